@@ -4,17 +4,18 @@ import (
 	"log"
 	"log/slog"
 	"os"
+	"strings"
 
-	"github.com/joho/godotenv"
 	"github.com/squarehole/package-scanner/pkg/cli"
 	"github.com/squarehole/package-scanner/pkg/logging"
+	"github.com/squarehole/package-scanner/pkg/redact"
 	"github.com/squarehole/package-scanner/pkg/scanner"
 	"github.com/squarehole/package-scanner/pkg/tui"
 )
 
 func main() {
 	// Load .env file if it exists
-	err := godotenv.Load()
+	err := cli.LoadEnvFile()
 	if err != nil {
 		log.Println("Warning: .env file not found or cannot be read. Using defaults and command line flags.")
 	} else {
@@ -62,6 +63,9 @@ func main() {
 		Compress:    config.LogCompress,
 		Level:       parseLogLevel(config.LogLevel),
 		Format:      logging.ParseLogFormat(config.LogFormat),
+		// Findings or results on stdout must not be interleaved with log lines
+		Stderr: config.OutputToStdout(),
+		Quiet:  config.LogQuiet,
 	}
 
 	logger, err := logging.SetupLogger(logConfig)
@@ -69,13 +73,28 @@ func main() {
 		log.Fatalf("Error setting up logger: %v", err)
 	}
 
-	logger.Info("Package Scanner starting", "version", "1.0.0")
+	// Reports meant for external sharing are redacted as they are written; results
+	// saved to the database keep the original values
+	if config.Redact != "" {
+		redactor, err := redact.Load(config.Redact)
+		if err != nil {
+			log.Fatalf("Error loading redaction profile: %v", err)
+		}
+		logger = slog.New(redact.NewHandler(logger.Handler(), redactor))
+		slog.SetDefault(logger)
+	}
+
+	logger.Info("Package Scanner starting", "version", cli.Version)
 
 	// Create and run the scanner controller
 	controller := scanner.NewController(config)
-	defer controller.Close()
-
 	controller.Run()
+	controller.Close()
+
+	// Operational errors and findings meeting the --fail-on threshold fail CI pipelines
+	if code := controller.ExitCode(); code != 0 {
+		os.Exit(code)
+	}
 }
 
 // convertTUIConfigToCLIConfig converts a TUI configuration to CLI configuration
@@ -88,6 +107,10 @@ func convertTUIConfigToCLIConfig(tuiConfig *tui.AppConfig) *cli.Config {
 		DBPassword:    tuiConfig.DBPassword,
 		DBName:        tuiConfig.DBName,
 		DBSSLMode:     tuiConfig.DBSSLMode,
+		DBSSLRootCert: tuiConfig.DBSSLRootCert,
+		DBSSLCert:     tuiConfig.DBSSLCert,
+		DBSSLKey:      tuiConfig.DBSSLKey,
+		DBSSLPassword: tuiConfig.DBSSLPassword,
 		UseDB:         tuiConfig.UseDB,
 		LogToFile:     tuiConfig.LogToFile,
 		LogFilePath:   tuiConfig.LogFilePath,
@@ -105,11 +128,11 @@ func convertTUIConfigToCLIConfig(tuiConfig *tui.AppConfig) *cli.Config {
 		config.PackageVersion = tuiConfig.PackageVersion
 		config.PackageEcosystem = tuiConfig.PackageEcosystem
 		// Clear directory scan fields
-		config.DirectoryPath = ""
+		config.DirectoryPaths = nil
 		config.FileExtension = ""
 	} else {
 		// Directory scan mode
-		config.DirectoryPath = tuiConfig.DirectoryPath
+		config.DirectoryPaths = splitList(tuiConfig.DirectoryPath)
 		config.FileExtension = tuiConfig.FileExtension
 		config.Concurrency = tuiConfig.Concurrency
 		// Clear single package fields
@@ -121,6 +144,17 @@ func convertTUIConfigToCLIConfig(tuiConfig *tui.AppConfig) *cli.Config {
 	return config
 }
 
+// splitList splits a comma-separated TUI field into its trimmed, non-empty values
+func splitList(value string) []string {
+	var values []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
+
 // parseLogLevel converts a string log level to slog.Level
 func parseLogLevel(level string) slog.Level {
 	switch level {
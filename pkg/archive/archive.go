@@ -0,0 +1,171 @@
+// Package archive keeps the reports and raw advisory responses of scan runs in object
+// storage, for retention periods the relational database is not meant to cover.
+package archive
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+	"github.com/squarehole/package-scanner/pkg/remote"
+)
+
+// Top-level prefixes of the archive. Keeping reports and raw responses apart lets
+// lifecycle rules treat them differently, e.g. expiring responses sooner.
+const (
+	reportsPrefix   = "reports"
+	responsesPrefix = "responses"
+)
+
+// Report is the JSON report of a run written to the archive
+type Report struct {
+	RunID    string            `json:"run_id"`
+	Command  string            `json:"command,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Started  time.Time         `json:"started"`
+	Finished time.Time         `json:"finished"`
+	Packages []PackageResult   `json:"packages"`
+}
+
+// PackageResult is the outcome of scanning one package
+type PackageResult struct {
+	Name            string                 `json:"name"`
+	Version         string                 `json:"version"`
+	Ecosystem       string                 `json:"ecosystem"`
+	Location        string                 `json:"location,omitempty"`
+	Checksum        string                 `json:"checksum,omitempty"`
+	Vulnerabilities []models.Vulnerability `json:"vulnerabilities"`
+	// Response is the archive URL of the raw advisory response the result came from
+	Response string `json:"response,omitempty"`
+}
+
+// Archive uploads the reports and raw advisory responses of a run below a location,
+// under prefixes that start with the kind of object and the run's date:
+//
+//	<location>/responses/YYYY/MM/DD/<run>/<ecosystem>/<name>/<version>.json
+//	<location>/reports/YYYY/MM/DD/<run>/report.json
+//
+// Responses are uploaded as they arrive; the report is written by Finish.
+// Methods are safe for concurrent use.
+type Archive struct {
+	writer  remote.Writer
+	runID   string
+	started time.Time
+
+	mu        sync.Mutex
+	packages  []PackageResult
+	responses map[string]string
+}
+
+// New creates the archive of a run started at the given time
+func New(location string, started time.Time) (*Archive, error) {
+	writer, err := remote.NewWriter(location)
+	if err != nil {
+		return nil, err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, fmt.Errorf("error generating run ID: %w", err)
+	}
+	started = started.UTC()
+	return &Archive{
+		writer:    writer,
+		runID:     started.Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix),
+		started:   started,
+		responses: make(map[string]string),
+	}, nil
+}
+
+// RunID returns the identifier of the run within the archive
+func (a *Archive) RunID() string {
+	return a.runID
+}
+
+// AddResponse uploads the raw advisory response for a package version and returns its URL
+func (a *Archive) AddResponse(name, version, ecosystem string, body []byte) (string, error) {
+	key := a.runPath(responsesPrefix) + url.PathEscape(ecosystem) + "/" + url.PathEscape(name) + "/" + url.PathEscape(version) + ".json"
+	if err := a.writer.Put(key, body, "application/json"); err != nil {
+		return "", err
+	}
+
+	location := a.writer.URL(key)
+	a.mu.Lock()
+	a.responses[responseKey(name, version, ecosystem)] = location
+	a.mu.Unlock()
+	return location, nil
+}
+
+// AddResult records the outcome of scanning a package for the run's report
+func (a *Archive) AddResult(result PackageResult) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if result.Response == "" {
+		result.Response = a.responses[responseKey(result.Name, result.Version, result.Ecosystem)]
+	}
+	if result.Vulnerabilities == nil {
+		result.Vulnerabilities = []models.Vulnerability{}
+	}
+	a.packages = append(a.packages, result)
+}
+
+// AddFile uploads a report file written during the run, such as the HTML report,
+// next to the run's JSON report
+func (a *Archive) AddFile(path, contentType string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading %s: %w", path, err)
+	}
+	key := a.runPath(reportsPrefix) + filepath.Base(path)
+	if err := a.writer.Put(key, data, contentType); err != nil {
+		return "", err
+	}
+	return a.writer.URL(key), nil
+}
+
+// Finish writes the run's JSON report and returns its URL
+func (a *Archive) Finish(command string, labels map[string]string) (string, error) {
+	a.mu.Lock()
+	report := Report{
+		RunID:    a.runID,
+		Command:  command,
+		Labels:   labels,
+		Started:  a.started,
+		Finished: time.Now().UTC(),
+		Packages: a.packages,
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	a.mu.Unlock()
+	if err != nil {
+		return "", fmt.Errorf("error encoding archive report: %w", err)
+	}
+
+	key := a.runPath(reportsPrefix) + reportFileName
+	if err := a.writer.Put(key, data, "application/json"); err != nil {
+		return "", err
+	}
+	return a.writer.URL(key), nil
+}
+
+// Pointer returns the small JSON document stored in the database in place of a raw
+// response that was archived, referring to the archived copy
+func Pointer(location string) []byte {
+	data, _ := json.Marshal(map[string]string{"archived": location})
+	return data
+}
+
+// runPath returns the path, ending in a slash, below which the run's objects of a kind are kept
+func (a *Archive) runPath(kind string) string {
+	return kind + "/" + a.started.Format("2006/01/02") + "/" + a.runID + "/"
+}
+
+// responseKey identifies the response of a package version within the run
+func responseKey(name, version, ecosystem string) string {
+	return ecosystem + "\x00" + name + "\x00" + version
+}
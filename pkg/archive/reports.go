@@ -0,0 +1,80 @@
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/remote"
+)
+
+// reportFileName is the name of a run's JSON report below its run path
+const reportFileName = "report.json"
+
+// LoadReports reads the JSON reports of the runs archived at a location that started at
+// or after since and carry all the given labels. Runs are found through the dates in
+// their paths, so reports of earlier days are not downloaded.
+func LoadReports(location string, since time.Time, labels map[string]string) ([]Report, error) {
+	store, err := remote.New(strings.TrimSuffix(location, "/") + "/" + reportsPrefix + "/")
+	if err != nil {
+		return nil, err
+	}
+	objects, err := store.List(0)
+	if err != nil {
+		return nil, fmt.Errorf("error listing archived reports: %w", err)
+	}
+
+	firstDay := since.UTC().Truncate(24 * time.Hour)
+	var reports []Report
+	for _, obj := range objects {
+		// Reports are kept as YYYY/MM/DD/<run>/report.json below the reports prefix
+		if path.Base(obj.Path) != reportFileName {
+			continue
+		}
+		parts := strings.Split(strings.TrimPrefix(obj.Path, "/"), "/")
+		if len(parts) < 5 {
+			continue
+		}
+		day, err := time.Parse("2006/01/02", strings.Join(parts[len(parts)-5:len(parts)-2], "/"))
+		if err != nil || day.Before(firstDay) {
+			continue
+		}
+
+		report, err := readReport(store, obj)
+		if err != nil {
+			return nil, err
+		}
+		if report.Started.Before(since) || !report.HasLabels(labels) {
+			continue
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// readReport downloads and decodes one archived report
+func readReport(store remote.Store, obj remote.Object) (Report, error) {
+	body, err := store.Open(obj.Path)
+	if err != nil {
+		return Report{}, fmt.Errorf("error reading archived report %s: %w", obj.URL, err)
+	}
+	defer body.Close()
+
+	var report Report
+	if err := json.NewDecoder(body).Decode(&report); err != nil {
+		return Report{}, fmt.Errorf("invalid archived report %s: %w", obj.URL, err)
+	}
+	return report, nil
+}
+
+// HasLabels reports whether the run was labelled with every one of the given labels
+func (r Report) HasLabels(labels map[string]string) bool {
+	for key, value := range labels {
+		if r.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
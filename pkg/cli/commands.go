@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"flag"
+	"strings"
+)
+
+// commands lists the supported subcommand groups and their actions; a group
+// without actions is a command on its own. Invocations that do not start with
+// one of these run a scan.
+var commands = map[string][]string{
+	"config":  {"show"},
+	"db":      {"schema", "migrate", "runs", "diff", "purge"},
+	"export":  {},
+	"history": {},
+	"keys":    {"generate", "rotate", "export"},
+	"offline": {"bundle", "load", "update"},
+	"policy":  {"import"},
+	"prime":   {},
+	"report":  {"aggregate", "trend", "status"},
+	"scan":    {"file"},
+	"search":  {},
+}
+
+// splitCommand separates a leading subcommand such as "offline bundle" from the
+// remaining arguments. An unknown action is kept in the command so it can be reported.
+func splitCommand(args []string) (string, []string) {
+	if len(args) == 0 {
+		return "", args
+	}
+
+	actions, ok := commands[args[0]]
+	if !ok {
+		return "", args
+	}
+	if len(actions) == 0 || len(args) < 2 || strings.HasPrefix(args[1], "-") {
+		return args[0], args[1:]
+	}
+
+	for _, action := range actions {
+		if args[1] == action {
+			return args[0] + " " + action, args[2:]
+		}
+	}
+	return args[0] + " " + args[1], args[2:]
+}
+
+// parseInterleaved parses flags that may appear before, between or after
+// positional arguments, returning the positional arguments in order
+func parseInterleaved(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// CommandNames returns the full names of all supported subcommands
+func CommandNames() []string {
+	var names []string
+	for group, actions := range commands {
+		if len(actions) == 0 {
+			names = append(names, group)
+		}
+		for _, action := range actions {
+			names = append(names, group+" "+action)
+		}
+	}
+	return names
+}
@@ -0,0 +1,337 @@
+package cli
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stringSliceFlag is a flag.Value that collects repeated flag values.
+// Each occurrence may also contain a comma-separated list of values.
+type stringSliceFlag []string
+
+// String returns the collected values as a comma-separated list
+func (s *stringSliceFlag) String() string {
+	if s == nil {
+		return ""
+	}
+	return strings.Join(*s, ",")
+}
+
+// Set appends one or more comma-separated values to the flag
+func (s *stringSliceFlag) Set(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			*s = append(*s, part)
+		}
+	}
+	return nil
+}
+
+// keyValueFlag is a flag.Value that collects repeated key=value pairs.
+// Each occurrence may also contain a comma-separated list of pairs.
+type keyValueFlag map[string]string
+
+// String returns the collected pairs as a comma-separated list
+func (kv keyValueFlag) String() string {
+	pairs := make([]string, 0, len(kv))
+	for key, value := range kv {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set parses one or more comma-separated key=value pairs into the flag
+func (kv keyValueFlag) Set(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return fmt.Errorf("expected key=value, got %q", pair)
+		}
+		kv[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+	return nil
+}
+
+// EcosystemLimit holds the concurrency and politeness settings for one ecosystem
+type EcosystemLimit struct {
+	// Maximum number of concurrent requests (0 means no per-ecosystem limit)
+	Concurrency int
+	// Minimum delay between the start of consecutive requests
+	Delay time.Duration
+}
+
+// ecosystemLimitsFlag is a flag.Value that collects ecosystem=concurrency[:delay] settings,
+// e.g. "PyPI=2:500ms,npm=10"
+type ecosystemLimitsFlag map[string]EcosystemLimit
+
+// String returns the collected limits as a comma-separated list
+func (el ecosystemLimitsFlag) String() string {
+	pairs := make([]string, 0, len(el))
+	for ecosystem, limit := range el {
+		pairs = append(pairs, fmt.Sprintf("%s=%d:%s", ecosystem, limit.Concurrency, limit.Delay))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set parses one or more comma-separated ecosystem limits into the flag
+func (el ecosystemLimitsFlag) Set(value string) error {
+	pairs := keyValueFlag{}
+	if err := pairs.Set(value); err != nil {
+		return err
+	}
+
+	for ecosystem, setting := range pairs {
+		concurrencyStr, delayStr, hasDelay := strings.Cut(setting, ":")
+
+		var limit EcosystemLimit
+		if concurrencyStr != "" {
+			concurrency, err := strconv.Atoi(concurrencyStr)
+			if err != nil || concurrency < 0 {
+				return fmt.Errorf("invalid concurrency %q for %s", concurrencyStr, ecosystem)
+			}
+			limit.Concurrency = concurrency
+		}
+		if hasDelay {
+			delay, err := time.ParseDuration(delayStr)
+			if err != nil {
+				return fmt.Errorf("invalid delay %q for %s: %w", delayStr, ecosystem, err)
+			}
+			limit.Delay = delay
+		}
+
+		el[ecosystem] = limit
+	}
+	return nil
+}
+
+// ReportOutput is a machine-readable output of a scan's results, given with --output as
+// format or format=path
+type ReportOutput struct {
+	Format string
+	// Path is the file the output is written to; empty writes it to --out or stdout
+	Path string
+}
+
+// outputFlag is a flag.Value that collects repeated --output formats, e.g.
+// "json=results.json". Each occurrence may also contain a comma-separated list.
+type outputFlag []ReportOutput
+
+// String returns the collected outputs as a comma-separated list
+func (o *outputFlag) String() string {
+	if o == nil {
+		return ""
+	}
+	parts := make([]string, len(*o))
+	for i, output := range *o {
+		parts[i] = output.Format
+		if output.Path != "" {
+			parts[i] += "=" + output.Path
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// Set appends one or more comma-separated format[=path] outputs to the flag
+func (o *outputFlag) Set(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		format, path, _ := strings.Cut(part, "=")
+		format = strings.ToLower(strings.TrimSpace(format))
+		if format == "" {
+			return fmt.Errorf("expected format or format=path, got %q", part)
+		}
+		*o = append(*o, ReportOutput{Format: format, Path: strings.TrimSpace(path)})
+	}
+	return nil
+}
+
+// headerFlag is a flag.Value that collects repeated "Name: value" HTTP headers.
+// Unlike the other list flags, values are not split on commas, since header
+// values may legitimately contain them.
+type headerFlag http.Header
+
+// String returns the collected header names; values are omitted as they often hold secrets
+func (h headerFlag) String() string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// Set parses a single "Name: value" or "Name=value" header
+func (h headerFlag) Set(value string) error {
+	name, val, ok := strings.Cut(value, ":")
+	if !ok {
+		name, val, ok = strings.Cut(value, "=")
+	}
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return fmt.Errorf("expected \"Name: value\", got %q", value)
+	}
+	http.Header(h).Add(name, strings.TrimSpace(val))
+	return nil
+}
+
+// readHeaderFile loads "Name: value" headers from a file, one per line.
+// Blank lines and lines starting with # are ignored.
+func readHeaderFile(path string, headers headerFlag) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading headers file %s: %w", path, err)
+	}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := headers.Set(line); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, i+1, err)
+		}
+	}
+	return nil
+}
+
+// sinceFlag is a flag.Value holding a point in time given either as an age
+// relative to now ("7d", "2w", "12h") or as an RFC 3339 time or YYYY-MM-DD date
+type sinceFlag struct {
+	time.Time
+	value string
+}
+
+// String returns the value as given on the command line
+func (s *sinceFlag) String() string {
+	if s == nil {
+		return ""
+	}
+	return s.value
+}
+
+// Set parses an age or an absolute time
+func (s *sinceFlag) Set(value string) error {
+	t, err := ParseSince(value)
+	if err != nil {
+		return err
+	}
+	s.Time, s.value = t, strings.TrimSpace(value)
+	return nil
+}
+
+// ParseSince parses a point in time given either as an age relative to now ("7d",
+// "2w", "12h") or as an RFC 3339 time or YYYY-MM-DD date
+func ParseSince(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+
+	age, err := parseAge(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected an age such as 7d or 12h, or a date, got %q", value)
+	}
+	return time.Now().Add(-age), nil
+}
+
+// ParseUntil parses a point in time given either as an age ahead of now ("90d", "12w")
+// or as an RFC 3339 time or YYYY-MM-DD date
+func ParseUntil(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+
+	age, err := parseAge(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected an age such as 90d or 12w, or a date, got %q", value)
+	}
+	return time.Now().Add(age), nil
+}
+
+// parseAge parses a duration, additionally accepting days (d) and weeks (w)
+func parseAge(value string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if number, ok := strings.CutSuffix(value, suffix); ok {
+			n, err := strconv.ParseFloat(number, 64)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid age %q", value)
+			}
+			return time.Duration(n * float64(unit)), nil
+		}
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid age %q", value)
+	}
+	return age, nil
+}
+
+// DefaultAutoConcurrency is the most workers --concurrency=auto ramps up to unless a
+// maximum is given as auto:<max>
+const DefaultAutoConcurrency = 64
+
+// concurrencyFlag is a flag.Value holding a fixed number of workers, or "auto" to
+// adapt the number to the advisory source's response times, up to an optional maximum
+// given as "auto:32"
+type concurrencyFlag struct {
+	n    int
+	auto bool
+}
+
+// String returns the setting as it is given on the command line
+func (c *concurrencyFlag) String() string {
+	if c == nil {
+		return ""
+	}
+	if c.auto {
+		return fmt.Sprintf("auto:%d", c.n)
+	}
+	return strconv.Itoa(c.n)
+}
+
+// Set parses a number of workers or auto[:max]
+func (c *concurrencyFlag) Set(value string) error {
+	value = strings.TrimSpace(value)
+	if rest, ok := strings.CutPrefix(value, "auto"); ok {
+		n := DefaultAutoConcurrency
+		if maxStr, ok := strings.CutPrefix(rest, ":"); ok {
+			var err error
+			if n, err = strconv.Atoi(maxStr); err != nil || n < 1 {
+				return fmt.Errorf("invalid maximum concurrency %q", maxStr)
+			}
+		} else if rest != "" {
+			return fmt.Errorf("expected a number of workers, auto or auto:<max>, got %q", value)
+		}
+		c.n, c.auto = n, true
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return fmt.Errorf("expected a number of workers, auto or auto:<max>, got %q", value)
+	}
+	c.n, c.auto = n, false
+	return nil
+}
@@ -0,0 +1,242 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Sources a setting's value can come from, in order of precedence
+const (
+	sourceFlag    = "flag"
+	sourceEnv     = "env"
+	sourceEnvFile = ".env"
+	sourceDefault = "default"
+)
+
+// flagEnv names the environment variables read as defaults for each flag
+var flagEnv = map[string][]string{
+	"lockfile":            {"LOCKFILES"},
+	"auto":                {"AUTO_DIRS"},
+	"skip-unpublished":    {"SKIP_UNPUBLISHED"},
+	"sbom":                {"SBOM_FILES"},
+	"reachability":        {"REACHABILITY"},
+	"resolve":             {"RESOLVE_MANIFESTS"},
+	"skip-dev":            {"SKIP_DEV"},
+	"nuspec-deps":         {"NUSPEC_DEPENDENCIES"},
+	"modified-since":      {"MODIFIED_SINCE"},
+	"include":             {"INCLUDE_PATTERNS"},
+	"exclude":             {"EXCLUDE_PATTERNS"},
+	"max-depth":           {"MAX_DEPTH"},
+	"follow-symlinks":     {"FOLLOW_SYMLINKS"},
+	"walker-concurrency":  {"WALKER_CONCURRENCY"},
+	"self-test-threshold": {"SELF_TEST_THRESHOLD"},
+	"ecosystem-limits":    {"ECOSYSTEM_LIMITS"},
+	"rate-limit":          {"OSV_RATE_LIMIT"},
+	"max-in-flight":       {"MAX_IN_FLIGHT"},
+	"registry-limits":     {"REGISTRY_LIMITS"},
+	"db-host":             {"DB_HOST"},
+	"db-port":             {"DB_PORT"},
+	"db-user":             {"DB_USER"},
+	"db-password":         {"DB_PASSWORD"},
+	"db-name":             {"DB_NAME"},
+	"db-sslmode":          {"DB_SSL_MODE"},
+	"db-sslrootcert":      {"DB_SSL_ROOT_CERT"},
+	"db-sslcert":          {"DB_SSL_CERT"},
+	"db-sslkey":           {"DB_SSL_KEY"},
+	"db-sslpassword":      {"DB_SSL_PASSWORD"},
+	"db-url":              {"DATABASE_URL"},
+	"db-schema":           {"DB_SCHEMA"},
+	"db-table-prefix":     {"DB_TABLE_PREFIX"},
+	"save-db":             {"USE_DB"},
+	"db-no-ddl":           {"DB_NO_DDL"},
+	"db-history":          {"DB_HISTORY"},
+	"record-clean":        {"RECORD_CLEAN"},
+	"db-batch-size":       {"DB_BATCH_SIZE"},
+	"db-max-open-conns":   {"DB_MAX_OPEN_CONNS"},
+	"db-max-idle-conns":   {"DB_MAX_IDLE_CONNS"},
+	"db-conn-lifetime":    {"DB_CONN_LIFETIME"},
+	"db-connect-timeout":  {"DB_CONNECT_TIMEOUT"},
+	"db-query-timeout":    {"DB_QUERY_TIMEOUT"},
+	"osv-api":             {"OSV_API_URL"},
+	"mock-osv":            {"MOCK_OSV_FIXTURES"},
+	"record":              {"OSV_RECORD"},
+	"replay":              {"OSV_REPLAY"},
+	"osv-header":          {"OSV_HEADERS", "OSV_API_TOKEN"},
+	"osv-headers-file":    {"OSV_HEADERS_FILE"},
+	"cache-dir":           {"QUERY_CACHE_DIR"},
+	"cache-ttl":           {"QUERY_CACHE_TTL"},
+	"incremental":         {"INCREMENTAL"},
+	"state-file":          {"STATE_FILE"},
+	"state-freshness":     {"STATE_FRESHNESS"},
+	"checkpoint":          {"CHECKPOINT_FILE"},
+	"resume":              {"RESUME"},
+	"sources":             {"VULN_SOURCES"},
+	"gitlab-db":           {"GITLAB_ADVISORY_DB"},
+	"vex":                 {"VEX_FILES"},
+	"policy":              {"POLICY_FILE"},
+	"baseline":            {"BASELINE_FILE"},
+	"write-baseline":      {"WRITE_BASELINE"},
+	"baseline-expires":    {"BASELINE_EXPIRES"},
+	"no-default-filter":   {"NO_DEFAULT_FILTERS"},
+	"verify-provenance":   {"VERIFY_PROVENANCE"},
+	"require-provenance":  {"REQUIRE_PROVENANCE"},
+	"verify-signatures":   {"VERIFY_SIGNATURES"},
+	"signature-roots":     {"SIGNATURE_ROOTS"},
+	"cosign-key":          {"COSIGN_PUBLIC_KEY"},
+	"offline":             {"OFFLINE"},
+	"offline-dir":         {"OFFLINE_DIR"},
+	"osv-bulk-url":        {"OSV_BULK_URL"},
+	"epss-url":            {"EPSS_URL"},
+	"kev-url":             {"KEV_URL"},
+	"keys-dir":            {"SIGNING_KEYS_DIR"},
+	"oidc-issuer":         {"SIGSTORE_OIDC_ISSUER"},
+	"identity":            {"SIGSTORE_IDENTITY"},
+	"check-latest":        {"CHECK_LATEST"},
+	"registry":            {"REGISTRY_URLS"},
+	"locale":              {"REPORT_LOCALE"},
+	"label":               {"RUN_LABELS"},
+	"redact":              {"REDACT_PROFILE"},
+	"html":                {"HTML_REPORT"},
+	"cyclonedx":           {"CYCLONEDX_REPORT"},
+	"report-translations": {"REPORT_TRANSLATIONS"},
+	"stats":               {"SCAN_STATS"},
+	"pins":                {"PINS_DIR"},
+	"output":              {"OUTPUT_FORMAT"},
+	"template":            {"REPORT_TEMPLATE"},
+	"compare":             {"COMPARE_RESULTS"},
+	"archive":             {"ARCHIVE_LOCATION"},
+	"summary-only":        {"SUMMARY_ONLY"},
+	"summary":             {"SUMMARY"},
+	"fail-on":             {"FAIL_ON"},
+	"log-to-file":         {"LOG_TO_FILE"},
+	"log-file":            {"LOG_FILE_PATH"},
+	"log-max-size":        {"LOG_MAX_SIZE"},
+	"log-max-backups":     {"LOG_MAX_BACKUPS"},
+	"log-max-age":         {"LOG_MAX_AGE"},
+	"log-compress":        {"LOG_COMPRESS"},
+	"log-level":           {"LOG_LEVEL"},
+	"log-format":          {"LOG_FORMAT"},
+	"quiet":               {"QUIET"},
+}
+
+// secretFlags hold credentials whose values are never shown
+var secretFlags = map[string]bool{
+	"db-password":    true,
+	"db-sslpassword": true,
+}
+
+// redactedValue replaces secret values in config show
+const redactedValue = "<redacted>"
+
+// envFileKeys records the variables supplied by the .env file rather than the environment
+var envFileKeys = make(map[string]bool)
+
+// LoadEnvFile loads the .env file into the environment. Variables already set in the
+// environment take precedence; the ones taken from the file are remembered so
+// config show can report where each setting came from.
+func LoadEnvFile() error {
+	values, err := godotenv.Read()
+	if err != nil {
+		return err
+	}
+	for key, value := range values {
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("error setting %s: %w", key, err)
+		}
+		envFileKeys[key] = true
+	}
+	return nil
+}
+
+// Setting is one entry of the effective configuration
+type Setting struct {
+	Flag   string `json:"flag" yaml:"flag"`
+	Value  string `json:"value" yaml:"value"`
+	Source string `json:"source" yaml:"source"`
+	// Env is the environment variable the value was read from, if any
+	Env string `json:"env,omitempty" yaml:"env,omitempty"`
+}
+
+// EffectiveSettings returns the resolved value of every flag and where it came from:
+// the command line, the environment, the .env file or the built-in default.
+// Secrets are redacted. It must be called after the flags are parsed.
+func EffectiveSettings() []Setting {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var settings []Setting
+	flag.VisitAll(func(f *flag.Flag) {
+		setting := Setting{Flag: f.Name, Value: f.Value.String(), Source: sourceDefault}
+		switch {
+		case set[f.Name]:
+			setting.Source = sourceFlag
+		default:
+			for _, key := range flagEnv[f.Name] {
+				if os.Getenv(key) == "" {
+					continue
+				}
+				setting.Source, setting.Env = sourceEnv, key
+				if envFileKeys[key] {
+					setting.Source = sourceEnvFile
+				}
+				break
+			}
+		}
+
+		if secretFlags[f.Name] && setting.Value != "" {
+			setting.Value = redactedValue
+		} else {
+			setting.Value = redactURLPassword(setting.Value)
+		}
+		settings = append(settings, setting)
+	})
+	return settings
+}
+
+// urlPassword matches the password of credentials embedded in URLs, e.g. in --db-url or
+// registry overrides, including those with an empty user name
+var urlPassword = regexp.MustCompile(`(://[^:/@\s]*:)[^@\s]+@`)
+
+// urlQueryPassword matches passwords given as query parameters, e.g. in --db-url
+var urlQueryPassword = regexp.MustCompile(`([?&](?:ssl)?password=)[^&\s]+`)
+
+// redactURLPassword hides the passwords of any URLs with credentials in a value
+func redactURLPassword(value string) string {
+	value = urlPassword.ReplaceAllString(value, "${1}"+redactedValue+"@")
+	return urlQueryPassword.ReplaceAllString(value, "${1}"+redactedValue)
+}
+
+// WriteSettings writes the effective configuration as yaml (the default) or json
+func WriteSettings(w io.Writer, format string) error {
+	settings := EffectiveSettings()
+	switch format {
+	case "", "yaml":
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(map[string][]Setting{"settings": settings}); err != nil {
+			return fmt.Errorf("error encoding configuration: %w", err)
+		}
+		return encoder.Close()
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(map[string][]Setting{"settings": settings}); err != nil {
+			return fmt.Errorf("error encoding configuration: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported format %q (supported: yaml, json)", format)
+	}
+}
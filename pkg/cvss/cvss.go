@@ -0,0 +1,193 @@
+package cvss
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+)
+
+// Vector represents a parsed CVSS base vector (https://www.first.org/cvss/)
+type Vector struct {
+	// Version is "2.0", "3.0", "3.1" or "4.0"
+	Version string
+	// Metrics maps each metric abbreviation, such as AV, to its value, such as N
+	Metrics map[string]string
+	raw     string
+}
+
+// baseMetrics are the metrics a vector of each version must set, with their allowed values
+var baseMetrics = map[string]map[string][]string{
+	"2.0": {
+		"AV": {"L", "A", "N"}, "AC": {"H", "M", "L"}, "Au": {"M", "S", "N"},
+		"C": {"N", "P", "C"}, "I": {"N", "P", "C"}, "A": {"N", "P", "C"},
+	},
+	"3": {
+		"AV": {"N", "A", "L", "P"}, "AC": {"L", "H"}, "PR": {"N", "L", "H"}, "UI": {"N", "R"},
+		"S": {"U", "C"}, "C": {"H", "L", "N"}, "I": {"H", "L", "N"}, "A": {"H", "L", "N"},
+	},
+	"4.0": {
+		"AV": {"N", "A", "L", "P"}, "AC": {"L", "H"}, "AT": {"N", "P"}, "PR": {"N", "L", "H"},
+		"UI": {"N", "P", "A"}, "VC": {"H", "L", "N"}, "VI": {"H", "L", "N"}, "VA": {"H", "L", "N"},
+		"SC": {"H", "L", "N"}, "SI": {"H", "L", "N"}, "SA": {"H", "L", "N"},
+	},
+}
+
+// Parse parses a CVSS vector: a v3 or v4 vector with its "CVSS:3.1/" style prefix, or
+// a v2 vector, which has none, such as "AV:N/AC:L/Au:N/C:P/I:P/A:P". Metrics beyond the
+// base metrics, such as temporal ones, are kept but not scored.
+func Parse(s string) (Vector, error) {
+	s = strings.TrimSpace(s)
+	v := Vector{Version: "2.0", Metrics: make(map[string]string), raw: s}
+
+	rest := strings.TrimSuffix(strings.TrimPrefix(s, "("), ")")
+	if prefix, metrics, ok := strings.Cut(rest, "/"); ok && strings.HasPrefix(prefix, "CVSS:") {
+		v.Version = strings.TrimPrefix(prefix, "CVSS:")
+		rest = metrics
+	}
+	family := v.Version
+	switch v.Version {
+	case "2.0", "4.0":
+	case "3.0", "3.1":
+		family = "3"
+	default:
+		return Vector{}, fmt.Errorf("invalid CVSS vector %q: unsupported version %s", s, v.Version)
+	}
+
+	for _, part := range strings.Split(rest, "/") {
+		metric, value, ok := strings.Cut(part, ":")
+		if !ok || metric == "" || value == "" {
+			return Vector{}, fmt.Errorf("invalid CVSS vector %q: malformed metric %q", s, part)
+		}
+		if _, seen := v.Metrics[metric]; seen {
+			return Vector{}, fmt.Errorf("invalid CVSS vector %q: metric %s set twice", s, metric)
+		}
+		v.Metrics[metric] = value
+	}
+
+	for _, metric := range slices.Sorted(maps.Keys(baseMetrics[family])) {
+		allowed := baseMetrics[family][metric]
+		value, ok := v.Metrics[metric]
+		if !ok {
+			return Vector{}, fmt.Errorf("invalid CVSS vector %q: missing base metric %s", s, metric)
+		}
+		if !slices.Contains(allowed, value) {
+			return Vector{}, fmt.Errorf("invalid CVSS vector %q: invalid value %s for metric %s", s, value, metric)
+		}
+	}
+	return v, nil
+}
+
+// String returns the vector as it was parsed
+func (v Vector) String() string {
+	return v.raw
+}
+
+// Scored reports whether BaseScore can score the vector. CVSS v4 scores come from a
+// lookup table of metric combinations rather than a formula, so v4 vectors are parsed
+// and validated but not scored.
+func (v Vector) Scored() bool {
+	return v.Version != "4.0"
+}
+
+// BaseScore computes the base score of the vector, from 0.0 to 10.0, or 0 for a vector
+// that is not Scored
+func (v Vector) BaseScore() float64 {
+	switch v.Version {
+	case "2.0":
+		return v.baseScoreV2()
+	case "3.0", "3.1":
+		return v.baseScoreV3()
+	}
+	return 0
+}
+
+// Severity returns the qualitative rating of a base score of the vector: None, Low,
+// Medium, High or Critical, using the v2 ranges of the NVD, which has no Critical, for
+// v2 vectors
+func (v Vector) Severity(score float64) string {
+	if v.Version == "2.0" {
+		switch {
+		case score >= 7:
+			return "High"
+		case score >= 4:
+			return "Medium"
+		default:
+			return "Low"
+		}
+	}
+	switch {
+	case score >= 9:
+		return "Critical"
+	case score >= 7:
+		return "High"
+	case score >= 4:
+		return "Medium"
+	case score > 0:
+		return "Low"
+	default:
+		return "None"
+	}
+}
+
+// baseScoreV3 implements the base score equations of CVSS v3.0 and v3.1
+func (v Vector) baseScoreV3() float64 {
+	m := v.Metrics
+	changed := m["S"] == "C"
+
+	attackVector := map[string]float64{"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2}[m["AV"]]
+	attackComplexity := map[string]float64{"L": 0.77, "H": 0.44}[m["AC"]]
+	privileges := map[string]float64{"N": 0.85, "L": 0.62, "H": 0.27}[m["PR"]]
+	if changed {
+		privileges = map[string]float64{"N": 0.85, "L": 0.68, "H": 0.5}[m["PR"]]
+	}
+	userInteraction := map[string]float64{"N": 0.85, "R": 0.62}[m["UI"]]
+	impactWeight := map[string]float64{"H": 0.56, "L": 0.22, "N": 0}
+
+	iss := 1 - (1-impactWeight[m["C"]])*(1-impactWeight[m["I"]])*(1-impactWeight[m["A"]])
+	impact := 6.42 * iss
+	if changed {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	}
+	if impact <= 0 {
+		return 0
+	}
+	exploitability := 8.22 * attackVector * attackComplexity * privileges * userInteraction
+
+	score := impact + exploitability
+	if changed {
+		score *= 1.08
+	}
+	return v.roundUp(math.Min(score, 10))
+}
+
+// roundUp rounds a v3 score up to one decimal. v3.1 first rounds to five decimals, so
+// floating-point error such as 4.000000001 does not round up to 4.1.
+func (v Vector) roundUp(score float64) float64 {
+	if v.Version == "3.0" {
+		return math.Ceil(score*10) / 10
+	}
+	scaled := int64(math.Round(score * 100000))
+	if scaled%10000 == 0 {
+		return float64(scaled) / 100000
+	}
+	return float64(scaled/10000+1) / 10
+}
+
+// baseScoreV2 implements the base score equation of CVSS v2
+func (v Vector) baseScoreV2() float64 {
+	m := v.Metrics
+	accessVector := map[string]float64{"L": 0.395, "A": 0.646, "N": 1.0}[m["AV"]]
+	accessComplexity := map[string]float64{"H": 0.35, "M": 0.61, "L": 0.71}[m["AC"]]
+	authentication := map[string]float64{"M": 0.45, "S": 0.56, "N": 0.704}[m["Au"]]
+	impactWeight := map[string]float64{"N": 0, "P": 0.275, "C": 0.660}
+
+	impact := 10.41 * (1 - (1-impactWeight[m["C"]])*(1-impactWeight[m["I"]])*(1-impactWeight[m["A"]]))
+	if impact == 0 {
+		return 0
+	}
+	exploitability := 20 * accessVector * accessComplexity * authentication
+	score := (0.6*impact + 0.4*exploitability - 1.5) * 1.176
+	return math.Round(score*10) / 10
+}
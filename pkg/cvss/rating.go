@@ -0,0 +1,83 @@
+package cvss
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+)
+
+// Preference orders the OSV severity types a vulnerability's CVSS vector is taken from;
+// v4 comes last as its vectors are not scored
+var Preference = []string{"CVSS_V3", "CVSS_V2", "CVSS_V4"}
+
+// Rating is the severity of a vulnerability, from its CVSS vector where it has one
+type Rating struct {
+	// Vector is the first vector of the vulnerability that parses, in Preference order,
+	// and HasVector reports whether there is one
+	Vector    Vector
+	HasVector bool
+	// Score is the base score of Vector, valid when Scored is set
+	Score  float64
+	Scored bool
+	// Severity is the rating of Score, the advisory's own severity if it has no score,
+	// or Unknown: one of Critical, High, Medium, Low, None or Unknown
+	Severity string
+}
+
+// Rate rates a vulnerability from the base score of its CVSS vector, falling back to
+// the severity the advisory gives itself, such as GitHub's database_specific severity
+func Rate(vuln models.Vulnerability) Rating {
+	rating := Rating{Severity: advisorySeverity(vuln)}
+	for _, severityType := range Preference {
+		for _, severity := range vuln.Severity {
+			if severity.Type != severityType || rating.HasVector {
+				continue
+			}
+			vector, err := Parse(severity.Score)
+			if err != nil {
+				continue
+			}
+			rating.Vector, rating.HasVector = vector, true
+			if vector.Scored() {
+				rating.Score, rating.Scored = vector.BaseScore(), true
+				rating.Severity = vector.Severity(rating.Score)
+			}
+		}
+	}
+	return rating
+}
+
+// String returns the rating out of 10 as the reports show it: the base score, such as
+// "7.5/10", or the range of scores of the advisory's own severity, such as "7.0-8.9/10"
+func (r Rating) String() string {
+	if r.Scored {
+		return fmt.Sprintf("%.1f/10", r.Score)
+	}
+	switch r.Severity {
+	case "Critical":
+		return "9.0+/10"
+	case "High":
+		return "7.0-8.9/10"
+	case "Medium":
+		return "4.0-6.9/10"
+	case "Low":
+		return "0.1-3.9/10"
+	}
+	return "Unknown"
+}
+
+// advisorySeverity returns the severity the advisory gives itself, or Unknown
+func advisorySeverity(vuln models.Vulnerability) string {
+	switch strings.ToUpper(vuln.DBSpecific.Severity) {
+	case "CRITICAL":
+		return "Critical"
+	case "HIGH":
+		return "High"
+	case "MEDIUM", "MODERATE":
+		return "Medium"
+	case "LOW":
+		return "Low"
+	}
+	return "Unknown"
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/squarehole/package-scanner/pkg/cvss"
+	"github.com/squarehole/package-scanner/pkg/models"
+)
+
+// AffectedRange is a range of versions of a package an advisory affects, as stored in
+// the affected_ranges column of a finding
+type AffectedRange struct {
+	// Type is the OSV range type, such as SEMVER, ECOSYSTEM or GIT, or empty for an expression
+	Type   string         `json:"type,omitempty"`
+	Events []models.Event `json:"events,omitempty"`
+	// Expression is the range as written by sources using range expressions, e.g. GitLab
+	Expression string `json:"expression,omitempty"`
+}
+
+// findingDetails holds the structured advisory data and score saved with a finding
+type findingDetails struct {
+	// aliases are the other IDs of the vulnerability, such as its CVE
+	aliases []string
+	// fixedVersions are the versions fixing the vulnerability, one per fixed event of
+	// any range, in the order of the advisory
+	fixedVersions []string
+	// affectedRanges is the JSON of the ranges of the package the vulnerability affects
+	affectedRanges string
+	// cvssVector is the CVSS vector of the advisory, and cvssScore its base score,
+	// which is NULL for CVSS v4 vectors
+	cvssVector sql.NullString
+	cvssScore  sql.NullFloat64
+	// severityLabel is the rating of cvssScore, the advisory's own severity if it has
+	// no score, or Unknown, and severityRating the same out of 10 for display
+	severityLabel  string
+	severityRating string
+}
+
+// getFindingDetails extracts the aliases, fixed versions and affected ranges of
+// packageName from an advisory, and scores its CVSS vector. Slices are never nil, so a finding saved without
+// any is told apart from one saved before they were stored.
+func getFindingDetails(vuln models.Vulnerability, packageName string) findingDetails {
+	details := findingDetails{
+		aliases:       append([]string{}, vuln.Aliases...),
+		fixedVersions: []string{},
+	}
+	ranges := []AffectedRange{}
+	for _, affected := range vuln.Affected {
+		if affected.Package.Name != packageName {
+			continue
+		}
+		for _, r := range affected.Ranges {
+			ranges = append(ranges, AffectedRange{Type: r.Type, Events: r.Events})
+			for _, event := range r.Events {
+				if event.Fixed != "" {
+					details.fixedVersions = append(details.fixedVersions, event.Fixed)
+				}
+			}
+		}
+		if affected.DatabaseSpecific.AffectedRange != "" {
+			ranges = append(ranges, AffectedRange{Expression: affected.DatabaseSpecific.AffectedRange})
+		}
+	}
+	// Ranges are plain strings, so encoding cannot fail
+	encoded, _ := json.Marshal(ranges)
+	details.affectedRanges = string(encoded)
+
+	rating := cvss.Rate(vuln)
+	details.severityLabel = rating.Severity
+	details.severityRating = rating.String()
+	if rating.HasVector {
+		details.cvssVector = sql.NullString{String: rating.Vector.String(), Valid: true}
+	}
+	if rating.Scored {
+		details.cvssScore = sql.NullFloat64{Float64: rating.Score, Valid: true}
+	}
+	return details
+}
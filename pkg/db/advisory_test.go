@@ -0,0 +1,79 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+)
+
+func TestGetFindingDetailsSeverity(t *testing.T) {
+	tests := []struct {
+		name       string
+		severity   []models.SeverityRating
+		advisory   string
+		wantVector string
+		wantScore  float64
+		wantLabel  string
+		wantRating string
+	}{
+		{
+			name:       "CVSS v3 vector",
+			severity:   []models.SeverityRating{{Type: "CVSS_V3", Score: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:N/A:N"}},
+			advisory:   "MODERATE",
+			wantVector: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:N/A:N",
+			wantScore:  7.5,
+			wantLabel:  "High",
+			wantRating: "7.5/10",
+		},
+		{
+			name: "v3 preferred to v2",
+			severity: []models.SeverityRating{
+				{Type: "CVSS_V2", Score: "AV:N/AC:L/Au:N/C:C/I:C/A:C"},
+				{Type: "CVSS_V3", Score: "CVSS:3.1/AV:N/AC:H/PR:N/UI:N/S:U/C:L/I:N/A:N"},
+			},
+			wantVector: "CVSS:3.1/AV:N/AC:H/PR:N/UI:N/S:U/C:L/I:N/A:N",
+			wantScore:  3.7,
+			wantLabel:  "Low",
+			wantRating: "3.7/10",
+		},
+		{
+			name:       "unscored v4 vector",
+			severity:   []models.SeverityRating{{Type: "CVSS_V4", Score: "CVSS:4.0/AV:N/AC:L/AT:N/PR:N/UI:N/VC:H/VI:H/VA:H/SC:N/SI:N/SA:N"}},
+			advisory:   "CRITICAL",
+			wantVector: "CVSS:4.0/AV:N/AC:L/AT:N/PR:N/UI:N/VC:H/VI:H/VA:H/SC:N/SI:N/SA:N",
+			wantLabel:  "Critical",
+			wantRating: "9.0+/10",
+		},
+		{
+			name:       "advisory severity only",
+			advisory:   "LOW",
+			wantLabel:  "Low",
+			wantRating: "0.1-3.9/10",
+		},
+		{
+			name:       "no severity",
+			wantLabel:  "Unknown",
+			wantRating: "Unknown",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vuln := models.Vulnerability{ID: "GHSA-1", Severity: tt.severity}
+			vuln.DBSpecific.Severity = tt.advisory
+
+			details := getFindingDetails(vuln, "lodash")
+			if details.cvssVector.String != tt.wantVector || details.cvssVector.Valid != (tt.wantVector != "") {
+				t.Errorf("cvss_vector = %+v, want %q", details.cvssVector, tt.wantVector)
+			}
+			if details.cvssScore.Float64 != tt.wantScore || details.cvssScore.Valid != (tt.wantScore != 0) {
+				t.Errorf("cvss_score = %+v, want %v", details.cvssScore, tt.wantScore)
+			}
+			if details.severityLabel != tt.wantLabel {
+				t.Errorf("severity_label = %q, want %q", details.severityLabel, tt.wantLabel)
+			}
+			if details.severityRating != tt.wantRating {
+				t.Errorf("severity_rating = %q, want %q", details.severityRating, tt.wantRating)
+			}
+		})
+	}
+}
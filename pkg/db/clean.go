@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// upsertCleanScanSQL records package versions found without vulnerabilities, given as
+// arrays of names, ecosystems, versions and checksums, linked to the scan run given by
+// the last parameter. A package recorded before keeps the time it was first checked and
+// is updated with the latest run and last_seen time, and its checksum if it has one.
+const upsertCleanScanSQL = `
+	INSERT INTO clean_scans (package_name, ecosystem, version, checksum, scan_id, last_seen)
+	SELECT DISTINCT ON (package_name, ecosystem, version)
+	       package_name, ecosystem, version, NULLIF(checksum, ''), $5::INTEGER, NOW()
+	FROM UNNEST($1::TEXT[], $2::TEXT[], $3::TEXT[], $4::TEXT[]) AS p(package_name, ecosystem, version, checksum)
+	ORDER BY package_name, ecosystem, version
+	ON CONFLICT (package_name, ecosystem, version) DO UPDATE SET
+		checksum = COALESCE(EXCLUDED.checksum, clean_scans.checksum),
+		scan_id = COALESCE(EXCLUDED.scan_id, clean_scans.scan_id),
+		last_seen = EXCLUDED.last_seen
+`
+
+// SaveCleanScan records that a package version was checked and found without
+// vulnerabilities, linked to the scan run with id runID, or to none if it is 0, so there
+// is evidence it was scanned
+func (p *PostgresDB) SaveCleanScan(ctx context.Context, runID int64, packageName string, ecosystem string, version string, checksum string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	err := saveCleanScans(ctx, p.db, runID, []PackageFindings{{
+		PackageName: packageName,
+		Ecosystem:   ecosystem,
+		Version:     version,
+		Checksum:    checksum,
+	}})
+	if err != nil {
+		return fmt.Errorf("error recording clean scan of %s@%s: %w", packageName, version, err)
+	}
+	return nil
+}
+
+// execer runs statements, on the database or in a transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// saveCleanScans records the package versions of clean, found without vulnerabilities,
+// in one statement
+func saveCleanScans(ctx context.Context, conn execer, runID int64, clean []PackageFindings) error {
+	names := make([]string, len(clean))
+	ecosystems := make([]string, len(clean))
+	versions := make([]string, len(clean))
+	checksums := make([]string, len(clean))
+	for i, pkg := range clean {
+		names[i], ecosystems[i], versions[i], checksums[i] = pkg.PackageName, pkg.Ecosystem, pkg.Version, pkg.Checksum
+	}
+	_, err := conn.ExecContext(ctx, upsertCleanScanSQL, pq.Array(names), pq.Array(ecosystems), pq.Array(versions),
+		pq.Array(checksums), sql.NullInt64{Int64: runID, Valid: runID != 0})
+	return err
+}
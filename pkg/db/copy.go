@@ -0,0 +1,159 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/squarehole/package-scanner/pkg/models"
+)
+
+// PackageFindings are the findings of a package version, saved together with
+// SaveVulnerabilityBatch. A package version without vulnerabilities is recorded as a
+// clean scan, like with SaveCleanScan.
+type PackageFindings struct {
+	PackageName string
+	Ecosystem   string
+	Version     string
+	// Checksum is the SHA-256 of the artifact the package was found in, or empty if there is none
+	Checksum        string
+	Vulnerabilities []models.Vulnerability
+	RawResponse     []byte
+}
+
+// findingColumns are the columns of vulnerability_scans written by a bulk save
+var findingColumns = []string{
+	"package_name", "ecosystem", "version", "vuln_id", "summary",
+	"published", "severity_rating", "fix_version", "raw_response", "checksum", "scan_id",
+	"aliases", "fixed_versions", "affected_ranges", "cvss_vector", "cvss_score", "severity_label", "last_seen",
+}
+
+// SaveVulnerabilityBatch saves the findings of many packages in one transaction, linked
+// to the scan run with id runID, or to none if it is 0. Rows are streamed with COPY,
+// which is far faster than inserting them one at a time. COPY cannot update existing
+// rows, so unless history is kept the rows are copied into a temporary table and merged
+// into vulnerability_scans from there, like SaveVulnerabilityResults. Packages without
+// findings are recorded in clean_scans in the same transaction.
+func (p *PostgresDB) SaveVulnerabilityBatch(ctx context.Context, runID int64, batch []PackageFindings) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	copyIn := pq.CopyIn("vulnerability_scans_batch", findingColumns...)
+	if p.keepHistory {
+		// pq.CopyIn quotes the table name, so it is named here rather than renamed
+		columns := append(append([]string{}, findingColumns...), "history")
+		copyIn = pq.CopyIn(p.naming.TablePrefix+"vulnerability_scans", columns...)
+		if p.naming.Schema != "" {
+			copyIn = pq.CopyInSchema(p.naming.Schema, p.naming.TablePrefix+"vulnerability_scans", columns...)
+		}
+	} else {
+		_, err = tx.ExecContext(ctx, `
+			CREATE TEMPORARY TABLE vulnerability_scans_batch ON COMMIT DROP AS
+			SELECT package_name, ecosystem, version, vuln_id, summary,
+			       published, severity_rating, fix_version, raw_response, checksum, scan_id,
+			       aliases, fixed_versions, affected_ranges, cvss_vector, cvss_score, severity_label, last_seen
+			FROM vulnerability_scans WITH NO DATA
+		`)
+		if err != nil {
+			return fmt.Errorf("error creating batch table: %w", err)
+		}
+	}
+
+	stmt, err := tx.PrepareContext(ctx, copyIn)
+	if err != nil {
+		return fmt.Errorf("error starting bulk copy: %w", err)
+	}
+	defer stmt.Close()
+
+	seen := time.Now()
+	rows := 0
+	var clean []PackageFindings
+	for _, pkg := range batch {
+		if len(pkg.Vulnerabilities) == 0 {
+			clean = append(clean, pkg)
+			continue
+		}
+		// COPY sends []byte as bytea, which JSONB does not accept
+		var rawResponse any
+		if pkg.RawResponse != nil {
+			rawResponse = string(pkg.RawResponse)
+		}
+		for _, vuln := range pkg.Vulnerabilities {
+			details := getFindingDetails(vuln, pkg.PackageName)
+			values := []any{
+				pkg.PackageName,
+				pkg.Ecosystem,
+				pkg.Version,
+				vuln.ID,
+				vuln.Summary,
+				vuln.Published,
+				details.severityRating,
+				findFixVersion(vuln, pkg.PackageName),
+				rawResponse,
+				sql.NullString{String: pkg.Checksum, Valid: pkg.Checksum != ""},
+				sql.NullInt64{Int64: runID, Valid: runID != 0},
+				pq.Array(details.aliases),
+				pq.Array(details.fixedVersions),
+				details.affectedRanges,
+				details.cvssVector,
+				details.cvssScore,
+				details.severityLabel,
+				seen,
+			}
+			if p.keepHistory {
+				values = append(values, true)
+			}
+			if _, err := stmt.ExecContext(ctx, values...); err != nil {
+				return fmt.Errorf("error copying finding %s of %s@%s: %w", vuln.ID, pkg.PackageName, pkg.Version, err)
+			}
+			rows++
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return fmt.Errorf("error completing bulk copy: %w", err)
+	}
+
+	// A batch can hold the same finding twice, which one upsert may not update twice
+	if !p.keepHistory {
+		_, err = tx.ExecContext(ctx, linkFindingSQL(`
+			INSERT INTO vulnerability_scans (
+				package_name, ecosystem, version, vuln_id, summary,
+				published, severity_rating, fix_version, raw_response, checksum, scan_id,
+				aliases, fixed_versions, affected_ranges, cvss_vector, cvss_score, severity_label, last_seen
+			)
+			SELECT DISTINCT ON (package_name, ecosystem, version, vuln_id)
+			       package_name, ecosystem, version, vuln_id, summary,
+			       published, severity_rating, fix_version, raw_response, checksum, scan_id,
+			       aliases, fixed_versions, affected_ranges, cvss_vector, cvss_score, severity_label, last_seen
+			FROM vulnerability_scans_batch
+			ORDER BY package_name, ecosystem, version, vuln_id
+		`+findingConflictSQL, "$1::INTEGER"), sql.NullInt64{Int64: runID, Valid: runID != 0})
+		if err != nil {
+			return fmt.Errorf("error merging batch: %w", err)
+		}
+	}
+
+	if len(clean) > 0 {
+		if err := saveCleanScans(ctx, tx, runID, clean); err != nil {
+			return fmt.Errorf("error recording clean scans: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing batch: %w", err)
+	}
+
+	slog.Info("Wrote vulnerability results to database in bulk",
+		"packages", len(batch),
+		"cleanPackages", len(clean),
+		"vulnCount", rows)
+	return nil
+}
@@ -0,0 +1,184 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// RunDiff compares the findings of two scan runs
+type RunDiff struct {
+	Base RunRecord `json:"base"`
+	Head RunRecord `json:"head"`
+	// New are the findings of the head run that the base run did not have
+	New []DiffFinding `json:"new"`
+	// Fixed are the findings of the base run that the head run no longer has
+	Fixed []DiffFinding `json:"fixed"`
+	// Persisting are the findings both runs have
+	Persisting []DiffFinding `json:"persisting"`
+}
+
+// DiffFinding is a vulnerability of a package in a run diff. Findings are matched by
+// package and vulnerability rather than version, so upgrading a package to another
+// vulnerable version leaves its vulnerability persisting.
+type DiffFinding struct {
+	PackageName    string `json:"package_name"`
+	Ecosystem      string `json:"ecosystem"`
+	VulnID         string `json:"vuln_id"`
+	Summary        string `json:"summary"`
+	SeverityRating string `json:"severity_rating"`
+	FixVersion     string `json:"fix_version"`
+	// BaseVersions and HeadVersions are the versions of the package each run found
+	// the vulnerability in
+	BaseVersions []string `json:"base_versions,omitempty"`
+	HeadVersions []string `json:"head_versions,omitempty"`
+}
+
+// runFindingSQL matches the findings seen by the scan run given by its parameter: those
+// it saved, and those it saved again after an earlier run, which now belong to a later
+// run if one saved them since
+const runFindingSQL = "(scan_id = $%[1]d OR id IN (SELECT finding_id FROM run_findings WHERE scan_id = $%[1]d))"
+
+// DiffRuns compares the findings of the scan runs with ids baseID and headID. A headID
+// of 0 compares the latest finished run, and a baseID of 0 the finished run of the same
+// target before the head run.
+func (p *PostgresDB) DiffRuns(ctx context.Context, baseID int64, headID int64) (RunDiff, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var diff RunDiff
+	var err error
+	if headID != 0 {
+		diff.Head, err = p.getRun(ctx, "id = $1", headID)
+	} else {
+		diff.Head, err = p.getRun(ctx, "finished_at IS NOT NULL")
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		if headID != 0 {
+			return RunDiff{}, fmt.Errorf("scan run %d not found", headID)
+		}
+		return RunDiff{}, errors.New("no finished scan run to compare")
+	} else if err != nil {
+		return RunDiff{}, fmt.Errorf("error getting scan run: %w", err)
+	}
+
+	if baseID != 0 {
+		diff.Base, err = p.getRun(ctx, "id = $1", baseID)
+	} else {
+		diff.Base, err = p.getRun(ctx, "finished_at IS NOT NULL AND COALESCE(target, '') = $1 AND (started_at, id) < ($2, $3)",
+			diff.Head.Target, diff.Head.StartedAt, diff.Head.ID)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		if baseID != 0 {
+			return RunDiff{}, fmt.Errorf("scan run %d not found", baseID)
+		}
+		return RunDiff{}, fmt.Errorf("no finished scan run of %q before run %d to compare", diff.Head.Target, diff.Head.ID)
+	} else if err != nil {
+		return RunDiff{}, fmt.Errorf("error getting scan run: %w", err)
+	}
+
+	base, err := p.runFindings(ctx, diff.Base.ID)
+	if err != nil {
+		return RunDiff{}, fmt.Errorf("error getting findings of scan run %d: %w", diff.Base.ID, err)
+	}
+	head, err := p.runFindings(ctx, diff.Head.ID)
+	if err != nil {
+		return RunDiff{}, fmt.Errorf("error getting findings of scan run %d: %w", diff.Head.ID, err)
+	}
+
+	diff.New, diff.Fixed, diff.Persisting = []DiffFinding{}, []DiffFinding{}, []DiffFinding{}
+	for key, finding := range head {
+		finding.HeadVersions = finding.versions
+		if before, ok := base[key]; ok {
+			finding.BaseVersions = before.versions
+			diff.Persisting = append(diff.Persisting, finding.DiffFinding)
+		} else {
+			diff.New = append(diff.New, finding.DiffFinding)
+		}
+	}
+	for key, finding := range base {
+		if _, ok := head[key]; !ok {
+			finding.BaseVersions = finding.versions
+			diff.Fixed = append(diff.Fixed, finding.DiffFinding)
+		}
+	}
+	for _, findings := range [][]DiffFinding{diff.New, diff.Fixed, diff.Persisting} {
+		sort.Slice(findings, func(i, j int) bool {
+			a, b := findings[i], findings[j]
+			if a.PackageName != b.PackageName {
+				return a.PackageName < b.PackageName
+			}
+			if a.Ecosystem != b.Ecosystem {
+				return a.Ecosystem < b.Ecosystem
+			}
+			return a.VulnID < b.VulnID
+		})
+	}
+	return diff, nil
+}
+
+// getRun gets the most recent scan run matching condition
+func (p *PostgresDB) getRun(ctx context.Context, condition string, args ...any) (RunRecord, error) {
+	row := p.db.QueryRowContext(ctx, `
+		SELECT `+runColumns+`
+		FROM scan_runs
+		WHERE `+condition+`
+		ORDER BY started_at DESC, id DESC
+		LIMIT 1
+	`, args...)
+	return scanRunRecord(row.Scan)
+}
+
+// runFinding is a vulnerability of a package seen by a scan run, in any of versions
+type runFinding struct {
+	DiffFinding
+	versions []string
+}
+
+// runFindings gets the findings seen by a scan run by package, ecosystem and
+// vulnerability, keeping the newest advisory data of each
+func (p *PostgresDB) runFindings(ctx context.Context, runID int64) (map[string]runFinding, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT package_name, ecosystem, version, vuln_id, COALESCE(summary, ''),
+		       COALESCE(severity_rating, ''), COALESCE(fix_version, '')
+		FROM vulnerability_scans
+		WHERE `+fmt.Sprintf(runFindingSQL, 1)+`
+		ORDER BY COALESCE(last_seen, created_at) DESC, version
+	`, runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	findings := map[string]runFinding{}
+	for rows.Next() {
+		var finding runFinding
+		var version string
+		err := rows.Scan(
+			&finding.PackageName,
+			&finding.Ecosystem,
+			&version,
+			&finding.VulnID,
+			&finding.Summary,
+			&finding.SeverityRating,
+			&finding.FixVersion,
+		)
+		if err != nil {
+			return nil, err
+		}
+		key := finding.PackageName + "\x00" + finding.Ecosystem + "\x00" + finding.VulnID
+		if seen, ok := findings[key]; ok {
+			finding = seen
+		}
+		finding.versions = append(finding.versions, version)
+		findings[key] = finding
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return findings, nil
+}
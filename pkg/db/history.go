@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ScanFilter selects stored findings. Zero values match every finding.
+type ScanFilter struct {
+	PackageName string
+	// Ecosystem is matched regardless of case
+	Ecosystem string
+	Version   string
+	// VulnID matches the ID of a vulnerability or any of its aliases, such as a CVE
+	VulnID string
+	// MinScore is the lowest CVSS base score matched, or for findings without one the
+	// score of their severity rating; findings with neither only match when it is 0
+	MinScore float64
+	// Since and Until bound the time findings were last seen
+	Since time.Time
+	Until time.Time
+	// RunID matches the findings seen by a scan run, including those a later run saved again
+	RunID int64
+	// Text is a web-search style query, such as "deserialization or log4j", matched
+	// against the summary and advisory response of each finding. Matches are ranked
+	// by relevance rather than by when they were last seen.
+	Text string
+	// Limit caps the number of findings returned, newest first
+	Limit int
+}
+
+// findingSearchVector is the full-text document of a finding, indexed by
+// idx_vuln_scans_search and matched by ScanFilter.Text; queries must use the same
+// expression for the index to apply. The response is truncated, as a tsvector is
+// limited to 1 MB and the responses of packages with many advisories can exceed it.
+const findingSearchVector = "to_tsvector('english', COALESCE(summary, '') || ' ' || LEFT(COALESCE(raw_response::text, ''), 200000))"
+
+// QueryScans gets the stored findings matching filter, most recently seen first, or
+// most relevant first when searching text
+func (p *PostgresDB) QueryScans(ctx context.Context, filter ScanFilter) ([]VulnerabilityRecord, error) {
+	var conditions []string
+	var args []any
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.PackageName != "" {
+		where("package_name = $%d", filter.PackageName)
+	}
+	if filter.Ecosystem != "" {
+		where("LOWER(ecosystem) = LOWER($%d)", filter.Ecosystem)
+	}
+	if filter.Version != "" {
+		where("version = $%d", filter.Version)
+	}
+	if filter.VulnID != "" {
+		where("(vuln_id = $%[1]d OR aliases @> ARRAY[$%[1]d::TEXT])", filter.VulnID)
+	}
+	if filter.MinScore > 0 {
+		// Findings without a CVSS score fall back to their rating, such as "7.5/10", "9.0+/10"
+		// or "7.0-8.9/10", of which the leading number is the score
+		where("COALESCE(cvss_score, CAST(SUBSTRING(severity_rating FROM '^[0-9]+(?:\\.[0-9]+)?') AS NUMERIC)) >= $%d", filter.MinScore)
+	}
+	if !filter.Since.IsZero() {
+		where("COALESCE(last_seen, created_at) >= $%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where("COALESCE(last_seen, created_at) < $%d", filter.Until)
+	}
+	if filter.RunID != 0 {
+		where(runFindingSQL, filter.RunID)
+	}
+	order := "COALESCE(last_seen, created_at) DESC, id DESC"
+	if filter.Text != "" {
+		where(findingSearchVector+" @@ websearch_to_tsquery('english', $%d)", filter.Text)
+		order = fmt.Sprintf("ts_rank(%s, websearch_to_tsquery('english', $%d)) DESC, %s", findingSearchVector, len(args), order)
+	}
+
+	query := `
+		SELECT id, package_name, ecosystem, version, vuln_id, summary, published,
+		       severity_rating, fix_version, COALESCE(cvss_vector, ''), cvss_score, COALESCE(severity_label, ''),
+		       aliases, fixed_versions, affected_ranges,
+		       raw_response, created_at, COALESCE(scan_id, 0), COALESCE(last_seen, created_at)
+		FROM vulnerability_scans`
+	if len(conditions) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(conditions, " AND ")
+	}
+	query += "\n\t\tORDER BY " + order
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf("\n\t\tLIMIT $%d", len(args))
+	}
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []VulnerabilityRecord{}
+	for rows.Next() {
+		var record VulnerabilityRecord
+		var ranges []byte
+		var score sql.NullFloat64
+		err := rows.Scan(
+			&record.ID,
+			&record.PackageName,
+			&record.Ecosystem,
+			&record.Version,
+			&record.VulnID,
+			&record.Summary,
+			&record.Published,
+			&record.SeverityRating,
+			&record.FixVersion,
+			&record.CVSSVector,
+			&score,
+			&record.SeverityLabel,
+			pq.Array(&record.Aliases),
+			pq.Array(&record.FixedVersions),
+			&ranges,
+			&record.RawResponse,
+			&record.CreatedAt,
+			&record.ScanID,
+			&record.LastSeen,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if score.Valid {
+			record.CVSSScore = &score.Float64
+		}
+		if ranges != nil {
+			if err := json.Unmarshal(ranges, &record.AffectedRanges); err != nil {
+				return nil, fmt.Errorf("error decoding affected ranges of finding %d: %w", record.ID, err)
+			}
+		}
+		records = append(records, record)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
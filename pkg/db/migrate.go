@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Migrate applies the schema migrations in order, each in its own transaction, and
+// returns the descriptions of the migrations applied. Migrations only create missing
+// tables, columns and indexes and fill in existing rows, so migrating an up-to-date
+// database changes nothing.
+func (p *PostgresDB) Migrate(ctx context.Context) ([]string, error) {
+	if statement := p.naming.createSchemaSQL(); statement != "" {
+		if _, err := p.db.ExecContext(ctx, statement); err != nil {
+			return nil, fmt.Errorf("error creating schema %s: %w", p.naming.Schema, err)
+		}
+	}
+	var applied []string
+	for i, m := range migrations {
+		if err := p.migrate(ctx, m); err != nil {
+			return applied, fmt.Errorf("migration %d (%s) failed: %w", i+1, m.Description, err)
+		}
+		applied = append(applied, m.Description)
+	}
+	return applied, nil
+}
+
+// migrate applies a migration in its own transaction. It is not bounded by the statement
+// timeout, as filling in the rows of a large table can take long.
+func (p *PostgresDB) migrate(ctx context.Context, m migration) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, m.sql()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// VerifySchema checks, without running any DDL, that every table, column and unique index
+// of the schema exists and that the connected role can read, insert into and, where the
+// scanner updates rows, update each table and use its id sequence.
+// It lets the scanner run as a least-privilege role while the schema is managed
+// separately with db migrate.
+func (p *PostgresDB) VerifySchema(ctx context.Context) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	var missing, denied []string
+	for _, m := range migrations {
+		for _, c := range m.Columns {
+			table := p.naming.Table(c.Table)
+			var exists bool
+			err := p.db.QueryRowContext(ctx, `
+				SELECT EXISTS (SELECT 1 FROM pg_attribute
+				               WHERE attrelid = to_regclass($1::text) AND attname = $2 AND NOT attisdropped)
+			`, table, c.Column.Name).Scan(&exists)
+			if err != nil {
+				return fmt.Errorf("error checking column %s.%s: %w", table, c.Column.Name, err)
+			}
+			if !exists {
+				missing = append(missing, table+"."+c.Column.Name)
+			}
+		}
+		// Saving findings relies on the unique index to detect a finding seen before
+		for _, idx := range m.Indexes {
+			if !idx.Unique {
+				continue
+			}
+			// An index lives in the schema of its table, so it is looked up like one
+			name := p.naming.Table(idx.Name)
+			var exists bool
+			if err := p.db.QueryRowContext(ctx, `SELECT to_regclass($1::text) IS NOT NULL`, name).Scan(&exists); err != nil {
+				return fmt.Errorf("error checking index %s: %w", name, err)
+			}
+			if !exists {
+				missing = append(missing, "index "+name)
+			}
+		}
+		for _, t := range m.Tables {
+			name := p.naming.Table(t.Name)
+			var exists bool
+			if err := p.db.QueryRowContext(ctx, `SELECT to_regclass($1::text) IS NOT NULL`, name).Scan(&exists); err != nil {
+				return fmt.Errorf("error checking table %s: %w", name, err)
+			}
+			if !exists {
+				missing = append(missing, name)
+				continue
+			}
+
+			var canSelect, canInsert, canUpdate, canUseSequence bool
+			err := p.db.QueryRowContext(ctx, `
+				SELECT has_table_privilege($1::text, 'SELECT'),
+				       has_table_privilege($1::text, 'INSERT'),
+				       has_table_privilege($1::text, 'UPDATE'),
+				       COALESCE(has_sequence_privilege(pg_get_serial_sequence($1::text, 'id'), 'USAGE'), TRUE)
+			`, name).Scan(&canSelect, &canInsert, &canUpdate, &canUseSequence)
+			if err != nil {
+				return fmt.Errorf("error checking privileges on %s: %w", name, err)
+			}
+			if !canSelect {
+				denied = append(denied, "SELECT on "+name)
+			}
+			if !canInsert {
+				denied = append(denied, "INSERT on "+name)
+			}
+			if t.Updated && !canUpdate {
+				denied = append(denied, "UPDATE on "+name)
+			}
+			if !canUseSequence {
+				denied = append(denied, "USAGE on the id sequence of "+name)
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("schema is not up to date, missing %s; run `package-scanner db migrate` "+
+			"as a role that can create tables", strings.Join(missing, ", "))
+	}
+	if len(denied) > 0 {
+		return fmt.Errorf("the connected role lacks %s", strings.Join(denied, ", "))
+	}
+	return nil
+}
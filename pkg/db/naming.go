@@ -0,0 +1,167 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Naming places the scanner's tables in a database shared with other teams or
+// applications: in a schema of their own, with a prefix on their names, or both
+type Naming struct {
+	// Schema holds the tables, such as security for security.vulnerability_scans, or is
+	// empty for the first schema of the search path, usually public
+	Schema string
+	// TablePrefix is put in front of the names of the tables and indexes, such as team_a_
+	// for team_a_vulnerability_scans
+	TablePrefix string
+}
+
+// maxIdentifierLength is the length PostgreSQL silently truncates longer names to
+const maxIdentifierLength = 63
+
+// identifier matches names that need no quoting in SQL
+var identifier = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// Validate checks that the schema and prefix are lowercase identifiers, which need no
+// quoting, and that no prefixed name would be truncated
+func (n Naming) Validate() error {
+	if n.Schema != "" && (!identifier.MatchString(n.Schema) || len(n.Schema) > maxIdentifierLength) {
+		return fmt.Errorf("schema %q is not a lowercase identifier of at most %d characters "+
+			"(letters, digits and underscores, not starting with a digit)", n.Schema, maxIdentifierLength)
+	}
+	if n.TablePrefix != "" && !identifier.MatchString(n.TablePrefix) {
+		return fmt.Errorf("table prefix %q is not made of lowercase letters, digits and underscores "+
+			"not starting with a digit", n.TablePrefix)
+	}
+	for _, name := range objectNames() {
+		if len(n.TablePrefix+name) > maxIdentifierLength {
+			return fmt.Errorf("table prefix %q is too long: %s%s exceeds %d characters",
+				n.TablePrefix, n.TablePrefix, name, maxIdentifierLength)
+		}
+	}
+	return nil
+}
+
+// Table returns the name of a table of the schema as it is written in SQL
+func (n Naming) Table(name string) string {
+	if n.Schema == "" {
+		return n.TablePrefix + name
+	}
+	return n.Schema + "." + n.TablePrefix + name
+}
+
+// createSchemaSQL returns the statement creating the schema, or nothing if the tables
+// are kept in the search path
+func (n Naming) createSchemaSQL() string {
+	if n.Schema == "" {
+		return ""
+	}
+	return "CREATE SCHEMA IF NOT EXISTS " + n.Schema + ";\n"
+}
+
+// objectName matches the names of the tables and indexes of the schema in SQL, after a
+// character that does not make them part of a longer, quoted or qualified name. The
+// temporary table of bulk saves is not matched, as it is not kept in a schema.
+var objectName = regexp.MustCompile(`(?:^|[^"\w.])(` + strings.Join(objectNames(), "|") + `)\b`)
+
+// objectNames returns the names of the tables and indexes of the schema
+func objectNames() []string {
+	var names []string
+	for _, m := range migrations {
+		for _, t := range m.Tables {
+			names = append(names, t.Name)
+		}
+		for _, idx := range m.Indexes {
+			names = append(names, idx.Name)
+		}
+	}
+	return names
+}
+
+// indexNames are the names of the indexes of the schema, which are prefixed but not
+// qualified with the schema
+var indexNames = func() map[string]bool {
+	names := make(map[string]bool)
+	for _, m := range migrations {
+		for _, idx := range m.Indexes {
+			names[idx.Name] = true
+		}
+	}
+	return names
+}()
+
+// rename rewrites the names of the tables and indexes in a query, which is written with
+// their plain names, to those of the schema
+func (n Naming) rename(query string) string {
+	if n == (Naming{}) {
+		return query
+	}
+	var b strings.Builder
+	last := 0
+	for _, match := range objectName.FindAllStringSubmatchIndex(query, -1) {
+		start, end := match[2], match[3]
+		name := query[start:end]
+		b.WriteString(query[last:start])
+		if indexNames[name] {
+			b.WriteString(n.TablePrefix + name)
+		} else {
+			b.WriteString(n.Table(name))
+		}
+		last = end
+	}
+	b.WriteString(query[last:])
+	return b.String()
+}
+
+// namedDB runs queries, which are written with the plain names of the tables, on the
+// tables of the schema
+type namedDB struct {
+	*sql.DB
+	naming Naming
+}
+
+// ExecContext executes a query without returning rows
+func (d namedDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return d.DB.ExecContext(ctx, d.naming.rename(query), args...)
+}
+
+// QueryContext executes a query returning rows
+func (d namedDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return d.DB.QueryContext(ctx, d.naming.rename(query), args...)
+}
+
+// QueryRowContext executes a query returning at most one row
+func (d namedDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return d.DB.QueryRowContext(ctx, d.naming.rename(query), args...)
+}
+
+// BeginTx starts a transaction whose queries are also run on the tables of the schema
+func (d namedDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (namedTx, error) {
+	tx, err := d.DB.BeginTx(ctx, opts)
+	return namedTx{Tx: tx, naming: d.naming}, err
+}
+
+// namedTx is a transaction of a namedDB
+type namedTx struct {
+	*sql.Tx
+	naming Naming
+}
+
+// ExecContext executes a query without returning rows
+func (t namedTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return t.Tx.ExecContext(ctx, t.naming.rename(query), args...)
+}
+
+// QueryContext executes a query returning rows
+func (t namedTx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return t.Tx.QueryContext(ctx, t.naming.rename(query), args...)
+}
+
+// PrepareContext creates a prepared statement. Quoted names, as written by pq.CopyIn,
+// are left alone.
+func (t namedTx) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return t.Tx.PrepareContext(ctx, t.naming.rename(query))
+}
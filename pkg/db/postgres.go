@@ -1,13 +1,17 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/squarehole/package-scanner/pkg/models"
+	"github.com/squarehole/package-scanner/pkg/usage"
 )
 
 // Config holds database connection configuration
@@ -18,6 +22,39 @@ type Config struct {
 	Password string
 	DBName   string
 	SSLMode  string
+	// SSLRootCert is the CA certificate the server certificate is verified against,
+	// or "system" for the system trust store
+	SSLRootCert string
+	// SSLCert and SSLKey are the client certificate and private key, for certificate authentication
+	SSLCert string
+	SSLKey  string
+	// SSLPassword decrypts an encrypted SSLKey
+	SSLPassword string
+	// KeepHistory saves every finding as a new row, kept as history, instead of updating
+	// the row of a finding seen before
+	KeepHistory bool
+
+	// MaxOpenConns and MaxIdleConns limit the open and idle connections of the pool; 0
+	// leaves open connections unlimited and idle ones at the database/sql default
+	MaxOpenConns int
+	MaxIdleConns int
+	// ConnMaxLifetime closes connections after they have been open this long, or never if 0
+	ConnMaxLifetime time.Duration
+	// ConnectTimeout bounds connecting to the server, and QueryTimeout each operation
+	// on scan data, such as saving the findings of a package, including the wait for a
+	// free connection; 0 waits indefinitely
+	ConnectTimeout time.Duration
+	QueryTimeout   time.Duration
+
+	// SearchPath and StatementTimeout are applied by the server to every connection;
+	// empty and 0 leave the server's settings in place
+	SearchPath       string
+	StatementTimeout time.Duration
+	// Params are further run-time parameters passed to the server, such as application_name
+	Params map[string]string
+
+	// Naming sets the schema and table prefix of the tables, to share a database with others
+	Naming
 }
 
 // VulnerabilityRecord represents a database record for vulnerability data
@@ -31,20 +68,57 @@ type VulnerabilityRecord struct {
 	Published      time.Time
 	SeverityRating string
 	FixVersion     string
+	// CVSSScore and SeverityLabel are computed from the advisory's CVSS vector, whereas
+	// SeverityRating is only a rough rating for display. CVSSVector is empty, and
+	// CVSSScore nil, for findings without a vector or saved before vectors were stored;
+	// CVSSScore is also nil for CVSS v4 vectors.
+	CVSSVector    string
+	CVSSScore     *float64
+	SeverityLabel string
+	// Aliases, FixedVersions and AffectedRanges are nil for findings saved before they
+	// were stored whose raw response did not include the advisory
+	Aliases        []string
+	FixedVersions  []string
+	AffectedRanges []AffectedRange
 	RawResponse    []byte // JSON data
 	CreatedAt      time.Time
+	// LastSeen is when the finding was last saved; it only differs from CreatedAt for
+	// findings seen again by later scans
+	LastSeen time.Time
+	// ScanID is the scan run that recorded the finding, or 0 if it was recorded outside one
+	ScanID int64
 }
 
 // PostgresDB wraps a connection to PostgreSQL
 type PostgresDB struct {
-	db *sql.DB
+	db           namedDB
+	naming       Naming
+	keepHistory  bool
+	queryTimeout time.Duration
 }
 
 // NewPostgresDB creates a new PostgreSQL database connection
 func NewPostgresDB(config Config) (*PostgresDB, error) {
+	if err := config.Naming.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid table naming: %w", err)
+	}
+	tlsOptions, err := config.tlsOptions()
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS configuration: %w", err)
+	}
+
 	// Connection string
-	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		config.Host, config.Port, config.User, config.Password, config.DBName, config.SSLMode)
+	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s %s",
+		quoteValue(config.Host), config.Port, quoteValue(config.User), quoteValue(config.Password),
+		quoteValue(config.DBName), strings.Join(tlsOptions, " "))
+	if options := config.runtimeOptions(); len(options) > 0 {
+		connStr += " " + strings.Join(options, " ")
+	}
+	if config.ConnectTimeout > 0 {
+		// connect_timeout is in whole seconds, and 0 would disable it
+		seconds := max(int((config.ConnectTimeout+time.Second-1)/time.Second), 1)
+		connStr += fmt.Sprintf(" connect_timeout=%d", seconds)
+	}
 
 	// Open a connection
 	db, err := sql.Open("postgres", connStr)
@@ -52,12 +126,37 @@ func NewPostgresDB(config Config) (*PostgresDB, error) {
 		return nil, fmt.Errorf("could not connect to PostgreSQL: %v", err)
 	}
 
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	if config.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(config.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(config.ConnMaxLifetime)
+
+	p := &PostgresDB{
+		db:           namedDB{DB: db, naming: config.Naming},
+		naming:       config.Naming,
+		keepHistory:  config.KeepHistory,
+		queryTimeout: config.QueryTimeout,
+	}
+
 	// Check the connection
-	if err := db.Ping(); err != nil {
+	ctx, cancel := p.withTimeout(context.Background())
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("could not ping PostgreSQL: %v", err)
 	}
 
-	return &PostgresDB{db: db}, nil
+	return p, nil
+}
+
+// withTimeout bounds a database operation by the query timeout, if one is set, so a
+// hung server fails the operation instead of blocking the scan
+func (p *PostgresDB) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, p.queryTimeout)
 }
 
 // Close closes the database connection
@@ -65,36 +164,25 @@ func (p *PostgresDB) Close() error {
 	return p.db.Close()
 }
 
-// InitializeSchema ensures the necessary tables exist
-func (p *PostgresDB) InitializeSchema() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS vulnerability_scans (
-		id SERIAL PRIMARY KEY,
-		package_name VARCHAR(255) NOT NULL,
-		ecosystem VARCHAR(100) NOT NULL,
-		version VARCHAR(100) NOT NULL,
-		vuln_id VARCHAR(100) NOT NULL,
-		summary TEXT,
-		published TIMESTAMP,
-		severity_rating VARCHAR(50),
-		fix_version VARCHAR(100),
-		raw_response JSONB,
-		created_at TIMESTAMP DEFAULT NOW()
-	);
-	
-	CREATE INDEX IF NOT EXISTS idx_vuln_scans_package ON vulnerability_scans(package_name, ecosystem, version);
-	`
-
-	_, err := p.db.Exec(schema)
+// InitializeSchema ensures the necessary tables exist. Like Migrate, it is not bounded by
+// the query timeout.
+func (p *PostgresDB) InitializeSchema(ctx context.Context) error {
+	_, err := p.db.DB.ExecContext(ctx, SchemaSQL(p.naming))
 	return err
 }
 
-// SaveVulnerabilityResults saves vulnerability scan results to the database
-func (p *PostgresDB) SaveVulnerabilityResults(packageName string, ecosystem string, version string,
+// SaveVulnerabilityResults saves vulnerability scan results to the database, linked to the
+// scan run with id runID, or to none if it is 0. Checksum is the SHA-256 of the artifact
+// the package was found in, or empty if there is none. A finding saved before is updated
+// with the latest advisory data, run and last_seen time, unless history is kept, in which
+// case every finding is inserted as a new row.
+func (p *PostgresDB) SaveVulnerabilityResults(ctx context.Context, runID int64, packageName string, ecosystem string, version string, checksum string,
 	vulnerabilities []models.Vulnerability, rawResponse []byte) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
 
 	// Begin a transaction
-	tx, err := p.db.Begin()
+	tx, err := p.db.BeginTx(ctx, nil)
 	if err != nil {
 		slog.Error("Failed to begin database transaction",
 			"error", err,
@@ -110,12 +198,11 @@ func (p *PostgresDB) SaveVulnerabilityResults(packageName string, ecosystem stri
 	}()
 
 	// Prepare the statement for inserting vulnerability records
-	stmt, err := tx.Prepare(`
-		INSERT INTO vulnerability_scans (
-			package_name, ecosystem, version, vuln_id, summary,
-			published, severity_rating, fix_version, raw_response
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-	`)
+	query := linkFindingSQL(insertFindingSQL, "$11")
+	if p.keepHistory {
+		query = insertFindingHistorySQL
+	}
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		slog.Error("Failed to prepare SQL statement",
 			"error", err,
@@ -145,20 +232,28 @@ func (p *PostgresDB) SaveVulnerabilityResults(packageName string, ecosystem stri
 			// Extract fix version
 			fixVersion := findFixVersion(vuln, packageName)
 
-			// Extract severity rating
-			severityRating := getSeverityRating(vuln)
+			// Extract aliases, fixed versions, affected ranges and CVSS score
+			details := getFindingDetails(vuln, packageName)
 
 			// Insert the record
-			_, err = stmt.Exec(
+			_, err = stmt.ExecContext(ctx,
 				packageName,
 				ecosystem,
 				version,
 				vuln.ID,
 				vuln.Summary,
 				vuln.Published,
-				severityRating,
+				details.severityRating,
 				fixVersion,
 				rawResponse,
+				sql.NullString{String: checksum, Valid: checksum != ""},
+				sql.NullInt64{Int64: runID, Valid: runID != 0},
+				pq.Array(details.aliases),
+				pq.Array(details.fixedVersions),
+				details.affectedRanges,
+				details.cvssVector,
+				details.cvssScore,
+				details.severityLabel,
 			)
 			if err != nil {
 				slog.Error("Failed to insert vulnerability record",
@@ -192,47 +287,107 @@ func (p *PostgresDB) SaveVulnerabilityResults(packageName string, ecosystem stri
 	return nil
 }
 
-// GetLatestScans gets the most recent vulnerability scans
-func (p *PostgresDB) GetLatestScans(limit int) ([]VulnerabilityRecord, error) {
-	rows, err := p.db.Query(`
-		SELECT id, package_name, ecosystem, version, vuln_id, summary, published, 
-		       severity_rating, fix_version, raw_response, created_at
-		FROM vulnerability_scans
-		ORDER BY created_at DESC
-		LIMIT $1
-	`, limit)
+// insertFindingSQL saves a finding, updating the row of the same finding if it was
+// saved before
+const insertFindingSQL = `
+	INSERT INTO vulnerability_scans (
+		package_name, ecosystem, version, vuln_id, summary,
+		published, severity_rating, fix_version, raw_response, checksum, scan_id,
+		aliases, fixed_versions, affected_ranges, cvss_vector, cvss_score, severity_label, last_seen
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, NOW())
+` + findingConflictSQL
+
+// linkFindingSQL extends an upsert of findings to record them in run_findings as seen
+// by the scan run given by the runID parameter, unless it is NULL. Rows kept as history
+// are not upserted and keep their own run, so they need no link.
+func linkFindingSQL(upsert string, runID string) string {
+	return "WITH saved AS (" + upsert + "\tRETURNING id\n)\n" +
+		"INSERT INTO run_findings (scan_id, finding_id)\n" +
+		"SELECT " + runID + ", id FROM saved WHERE " + runID + " IS NOT NULL\n" +
+		"ON CONFLICT DO NOTHING"
+}
+
+// findingConflictSQL updates the row of a finding saved before with the latest advisory
+// data, including its aliases and ranges, run and last_seen time. The checksum and run of the earlier row are kept if the
+// finding is now seen without them.
+const findingConflictSQL = `
+	ON CONFLICT (package_name, ecosystem, version, vuln_id) WHERE NOT history DO UPDATE SET
+		summary = EXCLUDED.summary,
+		published = EXCLUDED.published,
+		severity_rating = EXCLUDED.severity_rating,
+		fix_version = EXCLUDED.fix_version,
+		raw_response = EXCLUDED.raw_response,
+		aliases = EXCLUDED.aliases,
+		fixed_versions = EXCLUDED.fixed_versions,
+		affected_ranges = EXCLUDED.affected_ranges,
+		cvss_vector = EXCLUDED.cvss_vector,
+		cvss_score = EXCLUDED.cvss_score,
+		severity_label = EXCLUDED.severity_label,
+		checksum = COALESCE(EXCLUDED.checksum, vulnerability_scans.checksum),
+		scan_id = COALESCE(EXCLUDED.scan_id, vulnerability_scans.scan_id),
+		last_seen = EXCLUDED.last_seen
+`
+
+// insertFindingHistorySQL saves a finding as a new row kept as history, leaving the
+// rows of earlier scans untouched
+const insertFindingHistorySQL = `
+	INSERT INTO vulnerability_scans (
+		package_name, ecosystem, version, vuln_id, summary,
+		published, severity_rating, fix_version, raw_response, checksum, scan_id,
+		aliases, fixed_versions, affected_ranges, cvss_vector, cvss_score, severity_label, last_seen, history
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, NOW(), TRUE)
+`
+
+// SaveRunUsage records the resources used by a run, with the labels used to charge it back
+func (p *PostgresDB) SaveRunUsage(ctx context.Context, command string, labels map[string]string, u usage.Usage) error {
+	labelsJSON, err := json.Marshal(labels)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("error encoding run labels: %w", err)
 	}
-	defer rows.Close()
-
-	records := []VulnerabilityRecord{}
-	for rows.Next() {
-		var record VulnerabilityRecord
-		err := rows.Scan(
-			&record.ID,
-			&record.PackageName,
-			&record.Ecosystem,
-			&record.Version,
-			&record.VulnID,
-			&record.Summary,
-			&record.Published,
-			&record.SeverityRating,
-			&record.FixVersion,
-			&record.RawResponse,
-			&record.CreatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-		records = append(records, record)
+	callsJSON, err := json.Marshal(u.APICallsByHost)
+	if err != nil {
+		return fmt.Errorf("error encoding API call counts: %w", err)
+	}
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	_, err = p.db.ExecContext(ctx, `
+		INSERT INTO scan_run_usage (
+			command, labels, started_at, finished_at, cpu_seconds,
+			peak_memory_bytes, bytes_downloaded, api_calls, api_calls_by_host
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, command, labelsJSON, u.StartedAt, u.FinishedAt, u.CPUTime.Seconds(),
+		u.PeakMemoryBytes, u.BytesDownloaded, u.APICalls, callsJSON)
+	if err != nil {
+		return fmt.Errorf("error saving run usage: %w", err)
+	}
+	return nil
+}
+
+// CheckWritable writes a temporary row to the scan results table and rolls it back,
+// confirming the connected user can record results without leaving anything behind
+func (p *PostgresDB) CheckWritable(ctx context.Context) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	if err = rows.Err(); err != nil {
-		return nil, err
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO vulnerability_scans (package_name, ecosystem, version, vuln_id)
+		VALUES ($1, $2, $3, $4)
+	`, "package-scanner-self-test", "self-test", "0.0.0", "SELF-TEST")
+	if err != nil {
+		return fmt.Errorf("error writing to vulnerability_scans: %w", err)
 	}
+	return nil
+}
 
-	return records, nil
+// GetLatestScans gets the most recent vulnerability scans
+func (p *PostgresDB) GetLatestScans(ctx context.Context, limit int) ([]VulnerabilityRecord, error) {
+	return p.QueryScans(ctx, ScanFilter{Limit: limit})
 }
 
 // Helper functions ported from main.go to make this package self-contained
@@ -252,71 +407,3 @@ func findFixVersion(vuln models.Vulnerability, packageName string) string {
 	}
 	return "No fix version found"
 }
-
-// GetSeverityRating gets the severity rating as a string from the vulnerability
-func getSeverityRating(vuln models.Vulnerability) string {
-	// Try to get CVSS score first
-	if len(vuln.Severity) > 0 {
-		for _, sev := range vuln.Severity {
-			if sev.Type == "CVSS_V3" {
-				return extractCVSSScore(sev.Score)
-			}
-		}
-	}
-
-	// Fallback to database_specific severity
-	if vuln.DBSpecific.Severity != "" {
-		switch vuln.DBSpecific.Severity {
-		case "CRITICAL":
-			return "9.0+/10"
-		case "HIGH":
-			return "7.0-8.9/10"
-		case "MEDIUM":
-			return "4.0-6.9/10"
-		case "LOW":
-			return "0.1-3.9/10"
-		}
-	}
-
-	return "Unknown"
-}
-
-// Helper function to extract numeric CVSS score from a CVSS string
-func extractCVSSScore(cvssString string) string {
-	// Implementation copied from main.go
-	// CVSS strings are typically in format "CVSS:3.1/AV:N/AC:H/PR:N/UI:N/S:U/C:L/I:L/A:H"
-	if len(cvssString) == 0 {
-		return "N/A"
-	}
-
-	// Simple heuristic to estimate score out of 10
-	highCount := 0
-	mediumCount := 0
-	lowCount := 0
-
-	if cvssString[0:4] == "CVSS" {
-		// This is a proper CVSS string
-		highCount = countOccurrences(cvssString, ":H")
-		mediumCount = countOccurrences(cvssString, ":M")
-		lowCount = countOccurrences(cvssString, ":L")
-	}
-
-	// Simple heuristic for a score out of 10
-	score := float64(highCount)*3.0 + float64(mediumCount)*2.0 + float64(lowCount)*1.0
-	if score > 10.0 {
-		score = 10.0
-	}
-
-	return fmt.Sprintf("%.1f/10", score)
-}
-
-// countOccurrences counts how many times a substring appears in a string
-func countOccurrences(s, substr string) int {
-	count := 0
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			count++
-		}
-	}
-	return count
-}
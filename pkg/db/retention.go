@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RetentionPolicy selects the scan records a purge removes. Zero values disable each rule.
+type RetentionPolicy struct {
+	// Before removes the findings and clean scans last seen before this time, and the
+	// scan runs started before it that no longer have either
+	Before time.Time
+	// KeepRuns keeps, of each package, only the findings of the last KeepRuns scan runs
+	// that saw it. Findings saved outside a run count as the package's oldest run.
+	KeepRuns int
+}
+
+// PurgeResult counts the scan records removed by a purge
+type PurgeResult struct {
+	Findings   int64
+	CleanScans int64
+	Runs       int64
+}
+
+// Purge removes the scan records the retention policy no longer keeps, in one
+// transaction, so the tables do not grow without bound. Like Migrate, it is not bounded
+// by the query timeout, as purging a large table can take long.
+func (p *PostgresDB) Purge(ctx context.Context, policy RetentionPolicy) (PurgeResult, error) {
+	var purged PurgeResult
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return purged, fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if !policy.Before.IsZero() {
+		result, err := tx.ExecContext(ctx, `
+			DELETE FROM vulnerability_scans WHERE COALESCE(last_seen, created_at) < $1
+		`, policy.Before)
+		if err != nil {
+			return purged, fmt.Errorf("error purging findings: %w", err)
+		}
+		if purged.Findings, err = result.RowsAffected(); err != nil {
+			return purged, err
+		}
+
+		result, err = tx.ExecContext(ctx, `DELETE FROM clean_scans WHERE last_seen < $1`, policy.Before)
+		if err != nil {
+			return purged, fmt.Errorf("error purging clean scans: %w", err)
+		}
+		if purged.CleanScans, err = result.RowsAffected(); err != nil {
+			return purged, err
+		}
+	}
+
+	if policy.KeepRuns > 0 {
+		result, err := tx.ExecContext(ctx, `
+			DELETE FROM vulnerability_scans WHERE id IN (
+			    SELECT id FROM (
+			        SELECT id, DENSE_RANK() OVER (
+			            PARTITION BY package_name, ecosystem ORDER BY scan_id DESC NULLS LAST) AS run_rank
+			        FROM vulnerability_scans
+			    ) ranked
+			    WHERE run_rank > $1)
+		`, policy.KeepRuns)
+		if err != nil {
+			return purged, fmt.Errorf("error purging findings of older runs: %w", err)
+		}
+		findings, err := result.RowsAffected()
+		if err != nil {
+			return purged, err
+		}
+		purged.Findings += findings
+	}
+
+	// Runs are kept while they have findings or clean scans, and recent runs without
+	// any are kept as the record of a clean scan
+	if !policy.Before.IsZero() {
+		result, err := tx.ExecContext(ctx, `
+			DELETE FROM scan_runs r
+			WHERE r.started_at < $1 AND NOT EXISTS (SELECT 1 FROM vulnerability_scans v WHERE v.scan_id = r.id)
+			  AND NOT EXISTS (SELECT 1 FROM clean_scans c WHERE c.scan_id = r.id)
+		`, policy.Before)
+		if err != nil {
+			return purged, fmt.Errorf("error purging scan runs: %w", err)
+		}
+		if purged.Runs, err = result.RowsAffected(); err != nil {
+			return purged, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return purged, fmt.Errorf("error committing purge: %w", err)
+	}
+	return purged, nil
+}
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// RollupFilter selects the scan runs a rollup is built from
+type RollupFilter struct {
+	// Since is the earliest start of the runs included
+	Since time.Time
+	// Labels are labels every run included was started with; runs recorded before runs
+	// were labelled only match when it is empty
+	Labels map[string]string
+}
+
+// RollupRun is a scan run included in a rollup, with its labels, the findings it saw
+// and the package versions it recorded as clean
+type RollupRun struct {
+	Run    RunRecord
+	Labels map[string]string
+	// Findings only hold the package version, vulnerability ID, summary and severity
+	// label of each finding
+	Findings []VulnerabilityRecord
+	// Clean is empty unless the run was scanned with --record-clean
+	Clean []CleanScan
+}
+
+// rollupRunsSQL selects the ids of the scan runs started at or after $1 whose labels
+// contain $2
+const rollupRunsSQL = `
+		SELECT id FROM scan_runs
+		WHERE started_at >= $1 AND ($2::jsonb = '{}'::jsonb OR labels @> $2::jsonb)`
+
+// GetRollupRuns gets the scan runs started in the period of filter with all its labels,
+// oldest first, with the findings each run saw, including those a later run saved again,
+// and the package versions it recorded as clean. It only reads from the database.
+func (p *PostgresDB) GetRollupRuns(ctx context.Context, filter RollupFilter) ([]RollupRun, error) {
+	labels := filter.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labelsJSON, err := json.Marshal(labels)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding run labels: %w", err)
+	}
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT `+runColumns+`, labels
+		FROM scan_runs
+		WHERE id IN (`+rollupRunsSQL+`)
+		ORDER BY started_at, id
+	`, filter.Since, labelsJSON)
+	if err != nil {
+		return nil, fmt.Errorf("error getting scan runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []RollupRun{}
+	index := make(map[int64]int)
+	for rows.Next() {
+		var run RollupRun
+		var runLabels []byte
+		run.Run, err = scanRunRecord(func(dest ...any) error {
+			return rows.Scan(append(dest, &runLabels)...)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if runLabels != nil {
+			if err := json.Unmarshal(runLabels, &run.Labels); err != nil {
+				return nil, fmt.Errorf("invalid labels of scan run %d: %w", run.Run.ID, err)
+			}
+		}
+		index[run.Run.ID] = len(runs)
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return runs, nil
+	}
+
+	// A run saw the findings it saved, and those it saved again that a later run has
+	// saved since, as recorded in run_findings
+	rows, err = p.db.QueryContext(ctx, `
+		SELECT seen.scan_id, v.package_name, v.ecosystem, v.version, v.vuln_id,
+		       COALESCE(v.summary, ''), COALESCE(v.severity_label, '')
+		FROM (
+		    SELECT scan_id, id AS finding_id FROM vulnerability_scans WHERE scan_id IN (`+rollupRunsSQL+`)
+		    UNION
+		    SELECT scan_id, finding_id FROM run_findings WHERE scan_id IN (`+rollupRunsSQL+`)
+		) seen
+		JOIN vulnerability_scans v ON v.id = seen.finding_id
+		ORDER BY seen.scan_id, v.package_name, v.ecosystem, v.version, v.vuln_id
+	`, filter.Since, labelsJSON)
+	if err != nil {
+		return nil, fmt.Errorf("error getting findings of scan runs: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var runID int64
+		var finding VulnerabilityRecord
+		err := rows.Scan(&runID, &finding.PackageName, &finding.Ecosystem, &finding.Version, &finding.VulnID,
+			&finding.Summary, &finding.SeverityLabel)
+		if err != nil {
+			return nil, err
+		}
+		// Runs started since the runs were read are left out
+		i, ok := index[runID]
+		if !ok {
+			continue
+		}
+		finding.ScanID = runID
+		runs[i].Findings = append(runs[i].Findings, finding)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = p.db.QueryContext(ctx, `
+		SELECT scan_id, package_name, ecosystem, version, COALESCE(checksum, ''), last_seen
+		FROM clean_scans
+		WHERE scan_id IN (`+rollupRunsSQL+`)
+		ORDER BY scan_id, package_name, ecosystem, version
+	`, filter.Since, labelsJSON)
+	if err != nil {
+		return nil, fmt.Errorf("error getting clean scans of scan runs: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var runID int64
+		var clean CleanScan
+		if err := rows.Scan(&runID, &clean.PackageName, &clean.Ecosystem, &clean.Version, &clean.Checksum, &clean.LastSeen); err != nil {
+			return nil, err
+		}
+		if i, ok := index[runID]; ok {
+			runs[i].Clean = append(runs[i].Clean, clean)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
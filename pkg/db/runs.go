@@ -0,0 +1,189 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// RunRecord represents a scan run and the totals it recorded
+type RunRecord struct {
+	ID        int64     `json:"id"`
+	StartedAt time.Time `json:"started_at"`
+	// FinishedAt is zero for runs that did not finish, such as runs that failed
+	FinishedAt   time.Time `json:"finished_at"`
+	Target       string    `json:"target"`
+	PackageCount int       `json:"package_count"`
+	VulnCount    int       `json:"vuln_count"`
+	// Severities is zero for runs recorded before findings were counted per severity
+	Severities  SeverityCounts `json:"severities"`
+	ToolVersion string         `json:"tool_version"`
+}
+
+// SeverityCounts counts the findings of a scan run per severity level
+type SeverityCounts struct {
+	Critical int `json:"critical"`
+	High     int `json:"high"`
+	Medium   int `json:"medium"`
+	Low      int `json:"low"`
+	Unknown  int `json:"unknown"`
+}
+
+// StartRun records the start of a scan run with its labels and returns its id, to which
+// the findings saved during the run are linked
+func (p *PostgresDB) StartRun(ctx context.Context, target string, toolVersion string, labels map[string]string,
+	started time.Time) (int64, error) {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labelsJSON, err := json.Marshal(labels)
+	if err != nil {
+		return 0, fmt.Errorf("error encoding run labels: %w", err)
+	}
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	var id int64
+	err = p.db.QueryRowContext(ctx, `
+		INSERT INTO scan_runs (started_at, target, tool_version, labels)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, started, target, toolVersion, labelsJSON).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error recording scan run: %w", err)
+	}
+	return id, nil
+}
+
+// FinishRun records the end of a scan run with the number of packages it checked
+// and of vulnerabilities it found, in total and per severity
+func (p *PostgresDB) FinishRun(ctx context.Context, runID int64, finished time.Time, packageCount int, vulnCount int,
+	severities SeverityCounts) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	_, err := p.db.ExecContext(ctx, `
+		UPDATE scan_runs
+		SET finished_at = $2, package_count = $3, vuln_count = $4,
+		    critical_count = $5, high_count = $6, medium_count = $7, low_count = $8, unknown_count = $9
+		WHERE id = $1
+	`, runID, finished, packageCount, vulnCount,
+		severities.Critical, severities.High, severities.Medium, severities.Low, severities.Unknown)
+	if err != nil {
+		return fmt.Errorf("error recording end of scan run %d: %w", runID, err)
+	}
+	return nil
+}
+
+// GetRuns gets the most recent scan runs, newest first
+func (p *PostgresDB) GetRuns(ctx context.Context, limit int) ([]RunRecord, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT `+runColumns+`
+		FROM scan_runs
+		ORDER BY started_at DESC, id DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []RunRecord{}
+	for rows.Next() {
+		run, err := scanRunRecord(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+// runColumns are the columns of scan_runs read by scanRunRecord
+const runColumns = `id, started_at, finished_at, COALESCE(target, ''),
+		       COALESCE(package_count, 0), COALESCE(vuln_count, 0), COALESCE(tool_version, ''),
+		       COALESCE(critical_count, 0), COALESCE(high_count, 0), COALESCE(medium_count, 0),
+		       COALESCE(low_count, 0), COALESCE(unknown_count, 0)`
+
+// scanRunRecord reads a scan run selected with runColumns
+func scanRunRecord(scan func(dest ...any) error) (RunRecord, error) {
+	var run RunRecord
+	var finished sql.NullTime
+	err := scan(
+		&run.ID,
+		&run.StartedAt,
+		&finished,
+		&run.Target,
+		&run.PackageCount,
+		&run.VulnCount,
+		&run.ToolVersion,
+		&run.Severities.Critical,
+		&run.Severities.High,
+		&run.Severities.Medium,
+		&run.Severities.Low,
+		&run.Severities.Unknown,
+	)
+	run.FinishedAt = finished.Time
+	return run, err
+}
+
+// DeleteRun removes a scan run and the findings only it saw, returning the number of
+// findings removed. Findings other runs saw as well are kept and attributed to the latest
+// of them, so diffs and trends of the remaining runs are unchanged. Clean scans last
+// recorded by the run are removed with it.
+func (p *PostgresDB) DeleteRun(ctx context.Context, runID int64) (int64, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE vulnerability_scans v
+		SET scan_id = seen.scan_id
+		FROM (
+			SELECT finding_id, MAX(scan_id) AS scan_id
+			FROM run_findings
+			WHERE scan_id <> $1
+			GROUP BY finding_id
+		) seen
+		WHERE v.scan_id = $1 AND seen.finding_id = v.id`, runID)
+	if err != nil {
+		return 0, fmt.Errorf("error reassigning findings of scan run %d: %w", runID, err)
+	}
+
+	// The run's links in run_findings are removed with it
+	result, err := tx.ExecContext(ctx, `DELETE FROM vulnerability_scans WHERE scan_id = $1`, runID)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting findings of scan run %d: %w", runID, err)
+	}
+	findings, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err = tx.ExecContext(ctx, `DELETE FROM scan_runs WHERE id = $1`, runID)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting scan run %d: %w", runID, err)
+	}
+	if deleted, err := result.RowsAffected(); err != nil {
+		return 0, err
+	} else if deleted == 0 {
+		return 0, fmt.Errorf("scan run %d not found", runID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error deleting scan run %d: %w", runID, err)
+	}
+	return findings, nil
+}
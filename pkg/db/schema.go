@@ -0,0 +1,411 @@
+package db
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// migration is one step of the database schema. Steps are applied in order and
+// only ever add tables, columns and indexes, so applying them again is harmless.
+type migration struct {
+	Description string
+	Tables      []table
+	Columns     []addedColumn
+	// Backfill holds statements run after the columns are added and before the indexes
+	// are created, filling in existing rows. They must change nothing when run again.
+	Backfill []string
+	Indexes  []index
+}
+
+// table is a table created by a migration
+type table struct {
+	Name    string
+	Columns []column
+	// Updated is set for tables whose rows the scanner updates, so the scan role also
+	// needs UPDATE on them
+	Updated bool
+}
+
+// column is a column of a table
+type column struct {
+	Name       string
+	Type       string
+	PrimaryKey bool
+	NotNull    bool
+	Default    string
+	// References names the table whose primary key this column refers to, if any
+	References string
+	// Cascade deletes the row when the row it refers to is deleted
+	Cascade bool
+}
+
+// addedColumn is a column a migration adds to a table created by an earlier one
+type addedColumn struct {
+	Table  string
+	Column column
+}
+
+// index is an index created by a migration
+type index struct {
+	Name    string
+	Table   string
+	Columns []string
+	Unique  bool
+	// Method is the index access method, such as GIN, or empty for the default B-tree
+	Method string
+	// Where limits a partial index to the rows matching the condition
+	Where string
+}
+
+// migrations define the schema, oldest first
+var migrations = []migration{
+	{
+		Description: "Vulnerabilities found per package version",
+		Tables: []table{{
+			Name:    "vulnerability_scans",
+			Updated: true,
+			Columns: []column{
+				{Name: "id", Type: "SERIAL", PrimaryKey: true},
+				{Name: "package_name", Type: "VARCHAR(255)", NotNull: true},
+				{Name: "ecosystem", Type: "VARCHAR(100)", NotNull: true},
+				{Name: "version", Type: "VARCHAR(100)", NotNull: true},
+				{Name: "vuln_id", Type: "VARCHAR(100)", NotNull: true},
+				{Name: "summary", Type: "TEXT"},
+				{Name: "published", Type: "TIMESTAMP"},
+				{Name: "severity_rating", Type: "VARCHAR(50)"},
+				{Name: "fix_version", Type: "VARCHAR(100)"},
+				{Name: "raw_response", Type: "JSONB"},
+				{Name: "created_at", Type: "TIMESTAMP", Default: "NOW()"},
+			},
+		}},
+		Indexes: []index{
+			{Name: "idx_vuln_scans_package", Table: "vulnerability_scans", Columns: []string{"package_name", "ecosystem", "version"}},
+		},
+	},
+	{
+		Description: "Resources used per run, for budgeting and chargeback",
+		Tables: []table{{
+			Name: "scan_run_usage",
+			Columns: []column{
+				{Name: "id", Type: "SERIAL", PrimaryKey: true},
+				{Name: "command", Type: "VARCHAR(100)", NotNull: true},
+				{Name: "labels", Type: "JSONB"},
+				{Name: "started_at", Type: "TIMESTAMP", NotNull: true},
+				{Name: "finished_at", Type: "TIMESTAMP", NotNull: true},
+				{Name: "cpu_seconds", Type: "DOUBLE PRECISION"},
+				{Name: "peak_memory_bytes", Type: "BIGINT"},
+				{Name: "bytes_downloaded", Type: "BIGINT"},
+				{Name: "api_calls", Type: "INTEGER"},
+				{Name: "api_calls_by_host", Type: "JSONB"},
+				{Name: "created_at", Type: "TIMESTAMP", Default: "NOW()"},
+			},
+		}},
+	},
+	{
+		Description: "SHA-256 of the artifact each finding was found in",
+		Columns: []addedColumn{
+			{Table: "vulnerability_scans", Column: column{Name: "checksum", Type: "CHAR(64)"}},
+		},
+		Indexes: []index{
+			{Name: "idx_vuln_scans_checksum", Table: "vulnerability_scans", Columns: []string{"checksum"}},
+		},
+	},
+	{
+		Description: "Scan runs, grouping the findings recorded by each run",
+		Tables: []table{{
+			Name:    "scan_runs",
+			Updated: true,
+			Columns: []column{
+				{Name: "id", Type: "SERIAL", PrimaryKey: true},
+				{Name: "started_at", Type: "TIMESTAMP", NotNull: true},
+				{Name: "finished_at", Type: "TIMESTAMP"},
+				{Name: "target", Type: "TEXT"},
+				{Name: "package_count", Type: "INTEGER"},
+				{Name: "vuln_count", Type: "INTEGER"},
+				{Name: "tool_version", Type: "VARCHAR(50)"},
+			},
+		}},
+		Columns: []addedColumn{
+			{Table: "vulnerability_scans", Column: column{Name: "scan_id", Type: "INTEGER", References: "scan_runs"}},
+		},
+		Indexes: []index{
+			{Name: "idx_vuln_scans_scan_id", Table: "vulnerability_scans", Columns: []string{"scan_id"}},
+		},
+	},
+	{
+		Description: "One row per finding, updated when the finding is seen again",
+		Columns: []addedColumn{
+			{Table: "vulnerability_scans", Column: column{Name: "last_seen", Type: "TIMESTAMP"}},
+			{Table: "vulnerability_scans", Column: column{Name: "history", Type: "BOOLEAN", NotNull: true, Default: "FALSE"}},
+		},
+		Backfill: []string{
+			`UPDATE vulnerability_scans SET last_seen = created_at WHERE last_seen IS NULL`,
+			// Rows saved before findings were deduplicated are kept as history, except the
+			// newest of each finding
+			"UPDATE vulnerability_scans v SET history = TRUE\n" +
+				"WHERE NOT v.history AND EXISTS (\n" +
+				"    SELECT 1 FROM vulnerability_scans n\n" +
+				"    WHERE NOT n.history AND n.id > v.id AND n.package_name = v.package_name\n" +
+				"      AND n.ecosystem = v.ecosystem AND n.version = v.version AND n.vuln_id = v.vuln_id)",
+		},
+		Indexes: []index{
+			{Name: "idx_vuln_scans_finding", Table: "vulnerability_scans", Columns: findingKey, Unique: true, Where: "NOT history"},
+		},
+	},
+	{
+		Description: "Full-text search over finding summaries and advisory responses",
+		Indexes: []index{
+			{Name: "idx_vuln_scans_search", Table: "vulnerability_scans", Columns: []string{findingSearchVector}, Method: "GIN"},
+		},
+	},
+	{
+		Description: "Findings per severity of each scan run, for trends over time",
+		Columns: []addedColumn{
+			{Table: "scan_runs", Column: column{Name: "critical_count", Type: "INTEGER"}},
+			{Table: "scan_runs", Column: column{Name: "high_count", Type: "INTEGER"}},
+			{Table: "scan_runs", Column: column{Name: "medium_count", Type: "INTEGER"}},
+			{Table: "scan_runs", Column: column{Name: "low_count", Type: "INTEGER"}},
+			{Table: "scan_runs", Column: column{Name: "unknown_count", Type: "INTEGER"}},
+		},
+	},
+	{
+		Description: "Findings seen by each scan run, including those saved again by later runs",
+		Tables: []table{{
+			Name: "run_findings",
+			Columns: []column{
+				{Name: "scan_id", Type: "INTEGER", NotNull: true, References: "scan_runs", Cascade: true},
+				{Name: "finding_id", Type: "INTEGER", NotNull: true, References: "vulnerability_scans", Cascade: true},
+			},
+		}},
+		Backfill: []string{
+			"INSERT INTO run_findings (scan_id, finding_id)\n" +
+				"SELECT scan_id, id FROM vulnerability_scans WHERE scan_id IS NOT NULL AND NOT history\n" +
+				"ON CONFLICT DO NOTHING",
+		},
+		Indexes: []index{
+			{Name: "idx_run_findings_run", Table: "run_findings", Columns: []string{"scan_id", "finding_id"}, Unique: true},
+			{Name: "idx_run_findings_finding", Table: "run_findings", Columns: []string{"finding_id"}},
+		},
+	},
+	{
+		Description: "Aliases, fixed versions and affected ranges of findings",
+		Columns: []addedColumn{
+			{Table: "vulnerability_scans", Column: column{Name: "aliases", Type: "TEXT[]"}},
+			{Table: "vulnerability_scans", Column: column{Name: "fixed_versions", Type: "TEXT[]"}},
+			{Table: "vulnerability_scans", Column: column{Name: "affected_ranges", Type: "JSONB"}},
+		},
+		Backfill: []string{
+			// Findings saved before are filled in from their advisory in the raw response
+			"UPDATE vulnerability_scans v SET\n" +
+				"    aliases = ARRAY(SELECT jsonb_array_elements_text(" + jsonArray("f.advisory->'aliases'") + ")),\n" +
+				"    fixed_versions = ARRAY(\n" +
+				"        SELECT ev->>'fixed'\n" +
+				"        FROM jsonb_array_elements(" + jsonArray("f.advisory->'affected'") + ") a,\n" +
+				"             jsonb_array_elements(" + jsonArray("a->'ranges'") + ") r,\n" +
+				"             jsonb_array_elements(" + jsonArray("r->'events'") + ") ev\n" +
+				"        WHERE a->'package'->>'name' = v.package_name AND ev ? 'fixed'),\n" +
+				"    affected_ranges = jsonb_strip_nulls(COALESCE((\n" +
+				"        SELECT jsonb_agg(jsonb_build_object('type', r->'type', 'events', r->'events'))\n" +
+				"        FROM jsonb_array_elements(" + jsonArray("f.advisory->'affected'") + ") a,\n" +
+				"             jsonb_array_elements(" + jsonArray("a->'ranges'") + ") r\n" +
+				"        WHERE a->'package'->>'name' = v.package_name), '[]') || COALESCE((\n" +
+				"        SELECT jsonb_agg(jsonb_build_object('expression', a->'database_specific'->'affected_range'))\n" +
+				"        FROM jsonb_array_elements(" + jsonArray("f.advisory->'affected'") + ") a\n" +
+				"        WHERE a->'package'->>'name' = v.package_name\n" +
+				"          AND a->'database_specific'->>'affected_range' <> ''), '[]'))\n" +
+				"FROM (\n" +
+				"    SELECT s.id, e AS advisory\n" +
+				"    FROM vulnerability_scans s, jsonb_array_elements(" + jsonArray("s.raw_response->'vulns'") + ") e\n" +
+				"    WHERE s.aliases IS NULL AND e->>'id' = s.vuln_id\n" +
+				") f\n" +
+				"WHERE v.id = f.id",
+		},
+		Indexes: []index{
+			{Name: "idx_vuln_scans_aliases", Table: "vulnerability_scans", Columns: []string{"aliases"}, Method: "GIN"},
+		},
+	},
+	{
+		Description: "CVSS vector, base score and severity of findings",
+		Columns: []addedColumn{
+			{Table: "vulnerability_scans", Column: column{Name: "cvss_vector", Type: "TEXT"}},
+			{Table: "vulnerability_scans", Column: column{Name: "cvss_score", Type: "NUMERIC(3,1)"}},
+			{Table: "vulnerability_scans", Column: column{Name: "severity_label", Type: "VARCHAR(20)"}},
+		},
+	},
+	{
+		Description: "Package versions found without vulnerabilities, recorded with --record-clean",
+		Tables: []table{{
+			Name:    "clean_scans",
+			Updated: true,
+			Columns: []column{
+				{Name: "id", Type: "SERIAL", PrimaryKey: true},
+				{Name: "package_name", Type: "VARCHAR(255)", NotNull: true},
+				{Name: "ecosystem", Type: "VARCHAR(100)", NotNull: true},
+				{Name: "version", Type: "VARCHAR(100)", NotNull: true},
+				{Name: "checksum", Type: "CHAR(64)"},
+				{Name: "scan_id", Type: "INTEGER", References: "scan_runs", Cascade: true},
+				{Name: "created_at", Type: "TIMESTAMP", Default: "NOW()"},
+				{Name: "last_seen", Type: "TIMESTAMP", Default: "NOW()"},
+			},
+		}},
+		Indexes: []index{
+			{Name: "idx_clean_scans_package", Table: "clean_scans", Columns: []string{"package_name", "ecosystem", "version"}, Unique: true},
+			{Name: "idx_clean_scans_scan_id", Table: "clean_scans", Columns: []string{"scan_id"}},
+		},
+	},
+	{
+		Description: "Labels of each scan run, selecting the runs of report aggregate",
+		Columns: []addedColumn{
+			{Table: "scan_runs", Column: column{Name: "labels", Type: "JSONB"}},
+		},
+		Indexes: []index{
+			{Name: "idx_scan_runs_labels", Table: "scan_runs", Columns: []string{"labels"}, Method: "GIN"},
+		},
+	},
+}
+
+// jsonArray returns a JSON expression if it is an array, and NULL otherwise, so its
+// elements can be read from responses that hold null in place of an empty array
+func jsonArray(expression string) string {
+	return "CASE jsonb_typeof(" + expression + ") WHEN 'array' THEN " + expression + " END"
+}
+
+// findingKey identifies a finding; vulnerability_scans holds one row per finding,
+// other than rows kept as history
+var findingKey = []string{"package_name", "ecosystem", "version", "vuln_id"}
+
+// SchemaSQL returns the DDL creating the current schema, with the tables named by naming
+func SchemaSQL(naming Naming) string {
+	var b strings.Builder
+	b.WriteString(naming.createSchemaSQL())
+	for i, m := range migrations {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "-- %d. %s\n", i+1, m.Description)
+		b.WriteString(naming.rename(m.sql()))
+	}
+	return b.String()
+}
+
+// sql returns the DDL of a migration
+func (m migration) sql() string {
+	var b strings.Builder
+	for _, t := range m.Tables {
+		fmt.Fprintf(&b, "CREATE TABLE IF NOT EXISTS %s (\n", t.Name)
+		for j, c := range t.Columns {
+			fmt.Fprintf(&b, "    %s", c.definition())
+			if j < len(t.Columns)-1 {
+				b.WriteString(",")
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString(");\n")
+	}
+	for _, c := range m.Columns {
+		fmt.Fprintf(&b, "ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s;\n", c.Table, c.Column.definition())
+	}
+	for _, statement := range m.Backfill {
+		b.WriteString(statement + ";\n")
+	}
+	for _, idx := range m.Indexes {
+		b.WriteString(idx.definition() + ";\n")
+	}
+	return b.String()
+}
+
+// definition returns the CREATE INDEX statement of an index
+func (idx index) definition() string {
+	create := "CREATE INDEX"
+	if idx.Unique {
+		create = "CREATE UNIQUE INDEX"
+	}
+	table := idx.Table
+	if idx.Method != "" {
+		table += " USING " + idx.Method
+	}
+	statement := fmt.Sprintf("%s IF NOT EXISTS %s ON %s(%s)", create, idx.Name, table, strings.Join(idx.Columns, ", "))
+	if idx.Where != "" {
+		statement += " WHERE " + idx.Where
+	}
+	return statement
+}
+
+// definition returns the column definition used in CREATE TABLE
+func (c column) definition() string {
+	parts := []string{c.Name, c.Type}
+	if c.PrimaryKey {
+		parts = append(parts, "PRIMARY KEY")
+	}
+	if c.NotNull {
+		parts = append(parts, "NOT NULL")
+	}
+	if c.Default != "" {
+		parts = append(parts, "DEFAULT "+c.Default)
+	}
+	if c.References != "" {
+		parts = append(parts, "REFERENCES "+c.References+"(id)")
+	}
+	if c.Cascade {
+		parts = append(parts, "ON DELETE CASCADE")
+	}
+	return strings.Join(parts, " ")
+}
+
+// typeSize matches the size of a type such as VARCHAR(255), which Mermaid does not accept
+var typeSize = regexp.MustCompile(`\(.*\)`)
+
+// SchemaMermaid returns an entity-relationship diagram of the current schema in
+// Mermaid syntax, with a relationship for every column referring to another table
+func SchemaMermaid() string {
+	var b strings.Builder
+	b.WriteString("erDiagram\n")
+
+	var relationships []string
+	for _, t := range currentTables() {
+		fmt.Fprintf(&b, "    %s {\n", t.Name)
+		for _, c := range t.Columns {
+			typ := strings.ReplaceAll(strings.ToLower(typeSize.ReplaceAllString(c.Type, "")), " ", "_")
+			fmt.Fprintf(&b, "        %s %s", typ, c.Name)
+			switch {
+			case c.PrimaryKey:
+				b.WriteString(" PK")
+			case c.References != "":
+				b.WriteString(" FK")
+			}
+			if c.NotNull {
+				b.WriteString(` "not null"`)
+			}
+			b.WriteString("\n")
+
+			if c.References != "" {
+				relationships = append(relationships,
+					fmt.Sprintf("    %s ||--o{ %s : %s", c.References, t.Name, c.Name))
+			}
+		}
+		b.WriteString("    }\n")
+	}
+	for _, r := range relationships {
+		b.WriteString(r + "\n")
+	}
+	return b.String()
+}
+
+// currentTables returns the tables of the current schema, in the order they were
+// created, with the columns added by later migrations
+func currentTables() []table {
+	var tables []table
+	position := make(map[string]int)
+	for _, m := range migrations {
+		for _, t := range m.Tables {
+			position[t.Name] = len(tables)
+			tables = append(tables, table{Name: t.Name, Columns: append([]column{}, t.Columns...)})
+		}
+		for _, c := range m.Columns {
+			t := &tables[position[c.Table]]
+			t.Columns = append(t.Columns, c.Column)
+		}
+	}
+	return tables
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RunStatus is what a scan run recorded about the package versions it checked: the
+// findings it saw, and the package versions it recorded as clean
+type RunStatus struct {
+	Run      RunRecord
+	Findings []VulnerabilityRecord
+	// Clean is empty unless the run was scanned with --record-clean
+	Clean []CleanScan
+}
+
+// CleanScan is a package version recorded as found without vulnerabilities
+type CleanScan struct {
+	PackageName string
+	Ecosystem   string
+	Version     string
+	Checksum    string
+	LastSeen    time.Time
+}
+
+// GetRunStatus gets the findings and clean scans of the scan run with id runID or, if it
+// is 0, of the latest finished run, of target unless it is empty. It only reads from the
+// database.
+func (p *PostgresDB) GetRunStatus(ctx context.Context, runID int64, target string) (RunStatus, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var status RunStatus
+	var err error
+	switch {
+	case runID != 0:
+		status.Run, err = p.getRun(ctx, "id = $1", runID)
+	case target != "":
+		status.Run, err = p.getRun(ctx, "finished_at IS NOT NULL AND COALESCE(target, '') = $1", target)
+	default:
+		status.Run, err = p.getRun(ctx, "finished_at IS NOT NULL")
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		switch {
+		case runID != 0:
+			return RunStatus{}, fmt.Errorf("scan run %d not found", runID)
+		case target != "":
+			return RunStatus{}, fmt.Errorf("no finished scan run of %q", target)
+		}
+		return RunStatus{}, errors.New("no finished scan run")
+	} else if err != nil {
+		return RunStatus{}, fmt.Errorf("error getting scan run: %w", err)
+	}
+
+	status.Findings, err = p.QueryScans(ctx, ScanFilter{RunID: status.Run.ID})
+	if err != nil {
+		return RunStatus{}, fmt.Errorf("error getting findings of scan run %d: %w", status.Run.ID, err)
+	}
+
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT package_name, ecosystem, version, COALESCE(checksum, ''), last_seen
+		FROM clean_scans
+		WHERE scan_id = $1
+		ORDER BY package_name, ecosystem, version
+	`, status.Run.ID)
+	if err != nil {
+		return RunStatus{}, fmt.Errorf("error getting clean scans of scan run %d: %w", status.Run.ID, err)
+	}
+	defer rows.Close()
+	status.Clean = []CleanScan{}
+	for rows.Next() {
+		var clean CleanScan
+		if err := rows.Scan(&clean.PackageName, &clean.Ecosystem, &clean.Version, &clean.Checksum, &clean.LastSeen); err != nil {
+			return RunStatus{}, err
+		}
+		status.Clean = append(status.Clean, clean)
+	}
+	if err := rows.Err(); err != nil {
+		return RunStatus{}, err
+	}
+	return status, nil
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+	"github.com/squarehole/package-scanner/pkg/usage"
+)
+
+// Store persists scan results, grouped by scan run, and run usage. PostgresDB is the
+// PostgreSQL backend; other backends, and fakes in tests, implement Store to be used
+// by the scanner. Every method but Close stops when its context is done.
+type Store interface {
+	// SaveVulnerabilityResults saves the findings for a package version, linked to the
+	// scan run with id runID, or to none if it is 0. Checksum is the SHA-256 of the
+	// artifact the package was found in, or empty if there is none.
+	SaveVulnerabilityResults(ctx context.Context, runID int64, packageName string, ecosystem string, version string, checksum string,
+		vulnerabilities []models.Vulnerability, rawResponse []byte) error
+	// SaveVulnerabilityBatch saves the findings of many packages at once, linked to the
+	// scan run with id runID, or to none if it is 0; packages without findings are
+	// recorded as clean scans
+	SaveVulnerabilityBatch(ctx context.Context, runID int64, batch []PackageFindings) error
+	// SaveCleanScan records that a package version was found without vulnerabilities
+	SaveCleanScan(ctx context.Context, runID int64, packageName string, ecosystem string, version string, checksum string) error
+	// StartRun records the start of a scan run with its labels and returns its id
+	StartRun(ctx context.Context, target string, toolVersion string, labels map[string]string, started time.Time) (int64, error)
+	// FinishRun records the end of a scan run with its package and vulnerability counts
+	FinishRun(ctx context.Context, runID int64, finished time.Time, packageCount int, vulnCount int,
+		severities SeverityCounts) error
+	// GetRuns returns the most recent scan runs, newest first
+	GetRuns(ctx context.Context, limit int) ([]RunRecord, error)
+	// GetTrend returns the findings per severity of each target over time
+	GetTrend(ctx context.Context, filter TrendFilter) ([]TrendPoint, error)
+	// GetRollupRuns returns the scan runs of a period carrying the given labels, with the
+	// findings they saw, for an organization-level rollup
+	GetRollupRuns(ctx context.Context, filter RollupFilter) ([]RollupRun, error)
+	// DiffRuns compares the findings of two scan runs; a head of 0 is the latest finished
+	// run and a base of 0 the finished run of the same target before the head
+	DiffRuns(ctx context.Context, baseID int64, headID int64) (RunDiff, error)
+	// DeleteRun removes a scan run and the findings only it saw, returning the number of
+	// findings removed
+	DeleteRun(ctx context.Context, runID int64) (int64, error)
+	// Purge removes the findings and scan runs the retention policy no longer keeps
+	Purge(ctx context.Context, policy RetentionPolicy) (PurgeResult, error)
+	// SaveRunUsage records the resources used by a run, with the labels used to charge it back
+	SaveRunUsage(ctx context.Context, command string, labels map[string]string, u usage.Usage) error
+	// GetLatestScans returns the most recently saved findings, newest first
+	GetLatestScans(ctx context.Context, limit int) ([]VulnerabilityRecord, error)
+	// QueryScans returns the stored findings matching filter, most recently seen first
+	QueryScans(ctx context.Context, filter ScanFilter) ([]VulnerabilityRecord, error)
+	// CheckWritable confirms results can be saved without leaving anything behind
+	CheckWritable(ctx context.Context) error
+	// Close releases the store's connections
+	Close() error
+}
+
+// SchemaManager is implemented by stores whose schema the scanner creates, checks
+// and migrates
+type SchemaManager interface {
+	// InitializeSchema creates any missing tables and indexes
+	InitializeSchema(ctx context.Context) error
+	// VerifySchema checks that the schema is up to date without changing it
+	VerifySchema(ctx context.Context) error
+	// Migrate applies any missing migrations, returning a description of each
+	Migrate(ctx context.Context) ([]string, error)
+}
+
+var (
+	_ Store         = (*PostgresDB)(nil)
+	_ SchemaManager = (*PostgresDB)(nil)
+)
@@ -0,0 +1,213 @@
+package db
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// SSL modes supported by the PostgreSQL driver
+const (
+	SSLModeDisable    = "disable"
+	SSLModeRequire    = "require"
+	SSLModeVerifyCA   = "verify-ca"
+	SSLModeVerifyFull = "verify-full"
+)
+
+// SSLRootCertSystem as the root certificate verifies the server against the system trust store
+const SSLRootCertSystem = "system"
+
+// ValidateTLS checks the TLS settings before connecting, so a misconfigured
+// verify-ca or verify-full setup fails with an error naming the setting at fault
+// rather than a handshake error from the server. As with libpq, the verifying modes
+// fall back to ~/.postgresql/root.crt when no root certificate is given.
+func (c *Config) ValidateTLS() error {
+	switch c.SSLMode {
+	case "", SSLModeRequire, SSLModeVerifyCA, SSLModeVerifyFull:
+	case SSLModeDisable:
+		if c.SSLRootCert != "" || c.SSLCert != "" || c.SSLKey != "" || c.SSLPassword != "" {
+			return fmt.Errorf("sslmode %s does not use TLS, but TLS certificates or keys are configured", c.SSLMode)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported sslmode %q (supported: %s, %s, %s, %s)",
+			c.SSLMode, SSLModeDisable, SSLModeRequire, SSLModeVerifyCA, SSLModeVerifyFull)
+	}
+
+	verifying := c.SSLMode == SSLModeVerifyCA || c.SSLMode == SSLModeVerifyFull
+	if verifying && c.SSLRootCert == "" {
+		if path := defaultRootCert(); path != "" {
+			c.SSLRootCert = path
+		} else {
+			return fmt.Errorf("sslmode %s verifies the server certificate but no root certificate is set: "+
+				"set sslrootcert to the CA certificate that signed it, or to %q to use the system trust store",
+				c.SSLMode, SSLRootCertSystem)
+		}
+	}
+	if c.SSLRootCert != "" && c.SSLRootCert != SSLRootCertSystem {
+		if _, err := readRootCert(c.SSLRootCert); err != nil {
+			return err
+		}
+	}
+	if verifying && c.SSLMode == SSLModeVerifyFull && strings.HasPrefix(c.Host, "/") {
+		return fmt.Errorf("sslmode %s checks the server host name, but host %s is a Unix socket", c.SSLMode, c.Host)
+	}
+
+	switch {
+	case c.SSLCert != "" && c.SSLKey == "":
+		return fmt.Errorf("sslcert is set without sslkey; a client certificate needs its private key")
+	case c.SSLKey != "" && c.SSLCert == "":
+		return fmt.Errorf("sslkey is set without sslcert; a client key needs its certificate")
+	case c.SSLPassword != "" && c.SSLKey == "":
+		return fmt.Errorf("sslpassword is set without sslkey")
+	case c.SSLCert == "":
+		return nil
+	}
+
+	if _, _, err := loadClientCert(c.SSLCert, c.SSLKey, c.SSLPassword); err != nil {
+		return err
+	}
+	return nil
+}
+
+// tlsOptions returns the connection string settings for TLS. The driver cannot
+// decrypt private keys, so an encrypted key is decrypted here and passed inline
+// together with the certificates.
+func (c *Config) tlsOptions() ([]string, error) {
+	options := []string{"sslmode=" + quoteValue(c.SSLMode)}
+	if c.SSLMode == SSLModeDisable {
+		return options, nil
+	}
+
+	rootCert := c.SSLRootCert
+	if rootCert == SSLRootCertSystem {
+		rootCert = ""
+	}
+	if c.SSLCert == "" {
+		if rootCert != "" {
+			options = append(options, "sslrootcert="+quoteValue(rootCert))
+		}
+		return options, nil
+	}
+
+	certPEM, keyPEM, err := loadClientCert(c.SSLCert, c.SSLKey, c.SSLPassword)
+	if err != nil {
+		return nil, err
+	}
+	if c.SSLPassword == "" {
+		options = append(options, "sslcert="+quoteValue(c.SSLCert), "sslkey="+quoteValue(c.SSLKey))
+		if rootCert != "" {
+			options = append(options, "sslrootcert="+quoteValue(rootCert))
+		}
+		return options, nil
+	}
+
+	options = append(options, "sslinline=true", "sslcert="+quoteValue(string(certPEM)), "sslkey="+quoteValue(string(keyPEM)))
+	if rootCert != "" {
+		rootPEM, err := readRootCert(rootCert)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, "sslrootcert="+quoteValue(string(rootPEM)))
+	}
+	return options, nil
+}
+
+// defaultRootCert returns ~/.postgresql/root.crt when it exists
+func defaultRootCert() string {
+	u, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	path := filepath.Join(u.HomeDir, ".postgresql", "root.crt")
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// readRootCert reads a root certificate file and checks it holds at least one certificate
+func readRootCert(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading sslrootcert: %w", err)
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("sslrootcert %s holds no PEM certificates", path)
+	}
+	return data, nil
+}
+
+// loadClientCert reads a client certificate and its private key, decrypting the
+// key with the password when one is given, and checks that the two belong together.
+// It returns the certificate and the unencrypted key as PEM.
+func loadClientCert(certPath, keyPath, password string) ([]byte, []byte, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading sslcert: %w", err)
+	}
+
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading sslkey: %w", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+		return nil, nil, fmt.Errorf("sslkey %s has group or world access (%v); restrict it with chmod 0600", keyPath, info.Mode().Perm())
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading sslkey: %w", err)
+	}
+
+	keyPEM, err = decryptKey(keyPEM, password)
+	if err != nil {
+		return nil, nil, fmt.Errorf("sslkey %s: %w", keyPath, err)
+	}
+	if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		return nil, nil, fmt.Errorf("sslcert %s and sslkey %s do not form a valid key pair: %w", certPath, keyPath, err)
+	}
+	return certPEM, keyPEM, nil
+}
+
+// decryptKey returns a PEM private key in the clear. Keys encrypted with the
+// legacy PEM scheme (Proc-Type: 4,ENCRYPTED) are decrypted with the password.
+func decryptKey(keyPEM []byte, password string) ([]byte, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM private key found")
+	}
+
+	encrypted := x509.IsEncryptedPEMBlock(block)
+	switch {
+	case block.Type == "ENCRYPTED PRIVATE KEY":
+		return nil, fmt.Errorf("encrypted PKCS#8 keys are not supported; convert the key to the " +
+			"traditional PEM encryption with `openssl pkey -traditional -aes256`")
+	case !encrypted && password != "":
+		return nil, fmt.Errorf("sslpassword is set but the key is not encrypted")
+	case !encrypted:
+		return keyPEM, nil
+	case password == "":
+		return nil, fmt.Errorf("the key is encrypted; set sslpassword")
+	}
+
+	der, err := x509.DecryptPEMBlock(block, []byte(password))
+	if errors.Is(err, x509.IncorrectPasswordError) {
+		return nil, fmt.Errorf("sslpassword does not decrypt the key")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der}), nil
+}
+
+// quoteValue quotes a connection string value, escaping backslashes and single quotes
+func quoteValue(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
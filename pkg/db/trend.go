@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TrendIntervals are the periods a trend can be grouped by
+var TrendIntervals = []string{"day", "week", "month"}
+
+// TrendFilter selects the scan runs a trend is built from
+type TrendFilter struct {
+	// Since is the start of the trend; zero covers every run
+	Since time.Time
+	// Interval is the period runs are grouped by: day, week or month
+	Interval string
+	// Target only includes the runs of this target, or of every target if empty
+	Target string
+}
+
+// TrendPoint is the state of a target at the end of a period: the totals of the last
+// run of the target that finished in the period
+type TrendPoint struct {
+	Target          string         `json:"target"`
+	Period          time.Time      `json:"period"`
+	RunID           int64          `json:"run_id"`
+	Runs            int            `json:"runs"`
+	Packages        int            `json:"packages"`
+	Vulnerabilities int            `json:"vulnerabilities"`
+	Severities      SeverityCounts `json:"severities"`
+}
+
+// GetTrend gets the findings per severity of each target for every period in which it
+// was scanned, ordered by target and period. Each period reports the last finished run
+// of the target in it, the state the target was left in, rather than adding up the
+// runs, so scanning more often does not inflate the counts.
+func (p *PostgresDB) GetTrend(ctx context.Context, filter TrendFilter) ([]TrendPoint, error) {
+	valid := false
+	for _, interval := range TrendIntervals {
+		valid = valid || filter.Interval == interval
+	}
+	if !valid {
+		return nil, fmt.Errorf("unsupported trend interval %q", filter.Interval)
+	}
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT target, period, id, runs, package_count, vuln_count,
+		       critical_count, high_count, medium_count, low_count, unknown_count
+		FROM (
+		    SELECT DISTINCT ON (target, period)
+		           COALESCE(target, '') AS target, DATE_TRUNC($1, started_at) AS period, id,
+		           COUNT(*) OVER (PARTITION BY target, DATE_TRUNC($1, started_at)) AS runs,
+		           COALESCE(package_count, 0) AS package_count, COALESCE(vuln_count, 0) AS vuln_count,
+		           COALESCE(critical_count, 0) AS critical_count, COALESCE(high_count, 0) AS high_count,
+		           COALESCE(medium_count, 0) AS medium_count, COALESCE(low_count, 0) AS low_count,
+		           COALESCE(unknown_count, 0) AS unknown_count
+		    FROM scan_runs
+		    WHERE finished_at IS NOT NULL AND started_at >= $2 AND ($3 = '' OR target = $3)
+		    ORDER BY target, period, started_at DESC, id DESC
+		) latest
+		ORDER BY target, period
+	`, filter.Interval, filter.Since, filter.Target)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []TrendPoint{}
+	for rows.Next() {
+		var point TrendPoint
+		err := rows.Scan(
+			&point.Target,
+			&point.Period,
+			&point.RunID,
+			&point.Runs,
+			&point.Packages,
+			&point.Vulnerabilities,
+			&point.Severities.Critical,
+			&point.Severities.High,
+			&point.Severities.Medium,
+			&point.Severities.Low,
+			&point.Severities.Unknown,
+		)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, point)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return points, nil
+}
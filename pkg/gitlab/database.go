@@ -0,0 +1,311 @@
+package gitlab
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+	"github.com/squarehole/package-scanner/pkg/version"
+	"gopkg.in/yaml.v3"
+)
+
+// packageTypes maps OSV ecosystem names to gemnasium package types
+var packageTypes = map[string]string{
+	"npm":   "npm",
+	"maven": "maven",
+	"pypi":  "pypi",
+}
+
+// advisory is a gemnasium advisory as stored in the YAML dumps
+type advisory struct {
+	Identifier       string   `yaml:"identifier"`
+	Identifiers      []string `yaml:"identifiers"`
+	PackageSlug      string   `yaml:"package_slug"`
+	Title            string   `yaml:"title"`
+	Description      string   `yaml:"description"`
+	Date             string   `yaml:"date"`
+	PubDate          string   `yaml:"pubdate"`
+	AffectedRange    string   `yaml:"affected_range"`
+	FixedVersions    []string `yaml:"fixed_versions"`
+	AffectedVersions string   `yaml:"affected_versions"`
+	Solution         string   `yaml:"solution"`
+	URLs             []string `yaml:"urls"`
+	CVSSv2           string   `yaml:"cvss_v2"`
+	CVSSv3           string   `yaml:"cvss_v3"`
+	CWEIDs           []string `yaml:"cwe_ids"`
+}
+
+// parsedAdvisory is an advisory together with its parsed affected range
+type parsedAdvisory struct {
+	advisory
+	affected versionRange
+}
+
+// Database answers vulnerability queries from a local copy of the GitLab
+// advisory database (gemnasium-db), laid out as <type>/<package>/<id>.yml
+type Database struct {
+	dir string
+
+	mu       sync.Mutex
+	packages map[string][]parsedAdvisory
+}
+
+// Open opens a GitLab advisory database directory
+func Open(dir string) (*Database, error) {
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("%s does not contain a GitLab advisory database", dir)
+	}
+
+	return &Database{
+		dir:      dir,
+		packages: make(map[string][]parsedAdvisory),
+	}, nil
+}
+
+// Supports reports whether the database holds advisories for an ecosystem
+func (d *Database) Supports(ecosystem string) bool {
+	_, ok := packageTypes[strings.ToLower(ecosystem)]
+	return ok
+}
+
+// QueryPackage returns the advisories affecting a package version, converted to
+// the OSV shape used by the rest of the scanner. Ecosystems the database does not
+// cover return no results.
+func (d *Database) QueryPackage(packageName, packageVersion, packageEcosystem string) (models.ScanResults, []byte, error) {
+	var results models.ScanResults
+	if !d.Supports(packageEcosystem) {
+		return results, []byte("{}"), nil
+	}
+
+	advisories, err := d.advisories(packageName, packageEcosystem)
+	if err != nil {
+		return models.ScanResults{}, nil, err
+	}
+
+	for _, adv := range advisories {
+		if adv.affected.contains(packageVersion) {
+			results.Vulnerabilities = append(results.Vulnerabilities, adv.toVulnerability(packageName, packageVersion, packageEcosystem))
+		}
+	}
+
+	body := []byte("{}")
+	if len(results.Vulnerabilities) > 0 {
+		body, err = json.Marshal(results)
+		if err != nil {
+			return models.ScanResults{}, nil, fmt.Errorf("error encoding GitLab advisory results: %w", err)
+		}
+	}
+
+	return results, body, nil
+}
+
+// Search returns the advisories of an ecosystem accepted by match, in ID order. Every
+// advisory of the ecosystem is read, so unlike QueryPackage this walks the whole
+// package type directory.
+func (d *Database) Search(ecosystem string, match func(models.Vulnerability) bool) ([]models.Vulnerability, error) {
+	if !d.Supports(ecosystem) {
+		return nil, nil
+	}
+	packageType := packageTypes[strings.ToLower(ecosystem)]
+
+	var matches []models.Vulnerability
+	err := filepath.WalkDir(filepath.Join(d.dir, packageType), func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || filepath.Ext(path) != ".yml" {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading GitLab advisory %s: %w", path, err)
+		}
+		var adv advisory
+		if err := yaml.Unmarshal(data, &adv); err != nil {
+			return fmt.Errorf("error parsing GitLab advisory %s: %w", path, err)
+		}
+
+		vuln := parsedAdvisory{advisory: adv}.toVulnerability(slugName(packageType, adv.PackageSlug), "", ecosystem)
+		if match(vuln) {
+			matches = append(matches, vuln)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+	return matches, nil
+}
+
+// slugName returns the package name of a package slug such as "npm/lodash" or
+// "maven/org.example/library", which for Maven is written as groupId:artifactId
+func slugName(packageType, slug string) string {
+	name := strings.TrimPrefix(slug, packageType+"/")
+	if packageType == "maven" {
+		if i := strings.LastIndex(name, "/"); i >= 0 {
+			name = name[:i] + ":" + name[i+1:]
+		}
+	}
+	return name
+}
+
+// advisories returns the parsed advisories of a package, reading them from disk on first use
+func (d *Database) advisories(name, ecosystem string) ([]parsedAdvisory, error) {
+	packageType := packageTypes[strings.ToLower(ecosystem)]
+	key := packageType + "/" + normalizeName(packageType, name)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if advisories, ok := d.packages[key]; ok {
+		return advisories, nil
+	}
+
+	dir := d.packageDir(packageType, name)
+	if dir == "" {
+		d.packages[key] = nil
+		return nil, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.yml"))
+	if err != nil {
+		return nil, err
+	}
+
+	var advisories []parsedAdvisory
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading GitLab advisory %s: %w", file, err)
+		}
+
+		var adv advisory
+		if err := yaml.Unmarshal(data, &adv); err != nil {
+			return nil, fmt.Errorf("error parsing GitLab advisory %s: %w", file, err)
+		}
+
+		affected, err := parseRange(packageType, adv.AffectedRange)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing affected range of %s: %w", file, err)
+		}
+		advisories = append(advisories, parsedAdvisory{advisory: adv, affected: affected})
+	}
+
+	d.packages[key] = advisories
+	return advisories, nil
+}
+
+// packageDir locates the advisory directory of a package. The exact path is tried
+// first, then a case-insensitive (and for PyPI, normalized) match of the last segment.
+func (d *Database) packageDir(packageType, name string) string {
+	segments := []string{d.dir, packageType}
+	if packageType == "maven" {
+		// Maven packages are stored as <groupId>/<artifactId>
+		segments = append(segments, strings.Split(strings.Replace(name, ":", "/", 1), "/")...)
+	} else {
+		segments = append(segments, strings.Split(name, "/")...)
+	}
+
+	exact := filepath.Join(segments...)
+	if info, err := os.Stat(exact); err == nil && info.IsDir() {
+		return exact
+	}
+
+	parent := filepath.Dir(exact)
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		return ""
+	}
+	want := normalizeName(packageType, filepath.Base(exact))
+	for _, entry := range entries {
+		if entry.IsDir() && normalizeName(packageType, entry.Name()) == want {
+			return filepath.Join(parent, entry.Name())
+		}
+	}
+	return ""
+}
+
+var pypiSeparators = regexp.MustCompile(`[-_.]+`)
+
+// normalizeName applies the package type's name comparison rules
+func normalizeName(packageType, name string) string {
+	switch packageType {
+	case "pypi":
+		// PEP 503 normalization
+		return pypiSeparators.ReplaceAllString(strings.ToLower(name), "-")
+	case "maven":
+		return strings.Replace(name, ":", "/", 1)
+	default:
+		return name
+	}
+}
+
+// toVulnerability converts an advisory to the OSV vulnerability model. Fixed versions
+// newer than the scanned version are listed first, lowest first, so the reported
+// fix is the nearest upgrade.
+func (a parsedAdvisory) toVulnerability(name, scannedVersion, ecosystem string) models.Vulnerability {
+	vuln := models.Vulnerability{
+		ID:      a.Identifier,
+		Summary: a.Title,
+		Details: strings.TrimSpace(a.Description + "\n\n" + a.Solution),
+	}
+
+	for _, id := range a.Identifiers {
+		if id != a.Identifier {
+			vuln.Aliases = append(vuln.Aliases, id)
+		}
+	}
+	vuln.Published, _ = time.Parse("2006-01-02", a.PubDate)
+	vuln.Modified, _ = time.Parse("2006-01-02", a.Date)
+	vuln.DBSpecific.CWEIDs = a.CWEIDs
+
+	if a.CVSSv3 != "" {
+		vuln.Severity = append(vuln.Severity, models.SeverityRating{Type: "CVSS_V3", Score: a.CVSSv3})
+	}
+	if a.CVSSv2 != "" {
+		vuln.Severity = append(vuln.Severity, models.SeverityRating{Type: "CVSS_V2", Score: a.CVSSv2})
+	}
+
+	for _, url := range a.URLs {
+		vuln.References = append(vuln.References, models.Reference{Type: "WEB", URL: url})
+	}
+
+	fixed := append([]string{}, a.FixedVersions...)
+	sort.SliceStable(fixed, func(i, j int) bool {
+		iNewer := version.Compare(fixed[i], scannedVersion) > 0
+		jNewer := version.Compare(fixed[j], scannedVersion) > 0
+		if iNewer != jNewer {
+			return iNewer
+		}
+		return version.Compare(fixed[i], fixed[j]) < 0
+	})
+
+	affected := models.AffectedPackage{
+		Package: models.Package{Name: name, Ecosystem: ecosystem},
+		DatabaseSpecific: models.PackageDatabaseSpecific{
+			Source:        "gitlab:" + a.PackageSlug,
+			AffectedRange: a.AffectedRange,
+		},
+	}
+	if len(fixed) > 0 {
+		r := models.Range{Type: "ECOSYSTEM"}
+		for _, v := range fixed {
+			r.Events = append(r.Events, models.Event{Fixed: v})
+		}
+		affected.Ranges = append(affected.Ranges, r)
+	}
+	vuln.Affected = append(vuln.Affected, affected)
+
+	return vuln
+}
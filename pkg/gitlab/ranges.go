@@ -0,0 +1,192 @@
+package gitlab
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/squarehole/package-scanner/pkg/version"
+)
+
+// constraint is a single comparison such as ">=1.2.0"
+type constraint struct {
+	op      string
+	version string
+}
+
+// versionRange is a union of alternatives, each an intersection of constraints
+type versionRange [][]constraint
+
+// contains reports whether a version satisfies any alternative of the range
+func (r versionRange) contains(v string) bool {
+	for _, alternative := range r {
+		matched := true
+		for _, c := range alternative {
+			if !c.matches(v) {
+				matched = false
+				break
+			}
+		}
+		if matched && len(alternative) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether a version satisfies the constraint
+func (c constraint) matches(v string) bool {
+	cmp := version.Compare(v, c.version)
+	switch c.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "!=":
+		return cmp != 0
+	default:
+		return cmp == 0
+	}
+}
+
+// parseRange parses an affected_range in the syntax gemnasium uses for the package type:
+// npm-style comparator sets ("<1.2.3 >=1.0.0 || >=2.0.0 <2.1.0"), PyPI-style
+// comma-separated specifiers (">=1.0,<1.2") or Maven interval sets ("[1.0,1.2),[2.0,2.1)").
+func parseRange(packageType, s string) (versionRange, error) {
+	var r versionRange
+	for _, alternative := range strings.Split(s, "||") {
+		alternative = strings.TrimSpace(alternative)
+		if alternative == "" {
+			continue
+		}
+
+		if packageType == "maven" {
+			intervals, err := parseIntervals(alternative)
+			if err != nil {
+				return nil, err
+			}
+			r = append(r, intervals...)
+			continue
+		}
+
+		separator := " "
+		if packageType == "pypi" {
+			separator = ","
+		}
+		constraints, err := parseComparators(strings.Split(alternative, separator))
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, constraints)
+	}
+	return r, nil
+}
+
+// parseComparators parses comparator tokens, joining operators written apart from their version
+func parseComparators(tokens []string) ([]constraint, error) {
+	var constraints []constraint
+	pending := ""
+	for _, token := range tokens {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+
+		op := leadingOperator(token)
+		if op == token {
+			pending = op
+			continue
+		}
+		if pending != "" {
+			op, token = pending, pending+token
+			pending = ""
+		}
+
+		v := strings.TrimSpace(strings.TrimPrefix(token, op))
+		if op == "==" || op == "" {
+			op = "="
+		}
+		constraints = append(constraints, constraint{op: op, version: v})
+	}
+	if pending != "" {
+		return nil, fmt.Errorf("operator %q without version", pending)
+	}
+	return constraints, nil
+}
+
+// leadingOperator returns the comparison operator at the start of a token
+func leadingOperator(token string) string {
+	for _, op := range []string{"===", ">=", "<=", "==", "!=", ">", "<", "="} {
+		if strings.HasPrefix(token, op) {
+			if op == "===" {
+				return "=="
+			}
+			return op
+		}
+	}
+	return ""
+}
+
+// parseIntervals parses a Maven version range such as "(,1.0],[1.2,1.3)" into one
+// alternative per interval
+func parseIntervals(s string) (versionRange, error) {
+	var r versionRange
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimLeft(strings.TrimSpace(s), ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			break
+		}
+
+		open := s[0]
+		if open != '[' && open != '(' {
+			// A bare version is a soft requirement, treated as an exact match
+			end := strings.IndexAny(s, ",")
+			if end < 0 {
+				end = len(s)
+			}
+			r = append(r, []constraint{{op: "=", version: strings.TrimSpace(s[:end])}})
+			s = s[end:]
+			continue
+		}
+
+		end := strings.IndexAny(s, "])")
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated interval in %q", s)
+		}
+		closing := s[end]
+		body := s[1:end]
+		s = s[end+1:]
+
+		lower, upper, isPair := strings.Cut(body, ",")
+		lower, upper = strings.TrimSpace(lower), strings.TrimSpace(upper)
+		if !isPair {
+			r = append(r, []constraint{{op: "=", version: lower}})
+			continue
+		}
+
+		var interval []constraint
+		if lower != "" {
+			op := ">"
+			if open == '[' {
+				op = ">="
+			}
+			interval = append(interval, constraint{op: op, version: lower})
+		}
+		if upper != "" {
+			op := "<"
+			if closing == ']' {
+				op = "<="
+			}
+			interval = append(interval, constraint{op: op, version: upper})
+		}
+		if len(interval) == 0 {
+			// "(,)" matches every version
+			interval = append(interval, constraint{op: ">=", version: "0"})
+		}
+		r = append(r, interval)
+	}
+	return r, nil
+}
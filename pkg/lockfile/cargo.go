@@ -0,0 +1,65 @@
+package lockfile
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+// parseCargoLock reads the [[package]] entries of a Rust Cargo.lock. Packages without
+// a registry source are workspace members, path dependencies or git checkouts and are
+// marked as unpublished.
+func parseCargoLock(_ string, data []byte) ([]Dependency, error) {
+	var deps []Dependency
+	var current *Dependency
+	inPackage := false
+
+	flush := func() {
+		if current != nil && current.Name != "" && current.Version != "" {
+			deps = append(deps, *current)
+		}
+		current = nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(line, "[") && !strings.HasPrefix(line, `["`) {
+			if line == "[[package]]" {
+				flush()
+				// Unpublished until a registry source is seen
+				current = &Dependency{Ecosystem: "crates.io", Unpublished: true}
+				inPackage = true
+			} else {
+				// Sections such as [metadata] hold checksums, not packages
+				inPackage = false
+			}
+			continue
+		}
+		if !inPackage || current == nil {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		switch strings.TrimSpace(key) {
+		case "name":
+			current.Name = value
+		case "version":
+			current.Version = value
+		case "source":
+			current.Unpublished = !strings.HasPrefix(value, "registry+") && !strings.HasPrefix(value, "sparse+")
+		}
+	}
+	flush()
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return deps, nil
+}
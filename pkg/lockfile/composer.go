@@ -0,0 +1,49 @@
+package lockfile
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// composerPackage is an entry of the "packages" and "packages-dev" sections of composer.lock
+type composerPackage struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Dist    struct {
+		Type string `json:"type"`
+	} `json:"dist"`
+}
+
+// parseComposerLock reads the packages of a PHP composer.lock. Development branches
+// ("dev-main") and path repositories are marked as unpublished.
+func parseComposerLock(_ string, data []byte) ([]Dependency, error) {
+	var lock struct {
+		Packages    []composerPackage `json:"packages"`
+		PackagesDev []composerPackage `json:"packages-dev"`
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, err
+	}
+
+	var deps []Dependency
+	add := func(pkg composerPackage, dev bool) {
+		if pkg.Name == "" || pkg.Version == "" {
+			return
+		}
+		deps = append(deps, Dependency{
+			Name: pkg.Name,
+			// Tags are commonly prefixed with "v"; Packagist advisories use the bare version
+			Version:     strings.TrimPrefix(pkg.Version, "v"),
+			Ecosystem:   "Packagist",
+			Dev:         dev,
+			Unpublished: strings.HasPrefix(pkg.Version, "dev-") || strings.HasSuffix(pkg.Version, "-dev") || pkg.Dist.Type == "path",
+		})
+	}
+	for _, pkg := range lock.Packages {
+		add(pkg, false)
+	}
+	for _, pkg := range lock.PackagesDev {
+		add(pkg, true)
+	}
+	return deps, nil
+}
@@ -0,0 +1,119 @@
+package lockfile
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+// goRequirement is a require directive of a go.mod file
+type goRequirement struct {
+	path     string
+	version  string
+	indirect bool
+}
+
+// parseGoMod reads the require directives of a go.mod file, including indirect
+// requirements, and applies replace directives that point at another module version.
+// Requirements replaced by a local directory are skipped, as they are not published.
+func parseGoMod(_ string, data []byte) ([]Dependency, error) {
+	var requires []goRequirement
+	// Replacements are keyed by "path" or "path@version"
+	replacements := make(map[string]goRequirement)
+
+	block := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line, comment, _ := strings.Cut(scanner.Text(), "//")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		directive := block
+		switch {
+		case block != "" && fields[0] == ")":
+			block = ""
+			continue
+		case block == "" && len(fields) == 2 && fields[1] == "(":
+			block = fields[0]
+			continue
+		case block == "":
+			directive, fields = fields[0], fields[1:]
+		}
+
+		switch directive {
+		case "require":
+			if len(fields) >= 2 {
+				indirect := strings.HasPrefix(strings.TrimSpace(comment), "indirect")
+				requires = append(requires, goRequirement{path: fields[0], version: fields[1], indirect: indirect})
+			}
+		case "replace":
+			// old [version] => new [version]
+			arrow := -1
+			for i, field := range fields {
+				if field == "=>" {
+					arrow = i
+				}
+			}
+			if arrow < 1 || arrow == len(fields)-1 {
+				continue
+			}
+			key := fields[0]
+			if arrow == 2 {
+				key += "@" + fields[1]
+			}
+			target := goRequirement{path: fields[arrow+1]}
+			if arrow+2 < len(fields) {
+				target.version = fields[arrow+2]
+			}
+			replacements[key] = target
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var deps []Dependency
+	for _, req := range requires {
+		target, ok := replacements[req.path+"@"+req.version]
+		if !ok {
+			target, ok = replacements[req.path]
+		}
+		if ok {
+			if target.version == "" {
+				// Replaced by a local directory, which is not a published module
+				continue
+			}
+			req.path, req.version = target.path, target.version
+		}
+
+		deps = append(deps, Dependency{
+			Name:      req.path,
+			Version:   goVersion(req.version),
+			Ecosystem: "Go",
+			Indirect:  req.indirect,
+		})
+	}
+	return deps, nil
+}
+
+// parseGoSum reads the module versions recorded in a go.sum file. Lines that only
+// hash a module's go.mod are skipped, since those modules may not be part of the build.
+func parseGoSum(_ string, data []byte) ([]Dependency, error) {
+	var deps []Dependency
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || strings.HasSuffix(fields[1], "/go.mod") {
+			continue
+		}
+		deps = append(deps, Dependency{Name: fields[0], Version: goVersion(fields[1]), Ecosystem: "Go"})
+	}
+	return deps, scanner.Err()
+}
+
+// goVersion converts a module version to the form OSV uses for the Go ecosystem
+func goVersion(v string) string {
+	return strings.TrimPrefix(v, "v")
+}
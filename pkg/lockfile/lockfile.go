@@ -0,0 +1,156 @@
+package lockfile
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Dependency is a resolved dependency recorded in a lockfile
+type Dependency struct {
+	Name      string
+	Version   string
+	Ecosystem string
+	// Dev marks dependencies only needed for development
+	Dev bool
+	// Indirect marks dependencies not required directly by the project
+	Indirect bool
+	// Unpublished marks dependencies resolved from a git repository or local path
+	// rather than a registry, whose versions may not match any published release
+	Unpublished bool
+}
+
+// parseFunc extracts the resolved dependencies from a lockfile's contents.
+// The path is used to resolve files the lockfile refers to.
+type parseFunc func(path string, data []byte) ([]Dependency, error)
+
+// parsers maps supported lockfile names to their parsers
+var parsers = map[string]parseFunc{
+	"package-lock.json":   parseNpmLock,
+	"npm-shrinkwrap.json": parseNpmLock,
+	"go.mod":              parseGoMod,
+	"go.sum":              parseGoSum,
+	"Pipfile.lock":        parsePipfileLock,
+	"poetry.lock":         parsePoetryLock,
+	"Gemfile.lock":        parseGemfileLock,
+	"gems.locked":         parseGemfileLock,
+	"Cargo.lock":          parseCargoLock,
+	"composer.lock":       parseComposerLock,
+}
+
+// patternParsers maps file name glob patterns to parsers, for files whose names vary
+var patternParsers = map[string]parseFunc{
+	"requirements*.txt": parseRequirements,
+}
+
+// parserFor returns the parser for a lockfile name
+func parserFor(name string) (parseFunc, bool) {
+	name = filepath.Base(name)
+	if parse, ok := parsers[name]; ok {
+		return parse, true
+	}
+	for pattern, parse := range patternParsers {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return parse, true
+		}
+	}
+	return nil, false
+}
+
+// IsLockfile reports whether a file name is a supported lockfile
+func IsLockfile(name string) bool {
+	_, ok := parserFor(name)
+	return ok
+}
+
+// Parse reads a lockfile and returns every resolved dependency, each name/version once
+func Parse(path string) ([]Dependency, error) {
+	parse, ok := parserFor(path)
+	if !ok {
+		return nil, fmt.Errorf("unsupported lockfile %s", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading lockfile %s: %w", path, err)
+	}
+
+	deps, err := parse(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing lockfile %s: %w", path, err)
+	}
+
+	return dedupe(deps), nil
+}
+
+// IsDependencyDir reports whether a directory name is that of an installed dependency
+// tree (node_modules, vendor, a virtual environment) or of version control metadata,
+// whose contents belong to other projects
+func IsDependencyDir(name string) bool {
+	switch name {
+	case "node_modules", "vendor", ".git", ".venv", "site-packages":
+		return true
+	}
+	return false
+}
+
+// Find returns the supported lockfiles below a directory. Installed dependency
+// trees (node_modules, vendor, virtual environments) are skipped, as their lockfiles
+// belong to other projects.
+func Find(dir string) ([]string, error) {
+	var found []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if IsDependencyDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !IsLockfile(d.Name()) {
+			return nil
+		}
+		// go.sum also lists modules outside the build, so go.mod is preferred when present
+		if d.Name() == "go.sum" {
+			if _, err := os.Stat(filepath.Join(filepath.Dir(path), "go.mod")); err == nil {
+				return nil
+			}
+		}
+		found = append(found, path)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error searching %s for lockfiles: %w", dir, err)
+	}
+	return found, nil
+}
+
+// dedupe removes repeated name/version pairs, keeping a dependency as non-dev
+// (direct, or published) if any occurrence is, and sorts the result by name and version
+func dedupe(deps []Dependency) []Dependency {
+	index := make(map[string]int)
+	var unique []Dependency
+	for _, dep := range deps {
+		key := dep.Ecosystem + "/" + dep.Name + "@" + dep.Version
+		if i, ok := index[key]; ok {
+			unique[i].Dev = unique[i].Dev && dep.Dev
+			unique[i].Indirect = unique[i].Indirect && dep.Indirect
+			unique[i].Unpublished = unique[i].Unpublished && dep.Unpublished
+			continue
+		}
+		index[key] = len(unique)
+		unique = append(unique, dep)
+	}
+
+	sort.Slice(unique, func(i, j int) bool {
+		if unique[i].Name != unique[j].Name {
+			return unique[i].Name < unique[j].Name
+		}
+		return unique[i].Version < unique[j].Version
+	})
+	return unique
+}
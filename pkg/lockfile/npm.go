@@ -0,0 +1,96 @@
+package lockfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// npmLock is the subset of package-lock.json / npm-shrinkwrap.json used for scanning
+type npmLock struct {
+	LockfileVersion int `json:"lockfileVersion"`
+	// Packages is keyed by install path (lockfileVersion 2 and 3)
+	Packages map[string]npmPackage `json:"packages"`
+	// Dependencies is the nested dependency tree (lockfileVersion 1)
+	Dependencies map[string]npmDependency `json:"dependencies"`
+}
+
+// npmPackage is an entry of the "packages" section
+type npmPackage struct {
+	// Name is set when the package is installed under an alias
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Dev     bool   `json:"dev"`
+	Link    bool   `json:"link"`
+}
+
+// npmDependency is an entry of the lockfileVersion 1 "dependencies" tree
+type npmDependency struct {
+	Version      string                   `json:"version"`
+	Dev          bool                     `json:"dev"`
+	Dependencies map[string]npmDependency `json:"dependencies"`
+}
+
+// parseNpmLock parses npm lockfiles of every lockfileVersion
+func parseNpmLock(_ string, data []byte) ([]Dependency, error) {
+	var lock npmLock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, err
+	}
+
+	if len(lock.Packages) > 0 {
+		return npmPackages(lock.Packages), nil
+	}
+	if lock.Dependencies != nil {
+		var deps []Dependency
+		npmDependencies(lock.Dependencies, &deps)
+		return deps, nil
+	}
+	if lock.LockfileVersion == 0 {
+		return nil, fmt.Errorf("not an npm lockfile: no lockfileVersion")
+	}
+	return nil, nil
+}
+
+// npmPackages reads the "packages" section. The root project ("") and links to
+// workspace folders are skipped; every installed copy is reported.
+func npmPackages(packages map[string]npmPackage) []Dependency {
+	var deps []Dependency
+	for path, pkg := range packages {
+		if path == "" || pkg.Link || pkg.Version == "" {
+			continue
+		}
+
+		i := strings.LastIndex(path, "node_modules/")
+		if i < 0 {
+			// Workspace package folders are part of the project itself
+			continue
+		}
+		name := path[i+len("node_modules/"):]
+		if pkg.Name != "" {
+			name = pkg.Name
+		}
+
+		deps = append(deps, Dependency{Name: name, Version: pkg.Version, Ecosystem: "npm", Dev: pkg.Dev})
+	}
+	return deps
+}
+
+// npmDependencies walks the lockfileVersion 1 dependency tree
+func npmDependencies(tree map[string]npmDependency, deps *[]Dependency) {
+	for name, dep := range tree {
+		version := dep.Version
+		// Aliased installs record the real package as "npm:<name>@<version>"
+		if alias, ok := strings.CutPrefix(version, "npm:"); ok {
+			if at := strings.LastIndex(alias, "@"); at > 0 {
+				name, version = alias[:at], alias[at+1:]
+			}
+		}
+
+		// Git, file and tarball dependencies have no registry version to query
+		if version != "" && !strings.Contains(version, ":") && !strings.Contains(version, "/") {
+			*deps = append(*deps, Dependency{Name: name, Version: version, Ecosystem: "npm", Dev: dep.Dev})
+		}
+		npmDependencies(dep.Dependencies, deps)
+	}
+}
@@ -0,0 +1,208 @@
+package lockfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// requirementPattern matches a pinned requirement such as "Django[argon2]==4.2.1"
+var requirementPattern = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)\s*(?:\[[^\]]*\])?\s*===?\s*([^\s;,]+)\s*(?:;.*)?$`)
+
+// parseRequirements reads a pip requirements file. Only pinned requirements (== or ===)
+// identify a version to query; ranges, URLs and editable installs are skipped.
+// Hash options, environment markers and comments are ignored, and files included
+// with -r/--requirement are read relative to the including file.
+func parseRequirements(path string, data []byte) ([]Dependency, error) {
+	return readRequirements(path, data, map[string]bool{filepath.Clean(path): true})
+}
+
+// readRequirements parses a requirements file, tracking visited files to avoid include cycles
+func readRequirements(path string, data []byte, visited map[string]bool) ([]Dependency, error) {
+	var deps []Dependency
+
+	for _, line := range requirementLines(data) {
+		if include, ok := requirementInclude(line); ok {
+			included := filepath.Join(filepath.Dir(path), include)
+			if visited[filepath.Clean(included)] {
+				continue
+			}
+			visited[filepath.Clean(included)] = true
+
+			content, err := os.ReadFile(included)
+			if err != nil {
+				return nil, fmt.Errorf("error reading included requirements %s: %w", included, err)
+			}
+			nested, err := readRequirements(included, content, visited)
+			if err != nil {
+				return nil, err
+			}
+			deps = append(deps, nested...)
+			continue
+		}
+
+		// Options such as --index-url or -e apply to the file, not a pinned package
+		if strings.HasPrefix(line, "-") {
+			continue
+		}
+
+		// Per-requirement options such as --hash follow the specifier
+		if i := strings.Index(line, " --"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+
+		if m := requirementPattern.FindStringSubmatch(line); m != nil {
+			deps = append(deps, Dependency{Name: m[1], Version: m[2], Ecosystem: "PyPI"})
+		}
+	}
+
+	return deps, nil
+}
+
+// requirementLines returns the logical lines of a requirements file, joining
+// backslash continuations and removing comments
+func requirementLines(data []byte) []string {
+	var lines []string
+	var current strings.Builder
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		// A comment starts at '#' at the beginning of the line or after whitespace
+		if i := strings.Index(line, " #"); i >= 0 {
+			line = line[:i]
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			line = ""
+		}
+
+		line = strings.TrimSpace(line)
+		if continued, ok := strings.CutSuffix(line, "\\"); ok {
+			current.WriteString(continued)
+			current.WriteString(" ")
+			continue
+		}
+		current.WriteString(line)
+
+		if logical := strings.TrimSpace(current.String()); logical != "" {
+			lines = append(lines, logical)
+		}
+		current.Reset()
+	}
+	if logical := strings.TrimSpace(current.String()); logical != "" {
+		lines = append(lines, logical)
+	}
+	return lines
+}
+
+// requirementInclude returns the file named by a -r/--requirement line
+func requirementInclude(line string) (string, bool) {
+	for _, prefix := range []string{"--requirement=", "--requirement ", "-r "} {
+		if file, ok := strings.CutPrefix(line, prefix); ok {
+			return strings.TrimSpace(file), true
+		}
+	}
+	if file, ok := strings.CutPrefix(line, "-r"); ok && file != "" && !strings.HasPrefix(file, "-") {
+		return strings.TrimSpace(file), true
+	}
+	return "", false
+}
+
+// parsePipfileLock reads the default and develop sections of a Pipfile.lock
+func parsePipfileLock(_ string, data []byte) ([]Dependency, error) {
+	var lock struct {
+		Default map[string]struct {
+			Version string `json:"version"`
+		} `json:"default"`
+		Develop map[string]struct {
+			Version string `json:"version"`
+		} `json:"develop"`
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, err
+	}
+
+	var deps []Dependency
+	for name, pkg := range lock.Default {
+		if version, ok := pinnedVersion(pkg.Version); ok {
+			deps = append(deps, Dependency{Name: name, Version: version, Ecosystem: "PyPI"})
+		}
+	}
+	for name, pkg := range lock.Develop {
+		if version, ok := pinnedVersion(pkg.Version); ok {
+			deps = append(deps, Dependency{Name: name, Version: version, Ecosystem: "PyPI", Dev: true})
+		}
+	}
+	return deps, nil
+}
+
+// pinnedVersion extracts the version of an "==1.2.3" specifier. VCS and path
+// entries have no version and are skipped.
+func pinnedVersion(specifier string) (string, bool) {
+	version, ok := strings.CutPrefix(specifier, "===")
+	if !ok {
+		version, ok = strings.CutPrefix(specifier, "==")
+	}
+	return strings.TrimSpace(version), ok && strings.TrimSpace(version) != ""
+}
+
+// parsePoetryLock reads the [[package]] tables of a poetry.lock file. Only the
+// name, version and category keys are needed, so the TOML is read line by line.
+func parsePoetryLock(_ string, data []byte) ([]Dependency, error) {
+	var deps []Dependency
+	var current *Dependency
+	inPackage := false
+
+	flush := func() {
+		if current != nil && current.Name != "" && current.Version != "" {
+			deps = append(deps, *current)
+		}
+		current = nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(line, "[") {
+			if line == "[[package]]" {
+				flush()
+				current = &Dependency{Ecosystem: "PyPI"}
+				inPackage = true
+			} else {
+				// Sub-tables such as [package.dependencies] list requirements, not the package
+				inPackage = false
+			}
+			continue
+		}
+		if !inPackage || current == nil {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		switch strings.TrimSpace(key) {
+		case "name":
+			current.Name = value
+		case "version":
+			current.Version = value
+		case "category":
+			current.Dev = value == "dev"
+		}
+	}
+	flush()
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return deps, nil
+}
@@ -0,0 +1,58 @@
+package lockfile
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+// parseGemfileLock reads the specs of the GEM sections of a Gemfile.lock. Gems from
+// GIT and PATH sections are not published to a registry and are skipped. Platform-specific
+// variants such as "nokogiri (1.15.4-x86_64-linux)" are reported under the plain version.
+func parseGemfileLock(_ string, data []byte) ([]Dependency, error) {
+	var deps []Dependency
+	section := ""
+	inSpecs := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		// Unindented lines start a new section
+		if !strings.HasPrefix(line, " ") {
+			section = strings.TrimSpace(line)
+			inSpecs = false
+			continue
+		}
+		if section != "GEM" {
+			continue
+		}
+
+		if strings.TrimSpace(line) == "specs:" {
+			inSpecs = true
+			continue
+		}
+
+		// Specs are indented by four spaces; their own dependencies by six
+		if !inSpecs || !strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "      ") {
+			continue
+		}
+
+		name, version, ok := strings.Cut(strings.TrimSpace(line), " (")
+		if !ok {
+			continue
+		}
+		version = strings.TrimSuffix(version, ")")
+
+		// RubyGems versions separate prerelease segments with dots, so a dash
+		// always introduces the platform
+		version, _, _ = strings.Cut(version, "-")
+
+		deps = append(deps, Dependency{Name: name, Version: version, Ecosystem: "RubyGems"})
+	}
+
+	return deps, scanner.Err()
+}
@@ -38,6 +38,10 @@ type LogConfig struct {
 	Level slog.Level
 	// Logging format (json or text)
 	Format LogFormat
+	// Whether console logs go to stderr, keeping stdout for machine-readable output
+	Stderr bool
+	// Whether only errors and the run's final summary are logged
+	Quiet bool
 }
 
 // DefaultConfig returns the default logging configuration
@@ -67,6 +71,10 @@ func ParseLogFormat(format string) LogFormat {
 // SetupLogger configures the global logger with file rotation
 func SetupLogger(config LogConfig) (*slog.Logger, error) {
 	var writer io.Writer
+	var console io.Writer = os.Stdout
+	if config.Stderr {
+		console = os.Stderr
+	}
 
 	// Create multi-writer if logging to file
 	if config.LogToFile {
@@ -85,11 +93,11 @@ func SetupLogger(config LogConfig) (*slog.Logger, error) {
 			Compress:   config.Compress,
 		}
 
-		// Log to both stdout and file
-		writer = io.MultiWriter(os.Stdout, fileLogger)
+		// Log to both the console and file
+		writer = io.MultiWriter(console, fileLogger)
 	} else {
-		// Log to stdout only
-		writer = os.Stdout
+		// Log to the console only
+		writer = console
 	}
 
 	// Create slog handler based on format
@@ -108,6 +116,10 @@ func SetupLogger(config LogConfig) (*slog.Logger, error) {
 		})
 	}
 
+	if config.Quiet {
+		handler = quietHandler{handler}
+	}
+
 	logger := slog.New(handler)
 
 	// Set as default logger
@@ -0,0 +1,42 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+// summaryKey marks the context of log records that belong to a run's final summary
+type summaryKey struct{}
+
+// SummaryContext returns a context marking the records logged with it as part of the
+// run's final summary, which quiet logging still shows
+func SummaryContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, summaryKey{}, true)
+}
+
+// isSummary reports whether a record was logged with a SummaryContext
+func isSummary(ctx context.Context) bool {
+	marked, _ := ctx.Value(summaryKey{}).(bool)
+	return marked
+}
+
+// quietHandler passes on only errors and the records of the final summary
+type quietHandler struct {
+	slog.Handler
+}
+
+// Enabled reports whether a record is an error or part of the final summary, and is
+// enabled by the wrapped handler
+func (h quietHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return (level >= slog.LevelError || isSummary(ctx)) && h.Handler.Enabled(ctx, level)
+}
+
+// WithAttrs returns a quiet handler adding attrs to every record
+func (h quietHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return quietHandler{h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup returns a quiet handler nesting the attributes of every record in a group
+func (h quietHandler) WithGroup(name string) slog.Handler {
+	return quietHandler{h.Handler.WithGroup(name)}
+}
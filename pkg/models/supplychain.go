@@ -0,0 +1,32 @@
+package models
+
+// Supply-chain finding kinds
+const (
+	// FindingUnverifiableProvenance means provenance exists but could not be checked
+	FindingUnverifiableProvenance = "unverifiable-provenance"
+	// FindingProvenanceMismatch means provenance exists but does not describe the artifact
+	FindingProvenanceMismatch = "provenance-mismatch"
+	// FindingMissingProvenance means provenance was required but none was found
+	FindingMissingProvenance = "missing-provenance"
+	// FindingInvalidProvenanceSignature means provenance describes the artifact but is
+	// unsigned, or its signature or signer does not verify
+	FindingInvalidProvenanceSignature = "invalid-provenance-signature"
+	// FindingUnsignedPackage means an artifact expected to be signed carries no signature
+	FindingUnsignedPackage = "unsigned-package"
+	// FindingInvalidSignature means an artifact's signature does not verify
+	FindingInvalidSignature = "invalid-signature"
+	// FindingUnverifiableSignature means an artifact's signature verifies but its signer
+	// cannot be trusted, as there are no roots its certificate must chain to
+	FindingUnverifiableSignature = "unverifiable-signature"
+)
+
+// SupplyChainFinding describes a problem with the origin of an artifact,
+// reported alongside vulnerabilities
+type SupplyChainFinding struct {
+	PackageName string
+	Version     string
+	Ecosystem   string
+	FilePath    string
+	Kind        string
+	Detail      string
+}
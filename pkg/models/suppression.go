@@ -0,0 +1,13 @@
+package models
+
+// SuppressedVulnerability is a finding that was excluded from the results,
+// for example because a VEX statement marks the product as not affected
+type SuppressedVulnerability struct {
+	Vulnerability Vulnerability
+	// Status is the reason category, e.g. not_affected or fixed
+	Status string
+	// Justification is the free-text or coded reason given for the suppression
+	Justification string
+	// Source identifies the document that suppressed the finding
+	Source string
+}
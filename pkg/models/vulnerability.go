@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"slices"
+	"time"
+)
 
 // ScanResults represents the top-level structure of the results.json file
 type ScanResults struct {
@@ -22,6 +25,32 @@ type Vulnerability struct {
 	Severity      []SeverityRating  `json:"severity,omitempty"`
 }
 
+// Reference types whose links reports show with each finding
+const (
+	// ReferenceAdvisory is a published security advisory
+	ReferenceAdvisory = "ADVISORY"
+	// ReferenceFix is a source change fixing the vulnerability, such as a commit
+	ReferenceFix = "FIX"
+)
+
+// ReferenceURLs returns the URLs of the vulnerability's references of a type, such as
+// ReferenceAdvisory, in their order and without duplicates
+func (v Vulnerability) ReferenceURLs(refType string) []string {
+	var urls []string
+	for _, ref := range v.References {
+		if ref.Type == refType && ref.URL != "" && !slices.Contains(urls, ref.URL) {
+			urls = append(urls, ref.URL)
+		}
+	}
+	return urls
+}
+
+// CWEs returns the IDs of the weaknesses the vulnerability is an instance of, such as
+// CWE-79, as its advisory database lists them
+func (v Vulnerability) CWEs() []string {
+	return v.DBSpecific.CWEIDs
+}
+
 // DatabaseSpecific contains database-specific information about the vulnerability
 type DatabaseSpecific struct {
 	GithubReviewedAt time.Time `json:"github_reviewed_at"`
@@ -43,6 +72,8 @@ type AffectedPackage struct {
 	Ranges           []Range                 `json:"ranges"`
 	Versions         []string                `json:"versions,omitempty"`
 	DatabaseSpecific PackageDatabaseSpecific `json:"database_specific,omitempty"`
+	// EcosystemSpecific holds fields defined by the ecosystem, such as Debian's urgency
+	EcosystemSpecific map[string]any `json:"ecosystem_specific,omitempty"`
 }
 
 // Package contains information about a specific software package
@@ -60,14 +91,18 @@ type Range struct {
 
 // Event represents a version event like when a vulnerability was introduced or fixed
 type Event struct {
-	Introduced string `json:"introduced,omitempty"`
-	Fixed      string `json:"fixed,omitempty"`
+	Introduced   string `json:"introduced,omitempty"`
+	Fixed        string `json:"fixed,omitempty"`
+	LastAffected string `json:"last_affected,omitempty"`
+	Limit        string `json:"limit,omitempty"`
 }
 
 // PackageDatabaseSpecific contains database-specific information about an affected package
 type PackageDatabaseSpecific struct {
 	Source                        string `json:"source"`
 	LastKnownAffectedVersionRange string `json:"last_known_affected_version_range,omitempty"`
+	// AffectedRange is the affected range as written by sources using range expressions, e.g. GitLab
+	AffectedRange string `json:"affected_range,omitempty"`
 }
 
 // SeverityRating represents the severity rating information
@@ -0,0 +1,167 @@
+// Package noise holds the built-in filters that keep findings nobody acts on out of
+// the results by default, per ecosystem. Each filter can be turned off by name.
+package noise
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+)
+
+// All turns off every built-in filter when given as a filter name
+const All = "all"
+
+// Status is the suppression status of findings removed by a built-in filter
+const Status = "ignored"
+
+// Filter is a built-in filter for one ecosystem. It either skips artifacts by file
+// name before they are read, or removes advisories from the results.
+type Filter struct {
+	Name        string
+	Ecosystem   string
+	Description string
+
+	// artifact reports whether an artifact is skipped, from its lowercased file name
+	artifact func(filename string) bool
+	// advisory reports whether an advisory for a package is removed
+	advisory func(vuln models.Vulnerability, name string) bool
+}
+
+// mavenNoiseClassifiers are the classifiers of jars holding sources, documentation or
+// tests rather than code that runs; they carry the coordinates of the main jar, so
+// scanning them only repeats its findings
+var mavenNoiseClassifiers = []string{"sources", "javadoc", "tests", "test-sources", "test-javadoc"}
+
+// debianNoiseUrgencies are the urgencies the Debian security team gives issues it
+// does not consider worth fixing in a stable release
+var debianNoiseUrgencies = []string{"unimportant", "minor"}
+
+// builtins are the built-in filters, all of which are on unless turned off
+var builtins = []Filter{
+	{
+		Name:        "maven-classifiers",
+		Ecosystem:   "Maven",
+		Description: "skip -sources, -javadoc and -tests jars",
+		artifact: func(filename string) bool {
+			base := strings.TrimSuffix(filename, ".jar")
+			if base == filename {
+				return false
+			}
+			for _, classifier := range mavenNoiseClassifiers {
+				if strings.HasSuffix(base, "-"+classifier) {
+					return true
+				}
+			}
+			return false
+		},
+	},
+	{
+		Name:        "debian-unimportant",
+		Ecosystem:   "Debian",
+		Description: "ignore advisories Debian rates unimportant or minor",
+		advisory: func(vuln models.Vulnerability, name string) bool {
+			var urgencies []string
+			for _, affected := range vuln.Affected {
+				base, _, _ := strings.Cut(affected.Package.Ecosystem, ":")
+				if !strings.EqualFold(base, "Debian") || !strings.EqualFold(affected.Package.Name, name) {
+					continue
+				}
+				urgency, _ := affected.EcosystemSpecific["urgency"].(string)
+				urgencies = append(urgencies, strings.ToLower(urgency))
+			}
+			// Every Debian entry for the package must be rated as noise
+			for _, urgency := range urgencies {
+				if !slices.Contains(debianNoiseUrgencies, urgency) {
+					return false
+				}
+			}
+			return len(urgencies) > 0
+		},
+	},
+}
+
+// Set is the built-in filters that are on
+type Set []Filter
+
+// Defaults returns the built-in filters less those turned off by name; All turns
+// them all off
+func Defaults(disabled []string) (Set, error) {
+	off := make(map[string]bool)
+	for _, name := range disabled {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == All {
+			return nil, nil
+		}
+		if !slices.Contains(Names(), name) {
+			return nil, fmt.Errorf("unknown default filter %q (available: %s, %s)", name, strings.Join(Names(), ", "), All)
+		}
+		off[name] = true
+	}
+
+	var set Set
+	for _, filter := range builtins {
+		if !off[filter.Name] {
+			set = append(set, filter)
+		}
+	}
+	return set, nil
+}
+
+// Names returns the names of the built-in filters, sorted
+func Names() []string {
+	names := make([]string, len(builtins))
+	for i, filter := range builtins {
+		names[i] = filter.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SkipsArtifact returns the filter skipping an artifact, given its path or file name
+func (s Set) SkipsArtifact(filePath string) (Filter, bool) {
+	filename := strings.ToLower(path.Base(strings.ReplaceAll(filePath, "\\", "/")))
+	for _, filter := range s {
+		if filter.artifact != nil && filter.artifact(filename) {
+			return filter, true
+		}
+	}
+	return Filter{}, false
+}
+
+// Filter splits the advisories found for a package into those that remain and those
+// removed by a filter for the package's ecosystem
+func (s Set) Filter(name, ecosystem string, vulns []models.Vulnerability) ([]models.Vulnerability, []models.SuppressedVulnerability) {
+	base, _, _ := strings.Cut(ecosystem, ":")
+	var filters Set
+	for _, filter := range s {
+		if filter.advisory != nil && strings.EqualFold(filter.Ecosystem, base) {
+			filters = append(filters, filter)
+		}
+	}
+	if len(filters) == 0 {
+		return vulns, nil
+	}
+
+	var kept []models.Vulnerability
+	var suppressed []models.SuppressedVulnerability
+vulnerabilities:
+	for _, vuln := range vulns {
+		for _, filter := range filters {
+			if filter.advisory(vuln, name) {
+				suppressed = append(suppressed, models.SuppressedVulnerability{
+					Vulnerability: vuln,
+					Status:        Status,
+					Justification: filter.Description,
+					Source:        "default filter " + filter.Name,
+				})
+				continue vulnerabilities
+			}
+		}
+		kept = append(kept, vuln)
+	}
+	return kept, suppressed
+}
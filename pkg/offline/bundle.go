@@ -0,0 +1,418 @@
+package offline
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/klauspost/compress/zstd"
+)
+
+// secretKeys matches configuration keys whose values must not leave the connected side,
+// including keys such as AZURE_STORAGE_KEY. Key IDs such as AWS_ACCESS_KEY_ID identify
+// a key without granting access and are kept.
+var secretKeys = regexp.MustCompile(`(?i)(PASSWORD|TOKEN|SECRET|HEADERS|CREDENTIAL|_KEY$)`)
+
+// publicKeys matches keys ending in _KEY that hold public keys, which are not secret
+var publicKeys = regexp.MustCompile(`(?i)PUBLIC_KEY$`)
+
+// urlPassword matches the password of credentials embedded in URLs, such as
+// DATABASE_URL, which is removed while the rest of the URL is kept
+var urlPassword = regexp.MustCompile(`(://[^:/@\s]*:)[^@\s]+@`)
+
+// BundleOptions selects what a bundle contains
+type BundleOptions struct {
+	// Ecosystems whose advisories are included
+	Ecosystems []string
+	// EnvFile is the tool configuration to include, with secrets removed
+	EnvFile string
+	// Base describes the data already held by the receiving side. When set, a delta
+	// bundle is built carrying only records modified after each ecosystem's watermark.
+	Base *Manifest
+}
+
+// CreateBundle packages the offline database for the selected ecosystems, the EPSS and
+// KEV data, and the tool configuration (with secrets removed) into a single archive.
+// The compression is chosen from the output extension: .tar.zst, .tar.gz or .tar.
+func CreateBundle(dir, out string, opts BundleOptions) error {
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return err
+	}
+
+	// Only the requested ecosystems are described by the bundle's manifest
+	bundled := &Manifest{
+		CreatedAt:     manifest.CreatedAt,
+		Ecosystems:    make(map[string]EcosystemState),
+		EPSSUpdatedAt: manifest.EPSSUpdatedAt,
+		KEVUpdatedAt:  manifest.KEVUpdatedAt,
+		Delta:         opts.Base != nil,
+	}
+	for _, ecosystem := range opts.Ecosystems {
+		state, ok := manifest.Ecosystems[ecosystem]
+		if !ok {
+			return fmt.Errorf("offline database has no advisories for ecosystem %s", ecosystem)
+		}
+
+		if opts.Base != nil {
+			base, ok := opts.Base.Ecosystems[ecosystem]
+			if !ok || base.Watermark.IsZero() {
+				return fmt.Errorf("the receiving side has no %s advisories; send a full bundle first", ecosystem)
+			}
+			if base.Watermark.Before(state.SnapshotAt) {
+				return fmt.Errorf("the receiving side's %s advisories (%s) predate the local snapshot (%s); send a full bundle",
+					ecosystem, base.Watermark.Format(time.RFC3339), state.SnapshotAt.Format(time.RFC3339))
+			}
+			state.Since = base.Watermark
+		}
+		bundled.Ecosystems[ecosystem] = state
+	}
+
+	file, err := os.Create(out)
+	if err != nil {
+		return fmt.Errorf("error creating bundle: %w", err)
+	}
+	defer file.Close()
+
+	compressed, err := compressWriter(file, out)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(compressed)
+
+	manifestData, err := json.MarshalIndent(bundled, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding bundle manifest: %w", err)
+	}
+	if err := addBytes(tw, manifestFile, manifestData); err != nil {
+		return err
+	}
+
+	for _, ecosystem := range opts.Ecosystems {
+		if bundled.Delta {
+			if err := addDelta(tw, dir, ecosystem, bundled.Ecosystems[ecosystem].Since); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := addTree(tw, dir, path.Join(osvDir, ecosystem)); err != nil {
+			return err
+		}
+	}
+	for _, name := range []string{epssFile, kevFile} {
+		if err := addFile(tw, filepath.Join(dir, filepath.FromSlash(name)), name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if opts.EnvFile != "" {
+		config, err := redactedConfig(opts.EnvFile)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil {
+			if err := addBytes(tw, configFile, config); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("error finishing bundle: %w", err)
+	}
+	if err := compressed.Close(); err != nil {
+		return fmt.Errorf("error finishing bundle: %w", err)
+	}
+	return file.Close()
+}
+
+// LoadBundle extracts a bundle into the offline database directory and merges its manifest
+func LoadBundle(bundle, dir string) (*Manifest, error) {
+	file, err := os.Open(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("error opening bundle: %w", err)
+	}
+	defer file.Close()
+
+	reader, err := decompressReader(bufio.NewReader(file))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var bundled *Manifest
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading bundle: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(header.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("bundle contains unsafe path %s", header.Name)
+		}
+
+		if name == manifestFile {
+			bundled = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(bundled); err != nil {
+				return nil, fmt.Errorf("error parsing bundle manifest: %w", err)
+			}
+			if err := prepareLoad(dir, bundled); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if bundled == nil {
+			return nil, fmt.Errorf("%s is not an offline bundle: manifest must come first", bundle)
+		}
+
+		if err := extractFile(tr, filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			return nil, err
+		}
+	}
+
+	if bundled == nil {
+		return nil, fmt.Errorf("%s is not an offline bundle: manifest missing", bundle)
+	}
+
+	// Merge the bundle's contents into the existing manifest
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	for ecosystem, state := range bundled.Ecosystems {
+		if bundled.Delta {
+			// A delta advances the existing data; its snapshot remains the local one
+			local := manifest.Ecosystems[ecosystem]
+			local.UpdatedAt = state.UpdatedAt
+			if state.Watermark.After(local.Watermark) {
+				local.Watermark = state.Watermark
+			}
+			state = local
+		}
+		state.Since = time.Time{}
+		manifest.Ecosystems[ecosystem] = state
+	}
+	if bundled.EPSSUpdatedAt.After(manifest.EPSSUpdatedAt) {
+		manifest.EPSSUpdatedAt = bundled.EPSSUpdatedAt
+	}
+	if bundled.KEVUpdatedAt.After(manifest.KEVUpdatedAt) {
+		manifest.KEVUpdatedAt = bundled.KEVUpdatedAt
+	}
+	if err := WriteManifest(dir, manifest); err != nil {
+		return nil, err
+	}
+
+	return bundled, nil
+}
+
+// prepareLoad checks that a bundle can be applied to the directory before anything
+// is extracted. A delta bundle must build on the local data without leaving a gap;
+// a full bundle replaces the ecosystem, including its delta records.
+func prepareLoad(dir string, bundled *Manifest) error {
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return err
+	}
+
+	for ecosystem, state := range bundled.Ecosystems {
+		if !bundled.Delta {
+			if err := os.RemoveAll(deltaPath(dir, ecosystem)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		local, ok := manifest.Ecosystems[ecosystem]
+		if !ok {
+			return fmt.Errorf("delta bundle for %s requires a full bundle to be loaded first", ecosystem)
+		}
+		if local.Watermark.Before(state.Since) {
+			return fmt.Errorf("delta bundle for %s starts at %s but local advisories only reach %s; build the bundle with --since set to the local manifest",
+				ecosystem, state.Since.Format(time.RFC3339), local.Watermark.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// compressWriter wraps w with the compression implied by the bundle file name
+func compressWriter(w io.Writer, name string) (io.WriteCloser, error) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar.zst"), strings.HasSuffix(lower, ".tzst"):
+		return zstd.NewWriter(w)
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return gzip.NewWriter(w), nil
+	case strings.HasSuffix(lower, ".tar"):
+		return nopWriteCloser{w}, nil
+	default:
+		return nil, fmt.Errorf("unsupported bundle extension for %s (use .tar.zst, .tar.gz or .tar)", name)
+	}
+}
+
+// decompressReader detects the bundle compression from its magic bytes
+func decompressReader(r *bufio.Reader) (io.ReadCloser, error) {
+	magic, _ := r.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("error reading zstd bundle: %w", err)
+		}
+		return decoder.IOReadCloser(), nil
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		decoder, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("error reading gzip bundle: %w", err)
+		}
+		return decoder, nil
+	default:
+		return io.NopCloser(r), nil
+	}
+}
+
+// nopWriteCloser adds a no-op Close to an uncompressed writer
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close does nothing
+func (nopWriteCloser) Close() error { return nil }
+
+// addTree adds every file below dir/rel to the archive
+func addTree(tw *tar.Writer, dir, rel string) error {
+	root := filepath.Join(dir, filepath.FromSlash(rel))
+	return filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".download-") {
+			return nil
+		}
+		name, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		return addFile(tw, p, filepath.ToSlash(name))
+	})
+}
+
+// addDelta adds the delta records of an ecosystem modified after since
+func addDelta(tw *tar.Writer, dir, ecosystem string, since time.Time) error {
+	files, err := filepath.Glob(filepath.Join(deltaPath(dir, ecosystem), "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		modified, err := recordFileModified(file)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", file, err)
+		}
+		if !modified.After(since) {
+			continue
+		}
+		name := path.Join(osvDir, ecosystem, deltaDir, filepath.Base(file))
+		if err := addFile(tw, file, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addFile adds a file from disk to the archive under the given name
+func addFile(tw *tar.Writer, src, name string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	header := &tar.Header{Name: name, Mode: 0644, Size: info.Size(), ModTime: info.ModTime()}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("error writing %s to bundle: %w", name, err)
+	}
+	if _, err := io.Copy(tw, file); err != nil {
+		return fmt.Errorf("error writing %s to bundle: %w", name, err)
+	}
+	return nil
+}
+
+// addBytes adds in-memory content to the archive under the given name
+func addBytes(tw *tar.Writer, name string, data []byte) error {
+	header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data))}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("error writing %s to bundle: %w", name, err)
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// extractFile writes an archive entry to disk, replacing any existing file only once complete
+func extractFile(r io.Reader, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error extracting %s: %w", dest, err)
+	}
+
+	return os.Rename(tmp.Name(), dest)
+}
+
+// redactedConfig reads a .env file and blanks out secret values and the passwords of
+// URLs
+func redactedConfig(envFile string) ([]byte, error) {
+	values, err := godotenv.Read(envFile)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range values {
+		if secretKeys.MatchString(key) && !publicKeys.MatchString(key) {
+			values[key] = ""
+			continue
+		}
+		values[key] = urlPassword.ReplaceAllString(value, "${1}@")
+	}
+
+	content, err := godotenv.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	return []byte("# Configuration exported by 'offline bundle'; secret values have been removed\n" + content + "\n"), nil
+}
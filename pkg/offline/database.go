@@ -0,0 +1,268 @@
+package offline
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+	"github.com/squarehole/package-scanner/pkg/osv"
+)
+
+// Database answers vulnerability queries from an offline advisory directory
+// instead of the OSV API
+type Database struct {
+	dir string
+
+	mu         sync.Mutex
+	ecosystems map[string]*ecosystemIndex
+}
+
+// ecosystemIndex holds the advisories of one ecosystem keyed by normalized package name
+type ecosystemIndex struct {
+	byName map[string][]record
+}
+
+// record is a parsed advisory together with its original JSON
+type record struct {
+	vuln models.Vulnerability
+	raw  json.RawMessage
+}
+
+// Open opens an offline advisory database directory
+func Open(dir string) (*Database, error) {
+	info, err := os.Stat(filepath.Join(dir, osvDir))
+	if err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("%s does not contain an offline advisory database; run 'offline bundle' or 'offline load' first", dir)
+	}
+
+	return &Database{
+		dir:        dir,
+		ecosystems: make(map[string]*ecosystemIndex),
+	}, nil
+}
+
+// QueryPackage returns the advisories affecting a package version, in the same
+// shape as the OSV API query response
+func (d *Database) QueryPackage(packageName, packageVersion, packageEcosystem string) (models.ScanResults, []byte, error) {
+	index, err := d.index(packageEcosystem)
+	if err != nil {
+		return models.ScanResults{}, nil, err
+	}
+
+	var results models.ScanResults
+	var raw []json.RawMessage
+	for _, rec := range index.byName[normalizeName(packageEcosystem, packageName)] {
+		if affectsVersion(rec.vuln, packageEcosystem, packageName, packageVersion) {
+			results.Vulnerabilities = append(results.Vulnerabilities, rec.vuln)
+			raw = append(raw, rec.raw)
+		}
+	}
+
+	body := []byte("{}")
+	if len(raw) > 0 {
+		body, err = json.Marshal(map[string][]json.RawMessage{"vulns": raw})
+		if err != nil {
+			return models.ScanResults{}, nil, fmt.Errorf("error encoding offline results: %w", err)
+		}
+	}
+
+	return results, body, nil
+}
+
+// Search returns the advisories of an ecosystem accepted by match, each once, in ID order
+func (d *Database) Search(ecosystem string, match func(models.Vulnerability) bool) ([]models.Vulnerability, error) {
+	index, err := d.index(ecosystem)
+	if err != nil {
+		return nil, err
+	}
+
+	// Advisories affecting several packages are indexed under each of them
+	seen := make(map[string]bool)
+	var matches []models.Vulnerability
+	for _, records := range index.byName {
+		for _, rec := range records {
+			if seen[rec.vuln.ID] {
+				continue
+			}
+			seen[rec.vuln.ID] = true
+			if match(rec.vuln) {
+				matches = append(matches, rec.vuln)
+			}
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+	return matches, nil
+}
+
+// index returns the loaded index for an ecosystem, reading it from disk on first use
+func (d *Database) index(ecosystem string) (*ecosystemIndex, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := strings.ToLower(ecosystem)
+	if index, ok := d.ecosystems[key]; ok {
+		return index, nil
+	}
+
+	dir, err := d.findEcosystemDir(ecosystem)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := loadZip(filepath.Join(dir, allRecords))
+	if err != nil {
+		return nil, err
+	}
+
+	// Delta records replace the snapshot's version of the same advisory
+	if err := loadDelta(filepath.Join(dir, deltaDir), records); err != nil {
+		return nil, err
+	}
+
+	index := &ecosystemIndex{byName: make(map[string][]record)}
+	for _, data := range records {
+		addRecord(index, ecosystem, data)
+	}
+
+	d.ecosystems[key] = index
+	return index, nil
+}
+
+// findEcosystemDir locates an ecosystem directory, matching its name case-insensitively
+func (d *Database) findEcosystemDir(ecosystem string) (string, error) {
+	entries, err := os.ReadDir(filepath.Join(d.dir, osvDir))
+	if err != nil {
+		return "", fmt.Errorf("error reading offline database: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() && strings.EqualFold(entry.Name(), ecosystem) {
+			return filepath.Join(d.dir, osvDir, entry.Name()), nil
+		}
+	}
+
+	return "", fmt.Errorf("offline database has no advisories for ecosystem %s", ecosystem)
+}
+
+// loadZip reads the advisories in an OSV bulk export archive, keyed by file name
+func loadZip(archivePath string) (map[string][]byte, error) {
+	archive, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening offline advisories %s: %w", archivePath, err)
+	}
+	defer archive.Close()
+
+	records := make(map[string][]byte)
+	for _, file := range archive.File {
+		if !strings.HasSuffix(file.Name, ".json") {
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", file.Name, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", file.Name, err)
+		}
+
+		records[path.Base(file.Name)] = data
+	}
+
+	return records, nil
+}
+
+// loadDelta reads the delta records of an ecosystem over the snapshot records
+func loadDelta(dir string, records map[string][]byte) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", file, err)
+		}
+		records[filepath.Base(file)] = data
+	}
+	return nil
+}
+
+// addRecord parses an advisory and indexes it under each affected package of the ecosystem
+func addRecord(index *ecosystemIndex, ecosystem string, data []byte) {
+	var vuln models.Vulnerability
+	if err := json.Unmarshal(data, &vuln); err != nil {
+		return
+	}
+
+	// Withdrawn advisories stay in the export but no longer apply
+	var status struct {
+		Withdrawn string `json:"withdrawn"`
+	}
+	if json.Unmarshal(data, &status) == nil && status.Withdrawn != "" {
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, affected := range vuln.Affected {
+		if !matchesEcosystem(affected.Package.Ecosystem, ecosystem) {
+			continue
+		}
+		name := normalizeName(ecosystem, affected.Package.Name)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		index.byName[name] = append(index.byName[name], record{vuln: vuln, raw: data})
+	}
+}
+
+// affectsVersion reports whether an advisory affects the version of the package, either
+// by listing it or, where the ecosystem's version ordering is known, through its ranges
+func affectsVersion(vuln models.Vulnerability, ecosystem, name, version string) bool {
+	for _, affected := range vuln.Affected {
+		if !matchesEcosystem(affected.Package.Ecosystem, ecosystem) ||
+			normalizeName(ecosystem, affected.Package.Name) != normalizeName(ecosystem, name) {
+			continue
+		}
+		if osv.AffectsVersion(affected, version) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesEcosystem compares ecosystem names, treating release-qualified
+// ecosystems such as "Debian:12" as part of their base ecosystem
+func matchesEcosystem(recordEcosystem, ecosystem string) bool {
+	base, _, _ := strings.Cut(recordEcosystem, ":")
+	return strings.EqualFold(base, ecosystem) || strings.EqualFold(recordEcosystem, ecosystem)
+}
+
+var pypiSeparators = regexp.MustCompile(`[-_.]+`)
+
+// normalizeName applies the ecosystem's package name comparison rules
+func normalizeName(ecosystem, name string) string {
+	switch strings.ToLower(ecosystem) {
+	case "pypi":
+		// PEP 503 normalization
+		return pypiSeparators.ReplaceAllString(strings.ToLower(name), "-")
+	case "nuget", "packagist":
+		return strings.ToLower(name)
+	default:
+		return name
+	}
+}
@@ -0,0 +1,179 @@
+package offline
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// UpdateResult summarizes the delta update of one ecosystem
+type UpdateResult struct {
+	Ecosystem string
+	// Records is the number of advisories downloaded
+	Records int
+	// Full is set when the ecosystem had no local data and the full export was downloaded
+	Full      bool
+	Watermark time.Time
+}
+
+// Update refreshes the offline database incrementally. For each ecosystem, only the
+// advisories modified since the local watermark are downloaded, as listed by the bulk
+// export's modified_id.csv; ecosystems without local data are downloaded in full.
+// With no ecosystems given, every ecosystem in the database is updated.
+func (d *Downloader) Update(dir string, ecosystems []string) ([]UpdateResult, error) {
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ecosystems) == 0 {
+		for ecosystem := range manifest.Ecosystems {
+			ecosystems = append(ecosystems, ecosystem)
+		}
+	}
+
+	var results []UpdateResult
+	for _, ecosystem := range ecosystems {
+		state, ok := manifest.Ecosystems[ecosystem]
+		if !ok || state.Watermark.IsZero() {
+			state, err = d.downloadSnapshot(dir, ecosystem)
+			if err != nil {
+				return results, err
+			}
+			results = append(results, UpdateResult{Ecosystem: ecosystem, Full: true, Watermark: state.Watermark})
+		} else {
+			count, watermark, err := d.downloadDelta(dir, ecosystem, state.Watermark)
+			if err != nil {
+				return results, fmt.Errorf("error updating %s advisories: %w", ecosystem, err)
+			}
+			state.UpdatedAt = time.Now().UTC()
+			state.Watermark = watermark
+			results = append(results, UpdateResult{Ecosystem: ecosystem, Records: count, Watermark: watermark})
+		}
+
+		// Record progress after each ecosystem so an interrupted update resumes where it stopped
+		manifest.Ecosystems[ecosystem] = state
+		if err := WriteManifest(dir, manifest); err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// downloadDelta downloads the records modified after the watermark into the ecosystem's
+// delta directory and returns the number of records and the new watermark
+func (d *Downloader) downloadDelta(dir, ecosystem string, watermark time.Time) (int, time.Time, error) {
+	resp, err := d.httpClient.Get(d.ecosystemURL(ecosystem, modifiedIDs))
+	if err != nil {
+		return 0, watermark, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, watermark, fmt.Errorf("download of %s failed with status code %d", modifiedIDs, resp.StatusCode)
+	}
+
+	changed, newest, err := parseModifiedIDs(resp.Body, watermark)
+	if err != nil {
+		return 0, watermark, err
+	}
+
+	d.logger.Info("Downloading changed advisories", "ecosystem", ecosystem, "records", len(changed), "since", watermark)
+	for _, id := range changed {
+		dest := filepath.Join(deltaPath(dir, ecosystem), id+".json")
+		if err := d.download(d.ecosystemURL(ecosystem, url.PathEscape(id)+".json"), dest); err != nil {
+			return 0, watermark, fmt.Errorf("error downloading %s: %w", id, err)
+		}
+	}
+
+	if newest.After(watermark) {
+		watermark = newest
+	}
+	return len(changed), watermark, nil
+}
+
+// parseModifiedIDs reads a modified_id.csv listing ("<modified>,<id>" per line, newest
+// first) and returns the IDs modified after the watermark and the newest modification time
+func parseModifiedIDs(r io.Reader, watermark time.Time) ([]string, time.Time, error) {
+	var ids []string
+	var newest time.Time
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		modifiedStr, id, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ",")
+		if !ok {
+			continue
+		}
+		modified, err := time.Parse(time.RFC3339, modifiedStr)
+		if err != nil {
+			return nil, newest, fmt.Errorf("invalid %s entry %q: %w", modifiedIDs, scanner.Text(), err)
+		}
+		if !modified.After(watermark) {
+			// The listing is sorted newest first, so everything below is already held
+			break
+		}
+		if modified.After(newest) {
+			newest = modified
+		}
+		// Entries may be prefixed with the ecosystem directory
+		ids = append(ids, filepath.Base(id))
+	}
+
+	return ids, newest, scanner.Err()
+}
+
+// zipWatermark returns the newest modification time of the records in a full export
+func zipWatermark(path string) (time.Time, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error opening offline advisories %s: %w", path, err)
+	}
+	defer archive.Close()
+
+	var newest time.Time
+	for _, file := range archive.File {
+		if !strings.HasSuffix(file.Name, ".json") {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return time.Time{}, err
+		}
+		modified, err := recordModified(rc)
+		rc.Close()
+		if err == nil && modified.After(newest) {
+			newest = modified
+		}
+	}
+	return newest, nil
+}
+
+// recordModified reads the modification time of an OSV record
+func recordModified(r io.Reader) (time.Time, error) {
+	var header struct {
+		Modified time.Time `json:"modified"`
+	}
+	if err := json.NewDecoder(r).Decode(&header); err != nil {
+		return time.Time{}, err
+	}
+	return header.Modified, nil
+}
+
+// recordFileModified reads the modification time of an OSV record file
+func recordFileModified(path string) (time.Time, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer file.Close()
+	return recordModified(file)
+}
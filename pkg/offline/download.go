@@ -0,0 +1,150 @@
+package offline
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Sources holds the download locations for offline data, overridable for internal mirrors
+type Sources struct {
+	// OSVBulkURL is the base of the OSV bulk export (<base>/<ecosystem>/all.zip)
+	OSVBulkURL string
+	EPSSURL    string
+	KEVURL     string
+}
+
+// DefaultSources returns the public download locations
+func DefaultSources() Sources {
+	return Sources{
+		OSVBulkURL: "https://osv-vulnerabilities.storage.googleapis.com",
+		EPSSURL:    "https://epss.empiricalsecurity.com/epss_scores-current.csv.gz",
+		KEVURL:     "https://www.cisa.gov/sites/default/files/feeds/known_exploited_vulnerabilities.json",
+	}
+}
+
+// Downloader fetches advisory data into an offline database directory
+type Downloader struct {
+	sources    Sources
+	httpClient *http.Client
+	logger     *slog.Logger
+}
+
+// NewDownloader creates a downloader for the given sources
+func NewDownloader(sources Sources, logger *slog.Logger) *Downloader {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &Downloader{
+		sources:    sources,
+		httpClient: &http.Client{Timeout: 30 * time.Minute},
+		logger:     logger,
+	}
+}
+
+// Prepare ensures the directory holds advisories for every requested ecosystem
+// plus the EPSS and KEV data, downloading anything that is missing
+func (d *Downloader) Prepare(dir string, ecosystems []string) (*Manifest, error) {
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ecosystem := range ecosystems {
+		if _, ok := manifest.Ecosystems[ecosystem]; ok {
+			d.logger.Info("Using existing offline advisories", "ecosystem", ecosystem)
+			continue
+		}
+
+		state, err := d.downloadSnapshot(dir, ecosystem)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Ecosystems[ecosystem] = state
+	}
+
+	if manifest.EPSSUpdatedAt.IsZero() {
+		if err := d.download(d.sources.EPSSURL, filepath.Join(dir, epssFile)); err != nil {
+			return nil, fmt.Errorf("error downloading EPSS scores: %w", err)
+		}
+		manifest.EPSSUpdatedAt = time.Now().UTC()
+	}
+
+	if manifest.KEVUpdatedAt.IsZero() {
+		if err := d.download(d.sources.KEVURL, filepath.Join(dir, kevFile)); err != nil {
+			return nil, fmt.Errorf("error downloading KEV catalog: %w", err)
+		}
+		manifest.KEVUpdatedAt = time.Now().UTC()
+	}
+
+	if err := WriteManifest(dir, manifest); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// downloadSnapshot downloads the full export of an ecosystem, replacing any delta records
+func (d *Downloader) downloadSnapshot(dir, ecosystem string) (EcosystemState, error) {
+	dest := filepath.Join(ecosystemPath(dir, ecosystem), allRecords)
+	if err := d.download(d.ecosystemURL(ecosystem, allRecords), dest); err != nil {
+		return EcosystemState{}, fmt.Errorf("error downloading %s advisories: %w", ecosystem, err)
+	}
+	if err := os.RemoveAll(deltaPath(dir, ecosystem)); err != nil {
+		return EcosystemState{}, err
+	}
+
+	watermark, err := zipWatermark(dest)
+	if err != nil {
+		return EcosystemState{}, err
+	}
+	return EcosystemState{UpdatedAt: time.Now().UTC(), SnapshotAt: watermark, Watermark: watermark}, nil
+}
+
+// ecosystemURL returns the bulk export URL of a file in an ecosystem's directory
+func (d *Downloader) ecosystemURL(ecosystem, name string) string {
+	return fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(d.sources.OSVBulkURL, "/"), url.PathEscape(ecosystem), name)
+}
+
+// download fetches a URL into a file, replacing it only once the download has completed
+func (d *Downloader) download(source, dest string) error {
+	d.logger.Info("Downloading offline data", "url", source, "destination", dest)
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	resp, err := d.httpClient.Get(source)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download of %s failed with status code %d", source, resp.StatusCode)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := io.Copy(tmp, resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	d.logger.Info("Downloaded offline data", "url", source, "bytes", size)
+	return os.Rename(tmp.Name(), dest)
+}
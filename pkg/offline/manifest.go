@@ -0,0 +1,98 @@
+package offline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Layout of an offline database directory
+const (
+	manifestFile = "manifest.json"
+	osvDir       = "osv"
+	epssFile     = "epss/epss_scores-current.csv.gz"
+	kevFile      = "kev/known_exploited_vulnerabilities.json"
+	configFile   = "config/.env"
+	allRecords   = "all.zip"
+	modifiedIDs  = "modified_id.csv"
+	deltaDir     = "delta"
+)
+
+// Manifest records what an offline database directory contains
+type Manifest struct {
+	CreatedAt     time.Time                 `json:"created_at"`
+	Ecosystems    map[string]EcosystemState `json:"ecosystems"`
+	EPSSUpdatedAt time.Time                 `json:"epss_updated_at,omitzero"`
+	KEVUpdatedAt  time.Time                 `json:"kev_updated_at,omitzero"`
+	// Delta marks a bundle that only carries records modified since each ecosystem's Since
+	Delta bool `json:"delta,omitempty"`
+}
+
+// EcosystemState records when an ecosystem's advisories were last downloaded
+type EcosystemState struct {
+	UpdatedAt time.Time `json:"updated_at"`
+	// SnapshotAt is the newest modification time in the full export (all.zip)
+	SnapshotAt time.Time `json:"snapshot_at,omitzero"`
+	// Watermark is the newest modification time of any record held, including delta updates
+	Watermark time.Time `json:"watermark,omitzero"`
+	// Since is the watermark a delta bundle builds on; it is only set in delta bundles
+	Since time.Time `json:"since,omitzero"`
+}
+
+// ReadManifest reads the manifest of an offline database directory.
+// A directory without a manifest returns an empty manifest.
+func ReadManifest(dir string) (*Manifest, error) {
+	return ReadManifestFile(filepath.Join(dir, manifestFile))
+}
+
+// ReadManifestFile reads a manifest file, such as one copied from an isolated machine.
+// A missing file returns an empty manifest.
+func ReadManifestFile(path string) (*Manifest, error) {
+	manifest := &Manifest{Ecosystems: make(map[string]EcosystemState)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading offline manifest: %w", err)
+	}
+
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("error parsing offline manifest: %w", err)
+	}
+	if manifest.Ecosystems == nil {
+		manifest.Ecosystems = make(map[string]EcosystemState)
+	}
+
+	return manifest, nil
+}
+
+// WriteManifest writes the manifest of an offline database directory
+func WriteManifest(dir string, manifest *Manifest) error {
+	if manifest.CreatedAt.IsZero() {
+		manifest.CreatedAt = time.Now().UTC()
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding offline manifest: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating offline directory: %w", err)
+	}
+	return os.WriteFile(filepath.Join(dir, manifestFile), data, 0644)
+}
+
+// ecosystemPath returns the directory holding an ecosystem's advisories
+func ecosystemPath(dir, ecosystem string) string {
+	return filepath.Join(dir, osvDir, ecosystem)
+}
+
+// deltaPath returns the directory holding an ecosystem's delta records
+func deltaPath(dir, ecosystem string) string {
+	return filepath.Join(ecosystemPath(dir, ecosystem), deltaDir)
+}
@@ -0,0 +1,228 @@
+package osv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Cassette is the OSV API traffic of a run, recorded with a Recorder and played back
+// with a Replayer. Request headers are not recorded, so API keys sent to a proxy are
+// not written to the cassette.
+type Cassette struct {
+	RecordedAt   time.Time     `json:"recorded_at"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is one request to the OSV API and the response it got
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a request sent to the OSV API
+type RecordedRequest struct {
+	Method string          `json:"method"`
+	URL    string          `json:"url"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// RecordedResponse is a response of the OSV API. JSON bodies are kept as JSON so the
+// cassette can be read and edited; other bodies, such as error pages, as text.
+type RecordedResponse struct {
+	Status     int             `json:"status"`
+	RetryAfter string          `json:"retry_after,omitempty"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	Text       string          `json:"text,omitempty"`
+}
+
+// Recorder is an http.RoundTripper that passes requests on to the network and
+// records each request and response, to be written to a cassette with Save.
+// It is safe for concurrent use.
+type Recorder struct {
+	next http.RoundTripper
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewRecorder creates a recorder sending requests through http.DefaultTransport
+func NewRecorder() *Recorder {
+	return &Recorder{next: http.DefaultTransport, cassette: Cassette{RecordedAt: time.Now().UTC()}}
+}
+
+// RoundTrip sends a request and records it with its response
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		// Failed requests have no response to replay, so they are not recorded
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	interaction := Interaction{
+		Request: RecordedRequest{Method: req.Method, URL: req.URL.String(), Body: compactJSON(body)},
+		Response: RecordedResponse{
+			Status:     resp.StatusCode,
+			RetryAfter: resp.Header.Get("Retry-After"),
+		},
+	}
+	if compact := compactJSON(respBody); compact != nil {
+		interaction.Response.Body = compact
+	} else {
+		interaction.Response.Text = string(respBody)
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.mu.Unlock()
+	return resp, nil
+}
+
+// Len returns the number of interactions recorded
+func (r *Recorder) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.cassette.Interactions)
+}
+
+// Save writes the recorded interactions to a cassette file
+func (r *Recorder) Save(path string) error {
+	r.mu.Lock()
+	data, err := json.MarshalIndent(r.cassette, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("error encoding cassette: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing cassette %s: %w", path, err)
+	}
+	return nil
+}
+
+// Replayer is an http.RoundTripper answering requests from a cassette without using
+// the network. Requests are matched by method and body, whatever URL they are sent to.
+// A request recorded several times, such as a retried one, gets its responses in the
+// order they were recorded, the last one repeating. It is safe for concurrent use.
+type Replayer struct {
+	mu        sync.Mutex
+	responses map[string][]RecordedResponse
+	served    map[string]int
+	misses    int
+}
+
+// LoadReplayer reads a cassette for replay
+func LoadReplayer(path string) (*Replayer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading cassette %s: %w", path, err)
+	}
+	var cassette Cassette
+	if err := json.Unmarshal(data, &cassette); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %w", path, err)
+	}
+
+	r := &Replayer{responses: make(map[string][]RecordedResponse), served: make(map[string]int)}
+	for _, interaction := range cassette.Interactions {
+		// Bodies are compacted again, as the cassette file is indented and may have been edited
+		response := interaction.Response
+		if response.Body != nil {
+			response.Body = compactJSON(response.Body)
+		}
+		key := replayKey(interaction.Request.Method, compactJSON(interaction.Request.Body))
+		r.responses[key] = append(r.responses[key], response)
+	}
+	return r, nil
+}
+
+// RoundTrip answers a request with its recorded response
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+
+	key := replayKey(req.Method, compactJSON(body))
+	r.mu.Lock()
+	responses := r.responses[key]
+	if len(responses) == 0 {
+		r.misses++
+		r.mu.Unlock()
+		return nil, fmt.Errorf("no recorded response for %s %s", req.Method, body)
+	}
+	n := min(r.served[key], len(responses)-1)
+	r.served[key]++
+	r.mu.Unlock()
+
+	recorded := responses[n]
+	resp := &http.Response{
+		Status:     strconv.Itoa(recorded.Status) + " " + http.StatusText(recorded.Status),
+		StatusCode: recorded.Status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Request:    req,
+	}
+	payload := []byte(recorded.Text)
+	if recorded.Body != nil {
+		payload = recorded.Body
+		resp.Header.Set("Content-Type", "application/json")
+	}
+	if recorded.RetryAfter != "" {
+		resp.Header.Set("Retry-After", recorded.RetryAfter)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(payload))
+	resp.ContentLength = int64(len(payload))
+	return resp, nil
+}
+
+// Misses returns the number of requests the cassette had no response for
+func (r *Replayer) Misses() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.misses
+}
+
+// replayKey identifies a request for replay
+func replayKey(method string, body json.RawMessage) string {
+	return method + " " + string(body)
+}
+
+// compactJSON returns a JSON document without insignificant whitespace, or nil if
+// data is empty or not JSON
+func compactJSON(data []byte) json.RawMessage {
+	if len(data) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return nil
+	}
+	return buf.Bytes()
+}
@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"strings"
+	"strconv"
+	"time"
 
+	"github.com/squarehole/package-scanner/pkg/cvss"
 	"github.com/squarehole/package-scanner/pkg/models"
 )
 
@@ -15,7 +17,44 @@ const defaultOSVAPIURL = "https://api.osv.dev/v1/query"
 
 // Client represents an OSV API client
 type Client struct {
-	apiURL string
+	apiURL    string
+	headers   http.Header
+	transport http.RoundTripper
+}
+
+// Option configures optional Client behaviour
+type Option func(*Client)
+
+// WithHeaders adds request headers, such as API keys or bearer tokens
+// required by a proxy in front of the OSV API, to every request
+func WithHeaders(headers http.Header) Option {
+	return func(c *Client) {
+		for name, values := range headers {
+			for _, value := range values {
+				c.headers.Add(name, value)
+			}
+		}
+	}
+}
+
+// WithTransport sends requests through a transport other than http.DefaultTransport,
+// such as a Recorder or Replayer
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		c.transport = transport
+	}
+}
+
+// APIError is returned when the OSV API answers a query with a status other than 200
+type APIError struct {
+	StatusCode int
+	Body       []byte
+	// RetryAfter is the wait the API asked for in a Retry-After header, or zero
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API request failed with status code %d: %s", e.StatusCode, e.Body)
 }
 
 // PackageQuery represents the request structure for the OSV API
@@ -31,15 +70,21 @@ type PackageInfo struct {
 }
 
 // NewClient creates a new OSV API client
-func NewClient(apiURL string) *Client {
+func NewClient(apiURL string, opts ...Option) *Client {
 	// Use default URL if not provided
 	if apiURL == "" {
 		apiURL = defaultOSVAPIURL
 	}
 
-	return &Client{
-		apiURL: apiURL,
+	client := &Client{
+		apiURL:  apiURL,
+		headers: make(http.Header),
 	}
+	for _, opt := range opts {
+		opt(client)
+	}
+
+	return client
 }
 
 // QueryPackage queries the OSV API for vulnerabilities in a package
@@ -65,11 +110,14 @@ func (c *Client) QueryPackage(packageName, packageVersion, packageEcosystem stri
 		return models.ScanResults{}, nil, fmt.Errorf("error creating HTTP request: %v", err)
 	}
 
-	// Set headers
+	// Set headers, with any configured headers applied on top of the defaults
 	req.Header.Set("Content-Type", "application/json")
+	for name, values := range c.headers {
+		req.Header[name] = values
+	}
 
 	// Send the request
-	client := &http.Client{}
+	client := &http.Client{Transport: c.transport}
 	resp, err := client.Do(req)
 	if err != nil {
 		return models.ScanResults{}, nil, fmt.Errorf("error sending request to OSV API: %v", err)
@@ -84,7 +132,11 @@ func (c *Client) QueryPackage(packageName, packageVersion, packageEcosystem stri
 
 	// Check if the response was successful
 	if resp.StatusCode != http.StatusOK {
-		return models.ScanResults{}, body, fmt.Errorf("API request failed with status code %d: %s", resp.StatusCode, body)
+		return models.ScanResults{}, body, &APIError{
+			StatusCode: resp.StatusCode,
+			Body:       body,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
 	}
 
 	// Parse the response into our vulnerability model
@@ -115,35 +167,20 @@ func (c *Client) QueryPackage(packageName, packageVersion, packageEcosystem stri
 
 // Helper functions for vulnerability analysis
 
-// ExtractCVSSScore extracts a numeric CVSS score from a CVSS string
+// ExtractCVSSScore returns the base score out of 10 computed from a CVSS vector, such
+// as "7.5/10" for "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:N/A:N", or "N/A" for a
+// vector that does not parse or cannot be scored
 func ExtractCVSSScore(cvssString string) string {
-	// CVSS strings are typically in format "CVSS:3.1/AV:N/AC:H/PR:N/UI:N/S:U/C:L/I:L/A:H"
-	// We'll find the numeric part for display purposes
-	if len(cvssString) == 0 {
+	vector, err := cvss.Parse(cvssString)
+	if err != nil || !vector.Scored() {
 		return "N/A"
 	}
-
-	// Extract base score from CVSS
-	parts := strings.Split(cvssString, "/")
-	if len(parts) < 1 {
-		return "N/A"
-	}
-
-	// Try to convert the standard format into a numeric score
-	// This is a simplified approximation
-	highCount := strings.Count(cvssString, ":H")
-	mediumCount := strings.Count(cvssString, ":M")
-	lowCount := strings.Count(cvssString, ":L")
-
-	// Simple heuristic to estimate score out of 10
-	score := float64(highCount)*3.0 + float64(mediumCount)*2.0 + float64(lowCount)*1.0
-	if score > 10.0 {
-		score = 10.0
-	}
-
-	return fmt.Sprintf("%.1f/10", score)
+	return fmt.Sprintf("%.1f/10", vector.BaseScore())
 }
 
+// NoFixVersion is returned by FindFixVersion when no fixed version is known
+const NoFixVersion = "No fix version found"
+
 // FindFixVersion returns the fixed version for a given package name in a vulnerability
 func FindFixVersion(vuln models.Vulnerability, packageName string) string {
 	for _, affected := range vuln.Affected {
@@ -157,33 +194,25 @@ func FindFixVersion(vuln models.Vulnerability, packageName string) string {
 			}
 		}
 	}
-	return "No fix version found"
+	return NoFixVersion
 }
 
-// GetSeverityRating gets the severity rating as a string from the vulnerability
+// GetSeverityRating gets the severity rating as a string from the vulnerability: the
+// base score of its CVSS vector, or the range of scores of the advisory's own severity
 func GetSeverityRating(vuln models.Vulnerability) string {
-	// Try to get CVSS score first
-	if len(vuln.Severity) > 0 {
-		for _, sev := range vuln.Severity {
-			if sev.Type == "CVSS_V3" {
-				return ExtractCVSSScore(sev.Score)
-			}
-		}
-	}
+	return cvss.Rate(vuln).String()
+}
 
-	// Fallback to database_specific severity
-	if vuln.DBSpecific.Severity != "" {
-		switch strings.ToUpper(vuln.DBSpecific.Severity) {
-		case "CRITICAL":
-			return "9.0+/10"
-		case "HIGH":
-			return "7.0-8.9/10"
-		case "MEDIUM":
-			return "4.0-6.9/10"
-		case "LOW":
-			return "0.1-3.9/10"
-		}
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
 	}
-
-	return "Unknown"
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		return max(time.Until(when), 0)
+	}
+	return 0
 }
@@ -0,0 +1,246 @@
+package osv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+)
+
+// Fixture files read by the mock server
+const (
+	mockResponsesDir = "responses"
+	mockVulnsDir     = "vulns"
+	mockChaosFile    = "chaos.json"
+)
+
+// MockServer is a stand-in for the OSV query API that serves canned responses from
+// fixture files, so policies, report formats and CI gating can be tested deterministically.
+// A fixture directory holds:
+//
+//   - responses/<ecosystem>/<name>/<version>.json: the response body for one package
+//     version, served as is
+//   - vulns/**/*.json: OSV records; other queries are answered with the records whose
+//     affected ranges or versions cover the queried version
+//   - chaos.json: optional faults to inject, see MockChaos
+//
+// Ecosystem directories are matched without regard to case. Queries matching nothing
+// get the empty response the real API gives.
+type MockServer struct {
+	listener net.Listener
+	server   *http.Server
+
+	// responses holds canned response bodies keyed by mockKey
+	responses map[string][]byte
+	vulns     []mockRecord
+	chaos     MockChaos
+	latency   time.Duration
+	queries   atomic.Int64
+}
+
+// MockChaos configures the faults a mock server injects, read from chaos.json
+type MockChaos struct {
+	// Latency delays every response, e.g. "250ms"
+	Latency string `json:"latency"`
+	// FailureRate is the fraction of package versions, between 0 and 1, whose queries fail.
+	// Which ones fail depends only on the package version and Seed, so runs repeat exactly.
+	FailureRate float64 `json:"failure_rate"`
+	// FailureStatus is the HTTP status failing queries get; 503 when not set
+	FailureStatus int `json:"failure_status"`
+	// Seed changes which package versions fail
+	Seed int64 `json:"seed"`
+}
+
+// mockRecord is an OSV record served by the mock server, with its original JSON
+type mockRecord struct {
+	vuln models.Vulnerability
+	raw  json.RawMessage
+}
+
+// NewMockServer loads the fixtures and starts serving them on a loopback port
+func NewMockServer(fixtures fs.FS) (*MockServer, error) {
+	m, err := loadMock(fixtures)
+	if err != nil {
+		return nil, err
+	}
+
+	m.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("error starting mock OSV server: %w", err)
+	}
+	m.server = &http.Server{Handler: m, ReadHeaderTimeout: 10 * time.Second}
+	go m.server.Serve(m.listener)
+	return m, nil
+}
+
+// URL returns the query endpoint of the server, to use as the OSV API URL
+func (m *MockServer) URL() string {
+	return "http://" + m.listener.Addr().String() + "/v1/query"
+}
+
+// Queries returns the number of queries the server has received
+func (m *MockServer) Queries() int {
+	return int(m.queries.Load())
+}
+
+// Close stops the server
+func (m *MockServer) Close() error {
+	return m.server.Close()
+}
+
+// ServeHTTP answers OSV package queries, so the server can also be mounted on a
+// test server of the caller's own
+func (m *MockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST queries are supported", http.StatusMethodNotAllowed)
+		return
+	}
+	var query PackageQuery
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&query); err != nil || query.Package == nil {
+		http.Error(w, `{"code":3,"message":"Invalid query."}`, http.StatusBadRequest)
+		return
+	}
+	m.queries.Add(1)
+
+	if m.latency > 0 {
+		time.Sleep(m.latency)
+	}
+	if m.fails(query) {
+		status := m.chaos.FailureStatus
+		if status == 0 {
+			status = http.StatusServiceUnavailable
+		}
+		http.Error(w, `{"code":14,"message":"Injected failure."}`, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(m.respond(query.Package.Name, query.Version, query.Package.Ecosystem))
+}
+
+// respond returns the canned response for a package version, or one built from the records
+func (m *MockServer) respond(name, version, ecosystem string) []byte {
+	if body, ok := m.responses[mockKey(ecosystem, name, version)]; ok {
+		return body
+	}
+
+	var raw []json.RawMessage
+	for _, rec := range m.vulns {
+		for _, affected := range rec.vuln.Affected {
+			base, _, _ := strings.Cut(affected.Package.Ecosystem, ":")
+			if strings.EqualFold(base, ecosystem) && strings.EqualFold(affected.Package.Name, name) &&
+				AffectsVersion(affected, version) {
+				raw = append(raw, rec.raw)
+				break
+			}
+		}
+	}
+	if len(raw) == 0 {
+		return []byte("{}")
+	}
+	body, _ := json.Marshal(map[string][]json.RawMessage{"vulns": raw})
+	return body
+}
+
+// fails reports whether the chaos configuration fails queries for a package version
+func (m *MockServer) fails(query PackageQuery) bool {
+	if m.chaos.FailureRate <= 0 {
+		return false
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d\x00%s", m.chaos.Seed, mockKey(query.Package.Ecosystem, query.Package.Name, query.Version))
+	return float64(h.Sum64()%10000)/10000 < m.chaos.FailureRate
+}
+
+// loadMock reads the fixtures of a mock server
+func loadMock(fixtures fs.FS) (*MockServer, error) {
+	m := &MockServer{responses: make(map[string][]byte)}
+
+	err := fs.WalkDir(fixtures, mockResponsesDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(p) != ".json" {
+			return nil
+		}
+		// responses/<ecosystem>/<name...>/<version>.json, where scoped npm names span two directories
+		parts := strings.Split(strings.TrimPrefix(p, mockResponsesDir+"/"), "/")
+		if len(parts) < 3 {
+			return fmt.Errorf("mock response %s is not at responses/<ecosystem>/<name>/<version>.json", p)
+		}
+		body, err := fs.ReadFile(fixtures, p)
+		if err != nil {
+			return err
+		}
+		if !json.Valid(body) {
+			return fmt.Errorf("mock response %s is not valid JSON", p)
+		}
+		name := strings.Join(parts[1:len(parts)-1], "/")
+		m.responses[mockKey(parts[0], name, strings.TrimSuffix(parts[len(parts)-1], ".json"))] = body
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error reading mock responses: %w", err)
+	}
+
+	err = fs.WalkDir(fixtures, mockVulnsDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(p) != ".json" {
+			return nil
+		}
+		data, err := fs.ReadFile(fixtures, p)
+		if err != nil {
+			return err
+		}
+		var vuln models.Vulnerability
+		if err := json.Unmarshal(data, &vuln); err != nil {
+			return fmt.Errorf("invalid OSV record %s: %w", p, err)
+		}
+		m.vulns = append(m.vulns, mockRecord{vuln: vuln, raw: data})
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error reading mock OSV records: %w", err)
+	}
+
+	data, err := fs.ReadFile(fixtures, mockChaosFile)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("error reading %s: %w", mockChaosFile, err)
+	default:
+		if err := json.Unmarshal(data, &m.chaos); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", mockChaosFile, err)
+		}
+		if m.chaos.Latency != "" {
+			if m.latency, err = time.ParseDuration(m.chaos.Latency); err != nil {
+				return nil, fmt.Errorf("invalid latency in %s: %w", mockChaosFile, err)
+			}
+		}
+		if m.chaos.FailureRate < 0 || m.chaos.FailureRate > 1 {
+			return nil, fmt.Errorf("failure_rate in %s must be between 0 and 1", mockChaosFile)
+		}
+	}
+
+	if len(m.responses) == 0 && len(m.vulns) == 0 {
+		return nil, fmt.Errorf("no mock responses or OSV records found; expected %s/ or %s/", mockResponsesDir, mockVulnsDir)
+	}
+	return m, nil
+}
+
+// mockKey identifies a package version, matching ecosystems without regard to case
+func mockKey(ecosystem, name, version string) string {
+	return strings.ToLower(ecosystem) + "\x00" + name + "\x00" + version
+}
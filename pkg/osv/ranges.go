@@ -0,0 +1,101 @@
+package osv
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+	"github.com/squarehole/package-scanner/pkg/version"
+)
+
+// AffectsVersion reports whether an affected package entry covers a version: when it
+// lists the version, or when the version falls in one of its SEMVER ranges or, for
+// ecosystems whose version ordering is implemented, one of its ECOSYSTEM ranges.
+// GIT ranges refer to commits and are not evaluated.
+func AffectsVersion(affected models.AffectedPackage, v string) bool {
+	ecosystem, _, _ := strings.Cut(affected.Package.Ecosystem, ":")
+	compare, ordered := version.ForEcosystem(ecosystem)
+
+	for _, listed := range affected.Versions {
+		if listed == v || (ordered && compare(listed, v) == 0) {
+			return true
+		}
+	}
+
+	for _, r := range affected.Ranges {
+		switch {
+		case r.Type == "SEMVER":
+			if inRange(r.Events, v, version.CompareSemver) {
+				return true
+			}
+		case r.Type == "ECOSYSTEM" && ordered:
+			if inRange(r.Events, v, compare) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// inRange evaluates the events of a range as the OSV schema describes: in version
+// order, an introduced event at or below the version opens the range, and a fixed
+// event at or below it, or a last_affected event below it, closes it again. With
+// limit events, the version must also be below one of the limits.
+func inRange(events []models.Event, v string, compare version.Comparator) bool {
+	sorted := slices.Clone(events)
+	slices.SortStableFunc(sorted, func(a, b models.Event) int {
+		return compareEvents(a, b, compare)
+	})
+
+	affected := false
+	limited, belowLimit := false, false
+	for _, event := range sorted {
+		switch {
+		case event.Introduced != "":
+			if event.Introduced == "0" || compare(v, event.Introduced) >= 0 {
+				affected = true
+			}
+		case event.Fixed != "":
+			if compare(v, event.Fixed) >= 0 {
+				affected = false
+			}
+		case event.LastAffected != "":
+			if compare(v, event.LastAffected) > 0 {
+				affected = false
+			}
+		case event.Limit != "" && event.Limit != "*":
+			limited = true
+			if compare(v, event.Limit) < 0 {
+				belowLimit = true
+			}
+		}
+	}
+	return affected && (!limited || belowLimit)
+}
+
+// compareEvents orders events by their version, with the "0" introduced event first
+func compareEvents(a, b models.Event, compare version.Comparator) int {
+	va, vb := eventVersion(a), eventVersion(b)
+	switch {
+	case va == vb:
+		return 0
+	case a.Introduced == "0":
+		return -1
+	case b.Introduced == "0":
+		return 1
+	}
+	return compare(va, vb)
+}
+
+// eventVersion returns the version an event refers to
+func eventVersion(event models.Event) string {
+	switch {
+	case event.Introduced != "":
+		return event.Introduced
+	case event.Fixed != "":
+		return event.Fixed
+	case event.LastAffected != "":
+		return event.LastAffected
+	}
+	return event.Limit
+}
@@ -0,0 +1,157 @@
+package osv
+
+import (
+	"testing"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+	"github.com/squarehole/package-scanner/pkg/version"
+)
+
+func TestInRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		events  []models.Event
+		version string
+		want    bool
+	}{
+		{
+			name:    "introduced at zero, before the fix",
+			events:  []models.Event{{Introduced: "0"}, {Fixed: "1.2.0"}},
+			version: "1.1.9",
+			want:    true,
+		},
+		{
+			name:    "at the fix",
+			events:  []models.Event{{Introduced: "0"}, {Fixed: "1.2.0"}},
+			version: "1.2.0",
+		},
+		{
+			name:    "below the introduced version",
+			events:  []models.Event{{Introduced: "1.0.0"}, {Fixed: "1.2.0"}},
+			version: "0.9.0",
+		},
+		{
+			name:    "at the introduced version",
+			events:  []models.Event{{Introduced: "1.0.0"}, {Fixed: "1.2.0"}},
+			version: "1.0.0",
+			want:    true,
+		},
+		{
+			name:    "no fix",
+			events:  []models.Event{{Introduced: "1.0.0"}},
+			version: "9.0.0",
+			want:    true,
+		},
+		{
+			name:    "at the last affected version",
+			events:  []models.Event{{Introduced: "0"}, {LastAffected: "1.4.0"}},
+			version: "1.4.0",
+			want:    true,
+		},
+		{
+			name:    "above the last affected version",
+			events:  []models.Event{{Introduced: "0"}, {LastAffected: "1.4.0"}},
+			version: "1.4.1",
+		},
+		{
+			name:    "reintroduced after a fix",
+			events:  []models.Event{{Introduced: "0"}, {Fixed: "1.2.0"}, {Introduced: "2.0.0"}, {Fixed: "2.1.0"}},
+			version: "2.0.5",
+			want:    true,
+		},
+		{
+			name:    "between two affected spans",
+			events:  []models.Event{{Introduced: "0"}, {Fixed: "1.2.0"}, {Introduced: "2.0.0"}, {Fixed: "2.1.0"}},
+			version: "1.5.0",
+		},
+		{
+			name:    "events out of order",
+			events:  []models.Event{{Fixed: "2.1.0"}, {Introduced: "2.0.0"}, {Fixed: "1.2.0"}, {Introduced: "0"}},
+			version: "2.0.5",
+			want:    true,
+		},
+		{
+			name:    "below the limit",
+			events:  []models.Event{{Introduced: "0"}, {Limit: "3.0.0"}},
+			version: "2.9.0",
+			want:    true,
+		},
+		{
+			name:    "at the limit",
+			events:  []models.Event{{Introduced: "0"}, {Limit: "3.0.0"}},
+			version: "3.0.0",
+		},
+		{
+			name:    "pre-release before the fix",
+			events:  []models.Event{{Introduced: "0"}, {Fixed: "1.2.0"}},
+			version: "1.2.0-rc.1",
+			want:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inRange(tt.events, tt.version, version.CompareSemver); got != tt.want {
+				t.Errorf("inRange(%v, %q) = %v, want %v", tt.events, tt.version, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAffectsVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		affected models.AffectedPackage
+		version  string
+		want     bool
+	}{
+		{
+			name:     "listed version",
+			affected: models.AffectedPackage{Package: models.Package{Ecosystem: "Go"}, Versions: []string{"1.0.0", "1.0.1"}},
+			version:  "1.0.1",
+			want:     true,
+		},
+		{
+			name:     "listed version in another spelling",
+			affected: models.AffectedPackage{Package: models.Package{Ecosystem: "PyPI"}, Versions: []string{"1.0rc1"}},
+			version:  "1.0-RC1",
+			want:     true,
+		},
+		{
+			name: "SEMVER range",
+			affected: models.AffectedPackage{Package: models.Package{Ecosystem: "Go"}, Ranges: []models.Range{
+				{Type: "SEMVER", Events: []models.Event{{Introduced: "0"}, {Fixed: "1.2.0"}}},
+			}},
+			version: "1.1.0",
+			want:    true,
+		},
+		{
+			name: "ECOSYSTEM range of an ordered ecosystem",
+			affected: models.AffectedPackage{Package: models.Package{Ecosystem: "PyPI"}, Ranges: []models.Range{
+				{Type: "ECOSYSTEM", Events: []models.Event{{Introduced: "0"}, {Fixed: "2.0"}}},
+			}},
+			version: "2.0rc1",
+			want:    true,
+		},
+		{
+			name: "ECOSYSTEM range of an unordered ecosystem",
+			affected: models.AffectedPackage{Package: models.Package{Ecosystem: "Debian:12"}, Ranges: []models.Range{
+				{Type: "ECOSYSTEM", Events: []models.Event{{Introduced: "0"}, {Fixed: "2.0"}}},
+			}},
+			version: "1.0",
+		},
+		{
+			name: "GIT range",
+			affected: models.AffectedPackage{Package: models.Package{Ecosystem: "npm"}, Ranges: []models.Range{
+				{Type: "GIT", Events: []models.Event{{Introduced: "0"}, {Fixed: "abc123"}}},
+			}},
+			version: "1.0.0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AffectsVersion(tt.affected, tt.version); got != tt.want {
+				t.Errorf("AffectsVersion(%q) = %v, want %v", tt.version, got, tt.want)
+			}
+		})
+	}
+}
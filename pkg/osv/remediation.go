@@ -0,0 +1,131 @@
+package osv
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+	"github.com/squarehole/package-scanner/pkg/version"
+)
+
+// Upgrade is the remediation of a vulnerable package version
+type Upgrade struct {
+	// Version is the lowest version clearing every vulnerability that has a fix, or empty
+	// if none has one
+	Version string
+	// Unfixed are the IDs of the vulnerabilities no release above the version fixes, sorted
+	Unfixed []string
+}
+
+// SafeUpgrade returns the lowest version a package can be upgraded to that clears the
+// vulnerabilities found in it. Each vulnerability is fixed by the lowest fixed version
+// above the scanned one, across all its ranges, and the highest of these is taken. That
+// version is checked against the ranges of every vulnerability again, since one
+// introduced again further up, or affecting another release line, can call for a
+// higher one. For ecosystems whose version ordering is not implemented, ECOSYSTEM ranges
+// cannot be checked and the highest fixed version is taken as it is.
+func SafeUpgrade(name, pkgVersion, ecosystem string, vulns []models.Vulnerability) Upgrade {
+	compare := ecosystemComparator(ecosystem)
+
+	var upgrade Upgrade
+	unfixed := make(map[string]bool)
+	target := pkgVersion
+	// Each pass raises the target past at least one fixed version, so the number of
+	// fixed versions bounds the passes
+	for pass := 0; pass <= fixedEventCount(vulns); pass++ {
+		next := target
+		for _, vuln := range vulns {
+			if unfixed[vuln.ID] {
+				continue
+			}
+			// Every vulnerability found affects the scanned version, whether or not
+			// its ranges can be evaluated
+			if pass > 0 && !affectsPackage(vuln, name, target) {
+				continue
+			}
+			fix := lowestFixAbove(vuln, name, target, compare)
+			if fix == "" {
+				unfixed[vuln.ID] = true
+				continue
+			}
+			if compare(fix, next) > 0 {
+				next = fix
+			}
+		}
+		if next == target {
+			break
+		}
+		target = next
+	}
+
+	if target != pkgVersion {
+		upgrade.Version = target
+	}
+	for id := range unfixed {
+		upgrade.Unfixed = append(upgrade.Unfixed, id)
+	}
+	sort.Strings(upgrade.Unfixed)
+	return upgrade
+}
+
+// affectsPackage reports whether a vulnerability covers a version of the named package
+func affectsPackage(vuln models.Vulnerability, name, v string) bool {
+	for _, affected := range vuln.Affected {
+		if strings.EqualFold(affected.Package.Name, name) && AffectsVersion(affected, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// lowestFixAbove returns the lowest fixed version of a vulnerability above a version of
+// the named package, or "" if it lists none
+func lowestFixAbove(vuln models.Vulnerability, name, v string, compare version.Comparator) string {
+	fix := ""
+	for _, affected := range vuln.Affected {
+		if !strings.EqualFold(affected.Package.Name, name) {
+			continue
+		}
+		for _, r := range affected.Ranges {
+			// GIT ranges are fixed by commits, not releases
+			if r.Type == "GIT" {
+				continue
+			}
+			for _, event := range r.Events {
+				if event.Fixed == "" || compare(event.Fixed, v) <= 0 {
+					continue
+				}
+				if fix == "" || compare(event.Fixed, fix) < 0 {
+					fix = event.Fixed
+				}
+			}
+		}
+	}
+	return fix
+}
+
+// fixedEventCount returns the number of fixed events of the vulnerabilities
+func fixedEventCount(vulns []models.Vulnerability) int {
+	count := 0
+	for _, vuln := range vulns {
+		for _, affected := range vuln.Affected {
+			for _, r := range affected.Ranges {
+				for _, event := range r.Events {
+					if event.Fixed != "" {
+						count++
+					}
+				}
+			}
+		}
+	}
+	return count
+}
+
+// ecosystemComparator returns the version ordering of an ecosystem, or the generic one
+func ecosystemComparator(ecosystem string) version.Comparator {
+	base, _, _ := strings.Cut(ecosystem, ":")
+	if compare, ok := version.ForEcosystem(base); ok {
+		return compare
+	}
+	return version.Compare
+}
@@ -0,0 +1,142 @@
+package osv
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+)
+
+// semverVuln returns a vulnerability of lodash with a SEMVER range per list of events
+func semverVuln(id string, ranges ...[]models.Event) models.Vulnerability {
+	affected := models.AffectedPackage{Package: models.Package{Name: "lodash", Ecosystem: "npm"}}
+	for _, events := range ranges {
+		affected.Ranges = append(affected.Ranges, models.Range{Type: "SEMVER", Events: events})
+	}
+	return models.Vulnerability{ID: id, Affected: []models.AffectedPackage{affected}}
+}
+
+func TestSafeUpgrade(t *testing.T) {
+	tests := []struct {
+		name      string
+		version   string
+		ecosystem string
+		vulns     []models.Vulnerability
+		want      Upgrade
+	}{
+		{
+			name:      "no vulnerabilities",
+			version:   "1.0.0",
+			ecosystem: "npm",
+		},
+		{
+			name:      "single fix",
+			version:   "1.0.0",
+			ecosystem: "npm",
+			vulns: []models.Vulnerability{
+				semverVuln("GHSA-1", []models.Event{{Introduced: "0"}, {Fixed: "1.2.0"}}),
+			},
+			want: Upgrade{Version: "1.2.0"},
+		},
+		{
+			name:      "highest fix of several vulnerabilities",
+			version:   "1.0.0",
+			ecosystem: "npm",
+			vulns: []models.Vulnerability{
+				semverVuln("GHSA-1", []models.Event{{Introduced: "0"}, {Fixed: "1.2.0"}}),
+				semverVuln("GHSA-2", []models.Event{{Introduced: "0"}, {Fixed: "1.5.0"}}),
+			},
+			want: Upgrade{Version: "1.5.0"},
+		},
+		{
+			name:      "lowest fix above the version across release lines",
+			version:   "2.0.0",
+			ecosystem: "npm",
+			vulns: []models.Vulnerability{
+				semverVuln("GHSA-1",
+					[]models.Event{{Introduced: "0"}, {Fixed: "1.9.3"}},
+					[]models.Event{{Introduced: "2.0.0"}, {Fixed: "2.1.0"}},
+					[]models.Event{{Introduced: "3.0.0"}, {Fixed: "3.0.2"}},
+				),
+			},
+			want: Upgrade{Version: "2.1.0"},
+		},
+		{
+			name:      "fix reaching into a range of another vulnerability",
+			version:   "2.0.0",
+			ecosystem: "npm",
+			vulns: []models.Vulnerability{
+				semverVuln("GHSA-1", []models.Event{{Introduced: "0"}, {Fixed: "2.1.0"}}),
+				semverVuln("GHSA-2",
+					[]models.Event{{Introduced: "2.0.0"}, {Fixed: "2.0.5"}},
+					[]models.Event{{Introduced: "2.1.0"}, {Fixed: "2.3.0"}},
+				),
+			},
+			want: Upgrade{Version: "2.3.0"},
+		},
+		{
+			name:      "vulnerability without a fix",
+			version:   "1.0.0",
+			ecosystem: "npm",
+			vulns: []models.Vulnerability{
+				semverVuln("GHSA-1", []models.Event{{Introduced: "0"}, {Fixed: "1.2.0"}}),
+				semverVuln("GHSA-2", []models.Event{{Introduced: "0"}}),
+			},
+			want: Upgrade{Version: "1.2.0", Unfixed: []string{"GHSA-2"}},
+		},
+		{
+			name:      "only unfixed vulnerabilities",
+			version:   "1.0.0",
+			ecosystem: "npm",
+			vulns: []models.Vulnerability{
+				semverVuln("GHSA-2", []models.Event{{Introduced: "0"}}),
+				semverVuln("GHSA-1", []models.Event{{Introduced: "0"}, {LastAffected: "9.9.9"}}),
+			},
+			want: Upgrade{Unfixed: []string{"GHSA-1", "GHSA-2"}},
+		},
+		{
+			name:      "fixes ordered by semver rather than as strings",
+			version:   "1.9.0",
+			ecosystem: "npm",
+			vulns: []models.Vulnerability{
+				semverVuln("GHSA-1", []models.Event{{Introduced: "0"}, {Fixed: "1.10.0"}}),
+				semverVuln("GHSA-2", []models.Event{{Introduced: "0"}, {Fixed: "1.9.1"}}),
+			},
+			want: Upgrade{Version: "1.10.0"},
+		},
+		{
+			name:      "GIT ranges are not fixed by releases",
+			version:   "1.0.0",
+			ecosystem: "npm",
+			vulns: []models.Vulnerability{{ID: "GHSA-1", Affected: []models.AffectedPackage{{
+				Package: models.Package{Name: "lodash", Ecosystem: "npm"},
+				Ranges:  []models.Range{{Type: "GIT", Events: []models.Event{{Introduced: "0"}, {Fixed: "abc123"}}}},
+			}}}},
+			want: Upgrade{Unfixed: []string{"GHSA-1"}},
+		},
+		{
+			name:      "ranges of other packages are ignored",
+			version:   "1.0.0",
+			ecosystem: "npm",
+			vulns: []models.Vulnerability{{ID: "GHSA-1", Affected: []models.AffectedPackage{
+				{
+					Package: models.Package{Name: "lodash-es", Ecosystem: "npm"},
+					Ranges:  []models.Range{{Type: "SEMVER", Events: []models.Event{{Introduced: "0"}, {Fixed: "4.0.0"}}}},
+				},
+				{
+					Package: models.Package{Name: "lodash", Ecosystem: "npm"},
+					Ranges:  []models.Range{{Type: "SEMVER", Events: []models.Event{{Introduced: "0"}, {Fixed: "1.0.1"}}}},
+				},
+			}}},
+			want: Upgrade{Version: "1.0.1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SafeUpgrade("lodash", tt.version, tt.ecosystem, tt.vulns)
+			if got.Version != tt.want.Version || !slices.Equal(got.Unfixed, tt.want.Unfixed) {
+				t.Errorf("SafeUpgrade(%q) = %+v, want %+v", tt.version, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+// Package pins turns the fixes recommended by a scan into files pinning each vulnerable
+// package to its fixed version, in the format of its ecosystem's package manager, ready
+// to commit or feed to automation.
+package pins
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+	"github.com/squarehole/package-scanner/pkg/osv"
+	"github.com/squarehole/package-scanner/pkg/version"
+)
+
+// Pin is the version a vulnerable package should be raised to
+type Pin struct {
+	Name      string
+	Ecosystem string
+	// Versions are the vulnerable versions found, sorted
+	Versions []string
+	// Version is the lowest version fixing every advisory found for the package
+	Version string
+	// Advisories are the IDs of the advisories the pin fixes, sorted
+	Advisories []string
+}
+
+// Unfixed is a vulnerable package with advisories no release fixes yet
+type Unfixed struct {
+	Name       string
+	Ecosystem  string
+	Version    string
+	Advisories []string
+}
+
+// Set collects the pins of a scan. It is safe for concurrent use.
+type Set struct {
+	mu      sync.Mutex
+	pins    map[string]*Pin
+	unfixed []Unfixed
+}
+
+// New creates an empty set of pins
+func New() *Set {
+	return &Set{pins: make(map[string]*Pin)}
+}
+
+// Add records the advisories found for a package version. The package is pinned to the
+// lowest version clearing every advisory that has a fix, as osv.SafeUpgrade finds it, so
+// one upgrade fixes them all. Advisories without a fix are recorded as unfixed.
+func (s *Set) Add(name, pkgVersion, ecosystem string, vulns []models.Vulnerability) {
+	if len(vulns) == 0 {
+		return
+	}
+	compare := comparator(ecosystem)
+
+	upgrade := osv.SafeUpgrade(name, pkgVersion, ecosystem, vulns)
+	target, unfixed := upgrade.Version, upgrade.Unfixed
+	var fixed []string
+	for _, vuln := range vulns {
+		if !slices.Contains(unfixed, vuln.ID) {
+			fixed = append(fixed, vuln.ID)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(unfixed) > 0 {
+		s.unfixed = append(s.unfixed, Unfixed{Name: name, Ecosystem: ecosystem, Version: pkgVersion, Advisories: unfixed})
+	}
+	if target == "" {
+		return
+	}
+
+	// A package found at several versions, e.g. in several lockfiles, is pinned once
+	key := ecosystem + "|" + name
+	pin := s.pins[key]
+	if pin == nil {
+		pin = &Pin{Name: name, Ecosystem: ecosystem, Version: target}
+		s.pins[key] = pin
+	} else if compare(target, pin.Version) > 0 {
+		pin.Version = target
+	}
+	pin.Versions = appendUnique(pin.Versions, pkgVersion)
+	for _, id := range fixed {
+		pin.Advisories = appendUnique(pin.Advisories, id)
+	}
+}
+
+// comparator returns the version ordering of an ecosystem, or the generic one
+func comparator(ecosystem string) version.Comparator {
+	base, _, _ := strings.Cut(ecosystem, ":")
+	if compare, ok := version.ForEcosystem(base); ok {
+		return compare
+	}
+	return version.Compare
+}
+
+// appendUnique adds a value to a sorted list unless it is in it already
+func appendUnique(list []string, value string) []string {
+	i := sort.SearchStrings(list, value)
+	if i < len(list) && list[i] == value {
+		return list
+	}
+	list = append(list, "")
+	copy(list[i+1:], list[i:])
+	list[i] = value
+	return list
+}
+
+// Pins returns the pins collected, sorted by ecosystem and name
+func (s *Set) Pins() []Pin {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pins := make([]Pin, 0, len(s.pins))
+	for _, pin := range s.pins {
+		pins = append(pins, *pin)
+	}
+	sort.Slice(pins, func(i, j int) bool {
+		if pins[i].Ecosystem != pins[j].Ecosystem {
+			return pins[i].Ecosystem < pins[j].Ecosystem
+		}
+		return pins[i].Name < pins[j].Name
+	})
+	return pins
+}
+
+// Unfixed returns the packages with advisories no release fixes yet
+func (s *Set) Unfixed() []Unfixed {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Unfixed(nil), s.unfixed...)
+}
+
+// format writes the pins of one ecosystem as the file its package manager reads
+type format struct {
+	file   string
+	render func(pins []Pin) ([]byte, error)
+}
+
+// formats maps the ecosystems pin files are written for to their format
+var formats = map[string]format{
+	"npm":       {"npm-overrides.json", renderNpm},
+	"NuGet":     {"Directory.Packages.props", renderNuGet},
+	"PyPI":      {"constraints.txt", renderPip},
+	"Go":        {"go.mod.require", renderGo},
+	"Maven":     {"dependency-management.xml", renderMaven},
+	"RubyGems":  {"Gemfile.pins", renderGemfile},
+	"Packagist": {"composer-require.json", renderComposer},
+}
+
+// Write writes one pin file per ecosystem to dir, creating it if needed, and returns the
+// files written and the ecosystems that have no pin file format
+func (s *Set) Write(dir string) (written, unsupported []string, err error) {
+	byEcosystem := make(map[string][]Pin)
+	for _, pin := range s.Pins() {
+		base, _, _ := strings.Cut(pin.Ecosystem, ":")
+		byEcosystem[base] = append(byEcosystem[base], pin)
+	}
+	if len(byEcosystem) == 0 {
+		return nil, nil, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, fmt.Errorf("error creating pins directory %s: %w", dir, err)
+	}
+
+	ecosystems := make([]string, 0, len(byEcosystem))
+	for ecosystem := range byEcosystem {
+		ecosystems = append(ecosystems, ecosystem)
+	}
+	sort.Strings(ecosystems)
+	for _, ecosystem := range ecosystems {
+		f, ok := formats[ecosystem]
+		if !ok {
+			unsupported = append(unsupported, ecosystem)
+			continue
+		}
+		data, err := f.render(byEcosystem[ecosystem])
+		if err != nil {
+			return written, unsupported, fmt.Errorf("error rendering %s pins: %w", ecosystem, err)
+		}
+		path := filepath.Join(dir, f.file)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return written, unsupported, fmt.Errorf("error writing pins %s: %w", path, err)
+		}
+		written = append(written, path)
+	}
+	return written, unsupported, nil
+}
+
+// comment describes a pin for formats with comments
+func comment(pin Pin) string {
+	return fmt.Sprintf("%s -> %s fixes %s", strings.Join(pin.Versions, ", "), pin.Version, strings.Join(pin.Advisories, ", "))
+}
+
+// renderNpm writes an overrides block for npm and the same block as resolutions for Yarn
+func renderNpm(pins []Pin) ([]byte, error) {
+	versions := make(map[string]string, len(pins))
+	for _, pin := range pins {
+		versions[pin.Name] = pin.Version
+	}
+	data, err := json.MarshalIndent(map[string]map[string]string{
+		"overrides":   versions,
+		"resolutions": versions,
+	}, "", "  ")
+	return append(data, '\n'), err
+}
+
+// renderNuGet writes the PackageVersion items of central package management
+func renderNuGet(pins []Pin) ([]byte, error) {
+	var b strings.Builder
+	b.WriteString("<Project>\n  <ItemGroup>\n")
+	for _, pin := range pins {
+		fmt.Fprintf(&b, "    <!-- %s -->\n", xmlComment(comment(pin)))
+		fmt.Fprintf(&b, "    <PackageVersion Include=\"%s\" Version=\"%s\" />\n", xmlEscape(pin.Name), xmlEscape(pin.Version))
+	}
+	b.WriteString("  </ItemGroup>\n</Project>\n")
+	return []byte(b.String()), nil
+}
+
+// renderPip writes a pip constraints file
+func renderPip(pins []Pin) ([]byte, error) {
+	var b strings.Builder
+	for _, pin := range pins {
+		fmt.Fprintf(&b, "%s==%s  # %s\n", pin.Name, pin.Version, comment(pin))
+	}
+	return []byte(b.String()), nil
+}
+
+// renderGo writes a require block for go.mod
+func renderGo(pins []Pin) ([]byte, error) {
+	var b strings.Builder
+	b.WriteString("require (\n")
+	for _, pin := range pins {
+		v := pin.Version
+		if !strings.HasPrefix(v, "v") {
+			v = "v" + v
+		}
+		fmt.Fprintf(&b, "\t%s %s // %s\n", pin.Name, v, comment(pin))
+	}
+	b.WriteString(")\n")
+	return []byte(b.String()), nil
+}
+
+// renderMaven writes a dependencyManagement section for a pom.xml; packages are named
+// groupId:artifactId
+func renderMaven(pins []Pin) ([]byte, error) {
+	var b strings.Builder
+	b.WriteString("<dependencyManagement>\n  <dependencies>\n")
+	for _, pin := range pins {
+		group, artifact, ok := strings.Cut(pin.Name, ":")
+		if !ok {
+			return nil, fmt.Errorf("Maven package %s is not named groupId:artifactId", pin.Name)
+		}
+		fmt.Fprintf(&b, "    <!-- %s -->\n", xmlComment(comment(pin)))
+		fmt.Fprintf(&b, "    <dependency>\n      <groupId>%s</groupId>\n      <artifactId>%s</artifactId>\n      <version>%s</version>\n    </dependency>\n",
+			xmlEscape(group), xmlEscape(artifact), xmlEscape(pin.Version))
+	}
+	b.WriteString("  </dependencies>\n</dependencyManagement>\n")
+	return []byte(b.String()), nil
+}
+
+// renderGemfile writes gem lines for a Gemfile
+func renderGemfile(pins []Pin) ([]byte, error) {
+	var b strings.Builder
+	for _, pin := range pins {
+		fmt.Fprintf(&b, "gem %q, %q # %s\n", pin.Name, ">= "+pin.Version, comment(pin))
+	}
+	return []byte(b.String()), nil
+}
+
+// renderComposer writes a require block for composer.json
+func renderComposer(pins []Pin) ([]byte, error) {
+	require := make(map[string]string, len(pins))
+	for _, pin := range pins {
+		require[pin.Name] = "^" + pin.Version
+	}
+	data, err := json.MarshalIndent(map[string]map[string]string{"require": require}, "", "    ")
+	return append(data, '\n'), err
+}
+
+// xmlEscape escapes text for an XML attribute or element
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// xmlComment keeps text from closing an XML comment
+func xmlComment(s string) string {
+	return strings.ReplaceAll(s, "--", "- -")
+}
@@ -0,0 +1,88 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+)
+
+// StatusBaseline marks the suppressions of findings accepted by writing a baseline
+const StatusBaseline = "baseline"
+
+// Baseline collects the findings of a scan to write them as a policy of suppressions, so
+// later scans only report, and fail on, findings that are new since
+type Baseline struct {
+	mu       sync.Mutex
+	findings map[string]Suppression
+}
+
+// NewBaseline creates an empty baseline
+func NewBaseline() *Baseline {
+	return &Baseline{findings: make(map[string]Suppression)}
+}
+
+// Add records the vulnerabilities found for a package. It is safe for concurrent use.
+func (b *Baseline) Add(name, ecosystem string, vulns []models.Vulnerability) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, vuln := range vulns {
+		s := Suppression{ID: vuln.ID, Package: name, Ecosystem: ecosystem, Status: StatusBaseline}
+		b.findings[s.key()] = s
+	}
+}
+
+// Write writes the baseline to path as a policy file. A finding already suppressed by an
+// unexpired entry of previous, the baseline written before, keeps that entry with its
+// justification and expiry; the others get a new entry expiring at expires, if it is set.
+// Entries of previous whose findings were not seen again are dropped. It returns the
+// numbers of entries kept and added.
+func (b *Baseline) Write(path string, previous *Policy, expires string, now time.Time) (kept, added int, err error) {
+	existing := make(map[string]Suppression)
+	if previous != nil {
+		for _, s := range previous.Suppressions {
+			if !s.expiredAt(now) {
+				existing[s.key()] = s
+			}
+		}
+	}
+
+	b.mu.Lock()
+	baseline := &Policy{Suppressions: make([]Suppression, 0, len(b.findings))}
+	for key, s := range b.findings {
+		if previous, ok := existing[key]; ok {
+			baseline.Suppressions = append(baseline.Suppressions, previous)
+			kept++
+			continue
+		}
+		s.Justification = "Baseline of " + now.Format("2006-01-02")
+		s.Expires = expires
+		baseline.Suppressions = append(baseline.Suppressions, s)
+		added++
+	}
+	b.mu.Unlock()
+
+	sort.Slice(baseline.Suppressions, func(i, j int) bool {
+		a, c := baseline.Suppressions[i], baseline.Suppressions[j]
+		if !strings.EqualFold(a.Package, c.Package) {
+			return strings.ToLower(a.Package) < strings.ToLower(c.Package)
+		}
+		if a.Ecosystem != c.Ecosystem {
+			return a.Ecosystem < c.Ecosystem
+		}
+		return a.ID < c.ID
+	})
+
+	data, err := baseline.Marshal()
+	if err != nil {
+		return 0, 0, fmt.Errorf("error encoding baseline: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return 0, 0, fmt.Errorf("error writing baseline %s: %w", path, err)
+	}
+	return kept, added, nil
+}
@@ -0,0 +1,143 @@
+package policy
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Column names recognized in triage spreadsheets, after lowercasing and
+// replacing underscores and dashes with spaces
+var columnAliases = map[string][]string{
+	"id":            {"vuln id", "vulnerability id", "vulnerability", "advisory", "advisory id", "cve", "id"},
+	"package":       {"package", "package name", "component"},
+	"ecosystem":     {"ecosystem"},
+	"decision":      {"decision", "status", "state", "triage"},
+	"justification": {"justification", "reason", "rationale", "comment", "comments", "notes"},
+	"expiry":        {"expiry", "expires", "expiry date", "expiration", "expiration date", "review by"},
+}
+
+// decisions maps the triage decisions that suppress a finding to a policy status.
+// Other decisions (affected, fix, upgrade, investigate) leave the finding reported.
+var decisions = map[string]string{
+	"not affected":   StatusNotAffected,
+	"not applicable": StatusNotAffected,
+	"false positive": StatusNotAffected,
+	"mitigated":      StatusNotAffected,
+	"accepted":       StatusAccepted,
+	"accept":         StatusAccepted,
+	"risk accepted":  StatusAccepted,
+	"wont fix":       StatusAccepted,
+	"ignore":         StatusAccepted,
+	"fixed":          StatusFixed,
+	"resolved":       StatusFixed,
+}
+
+// ImportResult holds the suppressions read from a triage spreadsheet
+type ImportResult struct {
+	Suppressions []Suppression
+	// Skipped counts rows whose decision does not suppress the finding
+	Skipped int
+}
+
+// ImportCSV reads a triage spreadsheet exported as CSV. The first row names the
+// columns; a vulnerability ID and decision column are required, while package,
+// ecosystem, justification and expiry columns are optional.
+func ImportCSV(r io.Reader) (ImportResult, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return ImportResult{}, fmt.Errorf("spreadsheet is empty")
+	}
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("error reading header: %w", err)
+	}
+
+	columns := mapColumns(header)
+	for _, required := range []string{"id", "decision"} {
+		if _, ok := columns[required]; !ok {
+			return ImportResult{}, fmt.Errorf("no %s column found (expected one of: %s)",
+				required, strings.Join(columnAliases[required], ", "))
+		}
+	}
+
+	var result ImportResult
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return ImportResult{}, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		status, ok := decisions[normalize(field("decision"))]
+		if !ok {
+			result.Skipped++
+			continue
+		}
+
+		s := Suppression{
+			ID:            field("id"),
+			Package:       field("package"),
+			Ecosystem:     field("ecosystem"),
+			Status:        status,
+			Justification: field("justification"),
+			Expires:       field("expiry"),
+		}
+		if s.ID == "" {
+			return ImportResult{}, fmt.Errorf("line %d: missing vulnerability ID", line)
+		}
+		if _, err := s.expiry(); err != nil {
+			return ImportResult{}, fmt.Errorf("line %d: %w", line, err)
+		}
+		result.Suppressions = append(result.Suppressions, s)
+	}
+
+	return result, nil
+}
+
+// mapColumns returns the index of each recognized column in the header row
+func mapColumns(header []string) map[string]int {
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = normalize(name)
+		for column, aliases := range columnAliases {
+			if _, taken := columns[column]; taken {
+				continue
+			}
+			for _, alias := range aliases {
+				if name == alias {
+					columns[column] = i
+				}
+			}
+		}
+	}
+	return columns
+}
+
+// normalize lowercases a header or decision, treats underscores and dashes as
+// spaces and drops apostrophes, so "Won't Fix" and "wont_fix" compare equal
+func normalize(value string) string {
+	value = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(value, "\ufeff")))
+	value = strings.NewReplacer("_", " ", "-", " ", "'", "", "\u2019", "").Replace(value)
+	return strings.Join(strings.Fields(value), " ")
+}
@@ -0,0 +1,179 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+	"gopkg.in/yaml.v3"
+)
+
+// Suppression statuses recorded in a policy
+const (
+	StatusNotAffected = "not_affected"
+	StatusAccepted    = "accepted"
+	StatusFixed       = "fixed"
+)
+
+// Suppression excludes one vulnerability from the results, optionally only for one package
+type Suppression struct {
+	// ID is the vulnerability ID or one of its aliases
+	ID string `yaml:"id"`
+	// Package limits the suppression to one package; empty applies it to every package
+	Package string `yaml:"package,omitempty"`
+	// Ecosystem limits the suppression to one ecosystem; empty matches any
+	Ecosystem     string `yaml:"ecosystem,omitempty"`
+	Status        string `yaml:"status"`
+	Justification string `yaml:"justification,omitempty"`
+	// Expires is the date (YYYY-MM-DD) or RFC 3339 time after which the suppression no longer applies
+	Expires string `yaml:"expires,omitempty"`
+}
+
+// Policy holds the suppressions loaded from a policy file
+type Policy struct {
+	Suppressions []Suppression `yaml:"suppressions"`
+
+	// source is the file the policy was loaded from, reported with suppressed findings
+	source string
+}
+
+// Load reads a YAML policy file
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading policy file %s: %w", path, err)
+	}
+
+	policy := &Policy{source: path}
+	if err := yaml.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("error parsing policy file %s: %w", path, err)
+	}
+	for i, s := range policy.Suppressions {
+		if s.ID == "" {
+			return nil, fmt.Errorf("policy file %s: suppression %d has no id", path, i+1)
+		}
+		if _, err := s.expiry(); err != nil {
+			return nil, fmt.Errorf("policy file %s: suppression %s: %w", path, s.ID, err)
+		}
+	}
+	return policy, nil
+}
+
+// Marshal returns the policy as YAML
+func (p *Policy) Marshal() ([]byte, error) {
+	return yaml.Marshal(p)
+}
+
+// Merge adds suppressions to the policy, replacing any existing entry for the
+// same vulnerability, package and ecosystem. It returns the number of entries replaced.
+func (p *Policy) Merge(suppressions []Suppression) int {
+	replaced := 0
+	for _, s := range suppressions {
+		found := false
+		for i, existing := range p.Suppressions {
+			if existing.key() == s.key() {
+				p.Suppressions[i] = s
+				found = true
+				replaced++
+				break
+			}
+		}
+		if !found {
+			p.Suppressions = append(p.Suppressions, s)
+		}
+	}
+	return replaced
+}
+
+// Expired returns the suppressions whose expiry has passed at the given time
+func (p *Policy) Expired(now time.Time) []Suppression {
+	var expired []Suppression
+	for _, s := range p.Suppressions {
+		if s.expiredAt(now) {
+			expired = append(expired, s)
+		}
+	}
+	return expired
+}
+
+// Filter splits vulnerabilities for a package into those that remain and those
+// suppressed by an unexpired policy entry
+func (p *Policy) Filter(name, ecosystem string, vulns []models.Vulnerability, now time.Time) ([]models.Vulnerability, []models.SuppressedVulnerability) {
+	if p == nil || len(p.Suppressions) == 0 {
+		return vulns, nil
+	}
+
+	var kept []models.Vulnerability
+	var suppressed []models.SuppressedVulnerability
+	for _, vuln := range vulns {
+		s, ok := p.match(vuln, name, ecosystem, now)
+		if !ok {
+			kept = append(kept, vuln)
+			continue
+		}
+		suppressed = append(suppressed, models.SuppressedVulnerability{
+			Vulnerability: vuln,
+			Status:        s.Status,
+			Justification: s.Justification,
+			Source:        p.source,
+		})
+	}
+
+	return kept, suppressed
+}
+
+// match finds an unexpired suppression covering the vulnerability for the given package
+func (p *Policy) match(vuln models.Vulnerability, name, ecosystem string, now time.Time) (Suppression, bool) {
+	for _, s := range p.Suppressions {
+		if s.expiredAt(now) {
+			continue
+		}
+		if s.Package != "" && !strings.EqualFold(s.Package, name) {
+			continue
+		}
+		if s.Ecosystem != "" && !strings.EqualFold(s.Ecosystem, ecosystem) {
+			continue
+		}
+		if strings.EqualFold(s.ID, vuln.ID) {
+			return s, true
+		}
+		for _, alias := range vuln.Aliases {
+			if strings.EqualFold(s.ID, alias) {
+				return s, true
+			}
+		}
+	}
+	return Suppression{}, false
+}
+
+// key identifies the finding a suppression applies to
+func (s Suppression) key() string {
+	return strings.ToUpper(s.ID) + "|" + strings.ToLower(s.Package) + "|" + strings.ToLower(s.Ecosystem)
+}
+
+// expiredAt reports whether the suppression has expired at the given time
+func (s Suppression) expiredAt(now time.Time) bool {
+	expiry, err := s.expiry()
+	return err == nil && !expiry.IsZero() && now.After(expiry)
+}
+
+// expiry parses the expiry of the suppression; a date expires at the end of that day
+func (s Suppression) expiry() (time.Time, error) {
+	if s.Expires == "" {
+		return time.Time{}, nil
+	}
+	return parseExpiry(s.Expires)
+}
+
+// parseExpiry parses an expiry given as an RFC 3339 time or a YYYY-MM-DD date
+func parseExpiry(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t.AddDate(0, 0, 1), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid expiry %q, expected YYYY-MM-DD or an RFC 3339 time", value)
+}
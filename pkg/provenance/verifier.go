@@ -0,0 +1,433 @@
+package provenance
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+	"github.com/squarehole/package-scanner/pkg/signature"
+)
+
+const defaultNpmRegistryURL = "https://registry.npmjs.org"
+
+// Sidecar file suffixes checked for provenance next to an artifact
+var sidecarSuffixes = []string{".sigstore", ".sigstore.json", ".intoto.jsonl"}
+
+// Verifier checks artifacts against the provenance published for them.
+//
+// Provenance is located in sigstore bundles or in-toto attestation files stored
+// next to the artifact, and for npm packages in the registry's attestation endpoint.
+// The in-toto statement subjects are compared with the artifact digest, and the DSSE
+// envelope carrying a matching statement must be signed. Its signature is verified
+// with the certificate of the sigstore bundle it came in, which with trusted roots
+// must also chain to one of them, or with the cosign public key.
+type Verifier struct {
+	httpClient     *http.Client
+	npmRegistryURL string
+	// requireProvenance reports artifacts without any provenance as findings
+	requireProvenance bool
+	// roots, when set, are the certificates the signing certificates of sigstore
+	// bundles must chain to
+	roots *x509.CertPool
+	// key, when set, verifies envelopes signed with a key rather than a certificate
+	key crypto.PublicKey
+}
+
+// NewVerifier creates a provenance verifier. When requireProvenance is set,
+// artifacts without provenance are reported as findings. Roots and key are optional;
+// without roots the signer of a sigstore bundle is not checked, and without a key
+// envelopes signed with a key cannot be verified.
+func NewVerifier(npmRegistryURL string, requireProvenance bool, roots *x509.CertPool, key crypto.PublicKey) *Verifier {
+	if npmRegistryURL == "" {
+		npmRegistryURL = defaultNpmRegistryURL
+	}
+
+	return &Verifier{
+		httpClient:        &http.Client{Timeout: 30 * time.Second},
+		npmRegistryURL:    strings.TrimSuffix(npmRegistryURL, "/"),
+		requireProvenance: requireProvenance,
+		roots:             roots,
+		key:               key,
+	}
+}
+
+// envelope is a DSSE envelope as found in sigstore bundles and in-toto attestation files
+type envelope struct {
+	PayloadType string              `json:"payloadType"`
+	Payload     string              `json:"payload"`
+	Signatures  []envelopeSignature `json:"signatures"`
+	// certificates are the DER certificates of the sigstore bundle the envelope came
+	// in, the signing certificate first
+	certificates [][]byte
+}
+
+// envelopeSignature is a signature of a DSSE envelope
+type envelopeSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// sigstoreBundle is the subset of a sigstore bundle used for verification. Bundles
+// before v0.2 carry the certificate chain, later ones only the signing certificate.
+type sigstoreBundle struct {
+	DSSEEnvelope         *envelope `json:"dsseEnvelope"`
+	VerificationMaterial struct {
+		X509CertificateChain struct {
+			Certificates []struct {
+				RawBytes string `json:"rawBytes"`
+			} `json:"certificates"`
+		} `json:"x509CertificateChain"`
+		Certificate *struct {
+			RawBytes string `json:"rawBytes"`
+		} `json:"certificate"`
+	} `json:"verificationMaterial"`
+}
+
+// envelope returns the bundle's envelope with its certificates, or nil if it has none
+func (b sigstoreBundle) envelope() *envelope {
+	if b.DSSEEnvelope == nil {
+		return nil
+	}
+	env := *b.DSSEEnvelope
+	material := b.VerificationMaterial
+	if material.Certificate != nil {
+		if der, err := base64.StdEncoding.DecodeString(material.Certificate.RawBytes); err == nil {
+			env.certificates = append(env.certificates, der)
+		}
+	}
+	for _, cert := range material.X509CertificateChain.Certificates {
+		if der, err := base64.StdEncoding.DecodeString(cert.RawBytes); err == nil {
+			env.certificates = append(env.certificates, der)
+		}
+	}
+	return &env
+}
+
+// statement is the subset of an in-toto statement used for verification
+type statement struct {
+	PredicateType string `json:"predicateType"`
+	Subject       []struct {
+		Name   string            `json:"name"`
+		Digest map[string]string `json:"digest"`
+	} `json:"subject"`
+}
+
+// Verify checks the provenance of a package artifact and returns any findings
+func (v *Verifier) Verify(name, version, ecosystem, filePath string) []models.SupplyChainFinding {
+	finding := func(kind, detail string) models.SupplyChainFinding {
+		return models.SupplyChainFinding{
+			PackageName: name,
+			Version:     version,
+			Ecosystem:   ecosystem,
+			FilePath:    filePath,
+			Kind:        kind,
+			Detail:      detail,
+		}
+	}
+
+	var digests map[string]string
+	if filePath != "" {
+		var err error
+		digests, err = fileDigests(filePath)
+		if err != nil {
+			return []models.SupplyChainFinding{finding(models.FindingUnverifiableProvenance, err.Error())}
+		}
+	}
+
+	var findings []models.SupplyChainFinding
+	found := false
+
+	// Sidecar bundles shipped next to the artifact
+	for _, suffix := range sidecarSuffixes {
+		if filePath == "" {
+			break
+		}
+		data, err := os.ReadFile(filePath + suffix)
+		if err != nil {
+			continue
+		}
+		found = true
+
+		envelopes, err := parseEnvelopes(data)
+		if err != nil {
+			findings = append(findings, finding(models.FindingUnverifiableProvenance,
+				fmt.Sprintf("%s: %v", filePath+suffix, err)))
+			continue
+		}
+		if f, ok := v.checkEnvelopes(envelopes, digests, filePath+suffix); !ok {
+			findings = append(findings, finding(f.kind, f.detail))
+		}
+	}
+
+	// npm registry attestations
+	if strings.EqualFold(ecosystem, "npm") {
+		envelopes, err := v.npmAttestations(name, version)
+		switch {
+		case err != nil:
+			findings = append(findings, finding(models.FindingUnverifiableProvenance, err.Error()))
+			found = true
+		case len(envelopes) > 0:
+			found = true
+			if digests == nil {
+				break
+			}
+			if f, ok := v.checkEnvelopes(envelopes, digests, "npm registry attestations"); !ok {
+				findings = append(findings, finding(f.kind, f.detail))
+			}
+		}
+	}
+
+	if !found && v.requireProvenance {
+		findings = append(findings, finding(models.FindingMissingProvenance, "no provenance found for artifact"))
+	}
+
+	return findings
+}
+
+// checkResult describes why a set of envelopes failed verification
+type checkResult struct {
+	kind   string
+	detail string
+}
+
+// checkEnvelopes verifies that at least one signed in-toto statement has a subject
+// matching the artifact digests
+func (v *Verifier) checkEnvelopes(envelopes []envelope, digests map[string]string, source string) (checkResult, bool) {
+	statements := 0
+	// rejected is why the last statement matching the artifact was not accepted
+	var rejected *checkResult
+	for _, env := range envelopes {
+		payload, err := base64.StdEncoding.DecodeString(env.Payload)
+		if err != nil {
+			continue
+		}
+
+		var st statement
+		if err := json.Unmarshal(payload, &st); err != nil || len(st.Subject) == 0 {
+			continue
+		}
+		statements++
+
+		// Without a local artifact there is nothing to compare against
+		if digests != nil && !subjectMatches(st, digests) {
+			continue
+		}
+
+		if f, ok := v.verifySignature(env, payload, source); !ok {
+			rejected = &f
+			continue
+		}
+		return checkResult{}, true
+	}
+
+	if rejected != nil {
+		return *rejected, false
+	}
+	if statements == 0 {
+		return checkResult{models.FindingUnverifiableProvenance,
+			fmt.Sprintf("%s: no in-toto statement with subjects found", source)}, false
+	}
+	return checkResult{models.FindingProvenanceMismatch,
+		fmt.Sprintf("%s: no attestation subject matches the artifact digest", source)}, false
+}
+
+// subjectMatches reports whether a subject of a statement has one of the digests
+func subjectMatches(st statement, digests map[string]string) bool {
+	for _, subject := range st.Subject {
+		for algorithm, digest := range subject.Digest {
+			if local, ok := digests[strings.ToLower(algorithm)]; ok && strings.EqualFold(local, digest) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifySignature verifies that a signature of an envelope, whose decoded payload is
+// given, was made by the signing certificate of its bundle, which must chain to one of
+// the trusted roots at the time it was issued, or by the verifier's key. Without roots
+// a certificate is not trusted, as anyone can issue one to themselves.
+func (v *Verifier) verifySignature(env envelope, payload []byte, source string) (checkResult, bool) {
+	invalid := func(format string, args ...any) (checkResult, bool) {
+		return checkResult{models.FindingInvalidProvenanceSignature,
+			source + ": " + fmt.Sprintf(format, args...)}, false
+	}
+	if len(env.Signatures) == 0 {
+		return invalid("the attestation matching the artifact is not signed")
+	}
+
+	var keys []crypto.PublicKey
+	if len(env.certificates) > 0 && v.roots != nil {
+		cert, err := x509.ParseCertificate(env.certificates[0])
+		if err != nil {
+			return invalid("invalid signing certificate: %v", err)
+		}
+		// Sigstore signing certificates are short-lived, so the chain is checked when
+		// the certificate was issued
+		opts := x509.VerifyOptions{
+			Roots:         v.roots,
+			Intermediates: x509.NewCertPool(),
+			CurrentTime:   cert.NotBefore,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		}
+		for _, der := range env.certificates[1:] {
+			if intermediate, err := x509.ParseCertificate(der); err == nil {
+				opts.Intermediates.AddCert(intermediate)
+			}
+		}
+		if _, err := cert.Verify(opts); err != nil {
+			return invalid("signing certificate of %s is not trusted: %v", certificateIdentity(cert), err)
+		}
+		keys = append(keys, cert.PublicKey)
+	}
+	if v.key != nil {
+		keys = append(keys, v.key)
+	}
+	if len(keys) == 0 {
+		hint := "the attestation is signed with a key; give its public key with --cosign-key to verify it"
+		if len(env.certificates) > 0 {
+			hint = "the attestation's signing certificate is not trusted without the roots it must chain to; give them with --signature-roots to verify it"
+		}
+		return checkResult{models.FindingUnverifiableProvenance, source + ": " + hint}, false
+	}
+
+	// Signatures cover the DSSE pre-authentication encoding of the payload
+	pae := fmt.Appendf(nil, "DSSEv1 %d %s %d ", len(env.PayloadType), env.PayloadType, len(payload))
+	pae = append(pae, payload...)
+	for _, s := range env.Signatures {
+		sig, err := base64.StdEncoding.DecodeString(s.Sig)
+		if err != nil {
+			continue
+		}
+		for _, key := range keys {
+			if valid, _ := signature.VerifyData(key, pae, sig); valid {
+				return checkResult{}, true
+			}
+		}
+	}
+	return invalid("the signature of the attestation matching the artifact does not verify")
+}
+
+// certificateIdentity names the subject of a signing certificate: the identity of a
+// sigstore certificate, such as a workflow URI or email address, or its common name
+func certificateIdentity(cert *x509.Certificate) string {
+	switch {
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0]
+	}
+	return fmt.Sprintf("%q", cert.Subject.CommonName)
+}
+
+// parseEnvelopes reads DSSE envelopes from a sigstore bundle, a single envelope,
+// or a JSON Lines in-toto attestation file
+func parseEnvelopes(data []byte) ([]envelope, error) {
+	var bundle sigstoreBundle
+	if err := json.Unmarshal(data, &bundle); err == nil {
+		if env := bundle.envelope(); env != nil {
+			return []envelope{*env}, nil
+		}
+	}
+
+	var envelopes []envelope
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var env envelope
+		if err := json.Unmarshal(line, &env); err != nil {
+			return nil, fmt.Errorf("invalid attestation envelope: %w", err)
+		}
+		if env.Payload != "" {
+			envelopes = append(envelopes, env)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(envelopes) == 0 {
+		return nil, fmt.Errorf("no DSSE envelope found")
+	}
+
+	return envelopes, nil
+}
+
+// npmAttestations fetches the attestation bundles published for an npm package version.
+// A package without attestations returns no envelopes and no error.
+func (v *Verifier) npmAttestations(name, version string) ([]envelope, error) {
+	endpoint := fmt.Sprintf("%s/-/npm/v1/attestations/%s@%s", v.npmRegistryURL, url.PathEscape(name), url.PathEscape(version))
+
+	resp, err := v.httpClient.Get(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching npm attestations: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading npm attestations: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("npm attestations request failed with status code %d", resp.StatusCode)
+	}
+
+	var doc struct {
+		Attestations []struct {
+			PredicateType string         `json:"predicateType"`
+			Bundle        sigstoreBundle `json:"bundle"`
+		} `json:"attestations"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing npm attestations: %w", err)
+	}
+
+	var envelopes []envelope
+	for _, attestation := range doc.Attestations {
+		if env := attestation.Bundle.envelope(); env != nil {
+			envelopes = append(envelopes, *env)
+		}
+	}
+	return envelopes, nil
+}
+
+// fileDigests computes the hex-encoded SHA-256 and SHA-512 digests of a file
+func fileDigests(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening artifact: %w", err)
+	}
+	defer file.Close()
+
+	sha256Hash := sha256.New()
+	sha512Hash := sha512.New()
+	if _, err := io.Copy(io.MultiWriter(sha256Hash, sha512Hash), file); err != nil {
+		return nil, fmt.Errorf("error reading artifact: %w", err)
+	}
+
+	return map[string]string{
+		"sha256": hex.EncodeToString(sha256Hash.Sum(nil)),
+		"sha512": hex.EncodeToString(sha512Hash.Sum(nil)),
+	}, nil
+}
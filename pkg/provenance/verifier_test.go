@@ -0,0 +1,234 @@
+package provenance
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+)
+
+// testSigner is a key with a code signing certificate issued by a CA of its own
+type testSigner struct {
+	key  *ecdsa.PrivateKey
+	cert []byte
+	ca   *x509.Certificate
+}
+
+func newTestSigner(t *testing.T) testSigner {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber:   big.NewInt(2),
+		Subject:        pkix.Name{CommonName: "release workflow"},
+		NotBefore:      time.Now().Add(-time.Minute),
+		NotAfter:       time.Now().Add(10 * time.Minute),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		EmailAddresses: []string{"release@example.com"},
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, leafTemplate, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testSigner{key: key, cert: cert, ca: ca}
+}
+
+// signedEnvelope returns a DSSE envelope of an in-toto statement about a subject with
+// the digest, signed by key unless it is nil
+func signedEnvelope(t *testing.T, digest string, key *ecdsa.PrivateKey) map[string]any {
+	t.Helper()
+	payload, err := json.Marshal(map[string]any{
+		"_type":         "https://in-toto.io/Statement/v1",
+		"predicateType": "https://slsa.dev/provenance/v1",
+		"subject":       []map[string]any{{"name": "artifact.tgz", "digest": map[string]string{"sha256": digest}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payloadType := "application/vnd.in-toto+json"
+	env := map[string]any{
+		"payloadType": payloadType,
+		"payload":     base64.StdEncoding.EncodeToString(payload),
+		"signatures":  []map[string]string{},
+	}
+	if key != nil {
+		pae := fmt.Appendf(nil, "DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload)
+		hash := sha256.Sum256(pae)
+		sig, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		env["signatures"] = []map[string]string{{"sig": base64.StdEncoding.EncodeToString(sig)}}
+	}
+	return env
+}
+
+func TestVerifySignatures(t *testing.T) {
+	signer := newTestSigner(t)
+	other := newTestSigner(t)
+
+	trusted := x509.NewCertPool()
+	trusted.AddCert(signer.ca)
+	untrusted := x509.NewCertPool()
+	untrusted.AddCert(other.ca)
+
+	artifact := []byte("package contents")
+	sum := sha256.Sum256(artifact)
+	digest := hex.EncodeToString(sum[:])
+
+	bundle := func(env map[string]any, cert []byte) any {
+		return map[string]any{
+			"mediaType":    "application/vnd.dev.sigstore.bundle.v0.3+json",
+			"dsseEnvelope": env,
+			"verificationMaterial": map[string]any{
+				"certificate": map[string]string{"rawBytes": base64.StdEncoding.EncodeToString(cert)},
+			},
+		}
+	}
+
+	tests := []struct {
+		name string
+		// suffix and sidecar are the provenance file written next to the artifact
+		suffix  string
+		sidecar any
+		roots   *x509.CertPool
+		key     crypto.PublicKey
+		want    string
+	}{
+		{
+			name:    "bundle signed by its certificate without roots to trust it",
+			suffix:  ".sigstore.json",
+			sidecar: bundle(signedEnvelope(t, digest, signer.key), signer.cert),
+			want:    models.FindingUnverifiableProvenance,
+		},
+		{
+			name:    "bundle whose certificate chains to the roots",
+			suffix:  ".sigstore.json",
+			sidecar: bundle(signedEnvelope(t, digest, signer.key), signer.cert),
+			roots:   trusted,
+		},
+		{
+			name:    "bundle whose certificate does not chain to the roots",
+			suffix:  ".sigstore.json",
+			sidecar: bundle(signedEnvelope(t, digest, signer.key), signer.cert),
+			roots:   untrusted,
+			want:    models.FindingInvalidProvenanceSignature,
+		},
+		{
+			name:    "bundle signed by another key than its certificate's",
+			suffix:  ".sigstore.json",
+			sidecar: bundle(signedEnvelope(t, digest, other.key), signer.cert),
+			roots:   trusted,
+			want:    models.FindingInvalidProvenanceSignature,
+		},
+		{
+			name:    "unsigned bundle",
+			suffix:  ".sigstore.json",
+			sidecar: bundle(signedEnvelope(t, digest, nil), signer.cert),
+			roots:   trusted,
+			want:    models.FindingInvalidProvenanceSignature,
+		},
+		{
+			name:    "bundle for another artifact",
+			suffix:  ".sigstore.json",
+			sidecar: bundle(signedEnvelope(t, hex.EncodeToString(make([]byte, 32)), signer.key), signer.cert),
+			roots:   trusted,
+			want:    models.FindingProvenanceMismatch,
+		},
+		{
+			name:    "bundle with an untrusted certificate signed with the key",
+			suffix:  ".sigstore.json",
+			sidecar: bundle(signedEnvelope(t, digest, signer.key), other.cert),
+			key:     &signer.key.PublicKey,
+		},
+		{
+			name:    "attestation signed with the key",
+			suffix:  ".intoto.jsonl",
+			sidecar: signedEnvelope(t, digest, signer.key),
+			key:     &signer.key.PublicKey,
+		},
+		{
+			name:    "attestation signed with another key",
+			suffix:  ".intoto.jsonl",
+			sidecar: signedEnvelope(t, digest, other.key),
+			key:     &signer.key.PublicKey,
+			want:    models.FindingInvalidProvenanceSignature,
+		},
+		{
+			name:    "attestation signed with a key that is not given",
+			suffix:  ".intoto.jsonl",
+			sidecar: signedEnvelope(t, digest, signer.key),
+			want:    models.FindingUnverifiableProvenance,
+		},
+		{
+			name:    "unsigned attestation",
+			suffix:  ".intoto.jsonl",
+			sidecar: signedEnvelope(t, digest, nil),
+			key:     &signer.key.PublicKey,
+			want:    models.FindingInvalidProvenanceSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "artifact.tgz")
+			if err := os.WriteFile(path, artifact, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			sidecar, err := json.Marshal(tt.sidecar)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path+tt.suffix, sidecar, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			// An ecosystem without a registry of attestations keeps the check offline
+			findings := NewVerifier("", false, tt.roots, tt.key).Verify("artifact", "1.0.0", "PyPI", path)
+			switch {
+			case tt.want == "" && len(findings) > 0:
+				t.Errorf("findings = %+v, want none", findings)
+			case tt.want != "" && (len(findings) != 1 || findings[0].Kind != tt.want):
+				t.Errorf("findings = %+v, want one %s", findings, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package purl
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// PackageURL represents a parsed package URL (https://github.com/package-url/purl-spec)
+type PackageURL struct {
+	Type       string
+	Namespace  string
+	Name       string
+	Version    string
+	Qualifiers map[string]string
+	Subpath    string
+}
+
+// typeEcosystems maps purl types to OSV ecosystem names
+var typeEcosystems = map[string]string{
+	"nuget":    "NuGet",
+	"npm":      "npm",
+	"pypi":     "PyPI",
+	"maven":    "Maven",
+	"golang":   "Go",
+	"cargo":    "crates.io",
+	"gem":      "RubyGems",
+	"composer": "Packagist",
+	"deb":      "Debian",
+	"rpm":      "Red Hat",
+	"hex":      "Hex",
+	"pub":      "Pub",
+	"swift":    "SwiftURL",
+	"apk":      "Alpine",
+}
+
+// Parse parses a package URL string
+func Parse(s string) (PackageURL, error) {
+	rest, ok := strings.CutPrefix(s, "pkg:")
+	if !ok {
+		return PackageURL{}, fmt.Errorf("invalid purl %q: missing pkg: scheme", s)
+	}
+	rest = strings.TrimLeft(rest, "/")
+
+	var p PackageURL
+
+	// Subpath and qualifiers are split off from the right
+	if i := strings.Index(rest, "#"); i >= 0 {
+		p.Subpath = strings.Trim(rest[i+1:], "/")
+		rest = rest[:i]
+	}
+	if i := strings.Index(rest, "?"); i >= 0 {
+		query, err := url.ParseQuery(rest[i+1:])
+		if err != nil {
+			return PackageURL{}, fmt.Errorf("invalid purl %q qualifiers: %w", s, err)
+		}
+		p.Qualifiers = make(map[string]string)
+		for key, values := range query {
+			p.Qualifiers[strings.ToLower(key)] = values[0]
+		}
+		rest = rest[:i]
+	}
+	if i := strings.LastIndex(rest, "@"); i >= 0 && i > strings.LastIndex(rest, "/") {
+		version, err := url.PathUnescape(rest[i+1:])
+		if err != nil {
+			return PackageURL{}, fmt.Errorf("invalid purl %q version: %w", s, err)
+		}
+		p.Version = version
+		rest = rest[:i]
+	}
+
+	typ, path, ok := strings.Cut(rest, "/")
+	if !ok || typ == "" || path == "" {
+		return PackageURL{}, fmt.Errorf("invalid purl %q: missing type or name", s)
+	}
+	p.Type = strings.ToLower(typ)
+
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return PackageURL{}, fmt.Errorf("invalid purl %q: %w", s, err)
+		}
+		segments[i] = unescaped
+	}
+	p.Name = segments[len(segments)-1]
+	p.Namespace = strings.Join(segments[:len(segments)-1], "/")
+
+	return p, nil
+}
+
+// Ecosystem returns the OSV ecosystem for the purl type, or an empty string if unknown
+func (p PackageURL) Ecosystem() string {
+	return typeEcosystems[p.Type]
+}
+
+// PackageName returns the package name in the form OSV expects for the ecosystem
+func (p PackageURL) PackageName() string {
+	if p.Namespace == "" {
+		return p.Name
+	}
+
+	switch p.Type {
+	case "maven":
+		return p.Namespace + ":" + p.Name
+	case "npm", "golang", "composer", "swift":
+		return p.Namespace + "/" + p.Name
+	default:
+		// Namespaces such as the deb/rpm vendor are not part of the OSV package name
+		return p.Name
+	}
+}
+
+// String renders the package URL in canonical form
+func (p PackageURL) String() string {
+	var b strings.Builder
+	b.WriteString("pkg:")
+	b.WriteString(p.Type)
+	b.WriteString("/")
+	if p.Namespace != "" {
+		for _, segment := range strings.Split(p.Namespace, "/") {
+			b.WriteString(escapeSegment(segment))
+			b.WriteString("/")
+		}
+	}
+	b.WriteString(escapeSegment(p.Name))
+	if p.Version != "" {
+		b.WriteString("@")
+		b.WriteString(url.PathEscape(p.Version))
+	}
+	if len(p.Qualifiers) > 0 {
+		values := url.Values{}
+		for key, value := range p.Qualifiers {
+			values.Set(key, value)
+		}
+		b.WriteString("?")
+		b.WriteString(values.Encode())
+	}
+	if p.Subpath != "" {
+		b.WriteString("#")
+		b.WriteString(p.Subpath)
+	}
+	return b.String()
+}
+
+// escapeSegment percent-encodes a path segment, including the '@' that purl reserves for the version
+func escapeSegment(segment string) string {
+	return strings.ReplaceAll(url.PathEscape(segment), "@", "%40")
+}
+
+// FromPackage builds a package URL from an OSV package name, version and ecosystem
+func FromPackage(name, version, ecosystem string) (PackageURL, error) {
+	typ := ""
+	for purlType, eco := range typeEcosystems {
+		if strings.EqualFold(eco, ecosystem) {
+			typ = purlType
+			break
+		}
+	}
+	if typ == "" {
+		return PackageURL{}, fmt.Errorf("no purl type known for ecosystem %s", ecosystem)
+	}
+
+	p := PackageURL{Type: typ, Name: name, Version: version}
+	switch typ {
+	case "maven":
+		if group, artifact, ok := strings.Cut(name, ":"); ok {
+			p.Namespace, p.Name = group, artifact
+		}
+	case "npm", "golang", "composer", "swift":
+		if i := strings.LastIndex(name, "/"); i >= 0 {
+			p.Namespace, p.Name = name[:i], name[i+1:]
+		}
+	}
+
+	return p, nil
+}
+
+// Matches reports whether two package URLs refer to the same package. The version
+// is only compared when both sides specify one; names are compared case-insensitively
+// because several ecosystems (NuGet, PyPI) treat package names that way.
+func (p PackageURL) Matches(other PackageURL) bool {
+	if p.Type != other.Type || !strings.EqualFold(p.PackageName(), other.PackageName()) {
+		return false
+	}
+	if p.Version != "" && other.Version != "" && !strings.EqualFold(p.Version, other.Version) {
+		return false
+	}
+	return true
+}
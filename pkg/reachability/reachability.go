@@ -0,0 +1,185 @@
+package reachability
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Status describes whether a dependency is referenced by the project's source code
+type Status string
+
+const (
+	// InUse marks dependencies imported or required somewhere in the source code
+	InUse Status = "in-use"
+	// DeclaredOnly marks dependencies listed in a lockfile but never imported directly.
+	// They may still be used transitively through another dependency.
+	DeclaredOnly Status = "declared-only"
+	// Unknown is reported for ecosystems whose imports cannot be matched to packages
+	Unknown Status = ""
+)
+
+// maxSourceSize skips generated or minified files, which rarely hold useful imports
+const maxSourceSize = 2 << 20
+
+// language extracts the imported modules of one ecosystem from source files
+type language struct {
+	extensions []string
+	patterns   []*regexp.Regexp
+}
+
+// languages maps OSV ecosystems to the source files and import statements searched
+var languages = map[string]language{
+	"npm": {
+		extensions: []string{".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx", ".mts", ".cts", ".vue", ".svelte"},
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`\brequire\s*\(\s*['"]([^'"]+)['"]`),
+			regexp.MustCompile(`\bimport\s*\(\s*['"]([^'"]+)['"]`),
+			regexp.MustCompile(`\bfrom\s+['"]([^'"]+)['"]`),
+			regexp.MustCompile(`\bimport\s+['"]([^'"]+)['"]`),
+		},
+	},
+	"Go": {
+		extensions: []string{".go"},
+		patterns: []*regexp.Regexp{
+			// Single imports and the lines of import blocks, optionally named
+			regexp.MustCompile(`(?m)^\s*(?:import\s+)?(?:[\w.]+\s+)?"([^"\s]+)"\s*$`),
+		},
+	},
+	"PyPI": {
+		extensions: []string{".py", ".pyi"},
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?m)^\s*import\s+([\w.]+)`),
+			regexp.MustCompile(`(?m)^\s*from\s+([\w.]+)\s+import\b`),
+		},
+	},
+	"RubyGems": {
+		extensions: []string{".rb", ".rake", ".gemspec"},
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`\brequire\s*\(?\s*['"]([^'"]+)['"]`),
+		},
+	},
+	"crates.io": {
+		extensions: []string{".rs"},
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`\buse\s+(?:::)?(\w+)`),
+			regexp.MustCompile(`\bextern\s+crate\s+(\w+)`),
+			regexp.MustCompile(`\b(\w+)::`),
+		},
+	},
+}
+
+// skippedDirs are dependency trees and build output, which are not the project's own code
+var skippedDirs = map[string]bool{
+	"node_modules":  true,
+	"vendor":        true,
+	".git":          true,
+	".venv":         true,
+	"venv":          true,
+	"site-packages": true,
+	"target":        true,
+	"dist":          true,
+}
+
+// Index records the modules imported by the source files below a project directory
+type Index struct {
+	imports map[string]map[string]bool
+}
+
+// Build searches the source files below dir for import statements
+func Build(dir string) (*Index, error) {
+	index := &Index{imports: make(map[string]map[string]bool)}
+
+	extensions := make(map[string][]string)
+	for ecosystem, lang := range languages {
+		index.imports[ecosystem] = make(map[string]bool)
+		for _, ext := range lang.extensions {
+			extensions[ext] = append(extensions[ext], ecosystem)
+		}
+	}
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && skippedDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		ecosystems := extensions[filepath.Ext(d.Name())]
+		if len(ecosystems) == 0 {
+			return nil
+		}
+		if info, err := d.Info(); err != nil || info.Size() > maxSourceSize {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading source file %s: %w", path, err)
+		}
+		for _, ecosystem := range ecosystems {
+			for _, pattern := range languages[ecosystem].patterns {
+				for _, match := range pattern.FindAllSubmatch(data, -1) {
+					index.imports[ecosystem][string(match[1])] = true
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error searching %s for imports: %w", dir, err)
+	}
+
+	return index, nil
+}
+
+// Status reports whether a package is imported by the indexed source code
+func (idx *Index) Status(name, ecosystem string) Status {
+	imports, ok := idx.imports[ecosystem]
+	if !ok {
+		return Unknown
+	}
+
+	for imported := range imports {
+		if importMatches(imported, name, ecosystem) {
+			return InUse
+		}
+	}
+	return DeclaredOnly
+}
+
+// importMatches reports whether an imported module belongs to a package
+func importMatches(imported, name, ecosystem string) bool {
+	switch ecosystem {
+	case "npm":
+		// Subpath imports such as "lodash/fp" or "@babel/core/lib" belong to the package
+		return imported == name || strings.HasPrefix(imported, name+"/")
+	case "Go":
+		return imported == name || strings.HasPrefix(imported, name+"/")
+	case "PyPI":
+		// Distribution names differ from module names in case and separators;
+		// packages whose module name is unrelated (PyYAML -> yaml) are not matched
+		top, _, _ := strings.Cut(imported, ".")
+		return strings.EqualFold(top, pythonModule(name))
+	case "RubyGems":
+		// Gems named with dashes are usually required by path ("net-http" -> "net/http")
+		return imported == name || strings.HasPrefix(imported, name+"/") ||
+			imported == strings.ReplaceAll(name, "-", "/") || strings.HasPrefix(imported, strings.ReplaceAll(name, "-", "/")+"/")
+	case "crates.io":
+		return imported == strings.ReplaceAll(name, "-", "_")
+	}
+	return false
+}
+
+// pythonModule returns the module name a distribution is most likely imported under
+func pythonModule(name string) string {
+	name = strings.TrimPrefix(strings.ToLower(name), "python-")
+	return strings.NewReplacer("-", "_", ".", "_").Replace(name)
+}
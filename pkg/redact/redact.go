@@ -0,0 +1,146 @@
+package redact
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Replacement markers for redacted values
+const (
+	pathMarker    = "<path>"
+	hostMarker    = "<host>"
+	packageMarker = "<internal-package>"
+	patternMarker = "<redacted>"
+)
+
+// DefaultProfile is the built-in profile, selected with the name "default"
+var DefaultProfile = Profile{
+	Paths: true,
+	Hostnames: []string{
+		"*.internal", "*.corp", "*.local", "*.lan", "*.intranet", "*.home.arpa",
+		"10.*.*.*", "192.168.*.*",
+		"172.16.*.*", "172.17.*.*", "172.18.*.*", "172.19.*.*", "172.2?.*.*", "172.30.*.*", "172.31.*.*",
+	},
+}
+
+// Profile lists what is removed from reports intended for external sharing
+type Profile struct {
+	// Paths replaces absolute file system paths, keeping only the file name
+	Paths bool `yaml:"paths"`
+	// Hostnames are glob patterns of internal host names and addresses
+	Hostnames []string `yaml:"hostnames"`
+	// Packages are glob patterns of internal package names, e.g. "Acme.*" or "@acme/*"
+	Packages []string `yaml:"packages"`
+	// Patterns are additional regular expressions to remove
+	Patterns []string `yaml:"patterns"`
+}
+
+// Redactor applies a profile to text
+type Redactor struct {
+	paths    bool
+	hosts    []*regexp.Regexp
+	packages []*regexp.Regexp
+	patterns []*regexp.Regexp
+}
+
+// Path patterns: absolute Unix paths (not the "//host" of a URL) and Windows drive paths
+var (
+	unixPath    = regexp.MustCompile(`(^|[\s"'=(\[,])(/[^/\s"'(),\]][^\s"'(),\]]*)`)
+	windowsPath = regexp.MustCompile(`(^|[\s"'=(\[,])([A-Za-z]:\\[^\s"'(),\]]*)`)
+)
+
+// Characters a '*' may match in host patterns, which stop at the path of a URL,
+// and in package patterns, which span the segments of npm scopes and Go module paths
+const (
+	hostChars    = `[^\s"'=,()\[\]:/]`
+	packageChars = `[^\s"'=,()\[\]:]`
+)
+
+// Load returns the redactor for a profile: "default" for the built-in profile,
+// or the path of a YAML profile file
+func Load(name string) (*Redactor, error) {
+	if name == "default" {
+		return New(DefaultProfile)
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("error reading redaction profile: %w", err)
+	}
+	var profile Profile
+	if err := yaml.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("error parsing redaction profile %s: %w", name, err)
+	}
+	return New(profile)
+}
+
+// New compiles a redaction profile
+func New(profile Profile) (*Redactor, error) {
+	r := &Redactor{paths: profile.Paths}
+	for _, glob := range profile.Hostnames {
+		r.hosts = append(r.hosts, globPattern(glob, hostChars))
+	}
+	for _, glob := range profile.Packages {
+		r.packages = append(r.packages, globPattern(glob, packageChars))
+	}
+	for _, pattern := range profile.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// globPattern compiles a glob into a regular expression matching it as a whole word.
+// The surrounding delimiters are captured so they can be kept in the replacement.
+func globPattern(glob, chars string) *regexp.Regexp {
+	var b strings.Builder
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(chars + "*")
+		case '?':
+			b.WriteString(chars)
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return regexp.MustCompile(`(?i)(^|[\s"'=(\[,/@:])(` + b.String() + `)($|[^\w.-])`)
+}
+
+// String removes everything the profile matches from s
+func (r *Redactor) String(s string) string {
+	if r.paths {
+		s = unixPath.ReplaceAllStringFunc(s, redactPath(unixPath))
+		s = windowsPath.ReplaceAllStringFunc(s, redactPath(windowsPath))
+	}
+	for _, re := range r.hosts {
+		s = re.ReplaceAllString(s, "${1}"+hostMarker+"${3}")
+	}
+	for _, re := range r.packages {
+		s = re.ReplaceAllString(s, "${1}"+packageMarker+"${3}")
+	}
+	for _, re := range r.patterns {
+		s = re.ReplaceAllString(s, patternMarker)
+	}
+	return s
+}
+
+// redactPath returns a replacement function keeping a path's delimiter and file name
+func redactPath(re *regexp.Regexp) func(string) string {
+	return func(match string) string {
+		groups := re.FindStringSubmatch(match)
+		name := path.Base(strings.ReplaceAll(groups[2], `\`, "/"))
+		if name == "/" || name == "." {
+			return groups[1] + pathMarker
+		}
+		return groups[1] + pathMarker + "/" + name
+	}
+}
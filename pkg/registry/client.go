@@ -0,0 +1,290 @@
+package registry
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Default registry endpoints used for latest-version lookups
+const (
+	defaultNuGetURL = "https://api.nuget.org/v3-flatcontainer"
+	defaultNpmURL   = "https://registry.npmjs.org"
+	defaultPyPIURL  = "https://pypi.org/pypi"
+	defaultMavenURL = "https://repo1.maven.org/maven2"
+)
+
+// Releases describes the published versions of a package
+type Releases struct {
+	// Latest is the registry's current stable release
+	Latest string
+	// Versions lists every published version, oldest first
+	Versions []string
+}
+
+// VersionsBehind returns how many releases were published after the given version,
+// or -1 if the version is not known to the registry
+func (r Releases) VersionsBehind(version string) int {
+	current, latest := -1, len(r.Versions)-1
+	for i, v := range r.Versions {
+		if strings.EqualFold(v, version) {
+			current = i
+		}
+		if v == r.Latest {
+			latest = i
+		}
+	}
+
+	if current < 0 {
+		return -1
+	}
+	if latest < current {
+		return 0
+	}
+	return latest - current
+}
+
+// Client looks up release information from native package registries
+type Client struct {
+	httpClient *http.Client
+	baseURLs   map[string]string
+}
+
+// NewClient creates a registry client. Overrides maps an ecosystem name
+// (NuGet, npm, PyPI, Maven) to an alternative registry base URL, such as an internal mirror.
+func NewClient(overrides map[string]string) *Client {
+	baseURLs := map[string]string{
+		"nuget": defaultNuGetURL,
+		"npm":   defaultNpmURL,
+		"pypi":  defaultPyPIURL,
+		"maven": defaultMavenURL,
+	}
+	for ecosystem, baseURL := range overrides {
+		baseURLs[strings.ToLower(ecosystem)] = strings.TrimSuffix(baseURL, "/")
+	}
+
+	return &Client{
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		baseURLs:   baseURLs,
+	}
+}
+
+// Supports reports whether latest-version lookups are available for an ecosystem
+func (c *Client) Supports(ecosystem string) bool {
+	_, ok := c.baseURLs[strings.ToLower(ecosystem)]
+	return ok
+}
+
+// GetReleases fetches the published versions of a package from its native registry
+func (c *Client) GetReleases(name, ecosystem string) (Releases, error) {
+	baseURL, ok := c.baseURLs[strings.ToLower(ecosystem)]
+	if !ok {
+		return Releases{}, fmt.Errorf("latest version lookup is not supported for ecosystem %s", ecosystem)
+	}
+
+	switch strings.ToLower(ecosystem) {
+	case "nuget":
+		return c.nugetReleases(baseURL, name)
+	case "npm":
+		return c.npmReleases(baseURL, name)
+	case "pypi":
+		return c.pypiReleases(baseURL, name)
+	default:
+		return c.mavenReleases(baseURL, name)
+	}
+}
+
+// nugetReleases reads the flat container version index, which is ordered oldest first
+func (c *Client) nugetReleases(baseURL, name string) (Releases, error) {
+	var index struct {
+		Versions []string `json:"versions"`
+	}
+	endpoint := fmt.Sprintf("%s/%s/index.json", baseURL, strings.ToLower(name))
+	if err := c.getJSON(endpoint, &index); err != nil {
+		return Releases{}, err
+	}
+
+	releases := Releases{Versions: index.Versions}
+	for i := len(index.Versions) - 1; i >= 0; i-- {
+		if !strings.Contains(index.Versions[i], "-") {
+			releases.Latest = index.Versions[i]
+			break
+		}
+	}
+	if releases.Latest == "" && len(index.Versions) > 0 {
+		releases.Latest = index.Versions[len(index.Versions)-1]
+	}
+
+	return releases, nil
+}
+
+// npmReleases reads the package document and orders versions by publish time
+func (c *Client) npmReleases(baseURL, name string) (Releases, error) {
+	var doc struct {
+		DistTags map[string]string `json:"dist-tags"`
+		Time     map[string]string `json:"time"`
+	}
+	endpoint := fmt.Sprintf("%s/%s", baseURL, url.PathEscape(name))
+	if err := c.getJSON(endpoint, &doc); err != nil {
+		return Releases{}, err
+	}
+
+	published := make(map[string]string)
+	for version, timestamp := range doc.Time {
+		if version != "created" && version != "modified" {
+			published[version] = timestamp
+		}
+	}
+
+	return Releases{
+		Latest:   doc.DistTags["latest"],
+		Versions: sortByPublishTime(published),
+	}, nil
+}
+
+// pypiReleases reads the JSON API and orders versions by first upload time
+func (c *Client) pypiReleases(baseURL, name string) (Releases, error) {
+	var doc struct {
+		Info struct {
+			Version string `json:"version"`
+		} `json:"info"`
+		Releases map[string][]struct {
+			UploadTime string `json:"upload_time_iso_8601"`
+		} `json:"releases"`
+	}
+	endpoint := fmt.Sprintf("%s/%s/json", baseURL, url.PathEscape(name))
+	if err := c.getJSON(endpoint, &doc); err != nil {
+		return Releases{}, err
+	}
+
+	published := make(map[string]string)
+	for version, files := range doc.Releases {
+		if len(files) == 0 {
+			continue
+		}
+		published[version] = files[0].UploadTime
+	}
+
+	return Releases{
+		Latest:   doc.Info.Version,
+		Versions: sortByPublishTime(published),
+	}, nil
+}
+
+// mavenReleases reads maven-metadata.xml for a groupId:artifactId coordinate
+func (c *Client) mavenReleases(baseURL, name string) (Releases, error) {
+	groupID, artifactID, ok := strings.Cut(name, ":")
+	if !ok {
+		return Releases{}, fmt.Errorf("maven package name must be groupId:artifactId, got %s", name)
+	}
+
+	endpoint := fmt.Sprintf("%s/%s/%s/maven-metadata.xml", baseURL, strings.ReplaceAll(groupID, ".", "/"), artifactID)
+	body, err := c.get(endpoint)
+	if err != nil {
+		return Releases{}, err
+	}
+
+	var metadata struct {
+		Versioning struct {
+			Latest   string   `xml:"latest"`
+			Release  string   `xml:"release"`
+			Versions []string `xml:"versions>version"`
+		} `xml:"versioning"`
+	}
+	if err := xml.Unmarshal(body, &metadata); err != nil {
+		return Releases{}, fmt.Errorf("error parsing maven metadata: %w", err)
+	}
+
+	latest := metadata.Versioning.Release
+	if latest == "" {
+		latest = metadata.Versioning.Latest
+	}
+
+	return Releases{
+		Latest:   latest,
+		Versions: metadata.Versioning.Versions,
+	}, nil
+}
+
+// NpmPackage is the part of an npm package document needed to resolve dependency ranges
+type NpmPackage struct {
+	DistTags map[string]string     `json:"dist-tags"`
+	Versions map[string]NpmVersion `json:"versions"`
+}
+
+// NpmVersion is the manifest of one published npm package version
+type NpmVersion struct {
+	Dependencies         map[string]string `json:"dependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+}
+
+// GetNpmPackage fetches the package document of an npm package, listing the
+// dependencies of every published version
+func (c *Client) GetNpmPackage(name string) (NpmPackage, error) {
+	var doc NpmPackage
+	endpoint := fmt.Sprintf("%s/%s", c.baseURLs["npm"], url.PathEscape(name))
+	if err := c.getJSON(endpoint, &doc); err != nil {
+		return NpmPackage{}, err
+	}
+	return doc, nil
+}
+
+// GetMavenPOM fetches the POM of a Maven artifact version
+func (c *Client) GetMavenPOM(groupID, artifactID, version string) ([]byte, error) {
+	endpoint := fmt.Sprintf("%s/%s/%s/%s/%s-%s.pom", c.baseURLs["maven"],
+		strings.ReplaceAll(groupID, ".", "/"), artifactID, version, artifactID, version)
+	return c.get(endpoint)
+}
+
+// getJSON fetches a URL and decodes the JSON response into target
+func (c *Client) getJSON(endpoint string, target interface{}) error {
+	body, err := c.get(endpoint)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, target); err != nil {
+		return fmt.Errorf("error parsing registry response: %w", err)
+	}
+	return nil
+}
+
+// get fetches a URL and returns the response body
+func (c *Client) get(endpoint string) ([]byte, error) {
+	resp, err := c.httpClient.Get(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("error querying registry: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading registry response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("registry request to %s failed with status code %d", endpoint, resp.StatusCode)
+	}
+
+	return body, nil
+}
+
+// sortByPublishTime returns the versions ordered by their RFC 3339 publish timestamps
+func sortByPublishTime(published map[string]string) []string {
+	versions := make([]string, 0, len(published))
+	for version := range published {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		if published[versions[i]] == published[versions[j]] {
+			return versions[i] < versions[j]
+		}
+		return published[versions[i]] < published[versions[j]]
+	})
+	return versions
+}
@@ -0,0 +1,140 @@
+package remote
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gcsStore lists, reads and writes a bucket prefix with the Cloud Storage JSON API. An OAuth access
+// token is read from GOOGLE_OAUTH_ACCESS_TOKEN (e.g. from gcloud auth print-access-token);
+// without one requests are anonymous, for public buckets. STORAGE_EMULATOR_HOST
+// points the store at an emulator.
+type gcsStore struct {
+	client   *http.Client
+	bucket   string
+	prefix   string
+	endpoint string
+	token    string
+}
+
+func newGCSStore(location string, client *http.Client) (*gcsStore, error) {
+	bucket, prefix, err := splitBucket(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GCS location gs://%s: %w", location, err)
+	}
+
+	endpoint := "https://storage.googleapis.com"
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		endpoint = strings.TrimRight(host, "/")
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "http://" + endpoint
+		}
+	}
+
+	return &gcsStore{
+		client:   client,
+		bucket:   bucket,
+		prefix:   prefix,
+		endpoint: endpoint,
+		token:    os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"),
+	}, nil
+}
+
+// gcsObjects is a page of the objects.list response
+type gcsObjects struct {
+	Items []struct {
+		Name    string    `json:"name"`
+		Size    string    `json:"size"`
+		Updated time.Time `json:"updated"`
+	} `json:"items"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+func (g *gcsStore) List(maxDepth int) ([]Object, error) {
+	var objects []Object
+	query := url.Values{
+		"prefix": {g.prefix},
+		"fields": {"items(name,size,updated),nextPageToken"},
+	}
+	for {
+		body, err := g.do(fmt.Sprintf("%s/storage/v1/b/%s/o?%s", g.endpoint, url.PathEscape(g.bucket), query.Encode()))
+		if err != nil {
+			return nil, fmt.Errorf("error listing gs://%s/%s: %w", g.bucket, g.prefix, err)
+		}
+		var page gcsObjects
+		err = json.NewDecoder(body).Decode(&page)
+		body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading listing of gs://%s/%s: %w", g.bucket, g.prefix, err)
+		}
+
+		for _, item := range page.Items {
+			relPath := strings.TrimPrefix(item.Name, g.prefix)
+			if relPath == "" || strings.HasSuffix(relPath, "/") || !withinDepth(relPath, maxDepth) {
+				continue
+			}
+			size, _ := strconv.ParseInt(item.Size, 10, 64)
+			objects = append(objects, Object{
+				Path:    relPath,
+				URL:     "gs://" + g.bucket + "/" + item.Name,
+				Size:    size,
+				ModTime: item.Updated,
+			})
+		}
+
+		if page.NextPageToken == "" {
+			return objects, nil
+		}
+		query.Set("pageToken", page.NextPageToken)
+	}
+}
+
+func (g *gcsStore) Open(relPath string) (io.ReadCloser, error) {
+	body, err := g.do(fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media",
+		g.endpoint, url.PathEscape(g.bucket), url.PathEscape(g.prefix+relPath)))
+	if err != nil {
+		return nil, fmt.Errorf("error downloading gs://%s/%s%s: %w", g.bucket, g.prefix, relPath, err)
+	}
+	return body, nil
+}
+
+func (g *gcsStore) Put(relPath string, data []byte, contentType string) error {
+	target := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?%s", g.endpoint, url.PathEscape(g.bucket),
+		url.Values{"uploadType": {"media"}, "name": {g.prefix + relPath}}.Encode())
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if g.token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.token)
+	}
+	if err := send(g.client, req); err != nil {
+		return fmt.Errorf("error uploading %s: %w", g.URL(relPath), err)
+	}
+	return nil
+}
+
+func (g *gcsStore) URL(relPath string) string {
+	return "gs://" + g.bucket + "/" + g.prefix + relPath
+}
+
+// do sends a GET request, authorized with the access token when one is set
+func (g *gcsStore) do(target string) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if g.token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.token)
+	}
+	return get(g.client, req)
+}
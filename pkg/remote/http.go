@@ -0,0 +1,117 @@
+package remote
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// maxListingSize bounds how much of a directory listing page is read
+const maxListingSize = 16 << 20
+
+// href matches the link targets of a directory listing page
+var href = regexp.MustCompile(`(?i)href\s*=\s*["']([^"'#?]+)["']`)
+
+// httpStore reads an HTTP directory listing, such as an Apache or nginx autoindex
+// page or an artifact repository's browse view. Links to subdirectories (ending in a
+// slash) below the listing are followed; other links below it are objects.
+// Credentials in the URL are sent as basic authentication.
+type httpStore struct {
+	client *http.Client
+	base   *url.URL
+}
+
+func newHTTPStore(location string, client *http.Client) (*httpStore, error) {
+	base, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %s: %w", location, err)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+		base.RawPath = ""
+	}
+	return &httpStore{client: client, base: base}, nil
+}
+
+func (h *httpStore) List(maxDepth int) ([]Object, error) {
+	var objects []Object
+	seen := map[string]bool{h.base.Path: true}
+	pending := []*url.URL{h.base}
+
+	for len(pending) > 0 {
+		dir := pending[0]
+		pending = pending[1:]
+
+		links, err := h.links(dir)
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s: %w", dir.Redacted(), err)
+		}
+		for _, link := range links {
+			if seen[link.Path] {
+				continue
+			}
+			seen[link.Path] = true
+
+			relPath := strings.TrimPrefix(link.Path, h.base.Path)
+			if strings.HasSuffix(relPath, "/") {
+				if withinDepth(relPath, maxDepth) {
+					pending = append(pending, link)
+				}
+				continue
+			}
+			if !withinDepth(relPath, maxDepth) {
+				continue
+			}
+			objects = append(objects, Object{Path: relPath, URL: link.Redacted()})
+		}
+	}
+	return objects, nil
+}
+
+// links returns the links of a listing page that lead below the listed location
+func (h *httpStore) links(dir *url.URL) ([]*url.URL, error) {
+	body, err := h.get(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	page, err := io.ReadAll(io.LimitReader(body, maxListingSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var links []*url.URL
+	for _, match := range href.FindAllStringSubmatch(string(page), -1) {
+		ref, err := url.Parse(strings.TrimSpace(match[1]))
+		if err != nil {
+			continue
+		}
+		link := dir.ResolveReference(ref)
+		if link.Scheme != h.base.Scheme || link.Host != h.base.Host ||
+			!strings.HasPrefix(link.Path, h.base.Path) || link.Path == h.base.Path {
+			continue
+		}
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+func (h *httpStore) Open(relPath string) (io.ReadCloser, error) {
+	target := h.base.ResolveReference(&url.URL{Path: relPath})
+	body, err := h.get(target)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s: %w", target.Redacted(), err)
+	}
+	return body, nil
+}
+
+func (h *httpStore) get(target *url.URL) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return get(h.client, req)
+}
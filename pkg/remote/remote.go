@@ -0,0 +1,138 @@
+// Package remote lists and downloads artifacts kept outside the local file system:
+// S3 and GCS buckets and HTTP directory listings. It also writes objects to S3, GCS
+// and Azure Blob Storage containers.
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when opening an object that does not exist
+var ErrNotFound = errors.New("object not found")
+
+// Object is an artifact found under a remote location
+type Object struct {
+	// Path is the slash-separated path of the object relative to the location
+	Path string
+	// URL identifies the object in reports, without any credentials
+	URL  string
+	Size int64
+	// ModTime is when the object was last modified; zero when the store does not say
+	ModTime time.Time
+}
+
+// Store is a remote location holding artifacts
+type Store interface {
+	// List returns the objects below the location. A maxDepth above 0 limits how many
+	// path segments deep objects are listed, so 1 lists only the location's own objects.
+	List(maxDepth int) ([]Object, error)
+	// Open reads the object at a path relative to the location
+	Open(path string) (io.ReadCloser, error)
+}
+
+// Writer is a remote location objects can be written to
+type Writer interface {
+	// Put writes an object at a path relative to the location, replacing any object there
+	Put(path string, data []byte, contentType string) error
+	// URL returns the URL of the object at a path relative to the location
+	URL(path string) string
+}
+
+// IsRemote reports whether a location is a remote store rather than a local path
+func IsRemote(location string) bool {
+	for _, scheme := range []string{"s3://", "gs://", "http://", "https://"} {
+		if strings.HasPrefix(strings.ToLower(location), scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// New returns the store for a location: s3://bucket/prefix, gs://bucket/prefix,
+// or the http(s) URL of a directory listing
+func New(location string) (Store, error) {
+	client := &http.Client{Timeout: 30 * time.Minute}
+	lower := strings.ToLower(location)
+	switch {
+	case strings.HasPrefix(lower, "s3://"):
+		return newS3Store(location[len("s3://"):], client)
+	case strings.HasPrefix(lower, "gs://"):
+		return newGCSStore(location[len("gs://"):], client)
+	case strings.HasPrefix(lower, "http://"), strings.HasPrefix(lower, "https://"):
+		return newHTTPStore(location, client)
+	default:
+		return nil, fmt.Errorf("unsupported remote location %s (supported: s3://, gs://, http://, https://)", location)
+	}
+}
+
+// NewWriter returns the writer for a location: s3://bucket/prefix, gs://bucket/prefix
+// or az://account/container/prefix
+func NewWriter(location string) (Writer, error) {
+	client := &http.Client{Timeout: 30 * time.Minute}
+	lower := strings.ToLower(location)
+	switch {
+	case strings.HasPrefix(lower, "s3://"):
+		return newS3Store(location[len("s3://"):], client)
+	case strings.HasPrefix(lower, "gs://"):
+		return newGCSStore(location[len("gs://"):], client)
+	case strings.HasPrefix(lower, "az://"):
+		return newAzureWriter(location[len("az://"):], client)
+	default:
+		return nil, fmt.Errorf("unsupported object storage location %s (supported: s3://, gs://, az://)", location)
+	}
+}
+
+// splitBucket splits "bucket/prefix" into the bucket and a prefix that is empty or ends in a slash
+func splitBucket(location string) (string, string, error) {
+	bucket, prefix, _ := strings.Cut(location, "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("no bucket name given")
+	}
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return bucket, prefix, nil
+}
+
+// withinDepth reports whether a relative path lies within maxDepth path segments
+func withinDepth(relPath string, maxDepth int) bool {
+	return maxDepth <= 0 || strings.Count(relPath, "/") < maxDepth
+}
+
+// get performs a GET request and returns the body of a successful response
+func get(client *http.Client, req *http.Request) (io.ReadCloser, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp.Body, nil
+}
+
+// send performs a request that writes an object and checks that it succeeded
+func send(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package remote
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// emptyPayloadHash is the SHA-256 of an empty request body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3Store lists, reads and writes a bucket prefix with the S3 REST API. Credentials, region and an
+// S3-compatible endpoint (such as MinIO) are read from the standard AWS_* variables;
+// without credentials requests are anonymous, for public buckets.
+type s3Store struct {
+	client   *http.Client
+	bucket   string
+	prefix   string
+	region   string
+	endpoint string
+	// pathStyle addresses the bucket in the path, as S3-compatible endpoints expect
+	pathStyle bool
+
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+func newS3Store(location string, client *http.Client) (*s3Store, error) {
+	bucket, prefix, err := splitBucket(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 location s3://%s: %w", location, err)
+	}
+
+	s := &s3Store{
+		client:       client,
+		bucket:       bucket,
+		prefix:       prefix,
+		region:       firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if s.region == "" {
+		s.region = "us-east-1"
+	}
+	if endpoint := firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"); endpoint != "" {
+		s.endpoint = strings.TrimRight(endpoint, "/")
+		s.pathStyle = true
+	} else {
+		s.endpoint = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, s.region)
+	}
+	return s, nil
+}
+
+// listBucketResult is the ListObjectsV2 response
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		Size         int64     `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *s3Store) List(maxDepth int) ([]Object, error) {
+	var objects []Object
+	token := ""
+	for {
+		query := map[string]string{"list-type": "2", "prefix": s.prefix}
+		if token != "" {
+			query["continuation-token"] = token
+		}
+		body, err := s.do("", query)
+		if err != nil {
+			return nil, fmt.Errorf("error listing s3://%s/%s: %w", s.bucket, s.prefix, err)
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(body).Decode(&result)
+		body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading listing of s3://%s/%s: %w", s.bucket, s.prefix, err)
+		}
+
+		for _, c := range result.Contents {
+			relPath := strings.TrimPrefix(c.Key, s.prefix)
+			if relPath == "" || strings.HasSuffix(relPath, "/") || !withinDepth(relPath, maxDepth) {
+				continue
+			}
+			objects = append(objects, Object{
+				Path:    relPath,
+				URL:     "s3://" + s.bucket + "/" + c.Key,
+				Size:    c.Size,
+				ModTime: c.LastModified,
+			})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (s *s3Store) Open(relPath string) (io.ReadCloser, error) {
+	body, err := s.do(s.prefix+relPath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading s3://%s/%s%s: %w", s.bucket, s.prefix, relPath, err)
+	}
+	return body, nil
+}
+
+func (s *s3Store) Put(relPath string, data []byte, contentType string) error {
+	req, err := s.request(http.MethodPut, s.prefix+relPath, nil, data)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if err := send(s.client, req); err != nil {
+		return fmt.Errorf("error uploading %s: %w", s.URL(relPath), err)
+	}
+	return nil
+}
+
+func (s *s3Store) URL(relPath string) string {
+	return "s3://" + s.bucket + "/" + s.prefix + relPath
+}
+
+// do sends a signed GET request for an object key, or for the bucket when the key is empty
+func (s *s3Store) do(key string, query map[string]string) (io.ReadCloser, error) {
+	req, err := s.request(http.MethodGet, key, query, nil)
+	if err != nil {
+		return nil, err
+	}
+	return get(s.client, req)
+}
+
+// request builds a request for an object key, or for the bucket when the key is empty,
+// signed when credentials are set
+func (s *s3Store) request(method, key string, query map[string]string, body []byte) (*http.Request, error) {
+	path := "/"
+	if s.pathStyle {
+		path += uriEncode(s.bucket, false) + "/"
+	}
+	path += uriEncode(key, true)
+
+	rawQuery := canonicalQuery(query)
+	target := s.endpoint + path
+	if rawQuery != "" {
+		target += "?" + rawQuery
+	}
+	req, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if s.accessKey != "" {
+		payloadHash := emptyPayloadHash
+		if len(body) > 0 {
+			sum := sha256.Sum256(body)
+			payloadHash = hex.EncodeToString(sum[:])
+		}
+		s.sign(req, path, rawQuery, payloadHash, time.Now().UTC())
+	}
+	return req, nil
+}
+
+// sign adds an AWS Signature Version 4 authorization header to a request
+func (s *s3Store) sign(req *http.Request, path, rawQuery, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	if s.sessionToken != "" {
+		headers["x-amz-security-token"] = s.sessionToken
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method, path, rawQuery, canonicalHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hashHex(canonicalRequest)
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	for name, value := range headers {
+		if name != "host" {
+			req.Header.Set(name, value)
+		}
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes query parameters sorted by name, as signing requires
+func canonicalQuery(query map[string]string) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, uriEncode(name, false)+"="+uriEncode(query[name], false))
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes everything but unreserved characters, and slashes when keepSlash is set
+func uriEncode(value string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hashHex(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// firstEnv returns the first of the environment variables that is set
+func firstEnv(keys ...string) string {
+	for _, key := range keys {
+		if value := os.Getenv(key); value != "" {
+			return value
+		}
+	}
+	return ""
+}
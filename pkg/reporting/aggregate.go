@@ -0,0 +1,298 @@
+package reporting
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/archive"
+	"github.com/squarehole/package-scanner/pkg/db"
+)
+
+//go:embed aggregate_report.tmpl
+var aggregateReportTemplate string
+
+// teamLabel is the run label findings are grouped by in a rollup
+const teamLabel = "team"
+
+// noTeam stands for runs without a team label in a rollup
+const noTeam = "(none)"
+
+// Rollup is an organization-level summary of the scan runs of a period, for security
+// reviews. A finding is one advisory for one package version, counted once however
+// many runs reported it.
+type Rollup struct {
+	GeneratedAt time.Time         `json:"generated_at"`
+	Since       time.Time         `json:"since"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Runs        int               `json:"runs"`
+	// Packages counts the distinct package versions scanned; runs read from the database
+	// only count clean package versions recorded with --record-clean
+	Packages           int              `json:"packages"`
+	VulnerablePackages int              `json:"vulnerable_packages"`
+	Findings           int              `json:"findings"`
+	SeverityCounts     map[string]int   `json:"severity_counts"`
+	TopPackages        []PackageRollup  `json:"top_packages"`
+	TopAdvisories      []AdvisoryRollup `json:"top_advisories"`
+	Teams              []TeamRollup     `json:"teams"`
+}
+
+// PackageRollup is a vulnerable package across all its versions
+type PackageRollup struct {
+	Name      string   `json:"name"`
+	Ecosystem string   `json:"ecosystem"`
+	Versions  []string `json:"versions"`
+	// Advisories counts the distinct advisories found for any of its versions
+	Advisories int      `json:"advisories"`
+	Critical   int      `json:"critical"`
+	High       int      `json:"high"`
+	Teams      []string `json:"teams"`
+}
+
+// AdvisoryRollup is an advisory and how widespread its findings are
+type AdvisoryRollup struct {
+	ID       string `json:"id"`
+	Summary  string `json:"summary,omitempty"`
+	Severity string `json:"severity"`
+	// Packages counts the distinct package versions it was found for
+	Packages int      `json:"packages"`
+	Teams    []string `json:"teams"`
+}
+
+// TeamRollup is the findings of the runs labelled with one team
+type TeamRollup struct {
+	Team               string `json:"team"`
+	Runs               int    `json:"runs"`
+	VulnerablePackages int    `json:"vulnerable_packages"`
+	Findings           int    `json:"findings"`
+	Critical           int    `json:"critical"`
+	High               int    `json:"high"`
+}
+
+// ArchivedRuns returns archived runs as the runs of a rollup, with the findings of their
+// reports classified like those saved to the database
+func ArchivedRuns(reports []archive.Report) []db.RollupRun {
+	runs := make([]db.RollupRun, len(reports))
+	for i, report := range reports {
+		runs[i] = db.RollupRun{
+			Run:    db.RunRecord{StartedAt: report.Started, FinishedAt: report.Finished, PackageCount: len(report.Packages)},
+			Labels: report.Labels,
+		}
+		for _, result := range report.Packages {
+			if len(result.Vulnerabilities) == 0 {
+				runs[i].Clean = append(runs[i].Clean, db.CleanScan{
+					PackageName: result.Name, Ecosystem: result.Ecosystem, Version: result.Version, Checksum: result.Checksum,
+				})
+				continue
+			}
+			for _, vuln := range result.Vulnerabilities {
+				runs[i].Findings = append(runs[i].Findings, db.VulnerabilityRecord{
+					PackageName:   result.Name,
+					Ecosystem:     result.Ecosystem,
+					Version:       result.Version,
+					VulnID:        vuln.ID,
+					Summary:       vuln.Summary,
+					SeverityLabel: SeverityLevel(vuln),
+				})
+			}
+		}
+	}
+	return runs
+}
+
+// Aggregate summarizes the runs of a period, keeping the top packages and advisories
+func Aggregate(runs []db.RollupRun, since time.Time, labels map[string]string, top int) Rollup {
+	rollup := Rollup{
+		GeneratedAt:    time.Now().UTC(),
+		Since:          since.UTC(),
+		Labels:         labels,
+		Runs:           len(runs),
+		SeverityCounts: make(map[string]int),
+	}
+
+	// Findings are keyed by package version and advisory, with their severity
+	scanned := make(map[string]bool)
+	findings := make(map[string]string)
+	packages := make(map[string]*PackageRollup)
+	packageAdvisories := make(map[string]map[string]string)
+	advisories := make(map[string]*AdvisoryRollup)
+	advisoryTeams := make(map[string]map[string]bool)
+	teams := make(map[string]*TeamRollup)
+	teamFindings := make(map[string]map[string]string)
+	teamVulnerable := make(map[string]map[string]bool)
+
+	for _, run := range runs {
+		team := run.Labels[teamLabel]
+		if team == "" {
+			team = noTeam
+		}
+		if teams[team] == nil {
+			teams[team] = &TeamRollup{Team: team}
+			teamFindings[team] = make(map[string]string)
+			teamVulnerable[team] = make(map[string]bool)
+		}
+		teams[team].Runs++
+
+		for _, clean := range run.Clean {
+			scanned[clean.Ecosystem+"|"+clean.PackageName+"|"+clean.Version] = true
+		}
+		for _, finding := range run.Findings {
+			versionKey := finding.Ecosystem + "|" + finding.PackageName + "|" + finding.Version
+			scanned[versionKey] = true
+			teamVulnerable[team][versionKey] = true
+
+			packageKey := finding.Ecosystem + "|" + finding.PackageName
+			pkg := packages[packageKey]
+			if pkg == nil {
+				pkg = &PackageRollup{Name: finding.PackageName, Ecosystem: finding.Ecosystem}
+				packages[packageKey] = pkg
+				packageAdvisories[packageKey] = make(map[string]string)
+			}
+			pkg.Versions = appendSorted(pkg.Versions, finding.Version)
+			pkg.Teams = appendSorted(pkg.Teams, team)
+
+			// Findings saved before severities were stored have no label
+			severity := finding.SeverityLabel
+			if severity == "" {
+				severity = "Unknown"
+			}
+			findingKey := versionKey + "|" + finding.VulnID
+			if _, ok := findings[findingKey]; !ok {
+				findings[findingKey] = severity
+				rollup.SeverityCounts[severity]++
+			}
+			teamFindings[team][findingKey] = severity
+			packageAdvisories[packageKey][finding.VulnID] = severity
+
+			advisory := advisories[finding.VulnID]
+			if advisory == nil {
+				advisory = &AdvisoryRollup{ID: finding.VulnID, Summary: finding.Summary, Severity: severity}
+				advisories[finding.VulnID] = advisory
+				advisoryTeams[finding.VulnID] = make(map[string]bool)
+			}
+			advisoryTeams[finding.VulnID][team] = true
+		}
+	}
+
+	rollup.Packages = len(scanned)
+	rollup.Findings = len(findings)
+	vulnerable := make(map[string]bool)
+	for key := range findings {
+		vulnerable[key[:strings.LastIndex(key, "|")]] = true
+	}
+	rollup.VulnerablePackages = len(vulnerable)
+
+	for key, pkg := range packages {
+		for _, severity := range packageAdvisories[key] {
+			pkg.Advisories++
+			switch severity {
+			case "Critical":
+				pkg.Critical++
+			case "High":
+				pkg.High++
+			}
+		}
+		rollup.TopPackages = append(rollup.TopPackages, *pkg)
+	}
+	sort.Slice(rollup.TopPackages, func(i, j int) bool {
+		a, b := rollup.TopPackages[i], rollup.TopPackages[j]
+		if a.Critical != b.Critical {
+			return a.Critical > b.Critical
+		}
+		if a.High != b.High {
+			return a.High > b.High
+		}
+		if a.Advisories != b.Advisories {
+			return a.Advisories > b.Advisories
+		}
+		return a.Ecosystem+"|"+a.Name < b.Ecosystem+"|"+b.Name
+	})
+	rollup.TopPackages = rollup.TopPackages[:min(top, len(rollup.TopPackages))]
+
+	for key := range findings {
+		id := key[strings.LastIndex(key, "|")+1:]
+		advisories[id].Packages++
+	}
+	for id, advisory := range advisories {
+		for team := range advisoryTeams[id] {
+			advisory.Teams = appendSorted(advisory.Teams, team)
+		}
+		rollup.TopAdvisories = append(rollup.TopAdvisories, *advisory)
+	}
+	sort.Slice(rollup.TopAdvisories, func(i, j int) bool {
+		a, b := rollup.TopAdvisories[i], rollup.TopAdvisories[j]
+		if a.Packages != b.Packages {
+			return a.Packages > b.Packages
+		}
+		if len(a.Teams) != len(b.Teams) {
+			return len(a.Teams) > len(b.Teams)
+		}
+		return a.ID < b.ID
+	})
+	rollup.TopAdvisories = rollup.TopAdvisories[:min(top, len(rollup.TopAdvisories))]
+
+	for name, team := range teams {
+		team.VulnerablePackages = len(teamVulnerable[name])
+		team.Findings = len(teamFindings[name])
+		for _, severity := range teamFindings[name] {
+			switch severity {
+			case "Critical":
+				team.Critical++
+			case "High":
+				team.High++
+			}
+		}
+		rollup.Teams = append(rollup.Teams, *team)
+	}
+	sort.Slice(rollup.Teams, func(i, j int) bool {
+		a, b := rollup.Teams[i], rollup.Teams[j]
+		if a.Critical != b.Critical {
+			return a.Critical > b.Critical
+		}
+		if a.High != b.High {
+			return a.High > b.High
+		}
+		return a.Team < b.Team
+	})
+	return rollup
+}
+
+// appendSorted adds a value to a sorted list unless it is in it already
+func appendSorted(list []string, value string) []string {
+	i := sort.SearchStrings(list, value)
+	if i < len(list) && list[i] == value {
+		return list
+	}
+	return append(list[:i], append([]string{value}, list[i:]...)...)
+}
+
+// WriteJSON writes the rollup as an indented JSON document
+func (r Rollup) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(r); err != nil {
+		return fmt.Errorf("error writing rollup: %w", err)
+	}
+	return nil
+}
+
+// WriteHTML writes the rollup as a self-contained HTML page
+func (r Rollup) WriteHTML(w io.Writer) error {
+	tmpl, err := template.New("rollup").Funcs(template.FuncMap{
+		"lower":      strings.ToLower,
+		"join":       strings.Join,
+		"severities": func() []string { return severityLevels },
+	}).Parse(aggregateReportTemplate)
+	if err != nil {
+		return fmt.Errorf("error parsing rollup template: %w", err)
+	}
+	if err := tmpl.Execute(w, r); err != nil {
+		return fmt.Errorf("error writing rollup: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package reporting
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/logging"
+)
+
+// ResultsDiff compares the results of a scan with those of an earlier scan, read from its
+// --output json document, without a database
+type ResultsDiff struct {
+	// Previous is when the earlier results were generated
+	Previous time.Time `json:"previous_generated_at"`
+	// New are the vulnerabilities the scan found that the earlier one did not
+	New []ComparedFinding `json:"new"`
+	// Fixed are the vulnerabilities the earlier scan found that the scan no longer finds
+	Fixed []ComparedFinding `json:"fixed"`
+}
+
+// ComparedFinding is a vulnerability of a package in a results diff. Findings are matched
+// by package and vulnerability rather than version, as db diff does, so upgrading a
+// package to another vulnerable version is neither new nor fixed.
+type ComparedFinding struct {
+	Package   string `json:"package"`
+	Ecosystem string `json:"ecosystem"`
+	// Versions are the versions of the package the vulnerability was found in, by the
+	// scan for a new finding and by the earlier scan for a fixed one
+	Versions   []string `json:"versions"`
+	ID         string   `json:"id"`
+	Summary    string   `json:"summary"`
+	Severity   string   `json:"severity"`
+	FixVersion string   `json:"fix_version"`
+}
+
+// LoadResultsDocument reads the results of an earlier scan written with --output json
+func LoadResultsDocument(path string) (ResultsDocument, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ResultsDocument{}, fmt.Errorf("error reading previous results: %w", err)
+	}
+	var doc ResultsDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return ResultsDocument{}, fmt.Errorf("error parsing previous results %s: %w", path, err)
+	}
+	if doc.Tool.Name != "package-scanner" {
+		return ResultsDocument{}, fmt.Errorf("%s is not a results document written with --output json", path)
+	}
+	return doc, nil
+}
+
+// CompareResults returns the vulnerabilities that are new in current and those fixed
+// since previous
+func CompareResults(previous, current ResultsDocument) ResultsDiff {
+	before, after := comparedFindings(previous), comparedFindings(current)
+	diff := ResultsDiff{Previous: previous.GeneratedAt, New: []ComparedFinding{}, Fixed: []ComparedFinding{}}
+	for key, finding := range after {
+		if _, ok := before[key]; !ok {
+			diff.New = append(diff.New, *finding)
+		}
+	}
+	for key, finding := range before {
+		if _, ok := after[key]; !ok {
+			diff.Fixed = append(diff.Fixed, *finding)
+		}
+	}
+	for _, findings := range [][]ComparedFinding{diff.New, diff.Fixed} {
+		sort.Slice(findings, func(i, j int) bool {
+			a, b := findings[i], findings[j]
+			if a.Severity != b.Severity {
+				return severityRank(a.Severity) < severityRank(b.Severity)
+			}
+			if a.Package != b.Package {
+				return a.Package < b.Package
+			}
+			if a.Ecosystem != b.Ecosystem {
+				return a.Ecosystem < b.Ecosystem
+			}
+			return a.ID < b.ID
+		})
+	}
+	return diff
+}
+
+// comparedFindings returns the findings of a results document by package, ecosystem and
+// vulnerability, with the versions each was found in
+func comparedFindings(doc ResultsDocument) map[string]*ComparedFinding {
+	findings := make(map[string]*ComparedFinding)
+	for _, pkg := range doc.Packages {
+		for _, vuln := range pkg.Vulnerabilities {
+			key := pkg.Ecosystem + "|" + pkg.Name + "|" + vuln.ID
+			finding, ok := findings[key]
+			if !ok {
+				finding = &ComparedFinding{
+					Package:    pkg.Name,
+					Ecosystem:  pkg.Ecosystem,
+					ID:         vuln.ID,
+					Summary:    vuln.Summary,
+					Severity:   vuln.Severity,
+					FixVersion: vuln.FixVersion,
+				}
+				findings[key] = finding
+			}
+			finding.Versions = append(finding.Versions, pkg.Version)
+		}
+	}
+	return findings
+}
+
+// Totals returns the totals of the new findings, by which --fail-on judges a compared scan
+func (d ResultsDiff) Totals() ScanTotals {
+	var totals ScanTotals
+	severities := make([]string, len(d.New))
+	for i, finding := range d.New {
+		severities[i] = finding.Severity
+	}
+	totals.Add(severities)
+	return totals
+}
+
+// DisplayResultsDiff displays the vulnerabilities that are new and fixed since the
+// earlier results, then the totals of each
+func (r *Reporter) DisplayResultsDiff(diff ResultsDiff) {
+	if !r.SummaryOnly {
+		for _, group := range []struct {
+			status   string
+			findings []ComparedFinding
+		}{
+			{"new", diff.New},
+			{"fixed", diff.Fixed},
+		} {
+			for _, f := range group.findings {
+				r.logger.Info("Compared finding",
+					"status", group.status,
+					"name", f.Package,
+					"ecosystem", f.Ecosystem,
+					"versions", f.Versions,
+					"id", f.ID,
+					"summary", f.Summary,
+					"severity", f.Severity,
+					"fixVersion", f.FixVersion,
+				)
+			}
+		}
+	}
+
+	r.logger.InfoContext(logging.SummaryContext(context.Background()), "Results compared",
+		"previous", r.date(diff.Previous),
+		"new", r.count(len(diff.New)),
+		"fixed", r.count(len(diff.Fixed)),
+	)
+}
@@ -1,17 +1,56 @@
 package reporting
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/squarehole/package-scanner/pkg/models"
 	"github.com/squarehole/package-scanner/pkg/osv"
+	"github.com/squarehole/package-scanner/pkg/usage"
 )
 
 // Reporter handles reporting vulnerability scan results
 type Reporter struct {
 	logger *slog.Logger
+	// SummaryOnly suppresses per-package output, leaving only the aggregate summaries
+	SummaryOnly bool
+	// Condensed logs each vulnerable package on one line, without a line per
+	// vulnerability, and leaves out clean packages
+	Condensed bool
+	// Locale renders dates, durations and counts for human readers; when nil they are
+	// logged as raw values for machine-readable output
+	Locale *Locale
+
+	mu     sync.Mutex
+	totals ScanTotals
+}
+
+// date returns a time for logging, as a localized date when a locale is set
+func (r *Reporter) date(t time.Time) any {
+	if r.Locale == nil {
+		return t
+	}
+	return r.Locale.FormatDate(t)
+}
+
+// count returns a count for logging, with locale thousands separators when a locale is set
+func (r *Reporter) count(n int) any {
+	if r.Locale == nil {
+		return n
+	}
+	return r.Locale.FormatCount(n)
+}
+
+// duration returns a duration for logging, localized when a locale is set
+func (r *Reporter) duration(d time.Duration) any {
+	if r.Locale == nil {
+		return d
+	}
+	return r.Locale.FormatDuration(d)
 }
 
 // NewReporter creates a new reporter with structured logging
@@ -24,43 +63,354 @@ func NewReporter(logger *slog.Logger) *Reporter {
 	}
 }
 
-// DisplayResults displays the vulnerability results
-func (r *Reporter) DisplayResults(results models.ScanResults, packageName string) {
+// DisplayResults displays the vulnerability results of a checked package and counts them
+// towards the scan's totals. Hints are key/value pairs added to each finding, such as
+// whether the package is imported by the project's code or is a transitive dependency.
+func (r *Reporter) DisplayResults(results models.ScanResults, packageName, packageVersion, ecosystem string, hints ...any) {
+	severities := make([]string, len(results.Vulnerabilities))
+	for i, vuln := range results.Vulnerabilities {
+		severities[i] = SeverityLevel(vuln)
+	}
+	r.mu.Lock()
+	r.totals.Add(severities)
+	r.mu.Unlock()
+
+	if r.SummaryOnly {
+		return
+	}
 	if len(results.Vulnerabilities) == 0 {
-		r.logger.Info("No vulnerabilities found for the specified package and version.")
-	} else {
-		r.logger.Info("Vulnerabilities found", "count", len(results.Vulnerabilities))
-
-		for i, vuln := range results.Vulnerabilities {
-			// Extract severity rating and fix version
-			severityRating := osv.GetSeverityRating(vuln)
-			fixVersion := osv.FindFixVersion(vuln, packageName)
-
-			// Log each vulnerability as a structured log entry
-			r.logger.Info("Vulnerability details",
-				"index", i+1,
-				"id", vuln.ID,
-				"summary", vuln.Summary,
-				"published", vuln.Published,
-				"severity", severityRating,
-				"fixVersion", fixVersion,
-			)
+		if !r.Condensed {
+			r.logger.Info("No vulnerabilities found for the specified package and version.")
+		}
+		return
+	}
+	upgrade := upgradeAttrs(osv.SafeUpgrade(packageName, packageVersion, ecosystem, results.Vulnerabilities))
+	if r.Condensed {
+		r.displayCondensedResults(results, packageName, packageVersion, severities, upgrade, hints)
+		return
+	}
+
+	r.logger.Info("Vulnerabilities found", append([]any{"count", r.count(len(results.Vulnerabilities))}, upgrade...)...)
+	for i, vuln := range results.Vulnerabilities {
+		// Extract severity rating and fix version
+		severityRating := osv.GetSeverityRating(vuln)
+		fixVersion := osv.FindFixVersion(vuln, packageName)
+
+		// Log each vulnerability as a structured log entry
+		attrs := []any{
+			"index", i + 1,
+			"id", vuln.ID,
+			"summary", vuln.Summary,
+			"published", r.date(vuln.Published),
+			"severity", severityRating,
+			"fixVersion", fixVersion,
+		}
+		attrs = append(attrs, referenceAttrs(vuln)...)
+		attrs = append(attrs, hints...)
+		r.logger.Info("Vulnerability details", attrs...)
+	}
+}
+
+// referenceAttrs returns the log attributes identifying a vulnerability elsewhere and
+// linking to what acts on it: its aliases, CWEs, advisories and fixes, those it has
+func referenceAttrs(vuln models.Vulnerability) []any {
+	var attrs []any
+	for _, attr := range []struct {
+		key    string
+		values []string
+	}{
+		{"aliases", vuln.Aliases},
+		{"cwes", vuln.CWEs()},
+		{"advisories", vuln.ReferenceURLs(models.ReferenceAdvisory)},
+		{"fixes", vuln.ReferenceURLs(models.ReferenceFix)},
+	} {
+		if len(attr.values) > 0 {
+			attrs = append(attrs, attr.key, attr.values)
+		}
+	}
+	return attrs
+}
+
+// upgradeAttrs returns the log attributes recommending an upgrade: the version to
+// upgrade to, if any vulnerability has a fix, and the vulnerabilities no version fixes
+func upgradeAttrs(upgrade osv.Upgrade) []any {
+	var attrs []any
+	if upgrade.Version != "" {
+		attrs = append(attrs, "upgradeTo", upgrade.Version)
+	}
+	if len(upgrade.Unfixed) > 0 {
+		attrs = append(attrs, "unfixed", upgrade.Unfixed)
+	}
+	return attrs
+}
+
+// displayCondensedResults displays a vulnerable package on one line with its highest
+// severity, the IDs of its vulnerabilities and the upgrade clearing them
+func (r *Reporter) displayCondensedResults(results models.ScanResults, name, version string, severities []string, upgrade, hints []any) {
+	highest := severities[0]
+	ids := make([]string, len(results.Vulnerabilities))
+	for i, vuln := range results.Vulnerabilities {
+		ids[i] = vuln.ID
+		if severityRank(severities[i]) < severityRank(highest) {
+			highest = severities[i]
 		}
 	}
+	attrs := []any{
+		"name", name,
+		"version", version,
+		"count", r.count(len(results.Vulnerabilities)),
+		"severity", highest,
+		"ids", ids,
+	}
+	attrs = append(attrs, upgrade...)
+	attrs = append(attrs, hints...)
+	r.logger.Info("Vulnerable package", attrs...)
+}
+
+// DisplaySuppressed displays findings that were excluded from the results by VEX statements or the policy
+func (r *Reporter) DisplaySuppressed(name, version string, suppressed []models.SuppressedVulnerability) {
+	if r.SummaryOnly {
+		return
+	}
+	r.logger.Info("Vulnerabilities suppressed", "name", name, "version", version, "count", r.count(len(suppressed)))
+	if r.Condensed {
+		return
+	}
+
+	for _, s := range suppressed {
+		r.logger.Info("Suppressed vulnerability",
+			"id", s.Vulnerability.ID,
+			"summary", s.Vulnerability.Summary,
+			"status", s.Status,
+			"justification", s.Justification,
+			"source", s.Source,
+		)
+	}
+}
+
+// DisplaySupplyChainFindings displays provenance problems found for an artifact
+func (r *Reporter) DisplaySupplyChainFindings(findings []models.SupplyChainFinding) {
+	if r.SummaryOnly {
+		return
+	}
+	for _, f := range findings {
+		r.logger.Warn("Supply-chain finding",
+			"kind", f.Kind,
+			"name", f.PackageName,
+			"version", f.Version,
+			"ecosystem", f.Ecosystem,
+			"file", f.FilePath,
+			"detail", f.Detail,
+		)
+	}
+}
+
+// DisplaySignatureFindings displays unsigned artifacts and signatures that do not verify
+func (r *Reporter) DisplaySignatureFindings(findings []models.SupplyChainFinding) {
+	if r.SummaryOnly {
+		return
+	}
+	for _, f := range findings {
+		r.logger.Warn("Signature finding",
+			"kind", f.Kind,
+			"name", f.PackageName,
+			"version", f.Version,
+			"ecosystem", f.Ecosystem,
+			"file", f.FilePath,
+			"detail", f.Detail,
+		)
+	}
 }
 
 // DisplayScanSummary displays a summary of the scan operation
 func (r *Reporter) DisplayScanSummary(packageCount int) {
-	r.logger.Info("Scan completed", "packagesProcessed", packageCount)
+	r.logger.Info("Scan completed", "packagesProcessed", r.count(packageCount))
 }
 
-// DisplayPackageScanStart displays information about scanning a package
-func (r *Reporter) DisplayPackageScanStart(name, version, ecosystem string) {
-	r.logger.Info("Scanning package",
+// DirectorySummary holds aggregate results for one scanned directory
+type DirectorySummary struct {
+	Path               string
+	Packages           int
+	VulnerablePackages int
+	Vulnerabilities    int
+	Suppressed         int
+	// SupplyChainFindings counts provenance problems found for the directory's artifacts
+	SupplyChainFindings int
+	// SignatureFindings counts unsigned artifacts and invalid signatures
+	SignatureFindings int
+	Errors            int
+}
+
+// DisplayDirectorySummary displays the results for a single scanned directory
+func (r *Reporter) DisplayDirectorySummary(summary DirectorySummary) {
+	r.logger.Info("Directory scan completed",
+		"path", summary.Path,
+		"packagesProcessed", r.count(summary.Packages),
+		"vulnerablePackages", r.count(summary.VulnerablePackages),
+		"vulnerabilities", r.count(summary.Vulnerabilities),
+		"suppressed", r.count(summary.Suppressed),
+		"supplyChainFindings", r.count(summary.SupplyChainFindings),
+		"signatureFindings", r.count(summary.SignatureFindings),
+		"errors", r.count(summary.Errors),
+	)
+}
+
+// DisplayCombinedSummary displays the totals across all scanned directories and the run
+// time. sharedQueries counts the packages answered by an earlier query for the same
+// package version in the run.
+func (r *Reporter) DisplayCombinedSummary(summaries []DirectorySummary, uniqueQueries, sharedQueries int, elapsed time.Duration) {
+	var total DirectorySummary
+	for _, summary := range summaries {
+		total.Packages += summary.Packages
+		total.VulnerablePackages += summary.VulnerablePackages
+		total.Vulnerabilities += summary.Vulnerabilities
+		total.Suppressed += summary.Suppressed
+		total.SupplyChainFindings += summary.SupplyChainFindings
+		total.SignatureFindings += summary.SignatureFindings
+		total.Errors += summary.Errors
+	}
+
+	r.logger.Info("Scan completed",
+		"directories", r.count(len(summaries)),
+		"packagesProcessed", r.count(total.Packages),
+		"uniquePackagesQueried", r.count(uniqueQueries),
+		"sharedQueries", r.count(sharedQueries),
+		"vulnerablePackages", r.count(total.VulnerablePackages),
+		"vulnerabilities", r.count(total.Vulnerabilities),
+		"suppressed", r.count(total.Suppressed),
+		"supplyChainFindings", r.count(total.SupplyChainFindings),
+		"signatureFindings", r.count(total.SignatureFindings),
+		"errors", r.count(total.Errors),
+		"duration", r.duration(elapsed),
+	)
+}
+
+// EcosystemSummary holds aggregate results for the packages of one ecosystem
+type EcosystemSummary struct {
+	Ecosystem          string
+	Packages           int
+	VulnerablePackages int
+	Vulnerabilities    int
+	Suppressed         int
+	Errors             int
+}
+
+// DisplayEcosystemSummary displays the results for a single package ecosystem
+func (r *Reporter) DisplayEcosystemSummary(summary EcosystemSummary) {
+	r.logger.Info("Ecosystem scan completed",
+		"ecosystem", summary.Ecosystem,
+		"packagesProcessed", r.count(summary.Packages),
+		"vulnerablePackages", r.count(summary.VulnerablePackages),
+		"vulnerabilities", r.count(summary.Vulnerabilities),
+		"suppressed", r.count(summary.Suppressed),
+		"errors", r.count(summary.Errors),
+	)
+}
+
+// CoverageSummary counts how the files of one extension found while scanning were handled
+type CoverageSummary struct {
+	// Extension is the lowercased file extension, or "(none)" for files without one
+	Extension string
+	// Ecosystem is the ecosystem artifacts of the extension are scanned as, if it is scanned
+	Ecosystem string
+	// Parsed counts artifacts whose package was identified
+	Parsed int
+	// Failed counts artifacts whose package could not be identified
+	Failed int
+	// Unknown counts files of an extension the scan does not handle
+	Unknown int
+}
+
+// DisplayCoverage displays, per extension, how many of the files found were parsed,
+// failed to parse or skipped as unknown, followed by the totals
+func (r *Reporter) DisplayCoverage(coverage []CoverageSummary) {
+	var total CoverageSummary
+	for _, c := range coverage {
+		r.logger.Info("Scan coverage",
+			"extension", c.Extension,
+			"ecosystem", c.Ecosystem,
+			"parsed", r.count(c.Parsed),
+			"failed", r.count(c.Failed),
+			"unknown", r.count(c.Unknown),
+		)
+		total.Parsed += c.Parsed
+		total.Failed += c.Failed
+		total.Unknown += c.Unknown
+	}
+
+	level := slog.LevelInfo
+	if total.Failed > 0 || total.Unknown > 0 {
+		level = slog.LevelWarn
+	}
+	r.logger.Log(context.Background(), level, "Scan coverage totals",
+		"files", r.count(total.Parsed+total.Failed+total.Unknown),
+		"parsed", r.count(total.Parsed),
+		"failed", r.count(total.Failed),
+		"unknown", r.count(total.Unknown),
+	)
+}
+
+// DisplayResourceUsage displays the resources consumed by the run
+func (r *Reporter) DisplayResourceUsage(u usage.Usage) {
+	r.logger.Info("Resource usage",
+		"cpuTime", r.duration(u.CPUTime),
+		"peakMemoryBytes", r.count(int(u.PeakMemoryBytes)),
+		"bytesDownloaded", r.count(int(u.BytesDownloaded)),
+		"apiCalls", r.count(u.APICalls),
+		"apiCallsByHost", u.APICallsByHost,
+	)
+}
+
+// LatestVersionStatus describes how a scanned package compares to its latest release
+type LatestVersionStatus struct {
+	Name                  string
+	Version               string
+	Latest                string
+	VersionsBehind        int
+	ClearsAll             bool
+	Remaining             []string
+	LatestVulnerabilities int
+}
+
+// DisplayLatestVersion displays the latest release of a package and whether it fixes the findings
+func (r *Reporter) DisplayLatestVersion(status LatestVersionStatus) {
+	if r.SummaryOnly {
+		return
+	}
+	if status.Latest == "" || status.Latest == status.Version {
+		r.logger.Info("Package is up to date",
+			"name", status.Name,
+			"version", status.Version,
+		)
+		return
+	}
+
+	r.logger.Info("Newer version available",
+		"name", status.Name,
+		"version", status.Version,
+		"latest", status.Latest,
+		"versionsBehind", r.count(status.VersionsBehind),
+		"latestClearsAllVulnerabilities", status.ClearsAll,
+		"remainingInLatest", status.Remaining,
+		"latestVulnerabilities", r.count(status.LatestVulnerabilities),
+	)
+}
+
+// DisplayPackageScanStart displays information about scanning a package, with the
+// SHA-256 of the artifact it was found in when there is one
+func (r *Reporter) DisplayPackageScanStart(name, version, ecosystem, checksum string) {
+	if r.SummaryOnly || r.Condensed {
+		return
+	}
+	attrs := []any{
 		"name", name,
 		"version", version,
 		"ecosystem", ecosystem,
-	)
+	}
+	if checksum != "" {
+		attrs = append(attrs, "sha256", checksum)
+	}
+	r.logger.Info("Scanning package", attrs...)
 }
 
 // DisplayDirectoryScanStart displays information about starting a directory scan
@@ -71,9 +421,34 @@ func (r *Reporter) DisplayDirectoryScanStart(dirPath, fileExt string) {
 	)
 }
 
+// DisplayLockfileScanStart displays information about starting a lockfile scan
+func (r *Reporter) DisplayLockfileScanStart(path string) {
+	r.logger.Info("Scanning lockfile", "path", path)
+}
+
+// DisplayManifestScanStart displays information about starting a manifest scan
+func (r *Reporter) DisplayManifestScanStart(path string) {
+	r.logger.Info("Resolving manifest", "path", path)
+}
+
+// DisplayTargetsDetected displays the detectors that matched files in a directory
+// scanned in auto mode, with the number of files each matched
+func (r *Reporter) DisplayTargetsDetected(dirPath string, detectors map[string]int) {
+	if len(detectors) == 0 {
+		r.logger.Warn("No scan targets detected", "path", dirPath)
+		return
+	}
+	r.logger.Info("Scan targets detected", "path", dirPath, "detectors", detectors)
+}
+
+// DisplaySBOMScanStart displays information about starting an SBOM scan
+func (r *Reporter) DisplaySBOMScanStart(path string) {
+	r.logger.Info("Scanning SBOM", "path", path)
+}
+
 // DisplayPackagesFound displays information about found packages
 func (r *Reporter) DisplayPackagesFound(count int) {
-	r.logger.Info("Package files found", "count", count)
+	r.logger.Info("Package files found", "count", r.count(count))
 }
 
 // DisplayError displays an error message
@@ -0,0 +1,388 @@
+package reporting
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/cvss"
+	"github.com/squarehole/package-scanner/pkg/models"
+	"github.com/squarehole/package-scanner/pkg/osv"
+	"github.com/squarehole/package-scanner/pkg/purl"
+	"github.com/squarehole/package-scanner/pkg/redact"
+)
+
+// cycloneDXSpecVersion is the version of the CycloneDX specification the BOM follows
+const cycloneDXSpecVersion = "1.5"
+
+// CycloneDXReport collects the packages checked during a scan and the vulnerabilities
+// found in them, and writes them as a CycloneDX JSON BOM with a vulnerabilities section,
+// a vulnerability disclosure report (VDR) that other tools can ingest. Every checked
+// package is a component, and each vulnerability lists the components it affects.
+type CycloneDXReport struct {
+	toolVersion string
+
+	mu         sync.Mutex
+	components map[string]cdxComponent
+	vulns      map[string]*cdxVulnerability
+	// Redactor, if set, is applied to package names, locations and advisory texts
+	Redactor *redact.Redactor
+}
+
+// cdxBOM is a CycloneDX BOM
+type cdxBOM struct {
+	BOMFormat       string             `json:"bomFormat"`
+	SpecVersion     string             `json:"specVersion"`
+	SerialNumber    string             `json:"serialNumber"`
+	Version         int                `json:"version"`
+	Metadata        cdxMetadata        `json:"metadata"`
+	Components      []cdxComponent     `json:"components"`
+	Vulnerabilities []cdxVulnerability `json:"vulnerabilities"`
+}
+
+type cdxMetadata struct {
+	Timestamp time.Time `json:"timestamp"`
+	Tools     struct {
+		Components []cdxComponent `json:"components"`
+	} `json:"tools"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxComponent struct {
+	Type       string        `json:"type"`
+	BOMRef     string        `json:"bom-ref,omitempty"`
+	Group      string        `json:"group,omitempty"`
+	Name       string        `json:"name"`
+	Version    string        `json:"version,omitempty"`
+	PURL       string        `json:"purl,omitempty"`
+	Hashes     []cdxHash     `json:"hashes,omitempty"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxVulnerability struct {
+	BOMRef         string         `json:"bom-ref"`
+	ID             string         `json:"id"`
+	Source         *cdxSource     `json:"source,omitempty"`
+	References     []cdxReference `json:"references,omitempty"`
+	Ratings        []cdxRating    `json:"ratings,omitempty"`
+	CWEs           []int          `json:"cwes,omitempty"`
+	Description    string         `json:"description,omitempty"`
+	Detail         string         `json:"detail,omitempty"`
+	Recommendation string         `json:"recommendation,omitempty"`
+	Advisories     []cdxAdvisory  `json:"advisories,omitempty"`
+	Published      *time.Time     `json:"published,omitempty"`
+	Updated        *time.Time     `json:"updated,omitempty"`
+	Affects        []cdxAffect    `json:"affects"`
+	// severity is the vulnerability's severity level, counted in the BOM's totals
+	severity string
+}
+
+type cdxSource struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+type cdxReference struct {
+	ID     string    `json:"id"`
+	Source cdxSource `json:"source"`
+}
+
+type cdxRating struct {
+	Score    *float64 `json:"score,omitempty"`
+	Severity string   `json:"severity"`
+	Method   string   `json:"method,omitempty"`
+	Vector   string   `json:"vector,omitempty"`
+}
+
+type cdxAdvisory struct {
+	URL string `json:"url"`
+}
+
+type cdxAffect struct {
+	Ref      string               `json:"ref"`
+	Versions []cdxAffectedVersion `json:"versions,omitempty"`
+}
+
+type cdxAffectedVersion struct {
+	Version string `json:"version"`
+	Status  string `json:"status"`
+}
+
+// cvssMethods are the CycloneDX rating methods of the OSV severity types
+var cvssMethods = map[string]string{
+	"CVSS_V2": "CVSSv2",
+	"CVSS_V3": "CVSSv31",
+	"CVSS_V4": "CVSSv4",
+}
+
+// NewCycloneDXReport creates an empty CycloneDX report, naming toolVersion as the
+// version of the scanner that produced it
+func NewCycloneDXReport(toolVersion string) *CycloneDXReport {
+	return &CycloneDXReport{
+		toolVersion: toolVersion,
+		components:  make(map[string]cdxComponent),
+		vulns:       make(map[string]*cdxVulnerability),
+	}
+}
+
+// Add records a checked package as a component, and the vulnerabilities found for it as
+// affecting it. Location is the artifact, lockfile, SBOM or directory the package was
+// found in, and checksum the artifact's SHA-256, if any. A vulnerable component gets the
+// lowest version clearing its vulnerabilities as a property. It is safe for concurrent
+// use.
+func (c *CycloneDXReport) Add(name, version, ecosystem, location, checksum string, vulns []models.Vulnerability) {
+	component := c.component(name, version, ecosystem, location, checksum)
+	if upgrade := osv.SafeUpgrade(name, version, ecosystem, vulns); upgrade.Version != "" {
+		component.Properties = append(component.Properties, cdxProperty{Name: "package-scanner:upgrade-to", Value: upgrade.Version})
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if existing, ok := c.components[component.BOMRef]; ok {
+		// The same package found in another location keeps its first one
+		if len(existing.Hashes) == 0 {
+			existing.Hashes = component.Hashes
+			c.components[component.BOMRef] = existing
+		}
+	} else {
+		c.components[component.BOMRef] = component
+	}
+
+	for _, vuln := range vulns {
+		v, ok := c.vulns[vuln.ID]
+		if !ok {
+			v = c.vulnerability(vuln, name)
+			c.vulns[vuln.ID] = v
+		}
+		if !containsAffect(v.Affects, component.BOMRef) {
+			v.Affects = append(v.Affects, cdxAffect{
+				Ref:      component.BOMRef,
+				Versions: []cdxAffectedVersion{{Version: version, Status: "affected"}},
+			})
+		}
+	}
+}
+
+// component builds the component of a checked package, identified by its package URL
+func (c *CycloneDXReport) component(name, version, ecosystem, location, checksum string) cdxComponent {
+	component := cdxComponent{Type: "library", Name: name, Version: version}
+	if p, err := purl.FromPackage(name, version, ecosystem); err == nil {
+		component.Group, component.Name = p.Namespace, p.Name
+		component.PURL = p.String()
+		component.BOMRef = component.PURL
+	} else {
+		// Without a purl type for the ecosystem, the reference only has to be unique
+		component.BOMRef = ecosystem + ":" + name + "@" + version
+	}
+	component.Properties = append(component.Properties, cdxProperty{Name: "package-scanner:ecosystem", Value: ecosystem})
+	if location != "" {
+		component.Properties = append(component.Properties, cdxProperty{Name: "package-scanner:location", Value: c.redact(location)})
+	}
+	if checksum != "" {
+		component.Hashes = []cdxHash{{Alg: "SHA-256", Content: checksum}}
+	}
+	if c.Redactor != nil {
+		component.Group, component.Name = c.redact(component.Group), c.redact(component.Name)
+		component.PURL, component.BOMRef = c.redact(component.PURL), c.redact(component.BOMRef)
+	}
+	return component
+}
+
+// vulnerability builds the vulnerability entry of an advisory, with its aliases as
+// references, its CVSS vectors, or else its advisory severity, as ratings, and the
+// version fixing it in packageName as the recommendation
+func (c *CycloneDXReport) vulnerability(vuln models.Vulnerability, packageName string) *cdxVulnerability {
+	v := &cdxVulnerability{
+		BOMRef:      vuln.ID,
+		ID:          vuln.ID,
+		Source:      vulnerabilitySource(vuln.ID),
+		Description: c.redact(vuln.Summary),
+		Detail:      c.redact(vuln.Details),
+		Affects:     []cdxAffect{},
+		severity:    SeverityLevel(vuln),
+	}
+	for _, alias := range vuln.Aliases {
+		if source := vulnerabilitySource(alias); source != nil {
+			v.References = append(v.References, cdxReference{ID: alias, Source: *source})
+		}
+	}
+	for _, severity := range vuln.Severity {
+		method, ok := cvssMethods[severity.Type]
+		if !ok {
+			continue
+		}
+		vector, err := cvss.Parse(severity.Score)
+		if err != nil {
+			continue
+		}
+		if vector.Version == "3.0" {
+			method = "CVSSv3"
+		}
+		rating := cdxRating{Severity: "unknown", Method: method, Vector: vector.String()}
+		if vector.Scored() {
+			score := vector.BaseScore()
+			rating.Score = &score
+			rating.Severity = strings.ToLower(vector.Severity(score))
+		}
+		v.Ratings = append(v.Ratings, rating)
+	}
+	if len(v.Ratings) == 0 {
+		v.Ratings = []cdxRating{{Severity: strings.ToLower(SeverityLevel(vuln)), Method: "other"}}
+	}
+	for _, cwe := range vuln.CWEs() {
+		var id int
+		if _, err := fmt.Sscanf(cwe, "CWE-%d", &id); err == nil {
+			v.CWEs = append(v.CWEs, id)
+		}
+	}
+	if fix := osv.FindFixVersion(vuln, packageName); fix != "" && fix != osv.NoFixVersion {
+		v.Recommendation = "Upgrade " + c.redact(packageName) + " to " + fix + " or later"
+	}
+	for _, url := range vuln.ReferenceURLs(models.ReferenceAdvisory) {
+		v.Advisories = append(v.Advisories, cdxAdvisory{URL: url})
+	}
+	if !vuln.Published.IsZero() {
+		published := vuln.Published
+		v.Published = &published
+	}
+	if !vuln.Modified.IsZero() {
+		modified := vuln.Modified
+		v.Updated = &modified
+	}
+	return v
+}
+
+// vulnerabilitySource returns the database that issued a vulnerability ID, judging by
+// its prefix, or nil if it is not known
+func vulnerabilitySource(id string) *cdxSource {
+	prefix, _, _ := strings.Cut(id, "-")
+	switch prefix {
+	case "CVE":
+		return &cdxSource{Name: "NVD", URL: "https://nvd.nist.gov/vuln/detail/" + id}
+	case "GHSA":
+		return &cdxSource{Name: "GitHub", URL: "https://github.com/advisories/" + id}
+	case "":
+		return nil
+	}
+	return &cdxSource{Name: "OSV", URL: "https://osv.dev/vulnerability/" + id}
+}
+
+// containsAffect reports whether affects already lists the component ref
+func containsAffect(affects []cdxAffect, ref string) bool {
+	for _, affect := range affects {
+		if affect.Ref == ref {
+			return true
+		}
+	}
+	return false
+}
+
+// redact applies the Redactor, if set
+func (c *CycloneDXReport) redact(s string) string {
+	if c.Redactor == nil || s == "" {
+		return s
+	}
+	return c.Redactor.String(s)
+}
+
+// Write writes the BOM to path, with the components and vulnerabilities ordered by
+// reference and ID so repeated scans produce comparable documents
+func (c *CycloneDXReport) Write(path string) error {
+	serial, err := serialNumber()
+	if err != nil {
+		return err
+	}
+	bom := cdxBOM{
+		BOMFormat:       "CycloneDX",
+		SpecVersion:     cycloneDXSpecVersion,
+		SerialNumber:    serial,
+		Version:         1,
+		Metadata:        cdxMetadata{Timestamp: time.Now().UTC().Truncate(time.Second)},
+		Components:      []cdxComponent{},
+		Vulnerabilities: []cdxVulnerability{},
+	}
+	bom.Metadata.Tools.Components = []cdxComponent{{Type: "application", Name: "package-scanner", Version: c.toolVersion}}
+
+	c.mu.Lock()
+	for _, component := range c.components {
+		bom.Components = append(bom.Components, component)
+	}
+	for _, vuln := range c.vulns {
+		v := *vuln
+		v.Affects = append([]cdxAffect{}, vuln.Affects...)
+		bom.Vulnerabilities = append(bom.Vulnerabilities, v)
+	}
+	c.mu.Unlock()
+
+	sort.Slice(bom.Components, func(i, j int) bool { return bom.Components[i].BOMRef < bom.Components[j].BOMRef })
+	sort.Slice(bom.Vulnerabilities, func(i, j int) bool { return bom.Vulnerabilities[i].ID < bom.Vulnerabilities[j].ID })
+	for _, v := range bom.Vulnerabilities {
+		sort.Slice(v.Affects, func(i, j int) bool { return v.Affects[i].Ref < v.Affects[j].Ref })
+	}
+	bom.Metadata.Properties = totalsProperties(bom)
+
+	data, err := json.MarshalIndent(bom, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding CycloneDX report: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing CycloneDX report: %w", err)
+	}
+	return nil
+}
+
+// totalsProperties returns the totals of the BOM's components and vulnerabilities as
+// metadata properties, as CycloneDX has no field for them
+func totalsProperties(bom cdxBOM) []cdxProperty {
+	severities := make(map[string][]string)
+	for _, v := range bom.Vulnerabilities {
+		for _, affect := range v.Affects {
+			severities[affect.Ref] = append(severities[affect.Ref], v.severity)
+		}
+	}
+	var totals ScanTotals
+	for _, component := range bom.Components {
+		totals.Add(severities[component.BOMRef])
+	}
+
+	properties := []cdxProperty{
+		{Name: "package-scanner:totals:packages", Value: strconv.Itoa(totals.Packages)},
+		{Name: "package-scanner:totals:vulnerable_packages", Value: strconv.Itoa(totals.VulnerablePackages)},
+		{Name: "package-scanner:totals:clean_packages", Value: strconv.Itoa(totals.CleanPackages)},
+		{Name: "package-scanner:totals:vulnerabilities", Value: strconv.Itoa(totals.Vulnerabilities)},
+	}
+	for i, count := range totals.severityCounts() {
+		properties = append(properties, cdxProperty{
+			Name:  "package-scanner:totals:" + strings.ToLower(severityLevels[i]),
+			Value: strconv.Itoa(count),
+		})
+	}
+	return properties
+}
+
+// serialNumber returns a random UUID URN identifying a BOM
+func serialNumber() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("error generating BOM serial number: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
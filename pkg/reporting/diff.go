@@ -0,0 +1,63 @@
+package reporting
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/squarehole/package-scanner/pkg/db"
+)
+
+// DisplayRunDiff displays the findings that are new, fixed and persisting between two
+// scan runs, then the totals of each
+func (r *Reporter) DisplayRunDiff(diff db.RunDiff) {
+	if diff.Base.Target != diff.Head.Target {
+		r.logger.Warn("Compared scan runs have different targets",
+			"baseTarget", diff.Base.Target,
+			"headTarget", diff.Head.Target)
+	}
+
+	if !r.SummaryOnly {
+		for _, group := range []struct {
+			status   string
+			findings []db.DiffFinding
+		}{
+			{"new", diff.New},
+			{"fixed", diff.Fixed},
+			{"persisting", diff.Persisting},
+		} {
+			for _, f := range group.findings {
+				r.logger.Info("Run diff finding",
+					"status", group.status,
+					"name", f.PackageName,
+					"ecosystem", f.Ecosystem,
+					"id", f.VulnID,
+					"summary", f.Summary,
+					"severity", f.SeverityRating,
+					"fixVersion", f.FixVersion,
+					"baseVersions", f.BaseVersions,
+					"headVersions", f.HeadVersions,
+				)
+			}
+		}
+	}
+
+	r.logger.Info("Scan runs compared",
+		"baseRunID", diff.Base.ID,
+		"headRunID", diff.Head.ID,
+		"target", diff.Head.Target,
+		"new", r.count(len(diff.New)),
+		"fixed", r.count(len(diff.Fixed)),
+		"persisting", r.count(len(diff.Persisting)),
+	)
+}
+
+// WriteRunDiffJSON writes a diff of two scan runs as indented JSON
+func WriteRunDiffJSON(diff db.RunDiff, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(diff); err != nil {
+		return fmt.Errorf("error writing run diff: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package reporting
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/db"
+)
+
+// ExportFormats are the formats stored findings can be exported in: CSV, JSON Lines, and
+// CSV prepared for spreadsheets such as Excel
+var ExportFormats = []string{"csv", "jsonl", "excel"}
+
+// exportColumns are the header of a CSV export, one per field of exportRecord
+var exportColumns = []string{
+	"id", "package_name", "ecosystem", "version", "vuln_id", "aliases", "summary",
+	"severity_rating", "severity_label", "cvss_score", "cvss_vector", "fix_version", "fixed_versions",
+	"published", "first_seen", "last_seen", "scan_id",
+}
+
+// exportRecord is a stored finding as exported; the raw advisory response is left out
+type exportRecord struct {
+	ID             int64              `json:"id"`
+	PackageName    string             `json:"package_name"`
+	Ecosystem      string             `json:"ecosystem"`
+	Version        string             `json:"version"`
+	VulnID         string             `json:"vuln_id"`
+	Aliases        []string           `json:"aliases"`
+	Summary        string             `json:"summary"`
+	SeverityRating string             `json:"severity_rating"`
+	SeverityLabel  string             `json:"severity_label"`
+	CVSSScore      *float64           `json:"cvss_score"`
+	CVSSVector     string             `json:"cvss_vector"`
+	FixVersion     string             `json:"fix_version"`
+	FixedVersions  []string           `json:"fixed_versions"`
+	AffectedRanges []db.AffectedRange `json:"affected_ranges,omitempty"`
+	Published      time.Time          `json:"published"`
+	FirstSeen      time.Time          `json:"first_seen"`
+	LastSeen       time.Time          `json:"last_seen"`
+	ScanID         int64              `json:"scan_id,omitempty"`
+}
+
+// WriteExport writes stored findings in one of the ExportFormats
+func WriteExport(records []db.VulnerabilityRecord, format string, w io.Writer) error {
+	switch format {
+	case "jsonl":
+		encoder := json.NewEncoder(w)
+		for _, record := range records {
+			if err := encoder.Encode(newExportRecord(record)); err != nil {
+				return fmt.Errorf("error writing finding %d: %w", record.ID, err)
+			}
+		}
+		return nil
+	case "csv", "excel":
+		return writeExportCSV(records, format == "excel", w)
+	}
+	return fmt.Errorf("unsupported export format %q", format)
+}
+
+// newExportRecord converts a stored finding for export
+func newExportRecord(record db.VulnerabilityRecord) exportRecord {
+	return exportRecord{
+		ID:             record.ID,
+		PackageName:    record.PackageName,
+		Ecosystem:      record.Ecosystem,
+		Version:        record.Version,
+		VulnID:         record.VulnID,
+		Aliases:        record.Aliases,
+		Summary:        record.Summary,
+		SeverityRating: record.SeverityRating,
+		SeverityLabel:  record.SeverityLabel,
+		CVSSScore:      record.CVSSScore,
+		CVSSVector:     record.CVSSVector,
+		FixVersion:     record.FixVersion,
+		FixedVersions:  record.FixedVersions,
+		AffectedRanges: record.AffectedRanges,
+		Published:      record.Published,
+		FirstSeen:      record.CreatedAt,
+		LastSeen:       record.LastSeen,
+		ScanID:         record.ScanID,
+	}
+}
+
+// writeExportCSV writes stored findings as CSV with a header row, lists joined by
+// semicolons. For spreadsheets, the file starts with a UTF-8 byte order mark so Excel
+// reads it as UTF-8, lines end in CRLF, times are written in a form Excel parses as
+// dates, and cells that a spreadsheet would run as a formula are quoted with a leading
+// apostrophe, so an advisory summary cannot inject one.
+func writeExportCSV(records []db.VulnerabilityRecord, spreadsheet bool, w io.Writer) error {
+	if spreadsheet {
+		if _, err := io.WriteString(w, "\ufeff"); err != nil {
+			return fmt.Errorf("error writing export: %w", err)
+		}
+	}
+	writer := csv.NewWriter(w)
+	writer.UseCRLF = spreadsheet
+
+	timeLayout := time.RFC3339
+	if spreadsheet {
+		timeLayout = "2006-01-02 15:04:05"
+	}
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(timeLayout)
+	}
+
+	if err := writer.Write(exportColumns); err != nil {
+		return fmt.Errorf("error writing export: %w", err)
+	}
+	for _, record := range records {
+		score := ""
+		if record.CVSSScore != nil {
+			score = strconv.FormatFloat(*record.CVSSScore, 'f', 1, 64)
+		}
+		scanID := ""
+		if record.ScanID != 0 {
+			scanID = strconv.FormatInt(record.ScanID, 10)
+		}
+		row := []string{
+			strconv.FormatInt(record.ID, 10),
+			record.PackageName,
+			record.Ecosystem,
+			record.Version,
+			record.VulnID,
+			strings.Join(record.Aliases, ";"),
+			record.Summary,
+			record.SeverityRating,
+			record.SeverityLabel,
+			score,
+			record.CVSSVector,
+			record.FixVersion,
+			strings.Join(record.FixedVersions, ";"),
+			formatTime(record.Published),
+			formatTime(record.CreatedAt),
+			formatTime(record.LastSeen),
+			scanID,
+		}
+		if spreadsheet {
+			for i, cell := range row {
+				row[i] = spreadsheetCell(cell)
+			}
+		}
+		if err := writer.Write(row); err != nil {
+			return fmt.Errorf("error writing finding %d: %w", record.ID, err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing export: %w", err)
+	}
+	return nil
+}
+
+// spreadsheetCell escapes a cell a spreadsheet would evaluate as a formula
+func spreadsheetCell(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
@@ -0,0 +1,210 @@
+package reporting
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/cvss"
+	"github.com/squarehole/package-scanner/pkg/models"
+	"github.com/squarehole/package-scanner/pkg/osv"
+	"github.com/squarehole/package-scanner/pkg/redact"
+)
+
+//go:embed html_report.tmpl
+var htmlReportTemplate string
+
+// Severity levels used to group findings in the HTML report, most severe first
+var severityLevels = []string{"Critical", "High", "Medium", "Low", "Unknown"}
+
+// Finding is one vulnerability of one scanned package, as listed in the HTML report
+type Finding struct {
+	Package   string
+	Version   string
+	Ecosystem string
+	Location  string
+	// Checksum is the SHA-256 of the artifact, if the package was read from one
+	Checksum   string
+	ID         string
+	Aliases    []string
+	CWEs       []string
+	Summary    string
+	Severity   string
+	Rating     string
+	Published  time.Time
+	FixVersion string
+	// Advisories are the URLs of the vulnerability's published advisories, and Fixes
+	// those of the changes fixing it, such as commits
+	Advisories []string
+	Fixes      []string
+	// UpgradeTo is the lowest version of the package clearing all its vulnerabilities
+	// that have a fix, or empty if none has one
+	UpgradeTo string
+}
+
+// HTMLReport collects findings during a scan and writes them as a single
+// self-contained HTML page with client-side filtering, sorting and search
+type HTMLReport struct {
+	mu       sync.Mutex
+	findings []Finding
+	scanned  map[string]bool
+	// Redactor, if set, is applied to every text field written to the report
+	Redactor *redact.Redactor
+	// Translations, if set, replaces the report's English labels and headings
+	Translations Translations
+}
+
+// NewHTMLReport creates an empty HTML report
+func NewHTMLReport() *HTMLReport {
+	return &HTMLReport{scanned: make(map[string]bool)}
+}
+
+// Add records a scanned package and the vulnerabilities found for it. Location is the
+// artifact, lockfile, SBOM or directory the package was found in, and checksum the
+// artifact's SHA-256, if any. It is safe for concurrent use.
+func (h *HTMLReport) Add(name, version, ecosystem, location, checksum string, vulns []models.Vulnerability) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.scanned[ecosystem+"|"+name+"|"+version] = true
+	upgrade := osv.SafeUpgrade(name, version, ecosystem, vulns)
+	for _, vuln := range vulns {
+		rating := osv.GetSeverityRating(vuln)
+		h.findings = append(h.findings, Finding{
+			Package:    name,
+			Version:    version,
+			Ecosystem:  ecosystem,
+			Location:   location,
+			Checksum:   checksum,
+			ID:         vuln.ID,
+			Aliases:    vuln.Aliases,
+			CWEs:       vuln.CWEs(),
+			Summary:    vuln.Summary,
+			Severity:   SeverityLevel(vuln),
+			Rating:     rating,
+			Published:  vuln.Published,
+			FixVersion: osv.FindFixVersion(vuln, name),
+			Advisories: vuln.ReferenceURLs(models.ReferenceAdvisory),
+			Fixes:      vuln.ReferenceURLs(models.ReferenceFix),
+			UpgradeTo:  upgrade.Version,
+		})
+	}
+}
+
+// redactURLs returns reference URLs with a redactor, if there is one, applied
+func redactURLs(redactor *redact.Redactor, urls []string) []string {
+	if redactor == nil || len(urls) == 0 {
+		return urls
+	}
+	redacted := make([]string, len(urls))
+	for i, url := range urls {
+		redacted[i] = redactor.String(url)
+	}
+	return redacted
+}
+
+// SeverityLevel groups a vulnerability into one of Critical, High, Medium, Low or Unknown,
+// as the reports do, from the base score of its CVSS vector or otherwise the advisory's
+// own severity
+func SeverityLevel(vuln models.Vulnerability) string {
+	if severity := cvss.Rate(vuln).Severity; slices.Contains(severityLevels, severity) {
+		return severity
+	}
+	return "Unknown"
+}
+
+// htmlReportData is passed to the report template
+type htmlReportData struct {
+	Generated          string
+	PackagesScanned    int
+	VulnerablePackages int
+	CleanPackages      int
+	Findings           []Finding
+	Severities         []string
+	SeverityCounts     map[string]int
+	Ecosystems         []string
+}
+
+// Write renders the collected findings to path, most severe first
+func (h *HTMLReport) Write(path string, elapsed time.Duration) error {
+	h.mu.Lock()
+	findings := make([]Finding, len(h.findings))
+	copy(findings, h.findings)
+	packagesScanned := len(h.scanned)
+	h.mu.Unlock()
+
+	rank := make(map[string]int, len(severityLevels))
+	for i, level := range severityLevels {
+		rank[level] = i
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if rank[findings[i].Severity] != rank[findings[j].Severity] {
+			return rank[findings[i].Severity] < rank[findings[j].Severity]
+		}
+		return findings[i].Package < findings[j].Package
+	})
+
+	generated := strings.NewReplacer(
+		"{time}", time.Now().Format("2006-01-02 15:04:05 MST"),
+		"{duration}", elapsed.Round(time.Millisecond).String(),
+	).Replace(h.Translations.text("generated"))
+	data := htmlReportData{
+		Generated:       generated,
+		PackagesScanned: packagesScanned,
+		Severities:      severityLevels,
+		SeverityCounts:  make(map[string]int),
+	}
+	vulnerable := make(map[string]bool)
+	ecosystems := make(map[string]bool)
+	for i := range findings {
+		f := &findings[i]
+		vulnerable[f.Ecosystem+"|"+f.Package+"|"+f.Version] = true
+		if h.Redactor != nil {
+			f.Package = h.Redactor.String(f.Package)
+			f.Location = h.Redactor.String(f.Location)
+			f.Summary = h.Redactor.String(f.Summary)
+			f.Advisories = redactURLs(h.Redactor, f.Advisories)
+			f.Fixes = redactURLs(h.Redactor, f.Fixes)
+		}
+		ecosystems[f.Ecosystem] = true
+		data.SeverityCounts[f.Severity]++
+	}
+	data.Findings = findings
+	data.VulnerablePackages = len(vulnerable)
+	data.CleanPackages = packagesScanned - len(vulnerable)
+	for ecosystem := range ecosystems {
+		data.Ecosystems = append(data.Ecosystems, ecosystem)
+	}
+	sort.Strings(data.Ecosystems)
+
+	tmpl, err := template.New("report").Funcs(template.FuncMap{
+		"lower":    strings.ToLower,
+		"join":     func(list []string) string { return strings.Join(list, " ") },
+		"t":        h.Translations.text,
+		"severity": h.Translations.severity,
+		"date": func(t time.Time) string {
+			if t.IsZero() {
+				return ""
+			}
+			return t.Format("2006-01-02")
+		},
+	}).Parse(htmlReportTemplate)
+	if err != nil {
+		return fmt.Errorf("error parsing HTML report template: %w", err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating HTML report: %w", err)
+	}
+	defer f.Close()
+	if err := tmpl.Execute(f, data); err != nil {
+		return fmt.Errorf("error writing HTML report: %w", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,189 @@
+package reporting
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+	"github.com/squarehole/package-scanner/pkg/osv"
+	"github.com/squarehole/package-scanner/pkg/redact"
+)
+
+// Finding types written to the JSON Lines stream
+const (
+	StreamVulnerability = "vulnerability"
+	StreamSupplyChain   = "supply-chain"
+	StreamSignature     = "signature"
+	// StreamSummary is the last line, the totals of the scan
+	StreamSummary = "summary"
+)
+
+// StreamRecord is one line of the JSON Lines finding stream
+type StreamRecord struct {
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	Package   string    `json:"package"`
+	Version   string    `json:"version"`
+	Ecosystem string    `json:"ecosystem"`
+	Location  string    `json:"location,omitempty"`
+	Checksum  string    `json:"checksum,omitempty"`
+
+	// Vulnerability findings
+	ID         string    `json:"id,omitempty"`
+	Aliases    []string  `json:"aliases,omitempty"`
+	Summary    string    `json:"summary,omitempty"`
+	Severity   string    `json:"severity,omitempty"`
+	Rating     string    `json:"rating,omitempty"`
+	Published  time.Time `json:"published,omitzero"`
+	FixVersion string    `json:"fix_version,omitempty"`
+	CWEs       []string  `json:"cwes,omitempty"`
+	Advisories []string  `json:"advisories,omitempty"`
+	Fixes      []string  `json:"fixes,omitempty"`
+	// UpgradeTo is the lowest version of the package clearing all its vulnerabilities
+	// that have a fix
+	UpgradeTo string `json:"upgrade_to,omitempty"`
+
+	// Supply-chain and signature findings
+	Kind   string `json:"kind,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// streamSummary is the last line of the JSON Lines finding stream
+type streamSummary struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	ScanTotals
+}
+
+// FindingStream writes each finding as a JSON object on its own line as soon as it
+// is known, so long scans can be followed with tail -f or piped into a stream processor.
+// Lines are written whole with a single write and are never buffered. After a write
+// fails nothing more is written; the error is available from Err.
+type FindingStream struct {
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+	// Redactor, if set, is applied to package names, locations, summaries, details and
+	// reference URLs
+	Redactor *redact.Redactor
+}
+
+// NewFindingStream creates a finding stream writing to w
+func NewFindingStream(w io.Writer) *FindingStream {
+	return &FindingStream{w: w}
+}
+
+// AddVulnerabilities writes one line per vulnerability found for a package. Location
+// and checksum are as for HTMLReport.Add. It is safe for concurrent use.
+func (s *FindingStream) AddVulnerabilities(name, version, ecosystem, location, checksum string, vulns []models.Vulnerability) {
+	upgrade := osv.SafeUpgrade(name, version, ecosystem, vulns)
+	for _, vuln := range vulns {
+		rating := osv.GetSeverityRating(vuln)
+		fixVersion := osv.FindFixVersion(vuln, name)
+		if fixVersion == osv.NoFixVersion {
+			fixVersion = ""
+		}
+		s.write(StreamRecord{
+			Type:       StreamVulnerability,
+			Package:    name,
+			Version:    version,
+			Ecosystem:  ecosystem,
+			Location:   location,
+			Checksum:   checksum,
+			ID:         vuln.ID,
+			Aliases:    vuln.Aliases,
+			Summary:    vuln.Summary,
+			Severity:   SeverityLevel(vuln),
+			Rating:     rating,
+			Published:  vuln.Published,
+			FixVersion: fixVersion,
+			CWEs:       vuln.CWEs(),
+			Advisories: vuln.ReferenceURLs(models.ReferenceAdvisory),
+			Fixes:      vuln.ReferenceURLs(models.ReferenceFix),
+			UpgradeTo:  upgrade.Version,
+		})
+	}
+}
+
+// AddSupplyChainFindings writes one line per provenance or signature finding; kind is
+// StreamSupplyChain or StreamSignature. It is safe for concurrent use.
+func (s *FindingStream) AddSupplyChainFindings(kind string, findings []models.SupplyChainFinding) {
+	for _, f := range findings {
+		s.write(StreamRecord{
+			Type:      kind,
+			Package:   f.PackageName,
+			Version:   f.Version,
+			Ecosystem: f.Ecosystem,
+			Location:  f.FilePath,
+			Kind:      f.Kind,
+			Detail:    f.Detail,
+		})
+	}
+}
+
+// WriteSummary writes the totals of the scan as the last line of the stream
+func (s *FindingStream) WriteSummary(totals ScanTotals) {
+	s.encode(streamSummary{Type: StreamSummary, Time: time.Now().UTC(), ScanTotals: totals})
+}
+
+// Start does nothing; the stream's first line is its first finding. With
+// WritePackageResult and Finish it makes the stream a ReportWriter.
+func (s *FindingStream) Start() error {
+	return nil
+}
+
+// WritePackageResult writes the vulnerabilities of a package, returning the first error
+// encountered writing the stream
+func (s *FindingStream) WritePackageResult(result PackageResult) error {
+	s.AddVulnerabilities(result.Name, result.Version, result.Ecosystem, result.Location, result.Checksum, result.Vulnerabilities)
+	return s.Err()
+}
+
+// Finish writes the totals of the scan as the last line of the stream, returning the
+// first error encountered writing it
+func (s *FindingStream) Finish(totals ScanTotals) error {
+	s.WriteSummary(totals)
+	return s.Err()
+}
+
+// Err returns the first error encountered writing the stream, if any
+func (s *FindingStream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// write timestamps, redacts and writes a single record
+func (s *FindingStream) write(record StreamRecord) {
+	record.Time = time.Now().UTC()
+	if s.Redactor != nil {
+		record.Package = s.Redactor.String(record.Package)
+		record.Location = s.Redactor.String(record.Location)
+		record.Summary = s.Redactor.String(record.Summary)
+		record.Detail = s.Redactor.String(record.Detail)
+		record.Advisories = redactURLs(s.Redactor, record.Advisories)
+		record.Fixes = redactURLs(s.Redactor, record.Fixes)
+	}
+	s.encode(record)
+}
+
+// encode writes a value as a single line
+func (s *FindingStream) encode(v any) {
+	line, err := json.Marshal(v)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return
+	}
+	if err != nil {
+		s.err = fmt.Errorf("error encoding finding: %w", err)
+		return
+	}
+	if _, err := s.w.Write(append(line, '\n')); err != nil {
+		s.err = fmt.Errorf("error writing finding stream: %w", err)
+	}
+}
@@ -0,0 +1,135 @@
+package reporting
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Locale holds the conventions used to render dates, durations and counts in human-readable output
+type Locale struct {
+	Name       string
+	DateLayout string
+	// Group separates thousands in counts; Decimal separates fractional seconds in durations
+	Group   string
+	Decimal string
+}
+
+// isoLocale is used when no locale is configured, or the configured one is unknown
+var isoLocale = Locale{Name: "C", DateLayout: "2006-01-02", Decimal: "."}
+
+// locales maps language tags, with or without region, to their conventions
+var locales = map[string]Locale{
+	"en":    {DateLayout: "01/02/2006", Group: ",", Decimal: "."},
+	"en-US": {DateLayout: "01/02/2006", Group: ",", Decimal: "."},
+	"en-GB": {DateLayout: "02/01/2006", Group: ",", Decimal: "."},
+	"en-IE": {DateLayout: "02/01/2006", Group: ",", Decimal: "."},
+	"en-AU": {DateLayout: "02/01/2006", Group: ",", Decimal: "."},
+	"en-ZA": {DateLayout: "2006/01/02", Group: " ", Decimal: ","},
+	"de":    {DateLayout: "02.01.2006", Group: ".", Decimal: ","},
+	"de-CH": {DateLayout: "02.01.2006", Group: "’", Decimal: "."},
+	"fr":    {DateLayout: "02/01/2006", Group: " ", Decimal: ","},
+	"nl":    {DateLayout: "02-01-2006", Group: ".", Decimal: ","},
+	"af":    {DateLayout: "2006-01-02", Group: " ", Decimal: ","},
+	"es":    {DateLayout: "02/01/2006", Group: ".", Decimal: ","},
+	"it":    {DateLayout: "02/01/2006", Group: ".", Decimal: ","},
+	"pt":    {DateLayout: "02/01/2006", Group: ".", Decimal: ","},
+	"da":    {DateLayout: "02.01.2006", Group: ".", Decimal: ","},
+	"nb":    {DateLayout: "02.01.2006", Group: " ", Decimal: ","},
+	"fi":    {DateLayout: "2.1.2006", Group: " ", Decimal: ","},
+	"sv":    {DateLayout: "2006-01-02", Group: " ", Decimal: ","},
+	"pl":    {DateLayout: "02.01.2006", Group: " ", Decimal: ","},
+	"cs":    {DateLayout: "2. 1. 2006", Group: " ", Decimal: ","},
+	"ja":    {DateLayout: "2006/01/02", Group: ",", Decimal: "."},
+	"zh":    {DateLayout: "2006/01/02", Group: ",", Decimal: "."},
+}
+
+// LookupLocale returns the conventions for a locale such as "de", "en-GB" or "nl_NL.UTF-8",
+// falling back from a regional variant to its language
+func LookupLocale(name string) (Locale, error) {
+	tag := normalizeLocale(name)
+	if tag == "C" || tag == "POSIX" {
+		return isoLocale, nil
+	}
+
+	if locale, ok := locales[tag]; ok {
+		locale.Name = tag
+		return locale, nil
+	}
+	language, _, _ := strings.Cut(tag, "-")
+	if locale, ok := locales[language]; ok {
+		locale.Name = tag
+		return locale, nil
+	}
+	return Locale{}, fmt.Errorf("unsupported locale %q", name)
+}
+
+// EnvironmentLocale returns the locale configured by LC_ALL, LC_TIME or LANG,
+// or the ISO conventions when none is set or the one set is not supported
+func EnvironmentLocale() Locale {
+	for _, key := range []string{"LC_ALL", "LC_TIME", "LANG"} {
+		if value := os.Getenv(key); value != "" {
+			if locale, err := LookupLocale(value); err == nil {
+				return locale
+			}
+			break
+		}
+	}
+	return isoLocale
+}
+
+// normalizeLocale turns POSIX locale names such as "de_DE.UTF-8@euro" into language tags
+func normalizeLocale(name string) string {
+	name, _, _ = strings.Cut(name, ".")
+	name, _, _ = strings.Cut(name, "@")
+	language, region, ok := strings.Cut(strings.ReplaceAll(name, "_", "-"), "-")
+	if !ok {
+		if name == "C" || name == "POSIX" {
+			return name
+		}
+		return strings.ToLower(language)
+	}
+	return strings.ToLower(language) + "-" + strings.ToUpper(region)
+}
+
+// FormatDate renders the date part of a time, or an empty string for the zero time
+func (l Locale) FormatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(l.DateLayout)
+}
+
+// FormatCount renders a count with the locale's thousands separator
+func (l Locale) FormatCount(n int) string {
+	digits := strconv.Itoa(n)
+	sign := ""
+	if n < 0 {
+		sign, digits = "-", digits[1:]
+	}
+	if l.Group == "" || len(digits) <= 3 {
+		return sign + digits
+	}
+
+	var b strings.Builder
+	b.WriteString(sign)
+	first := len(digits) % 3
+	if first > 0 {
+		b.WriteString(digits[:first])
+	}
+	for i := first; i < len(digits); i += 3 {
+		if i > 0 {
+			b.WriteString(l.Group)
+		}
+		b.WriteString(digits[i : i+3])
+	}
+	return b.String()
+}
+
+// FormatDuration renders a duration rounded to milliseconds with the locale's decimal separator
+func (l Locale) FormatDuration(d time.Duration) string {
+	s := d.Round(time.Millisecond).String()
+	return strings.ReplaceAll(s, ".", l.Decimal)
+}
@@ -0,0 +1,281 @@
+package reporting
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+	"github.com/squarehole/package-scanner/pkg/osv"
+	"github.com/squarehole/package-scanner/pkg/redact"
+)
+
+// ResultsDocument is the results of a scan run as a single JSON document, written with
+// --output json for pipelines that parse the results rather than the logs
+type ResultsDocument struct {
+	Tool           ResultsTool      `json:"tool"`
+	GeneratedAt    time.Time        `json:"generated_at"`
+	ElapsedSeconds float64          `json:"elapsed_seconds"`
+	Summary        ScanTotals       `json:"summary"`
+	Packages       []PackageResults `json:"packages"`
+	// Comparison holds the findings new and fixed since the results given with --compare
+	Comparison *ResultsDiff `json:"comparison,omitempty"`
+}
+
+// ResultsTool names the scanner that produced a results document
+type ResultsTool struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// PackageResults is a checked package version and the vulnerabilities found in it, an
+// empty list for a clean package
+type PackageResults struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Ecosystem string `json:"ecosystem"`
+	Location  string `json:"location,omitempty"`
+	// Checksum is the SHA-256 of the artifact, if the package was read from one
+	Checksum        string                 `json:"checksum,omitempty"`
+	Vulnerabilities []VulnerabilityResults `json:"vulnerabilities"`
+	// UpgradeTo is the lowest version clearing all the vulnerabilities that have a fix,
+	// or empty if none has one
+	UpgradeTo string `json:"upgrade_to,omitempty"`
+	// Unfixed are the IDs of the vulnerabilities no version above the package's fixes
+	Unfixed []string `json:"unfixed,omitempty"`
+}
+
+// VulnerabilityResults is a vulnerability of a package in a results document
+type VulnerabilityResults struct {
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases,omitempty"`
+	Summary  string   `json:"summary"`
+	Severity string   `json:"severity"`
+	Rating   string   `json:"rating"`
+	// FixVersion is the first version fixing the vulnerability, or empty if there is none
+	FixVersion string    `json:"fix_version"`
+	Published  time.Time `json:"published,omitzero"`
+	// CWEs are the weaknesses the vulnerability is an instance of, such as CWE-79
+	CWEs []string `json:"cwes,omitempty"`
+	// Advisories are the URLs of its published advisories, and Fixes those of the
+	// changes fixing it, such as commits
+	Advisories []string `json:"advisories,omitempty"`
+	Fixes      []string `json:"fixes,omitempty"`
+}
+
+// ResultsReport collects the packages checked during a scan and the vulnerabilities
+// found in them, and writes them as a ResultsDocument or as CSV once the scan is done
+type ResultsReport struct {
+	toolVersion string
+
+	mu       sync.Mutex
+	packages map[string]*PackageResults
+	// Redactor, if set, is applied to package names, locations, summaries and reference
+	// URLs
+	Redactor *redact.Redactor
+	// Comparison, if set, is included in the document
+	Comparison *ResultsDiff
+}
+
+// NewResultsReport creates an empty results report, naming toolVersion as the version of
+// the scanner that produced it
+func NewResultsReport(toolVersion string) *ResultsReport {
+	return &ResultsReport{toolVersion: toolVersion, packages: make(map[string]*PackageResults)}
+}
+
+// Add records a checked package and the vulnerabilities found for it, with the upgrade
+// clearing them. Location and checksum are as for HTMLReport.Add. It is safe for
+// concurrent use.
+func (r *ResultsReport) Add(name, version, ecosystem, location, checksum string, vulns []models.Vulnerability) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := ecosystem + "|" + name + "|" + version
+	pkg, ok := r.packages[key]
+	if !ok {
+		// The same package found in another location keeps its first one
+		pkg = &PackageResults{
+			Name:            r.redact(name),
+			Version:         version,
+			Ecosystem:       ecosystem,
+			Location:        r.redact(location),
+			Checksum:        checksum,
+			Vulnerabilities: []VulnerabilityResults{},
+		}
+		r.packages[key] = pkg
+	}
+
+	for _, vuln := range vulns {
+		if containsResult(pkg.Vulnerabilities, vuln.ID) {
+			continue
+		}
+		rating := osv.GetSeverityRating(vuln)
+		fixVersion := osv.FindFixVersion(vuln, name)
+		if fixVersion == osv.NoFixVersion {
+			fixVersion = ""
+		}
+		pkg.Vulnerabilities = append(pkg.Vulnerabilities, VulnerabilityResults{
+			ID:         vuln.ID,
+			Aliases:    vuln.Aliases,
+			Summary:    r.redact(vuln.Summary),
+			Severity:   SeverityLevel(vuln),
+			Rating:     rating,
+			FixVersion: fixVersion,
+			Published:  vuln.Published,
+			CWEs:       vuln.CWEs(),
+			Advisories: redactURLs(r.Redactor, vuln.ReferenceURLs(models.ReferenceAdvisory)),
+			Fixes:      redactURLs(r.Redactor, vuln.ReferenceURLs(models.ReferenceFix)),
+		})
+	}
+	if len(vulns) > 0 && pkg.UpgradeTo == "" && len(pkg.Unfixed) == 0 {
+		upgrade := osv.SafeUpgrade(name, version, ecosystem, vulns)
+		pkg.UpgradeTo, pkg.Unfixed = upgrade.Version, upgrade.Unfixed
+	}
+}
+
+// containsResult reports whether a vulnerability is already listed
+func containsResult(vulns []VulnerabilityResults, id string) bool {
+	for _, v := range vulns {
+		if v.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// redact applies the Redactor, if set
+func (r *ResultsReport) redact(s string) string {
+	if r.Redactor == nil || s == "" {
+		return s
+	}
+	return r.Redactor.String(s)
+}
+
+// Document returns the collected results, the packages ordered by name, ecosystem and
+// version and their vulnerabilities most severe first
+func (r *ResultsReport) Document(elapsed time.Duration) ResultsDocument {
+	doc := ResultsDocument{
+		Tool:           ResultsTool{Name: "package-scanner", Version: r.toolVersion},
+		GeneratedAt:    time.Now().UTC(),
+		ElapsedSeconds: elapsed.Seconds(),
+		Packages:       []PackageResults{},
+		Comparison:     r.Comparison,
+	}
+
+	r.mu.Lock()
+	for _, pkg := range r.packages {
+		p := *pkg
+		p.Vulnerabilities = append([]VulnerabilityResults{}, pkg.Vulnerabilities...)
+		doc.Packages = append(doc.Packages, p)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(doc.Packages, func(i, j int) bool {
+		a, b := doc.Packages[i], doc.Packages[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Ecosystem != b.Ecosystem {
+			return a.Ecosystem < b.Ecosystem
+		}
+		return a.Version < b.Version
+	})
+
+	for _, pkg := range doc.Packages {
+		sort.Slice(pkg.Vulnerabilities, func(i, j int) bool {
+			a, b := pkg.Vulnerabilities[i], pkg.Vulnerabilities[j]
+			if a.Severity != b.Severity {
+				return severityRank(a.Severity) < severityRank(b.Severity)
+			}
+			return a.ID < b.ID
+		})
+		severities := make([]string, len(pkg.Vulnerabilities))
+		for i, vuln := range pkg.Vulnerabilities {
+			severities[i] = vuln.Severity
+		}
+		doc.Summary.Add(severities)
+	}
+	return doc
+}
+
+// Write writes the collected results to w as an indented JSON document
+func (r *ResultsReport) Write(w io.Writer, elapsed time.Duration) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(r.Document(elapsed)); err != nil {
+		return fmt.Errorf("error writing results: %w", err)
+	}
+	return nil
+}
+
+// resultsColumns are the header of the CSV results, one row per vulnerability of a package
+var resultsColumns = []string{
+	"severity", "package", "version", "ecosystem", "vuln_id", "aliases", "cwes", "summary",
+	"rating", "fix_version", "upgrade_to", "published", "advisories", "fixes", "location",
+	"checksum",
+}
+
+// WriteCSV writes the vulnerabilities found as CSV with a header row and one row per
+// vulnerability of a package, most severe first, for triage in a spreadsheet. Clean
+// packages have no rows. Lists are joined by semicolons, and cells a spreadsheet would
+// run as a formula are quoted with a leading apostrophe.
+func (r *ResultsReport) WriteCSV(w io.Writer) error {
+	type row struct {
+		pkg  PackageResults
+		vuln VulnerabilityResults
+	}
+	var rows []row
+	for _, pkg := range r.Document(0).Packages {
+		for _, vuln := range pkg.Vulnerabilities {
+			rows = append(rows, row{pkg, vuln})
+		}
+	}
+	// Packages are already ordered by name, ecosystem and version
+	sort.SliceStable(rows, func(i, j int) bool {
+		return severityRank(rows[i].vuln.Severity) < severityRank(rows[j].vuln.Severity)
+	})
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(resultsColumns); err != nil {
+		return fmt.Errorf("error writing results: %w", err)
+	}
+	for _, row := range rows {
+		published := ""
+		if !row.vuln.Published.IsZero() {
+			published = row.vuln.Published.UTC().Format(time.RFC3339)
+		}
+		cells := []string{
+			row.vuln.Severity,
+			row.pkg.Name,
+			row.pkg.Version,
+			row.pkg.Ecosystem,
+			row.vuln.ID,
+			strings.Join(row.vuln.Aliases, ";"),
+			strings.Join(row.vuln.CWEs, ";"),
+			row.vuln.Summary,
+			row.vuln.Rating,
+			row.vuln.FixVersion,
+			row.pkg.UpgradeTo,
+			published,
+			strings.Join(row.vuln.Advisories, ";"),
+			strings.Join(row.vuln.Fixes, ";"),
+			row.pkg.Location,
+			row.pkg.Checksum,
+		}
+		for i, cell := range cells {
+			cells[i] = spreadsheetCell(cell)
+		}
+		if err := writer.Write(cells); err != nil {
+			return fmt.Errorf("error writing results: %w", err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing results: %w", err)
+	}
+	return nil
+}
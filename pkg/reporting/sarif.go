@@ -0,0 +1,211 @@
+package reporting
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/squarehole/package-scanner/pkg/purl"
+)
+
+// sarifVersion is the version of the SARIF specification the log follows
+const sarifVersion = "2.1.0"
+
+// sarifSchema is the JSON schema of SARIF 2.1.0 logs
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri,omitempty"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+// sarifRule describes a vulnerability; every finding of it refers to the rule by its ID
+type sarifRule struct {
+	ID               string         `json:"id"`
+	ShortDescription sarifMessage   `json:"shortDescription"`
+	HelpURI          string         `json:"helpUri,omitempty"`
+	Properties       map[string]any `json:"properties,omitempty"`
+}
+
+type sarifResult struct {
+	RuleID     string          `json:"ruleId"`
+	Level      string          `json:"level"`
+	Message    sarifMessage    `json:"message"`
+	Locations  []sarifLocation `json:"locations,omitempty"`
+	Properties map[string]any  `json:"properties,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// sarifLevels map the severityLevels to SARIF result levels
+var sarifLevels = map[string]string{
+	"Critical": "error",
+	"High":     "error",
+	"Medium":   "warning",
+	"Low":      "note",
+	"Unknown":  "note",
+}
+
+// sarifSecurity map the severityLevels to the "security-severity" scores code scanning
+// services such as GitHub's rank alerts by, within the CVSS band of each level
+var sarifSecurity = map[string]string{
+	"Critical": "9.5",
+	"High":     "8.0",
+	"Medium":   "5.5",
+	"Low":      "2.0",
+}
+
+// WriteSARIF writes the vulnerabilities found as a SARIF 2.1.0 log for code scanning
+// services, with a rule per vulnerability and a result per vulnerability of a package,
+// located at the file the package was found in. Clean packages have no results.
+func (r *ResultsReport) WriteSARIF(w io.Writer) error {
+	doc := r.Document(0)
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           doc.Tool.Name,
+			Version:        doc.Tool.Version,
+			InformationURI: "https://github.com/squarehole/package-scanner",
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+
+	rules := make(map[string]bool)
+	for _, pkg := range doc.Packages {
+		for _, vuln := range pkg.Vulnerabilities {
+			if !rules[vuln.ID] {
+				rules[vuln.ID] = true
+				run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRuleOf(vuln))
+			}
+			run.Results = append(run.Results, sarifResultOf(pkg, vuln))
+		}
+	}
+	sort.Slice(run.Tool.Driver.Rules, func(i, j int) bool {
+		return run.Tool.Driver.Rules[i].ID < run.Tool.Driver.Rules[j].ID
+	})
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(sarifLog{Schema: sarifSchema, Version: sarifVersion, Runs: []sarifRun{run}}); err != nil {
+		return fmt.Errorf("error writing results: %w", err)
+	}
+	return nil
+}
+
+// sarifRuleOf returns the rule describing a vulnerability, linking to its first advisory
+// or else to osv.dev
+func sarifRuleOf(vuln VulnerabilityResults) sarifRule {
+	rule := sarifRule{
+		ID:               vuln.ID,
+		ShortDescription: sarifMessage{Text: vuln.Summary},
+		HelpURI:          "https://osv.dev/vulnerability/" + vuln.ID,
+		Properties:       map[string]any{"tags": append([]string{"security", "vulnerability"}, vuln.CWEs...)},
+	}
+	if rule.ShortDescription.Text == "" {
+		rule.ShortDescription.Text = vuln.ID
+	}
+	if len(vuln.Advisories) > 0 {
+		rule.HelpURI = vuln.Advisories[0]
+	}
+	if score, ok := sarifSecurity[vuln.Severity]; ok {
+		rule.Properties["security-severity"] = score
+	}
+	return rule
+}
+
+// sarifResultOf returns the result of a vulnerability found in a package
+func sarifResultOf(pkg PackageResults, vuln VulnerabilityResults) sarifResult {
+	message := fmt.Sprintf("%s %s (%s) is affected by %s", pkg.Name, pkg.Version, pkg.Ecosystem, vuln.ID)
+	if vuln.Summary != "" {
+		message += ": " + vuln.Summary
+	}
+	if pkg.UpgradeTo != "" {
+		message += fmt.Sprintf(". Upgrade to %s", pkg.UpgradeTo)
+	}
+
+	result := sarifResult{
+		RuleID:  vuln.ID,
+		Level:   sarifLevels[vuln.Severity],
+		Message: sarifMessage{Text: message},
+		Properties: map[string]any{
+			"package":   pkg.Name,
+			"version":   pkg.Version,
+			"ecosystem": pkg.Ecosystem,
+			"severity":  vuln.Severity,
+		},
+	}
+	if result.Level == "" {
+		result.Level = "note"
+	}
+	if p, err := purl.FromPackage(pkg.Name, pkg.Version, pkg.Ecosystem); err == nil {
+		result.Properties["purl"] = p.String()
+	}
+	if vuln.FixVersion != "" {
+		result.Properties["fixVersion"] = vuln.FixVersion
+	}
+	if pkg.UpgradeTo != "" {
+		result.Properties["upgradeTo"] = pkg.UpgradeTo
+	}
+	if pkg.Location != "" {
+		result.Locations = []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{URI: sarifURI(pkg.Location)},
+		}}}
+	}
+	return result
+}
+
+// sarifURI returns the URI of the file a package was found in: relative to the working
+// directory, where code scanning services expect the files of the repository, or else a
+// file URI. Remote locations are URIs already.
+func sarifURI(location string) string {
+	if strings.Contains(location, "://") {
+		return location
+	}
+	if filepath.IsAbs(location) {
+		wd, err := os.Getwd()
+		if err != nil {
+			return "file://" + filepath.ToSlash(location)
+		}
+		rel, err := filepath.Rel(wd, location)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "file://" + filepath.ToSlash(location)
+		}
+		location = rel
+	}
+	return strings.TrimPrefix(filepath.ToSlash(location), "./")
+}
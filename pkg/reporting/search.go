@@ -0,0 +1,92 @@
+package reporting
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+	"github.com/squarehole/package-scanner/pkg/osv"
+)
+
+// DisplayAdvisoryMatches displays the advisories a source returned for a text search,
+// with the package ranges each one affects
+func (r *Reporter) DisplayAdvisoryMatches(source string, matches []models.Vulnerability) {
+	r.logger.Info("Advisories matched", "source", source, "count", r.count(len(matches)))
+
+	for _, vuln := range matches {
+		r.logger.Info("Advisory match",
+			"source", source,
+			"id", vuln.ID,
+			"aliases", vuln.Aliases,
+			"summary", vuln.Summary,
+			"published", r.date(vuln.Published),
+			"severity", osv.GetSeverityRating(vuln),
+			"affected", AffectedRanges(vuln),
+		)
+	}
+}
+
+// AffectedRanges describes the versions an advisory affects, one entry per package,
+// e.g. "lodash >=4.0.0 <4.17.21". Range expressions given by the source are kept as written.
+func AffectedRanges(vuln models.Vulnerability) []string {
+	var ranges []string
+	for _, affected := range vuln.Affected {
+		if affected.DatabaseSpecific.AffectedRange != "" {
+			ranges = append(ranges, affected.Package.Name+" "+affected.DatabaseSpecific.AffectedRange)
+			continue
+		}
+
+		var parts []string
+		for _, r := range affected.Ranges {
+			if r.Type == "GIT" {
+				continue
+			}
+			parts = append(parts, describeEvents(r.Events)...)
+		}
+		if len(parts) == 0 && len(affected.Versions) > 0 {
+			parts = append(parts, fmt.Sprintf("%d listed versions", len(affected.Versions)))
+		}
+		if len(parts) == 0 {
+			parts = append(parts, "all versions")
+		}
+		ranges = append(ranges, affected.Package.Name+" "+strings.Join(parts, " || "))
+	}
+	return ranges
+}
+
+// describeEvents turns the introduced, fixed and last_affected events of a range into interval expressions
+func describeEvents(events []models.Event) []string {
+	var intervals []string
+	lower := ""
+	open := false
+	for _, event := range events {
+		switch {
+		case event.Introduced != "":
+			if open {
+				intervals = append(intervals, lower)
+			}
+			lower, open = ">="+event.Introduced, true
+			if event.Introduced == "0" {
+				lower = ">=0"
+			}
+		case event.Fixed != "":
+			if open {
+				intervals = append(intervals, lower+" <"+event.Fixed)
+			} else {
+				intervals = append(intervals, "<"+event.Fixed)
+			}
+			open = false
+		case event.LastAffected != "":
+			if open {
+				intervals = append(intervals, lower+" <="+event.LastAffected)
+			} else {
+				intervals = append(intervals, "<="+event.LastAffected)
+			}
+			open = false
+		}
+	}
+	if open {
+		intervals = append(intervals, lower)
+	}
+	return intervals
+}
@@ -0,0 +1,273 @@
+package reporting
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/db"
+)
+
+//go:embed status_report.tmpl
+var statusReportTemplate string
+
+// StatusReport is the status of the package versions checked by a stored scan run, built
+// from the database without scanning, for dashboards and scheduled reports
+type StatusReport struct {
+	GeneratedAt time.Time       `json:"generated_at"`
+	Run         db.RunRecord    `json:"run"`
+	Summary     StatusSummary   `json:"summary"`
+	Packages    []PackageStatus `json:"packages"`
+}
+
+// StatusSummary totals a status report
+type StatusSummary struct {
+	// Packages is the number of packages the run checked, which includes those neither
+	// vulnerable nor recorded as clean
+	Packages   int               `json:"packages"`
+	Vulnerable int               `json:"vulnerable"`
+	Clean      int               `json:"clean"`
+	Findings   int               `json:"findings"`
+	Severities db.SeverityCounts `json:"severities"`
+}
+
+// PackageStatus is the status of a package version in a run: vulnerable, with its
+// findings, or clean
+type PackageStatus struct {
+	PackageName string `json:"package_name"`
+	Ecosystem   string `json:"ecosystem"`
+	Version     string `json:"version"`
+	Status      string `json:"status"`
+	// Severity is the highest severity of the findings, or empty for a clean package
+	Severity string          `json:"severity,omitempty"`
+	Findings []StatusFinding `json:"findings,omitempty"`
+}
+
+// StatusFinding is a vulnerability of a package in a status report
+type StatusFinding struct {
+	VulnID     string   `json:"vuln_id"`
+	Aliases    []string `json:"aliases,omitempty"`
+	Summary    string   `json:"summary"`
+	Severity   string   `json:"severity"`
+	CVSSScore  *float64 `json:"cvss_score,omitempty"`
+	FixVersion string   `json:"fix_version"`
+}
+
+// Package statuses in a status report
+const (
+	StatusVulnerable = "vulnerable"
+	StatusClean      = "clean"
+)
+
+// BuildStatusReport groups the findings of a stored scan run by package version,
+// vulnerable packages first, most severe first, followed by the clean ones
+func BuildStatusReport(status db.RunStatus) StatusReport {
+	report := StatusReport{
+		GeneratedAt: time.Now(),
+		Run:         status.Run,
+		Summary:     StatusSummary{Packages: status.Run.PackageCount, Findings: len(status.Findings)},
+		Packages:    []PackageStatus{},
+	}
+
+	index := make(map[string]int)
+	for _, record := range status.Findings {
+		key := record.Ecosystem + "|" + record.PackageName + "|" + record.Version
+		i, ok := index[key]
+		if !ok {
+			i = len(report.Packages)
+			index[key] = i
+			report.Packages = append(report.Packages, PackageStatus{
+				PackageName: record.PackageName,
+				Ecosystem:   record.Ecosystem,
+				Version:     record.Version,
+				Status:      StatusVulnerable,
+			})
+		}
+		pkg := &report.Packages[i]
+		severity := recordSeverity(record)
+		pkg.Findings = append(pkg.Findings, StatusFinding{
+			VulnID:     record.VulnID,
+			Aliases:    record.Aliases,
+			Summary:    record.Summary,
+			Severity:   severity,
+			CVSSScore:  record.CVSSScore,
+			FixVersion: record.FixVersion,
+		})
+		if pkg.Severity == "" || severityRank(severity) < severityRank(pkg.Severity) {
+			pkg.Severity = severity
+		}
+		switch severity {
+		case "Critical":
+			report.Summary.Severities.Critical++
+		case "High":
+			report.Summary.Severities.High++
+		case "Medium":
+			report.Summary.Severities.Medium++
+		case "Low":
+			report.Summary.Severities.Low++
+		default:
+			report.Summary.Severities.Unknown++
+		}
+	}
+	report.Summary.Vulnerable = len(report.Packages)
+
+	for _, pkg := range report.Packages {
+		sort.Slice(pkg.Findings, func(i, j int) bool {
+			a, b := pkg.Findings[i], pkg.Findings[j]
+			if a.Severity != b.Severity {
+				return severityRank(a.Severity) < severityRank(b.Severity)
+			}
+			return a.VulnID < b.VulnID
+		})
+	}
+	sort.Slice(report.Packages, func(i, j int) bool {
+		a, b := report.Packages[i], report.Packages[j]
+		if a.Severity != b.Severity {
+			return severityRank(a.Severity) < severityRank(b.Severity)
+		}
+		if a.PackageName != b.PackageName {
+			return a.PackageName < b.PackageName
+		}
+		if a.Ecosystem != b.Ecosystem {
+			return a.Ecosystem < b.Ecosystem
+		}
+		return a.Version < b.Version
+	})
+
+	// Clean scans are already ordered by package, ecosystem and version
+	for _, clean := range status.Clean {
+		report.Packages = append(report.Packages, PackageStatus{
+			PackageName: clean.PackageName,
+			Ecosystem:   clean.Ecosystem,
+			Version:     clean.Version,
+			Status:      StatusClean,
+		})
+	}
+	report.Summary.Clean = len(status.Clean)
+	return report
+}
+
+// recordSeverity groups a stored finding into one of the severityLevels, from the label
+// computed from its CVSS vector or advisory when it was saved, or else from its rating
+func recordSeverity(record db.VulnerabilityRecord) string {
+	if slices.Contains(severityLevels, record.SeverityLabel) {
+		return record.SeverityLabel
+	}
+	return ratingLevel(record.SeverityRating)
+}
+
+// ratingLevel groups a rating out of 10 into one of the severityLevels
+func ratingLevel(rating string) string {
+	// Ratings look like "7.5/10", "9.0+/10" or "7.0-8.9/10"; the leading number is the score
+	end := strings.IndexFunc(rating, func(r rune) bool { return r != '.' && (r < '0' || r > '9') })
+	if end < 0 {
+		end = len(rating)
+	}
+	score, err := strconv.ParseFloat(rating[:end], 64)
+	switch {
+	case err != nil || score <= 0:
+		return "Unknown"
+	case score >= 9:
+		return "Critical"
+	case score >= 7:
+		return "High"
+	case score >= 4:
+		return "Medium"
+	default:
+		return "Low"
+	}
+}
+
+// severityRank orders the severityLevels, most severe first
+func severityRank(severity string) int {
+	if i := slices.Index(severityLevels, severity); i >= 0 {
+		return i
+	}
+	return len(severityLevels)
+}
+
+// DisplayStatusReport displays the status of each package version of a stored scan run,
+// unless only the summary is wanted, then the totals
+func (r *Reporter) DisplayStatusReport(report StatusReport) {
+	if !r.SummaryOnly {
+		for _, pkg := range report.Packages {
+			if pkg.Status == StatusClean {
+				r.logger.Info("Package status",
+					"name", pkg.PackageName,
+					"ecosystem", pkg.Ecosystem,
+					"version", pkg.Version,
+					"status", pkg.Status,
+				)
+				continue
+			}
+			ids := make([]string, len(pkg.Findings))
+			for i, finding := range pkg.Findings {
+				ids[i] = finding.VulnID
+			}
+			r.logger.Info("Package status",
+				"name", pkg.PackageName,
+				"ecosystem", pkg.Ecosystem,
+				"version", pkg.Version,
+				"status", pkg.Status,
+				"severity", pkg.Severity,
+				"vulnerabilities", r.count(len(pkg.Findings)),
+				"ids", ids,
+			)
+		}
+	}
+
+	run := report.Run
+	r.logger.Info("Scan run status",
+		"runID", run.ID,
+		"target", run.Target,
+		"startedAt", r.date(run.StartedAt),
+		"finishedAt", r.date(run.FinishedAt),
+		"packages", r.count(report.Summary.Packages),
+		"vulnerable", r.count(report.Summary.Vulnerable),
+		"clean", r.count(report.Summary.Clean),
+		"vulnerabilities", r.count(report.Summary.Findings),
+		"critical", r.count(report.Summary.Severities.Critical),
+		"high", r.count(report.Summary.Severities.High),
+		"medium", r.count(report.Summary.Severities.Medium),
+		"low", r.count(report.Summary.Severities.Low),
+		"unknown", r.count(report.Summary.Severities.Unknown),
+	)
+}
+
+// WriteJSON writes the status report as an indented JSON document
+func (s StatusReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(s); err != nil {
+		return fmt.Errorf("error writing status report: %w", err)
+	}
+	return nil
+}
+
+// WriteHTML writes the status report as a self-contained HTML page, which can be sent
+// as the body of an email
+func (s StatusReport) WriteHTML(w io.Writer) error {
+	tmpl, err := template.New("status").Funcs(template.FuncMap{
+		"lower": strings.ToLower,
+		"score": func(score *float64) string {
+			if score == nil {
+				return ""
+			}
+			return fmt.Sprintf("%.1f", *score)
+		},
+	}).Parse(statusReportTemplate)
+	if err != nil {
+		return fmt.Errorf("error parsing status template: %w", err)
+	}
+	if err := tmpl.Execute(w, s); err != nil {
+		return fmt.Errorf("error writing status report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package reporting
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+)
+
+// severityColors are the ANSI colors of the severityLevels in the console table
+var severityColors = map[string]lipgloss.Color{
+	"Critical": "9",
+	"High":     "208",
+	"Medium":   "11",
+	"Low":      "12",
+	"Unknown":  "8",
+}
+
+// tableColumns are the header of the console table
+var tableColumns = []string{"Package", "Version", "Ecosystem", "Severity", "Vulnerabilities", "Upgrade To"}
+
+// WriteTable writes the vulnerable packages found as a table for people reading a
+// terminal, one row per package with its highest severity, the number of
+// vulnerabilities and the version to upgrade to, most severe first, followed by the
+// numbers of vulnerable and clean packages and the totals per severity. Severities are
+// colored when w is a terminal that supports it and NO_COLOR is not set.
+func (r *ResultsReport) WriteTable(w io.Writer) error {
+	doc := r.Document(0)
+	renderer := lipgloss.NewRenderer(w)
+
+	var vulnerable []PackageResults
+	for _, pkg := range doc.Packages {
+		if len(pkg.Vulnerabilities) > 0 {
+			vulnerable = append(vulnerable, pkg)
+		}
+	}
+	// Packages are already ordered by name, ecosystem and version, and their
+	// vulnerabilities most severe first
+	sort.SliceStable(vulnerable, func(i, j int) bool {
+		return severityRank(vulnerable[i].Vulnerabilities[0].Severity) < severityRank(vulnerable[j].Vulnerabilities[0].Severity)
+	})
+
+	var b strings.Builder
+	if len(vulnerable) > 0 {
+		rows := make([][]string, len(vulnerable))
+		for i, pkg := range vulnerable {
+			rows[i] = []string{
+				pkg.Name,
+				pkg.Version,
+				pkg.Ecosystem,
+				pkg.Vulnerabilities[0].Severity,
+				strconv.Itoa(len(pkg.Vulnerabilities)),
+				fixAll(pkg),
+			}
+		}
+
+		header := renderer.NewStyle().Bold(true).Padding(0, 1)
+		cell := renderer.NewStyle().Padding(0, 1)
+		t := table.New().
+			Border(lipgloss.RoundedBorder()).
+			BorderStyle(renderer.NewStyle().Foreground(lipgloss.Color("8"))).
+			Headers(tableColumns...).
+			Rows(rows...).
+			StyleFunc(func(row, col int) lipgloss.Style {
+				switch {
+				case row == table.HeaderRow:
+					return header
+				case col == 3:
+					severity := rows[row][col]
+					style := cell.Foreground(severityColors[severity])
+					if severity == "Critical" {
+						style = style.Bold(true)
+					}
+					return style
+				case col == 4:
+					return cell.Align(lipgloss.Right)
+				}
+				return cell
+			})
+		b.WriteString(t.Render())
+		b.WriteString("\n")
+	}
+
+	summary := doc.Summary
+	fmt.Fprintf(&b, "%d packages: %d vulnerable, %d clean\n", summary.Packages, summary.VulnerablePackages, summary.CleanPackages)
+	var parts []string
+	for i, count := range summary.severityCounts() {
+		severity := severityLevels[i]
+		text := fmt.Sprintf("%d %s", count, strings.ToLower(severity))
+		if count > 0 {
+			text = renderer.NewStyle().Foreground(severityColors[severity]).Render(text)
+		}
+		parts = append(parts, text)
+	}
+	fmt.Fprintf(&b, "%d vulnerabilities: %s\n", summary.Vulnerabilities, strings.Join(parts, ", "))
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("error writing results: %w", err)
+	}
+	return nil
+}
+
+// fixAll returns the version a package should be upgraded to, noting the
+// vulnerabilities no version fixes
+func fixAll(pkg PackageResults) string {
+	switch {
+	case len(pkg.Unfixed) == 0:
+		return pkg.UpgradeTo
+	case pkg.UpgradeTo == "":
+		return "none"
+	}
+	return fmt.Sprintf("%s (%d unfixed)", pkg.UpgradeTo, len(pkg.Unfixed))
+}
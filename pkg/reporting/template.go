@@ -0,0 +1,59 @@
+package reporting
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ResultsTemplate is a user's text/template rendering the results of a scan in a format
+// of their own, such as Confluence markup or an internal ticket format. It is executed
+// with the ResultsDocument.
+type ResultsTemplate struct {
+	tmpl *template.Template
+}
+
+// templateFuncs are the functions available to results templates besides the built-in ones
+var templateFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"join":  func(sep string, list []string) string { return strings.Join(list, sep) },
+	"date": func(layout string, t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(layout)
+	},
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"fixAll": fixAll,
+}
+
+// LoadResultsTemplate reads and parses a results template, so mistakes in it are
+// reported before the scan starts
+func LoadResultsTemplate(path string) (*ResultsTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading template: %w", err)
+	}
+	tmpl, err := template.New(filepath.Base(path)).Funcs(templateFuncs).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template: %w", err)
+	}
+	return &ResultsTemplate{tmpl: tmpl}, nil
+}
+
+// WriteTemplate writes the collected results to w through a results template
+func (r *ResultsReport) WriteTemplate(w io.Writer, t *ResultsTemplate, elapsed time.Duration) error {
+	if err := t.tmpl.Execute(w, r.Document(elapsed)); err != nil {
+		return fmt.Errorf("error executing template: %w", err)
+	}
+	return nil
+}
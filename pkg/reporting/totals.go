@@ -0,0 +1,96 @@
+package reporting
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/squarehole/package-scanner/pkg/db"
+	"github.com/squarehole/package-scanner/pkg/logging"
+)
+
+// ScanTotals totals the packages checked by a scan and the vulnerabilities found in them
+// by severity, the summary every output format ends with
+type ScanTotals struct {
+	Packages           int               `json:"packages"`
+	VulnerablePackages int               `json:"vulnerable_packages"`
+	CleanPackages      int               `json:"clean_packages"`
+	Vulnerabilities    int               `json:"vulnerabilities"`
+	Severities         db.SeverityCounts `json:"severities"`
+}
+
+// Add counts a checked package, given the severity levels of its vulnerabilities, one
+// of the severityLevels each, or none for a clean package
+func (t *ScanTotals) Add(severities []string) {
+	t.Packages++
+	if len(severities) == 0 {
+		t.CleanPackages++
+		return
+	}
+	t.VulnerablePackages++
+	t.Vulnerabilities += len(severities)
+	for _, severity := range severities {
+		switch severity {
+		case "Critical":
+			t.Severities.Critical++
+		case "High":
+			t.Severities.High++
+		case "Medium":
+			t.Severities.Medium++
+		case "Low":
+			t.Severities.Low++
+		default:
+			t.Severities.Unknown++
+		}
+	}
+}
+
+// FailOnThresholds are the severities a scan can be failed at with --fail-on, most severe
+// first; "any" also counts vulnerabilities of unknown severity
+var FailOnThresholds = []string{"critical", "high", "medium", "low", "any"}
+
+// CountAtLeast returns the number of vulnerabilities at or above one of the
+// FailOnThresholds
+func (t ScanTotals) CountAtLeast(threshold string) (int, error) {
+	rank := slices.Index(FailOnThresholds, threshold)
+	if rank < 0 {
+		return 0, fmt.Errorf("unknown threshold %q (available: %s)", threshold, strings.Join(FailOnThresholds, ", "))
+	}
+	count := 0
+	// "any" is ranked with Unknown, the last of the severityLevels
+	for _, n := range t.severityCounts()[:rank+1] {
+		count += n
+	}
+	return count, nil
+}
+
+// severityCounts returns the counts of the severityLevels, in their order
+func (t ScanTotals) severityCounts() []int {
+	s := t.Severities
+	return []int{s.Critical, s.High, s.Medium, s.Low, s.Unknown}
+}
+
+// Totals returns the totals of the packages displayed with DisplayResults so far
+func (r *Reporter) Totals() ScanTotals {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.totals
+}
+
+// DisplayTotals displays the totals of the packages checked by the scan, grouped by
+// severity. It is shown even when only summaries are wanted, or the logs are quiet.
+func (r *Reporter) DisplayTotals() {
+	totals := r.Totals()
+	r.logger.InfoContext(logging.SummaryContext(context.Background()), "Scan totals",
+		"packages", r.count(totals.Packages),
+		"vulnerablePackages", r.count(totals.VulnerablePackages),
+		"cleanPackages", r.count(totals.CleanPackages),
+		"vulnerabilities", r.count(totals.Vulnerabilities),
+		"critical", r.count(totals.Severities.Critical),
+		"high", r.count(totals.Severities.High),
+		"medium", r.count(totals.Severities.Medium),
+		"low", r.count(totals.Severities.Low),
+		"unknown", r.count(totals.Severities.Unknown),
+	)
+}
@@ -0,0 +1,134 @@
+package reporting
+
+import (
+	"testing"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+	"github.com/squarehole/package-scanner/pkg/osv"
+)
+
+// cvssVuln returns a vulnerability with a CVSS vector of severityType and, if given, the
+// advisory's own severity
+func cvssVuln(severityType, vector, advisory string) models.Vulnerability {
+	vuln := models.Vulnerability{ID: "GHSA-1"}
+	if vector != "" {
+		vuln.Severity = []models.SeverityRating{{Type: severityType, Score: vector}}
+	}
+	vuln.DBSpecific.Severity = advisory
+	return vuln
+}
+
+func TestSeverityLevel(t *testing.T) {
+	tests := []struct {
+		name       string
+		vuln       models.Vulnerability
+		wantLevel  string
+		wantRating string
+	}{
+		{
+			name:       "network confidentiality only",
+			vuln:       cvssVuln("CVSS_V3", "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:N/A:N", ""),
+			wantLevel:  "High",
+			wantRating: "7.5/10",
+		},
+		{
+			name:       "high attack complexity, low confidentiality",
+			vuln:       cvssVuln("CVSS_V3", "CVSS:3.1/AV:N/AC:H/PR:N/UI:N/S:U/C:L/I:N/A:N", ""),
+			wantLevel:  "Low",
+			wantRating: "3.7/10",
+		},
+		{
+			name:       "full impact over the network",
+			vuln:       cvssVuln("CVSS_V3", "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", ""),
+			wantLevel:  "Critical",
+			wantRating: "9.8/10",
+		},
+		{
+			name:       "reflected XSS with changed scope",
+			vuln:       cvssVuln("CVSS_V3", "CVSS:3.0/AV:N/AC:L/PR:N/UI:R/S:C/C:L/I:L/A:N", ""),
+			wantLevel:  "Medium",
+			wantRating: "6.1/10",
+		},
+		{
+			name:       "CVSS v2 vector",
+			vuln:       cvssVuln("CVSS_V2", "AV:N/AC:L/Au:N/C:P/I:P/A:P", ""),
+			wantLevel:  "High",
+			wantRating: "7.5/10",
+		},
+		{
+			name:       "computed score over the advisory's own severity",
+			vuln:       cvssVuln("CVSS_V3", "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:N/A:N", "MODERATE"),
+			wantLevel:  "High",
+			wantRating: "7.5/10",
+		},
+		{
+			name:       "unscored CVSS v4 vector",
+			vuln:       cvssVuln("CVSS_V4", "CVSS:4.0/AV:N/AC:L/AT:N/PR:N/UI:N/VC:H/VI:H/VA:H/SC:N/SI:N/SA:N", "HIGH"),
+			wantLevel:  "High",
+			wantRating: "7.0-8.9/10",
+		},
+		{
+			name:       "invalid vector",
+			vuln:       cvssVuln("CVSS_V3", "CVSS:3.1/AV:N/AC:L", "LOW"),
+			wantLevel:  "Low",
+			wantRating: "0.1-3.9/10",
+		},
+		{
+			name:       "advisory severity only",
+			vuln:       cvssVuln("", "", "MODERATE"),
+			wantLevel:  "Medium",
+			wantRating: "4.0-6.9/10",
+		},
+		{
+			name:       "no severity",
+			vuln:       cvssVuln("", "", ""),
+			wantLevel:  "Unknown",
+			wantRating: "Unknown",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SeverityLevel(tt.vuln); got != tt.wantLevel {
+				t.Errorf("SeverityLevel() = %q, want %q", got, tt.wantLevel)
+			}
+			if got := osv.GetSeverityRating(tt.vuln); got != tt.wantRating {
+				t.Errorf("GetSeverityRating() = %q, want %q", got, tt.wantRating)
+			}
+		})
+	}
+}
+
+func TestCountAtLeast(t *testing.T) {
+	var totals ScanTotals
+	totals.Add([]string{
+		SeverityLevel(cvssVuln("CVSS_V3", "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:N/A:N", "")),
+		SeverityLevel(cvssVuln("CVSS_V3", "CVSS:3.1/AV:N/AC:H/PR:N/UI:N/S:U/C:L/I:N/A:N", "")),
+	})
+	totals.Add(nil)
+
+	tests := []struct {
+		threshold string
+		want      int
+	}{
+		{threshold: "critical", want: 0},
+		{threshold: "high", want: 1},
+		{threshold: "medium", want: 1},
+		{threshold: "low", want: 2},
+		{threshold: "any", want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.threshold, func(t *testing.T) {
+			got, err := totals.CountAtLeast(tt.threshold)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("CountAtLeast(%q) = %d, want %d", tt.threshold, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := totals.CountAtLeast("severe"); err == nil {
+		t.Error("CountAtLeast(\"severe\") = nil error, want an error")
+	}
+}
@@ -0,0 +1,97 @@
+package reporting
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Translations overrides the text of the HTML report, keyed by the names in
+// defaultTranslations. Keys it does not have are rendered in English.
+type Translations map[string]string
+
+// defaultTranslations is the English text of the HTML report. {time}, {duration},
+// {shown} and {total} are replaced with their values where they appear.
+var defaultTranslations = Translations{
+	"language":            "en",
+	"title":               "Package Scanner Report",
+	"generated":           "Generated {time} in {duration}",
+	"packages_scanned":    "packages scanned",
+	"vulnerable_packages": "vulnerable packages",
+	"clean_packages":      "clean packages",
+	"findings":            "findings",
+	"search":              "Search",
+	"search_placeholder":  "Search package, ID, alias, CWE, summary, location or checksum",
+	"severity_filter":     "Severity:",
+	"ecosystem_filter":    "Ecosystem:",
+	"all_ecosystems":      "All",
+	"package_filter":      "Package:",
+	"package_placeholder": "Name",
+	"showing":             "Showing {shown} of {total}",
+	"no_matches":          "No findings match the filters.",
+	"no_findings":         "No vulnerabilities found.",
+	"column.severity":     "Severity",
+	"column.package":      "Package",
+	"column.version":      "Version",
+	"column.ecosystem":    "Ecosystem",
+	"column.id":           "Vulnerability",
+	"column.summary":      "Summary",
+	"column.published":    "Published",
+	"column.fix":          "Fixed in",
+	"column.location":     "Location",
+	"upgrade_to":          "Upgrade to",
+	"advisory_link":       "Advisory",
+	"fix_link":            "Fix",
+	"severity.critical":   "Critical",
+	"severity.high":       "High",
+	"severity.medium":     "Medium",
+	"severity.low":        "Low",
+	"severity.unknown":    "Unknown",
+}
+
+// LoadTranslations reads a YAML or JSON file of report text keyed by the names in
+// TranslationKeys, so reports can be delivered in another language. Unknown keys are
+// rejected, so a misspelt key is not silently rendered in English.
+func LoadTranslations(path string) (Translations, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading report translations: %w", err)
+	}
+	var translations Translations
+	if err := yaml.Unmarshal(data, &translations); err != nil {
+		return nil, fmt.Errorf("error parsing report translations %s: %w", path, err)
+	}
+	for key := range translations {
+		if _, ok := defaultTranslations[key]; !ok {
+			return nil, fmt.Errorf("unknown report translation key %q in %s (available: %s)",
+				key, path, strings.Join(TranslationKeys(), ", "))
+		}
+	}
+	return translations, nil
+}
+
+// TranslationKeys returns the keys of the report text that can be translated, sorted
+func TranslationKeys() []string {
+	keys := make([]string, 0, len(defaultTranslations))
+	for key := range defaultTranslations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// text returns the translation of a key, or its English text if there is none
+func (t Translations) text(key string) string {
+	if text, ok := t[key]; ok && text != "" {
+		return text
+	}
+	return defaultTranslations[key]
+}
+
+// severity returns the label of one of the severityLevels
+func (t Translations) severity(level string) string {
+	return t.text("severity." + strings.ToLower(level))
+}
@@ -0,0 +1,106 @@
+package reporting
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/db"
+)
+
+//go:embed trend_report.tmpl
+var trendReportTemplate string
+
+// Trend is the history of the findings of each scanned target, built from the scan runs
+// stored in the database, to show whether the targets are getting better over time
+type Trend struct {
+	GeneratedAt time.Time     `json:"generated_at"`
+	Since       time.Time     `json:"since"`
+	Interval    string        `json:"interval"`
+	Targets     []TargetTrend `json:"targets"`
+}
+
+// TargetTrend is the findings of a target in every period it was scanned, oldest first
+type TargetTrend struct {
+	Target string          `json:"target"`
+	Points []db.TrendPoint `json:"points"`
+	// Peak is the most findings of the target in any period
+	Peak int `json:"peak"`
+	// Change is the difference between the last period and the first, negative when
+	// findings went down
+	Change TrendChange `json:"change"`
+}
+
+// TrendChange is the change in findings of a target over the trend
+type TrendChange struct {
+	Vulnerabilities int `json:"vulnerabilities"`
+	Critical        int `json:"critical"`
+	High            int `json:"high"`
+}
+
+// BuildTrend groups trend points, ordered by target and period, into the trend of each target
+func BuildTrend(points []db.TrendPoint, since time.Time, interval string) Trend {
+	trend := Trend{GeneratedAt: time.Now(), Since: since, Interval: interval, Targets: []TargetTrend{}}
+	for _, point := range points {
+		if n := len(trend.Targets); n == 0 || trend.Targets[n-1].Target != point.Target {
+			trend.Targets = append(trend.Targets, TargetTrend{Target: point.Target})
+		}
+		target := &trend.Targets[len(trend.Targets)-1]
+		target.Points = append(target.Points, point)
+		target.Peak = max(target.Peak, point.Vulnerabilities)
+	}
+	for i := range trend.Targets {
+		target := &trend.Targets[i]
+		first, last := target.Points[0], target.Points[len(target.Points)-1]
+		target.Change = TrendChange{
+			Vulnerabilities: last.Vulnerabilities - first.Vulnerabilities,
+			Critical:        last.Severities.Critical - first.Severities.Critical,
+			High:            last.Severities.High - first.Severities.High,
+		}
+	}
+	return trend
+}
+
+// WriteJSON writes the trend as an indented JSON document
+func (t Trend) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(t); err != nil {
+		return fmt.Errorf("error writing trend: %w", err)
+	}
+	return nil
+}
+
+// WriteHTML writes the trend as a self-contained HTML page
+func (t Trend) WriteHTML(w io.Writer) error {
+	layout := "2006-01-02"
+	if t.Interval == "month" {
+		layout = "2006-01"
+	}
+	tmpl, err := template.New("trend").Funcs(template.FuncMap{
+		"period": func(period time.Time) string { return period.Format(layout) },
+		// bar scales the findings of a period to a bar of at most 200 pixels
+		"bar": func(n, peak int) int {
+			if peak == 0 {
+				return 0
+			}
+			return n * 200 / peak
+		},
+		"signed": func(n int) string {
+			if n > 0 {
+				return fmt.Sprintf("+%d", n)
+			}
+			return fmt.Sprint(n)
+		},
+	}).Parse(trendReportTemplate)
+	if err != nil {
+		return fmt.Errorf("error parsing trend template: %w", err)
+	}
+	if err := tmpl.Execute(w, t); err != nil {
+		return fmt.Errorf("error writing trend: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package reporting
+
+import (
+	"github.com/squarehole/package-scanner/pkg/models"
+)
+
+// PackageResult is the outcome of checking one package, as handed to report writers
+type PackageResult struct {
+	Name      string
+	Version   string
+	Ecosystem string
+	// Location is the file or target the package was found in; empty for a single package
+	Location string
+	// Checksum is the SHA-256 of the package's artifact, when it is known
+	Checksum string
+	// Vulnerabilities are those left after VEX statements, the policy and the baseline
+	Vulnerabilities []models.Vulnerability
+	// Hints are key/value pairs describing the package, such as whether it is imported
+	// by the project's code or is a transitive dependency
+	Hints []any
+}
+
+// ReportWriter receives the results of a scan as it runs: Start before the first
+// package is checked, WritePackageResult once for every checked package, and Finish
+// with the scan's totals after the last. The controller calls its writers from one
+// goroutine at a time, in the order they were added, and stops the run at the first
+// error one returns. Console output is a ReportWriter; embedders add their own with
+// scanner.WithReportWriter.
+type ReportWriter interface {
+	Start() error
+	WritePackageResult(result PackageResult) error
+	Finish(totals ScanTotals) error
+}
+
+// ConsoleWriter is the ReportWriter logging the results of each package through a
+// Reporter, and the scan's totals at the end
+type ConsoleWriter struct {
+	reporter *Reporter
+}
+
+// NewConsoleWriter creates a console writer logging through reporter
+func NewConsoleWriter(reporter *Reporter) *ConsoleWriter {
+	return &ConsoleWriter{reporter: reporter}
+}
+
+// Start does nothing; the console has nothing to write before the first package
+func (w *ConsoleWriter) Start() error {
+	return nil
+}
+
+// WritePackageResult logs the vulnerabilities of a package and counts them towards the
+// reporter's totals
+func (w *ConsoleWriter) WritePackageResult(result PackageResult) error {
+	w.reporter.DisplayResults(models.ScanResults{Vulnerabilities: result.Vulnerabilities}, result.Name, result.Version, result.Ecosystem, result.Hints...)
+	return nil
+}
+
+// Finish logs the reporter's totals, which are those of the packages it was given
+func (w *ConsoleWriter) Finish(ScanTotals) error {
+	w.reporter.DisplayTotals()
+	return nil
+}
@@ -0,0 +1,518 @@
+package resolve
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/squarehole/package-scanner/pkg/version"
+)
+
+// maxParentDepth bounds parent and BOM chains, which could otherwise loop
+const maxParentDepth = 16
+
+// pom is the subset of a Maven POM used for resolving
+type pom struct {
+	GroupID    string `xml:"groupId"`
+	ArtifactID string `xml:"artifactId"`
+	Version    string `xml:"version"`
+	Parent     *struct {
+		GroupID    string `xml:"groupId"`
+		ArtifactID string `xml:"artifactId"`
+		Version    string `xml:"version"`
+		// RelativePath locates the parent in a source tree; an empty element means the
+		// parent is only looked up in the repository
+		RelativePath *string `xml:"relativePath"`
+	} `xml:"parent"`
+	Properties           pomProperties   `xml:"properties"`
+	DependencyManagement []pomDependency `xml:"dependencyManagement>dependencies>dependency"`
+	Dependencies         []pomDependency `xml:"dependencies>dependency"`
+}
+
+// pomDependency is a dependency, or a managed dependency, declared in a POM
+type pomDependency struct {
+	GroupID    string         `xml:"groupId"`
+	ArtifactID string         `xml:"artifactId"`
+	Version    string         `xml:"version"`
+	Type       string         `xml:"type"`
+	Scope      string         `xml:"scope"`
+	Optional   string         `xml:"optional"`
+	Exclusions []pomExclusion `xml:"exclusions>exclusion"`
+}
+
+// pomExclusion leaves a dependency's transitive dependency out, * matching any name
+type pomExclusion struct {
+	GroupID    string `xml:"groupId"`
+	ArtifactID string `xml:"artifactId"`
+}
+
+// key identifies a dependency regardless of its version
+func (d pomDependency) key() string {
+	return d.GroupID + ":" + d.ArtifactID
+}
+
+// pomProperties holds the <properties> of a POM by element name
+type pomProperties map[string]string
+
+// UnmarshalXML reads each child element of <properties> as a property
+func (p *pomProperties) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	*p = make(pomProperties)
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			var value string
+			if err := d.DecodeElement(&value, &t); err != nil {
+				return err
+			}
+			(*p)[t.Name.Local] = strings.TrimSpace(value)
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// model is an effective POM: a POM merged with its parents, its properties
+// interpolated and its imported BOMs expanded into the managed dependencies
+type model struct {
+	groupID    string
+	artifactID string
+	version    string
+	properties map[string]string
+	// managed are the managed dependencies by key
+	managed map[string]pomDependency
+	// imports are the BOMs imported into the dependency management, in the order
+	// they take precedence
+	imports      []pomDependency
+	dependencies []pomDependency
+}
+
+// pomEntry is a cached POM fetched from the repository
+type pomEntry struct {
+	once sync.Once
+	data []byte
+	err  error
+}
+
+// mavenRequest is a dependency waiting to be resolved
+type mavenRequest struct {
+	dependency pomDependency
+	// via is the direct dependency the request descends from, empty for direct ones
+	via string
+	dev bool
+	// exclusions are those of every dependency on the path to the request
+	exclusions []pomExclusion
+}
+
+// propertyPattern matches a ${property} reference
+var propertyPattern = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// resolveMaven resolves pom.xml the way Maven does: the nearest declaration of an
+// artifact wins, the project's dependency management also applies to transitive
+// dependencies, and only the compile and runtime dependencies of a dependency are
+// pulled in. Test dependencies are walked last and marked as dev.
+func (r *Resolver) resolveMaven(path string) ([]Dependency, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	root, err := r.effectiveModel(data, filepath.Dir(path), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var production, test []mavenRequest
+	for _, dep := range root.dependencies {
+		dep = root.manage(dep)
+		switch dep.Scope {
+		case "system", "import":
+			continue
+		case "test":
+			test = append(test, mavenRequest{dependency: dep, dev: true})
+		default:
+			production = append(production, mavenRequest{dependency: dep})
+		}
+	}
+
+	var deps []Dependency
+	seen := make(map[string]bool)
+	r.walkMaven(production, root, seen, &deps)
+	if !r.SkipDev {
+		r.walkMaven(test, root, seen, &deps)
+	}
+	return deps, nil
+}
+
+// walkMaven resolves requests breadth first, adding the first version of each
+// artifact reached to deps
+func (r *Resolver) walkMaven(level []mavenRequest, root *model, seen map[string]bool, deps *[]Dependency) {
+	for len(level) > 0 {
+		var coordinates []string
+		for _, req := range level {
+			dep := req.dependency
+			if !seen[dep.key()] && isConcreteMavenVersion(dep.Version) {
+				coordinates = append(coordinates, dep.key()+":"+dep.Version)
+			}
+		}
+		prefetch(coordinates, func(coordinate string) {
+			parts := strings.Split(coordinate, ":")
+			r.pomData(parts[0], parts[1], parts[2])
+		})
+
+		var next []mavenRequest
+		for _, req := range level {
+			dep := req.dependency
+			if seen[dep.key()] {
+				continue
+			}
+			resolved, ok := r.mavenVersion(dep)
+			if !ok {
+				continue
+			}
+			seen[dep.key()] = true
+			*deps = append(*deps, Dependency{
+				Name:      dep.key(),
+				Version:   resolved,
+				Ecosystem: "Maven",
+				Dev:       req.dev,
+				Direct:    req.via == "",
+				Via:       req.via,
+			})
+
+			data, err := r.pomData(dep.GroupID, dep.ArtifactID, resolved)
+			if err == nil {
+				var m *model
+				if m, err = r.effectiveModel(data, "", 0); err == nil {
+					next = append(next, transitiveRequests(req, m, root)...)
+					continue
+				}
+			}
+			r.warn("Could not read the dependencies of %s:%s: %v", dep.key(), resolved, err)
+		}
+		level = next
+	}
+}
+
+// transitiveRequests returns the dependencies a resolved artifact pulls in: its
+// compile and runtime dependencies that are neither optional nor excluded
+func transitiveRequests(req mavenRequest, m *model, root *model) []mavenRequest {
+	via := req.via
+	if via == "" {
+		via = req.dependency.key()
+	}
+	exclusions := append(slices.Clip(req.exclusions), req.dependency.Exclusions...)
+
+	var requests []mavenRequest
+	for _, dep := range m.dependencies {
+		dep = m.manage(dep)
+		if dep.Scope != "compile" && dep.Scope != "runtime" || dep.Optional == "true" || excluded(dep, exclusions) {
+			continue
+		}
+		// The project's dependency management overrides the versions dependencies ask for
+		if managed, ok := root.managed[dep.key()]; ok && managed.Version != "" {
+			dep.Version = managed.Version
+		}
+		requests = append(requests, mavenRequest{dependency: dep, via: via, dev: req.dev, exclusions: exclusions})
+	}
+	return requests
+}
+
+// excluded reports whether an exclusion on the path leaves the dependency out
+func excluded(dep pomDependency, exclusions []pomExclusion) bool {
+	for _, e := range exclusions {
+		if (e.GroupID == "*" || e.GroupID == dep.GroupID) && (e.ArtifactID == "*" || e.ArtifactID == dep.ArtifactID) {
+			return true
+		}
+	}
+	return false
+}
+
+// manage fills in the version and scope of a dependency from the model's dependency
+// management, the scope defaulting to compile
+func (m *model) manage(dep pomDependency) pomDependency {
+	if managed, ok := m.managed[dep.key()]; ok {
+		if dep.Version == "" {
+			dep.Version = managed.Version
+		}
+		if dep.Scope == "" {
+			dep.Scope = managed.Scope
+		}
+		if len(dep.Exclusions) == 0 {
+			dep.Exclusions = managed.Exclusions
+		}
+	}
+	if dep.Scope == "" {
+		dep.Scope = "compile"
+	}
+	return dep
+}
+
+// mavenVersion returns the version a dependency resolves to, picking the highest
+// release a version range allows
+func (r *Resolver) mavenVersion(dep pomDependency) (string, bool) {
+	switch {
+	case dep.Version == "" || strings.Contains(dep.Version, "${"):
+		r.warn("Skipping %s, whose version %q could not be determined", dep.key(), dep.Version)
+		return "", false
+	case isConcreteMavenVersion(dep.Version):
+		return dep.Version, true
+	}
+
+	release := r.acquire("maven")
+	releases, err := r.registry.GetReleases(dep.key(), "Maven")
+	release()
+	if err != nil {
+		r.warn("Could not resolve %s:%s: %v", dep.key(), dep.Version, err)
+		return "", false
+	}
+	best := ""
+	for _, v := range releases.Versions {
+		if !strings.HasSuffix(v, "-SNAPSHOT") && inMavenRange(v, dep.Version) && (best == "" || version.CompareMaven(v, best) > 0) {
+			best = v
+		}
+	}
+	if best == "" {
+		r.warn("No published version of %s matches %s", dep.key(), dep.Version)
+		return "", false
+	}
+	return best, true
+}
+
+// isConcreteMavenVersion reports whether a version is a single version rather than a range
+func isConcreteMavenVersion(v string) bool {
+	return v != "" && !strings.ContainsAny(v, "[]()${")
+}
+
+// mavenRangePattern matches one set of a Maven version range, such as [1.0,2.0)
+var mavenRangePattern = regexp.MustCompile(`[\[(][^\])]*[\])]`)
+
+// inMavenRange reports whether a version falls in any set of a Maven version range
+func inMavenRange(v, spec string) bool {
+	for _, set := range mavenRangePattern.FindAllString(spec, -1) {
+		bounds := set[1 : len(set)-1]
+		lower, upper, isRange := strings.Cut(bounds, ",")
+		if !isRange {
+			if version.CompareMaven(v, strings.TrimSpace(bounds)) == 0 {
+				return true
+			}
+			continue
+		}
+		lower, upper = strings.TrimSpace(lower), strings.TrimSpace(upper)
+		if lower != "" {
+			cmp := version.CompareMaven(v, lower)
+			if cmp < 0 || cmp == 0 && set[0] == '(' {
+				continue
+			}
+		}
+		if upper != "" {
+			cmp := version.CompareMaven(v, upper)
+			if cmp > 0 || cmp == 0 && set[len(set)-1] == ')' {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// pomData returns the POM of an artifact version from the repository, fetching it once
+func (r *Resolver) pomData(groupID, artifactID, version string) ([]byte, error) {
+	key := groupID + ":" + artifactID + ":" + version
+	r.mu.Lock()
+	entry, ok := r.poms[key]
+	if !ok {
+		entry = &pomEntry{}
+		r.poms[key] = entry
+	}
+	r.mu.Unlock()
+
+	entry.once.Do(func() {
+		defer r.acquire("maven")()
+		entry.data, entry.err = r.registry.GetMavenPOM(groupID, artifactID, version)
+	})
+	return entry.data, entry.err
+}
+
+// effectiveModel builds the effective model of a POM. Dir is the directory of a POM
+// in a source tree, whose parents are looked for there first, or empty for a POM
+// from the repository.
+func (r *Resolver) effectiveModel(data []byte, dir string, depth int) (*model, error) {
+	m, err := r.inheritedModel(data, dir, depth)
+	if err != nil {
+		return nil, err
+	}
+	m.interpolate()
+	if err := r.importBOMs(m, depth); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// inheritedModel parses a POM and merges it with its parents, without interpolating
+// properties, so those a POM declares apply to what it inherits
+func (r *Resolver) inheritedModel(data []byte, dir string, depth int) (*model, error) {
+	if depth > maxParentDepth {
+		return nil, fmt.Errorf("parent POMs nested more than %d deep", maxParentDepth)
+	}
+	var p pom
+	if err := xml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("error parsing POM: %w", err)
+	}
+
+	m := &model{
+		groupID:    p.GroupID,
+		artifactID: p.ArtifactID,
+		version:    p.Version,
+		properties: make(map[string]string),
+		managed:    make(map[string]pomDependency),
+	}
+	if p.Parent != nil {
+		parent, err := r.parentModel(p.Parent.GroupID, p.Parent.ArtifactID, p.Parent.Version, p.Parent.RelativePath, dir, depth)
+		if err != nil {
+			return nil, fmt.Errorf("error reading parent %s:%s:%s: %w", p.Parent.GroupID, p.Parent.ArtifactID, p.Parent.Version, err)
+		}
+		if m.groupID == "" {
+			m.groupID = parent.groupID
+		}
+		if m.version == "" {
+			m.version = parent.version
+		}
+		m.properties = parent.properties
+		m.properties["project.parent.groupId"] = p.Parent.GroupID
+		m.properties["project.parent.version"] = p.Parent.Version
+		m.managed = parent.managed
+		m.imports = parent.imports
+		m.dependencies = parent.dependencies
+	}
+
+	for name, value := range p.Properties {
+		m.properties[name] = value
+	}
+	var imports []pomDependency
+	for _, dep := range p.DependencyManagement {
+		if dep.Scope == "import" {
+			imports = append(imports, dep)
+			continue
+		}
+		m.managed[dep.key()] = dep
+	}
+	m.imports = append(imports, m.imports...)
+	// A dependency declared again replaces the inherited declaration
+	for _, dep := range p.Dependencies {
+		m.dependencies = slices.DeleteFunc(m.dependencies, func(inherited pomDependency) bool {
+			return inherited.key() == dep.key()
+		})
+		m.dependencies = append(m.dependencies, dep)
+	}
+	return m, nil
+}
+
+// parentModel returns the inherited model of a parent POM, read from the source tree
+// when it is found at its relative path and from the repository otherwise
+func (r *Resolver) parentModel(groupID, artifactID, version string, relativePath *string, dir string, depth int) (*model, error) {
+	if dir != "" && (relativePath == nil || *relativePath != "") {
+		path := "../pom.xml"
+		if relativePath != nil {
+			path = *relativePath
+		}
+		path = filepath.Join(dir, path)
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			path = filepath.Join(path, "pom.xml")
+		}
+		if data, err := os.ReadFile(path); err == nil {
+			parent, err := r.inheritedModel(data, filepath.Dir(path), depth+1)
+			if err == nil && parent.groupID == groupID && parent.artifactID == artifactID && (version == "" || parent.version == version) {
+				return parent, nil
+			}
+		}
+	}
+
+	data, err := r.pomData(groupID, artifactID, version)
+	if err != nil {
+		return nil, err
+	}
+	return r.inheritedModel(data, "", depth+1)
+}
+
+// interpolate replaces property references in the coordinates of the model's
+// dependencies and managed dependencies
+func (m *model) interpolate() {
+	m.properties["project.groupId"] = m.groupID
+	m.properties["project.artifactId"] = m.artifactID
+	m.properties["project.version"] = m.version
+	m.properties["pom.groupId"] = m.groupID
+	m.properties["pom.version"] = m.version
+
+	resolve := func(dep pomDependency) pomDependency {
+		dep.GroupID = m.expand(dep.GroupID)
+		dep.ArtifactID = m.expand(dep.ArtifactID)
+		dep.Version = m.expand(dep.Version)
+		dep.Scope = m.expand(dep.Scope)
+		dep.Type = m.expand(dep.Type)
+		dep.Optional = m.expand(dep.Optional)
+		return dep
+	}
+	managed := make(map[string]pomDependency, len(m.managed))
+	for _, dep := range m.managed {
+		dep = resolve(dep)
+		managed[dep.key()] = dep
+	}
+	m.managed = managed
+	for i, dep := range m.imports {
+		m.imports[i] = resolve(dep)
+	}
+	for i, dep := range m.dependencies {
+		m.dependencies[i] = resolve(dep)
+	}
+}
+
+// expand replaces property references in a value, following references to other
+// properties; unknown properties are left in place
+func (m *model) expand(value string) string {
+	for range maxParentDepth {
+		expanded := propertyPattern.ReplaceAllStringFunc(value, func(reference string) string {
+			if v, ok := m.properties[reference[2:len(reference)-1]]; ok {
+				return v
+			}
+			return reference
+		})
+		if expanded == value {
+			break
+		}
+		value = expanded
+	}
+	return strings.TrimSpace(value)
+}
+
+// importBOMs adds the managed dependencies of the BOMs the model imports, after its
+// own, so a version the model manages itself wins, and the first BOM managing an
+// artifact wins over later ones
+func (r *Resolver) importBOMs(m *model, depth int) error {
+	for _, dep := range m.imports {
+		if dep.Type != "pom" {
+			continue
+		}
+		data, err := r.pomData(dep.GroupID, dep.ArtifactID, dep.Version)
+		if err != nil {
+			return fmt.Errorf("error reading imported BOM %s:%s: %w", dep.key(), dep.Version, err)
+		}
+		bom, err := r.effectiveModel(data, "", depth+1)
+		if err != nil {
+			return fmt.Errorf("error reading imported BOM %s:%s: %w", dep.key(), dep.Version, err)
+		}
+		for key, managed := range bom.managed {
+			if _, ok := m.managed[key]; !ok {
+				m.managed[key] = managed
+			}
+		}
+	}
+	return nil
+}
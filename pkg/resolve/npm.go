@@ -0,0 +1,200 @@
+package resolve
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/squarehole/package-scanner/pkg/registry"
+)
+
+// packageJSON is the subset of package.json used for resolving
+type packageJSON struct {
+	Dependencies         map[string]string `json:"dependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+	DevDependencies      map[string]string `json:"devDependencies"`
+}
+
+// npmEntry is a cached npm package document
+type npmEntry struct {
+	once sync.Once
+	doc  registry.NpmPackage
+	err  error
+}
+
+// npmRequest is a dependency range waiting to be resolved
+type npmRequest struct {
+	name string
+	spec string
+	// via is the direct dependency the request descends from, empty for direct ones
+	via string
+	dev bool
+}
+
+// resolveNpm resolves package.json the way npm installs it: each range to the
+// highest published version it allows, preferring the latest tag. Production
+// dependencies are walked first, so packages that are also pulled in by development
+// dependencies are not marked as dev.
+func (r *Resolver) resolveNpm(path string) ([]Dependency, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var manifest packageJSON
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+
+	production := maps.Clone(manifest.Dependencies)
+	if production == nil {
+		production = make(map[string]string)
+	}
+	maps.Copy(production, manifest.OptionalDependencies)
+
+	var deps []Dependency
+	index := make(map[string]int)
+	passes := []struct {
+		ranges map[string]string
+		dev    bool
+	}{{production, false}, {manifest.DevDependencies, true}}
+	for _, pass := range passes {
+		if pass.dev && r.SkipDev {
+			continue
+		}
+		var level []npmRequest
+		for _, name := range slices.Sorted(maps.Keys(pass.ranges)) {
+			level = append(level, npmRequest{name: name, spec: pass.ranges[name], dev: pass.dev})
+		}
+		r.walkNpm(level, index, &deps)
+	}
+	return deps, nil
+}
+
+// walkNpm resolves requests breadth first, adding each package version reached to
+// deps once and recording its position in index
+func (r *Resolver) walkNpm(level []npmRequest, index map[string]int, deps *[]Dependency) {
+	for len(level) > 0 {
+		var names []string
+		for i := range level {
+			name, spec, ok := npmAlias(level[i].name, level[i].spec)
+			level[i].name, level[i].spec = name, spec
+			if ok && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+		prefetch(names, func(name string) { r.npmPackage(name) })
+
+		var next []npmRequest
+		for _, req := range level {
+			if !isRegistrySpec(req.spec) {
+				r.warn("Skipping %s@%s, which is not resolved from the registry", req.name, req.spec)
+				continue
+			}
+			doc, err := r.npmPackage(req.name)
+			if err != nil {
+				r.warn("Could not resolve %s@%s: %v", req.name, req.spec, err)
+				continue
+			}
+			resolved, ok := resolveNpmVersion(doc, req.spec)
+			if !ok {
+				r.warn("No published version of %s matches %s", req.name, req.spec)
+				continue
+			}
+
+			key := req.name + "@" + resolved
+			if i, ok := index[key]; ok {
+				(*deps)[i].Direct = (*deps)[i].Direct || req.via == ""
+				continue
+			}
+			index[key] = len(*deps)
+			*deps = append(*deps, Dependency{
+				Name:      req.name,
+				Version:   resolved,
+				Ecosystem: "npm",
+				Dev:       req.dev,
+				Direct:    req.via == "",
+				Via:       req.via,
+			})
+
+			via := req.via
+			if via == "" {
+				via = req.name
+			}
+			manifest := doc.Versions[resolved]
+			ranges := maps.Clone(manifest.Dependencies)
+			if ranges == nil {
+				ranges = make(map[string]string)
+			}
+			maps.Copy(ranges, manifest.OptionalDependencies)
+			for _, name := range slices.Sorted(maps.Keys(ranges)) {
+				next = append(next, npmRequest{name: name, spec: ranges[name], via: via, dev: req.dev})
+			}
+		}
+		level = next
+	}
+}
+
+// npmPackage returns the package document of an npm package, fetching it once
+func (r *Resolver) npmPackage(name string) (registry.NpmPackage, error) {
+	r.mu.Lock()
+	entry, ok := r.npm[name]
+	if !ok {
+		entry = &npmEntry{}
+		r.npm[name] = entry
+	}
+	r.mu.Unlock()
+
+	entry.once.Do(func() {
+		defer r.acquire("npm")()
+		entry.doc, entry.err = r.registry.GetNpmPackage(name)
+	})
+	return entry.doc, entry.err
+}
+
+// npmAlias returns the registry package and range an "npm:" alias stands for
+func npmAlias(name, spec string) (string, string, bool) {
+	target, ok := strings.CutPrefix(spec, "npm:")
+	if !ok {
+		return name, spec, isRegistrySpec(spec)
+	}
+	// The version separator follows the scope's leading @, if any
+	if at := strings.LastIndex(target, "@"); at > 0 {
+		return target[:at], target[at+1:], true
+	}
+	return target, "*", true
+}
+
+// isRegistrySpec reports whether a dependency specifier is a version range or tag,
+// rather than a git repository, URL, local path or workspace reference
+func isRegistrySpec(spec string) bool {
+	for _, prefix := range []string{"git", "http:", "https:", "file:", "link:", "workspace:", "github:", "gitlab:", "bitbucket:", ".", "/"} {
+		if strings.HasPrefix(spec, prefix) {
+			return false
+		}
+	}
+	// GitHub shorthand, such as user/repo#branch
+	return !strings.Contains(spec, "/")
+}
+
+// resolveNpmVersion picks the version npm installs for a range or dist-tag: the latest
+// tag when the range allows it, otherwise the highest version the range allows
+func resolveNpmVersion(doc registry.NpmPackage, spec string) (string, bool) {
+	spec = strings.TrimSpace(spec)
+	if tagged, ok := doc.DistTags[spec]; ok {
+		return tagged, true
+	}
+
+	r, err := parseRange(spec)
+	if err != nil {
+		return "", false
+	}
+	if latest, ok := doc.DistTags["latest"]; ok && r.satisfiedBy(latest) {
+		if _, published := doc.Versions[latest]; published {
+			return latest, true
+		}
+	}
+	return r.maxSatisfying(slices.Collect(maps.Keys(doc.Versions)))
+}
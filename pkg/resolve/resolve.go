@@ -0,0 +1,177 @@
+// Package resolve resolves the full dependency graph of manifests that are scanned
+// without a lockfile, such as package.json and pom.xml, from registry metadata
+package resolve
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/squarehole/package-scanner/pkg/lockfile"
+	"github.com/squarehole/package-scanner/pkg/registry"
+)
+
+// resolveConcurrency is the number of registry documents fetched at once
+const resolveConcurrency = 8
+
+// Dependency is a package version in the resolved dependency graph of a manifest
+type Dependency struct {
+	Name      string
+	Version   string
+	Ecosystem string
+	// Dev marks dependencies only needed for development, and everything they pull in
+	Dev bool
+	// Direct marks dependencies declared in the manifest itself
+	Direct bool
+	// Via is the direct dependency a transitive dependency is pulled in through
+	Via string
+}
+
+// resolveFunc resolves the dependency graph of a manifest
+type resolveFunc func(r *Resolver, path string) ([]Dependency, error)
+
+// manifests maps supported manifest names to their resolvers
+var manifests = map[string]resolveFunc{
+	"package.json": (*Resolver).resolveNpm,
+	"pom.xml":      (*Resolver).resolveMaven,
+}
+
+// lockedBy maps manifest names to the lockfiles that record their resolved dependencies.
+// A manifest next to one of them needs no resolving, as the lockfile is scanned instead.
+var lockedBy = map[string][]string{
+	"package.json": {"package-lock.json", "npm-shrinkwrap.json"},
+}
+
+// IsManifest reports whether a file name is a manifest whose dependencies can be resolved
+func IsManifest(name string) bool {
+	_, ok := manifests[filepath.Base(name)]
+	return ok
+}
+
+// IsLocked reports whether a manifest has a lockfile next to it
+func IsLocked(path string) bool {
+	for _, name := range lockedBy[filepath.Base(path)] {
+		if _, err := os.Stat(filepath.Join(filepath.Dir(path), name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns the manifests below a directory that have no lockfile next to them.
+// Installed dependency trees are skipped, as for lockfile searches.
+func Find(dir string) ([]string, error) {
+	var found []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && lockfile.IsDependencyDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if IsManifest(d.Name()) && !IsLocked(path) {
+			found = append(found, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error searching %s for manifests: %w", dir, err)
+	}
+	return found, nil
+}
+
+// Resolver resolves manifests against their native registries. Registry documents
+// are cached, so manifests sharing dependencies fetch them once. It is safe for
+// concurrent use.
+type Resolver struct {
+	registry *registry.Client
+	// SkipDev leaves out development dependencies (npm devDependencies, Maven test scope)
+	SkipDev bool
+	// Acquire, when set, is called before each registry request with the ecosystem
+	// queried and returns a function to call once the request has finished
+	Acquire func(ecosystem string) func()
+	// Warn, when set, reports dependencies that could not be resolved and were left out
+	Warn func(format string, args ...any)
+
+	mu     sync.Mutex
+	npm    map[string]*npmEntry
+	poms   map[string]*pomEntry
+	warned map[string]bool
+}
+
+// NewResolver creates a resolver that reads package metadata from the registry client
+func NewResolver(client *registry.Client) *Resolver {
+	return &Resolver{
+		registry: client,
+		npm:      make(map[string]*npmEntry),
+		poms:     make(map[string]*pomEntry),
+		warned:   make(map[string]bool),
+	}
+}
+
+// Resolve reads a manifest and returns every package version in its resolved dependency
+// graph, each name/version once, sorted by name and version
+func (r *Resolver) Resolve(path string) ([]Dependency, error) {
+	resolve, ok := manifests[filepath.Base(path)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported manifest %s", path)
+	}
+	deps, err := resolve(r, path)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving manifest %s: %w", path, err)
+	}
+
+	sort.Slice(deps, func(i, j int) bool {
+		if deps[i].Name != deps[j].Name {
+			return deps[i].Name < deps[j].Name
+		}
+		return deps[i].Version < deps[j].Version
+	})
+	return deps, nil
+}
+
+// warn reports a dependency left out of the graph, once however often it is reached
+func (r *Resolver) warn(format string, args ...any) {
+	if r.Warn == nil {
+		return
+	}
+	message := fmt.Sprintf(format, args...)
+	r.mu.Lock()
+	seen := r.warned[message]
+	r.warned[message] = true
+	r.mu.Unlock()
+	if !seen {
+		r.Warn("%s", message)
+	}
+}
+
+// acquire waits for a registry request to the ecosystem to be allowed
+func (r *Resolver) acquire(ecosystem string) func() {
+	if r.Acquire == nil {
+		return func() {}
+	}
+	return r.Acquire(ecosystem)
+}
+
+// prefetch calls fetch for each key, resolveConcurrency at a time, so the documents
+// of one level of the graph are fetched in parallel before the level is walked
+func prefetch(keys []string, fetch func(key string)) {
+	sem := make(chan struct{}, resolveConcurrency)
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(key string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fetch(key)
+		}(key)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,250 @@
+package resolve
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/squarehole/package-scanner/pkg/version"
+)
+
+// comparator is a single constraint of an npm version range, such as >=1.2.3
+type comparator struct {
+	op      string
+	version string
+}
+
+// npmRange is a parsed npm version range: alternatives separated by ||, each a set
+// of comparators that must all hold. An empty set matches every version.
+type npmRange [][]comparator
+
+var (
+	// operatorSpace matches the whitespace npm allows between an operator and its version
+	operatorSpace = regexp.MustCompile(`(<=|>=|<|>|=|~>?|\^)\s+`)
+	// partialPattern matches a version of which minor and patch may be missing or
+	// wildcards (x, X or *)
+	partialPattern = regexp.MustCompile(`^v?(\d+|[xX*])(?:\.(\d+|[xX*]))?(?:\.(\d+|[xX*]))?(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+)
+
+// partial is a version with up to three numeric parts; parts is how many were given
+// before the first missing or wildcard one
+type partial struct {
+	numbers    [3]int
+	parts      int
+	prerelease string
+}
+
+// parsePartial parses a version as written in a range
+func parsePartial(s string) (partial, error) {
+	match := partialPattern.FindStringSubmatch(strings.TrimPrefix(s, "="))
+	if match == nil {
+		return partial{}, fmt.Errorf("invalid version %q", s)
+	}
+	var p partial
+	for i := range p.numbers {
+		n, err := strconv.Atoi(match[i+1])
+		if err != nil {
+			break
+		}
+		p.numbers[i] = n
+		p.parts++
+	}
+	if p.parts == 3 {
+		p.prerelease = match[4]
+	}
+	return p, nil
+}
+
+// String formats the lowest version the partial version stands for
+func (p partial) String() string {
+	s := fmt.Sprintf("%d.%d.%d", p.numbers[0], p.numbers[1], p.numbers[2])
+	if p.prerelease != "" {
+		s += "-" + p.prerelease
+	}
+	return s
+}
+
+// bump returns the lowest version above every version the partial version stands
+// for, raising the part at index by one
+func (p partial) bump(index int) string {
+	numbers := p.numbers
+	numbers[index]++
+	for i := index + 1; i < len(numbers); i++ {
+		numbers[i] = 0
+	}
+	return fmt.Sprintf("%d.%d.%d", numbers[0], numbers[1], numbers[2])
+}
+
+// parseRange parses an npm version range
+func parseRange(spec string) (npmRange, error) {
+	var r npmRange
+	for _, alternative := range strings.Split(spec, "||") {
+		set, err := parseComparatorSet(strings.TrimSpace(alternative))
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, set)
+	}
+	return r, nil
+}
+
+// parseComparatorSet parses the space-separated comparators, or the hyphen range,
+// of one alternative
+func parseComparatorSet(s string) ([]comparator, error) {
+	if low, high, ok := strings.Cut(s, " - "); ok {
+		return hyphenRange(strings.TrimSpace(low), strings.TrimSpace(high))
+	}
+
+	set := []comparator{}
+	for _, field := range strings.Fields(operatorSpace.ReplaceAllString(s, "$1")) {
+		comparators, err := parseComparator(field)
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, comparators...)
+	}
+	return set, nil
+}
+
+// hyphenRange expands an inclusive range such as 1.2 - 2.3.4
+func hyphenRange(low, high string) ([]comparator, error) {
+	from, err := parsePartial(low)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parsePartial(high)
+	if err != nil {
+		return nil, err
+	}
+
+	set := []comparator{{">=", from.String()}}
+	switch to.parts {
+	case 0:
+	case 3:
+		set = append(set, comparator{"<=", to.String()})
+	default:
+		set = append(set, comparator{"<", to.bump(to.parts-1) + "-0"})
+	}
+	return set, nil
+}
+
+// parseComparator expands one comparator, caret or tilde range or X-range into
+// primitive comparators
+func parseComparator(s string) ([]comparator, error) {
+	op := ""
+	for _, prefix := range []string{"~>", "~", "^", ">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(s, prefix) {
+			op = prefix
+			break
+		}
+	}
+	p, err := parsePartial(strings.TrimPrefix(s, op))
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "^":
+		if p.parts == 0 {
+			return nil, nil
+		}
+		var upper string
+		switch {
+		case p.numbers[0] > 0 || p.parts == 1:
+			upper = p.bump(0)
+		case p.numbers[1] > 0 || p.parts == 2:
+			upper = p.bump(1)
+		default:
+			upper = p.bump(2)
+		}
+		return []comparator{{">=", p.String()}, {"<", upper + "-0"}}, nil
+	case "~", "~>":
+		if p.parts == 0 {
+			return nil, nil
+		}
+		return []comparator{{">=", p.String()}, {"<", p.bump(min(p.parts-1, 1)) + "-0"}}, nil
+	}
+
+	if p.parts == 0 {
+		if op == "<" || op == ">" {
+			// Nothing is below or above every version
+			return []comparator{{"<", "0.0.0-0"}}, nil
+		}
+		return nil, nil
+	}
+	if p.parts == 3 {
+		if op == "" {
+			op = "="
+		}
+		return []comparator{{op, p.String()}}, nil
+	}
+
+	switch op {
+	case ">":
+		return []comparator{{">=", p.bump(p.parts - 1)}}, nil
+	case ">=":
+		return []comparator{{">=", p.String()}}, nil
+	case "<":
+		return []comparator{{"<", p.String() + "-0"}}, nil
+	case "<=":
+		return []comparator{{"<", p.bump(p.parts-1) + "-0"}}, nil
+	default:
+		return []comparator{{">=", p.String()}, {"<", p.bump(p.parts-1) + "-0"}}, nil
+	}
+}
+
+// holds reports whether a version meets the comparator
+func (c comparator) holds(v string) bool {
+	cmp := version.CompareSemver(v, c.version)
+	switch c.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	default:
+		return cmp == 0
+	}
+}
+
+// satisfiedBy reports whether a version falls in the range. As in npm, a pre-release
+// only matches an alternative that names a pre-release of the same release.
+func (r npmRange) satisfiedBy(v string) bool {
+	p, err := parsePartial(v)
+	if err != nil || p.parts < 3 {
+		return false
+	}
+
+	for _, set := range r {
+		matches := true
+		allowed := p.prerelease == ""
+		for _, c := range set {
+			if !c.holds(v) {
+				matches = false
+				break
+			}
+			if bound, _ := parsePartial(c.version); bound.prerelease != "" && bound.numbers == p.numbers {
+				allowed = true
+			}
+		}
+		if matches && allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// maxSatisfying returns the highest of the versions that falls in the range
+func (r npmRange) maxSatisfying(versions []string) (string, bool) {
+	best := ""
+	for _, v := range versions {
+		if r.satisfiedBy(v) && (best == "" || version.CompareSemver(v, best) > 0) {
+			best = v
+		}
+	}
+	return best, best != ""
+}
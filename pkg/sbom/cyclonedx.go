@@ -0,0 +1,53 @@
+package sbom
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+)
+
+// cycloneDXComponent is the subset of a CycloneDX component used for scanning.
+// Components may nest sub-components, such as the modules of an application.
+type cycloneDXComponent struct {
+	PURL       string               `json:"purl" xml:"purl"`
+	Components []cycloneDXComponent `json:"components" xml:"components>component"`
+}
+
+// cycloneDXJSON returns the purls of the components of a CycloneDX JSON document
+func cycloneDXJSON(data []byte) ([]string, error) {
+	var bom struct {
+		BOMFormat  string               `json:"bomFormat"`
+		Components []cycloneDXComponent `json:"components"`
+	}
+	if err := json.Unmarshal(data, &bom); err != nil {
+		return nil, err
+	}
+	if bom.BOMFormat != "CycloneDX" {
+		return nil, fmt.Errorf("unsupported JSON SBOM: bomFormat is %q, not CycloneDX", bom.BOMFormat)
+	}
+	return componentPURLs(bom.Components, nil), nil
+}
+
+// cycloneDXXML returns the purls of the components of a CycloneDX XML document
+func cycloneDXXML(data []byte) ([]string, error) {
+	var bom struct {
+		XMLName    xml.Name
+		Components []cycloneDXComponent `xml:"components>component"`
+	}
+	if err := xml.Unmarshal(data, &bom); err != nil {
+		return nil, err
+	}
+	if bom.XMLName.Local != "bom" {
+		return nil, fmt.Errorf("unsupported XML SBOM: root element is %q, not a CycloneDX bom", bom.XMLName.Local)
+	}
+	return componentPURLs(bom.Components, nil), nil
+}
+
+// componentPURLs appends the purls of components and their sub-components to purls
+func componentPURLs(components []cycloneDXComponent, purls []string) []string {
+	for _, component := range components {
+		purls = append(purls, component.PURL)
+		purls = componentPURLs(component.Components, purls)
+	}
+	return purls
+}
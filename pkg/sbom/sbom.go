@@ -0,0 +1,95 @@
+package sbom
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/squarehole/package-scanner/pkg/purl"
+)
+
+// Component is a package listed in an SBOM
+type Component struct {
+	Name      string
+	Version   string
+	Ecosystem string
+	// PURL is the component's package URL as written in the SBOM
+	PURL string
+}
+
+// namePatterns are the conventional file names of CycloneDX and SPDX documents
+var namePatterns = []string{"bom.json", "bom.xml", "*.cdx.json", "*.cdx.xml", "*.spdx.json", "*.spdx"}
+
+// IsSBOM reports whether a file name is a conventional name of an SBOM
+func IsSBOM(name string) bool {
+	name = strings.ToLower(filepath.Base(name))
+	for _, pattern := range namePatterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse reads a CycloneDX (JSON or XML) or SPDX 2.x (JSON or tag-value) SBOM and
+// returns the components that identify a package version by purl.
+// The second result counts components skipped because they have no purl, no version, or
+// a purl type without a known ecosystem.
+func Parse(path string) ([]Component, int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error reading SBOM %s: %w", path, err)
+	}
+
+	var purls []string
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")) && bytes.Contains(trimmed, []byte(`"spdxVersion"`)):
+		purls, err = spdxJSON(trimmed)
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		purls, err = cycloneDXJSON(trimmed)
+	case bytes.HasPrefix(trimmed, []byte("<")):
+		purls, err = cycloneDXXML(trimmed)
+	case bytes.Contains(trimmed, []byte("SPDXVersion:")):
+		purls, err = spdxTagValue(trimmed)
+	default:
+		err = fmt.Errorf("unrecognized SBOM format")
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("error parsing SBOM %s: %w", path, err)
+	}
+
+	components, skipped := fromPURLs(purls)
+	return components, skipped, nil
+}
+
+// fromPURLs converts package URLs to components. Empty entries stand for
+// components without a purl and are counted as skipped.
+func fromPURLs(purls []string) ([]Component, int) {
+	var components []Component
+	skipped := 0
+	seen := make(map[string]bool)
+	for _, s := range purls {
+		p, err := purl.Parse(s)
+		if s == "" || err != nil || p.Version == "" || p.Ecosystem() == "" {
+			skipped++
+			continue
+		}
+
+		version := p.Version
+		// Go module versions are queried without the "v" prefix, as with go.mod
+		if p.Type == "golang" {
+			version = strings.TrimPrefix(version, "v")
+		}
+
+		component := Component{Name: p.PackageName(), Version: version, Ecosystem: p.Ecosystem(), PURL: s}
+		key := component.Ecosystem + "/" + component.Name + "@" + component.Version
+		if !seen[key] {
+			seen[key] = true
+			components = append(components, component)
+		}
+	}
+	return components, skipped
+}
@@ -0,0 +1,124 @@
+package sbom
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/squarehole/package-scanner/pkg/purl"
+)
+
+// spdxPackage is a package described by an SPDX document
+type spdxPackage struct {
+	Name         string            `json:"name"`
+	VersionInfo  string            `json:"versionInfo"`
+	ExternalRefs []spdxExternalRef `json:"externalRefs"`
+}
+
+// spdxExternalRef refers to a package by an external identifier such as a purl or CPE
+type spdxExternalRef struct {
+	ReferenceType    string `json:"referenceType"`
+	ReferenceLocator string `json:"referenceLocator"`
+}
+
+// purl returns the package's purl, completed with the package version when the
+// purl has none. An empty string is returned for packages without a purl reference.
+func (p spdxPackage) purl() string {
+	for _, ref := range p.ExternalRefs {
+		if ref.ReferenceType != "purl" {
+			continue
+		}
+		parsed, err := purl.Parse(ref.ReferenceLocator)
+		if err != nil || parsed.Version != "" || p.VersionInfo == "" {
+			return ref.ReferenceLocator
+		}
+		parsed.Version = p.VersionInfo
+		return parsed.String()
+	}
+	return ""
+}
+
+// spdxJSON returns the purls of the packages of an SPDX 2.x JSON document
+func spdxJSON(data []byte) ([]string, error) {
+	var doc struct {
+		SPDXVersion string        `json:"spdxVersion"`
+		Packages    []spdxPackage `json:"packages"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(doc.SPDXVersion, "SPDX-2.") {
+		return nil, fmt.Errorf("unsupported SPDX version %q", doc.SPDXVersion)
+	}
+
+	purls := make([]string, len(doc.Packages))
+	for i, pkg := range doc.Packages {
+		purls[i] = pkg.purl()
+	}
+	return purls, nil
+}
+
+// spdxTagValue returns the purls of the packages of an SPDX 2.x tag-value document
+func spdxTagValue(data []byte) ([]string, error) {
+	var purls []string
+	var current *spdxPackage
+	flush := func() {
+		if current != nil {
+			purls = append(purls, current.purl())
+		}
+		current = nil
+	}
+
+	inText := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Multi-line values are wrapped in <text> ... </text>
+		if inText {
+			inText = !strings.Contains(line, "</text>")
+			continue
+		}
+
+		tag, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, "<text>") && !strings.Contains(value, "</text>") {
+			inText = true
+		}
+
+		switch strings.TrimSpace(tag) {
+		case "SPDXVersion":
+			if !strings.HasPrefix(value, "SPDX-2.") {
+				return nil, fmt.Errorf("unsupported SPDX version %q", value)
+			}
+		case "PackageName":
+			flush()
+			current = &spdxPackage{Name: value}
+		case "FileName", "Snippet":
+			// Files and snippets follow the packages they belong to
+			flush()
+		case "PackageVersion":
+			if current != nil {
+				current.VersionInfo = value
+			}
+		case "ExternalRef":
+			// ExternalRef: <category> <type> <locator>
+			fields := strings.Fields(value)
+			if current != nil && len(fields) == 3 {
+				current.ExternalRefs = append(current.ExternalRefs, spdxExternalRef{ReferenceType: fields[1], ReferenceLocator: fields[2]})
+			}
+		}
+	}
+	flush()
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return purls, nil
+}
@@ -0,0 +1,159 @@
+package scanner
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+)
+
+// Adaptation of the number of workers to the advisory source with --concurrency=auto
+const (
+	// autoConcurrencyStart is the number of workers a scan starts with
+	autoConcurrencyStart = 2
+	// autoConcurrencyMinWindow is the least number of queries the limit is judged on,
+	// so a few slow responses at a low limit do not lower it
+	autoConcurrencyMinWindow = 4
+	// autoConcurrencyErrorRate is the share of failed queries in a window above which
+	// the limit is lowered
+	autoConcurrencyErrorRate = 0.1
+	// autoConcurrencyHeadroom is how much slower than the fastest window a window may be
+	// answered for the limit to still be raised
+	autoConcurrencyHeadroom = 1.25
+	// autoConcurrencyTolerance is how much slower than the fastest window a window may
+	// be answered before the limit is lowered
+	autoConcurrencyTolerance = 2.0
+	// autoConcurrencyDrift is the share of the gap to a slower window the fastest
+	// response time moves by, so a source that stays slower is judged by its new speed
+	autoConcurrencyDrift = 0.05
+)
+
+// adaptiveConcurrency limits the number of workers querying the advisory source,
+// starting low and adapting the limit to the response times and errors it observes.
+// The limit is judged once per window of as many queries as it allows. While responses
+// are about as fast as the fastest window seen and few fail, it doubles, until the
+// first window that is slower or fails more, after which it grows by one at a time.
+// Responses much slower than the fastest window or frequent errors lower it by a
+// quarter. Methods are nil-safe and safe for concurrent use.
+type adaptiveConcurrency struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	limit     int
+	max       int
+	active    int
+	peak      int
+	slowStart bool
+
+	// The queries of the current window
+	queries int
+	errors  int
+	latency time.Duration
+	// baseline is the average response time of the fastest window, drifting towards
+	// slower windows
+	baseline time.Duration
+}
+
+// newAdaptiveConcurrency creates a limiter that raises the number of workers up to max
+func newAdaptiveConcurrency(max int) *adaptiveConcurrency {
+	start := min(autoConcurrencyStart, max)
+	a := &adaptiveConcurrency{limit: start, max: max, peak: start, slowStart: true}
+	a.cond = sync.NewCond(&a.mu)
+	return a
+}
+
+// acquire blocks until a worker may start
+func (a *adaptiveConcurrency) acquire() {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for a.active >= a.limit {
+		a.cond.Wait()
+	}
+	a.active++
+}
+
+// release ends a worker started by acquire
+func (a *adaptiveConcurrency) release() {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	a.active--
+	a.mu.Unlock()
+	a.cond.Signal()
+}
+
+// observe records the response time and outcome of a query, adjusting the limit at
+// the end of each window
+func (a *adaptiveConcurrency) observe(latency time.Duration, err error) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.queries++
+	a.latency += latency
+	if err != nil {
+		a.errors++
+	}
+	if a.queries < max(a.limit, autoConcurrencyMinWindow) {
+		return
+	}
+
+	average := a.latency / time.Duration(a.queries)
+	errorRate := float64(a.errors) / float64(a.queries)
+	a.queries, a.errors, a.latency = 0, 0, 0
+	if a.baseline == 0 || average < a.baseline {
+		a.baseline = average
+	} else {
+		a.baseline += time.Duration(float64(average-a.baseline) * autoConcurrencyDrift)
+	}
+
+	previous := a.limit
+	switch {
+	case errorRate > autoConcurrencyErrorRate || float64(average) > float64(a.baseline)*autoConcurrencyTolerance:
+		a.slowStart = false
+		a.limit = max(1, a.limit-max(1, a.limit/4))
+	case float64(average) <= float64(a.baseline)*autoConcurrencyHeadroom:
+		if a.slowStart {
+			a.limit = min(a.max, a.limit*2)
+		} else {
+			a.limit = min(a.max, a.limit+1)
+		}
+	default:
+		a.slowStart = false
+	}
+	if a.limit == previous {
+		return
+	}
+	a.peak = max(a.peak, a.limit)
+	slog.Debug("Adjusting concurrency", "workers", a.limit, "previous", previous,
+		"avg_latency", average, "baseline", a.baseline, "error_rate", errorRate)
+	if a.limit > previous {
+		a.cond.Broadcast()
+	}
+}
+
+// limits returns the current and the highest number of workers allowed
+func (a *adaptiveConcurrency) limits() (current, peak int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.limit, a.peak
+}
+
+// adaptiveSource times the queries of an advisory source for an adaptive limit
+type adaptiveSource struct {
+	source      vulnerabilitySource
+	concurrency *adaptiveConcurrency
+}
+
+// QueryPackage queries the source and records how long it took
+func (s adaptiveSource) QueryPackage(packageName, packageVersion, packageEcosystem string) (models.ScanResults, []byte, error) {
+	began := time.Now()
+	results, body, err := s.source.QueryPackage(packageName, packageVersion, packageEcosystem)
+	s.concurrency.observe(time.Since(began), err)
+	return results, body, err
+}
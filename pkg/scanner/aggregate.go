@@ -0,0 +1,83 @@
+package scanner
+
+import (
+	"io"
+	"os"
+
+	"github.com/squarehole/package-scanner/pkg/archive"
+	"github.com/squarehole/package-scanner/pkg/cli"
+	"github.com/squarehole/package-scanner/pkg/db"
+	"github.com/squarehole/package-scanner/pkg/reporting"
+)
+
+// defaultAggregatePeriod is the period report aggregate covers without --since, a week
+// of runs for a weekly review
+const defaultAggregatePeriod = "7d"
+
+// aggregateTop is the number of packages and advisories a rollup lists
+const aggregateTop = 25
+
+// runReportAggregate rolls up the scan runs of the --since period carrying every --label
+// into an organization-level report. Runs are read from the configured database, or
+// from the reports archived at --archive when it is given.
+func (c *Controller) runReportAggregate() {
+	period := c.config.Since
+	if period == "" {
+		period = defaultAggregatePeriod
+	}
+	since, err := cli.ParseSince(period)
+	if err != nil {
+		c.logger.Error("Invalid period", "since", period, "error", err)
+		os.Exit(1)
+	}
+
+	var write func(reporting.Rollup, io.Writer) error
+	switch c.config.Format {
+	case "", "json":
+		write = reporting.Rollup.WriteJSON
+	case "html":
+		write = reporting.Rollup.WriteHTML
+	default:
+		c.logger.Error("Unsupported rollup format", "format", c.config.Format, "supported", "json, html")
+		os.Exit(1)
+	}
+
+	var runs []db.RollupRun
+	if c.config.Archive != "" {
+		reports, err := archive.LoadReports(c.config.Archive, since, c.config.Labels)
+		if err != nil {
+			c.logger.Error("Error loading archived runs", "location", c.config.Archive, "error", err)
+			os.Exit(1)
+		}
+		runs = reporting.ArchivedRuns(reports)
+	} else {
+		if c.store == nil {
+			c.store = c.openDatabase()
+		}
+		runs, err = c.store.GetRollupRuns(c.ctx, db.RollupFilter{Since: since, Labels: c.config.Labels})
+		if err != nil {
+			c.logger.Error("Error querying scan runs", "error", err)
+			os.Exit(1)
+		}
+	}
+	rollup := reporting.Aggregate(runs, since, c.config.Labels, aggregateTop)
+
+	if c.config.OutputPath == "" {
+		if err := write(rollup, os.Stdout); err != nil {
+			c.logger.Error("Error writing rollup", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+	f, err := os.Create(c.config.OutputPath)
+	if err != nil {
+		c.logger.Error("Error creating rollup", "path", c.config.OutputPath, "error", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	if err := write(rollup, f); err != nil {
+		c.logger.Error("Error writing rollup", "path", c.config.OutputPath, "error", err)
+		os.Exit(1)
+	}
+	c.logger.Info("Rollup written", "path", c.config.OutputPath, "runs", rollup.Runs)
+}
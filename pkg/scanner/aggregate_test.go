@@ -0,0 +1,82 @@
+package scanner
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/squarehole/package-scanner/pkg/cli"
+	"github.com/squarehole/package-scanner/pkg/db"
+	"github.com/squarehole/package-scanner/pkg/reporting"
+)
+
+func TestReportAggregateFromStore(t *testing.T) {
+	finding := func(name, version, id, severity string) db.VulnerabilityRecord {
+		return db.VulnerabilityRecord{PackageName: name, Ecosystem: "npm", Version: version, VulnID: id, SeverityLabel: severity}
+	}
+	store := newFakeStore()
+	store.rollupRuns = []db.RollupRun{
+		{
+			Labels: map[string]string{"env": "prod", "team": "payments"},
+			Findings: []db.VulnerabilityRecord{
+				finding("lodash", "4.17.0", "GHSA-jf85-cpcp-j695", "Critical"),
+				finding("minimist", "1.2.0", "GHSA-vh95-rmgr-6w4m", "Medium"),
+			},
+			Clean: []db.CleanScan{{PackageName: "left-pad", Ecosystem: "npm", Version: "1.3.0"}},
+		},
+		{
+			// The same finding seen again by another team's run is counted once
+			Labels:   map[string]string{"env": "prod", "team": "search"},
+			Findings: []db.VulnerabilityRecord{finding("lodash", "4.17.0", "GHSA-jf85-cpcp-j695", "Critical")},
+		},
+		{
+			// Findings saved before severities were stored have no label
+			Labels:   map[string]string{"env": "prod", "team": "search"},
+			Findings: []db.VulnerabilityRecord{finding("lodash", "4.17.11", "GHSA-p6mc-m468-83gw", "")},
+		},
+	}
+
+	out := filepath.Join(t.TempDir(), "rollup.json")
+	config := &cli.Config{
+		Command:    "report aggregate",
+		Labels:     map[string]string{"env": "prod"},
+		Since:      "7d",
+		OutputPath: out,
+		LogFormat:  "json",
+	}
+	controller := NewController(config, WithStore(store))
+	controller.Run()
+	controller.Close()
+
+	if store.rollupFilter.Labels["env"] != "prod" || store.rollupFilter.Since.IsZero() {
+		t.Errorf("runs queried with %+v, want env=prod since a week ago", store.rollupFilter)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rollup reporting.Rollup
+	if err := json.Unmarshal(data, &rollup); err != nil {
+		t.Fatal(err)
+	}
+	if rollup.Runs != 3 || rollup.Packages != 4 || rollup.VulnerablePackages != 3 || rollup.Findings != 3 {
+		t.Errorf("rollup of %d runs, %d packages, %d vulnerable, %d findings, want 3, 4, 3 and 3",
+			rollup.Runs, rollup.Packages, rollup.VulnerablePackages, rollup.Findings)
+	}
+	if rollup.SeverityCounts["Critical"] != 1 || rollup.SeverityCounts["Medium"] != 1 || rollup.SeverityCounts["Unknown"] != 1 {
+		t.Errorf("severity counts = %v, want 1 critical, 1 medium and 1 unknown", rollup.SeverityCounts)
+	}
+	if len(rollup.TopPackages) == 0 || rollup.TopPackages[0].Name != "lodash" || len(rollup.TopPackages[0].Versions) != 2 {
+		t.Errorf("top packages = %+v, want lodash in 2 versions first", rollup.TopPackages)
+	}
+	if len(rollup.TopAdvisories) == 0 || rollup.TopAdvisories[0].ID != "GHSA-jf85-cpcp-j695" ||
+		len(rollup.TopAdvisories[0].Teams) != 2 {
+		t.Errorf("top advisories = %+v, want GHSA-jf85-cpcp-j695 of 2 teams first", rollup.TopAdvisories)
+	}
+	if len(rollup.Teams) != 2 || rollup.Teams[0].Critical != 1 || rollup.Teams[0].Team != "payments" ||
+		rollup.Teams[1].Runs != 2 {
+		t.Errorf("teams = %+v, want payments then search with 2 runs", rollup.Teams)
+	}
+}
@@ -0,0 +1,69 @@
+package scanner
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// archiveInspector identifies the packages in an artifact from the metadata
+// embedded in it. The artifact's own package comes first; any further packages are
+// bundled in or declared by it. Name is the artifact's slash-separated path relative
+// to the scanned location, or its file name, used when the metadata cannot be read.
+type archiveInspector func(r io.ReaderAt, size int64, name string) ([]PackageInfo, error)
+
+// inspector returns the metadata reader for the scanner's artifact type, or nil
+// when packages are identified by their file name alone
+func (ps *PackageScanner) inspector() archiveInspector {
+	switch strings.ToLower(ps.FileExtension) {
+	case "nupkg":
+		return ps.nupkgPackages
+	case "jar":
+		return ps.jarPackages
+	case "deb":
+		return ps.debPackages
+	case "rpm":
+		return ps.rpmPackages
+	case "gem":
+		return ps.gemPackages
+	default:
+		return nil
+	}
+}
+
+// inspectFile identifies the packages in an artifact on disk, at relPath below the
+// scanned location. Only the artifact's own package is attributed to the file.
+func (ps *PackageScanner) inspectFile(filePath, relPath string, inspect archiveInspector) ([]PackageInfo, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening package: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("error reading package: %w", err)
+	}
+
+	packages, err := inspect(f, info.Size(), relPath)
+	if err != nil {
+		return nil, err
+	}
+	packages[0].FilePath = filePath
+	packages[0].Checksum = ps.artifactChecksum(filePath)
+	return packages, nil
+}
+
+// filenameFallback identifies an artifact by its directory layout or file name when its
+// metadata cannot be read
+func (ps *PackageScanner) filenameFallback(name string, err error) ([]PackageInfo, error) {
+	ps.logger.Warn("Could not read package metadata, using file name",
+		"filename", name,
+		"error", err)
+	pkg, err := ps.identify(name)
+	if err != nil {
+		return nil, err
+	}
+	return []PackageInfo{pkg}, nil
+}
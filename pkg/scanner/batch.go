@@ -0,0 +1,67 @@
+package scanner
+
+import (
+	"sync"
+
+	"github.com/squarehole/package-scanner/pkg/db"
+)
+
+// findingBatch collects the findings of a directory scan so they are saved to the
+// store in bulk rather than one package at a time. Methods are safe for concurrent use.
+type findingBatch struct {
+	// size is the number of findings collected before they are saved
+	size int
+
+	mu       sync.Mutex
+	pending  []db.PackageFindings
+	findings int
+}
+
+// add collects the findings of a package and, once size findings are pending, returns
+// them to be saved, leaving the batch empty. A package without findings, recorded as a
+// clean scan, counts as one.
+func (b *findingBatch) add(pkg db.PackageFindings) []db.PackageFindings {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = append(b.pending, pkg)
+	b.findings += max(len(pkg.Vulnerabilities), 1)
+	if b.findings < b.size {
+		return nil
+	}
+	return b.take()
+}
+
+// take returns the pending findings, leaving the batch empty
+func (b *findingBatch) take() []db.PackageFindings {
+	pending := b.pending
+	b.pending, b.findings = nil, 0
+	return pending
+}
+
+// saveBatch saves the findings of a batch to the store
+func (c *Controller) saveBatch(batch []db.PackageFindings) {
+	if len(batch) == 0 {
+		return
+	}
+	saved := c.stats.start(phaseDB)
+	err := c.store.SaveVulnerabilityBatch(c.ctx, c.run.runID(), batch)
+	saved()
+
+	if err != nil {
+		c.reporter.DisplayError("Error saving results of %d packages to database: %v", len(batch), err)
+		c.failures.Add(1)
+	} else {
+		c.reporter.DisplayInfo("Results of %d packages saved to database.", len(batch))
+	}
+}
+
+// flushFindings saves the findings still pending at the end of a scan
+func (c *Controller) flushFindings() {
+	if c.batch == nil {
+		return
+	}
+	c.batch.mu.Lock()
+	pending := c.batch.take()
+	c.batch.mu.Unlock()
+	c.saveBatch(pending)
+}
@@ -0,0 +1,121 @@
+package scanner
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+)
+
+// queryFunc performs a vulnerability lookup for a single package
+type queryFunc func() (models.ScanResults, []byte, error)
+
+// queryCache shares vulnerability query results between all packages scanned
+// in a single run, so that a package found in several places is only queried once,
+// whether it was found as an artifact, in a lockfile or in an SBOM. Raw response
+// bodies are only handed to the first scan of a package, which archives and persists
+// them, and are not kept, so the cache stays small on large scans.
+type queryCache struct {
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	hits    int
+}
+
+// cacheEntry holds the result of a single query; once ensures concurrent
+// callers asking for the same package wait for one in-flight request
+type cacheEntry struct {
+	once    sync.Once
+	results models.ScanResults
+	body    []byte
+	err     error
+	// claimed is set by the first scan of the package, which reports and persists the
+	// results; lookups do not claim an entry
+	claimed bool
+}
+
+// newQueryCache creates an empty query cache
+func newQueryCache() *queryCache {
+	return &queryCache{
+		entries: make(map[string]*cacheEntry),
+	}
+}
+
+// get returns the cached result for a package scan, calling fetch on the first request.
+// The returned bool reports whether an earlier scan of the run has already claimed the
+// result; such results come without the raw response body.
+func (qc *queryCache) get(name, version, ecosystem string, fetch queryFunc) (models.ScanResults, []byte, bool, error) {
+	entry, claimed := qc.entry(name, version, ecosystem, true)
+	entry.once.Do(func() {
+		entry.results, entry.body, entry.err = fetch()
+	})
+	if claimed {
+		return entry.results, nil, true, entry.err
+	}
+
+	// Only the first scan reads the body, once the query has completed
+	body := entry.body
+	entry.body = nil
+	return entry.results, body, false, entry.err
+}
+
+// lookup returns the cached result for a package without claiming it, calling fetch on
+// the first request. It serves checks such as whether the latest release is affected,
+// which report nothing of the package themselves, so a later scan of the same version
+// still reports, archives and persists it.
+func (qc *queryCache) lookup(name, version, ecosystem string, fetch queryFunc) (models.ScanResults, error) {
+	entry, _ := qc.entry(name, version, ecosystem, false)
+	entry.once.Do(func() {
+		entry.results, entry.body, entry.err = fetch()
+	})
+	return entry.results, entry.err
+}
+
+// entry returns the cache entry of a package, creating it on the first request, and
+// whether a scan had claimed it before. With claim set the entry is claimed.
+func (qc *queryCache) entry(name, version, ecosystem string, claim bool) (*cacheEntry, bool) {
+	key := queryKey(name, version, ecosystem)
+
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+	entry, hit := qc.entries[key]
+	if hit {
+		qc.hits++
+	} else {
+		entry = &cacheEntry{}
+		qc.entries[key] = entry
+	}
+	claimed := entry.claimed
+	if claim {
+		entry.claimed = true
+	}
+	return entry, claimed
+}
+
+// pypiNameSeparators are the runs of characters PEP 503 normalizes to a single dash
+var pypiNameSeparators = regexp.MustCompile(`[-_.]+`)
+
+// queryKey identifies a query in the cache. Ecosystems are matched regardless of case,
+// and PyPI names by their PEP 503 form, so a wheel's "zope_interface" and a
+// requirements file's "zope.interface" share one query; the version is expected in its
+// canonical form already.
+func queryKey(name, version, ecosystem string) string {
+	if strings.EqualFold(ecosystem, "PyPI") {
+		name = pypiNameSeparators.ReplaceAllString(strings.ToLower(name), "-")
+	}
+	return strings.Join([]string{strings.ToLower(ecosystem), name, version}, "|")
+}
+
+// size returns the number of distinct packages queried
+func (qc *queryCache) size() int {
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+	return len(qc.entries)
+}
+
+// shared returns the number of lookups answered by an earlier query of the run
+func (qc *queryCache) shared() int {
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+	return qc.hits
+}
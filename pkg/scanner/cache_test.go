@@ -0,0 +1,96 @@
+package scanner
+
+import (
+	"testing"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+)
+
+func TestQueryCache(t *testing.T) {
+	type call struct {
+		lookup bool
+		// wantClaimed and wantBody are checked for get calls
+		wantClaimed bool
+		wantBody    bool
+	}
+	tests := []struct {
+		name        string
+		calls       []call
+		wantFetches int
+	}{
+		{
+			name:        "first scan gets the body",
+			calls:       []call{{wantBody: true}},
+			wantFetches: 1,
+		},
+		{
+			name:        "later scans are served claimed results without the body",
+			calls:       []call{{wantBody: true}, {wantClaimed: true}, {wantClaimed: true}},
+			wantFetches: 1,
+		},
+		{
+			name:        "a lookup does not claim the results of a later scan",
+			calls:       []call{{lookup: true}, {wantBody: true}, {wantClaimed: true}},
+			wantFetches: 1,
+		},
+		{
+			name:        "a lookup after a scan shares its query",
+			calls:       []call{{wantBody: true}, {lookup: true}, {wantClaimed: true}},
+			wantFetches: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newQueryCache()
+			fetches := 0
+			fetch := func() (models.ScanResults, []byte, error) {
+				fetches++
+				return models.ScanResults{Vulnerabilities: []models.Vulnerability{{ID: "GHSA-1"}}}, []byte(`{"vulns":[]}`), nil
+			}
+
+			for i, c := range tt.calls {
+				if c.lookup {
+					results, err := cache.lookup("lodash", "4.17.0", "npm", fetch)
+					if err != nil || len(results.Vulnerabilities) != 1 {
+						t.Fatalf("call %d: lookup = %v, %v", i, results, err)
+					}
+					continue
+				}
+				results, body, claimed, err := cache.get("lodash", "4.17.0", "npm", fetch)
+				if err != nil || len(results.Vulnerabilities) != 1 {
+					t.Fatalf("call %d: get = %v, %v", i, results, err)
+				}
+				if claimed != c.wantClaimed {
+					t.Errorf("call %d: claimed = %v, want %v", i, claimed, c.wantClaimed)
+				}
+				if (body != nil) != c.wantBody {
+					t.Errorf("call %d: body = %q, want body %v", i, body, c.wantBody)
+				}
+			}
+			if fetches != tt.wantFetches {
+				t.Errorf("fetched %d times, want %d", fetches, tt.wantFetches)
+			}
+		})
+	}
+}
+
+func TestQueryKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		a, b       [3]string
+		wantShared bool
+	}{
+		{name: "ecosystem case", a: [3]string{"lodash", "1.0.0", "npm"}, b: [3]string{"lodash", "1.0.0", "NPM"}, wantShared: true},
+		{name: "PyPI name separators", a: [3]string{"zope_interface", "5.0", "PyPI"}, b: [3]string{"zope.interface", "5.0", "pypi"}, wantShared: true},
+		{name: "npm names are not normalized", a: [3]string{"lodash_es", "1.0.0", "npm"}, b: [3]string{"lodash-es", "1.0.0", "npm"}},
+		{name: "versions differ", a: [3]string{"lodash", "1.0.0", "npm"}, b: [3]string{"lodash", "1.0.1", "npm"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shared := queryKey(tt.a[0], tt.a[1], tt.a[2]) == queryKey(tt.b[0], tt.b[1], tt.b[2])
+			if shared != tt.wantShared {
+				t.Errorf("shared = %v, want %v", shared, tt.wantShared)
+			}
+		})
+	}
+}
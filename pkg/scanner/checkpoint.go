@@ -0,0 +1,217 @@
+package scanner
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+)
+
+// checkpointVersion is the format version of checkpoint files. Version 2 records the
+// findings of each package, so a resumed scan reports them again.
+const checkpointVersion = 2
+
+// checkpoint records the packages of a directory scan as they are checked, so an
+// interrupted scan can be resumed without checking them again. The file is JSON lines:
+// a header identifying the scan, then one line per checked package, appended as each
+// completes so a crash loses at most the packages being checked. Each line keeps the
+// vulnerabilities reported for the package, so a resumed scan reports them again
+// without querying for them. Packages whose check failed are not recorded and are
+// checked again on resume.
+// Methods are safe for concurrent use.
+type checkpoint struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+	done map[string]checkpointEntry
+	// restored counts the packages skipped because the checkpoint had them
+	restored int
+}
+
+// checkpointHeader identifies the scan a checkpoint belongs to
+type checkpointHeader struct {
+	Version   int      `json:"version"`
+	Targets   []string `json:"targets"`
+	Extension string   `json:"extension,omitempty"`
+}
+
+// checkpointEntry is a package checked before the scan was interrupted, with its outcome
+type checkpointEntry struct {
+	Target              string `json:"target"`
+	File                string `json:"file,omitempty"`
+	Name                string `json:"name"`
+	Version             string `json:"version"`
+	Ecosystem           string `json:"ecosystem"`
+	Vulnerabilities     int    `json:"vulnerabilities,omitempty"`
+	Suppressed          int    `json:"suppressed,omitempty"`
+	SupplyChainFindings int    `json:"supply_chain_findings,omitempty"`
+	SignatureFindings   int    `json:"signature_findings,omitempty"`
+	// Findings are the vulnerabilities reported for the package, after suppressions
+	Findings []models.Vulnerability `json:"findings,omitempty"`
+}
+
+// openCheckpoint starts the checkpoint of a scan of targets. With resume, the packages
+// recorded by an interrupted run of the same scan are loaded and kept; otherwise any
+// earlier checkpoint is replaced.
+func openCheckpoint(path string, resume bool, targets []string, extension string) (*checkpoint, error) {
+	header := checkpointHeader{Version: checkpointVersion, Targets: targets, Extension: extension}
+	cp := &checkpoint{path: path, done: make(map[string]checkpointEntry)}
+
+	if resume {
+		if err := cp.load(header); err != nil {
+			return nil, err
+		}
+	}
+
+	// The checkpoint is written afresh, with the packages already checked, so a line
+	// cut short when the interrupted run was killed is not appended to
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating checkpoint %s: %w", path, err)
+	}
+	cp.file = file
+	lines := []any{header}
+	for _, entry := range cp.done {
+		lines = append(lines, entry)
+	}
+	for _, line := range lines {
+		if err := cp.write(line); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return cp, nil
+}
+
+// load reads the packages of an earlier checkpoint of the same scan, if there is one
+func (cp *checkpoint) load(header checkpointHeader) error {
+	file, err := os.Open(cp.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading checkpoint %s: %w", cp.path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	if !scanner.Scan() {
+		// An empty checkpoint is left by a run interrupted before it wrote anything
+		return scanner.Err()
+	}
+	var saved checkpointHeader
+	if err := json.Unmarshal(scanner.Bytes(), &saved); err != nil {
+		return fmt.Errorf("invalid checkpoint %s: %w", cp.path, err)
+	}
+	if saved.Version != header.Version {
+		return fmt.Errorf("checkpoint %s was written by another version of the scanner; remove it or run without --resume", cp.path)
+	}
+	if saved.Extension != header.Extension || !slices.Equal(saved.Targets, header.Targets) {
+		return fmt.Errorf("checkpoint %s was written by a scan of other targets (%s); remove it or run without --resume",
+			cp.path, strings.Join(saved.Targets, ", "))
+	}
+
+	for scanner.Scan() {
+		var entry checkpointEntry
+		// The last line is cut short if the run was killed while writing it
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		cp.done[checkpointKey(entry.Target, entry.File, entry.Name, entry.Version, entry.Ecosystem)] = entry
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading checkpoint %s: %w", cp.path, err)
+	}
+	return nil
+}
+
+// lookup returns the recorded outcome of a package found in a target, if it was
+// checked before the scan was interrupted
+func (cp *checkpoint) lookup(target string, pkg PackageInfo) (scanOutcome, bool) {
+	if cp == nil {
+		return scanOutcome{}, false
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	entry, ok := cp.done[checkpointKey(target, pkg.FilePath, pkg.Name, pkg.Version, pkg.Ecosystem)]
+	if !ok {
+		return scanOutcome{}, false
+	}
+	cp.restored++
+	return scanOutcome{
+		vulnerabilities:     entry.Vulnerabilities,
+		suppressed:          entry.Suppressed,
+		supplyChainFindings: entry.SupplyChainFindings,
+		signatureFindings:   entry.SignatureFindings,
+		findings:            entry.Findings,
+	}, true
+}
+
+// add records a package that was checked
+func (cp *checkpoint) add(target string, pkg PackageInfo, outcome scanOutcome) error {
+	if cp == nil {
+		return nil
+	}
+	return cp.write(checkpointEntry{
+		Target:              target,
+		File:                pkg.FilePath,
+		Name:                pkg.Name,
+		Version:             pkg.Version,
+		Ecosystem:           pkg.Ecosystem,
+		Vulnerabilities:     outcome.vulnerabilities,
+		Suppressed:          outcome.suppressed,
+		SupplyChainFindings: outcome.supplyChainFindings,
+		SignatureFindings:   outcome.signatureFindings,
+		Findings:            outcome.findings,
+	})
+}
+
+// write appends one line to the checkpoint
+func (cp *checkpoint) write(line any) error {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return fmt.Errorf("error encoding checkpoint: %w", err)
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if _, err := cp.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing checkpoint %s: %w", cp.path, err)
+	}
+	return nil
+}
+
+// restoredPackages returns the number of packages skipped because the checkpoint had them
+func (cp *checkpoint) restoredPackages() int {
+	if cp == nil {
+		return 0
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.restored
+}
+
+// finish removes the checkpoint of a scan that completed
+func (cp *checkpoint) finish() error {
+	if cp == nil {
+		return nil
+	}
+	cp.file.Close()
+	if err := os.Remove(cp.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error removing checkpoint %s: %w", cp.path, err)
+	}
+	return nil
+}
+
+// checkpointKey identifies a package found in a target
+func checkpointKey(target, file, name, version, ecosystem string) string {
+	return strings.Join([]string{target, file, ecosystem, name, version}, "\x00")
+}
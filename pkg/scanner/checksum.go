@@ -0,0 +1,39 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+// artifactChecksum returns the hex SHA-256 of an artifact on disk, or an empty string,
+// with a warning, if it cannot be read
+func (ps *PackageScanner) artifactChecksum(filePath string) string {
+	f, err := os.Open(filePath)
+	if err != nil {
+		ps.logger.Warn("Could not compute artifact checksum", "filename", filePath, "error", err)
+		return ""
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		ps.logger.Warn("Could not compute artifact checksum", "filename", filePath, "error", fmt.Errorf("error reading artifact: %w", err))
+		return ""
+	}
+	return hexSum(h)
+}
+
+// checksum returns the hex SHA-256 of an artifact read into memory
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hexSum returns the hex digest of a hash
+func hexSum(h hash.Hash) string {
+	return hex.EncodeToString(h.Sum(nil))
+}
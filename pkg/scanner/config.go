@@ -0,0 +1,28 @@
+package scanner
+
+import (
+	"bytes"
+	"os"
+
+	"github.com/squarehole/package-scanner/pkg/cli"
+)
+
+// runConfigShow writes the effective configuration and the source of each setting
+// to --out, or to stdout
+func (c *Controller) runConfigShow() {
+	var buf bytes.Buffer
+	if err := cli.WriteSettings(&buf, c.config.Format); err != nil {
+		c.logger.Error("Error showing configuration", "error", err)
+		os.Exit(1)
+	}
+
+	if c.config.OutputPath == "" {
+		os.Stdout.Write(buf.Bytes())
+		return
+	}
+	if err := os.WriteFile(c.config.OutputPath, buf.Bytes(), 0644); err != nil {
+		c.logger.Error("Error writing configuration", "path", c.config.OutputPath, "error", err)
+		os.Exit(1)
+	}
+	c.logger.Info("Configuration written", "path", c.config.OutputPath)
+}
@@ -1,57 +1,485 @@
 package scanner
 
 import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"iter"
 	"log/slog"
+	"net/http"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/squarehole/package-scanner/pkg/archive"
 	"github.com/squarehole/package-scanner/pkg/cli"
 	"github.com/squarehole/package-scanner/pkg/db"
+	"github.com/squarehole/package-scanner/pkg/lockfile"
+	"github.com/squarehole/package-scanner/pkg/logging"
+	"github.com/squarehole/package-scanner/pkg/models"
+	"github.com/squarehole/package-scanner/pkg/noise"
 	"github.com/squarehole/package-scanner/pkg/osv"
+	"github.com/squarehole/package-scanner/pkg/pins"
+	"github.com/squarehole/package-scanner/pkg/policy"
+	"github.com/squarehole/package-scanner/pkg/provenance"
+	"github.com/squarehole/package-scanner/pkg/reachability"
+	"github.com/squarehole/package-scanner/pkg/redact"
+	"github.com/squarehole/package-scanner/pkg/registry"
+	"github.com/squarehole/package-scanner/pkg/remote"
 	"github.com/squarehole/package-scanner/pkg/reporting"
+	"github.com/squarehole/package-scanner/pkg/resolve"
+	"github.com/squarehole/package-scanner/pkg/signature"
+	"github.com/squarehole/package-scanner/pkg/usage"
+	"github.com/squarehole/package-scanner/pkg/version"
+	"github.com/squarehole/package-scanner/pkg/vex"
 )
 
+// ExitFindings is the exit code of a scan whose findings meet the --fail-on threshold.
+// Errors exit with ExitError, and a scan below the threshold with 0.
+const ExitFindings = 2
+
+// ExitError is the exit code of a run that hit an operational error, such as an
+// unreachable API or database. It takes precedence over ExitFindings.
+const ExitError = 1
+
+// vulnerabilitySource answers vulnerability queries for a single package version.
+// It is satisfied by the OSV API client and the offline advisory database.
+type vulnerabilitySource interface {
+	QueryPackage(packageName, packageVersion, packageEcosystem string) (models.ScanResults, []byte, error)
+}
+
 // Controller handles the package scanning operations
 type Controller struct {
+	// ctx bounds the controller's database operations; see WithContext
+	ctx        context.Context
 	config     *cli.Config
-	osvClient  *osv.Client
+	osvClient  vulnerabilitySource
 	reporter   *reporting.Reporter
-	dbInstance *db.PostgresDB
-	logger     *slog.Logger
+	store      db.Store
+	registry   *registry.Client
+	provenance *provenance.Verifier
+	signatures *signature.Verifier
+	vex        *vex.Document
+	policy     *policy.Policy
+	cache      *queryCache
+	// baseline suppresses the findings accepted in the --baseline file
+	baseline *policy.Policy
+	// baselineWriter collects the findings written to the baseline with --write-baseline,
+	// and previousBaseline is the baseline they replace, if there is one
+	baselineWriter   *policy.Baseline
+	previousBaseline *policy.Policy
+	// adaptive adapts the number of workers to the advisory source, with --concurrency=auto
+	adaptive *adaptiveConcurrency
+	// diskCache keeps OSV responses between runs, when --cache-dir is set
+	diskCache *diskCache
+	logger    *slog.Logger
+	// html collects findings for the HTML report, when one is requested
+	html *reporting.HTMLReport
+	// cyclonedx collects the checked packages and findings for the CycloneDX BOM, when one is requested
+	cyclonedx *reporting.CycloneDXReport
+	// pins collects the fixed versions to pin vulnerable packages to, with --pins
+	pins *pins.Set
+	// results collects the checked packages and findings written with --output json, csv,
+	// table or template
+	results *reporting.ResultsReport
+	// resultsTemplate renders the results with --template
+	resultsTemplate *reporting.ResultsTemplate
+	// previousResults are the results given with --compare, and comparison the findings
+	// new and fixed since, once the scan is done
+	previousResults *reporting.ResultsDocument
+	comparison      *reporting.ResultsDiff
+	// stream writes findings as they are found, with --output jsonl
+	stream *reporting.FindingStream
+	// streamFile is the file the stream writes to, when it is not stdout
+	streamFile *os.File
+	// writers receive the results of every checked package as the scan runs: the
+	// console, the stream and those added with WithReportWriter, one call at a time
+	writers   []reporting.ReportWriter
+	writersMu sync.Mutex
+	// archive keeps the run's reports and raw responses in object storage, with --archive
+	archive *archive.Archive
+	// mockOSV serves canned OSV responses in place of the API, with --mock-osv
+	mockOSV *osv.MockServer
+	// recorder and replayer record OSV traffic with --record and play it back with --replay
+	recorder *osv.Recorder
+	replayer *osv.Replayer
+	// state records the artifacts checked by incremental scans, with --incremental
+	state *scanState
+	// checkpoint records the packages checked by a directory scan, with --checkpoint
+	checkpoint *checkpoint
+	// run is the scan run the findings saved to the store are linked to
+	run *scanRun
+	// batch collects findings to save to the store in bulk, with --db-batch-size
+	batch *findingBatch
+	// resolver resolves the dependencies of manifests without a lockfile, with --resolve
+	resolver *resolve.Resolver
+	// noise holds the built-in per-ecosystem filters that are on
+	noise noise.Set
+	// progress passes progress updates to the function given with WithProgress
+	progress *progressTracker
+	// stats times the phases of the scan, with --stats
+	stats *scanStats
+
+	// Per-ecosystem limits for OSV queries and registry lookups
+	osvScheduler      *ecosystemScheduler
+	registryScheduler *ecosystemScheduler
+
+	// usage accounts the resources consumed by the run
+	usage *usage.Tracker
+
+	// exitCode is the exit code the run ends with, see ExitCode
+	exitCode int
+	// failures counts the packages that could not be queried and the saves that failed
+	// during a scan that carried on past them
+	failures atomic.Int64
 }
 
 // NewController creates a new scanner controller
-func NewController(config *cli.Config) *Controller {
+func NewController(config *cli.Config, opts ...ControllerOption) *Controller {
 	// Use the default logger
 	logger := slog.Default()
 
 	controller := &Controller{
-		config:    config,
-		osvClient: osv.NewClient(config.OSVAPI),
-		reporter:  reporting.NewReporter(logger),
-		logger:    logger,
+		ctx:      context.Background(),
+		config:   config,
+		reporter: reporting.NewReporter(logger),
+		cache:    newQueryCache(),
+		logger:   logger,
+
+		osvScheduler:      newEcosystemScheduler(config.EcosystemLimits),
+		registryScheduler: newEcosystemScheduler(config.RegistryLimits),
+
+		usage: usage.Start(),
+	}
+	for _, opt := range opts {
+		opt(controller)
+	}
+	controller.reporter.SummaryOnly = config.SummaryOnly
+	controller.reporter.Condensed = config.Summary
+	if config.Stats != "" {
+		controller.stats = newScanStats()
+	}
+
+	// Text output is read by people, so it follows their locale; JSON keeps raw values
+	// unless a locale is requested explicitly
+	if config.Locale != "" {
+		locale, err := reporting.LookupLocale(config.Locale)
+		if err != nil {
+			logger.Error("Invalid locale", "error", err)
+			os.Exit(1)
+		}
+		controller.reporter.Locale = &locale
+	} else if config.LogFormat == "text" {
+		locale := reporting.EnvironmentLocale()
+		controller.reporter.Locale = &locale
+	}
+
+	// Reports meant for external sharing are redacted as they are written
+	var redactor *redact.Redactor
+	if config.Redact != "" && (config.HTMLReport != "" || config.CycloneDXReport != "" || len(config.Outputs) > 0) {
+		var err error
+		redactor, err = redact.Load(config.Redact)
+		if err != nil {
+			logger.Error("Error loading redaction profile", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if config.HTMLReport != "" {
+		controller.html = reporting.NewHTMLReport()
+		controller.html.Redactor = redactor
+		if config.ReportTranslations != "" {
+			translations, err := reporting.LoadTranslations(config.ReportTranslations)
+			if err != nil {
+				logger.Error("Error loading report translations", "error", err)
+				os.Exit(1)
+			}
+			controller.html.Translations = translations
+		}
+	}
+	if config.CycloneDXReport != "" {
+		controller.cyclonedx = reporting.NewCycloneDXReport(cli.Version)
+		controller.cyclonedx.Redactor = redactor
+	}
+
+	if config.PinsDir != "" {
+		controller.pins = pins.New()
+	}
+
+	// Offline database, key management, configuration, schema, history, export, policy,
+	// search and report commands manage their own resources
+	if strings.HasPrefix(config.Command, "offline ") || strings.HasPrefix(config.Command, "keys ") ||
+		strings.HasPrefix(config.Command, "config ") || strings.HasPrefix(config.Command, "db ") ||
+		config.Command == "history" || config.Command == "export" || strings.HasPrefix(config.Command, "policy ") || config.Command == "search" ||
+		strings.HasPrefix(config.Command, "report ") {
+		return controller
 	}
 
-	// Initialize database if needed
-	if config.UseDB {
-		dbConfig := db.Config{
-			Host:     config.DBHost,
-			Port:     config.DBPort,
-			User:     config.DBUser,
-			Password: config.DBPassword,
-			DBName:   config.DBName,
-			SSLMode:  config.DBSSLMode,
+	if config.FailOn != "" && !slices.Contains(reporting.FailOnThresholds, config.FailOn) {
+		logger.Error("Invalid --fail-on threshold", "failOn", config.FailOn, "available", strings.Join(reporting.FailOnThresholds, ", "))
+		os.Exit(1)
+	}
+	// One scan can write several outputs, each once and to a file of its own, with at
+	// most one going to stdout
+	formats := make(map[string]bool)
+	files := make(map[string]string)
+	for _, output := range config.Outputs {
+		if formats[output.Format] {
+			logger.Error("--output format given more than once", "output", output.Format)
+			os.Exit(1)
+		}
+		formats[output.Format] = true
+		file := config.OutputFile(output)
+		if other, ok := files[file]; ok {
+			logger.Error("--output formats would be written to the same file", "outputs", []string{other, output.Format}, "path", file)
+			os.Exit(1)
+		}
+		files[file] = output.Format
+
+		switch output.Format {
+		case "jsonl":
+			out := os.Stdout
+			if file != "" {
+				f, err := os.Create(file)
+				if err != nil {
+					logger.Error("Error creating finding stream", "path", file, "error", err)
+					os.Exit(1)
+				}
+				controller.streamFile = f
+				out = f
+			}
+			controller.stream = reporting.NewFindingStream(out)
+			controller.stream.Redactor = redactor
+		case "json", "csv", "sarif", "table", "template":
+			if output.Format == "template" {
+				if config.Template == "" {
+					logger.Error("--output template needs a --template file")
+					os.Exit(1)
+				}
+				var err error
+				controller.resultsTemplate, err = reporting.LoadResultsTemplate(config.Template)
+				if err != nil {
+					logger.Error("Error loading results template", "path", config.Template, "error", err)
+					os.Exit(1)
+				}
+			}
+			if controller.results == nil {
+				controller.results = reporting.NewResultsReport(cli.Version)
+				controller.results.Redactor = redactor
+			}
+		default:
+			logger.Error("Unknown output format", "output", output.Format, "available", "json, jsonl, csv, sarif, table, template")
+			os.Exit(1)
 		}
+	}
+
+	// The console comes first and the stream second, ahead of the embedder's writers
+	writers := []reporting.ReportWriter{reporting.NewConsoleWriter(controller.reporter)}
+	if controller.stream != nil {
+		writers = append(writers, controller.stream)
+	}
+	controller.writers = append(writers, controller.writers...)
+
+	// Comparing with earlier results needs the scan's results, whatever the output
+	if config.Compare != "" {
+		previous, err := reporting.LoadResultsDocument(config.Compare)
+		if err != nil {
+			logger.Error("Error loading previous results", "error", err)
+			os.Exit(1)
+		}
+		controller.previousResults = &previous
+		if controller.results == nil {
+			controller.results = reporting.NewResultsReport(cli.Version)
+			controller.results.Redactor = redactor
+		}
+	}
 
+	// Priming only fills the query cache, so it has nothing to archive
+	if config.Archive != "" && config.Command != "prime" {
 		var err error
-		controller.dbInstance, err = db.NewPostgresDB(dbConfig)
+		controller.archive, err = archive.New(config.Archive, time.Now())
+		if err != nil {
+			logger.Error("Error configuring archive", "location", config.Archive, "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Archiving run", "location", config.Archive, "run", controller.archive.RunID())
+	}
+
+	// The mock server stands in for the OSV API, so it is started before the sources
+	if config.MockOSV != "" {
+		mock, err := osv.NewMockServer(os.DirFS(config.MockOSV))
+		if err != nil {
+			logger.Error("Error starting mock OSV server", "fixtures", config.MockOSV, "error", err)
+			os.Exit(1)
+		}
+		controller.mockOSV = mock
+		config.OSVAPI = mock.URL()
+		logger.Warn("Using mock OSV server; results come from fixtures, not real advisories", "fixtures", config.MockOSV, "url", mock.URL())
+	}
+
+	// Recording and replaying hook into the transport of the OSV client
+	var transport http.RoundTripper
+	switch {
+	case config.Record != "" && config.Replay != "":
+		logger.Error("--record and --replay cannot be combined")
+		os.Exit(1)
+	case config.Record != "":
+		controller.recorder = osv.NewRecorder()
+		transport = controller.recorder
+	case config.Replay != "":
+		replayer, err := osv.LoadReplayer(config.Replay)
+		if err != nil {
+			logger.Error("Error loading cassette", "path", config.Replay, "error", err)
+			os.Exit(1)
+		}
+		controller.replayer = replayer
+		transport = replayer
+		logger.Warn("Replaying recorded OSV traffic; results come from the cassette, not the OSV API", "path", config.Replay)
+	}
+
+	// Set up the advisory sources packages are matched against
+	var err error
+	controller.osvClient, controller.diskCache, err = newVulnerabilitySource(config, transport)
+	if err != nil {
+		logger.Error("Error setting up advisory sources", "error", err)
+		os.Exit(1)
+	}
+	if config.Offline {
+		logger.Info("Using offline advisory database", "path", config.OfflineDir)
+	}
+	if config.AutoConcurrency {
+		controller.adaptive = newAdaptiveConcurrency(config.Concurrency)
+		controller.osvClient = adaptiveSource{source: controller.osvClient, concurrency: controller.adaptive}
+		logger.Info("Adapting concurrency to advisory source response times", "start", autoConcurrencyStart, "max", config.Concurrency)
+	}
+
+	// Load VEX statements used to suppress non-exploitable findings
+	if len(config.VEXFiles) > 0 {
+		controller.vex, err = vex.Load(config.VEXFiles...)
+		if err != nil {
+			logger.Error("Error loading VEX documents", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Loaded VEX statements", "files", len(config.VEXFiles), "statements", len(controller.vex.Statements))
+	}
+
+	// Load the policy suppressions, warning about any that no longer apply
+	if config.PolicyFile != "" {
+		controller.policy, err = policy.Load(config.PolicyFile)
+		if err != nil {
+			logger.Error("Error loading policy", "error", err)
+			os.Exit(1)
+		}
+		for _, s := range controller.policy.Expired(time.Now()) {
+			logger.Warn("Policy suppression expired", "id", s.ID, "package", s.Package, "expires", s.Expires)
+		}
+		logger.Info("Loaded policy", "path", config.PolicyFile, "suppressions", len(controller.policy.Suppressions))
+	}
+
+	// Load the baseline of accepted findings, or prepare to write it; while it is written
+	// it is not applied, so every current finding is recorded
+	if config.WriteBaseline && config.Baseline == "" {
+		logger.Error("--write-baseline needs the --baseline file to write")
+		os.Exit(1)
+	}
+	if config.BaselineExpires != "" {
+		if _, err := cli.ParseUntil(config.BaselineExpires); err != nil {
+			logger.Error("Invalid --baseline-expires", "error", err)
+			os.Exit(1)
+		}
+	}
+	if config.WriteBaseline {
+		controller.baselineWriter = policy.NewBaseline()
+		if _, err := os.Stat(config.Baseline); err == nil {
+			controller.previousBaseline, err = policy.Load(config.Baseline)
+			if err != nil {
+				logger.Error("Error loading baseline", "error", err)
+				os.Exit(1)
+			}
+		}
+	} else if config.Baseline != "" {
+		controller.baseline, err = policy.Load(config.Baseline)
+		if err != nil {
+			logger.Error("Error loading baseline", "error", err)
+			os.Exit(1)
+		}
+		for _, s := range controller.baseline.Expired(time.Now()) {
+			logger.Warn("Baseline entry expired", "id", s.ID, "package", s.Package, "expires", s.Expires)
+		}
+		logger.Info("Loaded baseline", "path", config.Baseline, "findings", len(controller.baseline.Suppressions))
+	}
+
+	// Built-in per-ecosystem filters keep noise out of the results unless turned off
+	controller.noise, err = noise.Defaults(config.DisabledDefaultFilters)
+	if err != nil {
+		logger.Error("Error setting up default filters", "error", err)
+		os.Exit(1)
+	}
+
+	// Provenance signatures are verified with the same trust material as artifact signatures
+	if config.VerifyProvenance {
+		var roots *x509.CertPool
+		var key crypto.PublicKey
+		if config.SignatureRoots != "" {
+			if roots, err = signature.LoadRoots(config.SignatureRoots); err != nil {
+				logger.Error("Error setting up provenance verification", "error", err)
+				os.Exit(1)
+			}
+		}
+		if config.CosignKey != "" {
+			if key, err = signature.LoadPublicKey(config.CosignKey); err != nil {
+				logger.Error("Error setting up provenance verification", "error", err)
+				os.Exit(1)
+			}
+		}
+		controller.provenance = provenance.NewVerifier(config.RegistryURLs["npm"], config.RequireProvenance, roots, key)
+	}
+	if config.VerifySignatures {
+		controller.signatures, err = signature.NewVerifier(config.SignatureRoots, config.CosignKey)
 		if err != nil {
-			logger.Error("Error connecting to PostgreSQL", "error", err)
+			logger.Error("Error setting up signature verification", "error", err)
 			os.Exit(1)
 		}
+	}
+
+	// Registry lookups are only needed when reporting outdated packages
+	if config.CheckLatest {
+		controller.registry = registry.NewClient(config.RegistryURLs)
+	}
+
+	if config.ResolveManifests {
+		controller.resolver = resolve.NewResolver(registry.NewClient(config.RegistryURLs))
+		controller.resolver.SkipDev = config.SkipDev
+		controller.resolver.Acquire = controller.registryScheduler.acquire
+		controller.resolver.Warn = controller.reporter.DisplayWarning
+	}
+
+	// Initialize database if needed, unless a store was given
+	if config.UseDB && controller.store == nil {
+		controller.store = controller.openDatabase()
+	}
 
-		// Initialize the database schema
-		if err := controller.dbInstance.InitializeSchema(); err != nil {
+	// A checkpoint records packages as they complete, so their findings must be saved by
+	// then, not held in a batch that an interruption would lose
+	if controller.store != nil && config.DBBatchSize > 0 && config.CheckpointFile == "" {
+		controller.batch = &findingBatch{size: config.DBBatchSize}
+	}
+
+	// Initialize the schema of stores that have one, or only check it when DDL is not allowed
+	if schema, ok := controller.store.(db.SchemaManager); ok {
+		if config.DBNoDDL {
+			if err := schema.VerifySchema(controller.ctx); err != nil {
+				logger.Error("Database schema check failed", "error", err)
+				os.Exit(1)
+			}
+		} else if err := schema.InitializeSchema(controller.ctx); err != nil {
 			logger.Error("Error initializing database schema", "error", err)
 			os.Exit(1)
 		}
@@ -60,140 +488,1517 @@ func NewController(config *cli.Config) *Controller {
 	return controller
 }
 
+// WithContext makes the controller's database operations stop when ctx is done, so a
+// caller embedding the scanner can abandon them, such as on shutdown
+func WithContext(ctx context.Context) ControllerOption {
+	return func(c *Controller) {
+		c.ctx = ctx
+	}
+}
+
+// WithStore persists results to store instead of the PostgreSQL database configured with
+// --use-db, such as another backend or a fake in tests. The controller closes it.
+func WithStore(store db.Store) ControllerOption {
+	return func(c *Controller) {
+		c.store = store
+	}
+}
+
+// WithReportWriter adds a writer receiving the results of every package the scan
+// checks, after the console output and the --output jsonl stream. It can be given more
+// than once.
+func WithReportWriter(w reporting.ReportWriter) ControllerOption {
+	return func(c *Controller) {
+		c.writers = append(c.writers, w)
+	}
+}
+
+// dbNaming returns the schema and table prefix of the configured database tables
+func (c *Controller) dbNaming() db.Naming {
+	return db.Naming{Schema: c.config.DBSchema, TablePrefix: c.config.DBTablePrefix}
+}
+
+// openDatabase connects to the configured PostgreSQL database, exiting on failure
+func (c *Controller) openDatabase() *db.PostgresDB {
+	dbConfig := db.Config{
+		Host:     c.config.DBHost,
+		Port:     c.config.DBPort,
+		User:     c.config.DBUser,
+		Password: c.config.DBPassword,
+		DBName:   c.config.DBName,
+		SSLMode:  c.config.DBSSLMode,
+
+		SSLRootCert: c.config.DBSSLRootCert,
+		SSLCert:     c.config.DBSSLCert,
+		SSLKey:      c.config.DBSSLKey,
+		SSLPassword: c.config.DBSSLPassword,
+
+		KeepHistory: c.config.DBHistory,
+		Naming:      c.dbNaming(),
+
+		MaxOpenConns:    c.config.DBMaxOpenConns,
+		MaxIdleConns:    c.config.DBMaxIdleConns,
+		ConnMaxLifetime: c.config.DBConnLifetime,
+		ConnectTimeout:  c.config.DBConnectTimeout,
+		QueryTimeout:    c.config.DBQueryTimeout,
+	}
+
+	if c.config.DBURL != "" {
+		var err error
+		if dbConfig, err = db.ParseURL(c.config.DBURL, dbConfig); err != nil {
+			c.logger.Error("Invalid PostgreSQL connection URL", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := dbConfig.ValidateTLS(); err != nil {
+		c.logger.Error("Invalid PostgreSQL TLS configuration", "error", err)
+		os.Exit(1)
+	}
+
+	dbInstance, err := db.NewPostgresDB(dbConfig)
+	if err != nil {
+		c.logger.Error("Error connecting to PostgreSQL", "error", err)
+		os.Exit(1)
+	}
+	return dbInstance
+}
+
 // Close cleans up resources
 func (c *Controller) Close() {
-	if c.dbInstance != nil {
-		c.dbInstance.Close()
+	if c.store != nil {
+		c.store.Close()
+	}
+	if c.streamFile != nil {
+		c.streamFile.Close()
+	}
+	if c.mockOSV != nil {
+		c.mockOSV.Close()
 	}
 }
 
 // Run executes the scanning operation based on the current configuration
 func (c *Controller) Run() {
-	// Check if we're in directory scanning mode
-	if c.config.DirectoryPath != "" && c.config.FileExtension != "" {
+	switch c.config.Command {
+	case "":
+	case "offline bundle":
+		c.runOfflineBundle()
+		return
+	case "offline load":
+		c.runOfflineLoad()
+		return
+	case "offline update":
+		c.runOfflineUpdate()
+		return
+	case "keys generate":
+		c.runKeysGenerate()
+		return
+	case "keys rotate":
+		c.runKeysRotate()
+		return
+	case "keys export":
+		c.runKeysExport()
+		return
+	case "config show":
+		c.runConfigShow()
+		return
+	case "db schema":
+		c.runDBSchema()
+		return
+	case "db migrate":
+		c.runDBMigrate()
+		return
+	case "db runs":
+		c.runDBRuns()
+		return
+	case "db diff":
+		c.runDBDiff()
+		return
+	case "db purge":
+		c.runDBPurge()
+		return
+	case "history":
+		c.runHistory()
+		return
+	case "export":
+		c.runExport()
+		return
+	case "policy import":
+		c.runPolicyImport()
+		return
+	case "search":
+		c.runSearch()
+		return
+	case "report aggregate":
+		c.runReportAggregate()
+		return
+	case "report trend":
+		c.runReportTrend()
+		return
+	case "report status":
+		c.runReportStatus()
+		return
+	case "prime":
+		c.runPrime()
+		c.finishCassette()
+		c.recordUsage()
+		return
+	case "scan file":
+		c.startRun()
+		c.startWriters()
+		c.runFileScan()
+		c.finishScan()
+		return
+	default:
+		c.logger.Error("Unknown command", "command", c.config.Command, "available", strings.Join(cli.CommandNames(), ", "))
+		os.Exit(1)
+	}
+
+	c.startRun()
+	c.startWriters()
+	if c.directoryScan() {
 		c.runDirectoryScan()
 	} else {
 		c.runSinglePackageScan()
 	}
+	c.finishScan()
 }
 
-// runSinglePackageScan performs a vulnerability check on a single package
-func (c *Controller) runSinglePackageScan() {
-	// Log query information with structured fields instead of format strings
-	c.logger.Info("Querying OSV API for package",
-		"name", c.config.PackageName,
-		"version", c.config.PackageVersion,
-		"ecosystem", c.config.PackageEcosystem)
+// finishScan saves the findings still pending, writes the reports and records the end
+// of the run once its packages have been scanned, then sets the exit code. Every scan
+// command ends with it, so they all report and fail the same way.
+func (c *Controller) finishScan() {
+	c.flushFindings()
+	c.finishWriters()
+	c.compareResults()
+	c.writeHTMLReport()
+	c.writeCycloneDXReport()
+	c.writeResults()
+	c.writeBaseline()
+	c.writePins()
+	c.finishCassette()
+	c.archiveRun()
+	c.finishRun()
+	c.recordUsage()
+	c.writeStats()
+	c.checkFailOn()
+	c.checkFailures()
+}
 
-	results, body, err := c.osvClient.QueryPackage(
-		c.config.PackageName,
-		c.config.PackageVersion,
-		c.config.PackageEcosystem,
-	)
+// ExitCode returns the exit code the run ends with: ExitError when a package could not
+// be queried or its results saved, ExitFindings when its findings meet the --fail-on
+// threshold, otherwise 0. Other errors end the process with ExitError as they happen.
+func (c *Controller) ExitCode() int {
+	return c.exitCode
+}
+
+// checkFailures fails the run when a package could not be queried or its results could
+// not be saved, so an unreachable API or database does not pass as a clean scan. The
+// scan carries on past such errors, so its reports are still written.
+func (c *Controller) checkFailures() {
+	failures := c.failures.Load()
+	if failures == 0 {
+		return
+	}
+	c.logger.Error("Scan completed with errors", "errors", failures, "exitCode", ExitError)
+	c.exitCode = ExitError
+}
 
+// checkFailOn fails the scan when it found vulnerabilities at or above the --fail-on
+// severity, once every report has been written
+func (c *Controller) checkFailOn() {
+	if c.config.FailOn == "" {
+		return
+	}
+	// Compared with earlier results, only new findings fail the scan
+	totals := c.reporter.Totals()
+	if c.comparison != nil {
+		totals = c.comparison.Totals()
+	}
+	count, err := totals.CountAtLeast(c.config.FailOn)
 	if err != nil {
-		c.logger.Error("Error checking package vulnerabilities", "error", err)
+		c.logger.Error("Invalid --fail-on threshold", "error", err)
 		os.Exit(1)
 	}
+	if count == 0 {
+		c.logger.InfoContext(logging.SummaryContext(context.Background()), "No vulnerabilities at or above the --fail-on threshold", "failOn", c.config.FailOn)
+		return
+	}
+	c.logger.WarnContext(logging.SummaryContext(context.Background()), "Vulnerabilities at or above the --fail-on threshold", "failOn", c.config.FailOn, "count", count, "exitCode", ExitFindings)
+	c.exitCode = ExitFindings
+}
 
-	// Display results
-	c.reporter.DisplayResults(results, c.config.PackageName)
-
-	// Save to database if requested AND vulnerabilities were found
-	if c.config.UseDB && c.dbInstance != nil && len(results.Vulnerabilities) > 0 {
-		err = c.dbInstance.SaveVulnerabilityResults(
-			c.config.PackageName,
-			c.config.PackageEcosystem,
-			c.config.PackageVersion,
-			results.Vulnerabilities,
-			body,
-		)
+// directoryScan reports whether the run scans directories, lockfiles or SBOMs rather
+// than a single package
+func (c *Controller) directoryScan() bool {
+	hasTargets := len(c.config.DirectoryPaths) > 0 || c.config.TargetsFile != ""
+	return (hasTargets && c.config.FileExtension != "") || len(c.config.Lockfiles) > 0 || len(c.config.SBOMFiles) > 0 ||
+		len(c.config.AutoDirs) > 0
+}
 
-		if err != nil {
-			c.logger.Error("Error saving results to database", "error", err)
+// startWriters starts the report writers before the first package is checked
+func (c *Controller) startWriters() {
+	for _, w := range c.writers {
+		if err := w.Start(); err != nil {
+			c.logger.Error("Error starting report writer", "writer", fmt.Sprintf("%T", w), "error", err)
 			os.Exit(1)
 		}
-
-		c.logger.Info("Results saved to database",
-			"packageName", c.config.PackageName,
-			"vulnerabilitiesCount", len(results.Vulnerabilities))
-	} else if c.config.UseDB && len(results.Vulnerabilities) == 0 {
-		c.logger.Info("No vulnerabilities found. Nothing saved to database.")
 	}
+}
 
-	// Write raw response to file
-	err = os.WriteFile("api_response.json", body, 0644)
-	if err != nil {
-		c.logger.Warn("Could not write API response to file", "error", err)
-	} else {
-		c.logger.Info("Raw API response written to api_response.json")
+// writePackageResult hands the results of a checked package to every report writer
+func (c *Controller) writePackageResult(result reporting.PackageResult) {
+	c.writersMu.Lock()
+	defer c.writersMu.Unlock()
+	for _, w := range c.writers {
+		if err := w.WritePackageResult(result); err != nil {
+			c.logger.Error("Error writing package result", "writer", fmt.Sprintf("%T", w), "name", result.Name, "version", result.Version, "error", err)
+			os.Exit(1)
+		}
 	}
 }
 
-// runDirectoryScan scans a directory for packages and checks their vulnerabilities
-func (c *Controller) runDirectoryScan() {
-	c.reporter.DisplayDirectoryScanStart(c.config.DirectoryPath, c.config.FileExtension)
-
-	// Create scanner with the logger
-	packageScanner := NewPackageScanner(c.config.FileExtension, c.config.PackageEcosystem, c.logger)
+// finishWriters ends the scan's report writers with its totals per severity, logged by
+// the console and written as the last line of the finding stream
+func (c *Controller) finishWriters() {
+	totals := c.reporter.Totals()
+	for _, w := range c.writers {
+		if err := w.Finish(totals); err != nil {
+			c.logger.Error("Error finishing report writer", "writer", fmt.Sprintf("%T", w), "error", err)
+			os.Exit(1)
+		}
+	}
+}
 
-	// Scan directory
-	packages, err := packageScanner.ScanDirectory(c.config.DirectoryPath)
-	if err != nil {
-		c.logger.Error("Error scanning directory", "error", err)
+// writeHTMLReport writes the findings collected during the run to the HTML report, if requested
+func (c *Controller) writeHTMLReport() {
+	if c.html == nil {
+		return
+	}
+	if err := c.html.Write(c.config.HTMLReport, c.usage.Elapsed()); err != nil {
+		c.logger.Error("Error writing HTML report", "path", c.config.HTMLReport, "error", err)
 		os.Exit(1)
 	}
+	c.logger.Info("HTML report written", "path", c.config.HTMLReport)
+}
 
-	c.reporter.DisplayPackagesFound(len(packages))
-
-	// Create a semaphore to limit concurrency
-	sem := make(chan bool, c.config.Concurrency)
-	var wg sync.WaitGroup
-
-	// Process each package file
-	for _, pkg := range packages {
-		wg.Add(1)
-		sem <- true // Acquire semaphore
-
-		go func(pkg PackageInfo) {
-			defer wg.Done()
-			defer func() { <-sem }() // Release semaphore
+// writeCycloneDXReport writes the packages checked during the run and their findings to
+// the CycloneDX BOM, if requested
+func (c *Controller) writeCycloneDXReport() {
+	if c.cyclonedx == nil {
+		return
+	}
+	if err := c.cyclonedx.Write(c.config.CycloneDXReport); err != nil {
+		c.logger.Error("Error writing CycloneDX report", "path", c.config.CycloneDXReport, "error", err)
+		os.Exit(1)
+	}
+	c.logger.Info("CycloneDX report written", "path", c.config.CycloneDXReport)
+}
 
-			c.reporter.DisplayPackageScanStart(pkg.Name, pkg.Version, pkg.Ecosystem)
+// resultsFormats are the --output formats written from the results once the scan is done
+var resultsFormats = []string{"json", "csv", "sarif", "table", "template"}
 
-			// Run vulnerability check for this package
-			results, body, err := c.osvClient.QueryPackage(pkg.Name, pkg.Version, pkg.Ecosystem)
-			if err != nil {
-				c.reporter.DisplayError("Error checking %s@%s: %v", pkg.Name, pkg.Version, err)
-				return
-			}
+// compareResults reports the findings new and fixed since the results given with
+// --compare, and adds them to the results written with --output
+func (c *Controller) compareResults() {
+	if c.previousResults == nil {
+		return
+	}
+	diff := reporting.CompareResults(*c.previousResults, c.results.Document(0))
+	c.comparison = &diff
+	c.results.Comparison = &diff
+	c.reporter.DisplayResultsDiff(diff)
+}
 
-			// Display results
-			c.reporter.DisplayResults(results, pkg.Name)
+// writeResults writes the results of the run as a JSON document, CSV, a SARIF log, a table
+// and through the results template, as requested, each to its file or stdout
+func (c *Controller) writeResults() {
+	for _, output := range c.config.Outputs {
+		if slices.Contains(resultsFormats, output.Format) {
+			c.writeResultsOutput(output)
+		}
+	}
+}
 
-			// Save to database if requested AND vulnerabilities were found
-			if c.config.UseDB && c.dbInstance != nil && len(results.Vulnerabilities) > 0 {
-				err = c.dbInstance.SaveVulnerabilityResults(
-					pkg.Name,
-					pkg.Ecosystem,
-					pkg.Version,
-					results.Vulnerabilities,
-					body,
-				)
+// writeResultsOutput writes the results of the run in the format of one output
+func (c *Controller) writeResultsOutput(output cli.ReportOutput) {
+	write := func(w io.Writer) error {
+		switch output.Format {
+		case "csv":
+			return c.results.WriteCSV(w)
+		case "sarif":
+			return c.results.WriteSARIF(w)
+		case "table":
+			return c.results.WriteTable(w)
+		case "template":
+			return c.results.WriteTemplate(w, c.resultsTemplate, c.usage.Elapsed())
+		}
+		return c.results.Write(w, c.usage.Elapsed())
+	}
+	path := c.config.OutputFile(output)
+	if path == "" {
+		if err := write(os.Stdout); err != nil {
+			c.logger.Error("Error writing results", "output", output.Format, "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		c.logger.Error("Error creating results file", "output", output.Format, "path", path, "error", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	if err := write(f); err != nil {
+		c.logger.Error("Error writing results", "output", output.Format, "path", path, "error", err)
+		os.Exit(1)
+	}
+	c.logger.Info("Results written", "output", output.Format, "path", path)
+}
 
-				if err != nil {
-					c.reporter.DisplayError("Error saving results to database for %s: %v", pkg.Name, err)
-				} else {
-					c.reporter.DisplayInfo("Results for %s@%s saved to database.", pkg.Name, pkg.Version)
-				}
-			} else if c.config.UseDB && len(results.Vulnerabilities) == 0 {
-				c.reporter.DisplayInfo("No vulnerabilities found for %s@%s. Nothing saved to database.", pkg.Name, pkg.Version)
-			}
-		}(pkg)
+// writeBaseline writes the findings of the run to the --baseline file, if requested
+func (c *Controller) writeBaseline() {
+	if c.baselineWriter == nil {
+		return
 	}
+	expires := ""
+	if c.config.BaselineExpires != "" {
+		until, err := cli.ParseUntil(c.config.BaselineExpires)
+		if err != nil {
+			c.logger.Error("Invalid --baseline-expires", "error", err)
+			os.Exit(1)
+		}
+		expires = until.Format("2006-01-02")
+	}
+	kept, added, err := c.baselineWriter.Write(c.config.Baseline, c.previousBaseline, expires, time.Now())
+	if err != nil {
+		c.logger.Error("Error writing baseline", "error", err)
+		os.Exit(1)
+	}
+	c.logger.Info("Baseline written", "path", c.config.Baseline, "kept", kept, "added", added, "expires", expires)
+}
 
-	// Wait for all goroutines to complete
+// writePins writes the pin files of the vulnerable packages found during the run, if requested
+func (c *Controller) writePins() {
+	if c.pins == nil {
+		return
+	}
+	for _, unfixed := range c.pins.Unfixed() {
+		c.logger.Warn("No fixed version to pin to",
+			"name", unfixed.Name,
+			"version", unfixed.Version,
+			"ecosystem", unfixed.Ecosystem,
+			"advisories", unfixed.Advisories)
+	}
+	written, unsupported, err := c.pins.Write(c.config.PinsDir)
+	if err != nil {
+		c.logger.Error("Error writing pins", "error", err)
+		os.Exit(1)
+	}
+	if len(unsupported) > 0 {
+		c.logger.Warn("No pin file format for ecosystems", "ecosystems", unsupported)
+	}
+	if len(written) == 0 {
+		c.logger.Info("No fixed versions to pin")
+		return
+	}
+	c.logger.Info("Pin files written", "files", written)
+}
+
+// finishCassette writes the OSV traffic recorded during the run with --record, and
+// warns about queries a cassette replayed with --replay had no response for
+func (c *Controller) finishCassette() {
+	if c.replayer != nil {
+		if misses := c.replayer.Misses(); misses > 0 {
+			c.logger.Warn("Queries not found in the cassette failed", "path", c.config.Replay, "count", misses)
+		}
+	}
+	if c.recorder == nil {
+		return
+	}
+	if err := c.recorder.Save(c.config.Record); err != nil {
+		c.logger.Error("Error writing cassette", "path", c.config.Record, "error", err)
+		os.Exit(1)
+	}
+	c.logger.Info("OSV traffic recorded", "path", c.config.Record, "interactions", c.recorder.Len())
+}
+
+// archiveRun uploads the run's report files and its JSON report to the archive, if one is configured
+func (c *Controller) archiveRun() {
+	if c.archive == nil {
+		return
+	}
+
+	type reportFile struct{ path, contentType string }
+	var files []reportFile
+	if c.html != nil {
+		files = append(files, reportFile{c.config.HTMLReport, "text/html; charset=utf-8"})
+	}
+	if c.cyclonedx != nil {
+		files = append(files, reportFile{c.config.CycloneDXReport, "application/vnd.cyclonedx+json"})
+	}
+	for _, output := range c.config.Outputs {
+		path := c.config.OutputFile(output)
+		if path == "" {
+			continue
+		}
+		contentType := "application/json"
+		switch output.Format {
+		case "jsonl":
+			contentType = "application/x-ndjson"
+		case "csv":
+			contentType = "text/csv; charset=utf-8"
+		case "sarif":
+			contentType = "application/sarif+json"
+		case "table", "template":
+			contentType = "text/plain; charset=utf-8"
+		}
+		files = append(files, reportFile{path, contentType})
+	}
+	for _, file := range files {
+		location, err := c.archive.AddFile(file.path, file.contentType)
+		if err != nil {
+			c.logger.Error("Error archiving report", "path", file.path, "error", err)
+			os.Exit(1)
+		}
+		c.logger.Debug("Report archived", "path", file.path, "location", location)
+	}
+
+	command := c.config.Command
+	if command == "" {
+		command = "scan"
+	}
+	location, err := c.archive.Finish(command, c.config.Labels)
+	if err != nil {
+		c.logger.Error("Error archiving run report", "error", err)
+		os.Exit(1)
+	}
+	c.logger.Info("Run archived", "run", c.archive.RunID(), "report", location)
+}
+
+// archiveResponse uploads a raw advisory response to the archive and returns the body to
+// store in the database: a pointer to the archived copy, or the response itself when the
+// run is not archived or the upload failed
+func (c *Controller) archiveResponse(name, pkgVersion, ecosystem string, body []byte) []byte {
+	if c.archive == nil {
+		return body
+	}
+	location, err := c.archive.AddResponse(name, pkgVersion, ecosystem, body)
+	if err != nil {
+		c.reporter.DisplayWarning("Could not archive advisory response for %s@%s: %v", name, pkgVersion, err)
+		return body
+	}
+	return archive.Pointer(location)
+}
+
+// recordUsage reports the resources consumed by a scan run and saves them to the
+// database, labelled for charge-back, when results are stored
+func (c *Controller) recordUsage() {
+	runUsage := c.usage.Snapshot()
+	c.reporter.DisplayResourceUsage(runUsage)
+
+	if c.store != nil {
+		command := c.config.Command
+		if command == "" {
+			command = "scan"
+		}
+		if err := c.store.SaveRunUsage(c.ctx, command, c.config.Labels, runUsage); err != nil {
+			c.logger.Error("Error saving run usage to database", "error", err)
+		}
+	}
+}
+
+// logAdaptiveConcurrency reports the number of workers --concurrency=auto settled on
+func (c *Controller) logAdaptiveConcurrency() {
+	if c.adaptive == nil {
+		return
+	}
+	current, peak := c.adaptive.limits()
+	c.logger.Info("Adaptive concurrency", "workers", current, "peak", peak, "max", c.config.Concurrency)
+}
+
+// writeStats writes the timing of the scan's phases, with --stats
+func (c *Controller) writeStats() {
+	if c.stats == nil {
+		return
+	}
+	concurrency := c.config.Concurrency
+	if c.adaptive != nil {
+		_, concurrency = c.adaptive.limits()
+	}
+	report := c.stats.report(c.usage.Elapsed(), concurrency, c.cache.size())
+	if err := report.write(c.config.Stats); err != nil {
+		c.logger.Error("Error writing scan stats", "error", err)
+		os.Exit(1)
+	}
+	if c.config.Stats != "-" {
+		c.logger.Info("Scan stats written", "path", c.config.Stats)
+	}
+}
+
+// runSinglePackageScan performs a vulnerability check on a single package
+func (c *Controller) runSinglePackageScan() {
+	// Log query information with structured fields instead of format strings
+	c.logger.Info("Querying OSV API for package",
+		"name", c.config.PackageName,
+		"version", c.config.PackageVersion,
+		"ecosystem", c.config.PackageEcosystem)
+
+	queried := c.stats.start(phaseAPI)
+	results, body, err := c.osvClient.QueryPackage(
+		c.config.PackageName,
+		c.queryVersion(c.config.PackageName, c.config.PackageVersion, c.config.PackageEcosystem),
+		c.config.PackageEcosystem,
+	)
+	queried()
+
+	if err != nil {
+		c.logger.Error("Error checking package vulnerabilities", "error", err)
+		os.Exit(1)
+	}
+
+	stored := c.archiveResponse(c.config.PackageName, c.config.PackageVersion, c.config.PackageEcosystem, body)
+	results = c.applySuppressions(c.config.PackageName, c.config.PackageVersion, c.config.PackageEcosystem, results)
+
+	c.run.record(results.Vulnerabilities)
+
+	c.writePackageResult(reporting.PackageResult{
+		Name:            c.config.PackageName,
+		Version:         c.config.PackageVersion,
+		Ecosystem:       c.config.PackageEcosystem,
+		Vulnerabilities: results.Vulnerabilities,
+	})
+	if c.html != nil {
+		c.html.Add(c.config.PackageName, c.config.PackageVersion, c.config.PackageEcosystem, "", "", results.Vulnerabilities)
+	}
+	if c.cyclonedx != nil {
+		c.cyclonedx.Add(c.config.PackageName, c.config.PackageVersion, c.config.PackageEcosystem, "", "", results.Vulnerabilities)
+	}
+	if c.results != nil {
+		c.results.Add(c.config.PackageName, c.config.PackageVersion, c.config.PackageEcosystem, "", "", results.Vulnerabilities)
+	}
+	if c.baselineWriter != nil {
+		c.baselineWriter.Add(c.config.PackageName, c.config.PackageEcosystem, results.Vulnerabilities)
+	}
+	if c.archive != nil {
+		c.archive.AddResult(archive.PackageResult{
+			Name:            c.config.PackageName,
+			Version:         c.config.PackageVersion,
+			Ecosystem:       c.config.PackageEcosystem,
+			Vulnerabilities: results.Vulnerabilities,
+		})
+	}
+
+	if c.registry != nil {
+		c.reportLatestVersion(c.config.PackageName, c.config.PackageVersion, c.config.PackageEcosystem, results)
+	}
+
+	// Save to database if requested AND vulnerabilities were found, or with --record-clean
+	// record that the package was found clean
+	if c.store != nil && len(results.Vulnerabilities) > 0 {
+		saved := c.stats.start(phaseDB)
+		err = c.store.SaveVulnerabilityResults(
+			c.ctx,
+			c.run.runID(),
+			c.config.PackageName,
+			c.config.PackageEcosystem,
+			c.config.PackageVersion,
+			"",
+			results.Vulnerabilities,
+			stored,
+		)
+		saved()
+
+		if err != nil {
+			c.logger.Error("Error saving results to database", "error", err)
+			os.Exit(1)
+		}
+
+		c.logger.Info("Results saved to database",
+			"packageName", c.config.PackageName,
+			"vulnerabilitiesCount", len(results.Vulnerabilities))
+	} else if c.store != nil && c.config.RecordClean {
+		saved := c.stats.start(phaseDB)
+		err = c.store.SaveCleanScan(c.ctx, c.run.runID(), c.config.PackageName, c.config.PackageEcosystem, c.config.PackageVersion, "")
+		saved()
+
+		if err != nil {
+			c.logger.Error("Error recording clean scan in database", "error", err)
+			os.Exit(1)
+		}
+
+		c.logger.Info("No vulnerabilities found. Clean scan recorded in database.",
+			"packageName", c.config.PackageName)
+	} else if c.store != nil && len(results.Vulnerabilities) == 0 {
+		c.logger.Info("No vulnerabilities found. Nothing saved to database.")
+	}
+
+	// Write raw response to file
+	err = os.WriteFile("api_response.json", body, 0644)
+	if err != nil {
+		c.logger.Warn("Could not write API response to file", "error", err)
+	} else {
+		c.logger.Info("Raw API response written to api_response.json")
+	}
+}
+
+// runFileScan scans a single artifact file, or artifacts streamed over stdin
+func (c *Controller) runFileScan() {
+	if c.config.FileExtension == "" {
+		c.logger.Error("scan file requires --ext to identify the artifact type")
+		os.Exit(1)
+	}
+
+	packageScanner := NewPackageScanner(c.config.FileExtension, c.config.PackageEcosystem, c.logger)
+	packageScanner.Filter = c.artifactFilter()
+	packageScanner.NuspecDependencies = c.config.NuspecDependencies
+
+	var packages []PackageInfo
+	var err error
+	label := "stdin"
+	parsed := c.stats.start(phaseParse)
+	switch {
+	case c.config.Stdin:
+		packages, err = packageScanner.ScanStream(os.Stdin, c.config.ArtifactName)
+	case len(c.config.CommandArgs) == 1:
+		label = c.config.CommandArgs[0]
+		fileScanner := packageScanner.forFile(label)
+		if fileScanner == nil {
+			if strings.Contains(packageScanner.FileExtension, ",") {
+				err = fmt.Errorf("file name does not end in any of the extensions %s", packageScanner.FileExtension)
+				break
+			}
+			// A single extension identifies the artifact type whatever the file is called
+			fileScanner = packageScanner
+		}
+		if inspect := fileScanner.inspector(); inspect != nil {
+			packages, err = fileScanner.inspectFile(label, filepath.Base(label), inspect)
+			break
+		}
+		var pkg PackageInfo
+		pkg, err = fileScanner.ExtractPackageInfo(filepath.Base(label))
+		pkg.FilePath = label
+		pkg.Checksum = fileScanner.artifactChecksum(label)
+		packages = []PackageInfo{pkg}
+	default:
+		c.logger.Error("scan file requires --stdin or a single artifact path, e.g. scan file --stdin --name Example.1.0.0.nupkg --ext nupkg")
+		os.Exit(1)
+	}
+	parsed()
+	if err != nil {
+		c.logger.Error("Error identifying artifact", "source", label, "error", err)
+		os.Exit(1)
+	}
+
+	c.scanDiscovered([]string{label}, []iter.Seq2[PackageInfo, error]{packageList(packages)})
+}
+
+// runDirectoryScan scans directories, lockfiles and SBOMs for packages and checks their vulnerabilities
+func (c *Controller) runDirectoryScan() {
+	targets, err := c.scanTargets()
+	if err != nil {
+		c.logger.Error("Error reading scan targets", "error", err)
+		os.Exit(1)
+	}
+
+	// Create scanner with the logger
+	packageScanner := NewPackageScanner(c.config.FileExtension, c.config.PackageEcosystem, c.logger)
+	packageScanner.Filter = c.artifactFilter()
+	packageScanner.NuspecDependencies = c.config.NuspecDependencies
+	packageScanner.MaxDepth = c.config.MaxDepth
+	packageScanner.FollowSymlinks = c.config.FollowSymlinks
+	packageScanner.WalkerConcurrency = c.config.WalkerConcurrency
+	for _, target := range targets {
+		if target.project {
+			packageScanner.ProjectRoots = append(packageScanner.ProjectRoots, target.path)
+		}
+	}
+	packageScanner.Coverage = NewCoverage()
+	packageScanner.stats = c.stats
+	if c.progress != nil {
+		packageScanner.Progress = c.progress.fileDiscovered
+	}
+	if c.config.Incremental {
+		state, err := loadScanState(c.config.StateFile, c.config.StateFreshness)
+		if err != nil {
+			c.logger.Error("Error loading scan state", "error", err)
+			os.Exit(1)
+		}
+		c.state = state
+		packageScanner.state = state
+	}
+
+	// Lockfiles, manifests and SBOMs are read up front, in parallel, so reachability hints can be
+	// added; directories and remote locations are walked while their packages are
+	// being checked
+	found := make([][]PackageInfo, len(targets))
+	scanErrors := make([]error, len(targets))
+	var scanWg sync.WaitGroup
+
+	for i, target := range targets {
+		switch {
+		case target.lockfile:
+			c.reporter.DisplayLockfileScanStart(target.path)
+		case target.manifest:
+			c.reporter.DisplayManifestScanStart(target.path)
+		case target.sbom:
+			c.reporter.DisplaySBOMScanStart(target.path)
+		default:
+			c.reporter.DisplayDirectoryScanStart(target.path, c.config.FileExtension)
+		}
+
+		if target.directory() {
+			continue
+		}
+		scanWg.Add(1)
+		go func(i int, target scanTarget) {
+			defer scanWg.Done()
+			switch {
+			case target.lockfile:
+				defer c.stats.start(phaseParse)()
+				found[i], scanErrors[i] = lockfilePackages(target.path, lockfileFilter{
+					skipDev:         c.config.SkipDev,
+					skipUnpublished: c.config.SkipUnpublished,
+				})
+			case target.manifest:
+				defer c.stats.start(phaseParse)()
+				found[i], scanErrors[i] = manifestPackages(c.resolver, target.path, lockfileFilter{
+					skipDev: c.config.SkipDev,
+				})
+			default:
+				defer c.stats.start(phaseParse)()
+				found[i], scanErrors[i] = packageScanner.sbomPackages(target.path)
+			}
+		}(i, target)
+	}
+	scanWg.Wait()
+
+	paths := make([]string, len(targets))
+	for i, err := range scanErrors {
+		if err != nil {
+			c.logger.Error("Error scanning target", "path", targets[i].path, "error", err)
+			os.Exit(1)
+		}
+		paths[i] = targets[i].path
+	}
+
+	if c.config.Reachability {
+		c.annotateReachability(targets, found)
+	}
+
+	sources := make([]iter.Seq2[PackageInfo, error], len(targets))
+	for i, target := range targets {
+		switch {
+		case remote.IsRemote(target.path) && target.directory():
+			sources[i] = packageScanner.ScanRemoteStream(target.path)
+		case target.directory():
+			sources[i] = packageScanner.ScanDirectoryStream(target.path)
+		default:
+			sources[i] = packageList(found[i])
+		}
+	}
+	found = nil
+
+	if c.config.CheckpointFile != "" {
+		c.checkpoint, err = openCheckpoint(c.config.CheckpointFile, c.config.Resume, paths, c.config.FileExtension)
+		if err != nil {
+			c.logger.Error("Error opening checkpoint", "error", err)
+			os.Exit(1)
+		}
+	} else if c.config.Resume {
+		c.logger.Error("--resume needs the --checkpoint file of the interrupted scan")
+		os.Exit(1)
+	}
+
+	c.scanDiscovered(paths, sources)
+
+	// The scan completed, so there is nothing left to resume
+	if err := c.checkpoint.finish(); err != nil {
+		c.logger.Warn("Could not remove checkpoint", "error", err)
+	}
+
+	if c.state != nil {
+		if err := c.state.save(); err != nil {
+			c.logger.Warn("Could not save scan state", "error", err)
+		}
+	}
+
+	// Coverage applies to the artifacts of directories and remote locations
+	if coverage := packageScanner.Coverage.Summaries(); len(coverage) > 0 {
+		c.reporter.DisplayCoverage(coverage)
+	}
+}
+
+// packageList yields packages that were discovered up front
+func packageList(packages []PackageInfo) iter.Seq2[PackageInfo, error] {
+	return func(yield func(PackageInfo, error) bool) {
+		for _, pkg := range packages {
+			if !yield(pkg, nil) {
+				return
+			}
+		}
+	}
+}
+
+// discovered is a package found in the target at index target of a scan
+type discovered struct {
+	target int
+	pkg    PackageInfo
+}
+
+// scanDiscovered checks the packages discovered in each target, where sources[i] yields
+// the packages of paths[i], and reports per-target and combined summaries. In
+// summary-only mode the per-ecosystem summaries are reported as well. The targets are
+// read in parallel and packages are checked as they arrive, so checking starts before
+// discovery ends; a discovery error aborts the scan.
+// Discover, query and persist form a bounded pipeline: discovery waits while
+// --max-in-flight packages are queued or being checked, so memory stays flat however
+// many packages the targets hold.
+func (c *Controller) scanDiscovered(paths []string, sources []iter.Seq2[PackageInfo, error]) {
+	limit := max(c.config.MaxInFlight, c.config.Concurrency)
+	inFlight := make(chan struct{}, limit)
+	release := func() { <-inFlight }
+
+	queue := make(chan discovered, c.config.Concurrency)
+	var discoverWg sync.WaitGroup
+	for i, source := range sources {
+		discoverWg.Add(1)
+		go func(i int, source iter.Seq2[PackageInfo, error]) {
+			defer discoverWg.Done()
+			for pkg, err := range source {
+				if err != nil {
+					c.logger.Error("Error scanning target", "path", paths[i], "error", err)
+					os.Exit(1)
+				}
+				inFlight <- struct{}{}
+				queue <- discovered{target: i, pkg: pkg}
+			}
+		}(i, source)
+	}
+	go func() {
+		discoverWg.Wait()
+		close(queue)
+	}()
+
+	// Large scans check the environment with one package before starting every worker,
+	// so the first packages are held back until the threshold is reached or discovery
+	// ends. Held packages are in flight, so no more are held than the limit allows.
+	var held []discovered
+	if threshold := min(c.config.SelfTestThreshold, limit); threshold > 0 {
+		for len(held) < threshold {
+			item, ok := <-queue
+			if !ok {
+				break
+			}
+			held = append(held, item)
+		}
+		if len(held) >= threshold {
+			if err := c.selfTest(held[0].pkg); err != nil {
+				c.logger.Error("Self-test failed, aborting scan", "error", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	// Per-directory summaries are updated concurrently by the workers
+	summaries := make([]reporting.DirectorySummary, len(paths))
+	for i, path := range paths {
+		summaries[i] = reporting.DirectorySummary{Path: path}
+	}
+	ecosystems := make(map[string]*reporting.EcosystemSummary)
+	var summaryMu sync.Mutex
+
+	// Create a semaphore to limit concurrency; with --concurrency=auto it bounds the
+	// adaptive limit
+	sem := make(chan bool, c.config.Concurrency)
+	var wg sync.WaitGroup
+
+	// tally adds the outcome of checking a package to the summaries
+	tally := func(i int, pkg PackageInfo, outcome scanOutcome, err error) {
+		summaryMu.Lock()
+		defer summaryMu.Unlock()
+		ecosystem := ecosystems[pkg.Ecosystem]
+		if err != nil {
+			summaries[i].Errors++
+			ecosystem.Errors++
+			c.failures.Add(1)
+			return
+		}
+		if outcome.vulnerabilities > 0 {
+			summaries[i].VulnerablePackages++
+			summaries[i].Vulnerabilities += outcome.vulnerabilities
+			ecosystem.VulnerablePackages++
+			ecosystem.Vulnerabilities += outcome.vulnerabilities
+		}
+		summaries[i].Suppressed += outcome.suppressed
+		ecosystem.Suppressed += outcome.suppressed
+		summaries[i].SupplyChainFindings += outcome.supplyChainFindings
+		summaries[i].SignatureFindings += outcome.signatureFindings
+	}
+
+	// Process each package as it is discovered, across all targets
+	totalPackages := 0
+	dispatch := func(item discovered) {
+		totalPackages++
+		summaryMu.Lock()
+		summaries[item.target].Packages++
+		if ecosystems[item.pkg.Ecosystem] == nil {
+			ecosystems[item.pkg.Ecosystem] = &reporting.EcosystemSummary{Ecosystem: item.pkg.Ecosystem}
+		}
+		ecosystems[item.pkg.Ecosystem].Packages++
+		summaryMu.Unlock()
+		c.progress.packageFound(item.pkg)
+		c.stats.packageFound()
+
+		// Packages checked before a resumed scan was interrupted are reported again from
+		// the checkpoint; their results were saved before they were recorded in it
+		if outcome, ok := c.checkpoint.lookup(paths[item.target], item.pkg); ok {
+			c.reportPackage(item.pkg, paths[item.target], outcome.findings)
+			c.state.done(item.pkg.FilePath, outcome.vulnerabilities+outcome.suppressed > 0, nil)
+			tally(item.target, item.pkg, outcome, nil)
+			c.progress.packageQueried(item.pkg, outcome.vulnerabilities, nil)
+			release()
+			return
+		}
+
+		wg.Add(1)
+		c.adaptive.acquire()
+		sem <- true // Acquire semaphore
+
+		go func(i int, pkg PackageInfo) {
+			defer wg.Done()
+			defer release()
+			defer c.adaptive.release()
+			defer func() { <-sem }() // Release semaphore
+
+			outcome, err := c.scanPackage(pkg, paths[i])
+			c.state.done(pkg.FilePath, outcome.vulnerabilities+outcome.suppressed > 0, err)
+			if err == nil {
+				if err := c.checkpoint.add(paths[i], pkg, outcome); err != nil {
+					c.logger.Warn("Could not update checkpoint", "error", err)
+				}
+			}
+			tally(i, pkg, outcome, err)
+			c.progress.packageQueried(pkg, outcome.vulnerabilities, err)
+		}(item.target, item.pkg)
+	}
+	for _, item := range held {
+		dispatch(item)
+	}
+	held = nil
+	for item := range queue {
+		dispatch(item)
+	}
+	c.progress.discoveryFinished()
+
+	// Discovery has ended; wait for the remaining checks to complete
+	c.reporter.DisplayPackagesFound(totalPackages)
 	wg.Wait()
+	c.logAdaptiveConcurrency()
+
+	if restored := c.checkpoint.restoredPackages(); restored > 0 {
+		c.logger.Info("Packages checked before the scan was interrupted were skipped", "count", restored)
+	}
+
+	if len(paths) > 1 || c.config.SummaryOnly {
+		for _, summary := range summaries {
+			c.reporter.DisplayDirectorySummary(summary)
+		}
+	}
+
+	if c.config.SummaryOnly {
+		names := make([]string, 0, len(ecosystems))
+		for name := range ecosystems {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			c.reporter.DisplayEcosystemSummary(*ecosystems[name])
+		}
+	}
+
+	c.reporter.DisplayCombinedSummary(summaries, c.cache.size(), c.cache.shared(), c.usage.Elapsed())
+}
+
+// scanOutcome holds the per-package counts used for scan summaries
+type scanOutcome struct {
+	vulnerabilities     int
+	suppressed          int
+	supplyChainFindings int
+	signatureFindings   int
+	// findings are the vulnerabilities reported, after suppressions
+	findings []models.Vulnerability
+}
+
+// scanPackage queries a single discovered package and persists its results.
+// Target is the directory, lockfile or SBOM the package was discovered in.
+func (c *Controller) scanPackage(pkg PackageInfo, target string) (scanOutcome, error) {
+	c.reporter.DisplayPackageScanStart(pkg.Name, pkg.Version, pkg.Ecosystem, pkg.Checksum)
+
+	// Run vulnerability check for this package, sharing results across directories
+	results, body, cached, err := c.queryPackage(pkg.Name, pkg.Version, pkg.Ecosystem)
+	if err != nil {
+		c.reporter.DisplayError("Error checking %s@%s: %v", pkg.Name, pkg.Version, err)
+		return scanOutcome{}, err
+	}
+
+	// Responses served from the cache were archived when they were first received
+	if !cached {
+		body = c.archiveResponse(pkg.Name, pkg.Version, pkg.Ecosystem, body)
+	}
+
+	found := len(results.Vulnerabilities)
+	results = c.applySuppressions(pkg.Name, pkg.Version, pkg.Ecosystem, results)
+	outcome := scanOutcome{
+		vulnerabilities: len(results.Vulnerabilities),
+		suppressed:      found - len(results.Vulnerabilities),
+		findings:        results.Vulnerabilities,
+	}
+	c.reportPackage(pkg, target, results.Vulnerabilities)
+
+	// Provenance belongs to the artifact, so it is checked even for cached query results
+	if c.provenance != nil {
+		// Remote artifacts are not kept, so only their registry provenance is checked
+		filePath := pkg.FilePath
+		if remote.IsRemote(filePath) {
+			filePath = ""
+		}
+		findings := c.provenance.Verify(pkg.Name, pkg.Version, pkg.Ecosystem, filePath)
+		if len(findings) > 0 {
+			c.reporter.DisplaySupplyChainFindings(findings)
+		}
+		if c.stream != nil {
+			c.stream.AddSupplyChainFindings(reporting.StreamSupplyChain, findings)
+		}
+		outcome.supplyChainFindings = len(findings)
+	}
+
+	// Signatures are only checked on artifacts on disk; remote artifacts are not kept
+	if c.signatures != nil && !remote.IsRemote(pkg.FilePath) {
+		findings := c.signatures.Verify(pkg.Name, pkg.Version, pkg.Ecosystem, pkg.FilePath)
+		if len(findings) > 0 {
+			c.reporter.DisplaySignatureFindings(findings)
+		}
+		if c.stream != nil {
+			c.stream.AddSupplyChainFindings(reporting.StreamSignature, findings)
+		}
+		outcome.signatureFindings = len(findings)
+	}
+
+	// Results served from the cache have already been reported and persisted
+	if cached {
+		return outcome, nil
+	}
+
+	if c.registry != nil {
+		c.reportLatestVersion(pkg.Name, pkg.Version, pkg.Ecosystem, results)
+	}
+
+	// Save to database if requested AND vulnerabilities were found, or with --record-clean
+	// record that the package was found clean
+	if c.batch != nil && (len(results.Vulnerabilities) > 0 || c.config.RecordClean) {
+		c.saveBatch(c.batch.add(db.PackageFindings{
+			PackageName:     pkg.Name,
+			Ecosystem:       pkg.Ecosystem,
+			Version:         pkg.Version,
+			Checksum:        pkg.Checksum,
+			Vulnerabilities: results.Vulnerabilities,
+			RawResponse:     body,
+		}))
+	} else if c.store != nil && len(results.Vulnerabilities) > 0 {
+		saved := c.stats.start(phaseDB)
+		err = c.store.SaveVulnerabilityResults(
+			c.ctx,
+			c.run.runID(),
+			pkg.Name,
+			pkg.Ecosystem,
+			pkg.Version,
+			pkg.Checksum,
+			results.Vulnerabilities,
+			body,
+		)
+		saved()
+
+		if err != nil {
+			c.reporter.DisplayError("Error saving results to database for %s: %v", pkg.Name, err)
+			c.failures.Add(1)
+		} else {
+			c.reporter.DisplayInfo("Results for %s@%s saved to database.", pkg.Name, pkg.Version)
+		}
+	} else if c.store != nil && c.config.RecordClean {
+		saved := c.stats.start(phaseDB)
+		err = c.store.SaveCleanScan(c.ctx, c.run.runID(), pkg.Name, pkg.Ecosystem, pkg.Version, pkg.Checksum)
+		saved()
+
+		if err != nil {
+			c.reporter.DisplayError("Error recording clean scan of %s in database: %v", pkg.Name, err)
+			c.failures.Add(1)
+		} else {
+			c.reporter.DisplayInfo("No vulnerabilities found for %s@%s. Clean scan recorded in database.", pkg.Name, pkg.Version)
+		}
+	} else if c.store != nil && len(results.Vulnerabilities) == 0 {
+		c.reporter.DisplayInfo("No vulnerabilities found for %s@%s. Nothing saved to database.", pkg.Name, pkg.Version)
+	}
+
+	return outcome, nil
+}
+
+// reportPackage adds a checked package and the vulnerabilities reported for it to the
+// run's totals, reports, baseline, pins and archive
+func (c *Controller) reportPackage(pkg PackageInfo, target string, vulnerabilities []models.Vulnerability) {
+	c.run.record(vulnerabilities)
+
+	location := pkg.FilePath
+	if location == "" {
+		location = target
+	}
+	c.writePackageResult(reporting.PackageResult{
+		Name:            pkg.Name,
+		Version:         pkg.Version,
+		Ecosystem:       pkg.Ecosystem,
+		Location:        location,
+		Checksum:        pkg.Checksum,
+		Vulnerabilities: vulnerabilities,
+		Hints:           pkg.hints(),
+	})
+	if c.html != nil {
+		c.html.Add(pkg.Name, pkg.Version, pkg.Ecosystem, location, pkg.Checksum, vulnerabilities)
+	}
+	if c.cyclonedx != nil {
+		c.cyclonedx.Add(pkg.Name, pkg.Version, pkg.Ecosystem, location, pkg.Checksum, vulnerabilities)
+	}
+	if c.results != nil {
+		c.results.Add(pkg.Name, pkg.Version, pkg.Ecosystem, location, pkg.Checksum, vulnerabilities)
+	}
+	if c.baselineWriter != nil {
+		c.baselineWriter.Add(pkg.Name, pkg.Ecosystem, vulnerabilities)
+	}
+	if c.pins != nil {
+		c.pins.Add(pkg.Name, pkg.Version, pkg.Ecosystem, vulnerabilities)
+	}
+	if c.archive != nil {
+		c.archive.AddResult(archive.PackageResult{
+			Name:            pkg.Name,
+			Version:         pkg.Version,
+			Ecosystem:       pkg.Ecosystem,
+			Location:        location,
+			Checksum:        pkg.Checksum,
+			Vulnerabilities: vulnerabilities,
+		})
+	}
+}
+
+// applySuppressions removes findings covered by VEX statements or policy suppressions and
+// reports them separately. Suppressed findings are not persisted and do not count towards
+// the scan totals.
+func (c *Controller) applySuppressions(name, version, ecosystem string, results models.ScanResults) models.ScanResults {
+	if c.vex == nil && c.policy == nil && c.baseline == nil && len(c.noise) == 0 {
+		return results
+	}
+
+	kept, suppressed := c.vex.Filter(name, version, ecosystem, results.Vulnerabilities)
+	kept, policySuppressed := c.policy.Filter(name, ecosystem, kept, time.Now())
+	suppressed = append(suppressed, policySuppressed...)
+	kept, baselineSuppressed := c.baseline.Filter(name, ecosystem, kept, time.Now())
+	suppressed = append(suppressed, baselineSuppressed...)
+	kept, noiseSuppressed := c.noise.Filter(name, ecosystem, kept)
+	suppressed = append(suppressed, noiseSuppressed...)
+	if len(suppressed) > 0 {
+		c.reporter.DisplaySuppressed(name, version, suppressed)
+	}
+
+	results.Vulnerabilities = kept
+	return results
+}
+
+// queryPackage queries OSV for a package through the run-wide cache,
+// honouring any per-ecosystem limits. The version is queried in its ecosystem's
+// canonical form, so spellings of the same version share a cache entry.
+// The returned bool reports that an earlier scan of the run has already reported and
+// persisted the results.
+func (c *Controller) queryPackage(name, pkgVersion, ecosystem string) (models.ScanResults, []byte, bool, error) {
+	queried := c.queryVersion(name, pkgVersion, ecosystem)
+	return c.cache.get(name, queried, ecosystem, c.osvQuery(name, queried, ecosystem))
+}
+
+// lookupPackage queries OSV for a package through the run-wide cache like queryPackage,
+// for checks that do not report the package itself, so the version's own scan still
+// reports and persists its results
+func (c *Controller) lookupPackage(name, pkgVersion, ecosystem string) (models.ScanResults, error) {
+	queried := c.queryVersion(name, pkgVersion, ecosystem)
+	return c.cache.lookup(name, queried, ecosystem, c.osvQuery(name, queried, ecosystem))
+}
+
+// osvQuery returns the OSV query of a package, honouring any per-ecosystem limits
+func (c *Controller) osvQuery(name, queried, ecosystem string) queryFunc {
+	return func() (models.ScanResults, []byte, error) {
+		release := c.osvScheduler.acquire(ecosystem)
+		defer release()
+		defer c.stats.start(phaseAPI)()
+		return c.osvClient.QueryPackage(name, queried, ecosystem)
+	}
+}
+
+// queryVersion returns the version to query advisories for: the version normalized by
+// its ecosystem's rules, such as PEP 440 for PyPI, so "1.0-RC1" matches advisories
+// recording "1.0rc1". The scanned version is still the one reported and saved.
+func (c *Controller) queryVersion(name, pkgVersion, ecosystem string) string {
+	normalized := version.Normalize(pkgVersion, ecosystem)
+	if normalized != pkgVersion {
+		c.logger.Debug("Version normalized for query",
+			"name", name,
+			"version", pkgVersion,
+			"normalized", normalized,
+			"ecosystem", ecosystem)
+	}
+	return normalized
+}
+
+// reportLatestVersion looks up the newest release of a package in its native registry
+// and reports how far behind the scanned version is, and whether upgrading clears
+// the vulnerabilities found in the scanned version
+func (c *Controller) reportLatestVersion(name, version, ecosystem string, results models.ScanResults) {
+	if !c.registry.Supports(ecosystem) {
+		c.logger.Debug("Latest version lookup not supported", "ecosystem", ecosystem)
+		return
+	}
+
+	release := c.registryScheduler.acquire(ecosystem)
+	releases, err := c.registry.GetReleases(name, ecosystem)
+	release()
+	if err != nil {
+		c.reporter.DisplayWarning("Could not look up latest version of %s: %v", name, err)
+		return
+	}
+
+	status := reporting.LatestVersionStatus{
+		Name:           name,
+		Version:        version,
+		Latest:         releases.Latest,
+		VersionsBehind: releases.VersionsBehind(version),
+		ClearsAll:      true,
+	}
+
+	// Check the latest release against OSV to see whether the current findings are fixed there
+	if releases.Latest != "" && releases.Latest != version && len(results.Vulnerabilities) > 0 {
+		latestResults, err := c.lookupPackage(name, releases.Latest, ecosystem)
+		if err != nil {
+			c.reporter.DisplayWarning("Could not check vulnerabilities of %s@%s: %v", name, releases.Latest, err)
+			return
+		}
+
+		latestIDs := make(map[string]bool)
+		for _, vuln := range latestResults.Vulnerabilities {
+			latestIDs[vuln.ID] = true
+		}
+		for _, vuln := range results.Vulnerabilities {
+			if latestIDs[vuln.ID] {
+				status.ClearsAll = false
+				status.Remaining = append(status.Remaining, vuln.ID)
+			}
+		}
+		status.LatestVulnerabilities = len(latestResults.Vulnerabilities)
+	}
+
+	c.reporter.DisplayLatestVersion(status)
+}
+
+// annotateReachability marks the dependencies of each lockfile or manifest as in use or
+// declared only, searching the source files below its directory for imports. Directories
+// holding several lockfiles are searched once.
+func (c *Controller) annotateReachability(targets []scanTarget, found [][]PackageInfo) {
+	indexes := make(map[string]*reachability.Index)
+	for i, target := range targets {
+		if !target.lockfile && !target.manifest {
+			continue
+		}
+
+		dir := filepath.Dir(target.path)
+		index, ok := indexes[dir]
+		if !ok {
+			var err error
+			index, err = reachability.Build(dir)
+			if err != nil {
+				c.reporter.DisplayWarning("Could not search %s for imports: %v", dir, err)
+			}
+			indexes[dir] = index
+		}
+		if index == nil {
+			continue
+		}
+
+		for j := range found[i] {
+			found[i][j].Reachability = index.Status(found[i][j].Name, found[i][j].Ecosystem)
+		}
+	}
+}
+
+// artifactFilter returns the configured age and name filters for artifacts
+func (c *Controller) artifactFilter() ArtifactFilter {
+	return ArtifactFilter{
+		ModifiedSince: c.config.ModifiedSince,
+		Include:       c.config.IncludePatterns,
+		Exclude:       c.config.ExcludePatterns,
+		Noise:         c.noise,
+	}
+}
+
+// scanTarget is a directory of package files, a lockfile, a manifest or an SBOM to scan
+type scanTarget struct {
+	path     string
+	lockfile bool
+	// manifest marks a package.json or pom.xml whose dependencies are resolved, with --resolve
+	manifest bool
+	sbom     bool
+	// project marks a directory detected in auto mode, whose dependency trees are skipped
+	project bool
+}
+
+// directory reports whether the target is a directory on disk or a remote location,
+// whose packages are streamed to the checks as they are found rather than read up front
+func (t scanTarget) directory() bool {
+	return !t.lockfile && !t.manifest && !t.sbom
+}
+
+// scanTargets returns the directories to scan from the --dir flags and the targets file
+// (when an extension is given), followed by the lockfiles from the --lockfile flags
+// and the SBOMs from the --sbom flags. The --auto directories add the lockfiles and
+// SBOMs found in them, and are themselves scanned if they hold package files. With
+// --resolve, manifests without a lockfile are scanned alongside the lockfiles.
+func (c *Controller) scanTargets() ([]scanTarget, error) {
+	var targets []scanTarget
+
+	// Auto mode adds the lockfiles and SBOMs it detects to those given, and scans the
+	// directory for the artifact extensions it detects
+	lockfiles := append([]string{}, c.config.Lockfiles...)
+	sboms := append([]string{}, c.config.SBOMFiles...)
+	var autoDirs []string
+	for _, dir := range c.config.AutoDirs {
+		found, err := detectTargets(dir, c.config.ResolveManifests)
+		if err != nil {
+			return nil, err
+		}
+		c.reporter.DisplayTargetsDetected(dir, found.detectors)
+		lockfiles = append(lockfiles, found.lockfiles...)
+		lockfiles = append(lockfiles, found.manifests...)
+		sboms = append(sboms, found.sboms...)
+		if len(found.extensions) > 0 {
+			autoDirs = append(autoDirs, dir)
+			c.addExtensions(found.extensions)
+		}
+	}
+
+	if c.config.FileExtension != "" {
+		directories, err := c.directoryTargets()
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range directories {
+			targets = append(targets, scanTarget{path: dir})
+		}
+		for _, dir := range autoDirs {
+			targets = append(targets, scanTarget{path: dir, project: true})
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, path := range lockfiles {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("error accessing lockfile %s: %w", path, err)
+		}
+
+		paths := []string{path}
+		if info.IsDir() {
+			paths, err = lockfile.Find(path)
+			if err != nil {
+				return nil, err
+			}
+			if c.config.ResolveManifests {
+				manifests, err := resolve.Find(path)
+				if err != nil {
+					return nil, err
+				}
+				paths = append(paths, manifests...)
+			}
+			if len(paths) == 0 {
+				c.reporter.DisplayWarning("No supported lockfiles found in %s", path)
+			}
+		} else if resolve.IsManifest(path) && !c.config.ResolveManifests {
+			return nil, fmt.Errorf("%s is a manifest without resolved versions; use --resolve to resolve its dependencies from the registry", path)
+		}
+
+		for _, p := range paths {
+			if clean := filepath.Clean(p); !seen[clean] {
+				seen[clean] = true
+				manifest := resolve.IsManifest(p)
+				targets = append(targets, scanTarget{path: p, lockfile: !manifest, manifest: manifest})
+			}
+		}
+	}
+
+	for _, path := range sboms {
+		if clean := filepath.Clean(path); !seen[clean] {
+			seen[clean] = true
+			targets = append(targets, scanTarget{path: path, sbom: true})
+		}
+	}
+
+	return targets, nil
+}
+
+// addExtensions adds artifact extensions detected in auto mode to those scanned for.
+// Detected extensions have a known ecosystem, so when auto mode detects the only one,
+// its artifacts are identified in that ecosystem rather than the --ecosystem default.
+func (c *Controller) addExtensions(extensions []string) {
+	given := c.config.FileExtension
+	var merged []string
+	for _, ext := range strings.Split(given, ",") {
+		if ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), ".")); ext != "" && !slices.Contains(merged, ext) {
+			merged = append(merged, ext)
+		}
+	}
+	for _, ext := range extensions {
+		if !slices.Contains(merged, ext) {
+			merged = append(merged, ext)
+		}
+	}
+	c.config.FileExtension = strings.Join(merged, ",")
+	if given == "" && len(merged) == 1 {
+		c.config.PackageEcosystem = determineEcosystem(merged[0])
+	}
+}
+
+// directoryTargets returns the directories to scan from the --dir flags and the targets file
+func (c *Controller) directoryTargets() ([]string, error) {
+	directories := append([]string{}, c.config.DirectoryPaths...)
+
+	if c.config.TargetsFile != "" {
+		data, err := os.ReadFile(c.config.TargetsFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading targets file %s: %w", c.config.TargetsFile, err)
+		}
+
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			directories = append(directories, line)
+		}
+	}
+
+	// Drop duplicate targets while preserving order
+	seen := make(map[string]bool)
+	unique := directories[:0]
+	for _, dir := range directories {
+		clean := filepath.Clean(dir)
+		if seen[clean] {
+			continue
+		}
+		seen[clean] = true
+		unique = append(unique, dir)
+	}
 
-	c.reporter.DisplayScanSummary(len(packages))
+	return unique, nil
 }
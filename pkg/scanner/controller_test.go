@@ -0,0 +1,292 @@
+package scanner
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/squarehole/package-scanner/pkg/cli"
+	"github.com/squarehole/package-scanner/pkg/models"
+)
+
+func TestMain(m *testing.M) {
+	// The controller logs through the default logger; its output is not under test
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// lodashResponse is the mock OSV response for lodash 4.17.0, with one high severity
+// vulnerability fixed in 4.17.12
+const lodashResponse = `{"vulns": [{
+	"id": "GHSA-jf85-cpcp-j695",
+	"summary": "Prototype Pollution in lodash",
+	"affected": [{
+		"package": {"name": "lodash", "ecosystem": "npm"},
+		"ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "4.17.12"}]}]
+	}],
+	"database_specific": {"severity": "HIGH"}
+}]}`
+
+// testScan writes a lockfile holding lodash 4.17.0, which has one vulnerability, and
+// left-pad 1.3.0, which has none, and mock OSV fixtures answering for them, and returns
+// the configuration of a scan of the lockfile
+func testScan(t *testing.T) *cli.Config {
+	t.Helper()
+	dir := t.TempDir()
+
+	lockfile := filepath.Join(dir, "package-lock.json")
+	writeTestFile(t, lockfile, `{"name": "app", "lockfileVersion": 3, "packages": {
+		"": {"name": "app"},
+		"node_modules/lodash": {"version": "4.17.0"},
+		"node_modules/left-pad": {"version": "1.3.0"}
+	}}`)
+
+	fixtures := filepath.Join(dir, "osv")
+	writeTestFile(t, filepath.Join(fixtures, "responses", "npm", "lodash", "4.17.0.json"), lodashResponse)
+
+	return &cli.Config{
+		Lockfiles:   []string{lockfile},
+		MockOSV:     fixtures,
+		Sources:     []string{"osv"},
+		Concurrency: 2,
+		MaxInFlight: 4,
+		LogFormat:   "json",
+	}
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// runTestScan runs a scan with store in place of the database and returns its exit code
+func runTestScan(t *testing.T, config *cli.Config, store *fakeStore) int {
+	t.Helper()
+	controller := NewController(config, WithStore(store))
+	controller.Run()
+	controller.Close()
+	return controller.ExitCode()
+}
+
+func TestControllerSavesFindingsToStore(t *testing.T) {
+	tests := []struct {
+		name        string
+		batchSize   int
+		recordClean bool
+		// selfTest runs the self-test with the first package found
+		selfTest  bool
+		wantClean []string
+	}{
+		{name: "one package at a time"},
+		{name: "batched", batchSize: 10},
+		{name: "one package at a time with clean scans", recordClean: true, wantClean: []string{"left-pad@1.3.0"}},
+		{name: "batched with clean scans", batchSize: 10, recordClean: true, wantClean: []string{"left-pad@1.3.0"}},
+		{name: "after a self-test", recordClean: true, selfTest: true, wantClean: []string{"left-pad@1.3.0"}},
+		{name: "batched after a self-test", batchSize: 10, recordClean: true, selfTest: true, wantClean: []string{"left-pad@1.3.0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testScan(t)
+			config.DBBatchSize = tt.batchSize
+			config.RecordClean = tt.recordClean
+			config.Labels = map[string]string{"team": "payments"}
+			if tt.selfTest {
+				config.SelfTestThreshold = 1
+			}
+			store := newFakeStore()
+
+			if code := runTestScan(t, config, store); code != 0 {
+				t.Errorf("exit code = %d, want 0", code)
+			}
+
+			if len(store.runs) != 1 {
+				t.Fatalf("started %d runs, want 1", len(store.runs))
+			}
+			if store.runLabels[0]["team"] != "payments" {
+				t.Errorf("run started with labels %v, want team=payments", store.runLabels[0])
+			}
+			saved, ok := store.findings["lodash@4.17.0"]
+			if !ok {
+				t.Fatalf("findings of lodash@4.17.0 not saved; saved %v", store.findings)
+			}
+			if saved.runID != 1 {
+				t.Errorf("findings saved for run %d, want 1", saved.runID)
+			}
+			if len(saved.vulnerabilities) != 1 || saved.vulnerabilities[0].ID != "GHSA-jf85-cpcp-j695" {
+				t.Errorf("saved vulnerabilities = %v, want GHSA-jf85-cpcp-j695", saved.vulnerabilities)
+			}
+			if len(store.findings) != 1 {
+				t.Errorf("saved findings of %d packages, want 1", len(store.findings))
+			}
+			if len(store.clean) != len(tt.wantClean) || (len(tt.wantClean) > 0 && store.clean[0] != tt.wantClean[0]) {
+				t.Errorf("clean scans = %v, want %v", store.clean, tt.wantClean)
+			}
+
+			totals, ok := store.finished[1]
+			if !ok {
+				t.Fatal("run 1 not finished")
+			}
+			if totals.vulnerabilities != 1 || totals.severities.High != 1 {
+				t.Errorf("run finished with %d vulnerabilities, %d high, want 1 and 1", totals.vulnerabilities, totals.severities.High)
+			}
+			if !store.closed {
+				t.Error("store not closed")
+			}
+		})
+	}
+}
+
+// fileScan turns the configuration of testScan into that of scan file of an npm
+// tarball of lodash 4.17.0
+func fileScan(t *testing.T, config *cli.Config) {
+	t.Helper()
+	artifact := filepath.Join(filepath.Dir(config.Lockfiles[0]), "lodash-4.17.0.tgz")
+	writeTestFile(t, artifact, "")
+	config.Lockfiles = nil
+	config.Command = "scan file"
+	config.CommandArgs = []string{artifact}
+	config.FileExtension = "tgz"
+	config.PackageEcosystem = "npm"
+}
+
+func TestControllerExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileScan bool
+		failOn   string
+		saveErr  error
+		want     int
+	}{
+		{name: "no threshold", want: 0},
+		{name: "findings below the threshold", failOn: "critical", want: 0},
+		{name: "findings at the threshold", failOn: "high", want: ExitFindings},
+		{name: "failed save", saveErr: errors.New("connection refused"), want: ExitError},
+		{name: "failed save takes precedence over findings", failOn: "high", saveErr: errors.New("connection refused"), want: ExitError},
+		{name: "scan file with findings at the threshold", fileScan: true, failOn: "high", want: ExitFindings},
+		{name: "scan file with a failed save", fileScan: true, saveErr: errors.New("connection refused"), want: ExitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testScan(t)
+			if tt.fileScan {
+				fileScan(t, config)
+			}
+			config.FailOn = tt.failOn
+			store := newFakeStore()
+			store.saveErr = tt.saveErr
+
+			if code := runTestScan(t, config, store); code != tt.want {
+				t.Errorf("exit code = %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
+
+func TestControllerResumeReportsCheckpointedFindings(t *testing.T) {
+	config := testScan(t)
+	lockfile := config.Lockfiles[0]
+	config.CheckpointFile = filepath.Join(t.TempDir(), "scan.checkpoint")
+	config.Resume = true
+	config.FailOn = "high"
+
+	// An interrupted run checked lodash before it stopped
+	var response models.ScanResults
+	if err := json.Unmarshal([]byte(lodashResponse), &response); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := openCheckpoint(config.CheckpointFile, false, []string{lockfile}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lodash := PackageInfo{Name: "lodash", Version: "4.17.0", Ecosystem: "npm"}
+	if err := cp.add(lockfile, lodash, scanOutcome{vulnerabilities: 1, findings: response.Vulnerabilities}); err != nil {
+		t.Fatal(err)
+	}
+	cp.file.Close()
+	// The resumed run must not query lodash again, as its advisory source now finds it clean
+	writeTestFile(t, filepath.Join(config.MockOSV, "responses", "npm", "lodash", "4.17.0.json"), `{"vulns": []}`)
+
+	store := newFakeStore()
+	controller := NewController(config, WithStore(store))
+	controller.Run()
+	controller.Close()
+
+	if code := controller.ExitCode(); code != ExitFindings {
+		t.Errorf("exit code = %d, want %d for the checkpointed high severity finding", code, ExitFindings)
+	}
+	totals := controller.reporter.Totals()
+	if totals.Packages != 2 || totals.Vulnerabilities != 1 || totals.Severities.High != 1 {
+		t.Errorf("totals = %+v, want 2 packages and 1 high severity vulnerability", totals)
+	}
+	if _, ok := store.findings["lodash@4.17.0"]; ok {
+		t.Error("checkpointed findings saved again")
+	}
+	// The run is recorded with the same totals the reporter displays
+	if run, ok := store.finished[1]; !ok || run.packages != totals.Packages ||
+		run.vulnerabilities != totals.Vulnerabilities || run.severities != totals.Severities {
+		t.Errorf("run finished with %+v, want the reported totals %+v", run, totals)
+	}
+	if _, err := os.Stat(config.CheckpointFile); !os.IsNotExist(err) {
+		t.Errorf("checkpoint of the completed scan not removed: %v", err)
+	}
+}
+
+func TestControllerResumeRecordsCheckpointedArtifacts(t *testing.T) {
+	config := testScan(t)
+	dir := filepath.Join(t.TempDir(), "artifacts")
+	artifact := filepath.Join(dir, "lodash-4.17.0.tgz")
+	writeTestFile(t, artifact, "")
+	config.Lockfiles = nil
+	config.DirectoryPaths = []string{dir}
+	config.FileExtension = "tgz"
+	config.PackageEcosystem = "npm"
+	config.Incremental = true
+	config.StateFile = filepath.Join(t.TempDir(), "state.json")
+	config.CheckpointFile = filepath.Join(t.TempDir(), "scan.checkpoint")
+	config.Resume = true
+
+	// An interrupted run checked the artifact's package before it stopped
+	var response models.ScanResults
+	if err := json.Unmarshal([]byte(lodashResponse), &response); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := openCheckpoint(config.CheckpointFile, false, []string{dir}, "tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lodash := PackageInfo{Name: "lodash", Version: "4.17.0", Ecosystem: "npm", FilePath: artifact}
+	if err := cp.add(dir, lodash, scanOutcome{vulnerabilities: 1, findings: response.Vulnerabilities}); err != nil {
+		t.Fatal(err)
+	}
+	cp.file.Close()
+	writeTestFile(t, filepath.Join(config.MockOSV, "responses", "npm", "lodash", "4.17.0.json"), `{"vulns": []}`)
+
+	if code := runTestScan(t, config, newFakeStore()); code != 0 {
+		t.Errorf("exit code = %d, want 0", code)
+	}
+
+	data, err := os.ReadFile(config.StateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state stateFile
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	record, ok := state.Files[stateKey(artifact)]
+	if !ok {
+		t.Fatalf("artifact of the checkpointed package not recorded; recorded %v", state.Files)
+	}
+	if !record.Vulnerable {
+		t.Error("artifact recorded as clean, want vulnerable as the checkpoint found it")
+	}
+}
@@ -0,0 +1,80 @@
+package scanner
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/squarehole/package-scanner/pkg/reporting"
+)
+
+// noExtension is the coverage key of files without an extension
+const noExtension = "(none)"
+
+// Coverage counts, per extension, how the files found while scanning directories and
+// remote locations were handled, so gaps in what the scanner understands are visible
+// rather than silent. It is safe for concurrent use.
+type Coverage struct {
+	mu     sync.Mutex
+	counts map[string]*reporting.CoverageSummary
+}
+
+// NewCoverage creates an empty coverage count
+func NewCoverage() *Coverage {
+	return &Coverage{counts: make(map[string]*reporting.CoverageSummary)}
+}
+
+// parsed records an artifact whose package was identified
+func (c *Coverage) parsed(ps *PackageScanner) {
+	c.record(strings.ToLower(ps.FileExtension), ps.Ecosystem, func(s *reporting.CoverageSummary) { s.Parsed++ })
+}
+
+// failed records an artifact whose package could not be identified
+func (c *Coverage) failed(ps *PackageScanner) {
+	c.record(strings.ToLower(ps.FileExtension), ps.Ecosystem, func(s *reporting.CoverageSummary) { s.Failed++ })
+}
+
+// unknown records a file with none of the scanned extensions
+func (c *Coverage) unknown(filename string) {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(filename), "."))
+	if ext == "" {
+		ext = noExtension
+	}
+	c.record(ext, "", func(s *reporting.CoverageSummary) { s.Unknown++ })
+}
+
+func (c *Coverage) record(ext, ecosystem string, update func(*reporting.CoverageSummary)) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	summary, ok := c.counts[ext]
+	if !ok {
+		summary = &reporting.CoverageSummary{Extension: ext}
+		c.counts[ext] = summary
+	}
+	if ecosystem != "" {
+		summary.Ecosystem = ecosystem
+	}
+	update(summary)
+}
+
+// Summaries returns the counts per extension, scanned extensions first and then by name
+func (c *Coverage) Summaries() []reporting.CoverageSummary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	summaries := make([]reporting.CoverageSummary, 0, len(c.counts))
+	for _, summary := range c.counts {
+		summaries = append(summaries, *summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		scannedI, scannedJ := summaries[i].Ecosystem != "", summaries[j].Ecosystem != ""
+		if scannedI != scannedJ {
+			return scannedI
+		}
+		return summaries[i].Extension < summaries[j].Extension
+	})
+	return summaries
+}
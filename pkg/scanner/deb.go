@@ -0,0 +1,151 @@
+package scanner
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// debPackages identifies a .deb from the control file in its control archive.
+// Debian advisories are recorded against source packages, so the source package
+// named in the control file is reported, at its own version when one is given
+// (as for binNMUs). Versions keep their epoch, e.g. "1:2.4.52-1".
+func (ps *PackageScanner) debPackages(r io.ReaderAt, size int64, name string) ([]PackageInfo, error) {
+	control, err := readDebControl(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return ps.filenameFallback(name, err)
+	}
+	if control["Package"] == "" || control["Version"] == "" {
+		return ps.filenameFallback(name, fmt.Errorf("control file has no Package or Version"))
+	}
+
+	pkg := PackageInfo{
+		Name:         control["Package"],
+		Version:      control["Version"],
+		Ecosystem:    ps.Ecosystem,
+		Architecture: control["Architecture"],
+	}
+	if source := control["Source"]; source != "" {
+		name, version, hasVersion := strings.Cut(source, " ")
+		pkg.Name = name
+		if hasVersion {
+			pkg.Version = strings.Trim(strings.TrimSpace(version), "()")
+		}
+	}
+
+	ps.logger.Debug("Debian package metadata read",
+		"filename", name,
+		"package", control["Package"],
+		"source", pkg.Name,
+		"version", pkg.Version,
+		"architecture", pkg.Architecture)
+	return []PackageInfo{pkg}, nil
+}
+
+// readDebControl finds the control archive in a .deb (an ar archive) and parses
+// the control file in it
+func readDebControl(r io.Reader) (map[string]string, error) {
+	magic := make([]byte, 8)
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != "!<arch>\n" {
+		return nil, fmt.Errorf("not a Debian package archive")
+	}
+
+	header := make([]byte, 60)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, fmt.Errorf("no control archive in package")
+		}
+		name := strings.TrimSuffix(strings.TrimSpace(string(header[0:16])), "/")
+		size, err := strconv.ParseInt(strings.TrimSpace(string(header[48:58])), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid archive member size for %s", name)
+		}
+
+		// Members are padded to an even length
+		member := io.LimitReader(r, size)
+		if strings.HasPrefix(name, "control.tar") {
+			return readControlArchive(member, path.Ext(name))
+		}
+		if _, err := io.Copy(io.Discard, io.LimitReader(r, size+size%2)); err != nil {
+			return nil, fmt.Errorf("error reading package archive: %w", err)
+		}
+	}
+}
+
+// readControlArchive decompresses a control.tar archive and parses its control file
+func readControlArchive(r io.Reader, ext string) (map[string]string, error) {
+	var stream io.Reader
+	switch ext {
+	case ".tar":
+		stream = r
+	case ".gz":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing control archive: %w", err)
+		}
+		defer gz.Close()
+		stream = gz
+	case ".xz":
+		xzr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing control archive: %w", err)
+		}
+		stream = xzr
+	case ".zst":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing control archive: %w", err)
+		}
+		defer zr.Close()
+		stream = zr
+	default:
+		return nil, fmt.Errorf("unsupported control archive compression %q", ext)
+	}
+
+	tr := tar.NewReader(stream)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no control file in control archive")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading control archive: %w", err)
+		}
+		if path.Clean(header.Name) == "control" {
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, fmt.Errorf("error reading control file: %w", err)
+			}
+			return parseDebControl(data), nil
+		}
+	}
+}
+
+// parseDebControl parses the fields of the first paragraph of a Debian control file.
+// Continuation lines of multi-line fields are ignored.
+func parseDebControl(data []byte) map[string]string {
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			break
+		}
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			continue
+		}
+		if key, value, found := strings.Cut(line, ":"); found {
+			fields[key] = strings.TrimSpace(value)
+		}
+	}
+	return fields
+}
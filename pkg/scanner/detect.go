@@ -0,0 +1,88 @@
+package scanner
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/squarehole/package-scanner/pkg/lockfile"
+	"github.com/squarehole/package-scanner/pkg/resolve"
+	"github.com/squarehole/package-scanner/pkg/sbom"
+)
+
+// autoExtensions are the artifact extensions auto mode looks for, each identified in
+// its own ecosystem
+var autoExtensions = []string{"nupkg", "tgz", "whl", "egg", "jar", "gem", "deb", "rpm"}
+
+// detection is what auto mode found in a project directory
+type detection struct {
+	lockfiles []string
+	// manifests are those without a lockfile, found when they are resolved
+	manifests []string
+	sboms     []string
+	// extensions are the artifact extensions found, sorted
+	extensions []string
+	// detectors counts the files each detector matched, by lockfile name, "sbom" or
+	// artifact extension such as "*.nupkg"
+	detectors map[string]int
+}
+
+// detectTargets finds the lockfiles, SBOMs and artifacts below a project directory, and
+// the manifests without a lockfile when manifests are resolved. Installed dependency
+// trees are skipped, as for lockfile searches, so packages are only found where the
+// project itself declares or builds them.
+func detectTargets(dir string, manifests bool) (detection, error) {
+	found := detection{detectors: make(map[string]int)}
+
+	lockfiles, err := lockfile.Find(dir)
+	if err != nil {
+		return found, err
+	}
+	for _, path := range lockfiles {
+		found.lockfiles = append(found.lockfiles, path)
+		found.detectors[filepath.Base(path)]++
+	}
+
+	extensions := make(map[string]bool)
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && lockfile.IsDependencyDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if manifests && resolve.IsManifest(d.Name()) && !resolve.IsLocked(path) {
+			found.manifests = append(found.manifests, path)
+			found.detectors[d.Name()]++
+			return nil
+		}
+		if sbom.IsSBOM(d.Name()) {
+			found.sboms = append(found.sboms, path)
+			found.detectors["sbom"]++
+			return nil
+		}
+		name := strings.ToLower(d.Name())
+		for _, ext := range autoExtensions {
+			if strings.HasSuffix(name, "."+ext) {
+				extensions[ext] = true
+				found.detectors["*."+ext]++
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return found, fmt.Errorf("error detecting scan targets in %s: %w", dir, err)
+	}
+
+	for ext := range extensions {
+		found.extensions = append(found.extensions, ext)
+	}
+	sort.Strings(found.extensions)
+	return found, nil
+}
@@ -0,0 +1,74 @@
+package scanner
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/squarehole/package-scanner/pkg/reporting"
+)
+
+// runDBDiff compares the findings of two scan runs stored in the configured database:
+// db diff compares the latest finished run with the run of the same target before it,
+// db diff <head> compares run head with the run before it, and db diff <base> <head>
+// compares the two runs given
+func (c *Controller) runDBDiff() {
+	if len(c.config.CommandArgs) > 2 {
+		c.logger.Error("db diff takes at most two scan run ids, e.g. db diff 12 13")
+		os.Exit(1)
+	}
+	ids := make([]int64, len(c.config.CommandArgs))
+	for i, arg := range c.config.CommandArgs {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || id <= 0 {
+			c.logger.Error("Invalid scan run id", "id", arg)
+			os.Exit(1)
+		}
+		ids[i] = id
+	}
+	var baseID, headID int64
+	switch len(ids) {
+	case 1:
+		headID = ids[0]
+	case 2:
+		baseID, headID = ids[0], ids[1]
+	}
+
+	switch c.config.Format {
+	case "", "json":
+	default:
+		c.logger.Error("Unsupported diff format", "format", c.config.Format, "supported", "json")
+		os.Exit(1)
+	}
+
+	database := c.openDatabase()
+	c.store = database
+	diff, err := database.DiffRuns(c.ctx, baseID, headID)
+	if err != nil {
+		c.logger.Error("Error comparing scan runs", "error", err)
+		os.Exit(1)
+	}
+
+	if c.config.Format == "" {
+		c.reporter.DisplayRunDiff(diff)
+		return
+	}
+	if c.config.OutputPath == "" {
+		if err := reporting.WriteRunDiffJSON(diff, os.Stdout); err != nil {
+			c.logger.Error("Error writing run diff", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+	f, err := os.Create(c.config.OutputPath)
+	if err != nil {
+		c.logger.Error("Error creating run diff", "path", c.config.OutputPath, "error", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	if err := reporting.WriteRunDiffJSON(diff, f); err != nil {
+		c.logger.Error("Error writing run diff", "path", c.config.OutputPath, "error", err)
+		os.Exit(1)
+	}
+	c.logger.Info("Run diff written", "path", c.config.OutputPath,
+		"new", len(diff.New), "fixed", len(diff.Fixed), "persisting", len(diff.Persisting))
+}
@@ -0,0 +1,142 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+)
+
+// diskCache is an advisory source that keeps the responses of another source on disk,
+// so later runs on the same machine answer repeated queries without a network round trip
+type diskCache struct {
+	source vulnerabilitySource
+	dir    string
+	ttl    time.Duration
+}
+
+// cachedResponse is the file stored for one package version
+type cachedResponse struct {
+	Name      string          `json:"name"`
+	Version   string          `json:"version"`
+	Ecosystem string          `json:"ecosystem"`
+	FetchedAt time.Time       `json:"fetched_at"`
+	Response  json.RawMessage `json:"response"`
+}
+
+// newDiskCache wraps a source with a cache in dir whose entries are used for ttl
+func newDiskCache(source vulnerabilitySource, dir string, ttl time.Duration) (*diskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating query cache directory %s: %w", dir, err)
+	}
+	return &diskCache{source: source, dir: dir, ttl: ttl}, nil
+}
+
+// QueryPackage returns the cached response for a package version while it is fresh,
+// otherwise queries the wrapped source and stores its response
+func (d *diskCache) QueryPackage(packageName, packageVersion, packageEcosystem string) (models.ScanResults, []byte, error) {
+	if entry, ok := d.load(packageName, packageVersion, packageEcosystem); ok {
+		var results models.ScanResults
+		if err := json.Unmarshal(entry.Response, &results); err == nil {
+			return results, entry.Response, nil
+		}
+	}
+
+	results, body, err := d.source.QueryPackage(packageName, packageVersion, packageEcosystem)
+	if err != nil {
+		return results, body, err
+	}
+	if err := d.store(packageName, packageVersion, packageEcosystem, body); err != nil {
+		// A cache that cannot be written only costs a repeated query later
+		slog.Warn("Could not update query cache", "error", err)
+	}
+	return results, body, nil
+}
+
+// fresh reports whether the cache holds an unexpired response for a package version
+func (d *diskCache) fresh(name, version, ecosystem string) bool {
+	_, ok := d.load(name, version, ecosystem)
+	return ok
+}
+
+// load reads the cached response for a package version if it has not expired
+func (d *diskCache) load(name, version, ecosystem string) (cachedResponse, bool) {
+	data, err := os.ReadFile(d.path(name, version, ecosystem))
+	if err != nil {
+		return cachedResponse{}, false
+	}
+	var entry cachedResponse
+	if err := json.Unmarshal(data, &entry); err != nil || len(entry.Response) == 0 {
+		return cachedResponse{}, false
+	}
+	if d.ttl > 0 && time.Since(entry.FetchedAt) > d.ttl {
+		return cachedResponse{}, false
+	}
+	return entry, true
+}
+
+// store writes a response to the cache, replacing the file atomically so concurrent
+// runs sharing the directory never read a partial entry
+func (d *diskCache) store(name, version, ecosystem string, body []byte) error {
+	if !json.Valid(body) {
+		return nil
+	}
+	data, err := json.Marshal(cachedResponse{
+		Name:      name,
+		Version:   version,
+		Ecosystem: ecosystem,
+		FetchedAt: time.Now().UTC(),
+		Response:  body,
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding cached response: %w", err)
+	}
+
+	path := d.path(name, version, ecosystem)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating query cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".entry-*")
+	if err != nil {
+		return fmt.Errorf("error writing query cache: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("error writing query cache: %w", err)
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("error writing query cache: %w", err)
+	}
+	return nil
+}
+
+// checkWritable stores a probe entry in the cache, reads it back and removes it,
+// confirming responses can be kept for later runs
+func (d *diskCache) checkWritable() error {
+	const name, version, ecosystem = "package-scanner-self-test", "0.0.0", "self-test"
+	if err := d.store(name, version, ecosystem, []byte(`{"vulns":[]}`)); err != nil {
+		return err
+	}
+	defer os.RemoveAll(filepath.Join(d.dir, ecosystem))
+	if _, ok := d.load(name, version, ecosystem); !ok {
+		return fmt.Errorf("entry written to %s could not be read back", d.dir)
+	}
+	return nil
+}
+
+// path returns the cache file of a package version, spread over subdirectories by hash
+func (d *diskCache) path(name, version, ecosystem string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{ecosystem, name, version}, "|")))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(d.dir, strings.ToLower(ecosystem), key[:2], key+".json")
+}
@@ -0,0 +1,33 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiskCacheCheckWritable(t *testing.T) {
+	t.Run("writable directory", func(t *testing.T) {
+		dir := t.TempDir()
+		cache := &diskCache{dir: dir}
+		if err := cache.checkWritable(); err != nil {
+			t.Fatalf("checkWritable() = %v, want nil", err)
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) > 0 {
+			t.Errorf("probe left %d entries behind in the cache", len(entries))
+		}
+	})
+
+	t.Run("directory replaced by a file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cache")
+		writeTestFile(t, path, "not a directory")
+		cache := &diskCache{dir: path}
+		if err := cache.checkWritable(); err == nil {
+			t.Error("checkWritable() = nil, want an error")
+		}
+	})
+}
@@ -0,0 +1,53 @@
+package scanner
+
+import (
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/squarehole/package-scanner/pkg/reporting"
+)
+
+// runExport writes the findings stored in the configured database that match the
+// history filters, such as every finding of a run with --run, as CSV, JSON Lines or
+// spreadsheet-ready CSV to --out or stdout
+func (c *Controller) runExport() {
+	format := c.config.Format
+	if format == "" {
+		format = "csv"
+	}
+	if !slices.Contains(reporting.ExportFormats, format) {
+		c.logger.Error("Unsupported export format", "format", format,
+			"supported", strings.Join(reporting.ExportFormats, ", "))
+		os.Exit(1)
+	}
+	filter := c.scanFilter()
+	filter.Limit = c.config.ExportLimit
+
+	database := c.openDatabase()
+	c.store = database
+	records, err := database.QueryScans(c.ctx, filter)
+	if err != nil {
+		c.logger.Error("Error querying stored findings", "error", err)
+		os.Exit(1)
+	}
+
+	if c.config.OutputPath == "" {
+		if err := reporting.WriteExport(records, format, os.Stdout); err != nil {
+			c.logger.Error("Error writing export", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+	f, err := os.Create(c.config.OutputPath)
+	if err != nil {
+		c.logger.Error("Error creating export", "path", c.config.OutputPath, "error", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	if err := reporting.WriteExport(records, format, f); err != nil {
+		c.logger.Error("Error writing export", "path", c.config.OutputPath, "error", err)
+		os.Exit(1)
+	}
+	c.logger.Info("Findings exported", "path", c.config.OutputPath, "format", format, "findings", len(records))
+}
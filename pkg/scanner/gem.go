@@ -0,0 +1,78 @@
+package scanner
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// gemspec holds the fields of a gem's specification needed to identify it. The
+// specification is stored as YAML tagged with Ruby object types, which are ignored.
+type gemspec struct {
+	Name    string `yaml:"name"`
+	Version struct {
+		Version string `yaml:"version"`
+	} `yaml:"version"`
+	Platform string `yaml:"platform"`
+}
+
+// gemPackages identifies a .gem from the specification in its metadata.gz. Gems
+// built for a specific platform (e.g. x86_64-linux) share the advisories of the
+// plain version, so the platform is reported as the architecture only.
+func (ps *PackageScanner) gemPackages(r io.ReaderAt, size int64, name string) ([]PackageInfo, error) {
+	spec, err := readGemspec(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return ps.filenameFallback(name, err)
+	}
+	if spec.Name == "" || spec.Version.Version == "" {
+		return ps.filenameFallback(name, fmt.Errorf("gem specification has no name or version"))
+	}
+
+	pkg := PackageInfo{
+		Name:      spec.Name,
+		Version:   spec.Version.Version,
+		Ecosystem: ps.Ecosystem,
+	}
+	if spec.Platform != "" && spec.Platform != "ruby" {
+		pkg.Architecture = spec.Platform
+	}
+	ps.logger.Debug("Gem specification read",
+		"filename", name,
+		"package", pkg.Name,
+		"version", pkg.Version,
+		"platform", spec.Platform)
+	return []PackageInfo{pkg}, nil
+}
+
+// readGemspec finds metadata.gz in a gem (a plain tar archive) and parses the
+// specification in it
+func readGemspec(r io.Reader) (*gemspec, error) {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no metadata.gz in gem")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading gem archive: %w", err)
+		}
+		if header.Name != "metadata.gz" {
+			continue
+		}
+
+		gz, err := gzip.NewReader(tr)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing gem metadata: %w", err)
+		}
+		defer gz.Close()
+
+		var spec gemspec
+		if err := yaml.NewDecoder(gz).Decode(&spec); err != nil {
+			return nil, fmt.Errorf("error parsing gem specification: %w", err)
+		}
+		return &spec, nil
+	}
+}
@@ -0,0 +1,95 @@
+package scanner
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/cli"
+	"github.com/squarehole/package-scanner/pkg/db"
+)
+
+// severityScores are the lowest scores out of 10 of the levels --min-severity accepts
+var severityScores = map[string]float64{
+	"low":      0.1,
+	"medium":   4,
+	"high":     7,
+	"critical": 9,
+}
+
+// runHistory lists the findings stored in the configured database that match the
+// package, vulnerability, severity, period and run filters and the full-text query
+// given with --text or as arguments
+func (c *Controller) runHistory() {
+	filter := c.scanFilter()
+	filter.Limit = c.config.HistoryLimit
+
+	database := c.openDatabase()
+	c.store = database
+
+	records, err := database.QueryScans(c.ctx, filter)
+	if err != nil {
+		c.logger.Error("Error querying stored findings", "error", err)
+		os.Exit(1)
+	}
+	c.logger.Info("Stored findings", "count", len(records))
+	for _, record := range records {
+		// A finding without a CVSS score is logged with a null score rather than 0
+		var score any
+		if record.CVSSScore != nil {
+			score = *record.CVSSScore
+		}
+		c.logger.Info("Stored finding",
+			"package", record.PackageName,
+			"ecosystem", record.Ecosystem,
+			"version", record.Version,
+			"vulnID", record.VulnID,
+			"aliases", record.Aliases,
+			"severity", record.SeverityRating,
+			"severityLabel", record.SeverityLabel,
+			"cvssScore", score,
+			"cvssVector", record.CVSSVector,
+			"fixVersion", record.FixVersion,
+			"fixedVersions", record.FixedVersions,
+			"summary", record.Summary,
+			"firstSeen", record.CreatedAt.Format(time.RFC3339),
+			"lastSeen", record.LastSeen.Format(time.RFC3339),
+			"runID", record.ScanID)
+	}
+}
+
+// scanFilter builds the filter of stored findings given by the package, vulnerability,
+// severity, period and run flags and the full-text query given with --text or as
+// arguments, shared by history and export
+func (c *Controller) scanFilter() db.ScanFilter {
+	text := c.config.SearchText
+	if text == "" {
+		text = strings.Join(c.config.CommandArgs, " ")
+	}
+	filter := db.ScanFilter{
+		PackageName: c.config.HistoryPackage,
+		Ecosystem:   c.config.HistoryEcosystem,
+		Version:     c.config.HistoryVersion,
+		VulnID:      c.config.VulnID,
+		Until:       c.config.Until,
+		RunID:       c.config.RunID,
+		Text:        strings.TrimSpace(text),
+	}
+	if c.config.MinSeverity != "" {
+		score, ok := severityScores[strings.ToLower(c.config.MinSeverity)]
+		if !ok {
+			c.logger.Error("Invalid minimum severity", "minSeverity", c.config.MinSeverity, "supported", "low, medium, high, critical")
+			os.Exit(1)
+		}
+		filter.MinScore = score
+	}
+	if c.config.Since != "" {
+		since, err := cli.ParseSince(c.config.Since)
+		if err != nil {
+			c.logger.Error("Invalid period", "since", c.config.Since, "error", err)
+			os.Exit(1)
+		}
+		filter.Since = since
+	}
+	return filter
+}
@@ -0,0 +1,122 @@
+package scanner
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// jarPackages identifies a jar from the pom.properties Maven embeds under
+// META-INF/maven, naming packages groupId:artifactId as OSV expects. A shaded
+// (uber) jar carries the pom.properties of every artifact bundled into it, and
+// all of them are returned, the jar's own artifact first. Without pom.properties,
+// the group and version are taken from MANIFEST.MF and the artifact from the file
+// name; when neither names a group, the file name alone is used.
+func (ps *PackageScanner) jarPackages(r io.ReaderAt, size int64, name string) ([]PackageInfo, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return ps.filenameFallback(name, err)
+	}
+
+	var packages []PackageInfo
+	var manifest map[string]string
+	for _, file := range archive.File {
+		if matched, _ := path.Match("META-INF/maven/*/*/pom.properties", file.Name); matched {
+			props, err := readJarAttributes(file, "=")
+			if err != nil {
+				return nil, err
+			}
+			if props["groupId"] == "" || props["artifactId"] == "" || props["version"] == "" {
+				continue
+			}
+			packages = append(packages, PackageInfo{
+				Name:      props["groupId"] + ":" + props["artifactId"],
+				Version:   props["version"],
+				Ecosystem: ps.Ecosystem,
+			})
+		} else if strings.EqualFold(file.Name, "META-INF/MANIFEST.MF") {
+			if manifest, err = readJarAttributes(file, ":"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// The file name is the fallback identity, and picks the jar's own artifact among shaded ones
+	artifactID, fileVersion, nameErr := parseJavaPackage(path.Base(name))
+
+	if len(packages) == 0 {
+		group := manifest["Implementation-Vendor-Id"]
+		version := manifest["Implementation-Version"]
+		if version == "" {
+			version = manifest["Bundle-Version"]
+		}
+		if nameErr != nil {
+			return nil, nameErr
+		}
+		if group == "" {
+			ps.logger.Warn("Jar has no Maven metadata, using file name without a groupId",
+				"filename", name)
+			return []PackageInfo{{Name: artifactID, Version: fileVersion, Ecosystem: ps.Ecosystem}}, nil
+		}
+		if version == "" {
+			version = fileVersion
+		}
+		return []PackageInfo{{Name: group + ":" + artifactID, Version: version, Ecosystem: ps.Ecosystem}}, nil
+	}
+
+	if len(packages) > 1 {
+		for i, pkg := range packages {
+			if nameErr == nil && strings.HasSuffix(pkg.Name, ":"+artifactID) {
+				packages[0], packages[i] = packages[i], packages[0]
+				break
+			}
+		}
+		ps.logger.Info("Shaded jar bundles several artifacts",
+			"filename", name,
+			"artifact", packages[0].Name,
+			"bundled", len(packages)-1)
+	}
+	return packages, nil
+}
+
+// readJarAttributes reads the "key<sep>value" lines of a pom.properties (sep "=") or
+// the main section of a MANIFEST.MF (sep ":"), where lines starting with a space
+// continue the previous value
+func readJarAttributes(file *zip.File, sep string) (map[string]string, error) {
+	f, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", file.Name, err)
+	}
+	defer f.Close()
+
+	attrs := make(map[string]string)
+	var last string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case line == "":
+			// Per-entry manifest sections follow the first blank line
+			if sep == ":" {
+				return attrs, nil
+			}
+		case strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, " ") && last != "":
+			attrs[last] += line[1:]
+		default:
+			key, value, found := strings.Cut(line, sep)
+			if !found {
+				continue
+			}
+			last = strings.TrimSpace(key)
+			attrs[last] = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", file.Name, err)
+	}
+	return attrs, nil
+}
@@ -0,0 +1,72 @@
+package scanner
+
+import (
+	"errors"
+	"os"
+
+	"github.com/squarehole/package-scanner/pkg/signing"
+)
+
+// runKeysGenerate creates the signing key pair, or the keyless signing setup, used for report attestation
+func (c *Controller) runKeysGenerate() {
+	var keyring *signing.Keyring
+	var err error
+	if c.config.Keyless {
+		keyring, err = signing.GenerateKeyless(c.config.KeysDir, signing.Keyless{
+			OIDCIssuer: c.config.OIDCIssuer,
+			Identity:   c.config.Identity,
+		})
+	} else {
+		keyring, err = signing.Generate(c.config.KeysDir)
+	}
+	if errors.Is(err, signing.ErrKeyringExists) {
+		c.logger.Error("Signing keys already exist", "dir", c.config.KeysDir, "hint", "use keys rotate to replace them")
+		os.Exit(1)
+	}
+	if err != nil {
+		c.logger.Error("Error generating signing keys", "error", err)
+		os.Exit(1)
+	}
+
+	if keyring.Mode == signing.ModeKeyless {
+		c.logger.Info("Keyless signing configured",
+			"dir", c.config.KeysDir,
+			"oidcIssuer", keyring.Keyless.OIDCIssuer,
+			"identity", keyring.Keyless.Identity,
+			"fulcio", keyring.Keyless.FulcioURL,
+			"rekor", keyring.Keyless.RekorURL)
+		return
+	}
+	c.logger.Info("Signing key generated", "dir", c.config.KeysDir, "keyID", keyring.KeyID)
+}
+
+// runKeysRotate replaces the signing key pair, keeping the old public key for verification
+func (c *Controller) runKeysRotate() {
+	keyring, err := signing.Rotate(c.config.KeysDir)
+	if err != nil {
+		c.logger.Error("Error rotating signing keys", "error", err)
+		os.Exit(1)
+	}
+
+	retired := keyring.Retired[len(keyring.Retired)-1]
+	c.logger.Info("Signing key rotated", "dir", c.config.KeysDir, "keyID", keyring.KeyID, "retiredKeyID", retired.KeyID)
+}
+
+// runKeysExport writes the public keys verifiers need to --out, or to stdout
+func (c *Controller) runKeysExport() {
+	data, err := signing.Export(c.config.KeysDir)
+	if err != nil {
+		c.logger.Error("Error exporting signing keys", "error", err)
+		os.Exit(1)
+	}
+
+	if c.config.OutputPath == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(c.config.OutputPath, data, 0644); err != nil {
+		c.logger.Error("Error writing exported keys", "path", c.config.OutputPath, "error", err)
+		os.Exit(1)
+	}
+	c.logger.Info("Public keys exported", "path", c.config.OutputPath)
+}
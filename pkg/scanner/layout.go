@@ -0,0 +1,159 @@
+package scanner
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// layoutRule identifies a package from the directories above an artifact, given the
+// slash-separated elements of its path relative to the scanned location
+type layoutRule func(segments []string) (PackageInfo, bool)
+
+// registryLayouts are the registry mirror layouts artifacts are recognized in, in the
+// order they are tried. Every rule requires the file name to agree with the directories,
+// so an unrelated directory that happens to share a name is not mistaken for a layout.
+var registryLayouts = []struct {
+	name  string
+	match layoutRule
+}{
+	{"nuget-flat-container", nugetLayout},
+	{"npm-registry", npmLayout},
+	{"pypi-simple", pypiLayout},
+}
+
+// pypiSeparators are the runs of characters PEP 503 normalizes to a single dash
+var pypiSeparators = regexp.MustCompile(`[-_.]+`)
+
+// pypiExtensions are the distribution files found in a simple index project directory
+var pypiExtensions = []string{".whl", ".egg", ".tar.gz", ".tar.bz2"}
+
+// inferFromLayout identifies an artifact from where it sits in a registry mirror, such
+// as a NuGet flat container, an npm registry cache or a PyPI simple index. The layout
+// also settles the ecosystem, e.g. for a .tar.gz that could be an npm or PyPI package.
+// It returns the name of the layout that matched.
+func inferFromLayout(relPath string) (PackageInfo, string, bool) {
+	segments := strings.Split(strings.Trim(path.Clean(strings.ReplaceAll(relPath, `\`, "/")), "/"), "/")
+	for _, layout := range registryLayouts {
+		if pkg, ok := layout.match(segments); ok {
+			return pkg, layout.name, true
+		}
+	}
+	return PackageInfo{}, "", false
+}
+
+// nugetLayout matches the NuGet V3 flat container and hierarchical feed layout,
+// <id>/<version>/<id>.<version>.nupkg
+func nugetLayout(segments []string) (PackageInfo, bool) {
+	n := len(segments)
+	if n < 3 {
+		return PackageInfo{}, false
+	}
+	id, version, file := segments[n-3], segments[n-2], segments[n-1]
+	if !strings.EqualFold(file, id+"."+version+".nupkg") || !startsWithDigit(version) {
+		return PackageInfo{}, false
+	}
+	return PackageInfo{Name: id, Version: version, Ecosystem: "NuGet"}, true
+}
+
+// npmLayout matches the registry tarball layout, [@scope/]<name>/-/<name>-<version>.tgz,
+// and the storage of registry caches such as Verdaccio, [@scope/]<name>/<name>-<version>.tgz
+func npmLayout(segments []string) (PackageInfo, bool) {
+	n := len(segments)
+	stem, ok := strings.CutSuffix(segments[n-1], ".tgz")
+	if !ok || n < 2 {
+		return PackageInfo{}, false
+	}
+
+	nameAt := n - 2
+	if segments[nameAt] == "-" {
+		nameAt--
+	}
+	if nameAt < 0 {
+		return PackageInfo{}, false
+	}
+	name := segments[nameAt]
+	version, ok := strings.CutPrefix(stem, name+"-")
+	if !ok || !startsWithDigit(version) {
+		return PackageInfo{}, false
+	}
+	if nameAt > 0 && strings.HasPrefix(segments[nameAt-1], "@") {
+		name = segments[nameAt-1] + "/" + name
+	}
+	return PackageInfo{Name: name, Version: version, Ecosystem: "npm"}, true
+}
+
+// pypiLayout matches a PEP 503 simple index mirror, <normalized-project>/<distribution>,
+// where the distribution's name normalizes to the project directory's name
+func pypiLayout(segments []string) (PackageInfo, bool) {
+	n := len(segments)
+	if n < 2 {
+		return PackageInfo{}, false
+	}
+	project, file := segments[n-2], segments[n-1]
+	if project != normalizePyPIName(project) {
+		return PackageInfo{}, false
+	}
+
+	var stem, ext string
+	for _, e := range pypiExtensions {
+		if s, ok := strings.CutSuffix(strings.ToLower(file), e); ok {
+			stem, ext = file[:len(s)], e
+			break
+		}
+	}
+	if ext == "" {
+		return PackageInfo{}, false
+	}
+
+	// The name ends at the dash after which the rest of the stem starts with the version
+	for i := strings.Index(stem, "-"); i >= 0; i = nextDash(stem, i) {
+		if normalizePyPIName(stem[:i]) != project {
+			continue
+		}
+		version := stem[i+1:]
+		// Wheels and eggs add tags after the version: name-version(-build)?-python-abi-platform
+		if ext == ".whl" || ext == ".egg" {
+			version, _, _ = strings.Cut(version, "-")
+		}
+		if !startsWithDigit(version) {
+			return PackageInfo{}, false
+		}
+		return PackageInfo{Name: project, Version: version, Ecosystem: "PyPI"}, true
+	}
+	return PackageInfo{}, false
+}
+
+// nextDash returns the index of the next dash in s after index i, or -1
+func nextDash(s string, i int) int {
+	j := strings.Index(s[i+1:], "-")
+	if j < 0 {
+		return -1
+	}
+	return i + 1 + j
+}
+
+// normalizePyPIName normalizes a Python project name as PEP 503 does
+func normalizePyPIName(name string) string {
+	return strings.ToLower(pypiSeparators.ReplaceAllString(name, "-"))
+}
+
+// identify identifies an artifact from its slash-separated path relative to the scanned
+// location: from the registry mirror layout the path follows, if any, which is more
+// reliable than the file name, and otherwise from the file name
+func (ps *PackageScanner) identify(relPath string) (PackageInfo, error) {
+	if pkg, layout, ok := inferFromLayout(relPath); ok {
+		ps.logger.Debug("Package identified from directory layout",
+			"path", relPath,
+			"layout", layout,
+			"name", pkg.Name,
+			"version", pkg.Version)
+		return pkg, nil
+	}
+	return ps.ExtractPackageInfo(path.Base(relPath))
+}
+
+// startsWithDigit reports whether a version string starts with a digit
+func startsWithDigit(version string) bool {
+	return version != "" && version[0] >= '0' && version[0] <= '9'
+}
@@ -0,0 +1,113 @@
+package scanner
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// nuspec is the subset of a NuGet package manifest used for scanning
+type nuspec struct {
+	Metadata struct {
+		ID           string `xml:"id"`
+		Version      string `xml:"version"`
+		Dependencies struct {
+			// Dependencies are listed per target framework, or directly for old packages
+			Groups []struct {
+				Dependencies []nuspecDependency `xml:"dependency"`
+			} `xml:"group"`
+			Dependencies []nuspecDependency `xml:"dependency"`
+		} `xml:"dependencies"`
+	} `xml:"metadata"`
+}
+
+// nuspecDependency is a dependency declared with a NuGet version range
+type nuspecDependency struct {
+	ID      string `xml:"id,attr"`
+	Version string `xml:"version,attr"`
+}
+
+// readNuspec reads the manifest at the root of a .nupkg archive
+func readNuspec(r io.ReaderAt, size int64) (*nuspec, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("error opening package archive: %w", err)
+	}
+
+	for _, file := range archive.File {
+		if path.Dir(file.Name) != "." || !strings.EqualFold(path.Ext(file.Name), ".nuspec") {
+			continue
+		}
+
+		f, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("error opening %s: %w", file.Name, err)
+		}
+		defer f.Close()
+
+		var spec nuspec
+		if err := xml.NewDecoder(f).Decode(&spec); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", file.Name, err)
+		}
+		if spec.Metadata.ID == "" || spec.Metadata.Version == "" {
+			return nil, fmt.Errorf("%s has no id or version", file.Name)
+		}
+		return &spec, nil
+	}
+	return nil, fmt.Errorf("no .nuspec manifest in package")
+}
+
+// nupkgPackages identifies a .nupkg from its embedded .nuspec, falling back to the
+// feed layout or file name when the manifest cannot be read. With NuspecDependencies
+// set, the declared dependencies follow the package itself.
+func (ps *PackageScanner) nupkgPackages(r io.ReaderAt, size int64, name string) ([]PackageInfo, error) {
+	spec, err := readNuspec(r, size)
+	if err != nil {
+		return ps.filenameFallback(name, err)
+	}
+
+	packages := []PackageInfo{{Name: spec.Metadata.ID, Version: spec.Metadata.Version, Ecosystem: ps.Ecosystem}}
+	if ps.NuspecDependencies {
+		packages = append(packages, spec.dependencies(ps.Ecosystem)...)
+	}
+	return packages, nil
+}
+
+// dependencies returns the declared dependencies, each at the lowest version its
+// range allows, which is the version NuGet resolves when nothing else constrains it.
+// Dependencies without a lower bound are skipped.
+func (spec *nuspec) dependencies(ecosystem string) []PackageInfo {
+	declared := spec.Metadata.Dependencies.Dependencies
+	for _, group := range spec.Metadata.Dependencies.Groups {
+		declared = append(declared, group.Dependencies...)
+	}
+
+	seen := make(map[string]bool)
+	var packages []PackageInfo
+	for _, dep := range declared {
+		version := nugetMinimumVersion(dep.Version)
+		key := strings.ToLower(dep.ID) + "@" + version
+		if dep.ID == "" || version == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		packages = append(packages, PackageInfo{Name: dep.ID, Version: version, Ecosystem: ecosystem})
+	}
+	return packages
+}
+
+// nugetMinimumVersion returns the lower bound of a NuGet version range such as
+// "1.0", "[1.0,2.0)" or "(,2.0]". An exclusive lower bound is returned as is,
+// since the next version cannot be known.
+func nugetMinimumVersion(versionRange string) string {
+	versionRange = strings.TrimSpace(versionRange)
+	if !strings.HasPrefix(versionRange, "[") && !strings.HasPrefix(versionRange, "(") {
+		return versionRange
+	}
+
+	lower, _, _ := strings.Cut(versionRange[1:], ",")
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(lower, "]"), ")"))
+}
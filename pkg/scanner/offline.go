@@ -0,0 +1,123 @@
+package scanner
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/offline"
+)
+
+// runOfflineBundle prepares the offline database on the connected side and packages it,
+// together with the EPSS/KEV data and tool configuration, into a single artifact
+func (c *Controller) runOfflineBundle() {
+	if len(c.config.Ecosystems) == 0 || c.config.OutputPath == "" {
+		c.logger.Error("offline bundle requires --ecosystems and --out, e.g. offline bundle --ecosystems npm,NuGet --out bundle.tar.zst")
+		os.Exit(1)
+	}
+
+	downloader := c.offlineDownloader()
+
+	opts := offline.BundleOptions{Ecosystems: c.config.Ecosystems, EnvFile: ".env"}
+	if c.config.Since != "" {
+		base, err := parseSince(c.config.Since, c.config.Ecosystems)
+		if err != nil {
+			c.logger.Error("Invalid --since value", "error", err)
+			os.Exit(1)
+		}
+		opts.Base = base
+
+		// A delta bundle carries the latest changes, so refresh before packaging
+		if _, err := downloader.Update(c.config.OfflineDir, c.config.Ecosystems); err != nil {
+			c.logger.Error("Error updating offline database", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if _, err := downloader.Prepare(c.config.OfflineDir, c.config.Ecosystems); err != nil {
+		c.logger.Error("Error preparing offline database", "error", err)
+		os.Exit(1)
+	}
+
+	if err := offline.CreateBundle(c.config.OfflineDir, c.config.OutputPath, opts); err != nil {
+		c.logger.Error("Error creating offline bundle", "error", err)
+		os.Exit(1)
+	}
+
+	c.reporter.DisplayInfo("Offline bundle written to %s (ecosystems: %s)", c.config.OutputPath, strings.Join(c.config.Ecosystems, ", "))
+}
+
+// runOfflineLoad installs a bundle into the offline database directory on the isolated side
+func (c *Controller) runOfflineLoad() {
+	if len(c.config.CommandArgs) != 1 {
+		c.logger.Error("offline load requires exactly one bundle path, e.g. offline load bundle.tar.zst")
+		os.Exit(1)
+	}
+	bundle := c.config.CommandArgs[0]
+
+	manifest, err := offline.LoadBundle(bundle, c.config.OfflineDir)
+	if err != nil {
+		c.logger.Error("Error loading offline bundle", "bundle", bundle, "error", err)
+		os.Exit(1)
+	}
+
+	for ecosystem, state := range manifest.Ecosystems {
+		if manifest.Delta {
+			c.reporter.DisplayInfo("Applied %s advisory changes from %s to %s", ecosystem, state.Since.Format(time.RFC3339), state.Watermark.Format(time.RFC3339))
+			continue
+		}
+		c.reporter.DisplayInfo("Loaded %s advisories (downloaded %s)", ecosystem, state.UpdatedAt.Format("2006-01-02 15:04 MST"))
+	}
+	c.reporter.DisplayInfo("Offline database ready in %s; scan with --offline --offline-dir %s", c.config.OfflineDir, c.config.OfflineDir)
+}
+
+// runOfflineUpdate refreshes the offline database with the advisories modified since it was last updated
+func (c *Controller) runOfflineUpdate() {
+	results, err := c.offlineDownloader().Update(c.config.OfflineDir, c.config.Ecosystems)
+	for _, result := range results {
+		if result.Full {
+			c.reporter.DisplayInfo("Downloaded all %s advisories (up to %s)", result.Ecosystem, result.Watermark.Format(time.RFC3339))
+		} else {
+			c.reporter.DisplayInfo("Updated %d %s advisories (up to %s)", result.Records, result.Ecosystem, result.Watermark.Format(time.RFC3339))
+		}
+	}
+	if err != nil {
+		c.logger.Error("Error updating offline database", "error", err)
+		os.Exit(1)
+	}
+	if len(results) == 0 {
+		c.reporter.DisplayWarning("Offline database in %s is empty; pass --ecosystems to choose what to download", c.config.OfflineDir)
+	}
+}
+
+// offlineDownloader creates a downloader for the configured offline data sources
+func (c *Controller) offlineDownloader() *offline.Downloader {
+	return offline.NewDownloader(offline.Sources{
+		OSVBulkURL: c.config.OSVBulkURL,
+		EPSSURL:    c.config.EPSSURL,
+		KEVURL:     c.config.KEVURL,
+	}, c.logger)
+}
+
+// parseSince interprets --since as either the manifest.json of the receiving side,
+// giving per-ecosystem watermarks, or a single RFC 3339 time (or date) for all ecosystems
+func parseSince(value string, ecosystems []string) (*offline.Manifest, error) {
+	if _, err := os.Stat(value); err == nil {
+		return offline.ReadManifestFile(value)
+	}
+
+	since, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		since, err = time.Parse("2006-01-02", value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%q is neither a manifest file nor an RFC 3339 time", value)
+	}
+
+	base := &offline.Manifest{Ecosystems: make(map[string]offline.EcosystemState)}
+	for _, ecosystem := range ecosystems {
+		base.Ecosystems[ecosystem] = offline.EcosystemState{Watermark: since}
+	}
+	return base, nil
+}
@@ -0,0 +1,68 @@
+package scanner
+
+import (
+	"errors"
+	"os"
+
+	"github.com/squarehole/package-scanner/pkg/policy"
+)
+
+// runPolicyImport converts a triage spreadsheet into policy suppressions. With --out the
+// suppressions are merged into that policy file, replacing entries for the same finding;
+// otherwise the imported policy is written to stdout.
+func (c *Controller) runPolicyImport() {
+	if len(c.config.CommandArgs) != 1 {
+		c.logger.Error("policy import requires a single spreadsheet, e.g. policy import --format csv triage.csv")
+		os.Exit(1)
+	}
+	if c.config.Format != "" && c.config.Format != "csv" {
+		c.logger.Error("Unsupported spreadsheet format", "format", c.config.Format, "supported", "csv")
+		os.Exit(1)
+	}
+
+	path := c.config.CommandArgs[0]
+	file, err := os.Open(path)
+	if err != nil {
+		c.logger.Error("Error opening spreadsheet", "path", path, "error", err)
+		os.Exit(1)
+	}
+	imported, err := policy.ImportCSV(file)
+	file.Close()
+	if err != nil {
+		c.logger.Error("Error importing spreadsheet", "path", path, "error", err)
+		os.Exit(1)
+	}
+
+	target := &policy.Policy{}
+	if c.config.OutputPath != "" {
+		target, err = policy.Load(c.config.OutputPath)
+		if errors.Is(err, os.ErrNotExist) {
+			target = &policy.Policy{}
+		} else if err != nil {
+			c.logger.Error("Error loading existing policy", "error", err)
+			os.Exit(1)
+		}
+	}
+	replaced := target.Merge(imported.Suppressions)
+
+	data, err := target.Marshal()
+	if err != nil {
+		c.logger.Error("Error encoding policy", "error", err)
+		os.Exit(1)
+	}
+
+	if c.config.OutputPath == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(c.config.OutputPath, data, 0644); err != nil {
+		c.logger.Error("Error writing policy", "path", c.config.OutputPath, "error", err)
+		os.Exit(1)
+	}
+	c.logger.Info("Triage decisions imported",
+		"path", path,
+		"policy", c.config.OutputPath,
+		"suppressions", len(imported.Suppressions),
+		"replaced", replaced,
+		"skipped", imported.Skipped)
+}
@@ -0,0 +1,117 @@
+package scanner
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/squarehole/package-scanner/pkg/lockfile"
+)
+
+// runPrime fetches the advisories of every dependency listed in the --input SBOMs and
+// lockfiles into the on-disk query cache without reporting findings, so later scans on
+// the same machine are answered from the cache. Entries that are still fresh are kept.
+func (c *Controller) runPrime() {
+	if c.diskCache == nil {
+		c.logger.Error("prime requires --cache-dir and the online OSV source; the cache holds OSV API responses")
+		os.Exit(1)
+	}
+
+	inputs := append(append([]string{}, c.config.Inputs...), c.config.CommandArgs...)
+	if len(inputs) == 0 {
+		c.logger.Error("prime requires at least one input, e.g. prime --input sbom.json --cache-dir=.osv-cache")
+		os.Exit(1)
+	}
+
+	packageScanner := NewPackageScanner("", "", c.logger)
+	seen := make(map[string]bool)
+	var packages []PackageInfo
+	for _, input := range inputs {
+		found, err := c.primeInput(packageScanner, input)
+		if err != nil {
+			c.logger.Error("Error reading prime input", "path", input, "error", err)
+			os.Exit(1)
+		}
+		for _, pkg := range found {
+			key := pkg.Ecosystem + "|" + pkg.Name + "|" + pkg.Version
+			if !seen[key] {
+				seen[key] = true
+				packages = append(packages, pkg)
+			}
+		}
+	}
+
+	var fetched, warm, failed int
+	var mu sync.Mutex
+	sem := make(chan bool, c.config.Concurrency)
+	var wg sync.WaitGroup
+	for _, pkg := range packages {
+		if c.diskCache.fresh(pkg.Name, pkg.Version, pkg.Ecosystem) {
+			warm++
+			continue
+		}
+
+		wg.Add(1)
+		c.adaptive.acquire()
+		sem <- true
+		go func(pkg PackageInfo) {
+			defer wg.Done()
+			defer c.adaptive.release()
+			defer func() { <-sem }()
+
+			_, _, _, err := c.queryPackage(pkg.Name, pkg.Version, pkg.Ecosystem)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				c.reporter.DisplayError("Error fetching %s@%s: %v", pkg.Name, pkg.Version, err)
+				failed++
+				return
+			}
+			fetched++
+		}(pkg)
+	}
+	wg.Wait()
+	c.logAdaptiveConcurrency()
+
+	c.logger.Info("Query cache primed",
+		"cacheDir", c.config.CacheDir,
+		"packages", len(packages),
+		"fetched", fetched,
+		"alreadyCached", warm,
+		"errors", failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// primeInput returns the dependencies of a lockfile, of the lockfiles below a directory,
+// or of an SBOM
+func (c *Controller) primeInput(packageScanner *PackageScanner, input string) ([]PackageInfo, error) {
+	info, err := os.Stat(input)
+	if err != nil {
+		return nil, fmt.Errorf("error accessing %s: %w", input, err)
+	}
+
+	filter := lockfileFilter{skipDev: c.config.SkipDev, skipUnpublished: c.config.SkipUnpublished}
+	switch {
+	case info.IsDir():
+		paths, err := lockfile.Find(input)
+		if err != nil {
+			return nil, err
+		}
+		var packages []PackageInfo
+		for _, path := range paths {
+			found, err := lockfilePackages(path, filter)
+			if err != nil {
+				return nil, err
+			}
+			packages = append(packages, found...)
+		}
+		return packages, nil
+	case lockfile.IsLockfile(input):
+		return lockfilePackages(input, filter)
+	default:
+		return packageScanner.sbomPackages(input)
+	}
+}
@@ -0,0 +1,121 @@
+package scanner
+
+import "sync"
+
+// ProgressEvent tells what a progress update is about
+type ProgressEvent int
+
+const (
+	// FileDiscovered is sent for each artifact found in a directory or remote location
+	// that passed the filters
+	FileDiscovered ProgressEvent = iota
+	// PackageFound is sent for each package found in an artifact, lockfile or SBOM
+	PackageFound
+	// PackageQueried is sent when the advisories of a package have been checked
+	PackageQueried
+	// DiscoveryFinished is sent once every target has been read, from when PackagesFound
+	// is the total number of packages the scan checks
+	DiscoveryFinished
+)
+
+// String returns the name of the event
+func (e ProgressEvent) String() string {
+	switch e {
+	case FileDiscovered:
+		return "file_discovered"
+	case PackageFound:
+		return "package_found"
+	case PackageQueried:
+		return "package_queried"
+	case DiscoveryFinished:
+		return "discovery_finished"
+	}
+	return "unknown"
+}
+
+// Progress is a progress update of a scan. A PackageScanner only sets Event and Path;
+// updates from a Controller carry the totals of the scan so far as well.
+type Progress struct {
+	Event ProgressEvent
+	// Path is the artifact of a FileDiscovered update
+	Path string
+	// Package is the package of a PackageFound or PackageQueried update
+	Package PackageInfo
+	// Vulnerabilities is the number of findings of a PackageQueried update
+	Vulnerabilities int
+	// Err is the error a PackageQueried update's check failed with, if any
+	Err error
+
+	FilesDiscovered      int
+	PackagesFound        int
+	PackagesQueried      int
+	VulnerabilitiesFound int
+	Errors               int
+}
+
+// ProgressFunc receives progress updates, so embedders and interactive front ends can
+// render progress without parsing log output. A Controller serializes its calls; a
+// PackageScanner scanning several locations at once may call it concurrently.
+// It should return quickly, as the scan waits for it.
+type ProgressFunc func(Progress)
+
+// ControllerOption configures optional Controller behaviour
+type ControllerOption func(*Controller)
+
+// WithProgress reports the progress of directory, lockfile and SBOM scans to fn
+func WithProgress(fn ProgressFunc) ControllerOption {
+	return func(c *Controller) {
+		c.progress = &progressTracker{fn: fn}
+	}
+}
+
+// progressTracker keeps the totals of a scan and passes updates on, one at a time
+type progressTracker struct {
+	fn ProgressFunc
+
+	mu     sync.Mutex
+	totals Progress
+}
+
+// fileDiscovered reports an artifact found by the package scanner
+func (t *progressTracker) fileDiscovered(update Progress) {
+	t.send(update, func(totals *Progress) { totals.FilesDiscovered++ })
+}
+
+// packageFound reports a package queued for checking
+func (t *progressTracker) packageFound(pkg PackageInfo) {
+	t.send(Progress{Event: PackageFound, Package: pkg}, func(totals *Progress) { totals.PackagesFound++ })
+}
+
+// packageQueried reports a package whose advisories were checked
+func (t *progressTracker) packageQueried(pkg PackageInfo, vulnerabilities int, err error) {
+	update := Progress{Event: PackageQueried, Package: pkg, Vulnerabilities: vulnerabilities, Err: err}
+	t.send(update, func(totals *Progress) {
+		totals.PackagesQueried++
+		totals.VulnerabilitiesFound += vulnerabilities
+		if err != nil {
+			totals.Errors++
+		}
+	})
+}
+
+// discoveryFinished reports that every target has been read
+func (t *progressTracker) discoveryFinished() {
+	t.send(Progress{Event: DiscoveryFinished}, func(*Progress) {})
+}
+
+// send updates the totals and passes the update on with them
+func (t *progressTracker) send(update Progress, count func(*Progress)) {
+	if t == nil || t.fn == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	count(&t.totals)
+	update.FilesDiscovered = t.totals.FilesDiscovered
+	update.PackagesFound = t.totals.PackagesFound
+	update.PackagesQueried = t.totals.PackagesQueried
+	update.VulnerabilitiesFound = t.totals.VulnerabilitiesFound
+	update.Errors = t.totals.Errors
+	t.fn(update)
+}
@@ -0,0 +1,144 @@
+package scanner
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+	"github.com/squarehole/package-scanner/pkg/osv"
+)
+
+// Adaptation of the rate limiter to throttling by the OSV API
+const (
+	// rateLimitRetries is how often a throttled query is retried before its error is returned
+	rateLimitRetries = 3
+	// rateLimitBackoffInterval is the least time between two reductions of the rate, so
+	// a burst of throttled responses to queries sent at the old rate halves it only once
+	rateLimitBackoffInterval = time.Second
+	// rateLimitRecoverAfter is the number of successful queries after which a reduced
+	// rate is raised again by a tenth of the configured rate
+	rateLimitRecoverAfter = 20
+	// rateLimitFloorFraction is the lowest fraction of the configured rate it is reduced to
+	rateLimitFloorFraction = 0.05
+)
+
+// rateLimiter is a token bucket shared by all goroutines querying the OSV API, so the
+// request rate stays the same however many workers --concurrency starts. When the API
+// answers with 429 Too Many Requests, the rate is halved and pauses for any Retry-After
+// the API asked for; it grows back towards the configured rate as queries succeed.
+type rateLimiter struct {
+	mu          sync.Mutex
+	max         float64
+	rate        float64
+	floor       float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+	lastBackoff time.Time
+	successes   int
+}
+
+// newRateLimiter creates a limiter allowing rps requests per second, or returns nil
+// when rps is not positive
+func newRateLimiter(rps float64) *rateLimiter {
+	if rps <= 0 {
+		return nil
+	}
+	burst := max(1, rps)
+	return &rateLimiter{
+		max:    rps,
+		rate:   rps,
+		floor:  rps * rateLimitFloorFraction,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until a request may be sent
+func (l *rateLimiter) wait() {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+
+	// Take a token; a negative balance reserves one that has yet to be refilled
+	l.tokens--
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	if pause := l.pausedUntil.Sub(now); pause > delay {
+		delay = pause
+	}
+	l.mu.Unlock()
+
+	time.Sleep(delay)
+}
+
+// observe adapts the rate to the outcome of a request and reports whether the
+// request was throttled
+func (l *rateLimiter) observe(err error) bool {
+	var apiErr *osv.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		if err == nil {
+			l.succeeded()
+		}
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.successes = 0
+	if apiErr.RetryAfter > 0 && now.Add(apiErr.RetryAfter).After(l.pausedUntil) {
+		l.pausedUntil = now.Add(apiErr.RetryAfter)
+	}
+	if now.Sub(l.lastBackoff) >= rateLimitBackoffInterval && l.rate > l.floor {
+		l.lastBackoff = now
+		l.rate = max(l.floor, l.rate/2)
+		// Drop the tokens saved at the old rate so the lower rate applies at once
+		l.tokens = min(l.tokens, 0)
+		slog.Warn("OSV API is throttling queries, lowering the rate limit",
+			"requests_per_second", l.rate, "retry_after", apiErr.RetryAfter)
+	}
+	return true
+}
+
+// succeeded counts a successful request, raising a reduced rate after enough of them
+func (l *rateLimiter) succeeded() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate >= l.max {
+		return
+	}
+	l.successes++
+	if l.successes >= rateLimitRecoverAfter {
+		l.successes = 0
+		l.rate = min(l.max, l.rate+l.max/10)
+		slog.Debug("Raising the OSV rate limit", "requests_per_second", l.rate)
+	}
+}
+
+// rateLimitedSource sends the queries of an advisory source through a shared rate
+// limiter, retrying queries the API throttled
+type rateLimitedSource struct {
+	source  vulnerabilitySource
+	limiter *rateLimiter
+}
+
+// QueryPackage waits for the limiter before each attempt at the query
+func (r rateLimitedSource) QueryPackage(packageName, packageVersion, packageEcosystem string) (models.ScanResults, []byte, error) {
+	for attempt := 0; ; attempt++ {
+		r.limiter.wait()
+		results, body, err := r.source.QueryPackage(packageName, packageVersion, packageEcosystem)
+		if !r.limiter.observe(err) || attempt == rateLimitRetries {
+			return results, body, err
+		}
+		slog.Debug("Retrying throttled OSV query", "package", packageName, "version", packageVersion, "attempt", attempt+1)
+	}
+}
@@ -0,0 +1,224 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/remote"
+)
+
+// remoteDownloads is how many remote artifacts are downloaded at once for inspection
+const remoteDownloads = 4
+
+// ScanRemote scans an S3 or GCS prefix or an HTTP directory listing for packages with
+// the scanner's extensions. Artifacts identified by their file name are not downloaded;
+// archives carrying their own metadata are downloaded to a temporary file and read.
+// The filters, depth limit and a .scannerignore object at the location apply as they
+// do to a local directory.
+func (ps *PackageScanner) ScanRemote(location string) ([]PackageInfo, error) {
+	var packages []PackageInfo
+	for pkg, err := range ps.ScanRemoteStream(location) {
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, pkg)
+	}
+	return packages, nil
+}
+
+// ScanRemoteStream scans a remote location like ScanRemote, yielding each package as
+// it is identified instead of collecting them. Archives are downloaded a few at a time
+// in the background while the listing is worked through, and their packages yielded as
+// the downloads complete, so at most remoteDownloads artifacts are held at once.
+// An error ends the sequence; breaking out of the loop stops the downloads.
+func (ps *PackageScanner) ScanRemoteStream(location string) iter.Seq2[PackageInfo, error] {
+	return func(yield func(PackageInfo, error) bool) {
+		// The scan is timed less the time spent waiting for the consumer
+		began := time.Now()
+		var waited time.Duration
+		defer func() { ps.stats.add(phaseWalk, time.Since(began)-waited) }()
+
+		store, err := remote.New(location)
+		if err != nil {
+			yield(PackageInfo{}, err)
+			return
+		}
+
+		objects, err := store.List(ps.MaxDepth)
+		if err != nil {
+			yield(PackageInfo{}, err)
+			return
+		}
+
+		ignore, err := loadRemoteIgnoreFile(store)
+		if err != nil {
+			yield(PackageInfo{}, err)
+			return
+		}
+
+		// The listing is worked through in the background, passing on the packages of
+		// each artifact; stop tells it the consumer has stopped reading
+		out := make(chan []PackageInfo)
+		stop := make(chan struct{})
+		defer close(stop)
+		send := func(packages []PackageInfo) bool {
+			select {
+			case out <- packages:
+				return true
+			case <-stop:
+				return false
+			}
+		}
+
+		skipped := 0
+		go func() {
+			defer close(out)
+			sem := make(chan struct{}, remoteDownloads)
+			var wg sync.WaitGroup
+			defer wg.Wait()
+
+			for _, obj := range objects {
+				fileScanner := ps.forFile(path.Base(obj.Path))
+				if fileScanner == nil {
+					if ps.countsUnknown(obj.Path, ignore) && !ps.excludesRemoteDir(obj.Path, ignore) {
+						ps.Coverage.unknown(path.Base(obj.Path))
+					}
+					continue
+				}
+
+				// Listings without modification times are not filtered by age
+				filter := ps.Filter
+				if obj.ModTime.IsZero() {
+					filter.ModifiedSince = time.Time{}
+				}
+				if !filter.Matches(obj.Path, obj.ModTime) || ps.excludesRemoteDir(obj.Path, ignore) || ignore.ignores(obj.Path, false) {
+					skipped++
+					continue
+				}
+				ps.discovered(obj.URL)
+
+				if fileScanner.inspector() != nil {
+					select {
+					case sem <- struct{}{}:
+					case <-stop:
+						return
+					}
+					wg.Add(1)
+					go func(obj remote.Object) {
+						defer wg.Done()
+						defer func() { <-sem }()
+
+						pkgs, err := fileScanner.inspectRemote(store, obj)
+						if err != nil {
+							ps.logger.Warn("Could not parse package information",
+								"filename", obj.URL,
+								"error", err)
+							ps.Coverage.failed(fileScanner)
+							return
+						}
+						ps.Coverage.parsed(fileScanner)
+						send(pkgs)
+					}(obj)
+					continue
+				}
+
+				pkg, err := fileScanner.identify(obj.Path)
+				if err != nil {
+					ps.logger.Warn("Could not parse package information",
+						"filename", obj.URL,
+						"error", err)
+					ps.Coverage.failed(fileScanner)
+					continue
+				}
+				ps.Coverage.parsed(fileScanner)
+				pkg.FilePath = obj.URL
+				if !send([]PackageInfo{pkg}) {
+					return
+				}
+			}
+		}()
+
+		for pkgs := range out {
+			for _, pkg := range pkgs {
+				ps.logCaseSensitivityWarning(pkg.Name, pkg.Ecosystem)
+				yielded := time.Now()
+				ok := yield(pkg, nil)
+				waited += time.Since(yielded)
+				if !ok {
+					return
+				}
+			}
+		}
+
+		if skipped > 0 {
+			ps.logger.Info("Artifacts skipped by filters", "path", location, "count", skipped)
+		}
+	}
+}
+
+// excludesRemoteDir reports whether any directory above a remote object matches an
+// --exclude pattern or is ignored by the location's .scannerignore object
+func (ps *PackageScanner) excludesRemoteDir(relPath string, ignore ignoreRules) bool {
+	for dir := path.Dir(relPath); dir != "."; dir = path.Dir(dir) {
+		if matchesAny(ps.Filter.Exclude, dir) || ignore.ignores(dir, true) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadRemoteIgnoreFile reads the .scannerignore object at a remote location, if there is one
+func loadRemoteIgnoreFile(store remote.Store) (ignoreRules, error) {
+	body, err := store.Open(ignoreFileName)
+	if errors.Is(err, remote.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", ignoreFileName, err)
+	}
+	return parseIgnoreRules(string(data)), nil
+}
+
+// inspectRemote downloads a remote artifact to a temporary file and identifies its
+// packages from the embedded metadata. Only the artifact's own package is attributed to it.
+func (ps *PackageScanner) inspectRemote(store remote.Store, obj remote.Object) ([]PackageInfo, error) {
+	body, err := store.Open(obj.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	f, err := os.CreateTemp("", "package-scanner-*")
+	if err != nil {
+		return nil, fmt.Errorf("error creating temporary file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, h), body)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s: %w", obj.URL, err)
+	}
+
+	packages, err := ps.inspector()(f, size, obj.Path)
+	if err != nil {
+		return nil, err
+	}
+	packages[0].FilePath = obj.URL
+	packages[0].Checksum = hexSum(h)
+	return packages, nil
+}
@@ -0,0 +1,143 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// RPM header tags read from a package
+const (
+	rpmTagName    = 1000
+	rpmTagVersion = 1001
+	rpmTagRelease = 1002
+	rpmTagEpoch   = 1003
+	rpmTagArch    = 1022
+)
+
+// RPM header value types used by those tags
+const (
+	rpmTypeInt32  = 4
+	rpmTypeString = 6
+)
+
+// rpmPackages identifies an .rpm from its header. The version is reported as
+// [epoch:]version-release, the form used by Red Hat advisories.
+func (ps *PackageScanner) rpmPackages(r io.ReaderAt, size int64, name string) ([]PackageInfo, error) {
+	tags, err := readRPMHeader(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return ps.filenameFallback(name, err)
+	}
+	if tags.strings[rpmTagName] == "" || tags.strings[rpmTagVersion] == "" {
+		return ps.filenameFallback(name, fmt.Errorf("RPM header has no name or version"))
+	}
+
+	version := tags.strings[rpmTagVersion]
+	if release := tags.strings[rpmTagRelease]; release != "" {
+		version += "-" + release
+	}
+	if epoch, ok := tags.ints[rpmTagEpoch]; ok {
+		version = strconv.Itoa(int(epoch)) + ":" + version
+	}
+
+	pkg := PackageInfo{
+		Name:         tags.strings[rpmTagName],
+		Version:      version,
+		Ecosystem:    ps.Ecosystem,
+		Architecture: tags.strings[rpmTagArch],
+	}
+	ps.logger.Debug("RPM package metadata read",
+		"filename", name,
+		"package", pkg.Name,
+		"version", pkg.Version,
+		"architecture", pkg.Architecture)
+	return []PackageInfo{pkg}, nil
+}
+
+// rpmTags holds the string and integer values of the header tags of interest
+type rpmTags struct {
+	strings map[int32]string
+	ints    map[int32]int32
+}
+
+// rpmHeaderMagic starts the signature and main headers of an RPM
+var rpmHeaderMagic = []byte{0x8e, 0xad, 0xe8, 0x01}
+
+// readRPMHeader skips an RPM's lead and signature header and reads the tags of
+// its main header
+func readRPMHeader(r io.Reader) (*rpmTags, error) {
+	lead := make([]byte, 96)
+	if _, err := io.ReadFull(r, lead); err != nil || !bytes.Equal(lead[:4], []byte{0xed, 0xab, 0xee, 0xdb}) {
+		return nil, fmt.Errorf("not an RPM package")
+	}
+
+	// The signature header is padded to a multiple of 8 bytes
+	storeSize, err := readRPMHeaderStructure(r, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error reading signature header: %w", err)
+	}
+	if pad := (8 - storeSize%8) % 8; pad > 0 {
+		if _, err := io.CopyN(io.Discard, r, int64(pad)); err != nil {
+			return nil, fmt.Errorf("error reading signature header: %w", err)
+		}
+	}
+
+	tags := &rpmTags{strings: make(map[int32]string), ints: make(map[int32]int32)}
+	if _, err := readRPMHeaderStructure(r, tags); err != nil {
+		return nil, fmt.Errorf("error reading header: %w", err)
+	}
+	return tags, nil
+}
+
+// readRPMHeaderStructure reads one header structure, returning the size of its data
+// store. With tags set, the values of the tags of interest are collected.
+func readRPMHeaderStructure(r io.Reader, tags *rpmTags) (uint32, error) {
+	intro := make([]byte, 16)
+	if _, err := io.ReadFull(r, intro); err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(intro[:4], rpmHeaderMagic) {
+		return 0, fmt.Errorf("invalid header magic")
+	}
+	count := binary.BigEndian.Uint32(intro[8:12])
+	storeSize := binary.BigEndian.Uint32(intro[12:16])
+	if count > 1<<16 || storeSize > 1<<28 {
+		return 0, fmt.Errorf("header too large")
+	}
+
+	index := make([]byte, 16*count)
+	if _, err := io.ReadFull(r, index); err != nil {
+		return 0, err
+	}
+	store := make([]byte, storeSize)
+	if _, err := io.ReadFull(r, store); err != nil {
+		return 0, err
+	}
+	if tags == nil {
+		return storeSize, nil
+	}
+
+	for i := uint32(0); i < count; i++ {
+		entry := index[16*i : 16*(i+1)]
+		tag := int32(binary.BigEndian.Uint32(entry[0:4]))
+		typ := binary.BigEndian.Uint32(entry[4:8])
+		offset := binary.BigEndian.Uint32(entry[8:12])
+		if offset >= storeSize {
+			continue
+		}
+
+		switch {
+		case typ == rpmTypeString && (tag == rpmTagName || tag == rpmTagVersion || tag == rpmTagRelease || tag == rpmTagArch):
+			value := store[offset:]
+			if end := bytes.IndexByte(value, 0); end >= 0 {
+				value = value[:end]
+			}
+			tags.strings[tag] = string(value)
+		case typ == rpmTypeInt32 && tag == rpmTagEpoch && offset+4 <= storeSize:
+			tags.ints[tag] = int32(binary.BigEndian.Uint32(store[offset : offset+4]))
+		}
+	}
+	return storeSize, nil
+}
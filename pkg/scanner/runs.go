@@ -0,0 +1,187 @@
+package scanner
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/cli"
+	"github.com/squarehole/package-scanner/pkg/db"
+	"github.com/squarehole/package-scanner/pkg/models"
+	"github.com/squarehole/package-scanner/pkg/reporting"
+)
+
+// dbRunsLimit is the number of recent scan runs db runs lists
+const dbRunsLimit = 20
+
+// scanRun is the scan run recorded in the store, totalling the packages the run checks
+// and the vulnerabilities it finds, per severity. Methods are nil-safe, so runs without
+// a store record nothing.
+type scanRun struct {
+	id int64
+
+	mu     sync.Mutex
+	totals reporting.ScanTotals
+}
+
+// record counts a checked package and the vulnerabilities found for it
+func (r *scanRun) record(vulnerabilities []models.Vulnerability) {
+	if r == nil {
+		return
+	}
+	severities := make([]string, len(vulnerabilities))
+	for i, vuln := range vulnerabilities {
+		severities[i] = reporting.SeverityLevel(vuln)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.totals.Add(severities)
+}
+
+// scanTotals returns the totals of the packages recorded so far
+func (r *scanRun) scanTotals() reporting.ScanTotals {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.totals
+}
+
+// runID returns the id findings are saved under, or 0 outside a run
+func (r *scanRun) runID() int64 {
+	if r == nil {
+		return 0
+	}
+	return r.id
+}
+
+// startRun records the start of a scan in the store, so the findings saved during the
+// run are linked to it and can be listed, compared and purged together
+func (c *Controller) startRun() {
+	if c.store == nil {
+		return
+	}
+	id, err := c.store.StartRun(c.ctx, c.runTarget(), cli.Version, c.config.Labels, time.Now())
+	if err != nil {
+		c.logger.Error("Error recording scan run", "error", err)
+		os.Exit(1)
+	}
+	c.run = &scanRun{id: id}
+	c.logger.Info("Scan run started", "runID", id)
+}
+
+// finishRun records the end of the scan run with its totals
+func (c *Controller) finishRun() {
+	if c.run == nil {
+		return
+	}
+	totals := c.run.scanTotals()
+	if err := c.store.FinishRun(c.ctx, c.run.id, time.Now(), totals.Packages, totals.Vulnerabilities, totals.Severities); err != nil {
+		c.logger.Error("Error recording end of scan run", "runID", c.run.id, "error", err)
+	}
+}
+
+// runTarget describes what a scan run scans: the artifact of scan file, the
+// directories, lockfiles and SBOMs of a directory scan, or the queried package
+func (c *Controller) runTarget() string {
+	switch {
+	case c.config.Command == "scan file" && c.config.Stdin:
+		return "stdin"
+	case c.config.Command == "scan file":
+		return strings.Join(c.config.CommandArgs, ", ")
+	case c.directoryScan():
+		var targets []string
+		targets = append(targets, c.config.DirectoryPaths...)
+		if c.config.TargetsFile != "" {
+			targets = append(targets, c.config.TargetsFile)
+		}
+		targets = append(targets, c.config.Lockfiles...)
+		targets = append(targets, c.config.SBOMFiles...)
+		targets = append(targets, c.config.AutoDirs...)
+		return strings.Join(targets, ", ")
+	default:
+		return fmt.Sprintf("%s@%s (%s)", c.config.PackageName, c.config.PackageVersion, c.config.PackageEcosystem)
+	}
+}
+
+// runDBRuns lists the most recent scan runs recorded in the configured database
+func (c *Controller) runDBRuns() {
+	database := c.openDatabase()
+	c.store = database
+
+	runs, err := database.GetRuns(c.ctx, dbRunsLimit)
+	if err != nil {
+		c.logger.Error("Error listing scan runs", "error", err)
+		os.Exit(1)
+	}
+	c.logger.Info("Scan runs", "count", len(runs))
+	for _, run := range runs {
+		finished := ""
+		if !run.FinishedAt.IsZero() {
+			finished = run.FinishedAt.Format(time.RFC3339)
+		}
+		c.logger.Info("Scan run",
+			"runID", run.ID,
+			"started", run.StartedAt.Format(time.RFC3339),
+			"finished", finished,
+			"target", run.Target,
+			"packages", run.PackageCount,
+			"vulnerabilities", run.VulnCount,
+			"critical", run.Severities.Critical,
+			"high", run.Severities.High,
+			"version", run.ToolVersion)
+	}
+}
+
+// runDBPurge removes the scan runs given by id, with the findings they recorded, or the
+// scan records the retention policy set by --older-than and --keep-runs no longer keeps
+func (c *Controller) runDBPurge() {
+	policy := db.RetentionPolicy{Before: c.config.PurgeBefore, KeepRuns: c.config.PurgeKeepRuns}
+	retention := !policy.Before.IsZero() || policy.KeepRuns > 0
+	switch {
+	case c.config.PurgeKeepRuns < 0:
+		c.logger.Error("--keep-runs must not be negative", "keepRuns", c.config.PurgeKeepRuns)
+		os.Exit(1)
+	case len(c.config.CommandArgs) > 0 && retention:
+		c.logger.Error("db purge takes either the ids of scan runs or --older-than and --keep-runs, not both")
+		os.Exit(1)
+	case len(c.config.CommandArgs) == 0 && !retention:
+		c.logger.Error("db purge requires the ids of the scan runs to remove, e.g. db purge 12 13, " +
+			"or a retention policy, e.g. db purge --older-than=90d --keep-runs=5")
+		os.Exit(1)
+	}
+
+	if retention {
+		database := c.openDatabase()
+		c.store = database
+		purged, err := database.Purge(c.ctx, policy)
+		if err != nil {
+			c.logger.Error("Error purging scan records", "error", err)
+			os.Exit(1)
+		}
+		c.logger.Info("Scan records purged", "findings", purged.Findings, "cleanScans", purged.CleanScans, "runs", purged.Runs)
+		return
+	}
+
+	ids := make([]int64, len(c.config.CommandArgs))
+	for i, arg := range c.config.CommandArgs {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || id <= 0 {
+			c.logger.Error("Invalid scan run id", "id", arg)
+			os.Exit(1)
+		}
+		ids[i] = id
+	}
+
+	database := c.openDatabase()
+	c.store = database
+	for _, id := range ids {
+		findings, err := database.DeleteRun(c.ctx, id)
+		if err != nil {
+			c.logger.Error("Error purging scan run", "runID", id, "error", err)
+			os.Exit(1)
+		}
+		c.logger.Info("Scan run purged", "runID", id, "findings", findings)
+	}
+}
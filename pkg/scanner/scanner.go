@@ -1,13 +1,24 @@
 package scanner
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
+	"iter"
 	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/lockfile"
+	"github.com/squarehole/package-scanner/pkg/noise"
+	"github.com/squarehole/package-scanner/pkg/reachability"
+	"github.com/squarehole/package-scanner/pkg/resolve"
+	"github.com/squarehole/package-scanner/pkg/sbom"
 )
 
 // PackageInfo represents extracted package information
@@ -15,22 +26,138 @@ type PackageInfo struct {
 	Name      string
 	Version   string
 	Ecosystem string
+	// FilePath is the artifact the package was extracted from, if any
+	FilePath string
+	// Checksum is the hex SHA-256 of the artifact's content, when it was read
+	Checksum string
+	// Architecture is the target architecture of a Debian or RPM package, if known
+	Architecture string
+	// Reachability tells whether a lockfile dependency is imported by the project's code,
+	// when reachability hinting is enabled
+	Reachability reachability.Status
+	// Relationship tells whether a dependency resolved from a manifest is declared by
+	// the project ("direct") or pulled in by another dependency ("transitive")
+	Relationship string
+	// IntroducedBy is the direct dependency a transitive dependency is pulled in through
+	IntroducedBy string
+}
+
+// hints returns what is known about how the project uses the package, as key/value
+// pairs for the findings reported for it
+func (p PackageInfo) hints() []any {
+	var hints []any
+	if p.Reachability != reachability.Unknown {
+		hints = append(hints, "reachability", string(p.Reachability))
+	}
+	if p.Relationship != "" {
+		hints = append(hints, "dependency", p.Relationship)
+	}
+	if p.IntroducedBy != "" {
+		hints = append(hints, "introducedBy", p.IntroducedBy)
+	}
+	return hints
 }
 
 // PackageScanner handles scanning for package files
 type PackageScanner struct {
+	// FileExtension is the extension of the artifacts to scan, or a comma-separated
+	// list of extensions when artifacts of several types are scanned together
 	FileExtension string
-	Ecosystem     string
-	logger        *slog.Logger
+	// Ecosystem of the artifacts; with several extensions each artifact's ecosystem
+	// follows from its extension, and this only applies to unrecognized extensions
+	Ecosystem string
+	// Filter selects which artifacts are scanned; the zero value scans all of them
+	Filter ArtifactFilter
+	// NuspecDependencies also scans the dependencies declared in each .nupkg's .nuspec
+	NuspecDependencies bool
+	// MaxDepth limits how many directory levels below the root are scanned; 1 scans only
+	// the root's own files and 0 means no limit
+	MaxDepth int
+	// FollowSymlinks descends into symlinked directories, each directory at most once
+	FollowSymlinks bool
+	// ProjectRoots are the scanned directories detected in auto mode, below which
+	// installed dependency trees such as node_modules are not walked
+	ProjectRoots []string
+	// WalkerConcurrency is the number of directories read at once while walking; 0 or 1
+	// walks one directory at a time
+	WalkerConcurrency int
+	// Coverage, if set, counts how the files found in directories and remote locations were handled
+	Coverage *Coverage
+	// Progress, if set, is told about each artifact found that passed the filters
+	Progress ProgressFunc
+	logger   *slog.Logger
+
+	// state skips artifacts unchanged since an earlier incremental scan found them clean
+	state *scanState
+	// stats times walking directories and identifying artifacts, with --stats
+	stats *scanStats
+
+	// extensions are the lowercased extensions parsed from FileExtension
+	extensions []string
+}
+
+// ArtifactFilter selects artifacts by modification time and file name
+type ArtifactFilter struct {
+	// ModifiedSince skips artifacts last modified before this time, if set
+	ModifiedSince time.Time
+	// Include, if not empty, limits scanning to artifacts matching one of the glob patterns
+	Include []string
+	// Exclude skips artifacts, and directories while walking, matching any of the glob patterns
+	Exclude []string
+	// Noise skips artifacts matched by the built-in filters that are on
+	Noise noise.Set
+}
+
+// Matches reports whether an artifact passes the filter. Patterns containing a '/'
+// are matched against the slash-separated path relative to the scanned root,
+// others against the file name.
+func (f ArtifactFilter) Matches(relPath string, modTime time.Time) bool {
+	if !f.ModifiedSince.IsZero() && modTime.Before(f.ModifiedSince) {
+		return false
+	}
+
+	if len(f.Include) > 0 && !matchesAny(f.Include, relPath) {
+		return false
+	}
+	if _, ok := f.Noise.SkipsArtifact(relPath); ok {
+		return false
+	}
+	return !matchesAny(f.Exclude, relPath)
 }
 
-// NewPackageScanner creates a new package scanner
+// matchesAny reports whether a path matches any of the glob patterns
+func matchesAny(patterns []string, relPath string) bool {
+	relPath = filepath.ToSlash(relPath)
+	for _, pattern := range patterns {
+		subject := path.Base(relPath)
+		if strings.Contains(pattern, "/") {
+			subject = relPath
+		}
+		if ok, _ := path.Match(pattern, subject); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// NewPackageScanner creates a new package scanner for an extension, or for a
+// comma-separated list of extensions such as "nupkg,tgz,whl,jar"
 func NewPackageScanner(extension string, ecosystem string, logger *slog.Logger) *PackageScanner {
-	// Remove leading dot if present in the extension
-	extension = strings.TrimPrefix(extension, ".")
+	// Remove leading dots if present in the extensions
+	var extensions []string
+	for _, ext := range strings.Split(extension, ",") {
+		if ext = strings.TrimPrefix(strings.TrimSpace(ext), "."); ext != "" {
+			extensions = append(extensions, strings.ToLower(ext))
+		}
+	}
+	if len(extensions) == 1 {
+		extension = strings.TrimPrefix(strings.TrimSpace(extension), ".")
+	} else {
+		extension = strings.Join(extensions, ",")
+	}
 
 	// Determine ecosystem if not provided
-	if ecosystem == "" {
+	if ecosystem == "" && len(extensions) == 1 {
 		ecosystem = determineEcosystem(extension)
 	}
 
@@ -43,60 +170,272 @@ func NewPackageScanner(extension string, ecosystem string, logger *slog.Logger)
 		FileExtension: extension,
 		Ecosystem:     ecosystem,
 		logger:        logger,
+		extensions:    extensions,
 	}
 }
 
-// ScanDirectory scans a directory for packages with the specified extension
-func (ps *PackageScanner) ScanDirectory(dirPath string) ([]PackageInfo, error) {
-	var packages []PackageInfo
-
-	// Ensure path exists
-	info, err := os.Stat(dirPath)
-	if err != nil {
-		return nil, fmt.Errorf("error accessing directory %s: %w", dirPath, err)
+// forFile returns the scanner for an artifact's type, chosen by the longest of the
+// scanner's extensions the file name ends with, or nil if it has none of them.
+// A scanner for a single extension returns itself.
+func (ps *PackageScanner) forFile(filename string) *PackageScanner {
+	lower := strings.ToLower(filename)
+	match := ""
+	for _, ext := range ps.extensions {
+		if strings.HasSuffix(lower, "."+ext) && len(ext) > len(match) {
+			match = ext
+		}
+	}
+	if match == "" {
+		return nil
+	}
+	if len(ps.extensions) == 1 {
+		return ps
 	}
 
-	if !info.IsDir() {
-		return nil, fmt.Errorf("%s is not a directory", dirPath)
+	scanner := *ps
+	scanner.FileExtension = match
+	scanner.extensions = []string{match}
+	scanner.Ecosystem = determineEcosystem(match)
+	if scanner.Ecosystem == "Unknown" && ps.Ecosystem != "" {
+		scanner.Ecosystem = ps.Ecosystem
 	}
+	return &scanner
+}
 
-	// Walk the directory recursively
-	err = filepath.WalkDir(dirPath, func(path string, d fs.DirEntry, err error) error {
+// ScanDirectory scans a directory for packages with the specified extensions
+func (ps *PackageScanner) ScanDirectory(dirPath string) ([]PackageInfo, error) {
+	var packages []PackageInfo
+	for pkg, err := range ps.ScanDirectoryStream(dirPath) {
 		if err != nil {
-			return err
+			return nil, err
 		}
+		packages = append(packages, pkg)
+	}
+	return packages, nil
+}
 
-		// Skip directories
-		if d.IsDir() {
-			return nil
+// errStopWalk ends a directory walk early when the consumer of a stream stops reading
+var errStopWalk = errors.New("walk stopped")
+
+// ScanDirectoryStream scans a directory like ScanDirectory, yielding each package as
+// its artifact is found instead of collecting them, so packages can be checked while
+// the walk goes on and memory stays flat however many files the directory holds.
+// An error ends the sequence; breaking out of the loop stops the walk.
+func (ps *PackageScanner) ScanDirectoryStream(dirPath string) iter.Seq2[PackageInfo, error] {
+	return func(yield func(PackageInfo, error) bool) {
+		skipped, skippedDirs, unchanged := 0, 0, 0
+
+		// The walk is timed less the time spent identifying artifacts and waiting for the
+		// consumer, which are accounted elsewhere
+		began := time.Now()
+		var excluded time.Duration
+		defer func() { ps.stats.add(phaseWalk, time.Since(began)-excluded) }()
+		emit := func(pkg PackageInfo) bool {
+			waited := time.Now()
+			defer func() { excluded += time.Since(waited) }()
+			return yield(pkg, nil)
+		}
+		parsed := func(started time.Time) {
+			d := time.Since(started)
+			ps.stats.add(phaseParse, d)
+			excluded += d
 		}
 
-		// Check file extension - case insensitive matching
-		if !strings.HasSuffix(strings.ToLower(d.Name()), "."+strings.ToLower(ps.FileExtension)) {
-			return nil
+		// Ensure path exists
+		info, err := os.Stat(dirPath)
+		if err != nil {
+			yield(PackageInfo{}, fmt.Errorf("error accessing directory %s: %w", dirPath, err))
+			return
+		}
+
+		if !info.IsDir() {
+			yield(PackageInfo{}, fmt.Errorf("%s is not a directory", dirPath))
+			return
 		}
 
-		// Extract package info from filename - preserve original case
-		pkg, err := ps.ExtractPackageInfo(d.Name())
+		ignore, err := loadIgnoreFile(dirPath)
 		if err != nil {
-			ps.logger.Warn("Could not parse package information",
-				"filename", d.Name(),
-				"error", err)
+			yield(PackageInfo{}, err)
+			return
+		}
+
+		// Walk the directory recursively, within the depth limit
+		err = ps.walk(dirPath, func(path string, d fs.DirEntry) error {
+			// Excluded and ignored directories are not descended into
+			if d.IsDir() {
+				if path != dirPath && ps.excludesDir(dirPath, path, ignore) {
+					skippedDirs++
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			// Check file extension - case insensitive matching
+			fileScanner := ps.forFile(d.Name())
+			if fileScanner == nil {
+				if ps.countsUnknown(relativePath(dirPath, path), ignore) {
+					ps.Coverage.unknown(d.Name())
+				}
+				return nil
+			}
+
+			// Apply the ignore file and the age and name filters before any further work
+			if !ps.filterAccepts(dirPath, path, d) || ignore.ignores(relativePath(dirPath, path), false) {
+				skipped++
+				return nil
+			}
+
+			ps.discovered(path)
+
+			// In incremental scans, unchanged artifacts are skipped or their recorded
+			// packages checked again, without reading them
+			var info fs.FileInfo
+			if ps.state != nil {
+				if stat, err := os.Stat(path); err == nil {
+					info = stat
+				}
+			}
+			if info != nil {
+				decision, recorded := ps.state.decide(path, info)
+				switch decision {
+				case stateSkip:
+					unchanged++
+					ps.Coverage.parsed(fileScanner)
+					return nil
+				case stateRecheck:
+					ps.Coverage.parsed(fileScanner)
+					ps.state.begin(path, info, recorded)
+					for _, pkg := range recorded {
+						if !emit(pkg) {
+							return errStopWalk
+						}
+					}
+					return nil
+				}
+			}
+
+			// Archives carrying their own metadata are identified from it
+			parseStarted := time.Now()
+			if inspect := fileScanner.inspector(); inspect != nil {
+				found, err := fileScanner.inspectFile(path, filepath.ToSlash(relativePath(dirPath, path)), inspect)
+				parsed(parseStarted)
+				if err != nil {
+					ps.logger.Warn("Could not parse package information",
+						"filename", d.Name(),
+						"error", err)
+					ps.Coverage.failed(fileScanner)
+					return nil
+				}
+				ps.Coverage.parsed(fileScanner)
+				if info != nil {
+					ps.state.begin(path, info, found)
+				}
+				for _, pkg := range found {
+					ps.logCaseSensitivityWarning(pkg.Name, pkg.Ecosystem)
+					if !emit(pkg) {
+						return errStopWalk
+					}
+				}
+				return nil
+			}
+
+			// Identify the package from a registry mirror layout or the file name - preserve original case
+			pkg, err := fileScanner.identify(filepath.ToSlash(relativePath(dirPath, path)))
+			if err != nil {
+				parsed(parseStarted)
+				ps.logger.Warn("Could not parse package information",
+					"filename", d.Name(),
+					"error", err)
+				ps.Coverage.failed(fileScanner)
+				return nil
+			}
+			ps.Coverage.parsed(fileScanner)
+
+			pkg.FilePath = path
+			pkg.Checksum = ps.artifactChecksum(path)
+			parsed(parseStarted)
+
+			// Add additional case sensitivity warning if applicable
+			ps.logCaseSensitivityWarning(pkg.Name, pkg.Ecosystem)
+
+			if info != nil {
+				ps.state.begin(path, info, []PackageInfo{pkg})
+			}
+			if !emit(pkg) {
+				return errStopWalk
+			}
 			return nil
+		})
+
+		if errors.Is(err, errStopWalk) {
+			return
+		}
+		if err != nil {
+			yield(PackageInfo{}, fmt.Errorf("error scanning directory: %w", err))
+			return
 		}
 
-		// Add additional case sensitivity warning if applicable
-		ps.logCaseSensitivityWarning(pkg.Name, pkg.Ecosystem)
+		if skipped > 0 {
+			ps.logger.Info("Artifacts skipped by filters", "path", dirPath, "count", skipped)
+		}
+		if skippedDirs > 0 {
+			ps.logger.Info("Directories skipped by exclude patterns and .scannerignore", "path", dirPath, "count", skippedDirs)
+		}
+		if unchanged > 0 {
+			ps.logger.Info("Unchanged artifacts skipped", "path", dirPath, "count", unchanged)
+		}
+	}
+}
 
-		packages = append(packages, pkg)
-		return nil
-	})
+// discovered reports an artifact that passed the filters to the progress function
+func (ps *PackageScanner) discovered(filePath string) {
+	if ps.Progress != nil {
+		ps.Progress(Progress{Event: FileDiscovered, Path: filePath})
+	}
+}
+
+// excludesDir reports whether a directory found while walking root matches an
+// --exclude pattern, is ignored by the root's .scannerignore file, or is an installed
+// dependency tree below a project root
+func (ps *PackageScanner) excludesDir(root, dirPath string, ignore ignoreRules) bool {
+	if slices.Contains(ps.ProjectRoots, root) && lockfile.IsDependencyDir(filepath.Base(dirPath)) {
+		return true
+	}
+	relPath := relativePath(root, dirPath)
+	return matchesAny(ps.Filter.Exclude, relPath) || ignore.ignores(relPath, true)
+}
+
+// countsUnknown reports whether a file the scan does not handle is counted in the
+// coverage: files excluded by --exclude or the .scannerignore file, and the ignore
+// file itself, are left out
+func (ps *PackageScanner) countsUnknown(relPath string, ignore ignoreRules) bool {
+	return ps.Coverage != nil && path.Base(filepath.ToSlash(relPath)) != ignoreFileName &&
+		!matchesAny(ps.Filter.Exclude, relPath) && !ignore.ignores(relPath, false)
+}
 
+// relativePath returns filePath relative to root, or its base name if it is not below root
+func relativePath(root, filePath string) string {
+	relPath, err := filepath.Rel(root, filePath)
 	if err != nil {
-		return nil, fmt.Errorf("error scanning directory: %w", err)
+		return filepath.Base(filePath)
 	}
+	return relPath
+}
 
-	return packages, nil
+// filterAccepts applies the artifact filter to a file found while walking root
+func (ps *PackageScanner) filterAccepts(root, filePath string, d fs.DirEntry) bool {
+	relPath := relativePath(root, filePath)
+
+	var modTime time.Time
+	if !ps.Filter.ModifiedSince.IsZero() {
+		info, err := d.Info()
+		if err != nil {
+			return false
+		}
+		modTime = info.ModTime()
+	}
+
+	return ps.Filter.Matches(relPath, modTime)
 }
 
 // ExtractPackageInfo extracts package name and version from filename
@@ -306,7 +645,7 @@ func determineEcosystem(extension string) string {
 	case "deb":
 		return "Debian"
 	case "rpm":
-		return "RPM"
+		return "Red Hat"
 	default:
 		return "Unknown"
 	}
@@ -330,3 +669,83 @@ func (ps *PackageScanner) logCaseSensitivityWarning(packageName string, ecosyste
 			"packageName", packageName)
 	}
 }
+
+// lockfileFilter selects which lockfile dependencies are scanned
+type lockfileFilter struct {
+	// skipDev leaves out dependencies only needed for development
+	skipDev bool
+	// skipUnpublished leaves out dependencies not resolved from a registry
+	skipUnpublished bool
+}
+
+// lockfilePackages returns the resolved dependencies recorded in a lockfile that pass the filter.
+// FilePath is left empty since there is no artifact to inspect.
+func lockfilePackages(path string, filter lockfileFilter) ([]PackageInfo, error) {
+	deps, err := lockfile.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	packages := make([]PackageInfo, 0, len(deps))
+	for _, dep := range deps {
+		if (filter.skipDev && dep.Dev) || (filter.skipUnpublished && dep.Unpublished) {
+			continue
+		}
+		packages = append(packages, PackageInfo{
+			Name:      dep.Name,
+			Version:   dep.Version,
+			Ecosystem: dep.Ecosystem,
+		})
+	}
+	return packages, nil
+}
+
+// manifestPackages returns the dependencies a manifest resolves to that pass the filter,
+// marked as direct or transitive
+func manifestPackages(resolver *resolve.Resolver, path string, filter lockfileFilter) ([]PackageInfo, error) {
+	deps, err := resolver.Resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	packages := make([]PackageInfo, 0, len(deps))
+	for _, dep := range deps {
+		if filter.skipDev && dep.Dev {
+			continue
+		}
+		relationship := "transitive"
+		if dep.Direct {
+			relationship = "direct"
+		}
+		packages = append(packages, PackageInfo{
+			Name:         dep.Name,
+			Version:      dep.Version,
+			Ecosystem:    dep.Ecosystem,
+			Relationship: relationship,
+			IntroducedBy: dep.Via,
+		})
+	}
+	return packages, nil
+}
+
+// sbomPackages returns the components of an SBOM that identify a package version,
+// logging how many components had to be skipped
+func (ps *PackageScanner) sbomPackages(path string) ([]PackageInfo, error) {
+	components, skipped, err := sbom.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	if skipped > 0 {
+		ps.logger.Warn("SBOM components without a usable purl skipped", "path", path, "count", skipped)
+	}
+
+	packages := make([]PackageInfo, 0, len(components))
+	for _, component := range components {
+		packages = append(packages, PackageInfo{
+			Name:      component.Name,
+			Version:   component.Version,
+			Ecosystem: component.Ecosystem,
+		})
+	}
+	return packages, nil
+}
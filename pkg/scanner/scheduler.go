@@ -0,0 +1,73 @@
+package scanner
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/cli"
+)
+
+// ecosystemScheduler applies per-ecosystem concurrency limits and request spacing
+// on top of the global worker limit, so that slower or shared backends
+// (such as an internal registry mirror) are not overwhelmed
+type ecosystemScheduler struct {
+	slots map[string]*ecosystemSlot
+}
+
+// ecosystemSlot tracks the limit state for a single ecosystem
+type ecosystemSlot struct {
+	sem   chan struct{}
+	delay time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// newEcosystemScheduler creates a scheduler from the configured ecosystem limits
+func newEcosystemScheduler(limits map[string]cli.EcosystemLimit) *ecosystemScheduler {
+	scheduler := &ecosystemScheduler{slots: make(map[string]*ecosystemSlot)}
+
+	for ecosystem, limit := range limits {
+		slot := &ecosystemSlot{delay: limit.Delay}
+		if limit.Concurrency > 0 {
+			slot.sem = make(chan struct{}, limit.Concurrency)
+		}
+		scheduler.slots[strings.ToLower(ecosystem)] = slot
+	}
+
+	return scheduler
+}
+
+// acquire blocks until a request for the ecosystem may start and returns
+// a function that must be called when the request has finished
+func (s *ecosystemScheduler) acquire(ecosystem string) func() {
+	slot, ok := s.slots[strings.ToLower(ecosystem)]
+	if !ok {
+		return func() {}
+	}
+
+	if slot.sem != nil {
+		slot.sem <- struct{}{}
+	}
+
+	if slot.delay > 0 {
+		// Reserve the next start time, then wait for it outside the lock
+		slot.mu.Lock()
+		now := time.Now()
+		start := slot.next
+		if start.Before(now) {
+			start = now
+		}
+		slot.next = start.Add(slot.delay)
+		slot.mu.Unlock()
+
+		time.Sleep(time.Until(start))
+	}
+
+	return func() {
+		if slot.sem != nil {
+			<-slot.sem
+		}
+	}
+}
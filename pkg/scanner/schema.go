@@ -0,0 +1,57 @@
+package scanner
+
+import (
+	"os"
+
+	"github.com/squarehole/package-scanner/pkg/db"
+)
+
+// runDBSchema writes the database schema as SQL (the default), in the configured schema
+// and with the configured table prefix, or as a Mermaid entity-relationship diagram to
+// --out, or to stdout. No database connection is needed.
+func (c *Controller) runDBSchema() {
+	naming := c.dbNaming()
+	if err := naming.Validate(); err != nil {
+		c.logger.Error("Invalid table naming", "error", err)
+		os.Exit(1)
+	}
+
+	var schema string
+	switch c.config.Format {
+	case "", "sql":
+		schema = db.SchemaSQL(naming)
+	case "mermaid":
+		schema = db.SchemaMermaid()
+	default:
+		c.logger.Error("Unsupported schema format", "format", c.config.Format, "supported", "sql, mermaid")
+		os.Exit(1)
+	}
+
+	if c.config.OutputPath == "" {
+		os.Stdout.WriteString(schema)
+		return
+	}
+	if err := os.WriteFile(c.config.OutputPath, []byte(schema), 0644); err != nil {
+		c.logger.Error("Error writing schema", "path", c.config.OutputPath, "error", err)
+		os.Exit(1)
+	}
+	c.logger.Info("Schema written", "path", c.config.OutputPath)
+}
+
+// runDBMigrate creates any missing tables and indexes in the configured database.
+// It is run by a role allowed to create tables, so scans can use --db-no-ddl with
+// a role that may only read and insert.
+func (c *Controller) runDBMigrate() {
+	database := c.openDatabase()
+	c.store = database
+
+	applied, err := database.Migrate(c.ctx)
+	for i, description := range applied {
+		c.logger.Info("Migration applied", "step", i+1, "description", description)
+	}
+	if err != nil {
+		c.logger.Error("Error migrating database schema", "error", err)
+		os.Exit(1)
+	}
+	c.logger.Info("Database schema is up to date", "migrations", len(applied))
+}
@@ -0,0 +1,80 @@
+package scanner
+
+import (
+	"os"
+	"strings"
+
+	"github.com/squarehole/package-scanner/pkg/gitlab"
+	"github.com/squarehole/package-scanner/pkg/models"
+	"github.com/squarehole/package-scanner/pkg/offline"
+)
+
+// advisorySearcher is an advisory source whose advisories can be searched as a whole.
+// The OSV API only answers queries for a single package, so it is not one.
+type advisorySearcher interface {
+	Search(ecosystem string, match func(models.Vulnerability) bool) ([]models.Vulnerability, error)
+}
+
+// runSearch reports the advisories of an ecosystem whose summary or details contain
+// the --text phrase, searching every enabled source that can be searched
+func (c *Controller) runSearch() {
+	text := c.config.SearchText
+	if text == "" {
+		text = strings.Join(c.config.CommandArgs, " ")
+	}
+	text = strings.ToLower(strings.TrimSpace(text))
+	if text == "" {
+		c.logger.Error("search requires a phrase, e.g. search --ecosystem npm --text \"prototype pollution\"")
+		os.Exit(1)
+	}
+
+	match := func(vuln models.Vulnerability) bool {
+		return strings.Contains(strings.ToLower(vuln.Summary), text) ||
+			strings.Contains(strings.ToLower(vuln.Details), text)
+	}
+
+	searched := 0
+	for _, name := range c.config.Sources {
+		var searcher advisorySearcher
+		switch name {
+		case "osv":
+			if !c.config.Offline {
+				c.reporter.DisplayWarning("The OSV API cannot be searched by text; load an offline database and pass --offline to search OSV advisories")
+				continue
+			}
+			database, err := offline.Open(c.config.OfflineDir)
+			if err != nil {
+				c.logger.Error("Error opening offline database", "error", err)
+				os.Exit(1)
+			}
+			searcher = database
+		case "gitlab":
+			database, err := gitlab.Open(c.config.GitLabDBDir)
+			if err != nil {
+				c.logger.Error("Error opening GitLab advisory database", "error", err)
+				os.Exit(1)
+			}
+			if !database.Supports(c.config.PackageEcosystem) {
+				c.reporter.DisplayWarning("The GitLab advisory database does not cover %s", c.config.PackageEcosystem)
+				continue
+			}
+			searcher = database
+		default:
+			c.logger.Error("Unknown advisory source", "source", name, "supported", "osv, gitlab")
+			os.Exit(1)
+		}
+
+		matches, err := searcher.Search(c.config.PackageEcosystem, match)
+		if err != nil {
+			c.logger.Error("Error searching advisories", "source", name, "error", err)
+			os.Exit(1)
+		}
+		c.reporter.DisplayAdvisoryMatches(name, matches)
+		searched++
+	}
+
+	if searched == 0 {
+		c.logger.Error("No searchable advisory source enabled", "sources", strings.Join(c.config.Sources, ","))
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,40 @@
+package scanner
+
+import (
+	"fmt"
+	"time"
+)
+
+// selfTest checks the environment with a single package before a large scan is
+// fanned out, so a broken advisory source or database fails once with a clear
+// error instead of once per package. The advisory query goes through the run-wide
+// cache without claiming it, so the package's own scan reuses the result and still
+// reports and persists it.
+func (c *Controller) selfTest(pkg PackageInfo) error {
+	started := time.Now()
+
+	if _, err := c.lookupPackage(pkg.Name, pkg.Version, pkg.Ecosystem); err != nil {
+		return fmt.Errorf("advisory query for %s@%s failed: %w", pkg.Name, pkg.Version, err)
+	}
+
+	if c.store != nil {
+		if err := c.store.CheckWritable(c.ctx); err != nil {
+			return fmt.Errorf("database write failed: %w", err)
+		}
+	}
+
+	if c.diskCache != nil {
+		if err := c.diskCache.checkWritable(); err != nil {
+			return fmt.Errorf("query cache write failed: %w", err)
+		}
+	}
+
+	c.logger.Info("Self-test passed",
+		"package", pkg.Name,
+		"version", pkg.Version,
+		"ecosystem", pkg.Ecosystem,
+		"database", c.store != nil,
+		"queryCache", c.diskCache != nil,
+		"duration", time.Since(started).Round(time.Millisecond))
+	return nil
+}
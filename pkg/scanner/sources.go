@@ -0,0 +1,122 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/squarehole/package-scanner/pkg/cli"
+	"github.com/squarehole/package-scanner/pkg/gitlab"
+	"github.com/squarehole/package-scanner/pkg/models"
+	"github.com/squarehole/package-scanner/pkg/offline"
+	"github.com/squarehole/package-scanner/pkg/osv"
+)
+
+// newVulnerabilitySource builds the advisory source selected by --sources.
+// Several sources are combined so each package is matched against all of them.
+// With --cache-dir, OSV API responses are kept on disk between runs; the cache is
+// returned as well so it can be primed. With --rate-limit, queries to the OSV API
+// pass through a limiter below the cache, so cache hits are not held back. Transport,
+// if not nil, carries the OSV client's requests, to record or replay them.
+func newVulnerabilitySource(config *cli.Config, transport http.RoundTripper) (vulnerabilitySource, *diskCache, error) {
+	limiter := newRateLimiter(config.RateLimit)
+	osvClient := func(opts ...osv.Option) vulnerabilitySource {
+		client := osv.NewClient(config.OSVAPI, append(opts, osv.WithTransport(transport))...)
+		if limiter == nil {
+			return client
+		}
+		return rateLimitedSource{source: client, limiter: limiter}
+	}
+
+	var cache *diskCache
+	var sources []vulnerabilitySource
+	for _, name := range config.Sources {
+		switch name {
+		case "osv":
+			// A mock server's canned responses replace the OSV API and are never cached
+			if config.MockOSV != "" {
+				sources = append(sources, osvClient())
+			} else if config.Replay != "" {
+				// Recorded traffic is played back as it was, without rate limiting
+				sources = append(sources, osv.NewClient(config.OSVAPI, osv.WithTransport(transport)))
+			} else if config.Record != "" {
+				// Every query is sent to the API to be recorded, bypassing the offline database and cache
+				sources = append(sources, osvClient(osv.WithHeaders(config.OSVHeaders)))
+			} else if config.Offline {
+				// The offline database replaces the OSV API in air-gapped environments
+				database, err := offline.Open(config.OfflineDir)
+				if err != nil {
+					return nil, nil, err
+				}
+				sources = append(sources, database)
+			} else if config.CacheDir != "" {
+				var err error
+				cache, err = newDiskCache(osvClient(osv.WithHeaders(config.OSVHeaders)), config.CacheDir, config.CacheTTL)
+				if err != nil {
+					return nil, nil, err
+				}
+				sources = append(sources, cache)
+			} else {
+				sources = append(sources, osvClient(osv.WithHeaders(config.OSVHeaders)))
+			}
+		case "gitlab":
+			database, err := gitlab.Open(config.GitLabDBDir)
+			if err != nil {
+				return nil, nil, err
+			}
+			sources = append(sources, database)
+		default:
+			return nil, nil, fmt.Errorf("unknown advisory source %q (supported: osv, gitlab)", name)
+		}
+	}
+
+	switch len(sources) {
+	case 0:
+		return nil, nil, fmt.Errorf("no advisory sources selected")
+	case 1:
+		return sources[0], cache, nil
+	default:
+		return multiSource(sources), cache, nil
+	}
+}
+
+// multiSource queries several advisory sources and merges their findings.
+// An advisory already reported by an earlier source, matched by ID or alias,
+// is not reported again.
+type multiSource []vulnerabilitySource
+
+// QueryPackage queries every source in order and returns the merged findings
+func (m multiSource) QueryPackage(packageName, packageVersion, packageEcosystem string) (models.ScanResults, []byte, error) {
+	var merged models.ScanResults
+	seen := make(map[string]bool)
+
+	for _, source := range m {
+		results, _, err := source.QueryPackage(packageName, packageVersion, packageEcosystem)
+		if err != nil {
+			return models.ScanResults{}, nil, err
+		}
+
+		for _, vuln := range results.Vulnerabilities {
+			ids := append([]string{vuln.ID}, vuln.Aliases...)
+			duplicate := false
+			for _, id := range ids {
+				if seen[id] {
+					duplicate = true
+					break
+				}
+			}
+			for _, id := range ids {
+				seen[id] = true
+			}
+			if !duplicate {
+				merged.Vulnerabilities = append(merged.Vulnerabilities, vuln)
+			}
+		}
+	}
+
+	body, err := json.Marshal(merged)
+	if err != nil {
+		return models.ScanResults{}, nil, fmt.Errorf("error encoding merged results: %w", err)
+	}
+	return merged, body, nil
+}
@@ -0,0 +1,229 @@
+package scanner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// stateVersion is the format version of the state file
+const stateVersion = 1
+
+// scanState remembers the artifacts of earlier incremental scans, so artifacts that have
+// not changed since they were found clean are skipped until their advisory data is
+// older than the freshness window. Artifacts with findings are always checked again,
+// so their findings keep being reported and gating on them keeps working.
+// Methods are safe for concurrent use.
+type scanState struct {
+	path      string
+	freshness time.Duration
+
+	mu    sync.Mutex
+	files map[string]fileRecord
+	// pending holds the artifacts being checked in this run until all their packages are
+	pending map[string]*pendingFile
+}
+
+// stateFile is the JSON document a scan state is saved as
+type stateFile struct {
+	Version int                   `json:"version"`
+	Files   map[string]fileRecord `json:"files"`
+}
+
+// fileRecord is what a scan state knows about one artifact
+type fileRecord struct {
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mod_time"`
+	Checksum string    `json:"checksum,omitempty"`
+	// CheckedAt is when the artifact's packages were last checked for advisories
+	CheckedAt  time.Time      `json:"checked_at"`
+	Vulnerable bool           `json:"vulnerable"`
+	Packages   []statePackage `json:"packages"`
+}
+
+// statePackage is a package identified in an artifact
+type statePackage struct {
+	Name         string `json:"name"`
+	Version      string `json:"version"`
+	Ecosystem    string `json:"ecosystem"`
+	Architecture string `json:"architecture,omitempty"`
+}
+
+// pendingFile is an artifact whose packages are being checked
+type pendingFile struct {
+	record    fileRecord
+	remaining int
+	failed    bool
+}
+
+// stateDecision is what an incremental scan does with an artifact
+type stateDecision int
+
+const (
+	// stateScan identifies the artifact's packages and checks them
+	stateScan stateDecision = iota
+	// stateRecheck checks the packages recorded for an unchanged artifact again
+	stateRecheck
+	// stateSkip leaves out an unchanged artifact that was clean when last checked
+	stateSkip
+)
+
+// loadScanState reads the state saved at path, starting empty if there is none yet
+func loadScanState(path string, freshness time.Duration) (*scanState, error) {
+	state := &scanState{
+		path:      path,
+		freshness: freshness,
+		files:     make(map[string]fileRecord),
+		pending:   make(map[string]*pendingFile),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading scan state %s: %w", path, err)
+	}
+	var saved stateFile
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("invalid scan state %s: %w", path, err)
+	}
+	if saved.Version != stateVersion {
+		// A state written by another version is dropped; the next run rebuilds it
+		return state, nil
+	}
+	for file, record := range saved.Files {
+		state.files[file] = record
+	}
+	return state, nil
+}
+
+// decide tells what to do with an artifact found on disk, returning the packages
+// recorded for it when they are to be checked again
+func (s *scanState) decide(filePath string, info fs.FileInfo) (stateDecision, []PackageInfo) {
+	if s == nil {
+		return stateScan, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.files[stateKey(filePath)]
+	if !ok || record.Size != info.Size() || !record.ModTime.Equal(info.ModTime()) || len(record.Packages) == 0 {
+		return stateScan, nil
+	}
+	if record.Vulnerable || time.Since(record.CheckedAt) >= s.freshness {
+		packages := make([]PackageInfo, len(record.Packages))
+		for i, pkg := range record.Packages {
+			packages[i] = PackageInfo{
+				Name:         pkg.Name,
+				Version:      pkg.Version,
+				Ecosystem:    pkg.Ecosystem,
+				Architecture: pkg.Architecture,
+				FilePath:     filePath,
+				Checksum:     record.Checksum,
+			}
+		}
+		return stateRecheck, packages
+	}
+	return stateSkip, nil
+}
+
+// begin starts checking the packages found in an artifact; the artifact is recorded
+// once all of them have been checked without error
+func (s *scanState) begin(filePath string, info fs.FileInfo, packages []PackageInfo) {
+	if s == nil || len(packages) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := fileRecord{
+		Size:      info.Size(),
+		ModTime:   info.ModTime(),
+		Checksum:  packages[0].Checksum,
+		CheckedAt: time.Now().UTC(),
+	}
+	for _, pkg := range packages {
+		record.Packages = append(record.Packages, statePackage{
+			Name:         pkg.Name,
+			Version:      pkg.Version,
+			Ecosystem:    pkg.Ecosystem,
+			Architecture: pkg.Architecture,
+		})
+	}
+	s.pending[stateKey(filePath)] = &pendingFile{record: record, remaining: len(packages)}
+}
+
+// done records the outcome of checking one package of an artifact
+func (s *scanState) done(filePath string, vulnerable bool, err error) {
+	if s == nil || filePath == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := stateKey(filePath)
+	pending, ok := s.pending[key]
+	if !ok {
+		return
+	}
+	pending.failed = pending.failed || err != nil
+	pending.record.Vulnerable = pending.record.Vulnerable || vulnerable
+	pending.remaining--
+	if pending.remaining > 0 {
+		return
+	}
+
+	delete(s.pending, key)
+	if pending.failed {
+		// An artifact that could not be checked is checked again next time
+		delete(s.files, key)
+		return
+	}
+	s.files[key] = pending.record
+}
+
+// save writes the state, leaving out artifacts that no longer exist
+func (s *scanState) save() error {
+	s.mu.Lock()
+	saved := stateFile{Version: stateVersion, Files: make(map[string]fileRecord, len(s.files))}
+	for file, record := range s.files {
+		if _, err := os.Stat(file); err == nil {
+			saved.Files[file] = record
+		}
+	}
+	s.mu.Unlock()
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding scan state: %w", err)
+	}
+	if dir := filepath.Dir(s.path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("error creating scan state directory %s: %w", dir, err)
+		}
+	}
+	// Written next to the state and renamed over it, so an interrupted run cannot corrupt it
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("error writing scan state %s: %w", s.path, err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("error writing scan state %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// stateKey identifies an artifact by its absolute path, so runs from other working
+// directories share the state
+func stateKey(filePath string) string {
+	if abs, err := filepath.Abs(filePath); err == nil {
+		return abs
+	}
+	return filePath
+}
@@ -0,0 +1,155 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Phases of a scan timed for --stats
+const (
+	// phaseWalk is reading directories and listing and fetching remote locations, less
+	// the time spent identifying artifacts and waiting for the workers to take packages
+	phaseWalk = "walk"
+	// phaseParse is identifying the packages of artifacts, lockfiles and SBOMs
+	phaseParse = "parse"
+	// phaseAPI is querying advisories, including rate limiting and retries
+	phaseAPI = "api"
+	// phaseDB is saving results to the database
+	phaseDB = "db"
+)
+
+// statsPhases are the phases reported, in the order they happen
+var statsPhases = []string{phaseWalk, phaseParse, phaseAPI, phaseDB}
+
+// scanStats times the phases of a scan, so concurrency can be tuned and bottlenecks
+// found. Phases run concurrently, so their totals add up the time of every worker and
+// can exceed the run's elapsed time. Methods are nil-safe and safe for concurrent use.
+type scanStats struct {
+	mu       sync.Mutex
+	phases   map[string]*phaseTiming
+	packages int
+}
+
+// phaseTiming is the time spent in one phase
+type phaseTiming struct {
+	count int
+	total time.Duration
+	max   time.Duration
+}
+
+// newScanStats starts timing a scan
+func newScanStats() *scanStats {
+	return &scanStats{phases: make(map[string]*phaseTiming)}
+}
+
+// start times one occurrence of a phase until the returned function is called
+func (s *scanStats) start(phase string) func() {
+	if s == nil {
+		return func() {}
+	}
+	began := time.Now()
+	return func() { s.add(phase, time.Since(began)) }
+}
+
+// add records one occurrence of a phase that took d
+func (s *scanStats) add(phase string, d time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	timing := s.phases[phase]
+	if timing == nil {
+		timing = &phaseTiming{}
+		s.phases[phase] = timing
+	}
+	timing.count++
+	timing.total += d
+	timing.max = max(timing.max, d)
+}
+
+// packageFound counts a package queued for checking
+func (s *scanStats) packageFound() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.packages++
+	s.mu.Unlock()
+}
+
+// statsReport is the stats block written at the end of a run
+type statsReport struct {
+	ElapsedMs     float64 `json:"elapsed_ms"`
+	Concurrency   int     `json:"concurrency"`
+	Packages      int     `json:"packages"`
+	UniqueQueries int     `json:"unique_queries"`
+	// Phases holds every phase, with zero counts for those the run did not go through
+	Phases map[string]phaseReport `json:"phases"`
+}
+
+// phaseReport is the timing of one phase in the stats block. Utilization is the share
+// of the run's elapsed time the phase kept one worker busy on average, so an api
+// utilization close to the concurrency means the workers spend their time waiting on
+// the advisory source.
+type phaseReport struct {
+	Count       int     `json:"count"`
+	TotalMs     float64 `json:"total_ms"`
+	AvgMs       float64 `json:"avg_ms"`
+	MaxMs       float64 `json:"max_ms"`
+	Utilization float64 `json:"utilization"`
+}
+
+// report returns the stats block of a run that took elapsed
+func (s *scanStats) report(elapsed time.Duration, concurrency, uniqueQueries int) statsReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := statsReport{
+		ElapsedMs:     milliseconds(elapsed),
+		Concurrency:   concurrency,
+		Packages:      s.packages,
+		UniqueQueries: uniqueQueries,
+		Phases:        make(map[string]phaseReport, len(statsPhases)),
+	}
+	for _, phase := range statsPhases {
+		var phaseStats phaseReport
+		if timing := s.phases[phase]; timing != nil {
+			phaseStats = phaseReport{
+				Count:   timing.count,
+				TotalMs: milliseconds(timing.total),
+				AvgMs:   milliseconds(timing.total / time.Duration(timing.count)),
+				MaxMs:   milliseconds(timing.max),
+			}
+			if elapsed > 0 {
+				phaseStats.Utilization = float64(int(float64(timing.total)/float64(elapsed)*100)) / 100
+			}
+		}
+		report.Phases[phase] = phaseStats
+	}
+	return report
+}
+
+// write writes the stats block as JSON to path, or to stderr for "-"
+func (r statsReport) write(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding scan stats: %w", err)
+	}
+	data = append(data, '\n')
+	if path == "-" {
+		_, err = os.Stderr.Write(data)
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing scan stats %s: %w", path, err)
+	}
+	return nil
+}
+
+// milliseconds returns a duration in milliseconds, to the microsecond
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,74 @@
+package scanner
+
+import (
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/squarehole/package-scanner/pkg/reporting"
+)
+
+// runReportStatus reports the status of each package version checked by a scan run
+// stored in the configured database: report status reports the latest finished run,
+// of --target if given, and report status <id> the run given. Nothing is scanned and
+// nothing is written to the database.
+func (c *Controller) runReportStatus() {
+	if len(c.config.CommandArgs) > 1 {
+		c.logger.Error("report status takes at most one scan run id, e.g. report status 13")
+		os.Exit(1)
+	}
+	var runID int64
+	if len(c.config.CommandArgs) == 1 {
+		id, err := strconv.ParseInt(c.config.CommandArgs[0], 10, 64)
+		if err != nil || id <= 0 {
+			c.logger.Error("Invalid scan run id", "id", c.config.CommandArgs[0])
+			os.Exit(1)
+		}
+		runID = id
+	}
+
+	var write func(reporting.StatusReport, io.Writer) error
+	switch c.config.Format {
+	case "":
+	case "json":
+		write = reporting.StatusReport.WriteJSON
+	case "html":
+		write = reporting.StatusReport.WriteHTML
+	default:
+		c.logger.Error("Unsupported status format", "format", c.config.Format, "supported", "json, html")
+		os.Exit(1)
+	}
+
+	database := c.openDatabase()
+	c.store = database
+	status, err := database.GetRunStatus(c.ctx, runID, c.config.TrendTarget)
+	if err != nil {
+		c.logger.Error("Error getting scan run status", "error", err)
+		os.Exit(1)
+	}
+	report := reporting.BuildStatusReport(status)
+
+	if write == nil {
+		c.reporter.DisplayStatusReport(report)
+		return
+	}
+	if c.config.OutputPath == "" {
+		if err := write(report, os.Stdout); err != nil {
+			c.logger.Error("Error writing status report", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+	f, err := os.Create(c.config.OutputPath)
+	if err != nil {
+		c.logger.Error("Error creating status report", "path", c.config.OutputPath, "error", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	if err := write(report, f); err != nil {
+		c.logger.Error("Error writing status report", "path", c.config.OutputPath, "error", err)
+		os.Exit(1)
+	}
+	c.logger.Info("Status report written", "path", c.config.OutputPath, "runID", report.Run.ID,
+		"vulnerable", report.Summary.Vulnerable, "findings", report.Summary.Findings)
+}
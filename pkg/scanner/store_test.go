@@ -0,0 +1,160 @@
+package scanner
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/db"
+	"github.com/squarehole/package-scanner/pkg/models"
+	"github.com/squarehole/package-scanner/pkg/usage"
+)
+
+// fakeStore is an in-memory db.Store recording what the controller saves. Saves fail
+// with saveErr when it is set.
+type fakeStore struct {
+	mu sync.Mutex
+
+	saveErr error
+
+	// runs are the targets of the started runs, and runLabels their labels; run IDs are
+	// their index plus one
+	runs      []string
+	runLabels []map[string]string
+	// rollupRuns are returned by GetRollupRuns, which records the filter it was given
+	rollupRuns   []db.RollupRun
+	rollupFilter db.RollupFilter
+	// finished are the totals each finished run was recorded with, by run ID
+	finished map[int64]fakeRunTotals
+	// findings are the saved findings by package, as name@version, with the run they
+	// were saved for
+	findings map[string]fakeFindings
+	// clean are the packages recorded as clean scans, as name@version
+	clean []string
+	// closed reports whether Close was called
+	closed bool
+}
+
+type fakeRunTotals struct {
+	packages        int
+	vulnerabilities int
+	severities      db.SeverityCounts
+}
+
+type fakeFindings struct {
+	runID           int64
+	vulnerabilities []models.Vulnerability
+}
+
+var _ db.Store = (*fakeStore)(nil)
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		finished: make(map[int64]fakeRunTotals),
+		findings: make(map[string]fakeFindings),
+	}
+}
+
+func (s *fakeStore) SaveVulnerabilityResults(_ context.Context, runID int64, packageName, _, version, _ string,
+	vulnerabilities []models.Vulnerability, _ []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.saveErr != nil {
+		return s.saveErr
+	}
+	s.findings[packageName+"@"+version] = fakeFindings{runID: runID, vulnerabilities: vulnerabilities}
+	return nil
+}
+
+func (s *fakeStore) SaveVulnerabilityBatch(_ context.Context, runID int64, batch []db.PackageFindings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.saveErr != nil {
+		return s.saveErr
+	}
+	for _, pkg := range batch {
+		key := pkg.PackageName + "@" + pkg.Version
+		if len(pkg.Vulnerabilities) == 0 {
+			s.clean = append(s.clean, key)
+			continue
+		}
+		s.findings[key] = fakeFindings{runID: runID, vulnerabilities: pkg.Vulnerabilities}
+	}
+	return nil
+}
+
+func (s *fakeStore) SaveCleanScan(_ context.Context, _ int64, packageName, _, version, _ string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.saveErr != nil {
+		return s.saveErr
+	}
+	s.clean = append(s.clean, packageName+"@"+version)
+	return nil
+}
+
+func (s *fakeStore) StartRun(_ context.Context, target, _ string, labels map[string]string, _ time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runs = append(s.runs, target)
+	s.runLabels = append(s.runLabels, labels)
+	return int64(len(s.runs)), nil
+}
+
+func (s *fakeStore) FinishRun(_ context.Context, runID int64, _ time.Time, packageCount, vulnCount int,
+	severities db.SeverityCounts) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.finished[runID] = fakeRunTotals{packages: packageCount, vulnerabilities: vulnCount, severities: severities}
+	return nil
+}
+
+func (s *fakeStore) GetRuns(context.Context, int) ([]db.RunRecord, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) GetTrend(context.Context, db.TrendFilter) ([]db.TrendPoint, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) GetRollupRuns(_ context.Context, filter db.RollupFilter) ([]db.RollupRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rollupFilter = filter
+	return s.rollupRuns, nil
+}
+
+func (s *fakeStore) DiffRuns(context.Context, int64, int64) (db.RunDiff, error) {
+	return db.RunDiff{}, nil
+}
+
+func (s *fakeStore) DeleteRun(context.Context, int64) (int64, error) {
+	return 0, nil
+}
+
+func (s *fakeStore) Purge(context.Context, db.RetentionPolicy) (db.PurgeResult, error) {
+	return db.PurgeResult{}, nil
+}
+
+func (s *fakeStore) SaveRunUsage(context.Context, string, map[string]string, usage.Usage) error {
+	return nil
+}
+
+func (s *fakeStore) GetLatestScans(context.Context, int) ([]db.VulnerabilityRecord, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) QueryScans(context.Context, db.ScanFilter) ([]db.VulnerabilityRecord, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) CheckWritable(context.Context) error {
+	return nil
+}
+
+func (s *fakeStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
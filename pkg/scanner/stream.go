@@ -0,0 +1,134 @@
+package scanner
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"path"
+)
+
+// ScanStream identifies the packages in an artifact stream without writing it to disk.
+// With a name, the stream is a single artifact identified by that file name. Without
+// one, the stream is a tar archive (optionally gzip-compressed) and every entry with
+// one of the scanner's extensions is identified by its entry name. NuGet packages, jars,
+// Debian packages and RPMs are read so they can be identified by their embedded
+// metadata instead.
+func (ps *PackageScanner) ScanStream(r io.Reader, name string) ([]PackageInfo, error) {
+	if name != "" {
+		fileScanner := ps.forFile(name)
+		if fileScanner == nil {
+			if len(ps.extensions) != 1 {
+				return nil, fmt.Errorf("artifact name %s does not end in any of the extensions %s", name, ps.FileExtension)
+			}
+			name += "." + ps.FileExtension
+			fileScanner = ps
+		}
+
+		// Archives carrying their own metadata are buffered so it can be read
+		if inspect := fileScanner.inspector(); inspect != nil {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return nil, fmt.Errorf("error reading artifact stream: %w", err)
+			}
+			packages, err := inspect(bytes.NewReader(data), int64(len(data)), path.Base(name))
+			if err != nil {
+				return nil, err
+			}
+			packages[0].Checksum = checksum(data)
+			for _, pkg := range packages {
+				ps.logCaseSensitivityWarning(pkg.Name, pkg.Ecosystem)
+			}
+			return packages, nil
+		}
+
+		// The artifact is consumed, for its checksum and so the producing process is not cut off
+		h := sha256.New()
+		if _, err := io.Copy(h, r); err != nil {
+			return nil, fmt.Errorf("error reading artifact stream: %w", err)
+		}
+
+		pkg, err := fileScanner.ExtractPackageInfo(path.Base(name))
+		if err != nil {
+			return nil, err
+		}
+		pkg.Checksum = hexSum(h)
+		ps.logCaseSensitivityWarning(pkg.Name, pkg.Ecosystem)
+		return []PackageInfo{pkg}, nil
+	}
+
+	buffered := bufio.NewReader(r)
+	var stream io.Reader = buffered
+	if magic, _ := buffered.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("error reading compressed tar stream: %w", err)
+		}
+		defer gz.Close()
+		stream = gz
+	}
+
+	var packages []PackageInfo
+	tr := tar.NewReader(stream)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading tar stream: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		base := path.Base(header.Name)
+		fileScanner := ps.forFile(base)
+		if fileScanner == nil {
+			continue
+		}
+		if !ps.Filter.Matches(path.Clean(header.Name), header.ModTime) {
+			continue
+		}
+
+		if inspect := fileScanner.inspector(); inspect != nil {
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, fmt.Errorf("error reading tar stream: %w", err)
+			}
+			found, err := inspect(bytes.NewReader(data), int64(len(data)), path.Clean(header.Name))
+			if err != nil {
+				ps.logger.Warn("Could not parse package information",
+					"filename", header.Name,
+					"error", err)
+				continue
+			}
+			found[0].Checksum = checksum(data)
+			for _, pkg := range found {
+				ps.logCaseSensitivityWarning(pkg.Name, pkg.Ecosystem)
+			}
+			packages = append(packages, found...)
+			continue
+		}
+
+		pkg, err := fileScanner.identify(path.Clean(header.Name))
+		if err != nil {
+			ps.logger.Warn("Could not parse package information",
+				"filename", header.Name,
+				"error", err)
+			continue
+		}
+		h := sha256.New()
+		if _, err := io.Copy(h, tr); err != nil {
+			return nil, fmt.Errorf("error reading tar stream: %w", err)
+		}
+		pkg.Checksum = hexSum(h)
+		ps.logCaseSensitivityWarning(pkg.Name, pkg.Ecosystem)
+		packages = append(packages, pkg)
+	}
+
+	return packages, nil
+}
@@ -0,0 +1,74 @@
+package scanner
+
+import (
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/squarehole/package-scanner/pkg/cli"
+	"github.com/squarehole/package-scanner/pkg/db"
+	"github.com/squarehole/package-scanner/pkg/reporting"
+)
+
+// defaultTrendPeriod is the period report trend covers without --since, a quarter of
+// weekly points
+const defaultTrendPeriod = "90d"
+
+// runReportTrend reports the findings per severity of each target over the --since
+// period, per --interval, from the scan runs stored in the configured database
+func (c *Controller) runReportTrend() {
+	period := c.config.Since
+	if period == "" {
+		period = defaultTrendPeriod
+	}
+	since, err := cli.ParseSince(period)
+	if err != nil {
+		c.logger.Error("Invalid period", "since", period, "error", err)
+		os.Exit(1)
+	}
+	if !slices.Contains(db.TrendIntervals, c.config.TrendInterval) {
+		c.logger.Error("Unsupported trend interval", "interval", c.config.TrendInterval,
+			"supported", strings.Join(db.TrendIntervals, ", "))
+		os.Exit(1)
+	}
+
+	var write func(reporting.Trend, io.Writer) error
+	switch c.config.Format {
+	case "", "json":
+		write = reporting.Trend.WriteJSON
+	case "html":
+		write = reporting.Trend.WriteHTML
+	default:
+		c.logger.Error("Unsupported trend format", "format", c.config.Format, "supported", "json, html")
+		os.Exit(1)
+	}
+
+	database := c.openDatabase()
+	c.store = database
+	points, err := database.GetTrend(c.ctx, db.TrendFilter{Since: since, Interval: c.config.TrendInterval, Target: c.config.TrendTarget})
+	if err != nil {
+		c.logger.Error("Error querying scan runs", "error", err)
+		os.Exit(1)
+	}
+	trend := reporting.BuildTrend(points, since, c.config.TrendInterval)
+
+	if c.config.OutputPath == "" {
+		if err := write(trend, os.Stdout); err != nil {
+			c.logger.Error("Error writing trend", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+	f, err := os.Create(c.config.OutputPath)
+	if err != nil {
+		c.logger.Error("Error creating trend report", "path", c.config.OutputPath, "error", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	if err := write(trend, f); err != nil {
+		c.logger.Error("Error writing trend", "path", c.config.OutputPath, "error", err)
+		os.Exit(1)
+	}
+	c.logger.Info("Trend written", "path", c.config.OutputPath, "targets", len(trend.Targets))
+}
@@ -0,0 +1,315 @@
+package scanner
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// walkFunc is called for every file and directory found while walking a scan root,
+// with its path below the root as reached (through any followed symlinks)
+type walkFunc func(path string, d fs.DirEntry) error
+
+// walk walks root honouring MaxDepth and, with FollowSymlinks, descends into
+// symlinked directories. Each directory is walked once: a symlink leading back to a
+// directory that was already walked, such as an ancestor, is reported and skipped.
+// With WalkerConcurrency above 1, directories are read in parallel.
+func (ps *PackageScanner) walk(root string, fn walkFunc) error {
+	if ps.WalkerConcurrency > 1 {
+		return ps.walkParallel(root, fn)
+	}
+	visited := make(map[string]bool)
+	return ps.walkFrom(root, root, root, visited, fn)
+}
+
+// walkFrom walks the directory dir, reached at the logical path logical below root
+func (ps *PackageScanner) walkFrom(root, dir, logical string, visited map[string]bool, fn walkFunc) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Report paths as reached from the root, not as resolved
+		if dir != logical {
+			rel, relErr := filepath.Rel(dir, path)
+			if relErr != nil {
+				return relErr
+			}
+			path = filepath.Join(logical, rel)
+		}
+		depth := pathDepth(root, path)
+
+		if d.IsDir() {
+			if ps.FollowSymlinks {
+				real, err := filepath.EvalSymlinks(path)
+				if err == nil {
+					if visited[real] {
+						return filepath.SkipDir
+					}
+					visited[real] = true
+				}
+			}
+			if err := fn(path, d); err != nil {
+				return err
+			}
+			// Directories at the depth limit are not entered, since their files would lie beyond it
+			if ps.MaxDepth > 0 && depth >= ps.MaxDepth {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if ps.MaxDepth > 0 && depth > ps.MaxDepth {
+			return nil
+		}
+
+		if d.Type()&fs.ModeSymlink != 0 && ps.FollowSymlinks {
+			info, err := os.Stat(path)
+			if err != nil {
+				ps.logger.Warn("Could not follow symlink", "path", path, "error", err)
+				return nil
+			}
+			if info.IsDir() {
+				return ps.followDir(root, path, depth, visited, fn)
+			}
+		}
+
+		return fn(path, d)
+	})
+}
+
+// followDir walks the directory a symlink points to, unless it was already walked
+func (ps *PackageScanner) followDir(root, link string, depth int, visited map[string]bool, fn walkFunc) error {
+	real, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		ps.logger.Warn("Could not follow symlink", "path", link, "error", err)
+		return nil
+	}
+	if visited[real] {
+		ps.logger.Warn("Symlink leads to a directory already scanned, skipping", "path", link, "target", real)
+		return nil
+	}
+	if ps.MaxDepth > 0 && depth >= ps.MaxDepth {
+		return nil
+	}
+
+	info, err := os.Lstat(real)
+	if err != nil {
+		return nil
+	}
+	if err := fn(link, fs.FileInfoToDirEntry(info)); err != nil {
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+	visited[real] = true
+
+	// The target's own entry was handled above, so walking starts with its contents
+	entries, err := os.ReadDir(real)
+	if err != nil {
+		ps.logger.Warn("Could not read symlinked directory", "path", link, "error", err)
+		return nil
+	}
+	for _, entry := range entries {
+		err := ps.walkFrom(root, filepath.Join(real, entry.Name()), filepath.Join(link, entry.Name()), visited, fn)
+		if err != nil && err != filepath.SkipDir {
+			return err
+		}
+	}
+	return nil
+}
+
+// dirJob is a directory to read in a parallel walk: its physical path and the path it
+// was reached at from the root, which differ below followed symlinks
+type dirJob struct {
+	dir     string
+	logical string
+}
+
+// dirListing is the contents of a directory read in a parallel walk
+type dirListing struct {
+	job     dirJob
+	entries []fs.DirEntry
+	err     error
+}
+
+// walkParallel walks root like walk, reading up to WalkerConcurrency directories at
+// once. Reading directories and the metadata of their files, the part of a walk that
+// waits on network filesystems, happens on the readers; fn is still called from the
+// calling goroutine, one entry at a time, and decides which directories are read.
+// Directories are therefore found in the order their reads complete, not in lexical
+// order.
+func (ps *PackageScanner) walkParallel(root string, fn walkFunc) error {
+	// Like filepath.WalkDir, the root itself is not followed if it is a symlink
+	info, err := os.Lstat(root)
+	if err != nil {
+		return err
+	}
+	visited := make(map[string]bool)
+	if ps.FollowSymlinks {
+		if real, err := filepath.EvalSymlinks(root); err == nil {
+			visited[real] = true
+		}
+	}
+	if err := fn(root, fs.FileInfoToDirEntry(info)); err != nil || !info.IsDir() {
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+
+	jobs := make(chan dirJob)
+	listings := make(chan dirListing, ps.WalkerConcurrency)
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	for range ps.WalkerConcurrency {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for job := range jobs {
+				entries, err := readDirInfo(job.dir)
+				select {
+				case listings <- dirListing{job: job, entries: entries, err: err}:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	defer func() {
+		close(done)
+		close(jobs)
+		readers.Wait()
+	}()
+
+	// Directories waiting for a reader, and the number read or being read whose
+	// entries have not been handled yet
+	pending := []dirJob{{dir: root, logical: root}}
+	outstanding := len(pending)
+	enqueue := func(job dirJob) {
+		pending = append(pending, job)
+		outstanding++
+	}
+
+	for outstanding > 0 {
+		var send chan dirJob
+		var next dirJob
+		if len(pending) > 0 {
+			send, next = jobs, pending[0]
+		}
+		select {
+		case send <- next:
+			pending = pending[1:]
+		case listing := <-listings:
+			outstanding--
+			if listing.err != nil {
+				return listing.err
+			}
+			for _, entry := range listing.entries {
+				if err := ps.walkEntry(root, listing.job, entry, visited, enqueue, fn); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// walkEntry handles one entry of a directory read in a parallel walk, calling fn for
+// it and queueing the directories to descend into, as walkFrom does for a sequential walk
+func (ps *PackageScanner) walkEntry(root string, job dirJob, entry fs.DirEntry, visited map[string]bool, enqueue func(dirJob), fn walkFunc) error {
+	physical := filepath.Join(job.dir, entry.Name())
+	path := filepath.Join(job.logical, entry.Name())
+	depth := pathDepth(root, path)
+
+	if entry.IsDir() {
+		if ps.FollowSymlinks {
+			real, err := filepath.EvalSymlinks(physical)
+			if err == nil {
+				if visited[real] {
+					return nil
+				}
+				visited[real] = true
+			}
+		}
+		if err := fn(path, entry); err != nil {
+			if err == filepath.SkipDir {
+				return nil
+			}
+			return err
+		}
+		// Directories at the depth limit are not entered, since their files would lie beyond it
+		if ps.MaxDepth == 0 || depth < ps.MaxDepth {
+			enqueue(dirJob{dir: physical, logical: path})
+		}
+		return nil
+	}
+
+	if ps.MaxDepth > 0 && depth > ps.MaxDepth {
+		return nil
+	}
+
+	if entry.Type()&fs.ModeSymlink != 0 && ps.FollowSymlinks {
+		info, err := os.Stat(physical)
+		if err != nil {
+			ps.logger.Warn("Could not follow symlink", "path", path, "error", err)
+			return nil
+		}
+		if info.IsDir() {
+			real, err := filepath.EvalSymlinks(physical)
+			if err != nil {
+				ps.logger.Warn("Could not follow symlink", "path", path, "error", err)
+				return nil
+			}
+			if visited[real] {
+				ps.logger.Warn("Symlink leads to a directory already scanned, skipping", "path", path, "target", real)
+				return nil
+			}
+			if ps.MaxDepth > 0 && depth >= ps.MaxDepth {
+				return nil
+			}
+			if err := fn(path, fs.FileInfoToDirEntry(info)); err != nil {
+				if err == filepath.SkipDir {
+					return nil
+				}
+				return err
+			}
+			visited[real] = true
+			enqueue(dirJob{dir: real, logical: path})
+			return nil
+		}
+	}
+
+	return fn(path, entry)
+}
+
+// readDirInfo reads a directory, fetching the metadata of its files along with the
+// listing so the walk does not wait for it later
+func readDirInfo(dir string) ([]fs.DirEntry, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for i, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		// A file removed since the listing keeps its entry, whose Info reports the error
+		if info, err := entry.Info(); err == nil {
+			entries[i] = fs.FileInfoToDirEntry(info)
+		}
+	}
+	return entries, nil
+}
+
+// pathDepth returns the number of path elements of path below root; root itself is 0
+func pathDepth(root, path string) int {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(filepath.ToSlash(rel), "/") + 1
+}
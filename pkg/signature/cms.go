@@ -0,0 +1,257 @@
+package signature
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Object identifiers used by CMS signatures (RFC 5652) and timestamps (RFC 3161)
+var (
+	oidSignedData     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidMessageDigest  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidTimeStampToken = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+	oidRSAPSS         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+)
+
+// digestAlgorithms maps CMS digest algorithm OIDs to hash functions
+var digestAlgorithms = map[string]crypto.Hash{
+	"2.16.840.1.101.3.4.2.1": crypto.SHA256,
+	"2.16.840.1.101.3.4.2.2": crypto.SHA384,
+	"2.16.840.1.101.3.4.2.3": crypto.SHA512,
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type signedDataInfo struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type encapsulatedContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+// tstInfo is the leading part of an RFC 3161 timestamp token's content
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint asn1.RawValue
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+}
+
+// signedData is a parsed CMS signature with a single signer
+type signedData struct {
+	content      []byte
+	certificates []*x509.Certificate
+	signer       *x509.Certificate
+	info         signerInfo
+	// signingTime is the timestamp's time, the signer's claimed time, or the current time
+	signingTime time.Time
+}
+
+// parseSignedData parses a DER CMS SignedData structure with embedded content
+// and identifies the certificate of its first signer
+func parseSignedData(der []byte) (*signedData, error) {
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, err
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("content type %s is not signed data", ci.ContentType)
+	}
+	var sd signedDataInfo
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, err
+	}
+	if len(sd.EncapContentInfo.Content) == 0 {
+		return nil, fmt.Errorf("signature has no signed content")
+	}
+	if len(sd.SignerInfos) == 0 {
+		return nil, fmt.Errorf("signature has no signers")
+	}
+
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate: %w", err)
+	}
+
+	s := &signedData{
+		content:      sd.EncapContentInfo.Content,
+		certificates: certs,
+		info:         sd.SignerInfos[0],
+		signingTime:  time.Now(),
+	}
+	s.signer, err = findSigner(s.info.SID, certs)
+	if err != nil {
+		return nil, err
+	}
+
+	if t, ok := timestampTime(s.info.UnsignedAttrs); ok {
+		s.signingTime = t
+	} else if values, ok := findAttribute(s.info.SignedAttrs, oidSigningTime); ok {
+		var t time.Time
+		if _, err := asn1.Unmarshal(values, &t); err == nil {
+			s.signingTime = t
+		}
+	}
+	return s, nil
+}
+
+// verify checks that the signed attributes record the digest of the content and
+// that the signer's certificate key signed them
+func (s *signedData) verify() error {
+	hash, ok := digestAlgorithms[s.info.DigestAlgorithm.Algorithm.String()]
+	if !ok {
+		return fmt.Errorf("unsupported digest algorithm %s", s.info.DigestAlgorithm.Algorithm)
+	}
+	if len(s.info.SignedAttrs.Bytes) == 0 {
+		return fmt.Errorf("signature has no signed attributes")
+	}
+
+	values, ok := findAttribute(s.info.SignedAttrs, oidMessageDigest)
+	if !ok {
+		return fmt.Errorf("signature has no message digest")
+	}
+	var digest []byte
+	if _, err := asn1.Unmarshal(values, &digest); err != nil {
+		return fmt.Errorf("invalid message digest: %w", err)
+	}
+	h := hash.New()
+	h.Write(s.content)
+	if !bytes.Equal(h.Sum(nil), digest) {
+		return fmt.Errorf("signed content does not match its message digest")
+	}
+
+	algorithm, err := signatureAlgorithm(hash, s.info.SignatureAlgorithm.Algorithm, s.signer.PublicKeyAlgorithm)
+	if err != nil {
+		return err
+	}
+	// The attributes are signed with their universal SET tag rather than the implicit [0]
+	signed := append([]byte{0x31}, s.info.SignedAttrs.FullBytes[1:]...)
+	if err := s.signer.CheckSignature(algorithm, signed, s.info.Signature); err != nil {
+		return fmt.Errorf("signature does not verify with signer certificate %q: %w", s.signer.Subject.CommonName, err)
+	}
+	return nil
+}
+
+// signatureAlgorithm combines a CMS digest algorithm with the signer's key type
+func signatureAlgorithm(hash crypto.Hash, sigAlgorithm asn1.ObjectIdentifier, keyAlgorithm x509.PublicKeyAlgorithm) (x509.SignatureAlgorithm, error) {
+	pss := sigAlgorithm.Equal(oidRSAPSS)
+	switch {
+	case keyAlgorithm == x509.RSA && pss:
+		return map[crypto.Hash]x509.SignatureAlgorithm{
+			crypto.SHA256: x509.SHA256WithRSAPSS, crypto.SHA384: x509.SHA384WithRSAPSS, crypto.SHA512: x509.SHA512WithRSAPSS,
+		}[hash], nil
+	case keyAlgorithm == x509.RSA:
+		return map[crypto.Hash]x509.SignatureAlgorithm{
+			crypto.SHA256: x509.SHA256WithRSA, crypto.SHA384: x509.SHA384WithRSA, crypto.SHA512: x509.SHA512WithRSA,
+		}[hash], nil
+	case keyAlgorithm == x509.ECDSA:
+		return map[crypto.Hash]x509.SignatureAlgorithm{
+			crypto.SHA256: x509.ECDSAWithSHA256, crypto.SHA384: x509.ECDSAWithSHA384, crypto.SHA512: x509.ECDSAWithSHA512,
+		}[hash], nil
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported signer key algorithm %s", keyAlgorithm)
+}
+
+// findSigner returns the certificate a signer identifier refers to, by issuer and
+// serial number or by subject key identifier
+func findSigner(sid asn1.RawValue, certs []*x509.Certificate) (*x509.Certificate, error) {
+	if sid.Class == asn1.ClassContextSpecific && sid.Tag == 0 {
+		for _, cert := range certs {
+			if bytes.Equal(cert.SubjectKeyId, sid.Bytes) {
+				return cert, nil
+			}
+		}
+		return nil, fmt.Errorf("signer certificate not found in signature")
+	}
+
+	var id issuerAndSerial
+	if _, err := asn1.Unmarshal(sid.FullBytes, &id); err != nil {
+		return nil, fmt.Errorf("invalid signer identifier: %w", err)
+	}
+	for _, cert := range certs {
+		if bytes.Equal(cert.RawIssuer, id.Issuer.FullBytes) && cert.SerialNumber.Cmp(id.Serial) == 0 {
+			return cert, nil
+		}
+	}
+	return nil, fmt.Errorf("signer certificate not found in signature")
+}
+
+// findAttribute returns the DER of the first value of an attribute in a set of attributes
+func findAttribute(attrs asn1.RawValue, oid asn1.ObjectIdentifier) ([]byte, bool) {
+	for rest := attrs.Bytes; len(rest) > 0; {
+		var attr attribute
+		var err error
+		rest, err = asn1.Unmarshal(rest, &attr)
+		if err != nil {
+			return nil, false
+		}
+		if attr.Type.Equal(oid) {
+			var value asn1.RawValue
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &value); err != nil {
+				return nil, false
+			}
+			return value.FullBytes, true
+		}
+	}
+	return nil, false
+}
+
+// timestampTime returns the time of an RFC 3161 timestamp countersignature. The
+// timestamp authority's own signature is not verified.
+func timestampTime(unsignedAttrs asn1.RawValue) (time.Time, bool) {
+	token, ok := findAttribute(unsignedAttrs, oidTimeStampToken)
+	if !ok {
+		return time.Time{}, false
+	}
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(token, &ci); err != nil {
+		return time.Time{}, false
+	}
+	var sd signedDataInfo
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return time.Time{}, false
+	}
+	var info tstInfo
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.Content, &info); err != nil {
+		return time.Time{}, false
+	}
+	return info.GenTime, true
+}
@@ -0,0 +1,86 @@
+package signature
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// cosignSuffix is the file cosign sign-blob --output-signature is expected to write next to an artifact
+const cosignSuffix = ".sig"
+
+// verifyCosign checks the base64 signature cosign sign-blob produced for an artifact
+// against the configured public key. ECDSA and RSA keys sign the SHA-256 digest of
+// the artifact; Ed25519 keys sign the artifact itself.
+func (v *Verifier) verifyCosign(filePath string) error {
+	sigPath := filePath + cosignSuffix
+	encoded, err := os.ReadFile(sigPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w at %s", errNoSignature, sigPath)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", sigPath, err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(encoded)))
+	if err != nil {
+		return fmt.Errorf("%s is not a base64 signature: %w", sigPath, err)
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("error opening artifact: %w", err)
+	}
+	defer f.Close()
+
+	var valid bool
+	switch key := v.cosignKey.(type) {
+	case ed25519.PublicKey:
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return fmt.Errorf("error reading artifact: %w", err)
+		}
+		valid = ed25519.Verify(key, data, sig)
+	case *ecdsa.PublicKey, *rsa.PublicKey:
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return fmt.Errorf("error reading artifact: %w", err)
+		}
+		if ecKey, ok := key.(*ecdsa.PublicKey); ok {
+			valid = ecdsa.VerifyASN1(ecKey, h.Sum(nil), sig)
+		} else {
+			valid = rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), crypto.SHA256, h.Sum(nil), sig) == nil
+		}
+	default:
+		return fmt.Errorf("unsupported cosign public key type %T", key)
+	}
+
+	if !valid {
+		return fmt.Errorf("signature %s does not match the artifact", sigPath)
+	}
+	return nil
+}
+
+// VerifyData reports whether sig is a signature of data by key, made as cosign makes
+// them: ECDSA and RSA keys sign the SHA-256 digest of the data, Ed25519 keys the data
+// itself
+func VerifyData(key crypto.PublicKey, data, sig []byte) (bool, error) {
+	switch key := key.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, sig), nil
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, digest[:], sig), nil
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil, nil
+	}
+	return false, fmt.Errorf("unsupported public key type %T", key)
+}
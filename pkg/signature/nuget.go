@@ -0,0 +1,263 @@
+package signature
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha256" // hash functions NuGet signatures may use
+	_ "crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// nugetSignatureFile is the ZIP entry holding a NuGet package signature
+const nugetSignatureFile = ".signature.p7s"
+
+// ZIP record signatures and sizes used to rebuild the unsigned package
+const (
+	localHeaderSignature   = 0x04034b50
+	centralHeaderSignature = 0x02014b50
+	endOfCentralSignature  = 0x06054b50
+	localHeaderSize        = 30
+	centralHeaderSize      = 46
+	endOfCentralSize       = 22
+)
+
+// nugetHashAlgorithms maps the hash algorithm OIDs of the signature content to hash functions
+var nugetHashAlgorithms = map[string]crypto.Hash{
+	"2.16.840.1.101.3.4.2.1": crypto.SHA256,
+	"2.16.840.1.101.3.4.2.2": crypto.SHA384,
+	"2.16.840.1.101.3.4.2.3": crypto.SHA512,
+}
+
+// verifyNuGet checks the primary signature of a NuGet package: the signer's signature
+// over the signed content, the package hash that content records and the signer
+// certificate chain to the trusted roots at the time the package was signed. Without
+// roots the error wraps errUntrustedSigner once the signature itself verifies.
+func (v *Verifier) verifyNuGet(filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("error opening package: %w", err)
+	}
+	defer f.Close()
+
+	pkg, err := readSignedZip(f)
+	if err != nil {
+		return err
+	}
+
+	signed, err := parseSignedData(pkg.signature)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", nugetSignatureFile, err)
+	}
+	if err := signed.verify(); err != nil {
+		return err
+	}
+
+	hash, expected, err := nugetContentHash(signed.content)
+	if err != nil {
+		return err
+	}
+	h := hash.New()
+	if err := pkg.writeUnsigned(h); err != nil {
+		return fmt.Errorf("error reading package: %w", err)
+	}
+	if !bytes.Equal(h.Sum(nil), expected) {
+		return fmt.Errorf("package content does not match the hash in its signature")
+	}
+
+	if v.roots == nil {
+		return fmt.Errorf("signer certificate %q: %w", signed.signer.Subject.CommonName, errUntrustedSigner)
+	}
+	opts := x509.VerifyOptions{
+		Roots:         v.roots,
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   signed.signingTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	for _, cert := range signed.certificates {
+		opts.Intermediates.AddCert(cert)
+	}
+	if _, err := signed.signer.Verify(opts); err != nil {
+		return fmt.Errorf("signer certificate %q is not trusted: %w", signed.signer.Subject.CommonName, err)
+	}
+
+	return nil
+}
+
+// nugetContentHash reads the package hash from NuGet signature content, a set of
+// "Version:1" and "<hash algorithm OID>-Hash:<base64>" lines
+func nugetContentHash(content []byte) (crypto.Hash, []byte, error) {
+	for _, line := range strings.Split(string(content), "\n") {
+		oid, value, ok := strings.Cut(strings.TrimSpace(line), "-Hash:")
+		if !ok {
+			continue
+		}
+		hash, known := nugetHashAlgorithms[oid]
+		if !known {
+			return 0, nil, fmt.Errorf("unsupported package hash algorithm %s", oid)
+		}
+		digest, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid package hash in signature: %w", err)
+		}
+		return hash, digest, nil
+	}
+	return 0, nil, fmt.Errorf("signature content has no package hash")
+}
+
+// signedZip locates the signature entry of a package so the package can be hashed as
+// it was before the entry was added
+type signedZip struct {
+	r io.ReaderAt
+	// signature is the content of the signature entry
+	signature []byte
+	// Offset and length of the signature entry's local header and data
+	localOffset, localLength int64
+	// centralOffset is where the central directory starts
+	centralOffset int64
+	// central holds the central directory records, without the signature entry's
+	central []byte
+	// endOfCentral is the end of central directory record, including the archive comment
+	endOfCentral []byte
+	// centralRecordLength is the size of the signature entry's central directory record
+	centralRecordLength int
+}
+
+// readSignedZip reads the central directory of a ZIP archive and the signature entry.
+// Archives without the entry wrap errNoSignature; ZIP64 archives are not supported.
+func readSignedZip(f *os.File) (*signedZip, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("error reading package: %w", err)
+	}
+	size := info.Size()
+
+	// The end of central directory record is followed by at most a 64 KiB comment
+	tailSize := min(size, endOfCentralSize+0xffff)
+	tail := make([]byte, tailSize)
+	if _, err := f.ReadAt(tail, size-tailSize); err != nil {
+		return nil, fmt.Errorf("error reading package: %w", err)
+	}
+	eocd := -1
+	for i := len(tail) - endOfCentralSize; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(tail[i:]) == endOfCentralSignature &&
+			i+endOfCentralSize+int(binary.LittleEndian.Uint16(tail[i+20:])) == len(tail) {
+			eocd = i
+			break
+		}
+	}
+	if eocd < 0 {
+		return nil, fmt.Errorf("package is not a ZIP archive")
+	}
+
+	pkg := &signedZip{r: f, endOfCentral: append([]byte(nil), tail[eocd:]...)}
+	centralSize := int64(binary.LittleEndian.Uint32(pkg.endOfCentral[12:]))
+	pkg.centralOffset = int64(binary.LittleEndian.Uint32(pkg.endOfCentral[16:]))
+	if pkg.centralOffset == 0xffffffff || centralSize == 0xffffffff {
+		return nil, fmt.Errorf("ZIP64 packages are not supported")
+	}
+	if pkg.centralOffset+centralSize > size {
+		return nil, fmt.Errorf("package has a truncated central directory")
+	}
+	central := make([]byte, centralSize)
+	if _, err := f.ReadAt(central, pkg.centralOffset); err != nil {
+		return nil, fmt.Errorf("error reading package: %w", err)
+	}
+
+	found := false
+	for rest := central; len(rest) > 0; {
+		if len(rest) < centralHeaderSize || binary.LittleEndian.Uint32(rest) != centralHeaderSignature {
+			return nil, fmt.Errorf("package has a malformed central directory")
+		}
+		recordLength := centralHeaderSize + int(binary.LittleEndian.Uint16(rest[28:])) +
+			int(binary.LittleEndian.Uint16(rest[30:])) + int(binary.LittleEndian.Uint16(rest[32:]))
+		if recordLength > len(rest) {
+			return nil, fmt.Errorf("package has a malformed central directory")
+		}
+		record := rest[:recordLength]
+		rest = rest[recordLength:]
+
+		name := string(record[centralHeaderSize : centralHeaderSize+int(binary.LittleEndian.Uint16(record[28:]))])
+		if name != nugetSignatureFile {
+			pkg.central = append(pkg.central, record...)
+			continue
+		}
+		if found {
+			return nil, fmt.Errorf("package has more than one %s", nugetSignatureFile)
+		}
+		found = true
+		pkg.centralRecordLength = recordLength
+		if err := pkg.readSignature(record); err != nil {
+			return nil, err
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%w in package (%s)", errNoSignature, nugetSignatureFile)
+	}
+	return pkg, nil
+}
+
+// readSignature reads the signature entry described by its central directory record.
+// NuGet stores the entry uncompressed.
+func (z *signedZip) readSignature(record []byte) error {
+	if method := binary.LittleEndian.Uint16(record[10:]); method != 0 {
+		return fmt.Errorf("%s is compressed", nugetSignatureFile)
+	}
+	dataLength := int64(binary.LittleEndian.Uint32(record[20:]))
+	z.localOffset = int64(binary.LittleEndian.Uint32(record[42:]))
+
+	header := make([]byte, localHeaderSize)
+	if _, err := z.r.ReadAt(header, z.localOffset); err != nil || binary.LittleEndian.Uint32(header) != localHeaderSignature {
+		return fmt.Errorf("package has a malformed %s entry", nugetSignatureFile)
+	}
+	dataOffset := z.localOffset + localHeaderSize +
+		int64(binary.LittleEndian.Uint16(header[26:])) + int64(binary.LittleEndian.Uint16(header[28:]))
+	z.localLength = dataOffset + dataLength - z.localOffset
+	if z.localOffset+z.localLength > z.centralOffset {
+		return fmt.Errorf("package has a malformed %s entry", nugetSignatureFile)
+	}
+
+	z.signature = make([]byte, dataLength)
+	if _, err := z.r.ReadAt(z.signature, dataOffset); err != nil {
+		return fmt.Errorf("error reading %s: %w", nugetSignatureFile, err)
+	}
+	return nil
+}
+
+// writeUnsigned writes the package as it was before it was signed: without the signature
+// entry, with the offsets after it moved back and the entry counts and sizes reduced
+func (z *signedZip) writeUnsigned(w io.Writer) error {
+	if _, err := io.Copy(w, io.NewSectionReader(z.r, 0, z.localOffset)); err != nil {
+		return err
+	}
+	after := z.localOffset + z.localLength
+	if _, err := io.Copy(w, io.NewSectionReader(z.r, after, z.centralOffset-after)); err != nil {
+		return err
+	}
+
+	central := append([]byte(nil), z.central...)
+	for rest := central; len(rest) > 0; {
+		offset := binary.LittleEndian.Uint32(rest[42:])
+		if int64(offset) > z.localOffset {
+			binary.LittleEndian.PutUint32(rest[42:], offset-uint32(z.localLength))
+		}
+		rest = rest[centralHeaderSize+int(binary.LittleEndian.Uint16(rest[28:]))+
+			int(binary.LittleEndian.Uint16(rest[30:]))+int(binary.LittleEndian.Uint16(rest[32:])):]
+	}
+	if _, err := w.Write(central); err != nil {
+		return err
+	}
+
+	eocd := append([]byte(nil), z.endOfCentral...)
+	binary.LittleEndian.PutUint16(eocd[8:], binary.LittleEndian.Uint16(eocd[8:])-1)
+	binary.LittleEndian.PutUint16(eocd[10:], binary.LittleEndian.Uint16(eocd[10:])-1)
+	binary.LittleEndian.PutUint32(eocd[12:], binary.LittleEndian.Uint32(eocd[12:])-uint32(z.centralRecordLength))
+	binary.LittleEndian.PutUint32(eocd[16:], uint32(z.centralOffset-z.localLength))
+	_, err := w.Write(eocd)
+	return err
+}
@@ -0,0 +1,256 @@
+package signature
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"hash/crc32"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+)
+
+var (
+	oidSHA256          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidData            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+)
+
+// testCA issues code signing certificates
+type testCA struct {
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newTestCA(t *testing.T) testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testCA{key: key, cert: cert}
+}
+
+// issue returns a signer key with a code signing certificate issued by the CA
+func (ca testCA) issue(t *testing.T) (*ecdsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Example Publisher"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+// writeNuGet writes a package with one file and, if signature is not nil, a
+// .signature.p7s entry holding it
+func writeNuGet(t *testing.T, path string, signature []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f, err := w.CreateHeader(&zip.FileHeader{Name: "Example.nuspec", Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("<package><metadata><id>Example</id><version>1.0.0</version></metadata></package>"))
+	if signature != nil {
+		// NuGet stores the signature without a data descriptor, so its sizes are known
+		// from its headers
+		f, err := w.CreateRaw(&zip.FileHeader{
+			Name:               nugetSignatureFile,
+			Method:             zip.Store,
+			Modified:           modified,
+			CRC32:              crc32.ChecksumIEEE(signature),
+			CompressedSize64:   uint64(len(signature)),
+			UncompressedSize64: uint64(len(signature)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(signature)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// signNuGet writes a package signed by key with cert, with a CMS signature over the
+// hash of the package as it was before it was signed
+func signNuGet(t *testing.T, path string, key *ecdsa.PrivateKey, cert *x509.Certificate) {
+	t.Helper()
+	// The unsigned package does not depend on the signature, so a placeholder entry
+	// gives the hash the real signature covers
+	writeNuGet(t, path, []byte("placeholder"))
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := readSignedZip(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packageHash := sha256.New()
+	if err := pkg.writeUnsigned(packageHash); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	content := []byte("Version:1\n\n2.16.840.1.101.3.4.2.1-Hash:" + base64.StdEncoding.EncodeToString(packageHash.Sum(nil)) + "\n\n")
+	contentDigest := sha256.Sum256(content)
+	digestValue := mustMarshal(t, contentDigest[:])
+	digestAttr := mustMarshal(t, attribute{
+		Type:   oidMessageDigest,
+		Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: digestValue},
+	})
+	// Signed attributes are signed as a SET and stored with the implicit [0] tag
+	attrs := mustMarshal(t, asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: digestAttr})
+	attrsDigest := sha256.Sum256(attrs)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, attrsDigest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sd := mustMarshal(t, signedDataInfo{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		EncapContentInfo: encapsulatedContentInfo{ContentType: oidData, Content: content},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: cert.Raw},
+		SignerInfos: []signerInfo{{
+			Version: 1,
+			SID: asn1.RawValue{FullBytes: mustMarshal(t, issuerAndSerial{
+				Issuer: asn1.RawValue{FullBytes: cert.RawIssuer},
+				Serial: cert.SerialNumber,
+			})},
+			DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: digestAttr},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256},
+			Signature:          sig,
+		}},
+	})
+	signature := mustMarshal(t, contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+	writeNuGet(t, path, signature)
+}
+
+func mustMarshal(t *testing.T, value any) []byte {
+	t.Helper()
+	der, err := asn1.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestVerifyNuGet(t *testing.T) {
+	ca := newTestCA(t)
+	key, cert := ca.issue(t)
+
+	trusted := x509.NewCertPool()
+	trusted.AddCert(ca.cert)
+	untrusted := x509.NewCertPool()
+	untrusted.AddCert(newTestCA(t).cert)
+
+	tests := []struct {
+		name   string
+		signed bool
+		roots  *x509.CertPool
+		want   string
+		// wantDetail is part of the finding's detail
+		wantDetail string
+	}{
+		{name: "signer chains to the roots", signed: true, roots: trusted},
+		{name: "signer does not chain to the roots", signed: true, roots: untrusted, want: models.FindingInvalidSignature, wantDetail: "is not trusted"},
+		{name: "signed without roots to trust the signer", signed: true, want: models.FindingUnverifiableSignature, wantDetail: "--signature-roots"},
+		{name: "unsigned", roots: trusted, want: models.FindingUnsignedPackage, wantDetail: "no signature"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "Example.1.0.0.nupkg")
+			if tt.signed {
+				signNuGet(t, path, key, cert)
+			} else {
+				writeNuGet(t, path, nil)
+			}
+
+			findings := (&Verifier{roots: tt.roots}).Verify("Example", "1.0.0", "NuGet", path)
+			switch {
+			case tt.want == "" && len(findings) > 0:
+				t.Errorf("findings = %+v, want none", findings)
+			case tt.want != "" && (len(findings) != 1 || findings[0].Kind != tt.want):
+				t.Errorf("findings = %+v, want one %s", findings, tt.want)
+			case tt.want != "" && !strings.Contains(findings[0].Detail, tt.wantDetail):
+				t.Errorf("detail = %q, want it to mention %q", findings[0].Detail, tt.wantDetail)
+			}
+		})
+	}
+
+	t.Run("content changed after signing", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "Example.1.0.0.nupkg")
+		signNuGet(t, path, key, cert)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The nuspec's modification date is in its local header, covered by the hash
+		data[10] ^= 0xff
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		findings := (&Verifier{roots: trusted}).Verify("Example", "1.0.0", "NuGet", path)
+		if len(findings) != 1 || findings[0].Kind != models.FindingInvalidSignature ||
+			!strings.Contains(findings[0].Detail, "does not match the hash") {
+			t.Errorf("findings = %+v, want one %s for the package hash", findings, models.FindingInvalidSignature)
+		}
+	})
+}
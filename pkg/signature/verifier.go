@@ -0,0 +1,133 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+)
+
+// errNoSignature is wrapped by verification errors for artifacts that are not signed at all
+var errNoSignature = errors.New("no signature found")
+
+// errUntrustedSigner is wrapped by verification errors for signatures that verify with
+// a certificate no trusted roots were given for
+var errUntrustedSigner = errors.New("signer cannot be trusted without --signature-roots")
+
+// Verifier checks the signatures carried by package artifacts.
+//
+// NuGet packages are expected to embed a signature (.signature.p7s); its signer
+// signature and the package content hash it covers are verified, and the signer
+// certificate must chain to one of the trusted roots. Without roots, anyone could have
+// issued the certificate, so the signature cannot be trusted. With a cosign public
+// key, every artifact must have a cosign sign-blob signature stored next to it.
+type Verifier struct {
+	// roots, when set, are the certificates NuGet signer certificates must chain to
+	roots *x509.CertPool
+	// cosignKey, when set, verifies <artifact>.sig signatures
+	cosignKey crypto.PublicKey
+}
+
+// NewVerifier creates a signature verifier. rootsPath is an optional PEM bundle of
+// trusted code-signing roots for NuGet signatures; cosignKeyPath is an optional
+// PEM public key (as written by cosign generate-key-pair) for sidecar signatures.
+func NewVerifier(rootsPath, cosignKeyPath string) (*Verifier, error) {
+	v := &Verifier{}
+
+	if rootsPath != "" {
+		var err error
+		if v.roots, err = LoadRoots(rootsPath); err != nil {
+			return nil, err
+		}
+	}
+
+	if cosignKeyPath != "" {
+		var err error
+		if v.cosignKey, err = LoadPublicKey(cosignKeyPath); err != nil {
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
+
+// LoadRoots reads a PEM bundle of trusted root certificates
+func LoadRoots(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading signature roots: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return roots, nil
+}
+
+// LoadPublicKey reads a PEM public key, as written by cosign generate-key-pair
+func LoadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading cosign public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in %s", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cosign public key %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// Verify checks the signatures of a package artifact on disk and returns any findings.
+// Packages without an artifact file have nothing to verify.
+func (v *Verifier) Verify(name, version, ecosystem, filePath string) []models.SupplyChainFinding {
+	if filePath == "" {
+		return nil
+	}
+
+	finding := func(kind, detail string) models.SupplyChainFinding {
+		return models.SupplyChainFinding{
+			PackageName: name,
+			Version:     version,
+			Ecosystem:   ecosystem,
+			FilePath:    filePath,
+			Kind:        kind,
+			Detail:      detail,
+		}
+	}
+
+	var findings []models.SupplyChainFinding
+
+	if strings.HasSuffix(strings.ToLower(filePath), ".nupkg") {
+		if err := v.verifyNuGet(filePath); err != nil {
+			kind := models.FindingInvalidSignature
+			switch {
+			case errors.Is(err, errNoSignature):
+				kind = models.FindingUnsignedPackage
+			case errors.Is(err, errUntrustedSigner):
+				kind = models.FindingUnverifiableSignature
+			}
+			findings = append(findings, finding(kind, err.Error()))
+		}
+	}
+
+	if v.cosignKey != nil {
+		if err := v.verifyCosign(filePath); err != nil {
+			kind := models.FindingInvalidSignature
+			if errors.Is(err, errNoSignature) {
+				kind = models.FindingUnsignedPackage
+			}
+			findings = append(findings, finding(kind, "cosign: "+err.Error()))
+		}
+	}
+
+	return findings
+}
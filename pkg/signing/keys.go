@@ -0,0 +1,242 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Layout of a signing key directory
+const (
+	keyringFile   = "keyring.json"
+	privateKey    = "signing.key"
+	publicKey     = "signing.pub"
+	retiredKeyDir = "retired"
+)
+
+// Signing modes
+const (
+	// ModeKey signs with an Ed25519 key pair held in the key directory
+	ModeKey = "key"
+	// ModeKeyless signs with short-lived Sigstore certificates bound to an OIDC identity
+	ModeKeyless = "keyless"
+)
+
+// Public-good Sigstore instance used for keyless signing
+const (
+	DefaultFulcioURL = "https://fulcio.sigstore.dev"
+	DefaultRekorURL  = "https://rekor.sigstore.dev"
+)
+
+// ErrKeyringExists is returned when generating keys into a directory that already holds some
+var ErrKeyringExists = errors.New("signing keys already exist; use keys rotate to replace them")
+
+// Keyring records the signing setup of a key directory
+type Keyring struct {
+	Mode string `json:"mode"`
+	// KeyID identifies the current key pair; it is empty in keyless mode
+	KeyID     string    `json:"key_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// Retired lists replaced key pairs whose public keys are kept to verify older reports
+	Retired []RetiredKey `json:"retired,omitempty"`
+	Keyless *Keyless     `json:"keyless,omitempty"`
+}
+
+// RetiredKey is a key pair replaced by a rotation
+type RetiredKey struct {
+	KeyID     string    `json:"key_id"`
+	CreatedAt time.Time `json:"created_at"`
+	RetiredAt time.Time `json:"retired_at"`
+}
+
+// Keyless configures Sigstore keyless signing
+type Keyless struct {
+	FulcioURL  string `json:"fulcio_url"`
+	RekorURL   string `json:"rekor_url"`
+	OIDCIssuer string `json:"oidc_issuer"`
+	// Identity is the certificate subject (e-mail or workflow URI) verifiers expect
+	Identity string `json:"identity"`
+}
+
+// ReadKeyring reads the keyring of a key directory
+func ReadKeyring(dir string) (*Keyring, error) {
+	data, err := os.ReadFile(filepath.Join(dir, keyringFile))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no signing keys in %s; run keys generate first", dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading keyring: %w", err)
+	}
+
+	var keyring Keyring
+	if err := json.Unmarshal(data, &keyring); err != nil {
+		return nil, fmt.Errorf("error parsing keyring: %w", err)
+	}
+	return &keyring, nil
+}
+
+// writeKeyring writes the keyring of a key directory
+func writeKeyring(dir string, keyring *Keyring) error {
+	data, err := json.MarshalIndent(keyring, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding keyring: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, keyringFile), data, 0644); err != nil {
+		return fmt.Errorf("error writing keyring: %w", err)
+	}
+	return nil
+}
+
+// Generate creates an Ed25519 signing key pair in dir. The private key is
+// only readable by the owner.
+func Generate(dir string) (*Keyring, error) {
+	if err := checkEmpty(dir); err != nil {
+		return nil, err
+	}
+
+	keyring := &Keyring{Mode: ModeKey}
+	if err := newKeyPair(dir, keyring); err != nil {
+		return nil, err
+	}
+	if err := writeKeyring(dir, keyring); err != nil {
+		return nil, err
+	}
+	return keyring, nil
+}
+
+// GenerateKeyless configures dir for Sigstore keyless signing. No key material is
+// stored; certificates are issued by Fulcio for the OIDC identity at signing time.
+func GenerateKeyless(dir string, keyless Keyless) (*Keyring, error) {
+	if keyless.OIDCIssuer == "" || keyless.Identity == "" {
+		return nil, fmt.Errorf("keyless signing requires an OIDC issuer and identity")
+	}
+	if keyless.FulcioURL == "" {
+		keyless.FulcioURL = DefaultFulcioURL
+	}
+	if keyless.RekorURL == "" {
+		keyless.RekorURL = DefaultRekorURL
+	}
+	if err := checkEmpty(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating key directory: %w", err)
+	}
+
+	keyring := &Keyring{Mode: ModeKeyless, CreatedAt: time.Now().UTC(), Keyless: &keyless}
+	if err := writeKeyring(dir, keyring); err != nil {
+		return nil, err
+	}
+	return keyring, nil
+}
+
+// Rotate replaces the current key pair with a new one. The old public key is moved to
+// the retired directory so reports signed before the rotation can still be verified;
+// the old private key is deleted.
+func Rotate(dir string) (*Keyring, error) {
+	keyring, err := ReadKeyring(dir)
+	if err != nil {
+		return nil, err
+	}
+	if keyring.Mode != ModeKey {
+		return nil, fmt.Errorf("keys in %s use %s signing, which has no key to rotate", dir, keyring.Mode)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, retiredKeyDir), 0755); err != nil {
+		return nil, fmt.Errorf("error creating retired key directory: %w", err)
+	}
+	retiredPath := filepath.Join(dir, retiredKeyDir, keyring.KeyID+".pub")
+	if err := os.Rename(filepath.Join(dir, publicKey), retiredPath); err != nil {
+		return nil, fmt.Errorf("error retiring public key: %w", err)
+	}
+	keyring.Retired = append(keyring.Retired, RetiredKey{
+		KeyID:     keyring.KeyID,
+		CreatedAt: keyring.CreatedAt,
+		RetiredAt: time.Now().UTC(),
+	})
+
+	if err := newKeyPair(dir, keyring); err != nil {
+		return nil, err
+	}
+	if err := writeKeyring(dir, keyring); err != nil {
+		return nil, err
+	}
+	return keyring, nil
+}
+
+// Export returns the PEM-encoded public keys of a key directory, the current key
+// first followed by retired keys, for distribution to report verifiers. In keyless
+// mode it returns the keyring, which names the identity verifiers must trust.
+func Export(dir string) ([]byte, error) {
+	keyring, err := ReadKeyring(dir)
+	if err != nil {
+		return nil, err
+	}
+	if keyring.Mode == ModeKeyless {
+		return json.MarshalIndent(keyring, "", "  ")
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, publicKey))
+	if err != nil {
+		return nil, fmt.Errorf("error reading public key: %w", err)
+	}
+	for _, retired := range keyring.Retired {
+		old, err := os.ReadFile(filepath.Join(dir, retiredKeyDir, retired.KeyID+".pub"))
+		if err != nil {
+			return nil, fmt.Errorf("error reading retired public key %s: %w", retired.KeyID, err)
+		}
+		data = append(data, old...)
+	}
+	return data, nil
+}
+
+// checkEmpty fails if dir already holds a keyring
+func checkEmpty(dir string) error {
+	if _, err := os.Stat(filepath.Join(dir, keyringFile)); err == nil {
+		return ErrKeyringExists
+	}
+	return nil
+}
+
+// newKeyPair writes a new Ed25519 key pair to dir and records it as the current key
+func newKeyPair(dir string, keyring *Keyring) error {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("error generating signing key: %w", err)
+	}
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return fmt.Errorf("error encoding private key: %w", err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return fmt.Errorf("error encoding public key: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating key directory: %w", err)
+	}
+	privPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER})
+	if err := os.WriteFile(filepath.Join(dir, privateKey), privPEM, 0600); err != nil {
+		return fmt.Errorf("error writing private key: %w", err)
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+	if err := os.WriteFile(filepath.Join(dir, publicKey), pubPEM, 0644); err != nil {
+		return fmt.Errorf("error writing public key: %w", err)
+	}
+
+	sum := sha256.Sum256(pubDER)
+	keyring.KeyID = hex.EncodeToString(sum[:8])
+	keyring.CreatedAt = time.Now().UTC()
+	return nil
+}
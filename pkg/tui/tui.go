@@ -43,6 +43,11 @@ type AppConfig struct {
 	DBPassword string
 	DBName     string
 	DBSSLMode  string
+	// TLS certificates and client key, for verify-ca/verify-full and certificate authentication
+	DBSSLRootCert string
+	DBSSLCert     string
+	DBSSLKey      string
+	DBSSLPassword string
 
 	// Logging options
 	LogToFile     bool
@@ -161,6 +166,10 @@ func NewModel() Model {
 	dbPassword := getEnvWithDefault("DB_PASSWORD", "")
 	dbName := getEnvWithDefault("DB_NAME", "package_scanner")
 	dbSSLMode := getEnvWithDefault("DB_SSL_MODE", "disable")
+	dbSSLRootCert := getEnvWithDefault("DB_SSL_ROOT_CERT", "")
+	dbSSLCert := getEnvWithDefault("DB_SSL_CERT", "")
+	dbSSLKey := getEnvWithDefault("DB_SSL_KEY", "")
+	dbSSLPassword := getEnvWithDefault("DB_SSL_PASSWORD", "")
 
 	// Other defaults
 	packageName := getEnvWithDefault("PACKAGE_NAME", "Microsoft.AspNetCore.Identity")
@@ -186,6 +195,10 @@ func NewModel() Model {
 			DBPassword:       dbPassword,
 			DBName:           dbName,
 			DBSSLMode:        dbSSLMode,
+			DBSSLRootCert:    dbSSLRootCert,
+			DBSSLCert:        dbSSLCert,
+			DBSSLKey:         dbSSLKey,
+			DBSSLPassword:    dbSSLPassword,
 			LogToFile:        true,
 			LogFilePath:      logFilePath,
 			LogMaxSize:       logMaxSize,
@@ -270,7 +283,11 @@ func (m *Model) initializeInputs() {
 		{placeholder: "User", value: m.config.DBUser, label: "Database User"},
 		{placeholder: "Password", value: m.config.DBPassword, label: "Database Password"},
 		{placeholder: "Database Name", value: m.config.DBName, label: "Database Name"},
-		{placeholder: "SSL Mode", value: m.config.DBSSLMode, label: "SSL Mode"},
+		{placeholder: "SSL Mode (disable, require, verify-ca, verify-full)", value: m.config.DBSSLMode, label: "SSL Mode"},
+		{placeholder: "SSL Root Certificate (path or system)", value: m.config.DBSSLRootCert, label: "SSL Root Certificate"},
+		{placeholder: "SSL Client Certificate", value: m.config.DBSSLCert, label: "SSL Client Certificate"},
+		{placeholder: "SSL Client Key", value: m.config.DBSSLKey, label: "SSL Client Key"},
+		{placeholder: "SSL Key Password", value: m.config.DBSSLPassword, label: "SSL Key Password"},
 	}
 
 	// Log inputs
@@ -322,11 +339,11 @@ func (m *Model) initializeInputs() {
 		ti := textinput.New()
 		ti.Placeholder = inp.placeholder
 		ti.SetValue(inp.value)
-		ti.CharLimit = 64
+		ti.CharLimit = 256
 		ti.Width = 40
 
-		// Hide password input
-		if inp.label == "Database Password" {
+		// Hide password inputs
+		if inp.label == "Database Password" || inp.label == "SSL Key Password" {
 			ti.EchoMode = textinput.EchoPassword
 			ti.EchoCharacter = '•'
 		}
@@ -573,7 +590,7 @@ func (m *Model) updateConfig() {
 
 	// Update DB config
 	if m.showAdvanced {
-		if len(m.dbInputs) >= 6 {
+		if len(m.dbInputs) >= 10 {
 			m.config.UseDB = true // If they're in advanced mode and submitting, assume DB usage
 			m.config.DBHost = m.dbInputs[0].Value()
 			if port, err := strconv.Atoi(m.dbInputs[1].Value()); err == nil {
@@ -583,6 +600,10 @@ func (m *Model) updateConfig() {
 			m.config.DBPassword = m.dbInputs[3].Value()
 			m.config.DBName = m.dbInputs[4].Value()
 			m.config.DBSSLMode = m.dbInputs[5].Value()
+			m.config.DBSSLRootCert = m.dbInputs[6].Value()
+			m.config.DBSSLCert = m.dbInputs[7].Value()
+			m.config.DBSSLKey = m.dbInputs[8].Value()
+			m.config.DBSSLPassword = m.dbInputs[9].Value()
 		}
 
 		// Update log config
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package usage
+
+import (
+	"runtime"
+	"time"
+)
+
+// processUsage returns the memory obtained from the operating system by the Go runtime;
+// CPU time is not available on this platform
+func processUsage() (time.Duration, int64) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return 0, int64(stats.Sys)
+}
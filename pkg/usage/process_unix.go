@@ -0,0 +1,26 @@
+//go:build unix
+
+package usage
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// processUsage returns the CPU time and peak resident set size of the process
+func processUsage() (time.Duration, int64) {
+	var rusage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &rusage); err != nil {
+		return 0, 0
+	}
+
+	cpu := time.Duration(rusage.Utime.Nano() + rusage.Stime.Nano())
+
+	// Maxrss is reported in bytes on macOS and in kilobytes elsewhere
+	peak := int64(rusage.Maxrss)
+	if runtime.GOOS != "darwin" {
+		peak *= 1024
+	}
+	return cpu, peak
+}
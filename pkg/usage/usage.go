@@ -0,0 +1,97 @@
+package usage
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Usage is the resources consumed by one run
+type Usage struct {
+	StartedAt  time.Time
+	FinishedAt time.Time
+	// CPUTime is the user and system CPU time of the process
+	CPUTime time.Duration
+	// PeakMemoryBytes is the maximum resident set size of the process
+	PeakMemoryBytes int64
+	// BytesDownloaded counts HTTP response bodies read
+	BytesDownloaded int64
+	// APICalls counts HTTP requests, in total and per host
+	APICalls       int
+	APICallsByHost map[string]int
+}
+
+// Tracker accounts the resources used by a run. HTTP traffic is counted by wrapping
+// http.DefaultTransport, which every client in the scanner uses.
+type Tracker struct {
+	startedAt time.Time
+	transport *countingTransport
+}
+
+// Start begins accounting and installs the counting transport
+func Start() *Tracker {
+	transport := &countingTransport{next: http.DefaultTransport, calls: make(map[string]int)}
+	http.DefaultTransport = transport
+	return &Tracker{startedAt: time.Now(), transport: transport}
+}
+
+// Elapsed returns the wall-clock time since accounting started
+func (t *Tracker) Elapsed() time.Duration {
+	return time.Since(t.startedAt)
+}
+
+// Snapshot returns the resources used so far
+func (t *Tracker) Snapshot() Usage {
+	usage := Usage{
+		StartedAt:       t.startedAt,
+		FinishedAt:      time.Now(),
+		BytesDownloaded: t.transport.bytes.Load(),
+		APICallsByHost:  make(map[string]int),
+	}
+	usage.CPUTime, usage.PeakMemoryBytes = processUsage()
+
+	t.transport.mu.Lock()
+	defer t.transport.mu.Unlock()
+	for host, calls := range t.transport.calls {
+		usage.APICallsByHost[host] = calls
+		usage.APICalls += calls
+	}
+	return usage
+}
+
+// countingTransport counts requests per host and the response bytes read
+type countingTransport struct {
+	next  http.RoundTripper
+	bytes atomic.Int64
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+// RoundTrip counts the request and wraps the response body to count bytes read
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.calls[req.URL.Host]++
+	t.mu.Unlock()
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &countingBody{ReadCloser: resp.Body, bytes: &t.bytes}
+	return resp, nil
+}
+
+// countingBody adds the bytes read from a response body to a counter
+type countingBody struct {
+	io.ReadCloser
+	bytes *atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,304 @@
+package version
+
+import "strings"
+
+// Comparator orders two versions, returning -1, 0 or 1
+type Comparator func(a, b string) int
+
+// mavenQualifierOrder ranks Maven's well-known qualifiers as ComparableVersion does:
+// snapshots come after release candidates, and unknown qualifiers after the release
+var mavenQualifierOrder = map[string]int{
+	"alpha":     -5,
+	"a":         -5,
+	"beta":      -4,
+	"b":         -4,
+	"milestone": -3,
+	"m":         -3,
+	"rc":        -2,
+	"cr":        -2,
+	"snapshot":  -1,
+	"":          0,
+	"final":     0,
+	"ga":        0,
+	"release":   0,
+}
+
+// pep440PreReleaseOrder ranks the normalized PEP 440 pre-release labels
+var pep440PreReleaseOrder = map[string]int{"a": 0, "b": 1, "rc": 2}
+
+// ForEcosystem returns the comparator implementing an ecosystem's version ordering:
+// semver for npm, PEP 440 for PyPI, NuGet's for NuGet and Maven's for Maven. It returns
+// false for other ecosystems, whose orderings are not implemented.
+func ForEcosystem(ecosystem string) (Comparator, bool) {
+	switch strings.ToLower(ecosystem) {
+	case "npm":
+		return CompareSemver, true
+	case "pypi":
+		return ComparePEP440, true
+	case "nuget":
+		return CompareNuGet, true
+	case "maven":
+		return CompareMaven, true
+	}
+	return nil, false
+}
+
+// CompareSemver compares two semantic versions by semver 2.0 precedence: build metadata
+// is ignored, and a pre-release sorts before its release. Versions that are not semver
+// are compared as Compare does.
+func CompareSemver(a, b string) int {
+	va, okA := parseNumericVersion(a)
+	vb, okB := parseNumericVersion(b)
+	if !okA || !okB || va.parts[3] != "0" || vb.parts[3] != "0" {
+		return Compare(a, b)
+	}
+	return compareNumericVersions(va, vb, false)
+}
+
+// CompareNuGet compares two NuGet versions: up to four numeric parts, then the
+// pre-release label, compared without regard to case. Build metadata is ignored.
+func CompareNuGet(a, b string) int {
+	va, okA := parseNumericVersion(a)
+	vb, okB := parseNumericVersion(b)
+	if !okA || !okB {
+		return Compare(a, b)
+	}
+	return compareNumericVersions(va, vb, true)
+}
+
+// CompareMaven compares two Maven versions as Compare does, with Maven's ordering
+// of qualifiers, in which snapshots sort after release candidates
+func CompareMaven(a, b string) int {
+	return compareQualified(a, b, mavenQualifierOrder)
+}
+
+// ComparePEP440 compares two Python versions by PEP 440: epoch, release, then
+// pre-, post- and development releases and the local version label. Versions that
+// are not valid PEP 440 versions are compared as Compare does.
+func ComparePEP440(a, b string) int {
+	va, okA := parsePEP440(a)
+	vb, okB := parsePEP440(b)
+	if !okA || !okB {
+		return Compare(a, b)
+	}
+
+	if c := compareNumbers(va.epoch, vb.epoch); c != 0 {
+		return c
+	}
+	for i := 0; i < len(va.release) || i < len(vb.release); i++ {
+		x, y := "0", "0"
+		if i < len(va.release) {
+			x = va.release[i]
+		}
+		if i < len(vb.release) {
+			y = vb.release[i]
+		}
+		if c := compareNumbers(x, y); c != 0 {
+			return c
+		}
+	}
+	if c := comparePEP440Pre(va, vb); c != 0 {
+		return c
+	}
+	// A post-release follows the release it is based on
+	if c := compareOptional(va.post, vb.post, -1); c != 0 {
+		return c
+	}
+	// A development release precedes the release it leads to
+	if c := compareOptional(va.dev, vb.dev, 1); c != 0 {
+		return c
+	}
+	return compareLocal(va.local, vb.local)
+}
+
+// numericVersion is a parsed semver or NuGet version
+type numericVersion struct {
+	parts      [4]string
+	prerelease []string
+}
+
+// parseNumericVersion parses a version with up to four numeric parts, missing
+// parts being zero, and an optional pre-release label
+func parseNumericVersion(v string) (numericVersion, bool) {
+	match := numericVersionPattern.FindStringSubmatch(strings.TrimSpace(v))
+	if match == nil {
+		return numericVersion{}, false
+	}
+	var parsed numericVersion
+	for i := range parsed.parts {
+		parsed.parts[i] = orZero(match[i+1])
+	}
+	if match[5] != "" {
+		parsed.prerelease = strings.Split(match[5], ".")
+	}
+	return parsed, true
+}
+
+// compareNumericVersions compares the numeric parts, then the pre-release labels:
+// a version without one follows all versions with one, identifiers are compared in
+// turn, numeric identifiers numerically and before alphanumeric ones, and a label
+// that is a prefix of the other comes first
+func compareNumericVersions(a, b numericVersion, foldCase bool) int {
+	for i := range a.parts {
+		if c := compareNumbers(a.parts[i], b.parts[i]); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case len(a.prerelease) == 0 && len(b.prerelease) == 0:
+		return 0
+	case len(a.prerelease) == 0:
+		return 1
+	case len(b.prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(a.prerelease) && i < len(b.prerelease); i++ {
+		x, y := a.prerelease[i], b.prerelease[i]
+		xNumeric, yNumeric := isNumber(x), isNumber(y)
+		var c int
+		switch {
+		case xNumeric && yNumeric:
+			c = compareNumbers(x, y)
+		case xNumeric:
+			c = -1
+		case yNumeric:
+			c = 1
+		case foldCase:
+			c = strings.Compare(strings.ToLower(x), strings.ToLower(y))
+		default:
+			c = strings.Compare(x, y)
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return sign(len(a.prerelease) - len(b.prerelease))
+}
+
+// pep440Version is a parsed PEP 440 version. Optional parts are empty when absent.
+type pep440Version struct {
+	epoch     string
+	release   []string
+	preLabel  string
+	preNumber string
+	post      string
+	dev       string
+	local     []string
+}
+
+// parsePEP440 parses a PEP 440 version in any of the spellings PEP 440 accepts
+func parsePEP440(v string) (pep440Version, bool) {
+	normalized, ok := normalizePEP440(strings.TrimSpace(v))
+	if !ok {
+		return pep440Version{}, false
+	}
+	match := pep440Pattern.FindStringSubmatch(normalized)
+	group := func(name string) string {
+		return match[pep440Pattern.SubexpIndex(name)]
+	}
+
+	parsed := pep440Version{epoch: orZero(group("epoch"))}
+	for _, part := range strings.Split(group("release"), ".") {
+		parsed.release = append(parsed.release, trimZeros(part))
+	}
+	// Trailing zeros do not change the release (1.0 == 1.0.0)
+	for len(parsed.release) > 1 && parsed.release[len(parsed.release)-1] == "0" {
+		parsed.release = parsed.release[:len(parsed.release)-1]
+	}
+	if label := group("pre_l"); label != "" {
+		parsed.preLabel, parsed.preNumber = label, orZero(group("pre_n"))
+	}
+	if group("post_l") != "" {
+		parsed.post = orZero(group("post_n2"))
+	}
+	if group("dev_l") != "" {
+		parsed.dev = orZero(group("dev_n"))
+	}
+	if local := group("local"); local != "" {
+		parsed.local = strings.Split(local, ".")
+	}
+	return parsed, true
+}
+
+// comparePEP440Pre orders the pre-release parts of two versions. A development release
+// of a final release, such as 1.0.dev1, sorts before all of its pre-releases; a release
+// without a pre-release part sorts after them.
+func comparePEP440Pre(a, b pep440Version) int {
+	class := func(v pep440Version) int {
+		switch {
+		case v.preLabel == "" && v.post == "" && v.dev != "":
+			return -1
+		case v.preLabel == "":
+			return 1
+		}
+		return 0
+	}
+	if ca, cb := class(a), class(b); ca != cb || ca != 0 {
+		return sign(ca - cb)
+	}
+	if c := sign(pep440PreReleaseOrder[a.preLabel] - pep440PreReleaseOrder[b.preLabel]); c != 0 {
+		return c
+	}
+	return compareNumbers(a.preNumber, b.preNumber)
+}
+
+// compareOptional compares two optional numbers, an absent number ordering as absent does
+// relative to one that is present: -1 before it, 1 after it
+func compareOptional(x, y string, absent int) int {
+	switch {
+	case x == "" && y == "":
+		return 0
+	case x == "":
+		return absent
+	case y == "":
+		return -absent
+	}
+	return compareNumbers(x, y)
+}
+
+// compareLocal orders local version labels: a version without one comes first, numeric
+// segments follow alphanumeric ones, and a label that is a prefix of the other comes first
+func compareLocal(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		x, y := a[i], b[i]
+		xNumeric, yNumeric := isNumber(x), isNumber(y)
+		var c int
+		switch {
+		case xNumeric && yNumeric:
+			c = compareNumbers(x, y)
+		case xNumeric:
+			c = 1
+		case yNumeric:
+			c = -1
+		default:
+			c = strings.Compare(x, y)
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return sign(len(a) - len(b))
+}
+
+// compareNumbers compares two unsigned decimal numbers of any length
+func compareNumbers(x, y string) int {
+	x, y = trimZeros(x), trimZeros(y)
+	if len(x) != len(y) {
+		return sign(len(x) - len(y))
+	}
+	return strings.Compare(x, y)
+}
+
+// isNumber reports whether s consists only of decimal digits
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,165 @@
+package version
+
+import (
+	"regexp"
+	"strings"
+)
+
+// pep440Pattern is the version pattern of PEP 440, Appendix B, which accepts the
+// alternative spellings the normalized form replaces
+var pep440Pattern = regexp.MustCompile(`(?i)^v?` +
+	`(?:(?P<epoch>[0-9]+)!)?` +
+	`(?P<release>[0-9]+(?:\.[0-9]+)*)` +
+	`(?:[-_.]?(?P<pre_l>alpha|beta|preview|pre|rc|a|b|c)[-_.]?(?P<pre_n>[0-9]+)?)?` +
+	`(?:-(?P<post_n1>[0-9]+)|[-_.]?(?P<post_l>post|rev|r)[-_.]?(?P<post_n2>[0-9]+)?)?` +
+	`(?:[-_.]?(?P<dev_l>dev)[-_.]?(?P<dev_n>[0-9]+)?)?` +
+	`(?:\+(?P<local>[a-z0-9]+(?:[-_.][a-z0-9]+)*))?$`)
+
+// pep440PreReleases maps the pre-release spellings PEP 440 accepts to their normal form
+var pep440PreReleases = map[string]string{
+	"a": "a", "alpha": "a",
+	"b": "b", "beta": "b",
+	"rc": "rc", "c": "rc", "pre": "rc", "preview": "rc",
+}
+
+// numericVersionPattern matches the up to four numeric parts, pre-release label and
+// build metadata of semver and NuGet versions
+var numericVersionPattern = regexp.MustCompile(`^[=v]?([0-9]+)(?:\.([0-9]+))?(?:\.([0-9]+))?(?:\.([0-9]+))?` +
+	`(?:-([0-9A-Za-z.-]+))?(?:\+([0-9A-Za-z.-]+))?$`)
+
+// mavenQualifier matches an alphabetic run in a Maven version
+var mavenQualifier = regexp.MustCompile(`[A-Za-z]+`)
+
+// Normalize rewrites a version in the canonical form of its ecosystem, so a version
+// spelled differently from the advisory data still matches it:
+//
+//   - PyPI: PEP 440 normalization, e.g. "1.0-RC1" becomes "1.0rc1" and "1.0-1" becomes "1.0.post1"
+//   - npm: semver with three parts, e.g. "v1.2" becomes "1.2.0" and "1.2.3.0" becomes "1.2.3"
+//   - NuGet: NuGet's normalized form with a lowercase pre-release label, as used by the
+//     flat container, e.g. "1.0.0.0" becomes "1.0.0" and "1.0.0-Beta" becomes "1.0.0-beta"
+//   - Maven: lowercase qualifiers, with "cr" spelled "rc", e.g. "1.0-RC1" becomes "1.0-rc1"
+//
+// Versions in other ecosystems, and versions that do not follow their ecosystem's
+// syntax, are returned with only surrounding whitespace removed.
+func Normalize(v, ecosystem string) string {
+	v = strings.TrimSpace(v)
+	var normalized string
+	var ok bool
+	switch strings.ToLower(ecosystem) {
+	case "pypi":
+		normalized, ok = normalizePEP440(v)
+	case "npm":
+		normalized, ok = normalizeSemver(v)
+	case "nuget":
+		normalized, ok = normalizeNuGet(v)
+	case "maven":
+		normalized, ok = normalizeMaven(v), true
+	}
+	if !ok {
+		return v
+	}
+	return normalized
+}
+
+// normalizePEP440 returns the normalized form of a PEP 440 version
+func normalizePEP440(v string) (string, bool) {
+	match := pep440Pattern.FindStringSubmatch(v)
+	if match == nil {
+		return "", false
+	}
+	group := func(name string) string {
+		return strings.ToLower(match[pep440Pattern.SubexpIndex(name)])
+	}
+
+	var b strings.Builder
+	if epoch := trimZeros(group("epoch")); epoch != "" && epoch != "0" {
+		b.WriteString(epoch + "!")
+	}
+	for i, part := range strings.Split(group("release"), ".") {
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(trimZeros(part))
+	}
+	if label := group("pre_l"); label != "" {
+		b.WriteString(pep440PreReleases[label] + orZero(group("pre_n")))
+	}
+	if n := group("post_n1"); n != "" {
+		b.WriteString(".post" + trimZeros(n))
+	} else if group("post_l") != "" {
+		b.WriteString(".post" + orZero(group("post_n2")))
+	}
+	if group("dev_l") != "" {
+		b.WriteString(".dev" + orZero(group("dev_n")))
+	}
+	if local := group("local"); local != "" {
+		b.WriteString("+" + strings.NewReplacer("-", ".", "_", ".").Replace(local))
+	}
+	return b.String(), true
+}
+
+// normalizeSemver pads a version to the three parts semver requires and drops a
+// leading 'v' or '='. A fourth part is only dropped when it is zero.
+func normalizeSemver(v string) (string, bool) {
+	match := numericVersionPattern.FindStringSubmatch(v)
+	if match == nil || (match[4] != "" && trimZeros(match[4]) != "0") {
+		return "", false
+	}
+	normalized := trimZeros(match[1]) + "." + orZero(match[2]) + "." + orZero(match[3])
+	if match[5] != "" {
+		normalized += "-" + match[5]
+	}
+	if match[6] != "" {
+		normalized += "+" + match[6]
+	}
+	return normalized, true
+}
+
+// normalizeNuGet returns NuGet's normalized version: at least three parts, a fourth
+// only when it is not zero, and no build metadata. The pre-release label is lowercased,
+// since NuGet compares it without regard to case.
+func normalizeNuGet(v string) (string, bool) {
+	match := numericVersionPattern.FindStringSubmatch(v)
+	if match == nil || strings.HasPrefix(v, "=") {
+		return "", false
+	}
+	normalized := trimZeros(match[1]) + "." + orZero(match[2]) + "." + orZero(match[3])
+	if revision := orZero(match[4]); revision != "0" {
+		normalized += "." + revision
+	}
+	if match[5] != "" {
+		normalized += "-" + strings.ToLower(match[5])
+	}
+	return normalized, true
+}
+
+// normalizeMaven lowercases the qualifiers of a Maven version, which Maven compares
+// without regard to case, and spells the "cr" alias of "rc" as "rc"
+func normalizeMaven(v string) string {
+	return mavenQualifier.ReplaceAllStringFunc(v, func(qualifier string) string {
+		qualifier = strings.ToLower(qualifier)
+		if qualifier == "cr" {
+			return "rc"
+		}
+		return qualifier
+	})
+}
+
+// trimZeros removes the leading zeros of a number, keeping a single "0"
+func trimZeros(n string) string {
+	if n == "" {
+		return ""
+	}
+	if trimmed := strings.TrimLeft(n, "0"); trimmed != "" {
+		return trimmed
+	}
+	return "0"
+}
+
+// orZero returns the number without leading zeros, or "0" when it is absent
+func orZero(n string) string {
+	if n == "" {
+		return "0"
+	}
+	return trimZeros(n)
+}
@@ -0,0 +1,173 @@
+package version
+
+import (
+	"strings"
+	"unicode"
+)
+
+// qualifierOrder ranks well-known pre-release and post-release qualifiers relative
+// to a plain release, which ranks 0. Unknown qualifiers sort after a plain release.
+var qualifierOrder = map[string]int{
+	"dev":       -6,
+	"snapshot":  -5,
+	"alpha":     -4,
+	"a":         -4,
+	"beta":      -3,
+	"b":         -3,
+	"milestone": -2,
+	"m":         -2,
+	"rc":        -1,
+	"cr":        -1,
+	"c":         -1,
+	"pre":       -1,
+	"preview":   -1,
+	"":          0,
+	"final":     0,
+	"ga":        0,
+	"release":   0,
+}
+
+// segment is one numeric or alphabetic part of a version string
+type segment struct {
+	value   string
+	numeric bool
+}
+
+// Compare compares two version strings, returning -1, 0 or 1.
+//
+// Versions are split into numeric and alphabetic segments so that the common
+// semver, PEP 440, Maven and NuGet forms order as expected: numeric segments
+// compare numerically, pre-release qualifiers (alpha, beta, rc, ...) sort before
+// the release they precede, and build metadata after '+' is ignored.
+func Compare(a, b string) int {
+	return compareQualified(a, b, qualifierOrder)
+}
+
+// compareQualified compares two versions as Compare does, ranking qualifiers by ranks
+func compareQualified(a, b string, ranks map[string]int) int {
+	sa, sb := segments(a, ranks), segments(b, ranks)
+
+	for i := 0; i < len(sa) || i < len(sb); i++ {
+		var x, y segment
+		if i < len(sa) {
+			x = sa[i]
+		} else {
+			x = padding(sb[i])
+		}
+		if i < len(sb) {
+			y = sb[i]
+		} else {
+			y = padding(sa[i])
+		}
+
+		if c := compareSegments(x, y, ranks); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// padding returns the segment a shorter version is treated as having where the other has s
+func padding(s segment) segment {
+	if s.numeric {
+		return segment{value: "0", numeric: true}
+	}
+	return segment{}
+}
+
+// compareSegments orders two segments. A number continues the release and so
+// ranks above any qualifier in the same position.
+func compareSegments(x, y segment, ranks map[string]int) int {
+	switch {
+	case x.numeric && y.numeric:
+		if len(x.value) != len(y.value) {
+			return sign(len(x.value) - len(y.value))
+		}
+		return strings.Compare(x.value, y.value)
+	case x.numeric:
+		return 1
+	case y.numeric:
+		return -1
+	}
+
+	if rx, ry := rank(x.value, ranks), rank(y.value, ranks); rx != ry {
+		return sign(rx - ry)
+	}
+	return strings.Compare(x.value, y.value)
+}
+
+// rank returns the ordering of a qualifier relative to a plain release
+func rank(qualifier string, ranks map[string]int) int {
+	if r, ok := ranks[qualifier]; ok {
+		return r
+	}
+	return 1
+}
+
+// sign returns -1, 0 or 1 according to the sign of n
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// segments splits a version into numeric and alphabetic parts, dropping
+// separators, a leading 'v', build metadata and trailing zero segments
+func segments(v string, ranks map[string]int) []segment {
+	v = strings.ToLower(strings.TrimSpace(v))
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.Index(v, "+"); i >= 0 {
+		v = v[:i]
+	}
+
+	var parts []segment
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		part := v[start:end]
+		if unicode.IsDigit(rune(part[0])) {
+			// Leading zeros do not change a number's value
+			part = strings.TrimLeft(part, "0")
+			if part == "" {
+				part = "0"
+			}
+			parts = append(parts, segment{value: part, numeric: true})
+		} else {
+			parts = append(parts, segment{value: part})
+		}
+		start = -1
+	}
+
+	for i, r := range v {
+		digit := unicode.IsDigit(r)
+		if !digit && !unicode.IsLetter(r) {
+			flush(i)
+			continue
+		}
+		if start >= 0 && unicode.IsDigit(rune(v[start])) != digit {
+			flush(i)
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	flush(len(v))
+
+	// Trailing zeros and release markers do not change the version (1.0 == 1.0.0 == 1.0-GA)
+	for len(parts) > 0 {
+		last := parts[len(parts)-1]
+		if last.value != "0" && (last.numeric || rank(last.value, ranks) != 0) {
+			break
+		}
+		parts = parts[:len(parts)-1]
+	}
+
+	return parts
+}
@@ -0,0 +1,291 @@
+package vex
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/squarehole/package-scanner/pkg/models"
+	"github.com/squarehole/package-scanner/pkg/purl"
+)
+
+// Statuses that suppress a finding. Other statuses (affected, under_investigation,
+// exploitable, in_triage) leave the finding in the results.
+var suppressingStatuses = map[string]string{
+	// OpenVEX
+	"not_affected": "not_affected",
+	"fixed":        "fixed",
+	// CycloneDX analysis states
+	"false_positive":         "not_affected",
+	"resolved":               "fixed",
+	"resolved_with_pedigree": "fixed",
+}
+
+// Statement is a single VEX assertion about one vulnerability
+type Statement struct {
+	// VulnerabilityIDs holds the vulnerability ID and any aliases it was given under
+	VulnerabilityIDs []string
+	// Products lists the product or component identifiers the statement applies to
+	Products []string
+	// Status is the normalized status (not_affected or fixed for suppressing statements)
+	Status        string
+	Justification string
+	Source        string
+}
+
+// Document holds the suppressing statements loaded from one or more VEX files
+type Document struct {
+	Statements []Statement
+}
+
+// Load reads OpenVEX or CycloneDX VEX JSON files and merges their suppressing statements
+func Load(paths ...string) (*Document, error) {
+	doc := &Document{}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading VEX file %s: %w", path, err)
+		}
+
+		var probe struct {
+			BOMFormat  string          `json:"bomFormat"`
+			Statements json.RawMessage `json:"statements"`
+		}
+		if err := json.Unmarshal(data, &probe); err != nil {
+			return nil, fmt.Errorf("error parsing VEX file %s: %w", path, err)
+		}
+
+		var statements []Statement
+		switch {
+		case probe.BOMFormat == "CycloneDX":
+			statements, err = parseCycloneDX(data)
+		case probe.Statements != nil:
+			statements, err = parseOpenVEX(data)
+		default:
+			err = fmt.Errorf("unrecognized VEX format")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing VEX file %s: %w", path, err)
+		}
+
+		for i := range statements {
+			statements[i].Source = path
+		}
+		doc.Statements = append(doc.Statements, statements...)
+	}
+
+	return doc, nil
+}
+
+// parseOpenVEX extracts suppressing statements from an OpenVEX document.
+// Both the v0.0.x (string) and v0.2.x (object) forms of vulnerabilities and products are accepted.
+func parseOpenVEX(data []byte) ([]Statement, error) {
+	var doc struct {
+		Statements []struct {
+			Vulnerability   json.RawMessage   `json:"vulnerability"`
+			Products        []json.RawMessage `json:"products"`
+			Status          string            `json:"status"`
+			Justification   string            `json:"justification"`
+			ImpactStatement string            `json:"impact_statement"`
+		} `json:"statements"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	var statements []Statement
+	for _, s := range doc.Statements {
+		status, ok := suppressingStatuses[strings.ToLower(s.Status)]
+		if !ok {
+			continue
+		}
+
+		statement := Statement{Status: status, Justification: s.Justification}
+		if statement.Justification == "" {
+			statement.Justification = s.ImpactStatement
+		}
+
+		var vulnName string
+		var vulnObject struct {
+			ID      string   `json:"@id"`
+			Name    string   `json:"name"`
+			Aliases []string `json:"aliases"`
+		}
+		if err := json.Unmarshal(s.Vulnerability, &vulnName); err == nil {
+			statement.VulnerabilityIDs = []string{vulnName}
+		} else if err := json.Unmarshal(s.Vulnerability, &vulnObject); err == nil {
+			statement.VulnerabilityIDs = append([]string{vulnObject.Name, vulnObject.ID}, vulnObject.Aliases...)
+		}
+
+		for _, raw := range s.Products {
+			var productName string
+			var productObject struct {
+				ID            string `json:"@id"`
+				Subcomponents []struct {
+					ID string `json:"@id"`
+				} `json:"subcomponents"`
+			}
+			if err := json.Unmarshal(raw, &productName); err == nil {
+				statement.Products = append(statement.Products, productName)
+			} else if err := json.Unmarshal(raw, &productObject); err == nil {
+				// Subcomponents are more specific than the product they belong to
+				if len(productObject.Subcomponents) > 0 {
+					for _, sub := range productObject.Subcomponents {
+						statement.Products = append(statement.Products, sub.ID)
+					}
+				} else {
+					statement.Products = append(statement.Products, productObject.ID)
+				}
+			}
+		}
+
+		statements = append(statements, statement)
+	}
+
+	return statements, nil
+}
+
+// parseCycloneDX extracts suppressing statements from a CycloneDX VEX document
+func parseCycloneDX(data []byte) ([]Statement, error) {
+	var doc struct {
+		Components []struct {
+			BOMRef string `json:"bom-ref"`
+			PURL   string `json:"purl"`
+		} `json:"components"`
+		Vulnerabilities []struct {
+			ID       string `json:"id"`
+			Analysis struct {
+				State         string `json:"state"`
+				Justification string `json:"justification"`
+				Detail        string `json:"detail"`
+			} `json:"analysis"`
+			Affects []struct {
+				Ref string `json:"ref"`
+			} `json:"affects"`
+			References []struct {
+				ID string `json:"id"`
+			} `json:"references"`
+		} `json:"vulnerabilities"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	// Resolve bom-ref values to purls where the document lists its components
+	refs := make(map[string]string)
+	for _, component := range doc.Components {
+		if component.BOMRef != "" && component.PURL != "" {
+			refs[component.BOMRef] = component.PURL
+		}
+	}
+
+	var statements []Statement
+	for _, v := range doc.Vulnerabilities {
+		status, ok := suppressingStatuses[strings.ToLower(v.Analysis.State)]
+		if !ok {
+			continue
+		}
+
+		statement := Statement{
+			VulnerabilityIDs: []string{v.ID},
+			Status:           status,
+			Justification:    v.Analysis.Justification,
+		}
+		if v.Analysis.Detail != "" {
+			statement.Justification = strings.TrimSpace(statement.Justification + " " + v.Analysis.Detail)
+		}
+		for _, ref := range v.References {
+			statement.VulnerabilityIDs = append(statement.VulnerabilityIDs, ref.ID)
+		}
+
+		for _, affects := range v.Affects {
+			ref := affects.Ref
+			if resolved, ok := refs[ref]; ok {
+				ref = resolved
+			} else if i := strings.Index(ref, "#pkg:"); i >= 0 {
+				// BOM-Link references carry the purl after the fragment marker
+				ref = ref[i+1:]
+			}
+			statement.Products = append(statement.Products, ref)
+		}
+
+		statements = append(statements, statement)
+	}
+
+	return statements, nil
+}
+
+// Filter splits vulnerabilities for a package into those that remain and those
+// suppressed by a VEX statement
+func (d *Document) Filter(name, version, ecosystem string, vulns []models.Vulnerability) ([]models.Vulnerability, []models.SuppressedVulnerability) {
+	if d == nil || len(d.Statements) == 0 {
+		return vulns, nil
+	}
+
+	pkgURL, pkgErr := purl.FromPackage(name, version, ecosystem)
+
+	var kept []models.Vulnerability
+	var suppressed []models.SuppressedVulnerability
+	for _, vuln := range vulns {
+		statement, ok := d.match(vuln, pkgURL, pkgErr == nil)
+		if !ok {
+			kept = append(kept, vuln)
+			continue
+		}
+		suppressed = append(suppressed, models.SuppressedVulnerability{
+			Vulnerability: vuln,
+			Status:        statement.Status,
+			Justification: statement.Justification,
+			Source:        statement.Source,
+		})
+	}
+
+	return kept, suppressed
+}
+
+// match finds a statement covering the vulnerability for the given package
+func (d *Document) match(vuln models.Vulnerability, pkgURL purl.PackageURL, hasPURL bool) (Statement, bool) {
+	ids := map[string]bool{strings.ToUpper(vuln.ID): true}
+	for _, alias := range vuln.Aliases {
+		ids[strings.ToUpper(alias)] = true
+	}
+
+	for _, statement := range d.Statements {
+		matchesID := false
+		for _, id := range statement.VulnerabilityIDs {
+			if id != "" && ids[strings.ToUpper(id)] {
+				matchesID = true
+				break
+			}
+		}
+		if matchesID && appliesTo(statement, pkgURL, hasPURL) {
+			return statement, true
+		}
+	}
+
+	return Statement{}, false
+}
+
+// appliesTo reports whether a statement covers the package. Product identifiers that
+// are package URLs for a known ecosystem must match the package; other identifiers
+// (product names, OCI or GitHub purls) name the product being scanned as a whole
+// and therefore apply to every package in it.
+func appliesTo(statement Statement, pkgURL purl.PackageURL, hasPURL bool) bool {
+	if len(statement.Products) == 0 {
+		return true
+	}
+
+	for _, product := range statement.Products {
+		productURL, err := purl.Parse(product)
+		if err != nil || productURL.Ecosystem() == "" {
+			return true
+		}
+		if hasPURL && productURL.Matches(pkgURL) {
+			return true
+		}
+	}
+
+	return false
+}